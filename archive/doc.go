@@ -0,0 +1,14 @@
+/*
+Build APT repositories out of local files.
+
+ScanPackages and ScanSources do the job of dpkg-scanpackages(1) and
+dpkg-scansources(1): walk a directory of .deb (or .dsc) files, and produce
+the Packages (or Sources) index entry for each, with the Filename, Size and
+checksums filled in, ready to be written out with WritePackages or
+WriteSources.
+
+Once the indices are in place under dists/<suite>, ReleaseWriter hashes
+them all and writes the Release file for the suite, and (given a signing
+key) the clearsigned InRelease.
+*/
+package archive // import "pault.ag/go/debian/archive"
@@ -0,0 +1,230 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package archive // import "pault.ag/go/debian/archive"
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/hashio"
+)
+
+// ReleaseWriter {{{
+
+// ReleaseWriter writes the Release (and InRelease) file for a suite, once
+// all of its indices are in place under dists/<suite>.
+type ReleaseWriter struct {
+	// Fields to copy into the Release, such as Origin, Label, Suite and
+	// Codename. If Date is zero, the current time is used. If
+	// Architectures or Components are empty, they're worked out from the
+	// binary-<arch> and source directories on disk. Any hashes are
+	// ignored; they are always computed from the files.
+	Release control.Release
+
+	// If set, Valid-Until is set this long after Date.
+	ValidFor time.Duration
+
+	// Which hashes to list, out of "md5", "sha1", "sha256" and "sha512".
+	// If empty, DefaultReleaseHashes are used.
+	Hashes []string
+
+	// If set, an InRelease file is written, clearsigned with this entity.
+	// The entity's private key must already be decrypted.
+	Signer *openpgp.Entity
+}
+
+// Hashes listed in a Release when ReleaseWriter.Hashes is empty, the same
+// as the Debian archive.
+var DefaultReleaseHashes = []string{"md5", "sha256"}
+
+// Files at the top of a suite that are never listed in its Release.
+var releaseFiles = map[string]bool{
+	"Release":     true,
+	"InRelease":   true,
+	"Release.gpg": true,
+}
+
+// Write the Release file for the suite in the directory dists (such as
+// "dists/unstable"), listing every file under it, and sign it if there's
+// a Signer. The Release that was written is returned.
+func (w ReleaseWriter) Write(dists string) (*control.Release, error) {
+	release := w.Release
+	release.Paragraph = control.Paragraph{}
+	release.MD5Sum = nil
+	release.SHA1 = nil
+	release.SHA256 = nil
+	release.SHA512 = nil
+
+	if release.Date.IsZero() {
+		release.Date = time.Now().UTC().Truncate(time.Second)
+	}
+	if w.ValidFor != 0 {
+		release.ValidUntil = release.Date.Add(w.ValidFor)
+	}
+
+	hashes := w.Hashes
+	if len(hashes) == 0 {
+		hashes = DefaultReleaseHashes
+	}
+
+	components := map[string]bool{}
+	architectures := map[string]bool{}
+
+	if err := filepath.WalkDir(dists, func(pathname string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		filename, err := relative(dists, pathname)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == "by-hash" {
+				return filepath.SkipDir
+			}
+			parts := strings.Split(filename, "/")
+			if len(parts) == 2 && (parts[1] == "source" || strings.HasPrefix(parts[1], "binary-")) {
+				components[parts[0]] = true
+				if strings.HasPrefix(parts[1], "binary-") {
+					architectures[strings.TrimPrefix(parts[1], "binary-")] = true
+				}
+			}
+			return nil
+		}
+		if releaseFiles[filename] {
+			return nil
+		}
+		return addHashes(&release, pathname, filename, hashes)
+	}); err != nil {
+		return nil, err
+	}
+
+	/* The walk goes a directory at a time, which isn't quite the same
+	 * order as sorting the whole path */
+	sort.Slice(release.MD5Sum, func(i, j int) bool { return release.MD5Sum[i].Filename < release.MD5Sum[j].Filename })
+	sort.Slice(release.SHA1, func(i, j int) bool { return release.SHA1[i].Filename < release.SHA1[j].Filename })
+	sort.Slice(release.SHA256, func(i, j int) bool { return release.SHA256[i].Filename < release.SHA256[j].Filename })
+	sort.Slice(release.SHA512, func(i, j int) bool { return release.SHA512[i].Filename < release.SHA512[j].Filename })
+
+	if len(release.Components) == 0 {
+		release.Components = sortedKeys(components)
+	}
+	if len(release.Architectures) == 0 {
+		for _, name := range sortedKeys(architectures) {
+			arch, err := dependency.ParseArch(name)
+			if err != nil {
+				return nil, err
+			}
+			release.Architectures = append(release.Architectures, *arch)
+		}
+	}
+
+	out := bytes.Buffer{}
+	if err := control.Marshal(&out, release); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dists, "Release"), out.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+
+	if w.Signer != nil {
+		signed := bytes.Buffer{}
+		if err := sign(&signed, w.Signer, out.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(dists, "InRelease"), signed.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return &release, nil
+}
+
+// }}}
+
+// Helpers {{{
+
+// Hash the file at pathname, and list it in the Release as filename.
+func addHashes(release *control.Release, pathname, filename string, hashes []string) error {
+	fd, err := os.Open(pathname)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	writer, hashers, err := hashio.NewHasherWriters(hashes, io.Discard)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, fd); err != nil {
+		return err
+	}
+
+	for _, hasher := range hashers {
+		hash := control.FileHashFromHasher(filename, *hasher)
+		switch hasher.Name() {
+		case "md5":
+			release.MD5Sum = append(release.MD5Sum, control.MD5FileHash{FileHash: hash})
+		case "sha1":
+			release.SHA1 = append(release.SHA1, control.SHA1FileHash{FileHash: hash})
+		case "sha256":
+			release.SHA256 = append(release.SHA256, control.SHA256FileHash{FileHash: hash})
+		case "sha512":
+			release.SHA512 = append(release.SHA512, control.SHA512FileHash{FileHash: hash})
+		}
+	}
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	ret := []string{}
+	for key := range set {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Clearsign data with the entity's private key.
+func sign(out io.Writer, signer *openpgp.Entity, data []byte) error {
+	writer, err := clearsign.Encode(out, signer.PrivateKey, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// }}}
+
+// vim: foldmethod=marker
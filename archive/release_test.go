@@ -0,0 +1,107 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package archive_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"pault.ag/go/debian/archive"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/pgp"
+)
+
+/*
+ *
+ */
+
+func TestReleaseWriter(t *testing.T) {
+	dists := filepath.Join(t.TempDir(), "dists", "stable")
+	packages := []byte("Package: hello\nVersion: 1.0\n")
+	writeFile(t, filepath.Join(dists, "main/binary-amd64/Packages"), packages)
+	writeFile(t, filepath.Join(dists, "main/binary-arm64/Packages"), []byte{})
+	writeFile(t, filepath.Join(dists, "main/source/Sources"), []byte{})
+	writeFile(t, filepath.Join(dists, "contrib/binary-amd64/Packages"), []byte{})
+	writeFile(t, filepath.Join(dists, "main/binary-amd64/by-hash/SHA256/abc"), []byte{})
+	writeFile(t, filepath.Join(dists, "Release.gpg"), []byte("old signature"))
+
+	signer, err := openpgp.NewEntity("Test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	isok(t, err)
+
+	date := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	writer := archive.ReleaseWriter{
+		Release: control.Release{
+			Origin: "Example",
+			Suite:  "stable",
+			Date:   date,
+		},
+		ValidFor: 7 * 24 * time.Hour,
+		Signer:   signer,
+	}
+	release, err := writer.Write(dists)
+	isok(t, err)
+	assert(t, release.ValidUntil.Equal(date.Add(7*24*time.Hour)))
+
+	/* Read back what was written, checking the signature */
+	f, err := os.Open(filepath.Join(dists, "InRelease"))
+	isok(t, err)
+	defer f.Close()
+	written, _, err := pgp.ParseSignedRelease(f, openpgp.EntityList{signer})
+	isok(t, err)
+	assert(t, written.Origin == "Example")
+	assert(t, written.Date.Equal(date))
+	assert(t, written.ValidUntil.Equal(date.Add(7*24*time.Hour)))
+	assert(t, len(written.Components) == 2)
+	assert(t, written.Components[0] == "contrib" && written.Components[1] == "main")
+	assert(t, len(written.Architectures) == 2)
+	assert(t, written.Architectures[0].String() == "amd64")
+	assert(t, written.Architectures[1].String() == "arm64")
+
+	assert(t, len(written.SHA1) == 0)
+	assert(t, len(written.MD5Sum) == 4)
+	assert(t, len(written.SHA256) == 4)
+	assert(t, written.SHA256[0].Filename == "contrib/binary-amd64/Packages")
+	assert(t, written.SHA256[1].Filename == "main/binary-amd64/Packages")
+	assert(t, written.SHA256[1].Size == int64(len(packages)))
+	assert(t, written.SHA256[1].Hash == fmt.Sprintf("%x", sha256.Sum256(packages)))
+	assert(t, written.MD5Sum[1].Hash == fmt.Sprintf("%x", md5.Sum(packages)))
+
+	/* The plain Release is the same as the signed one */
+	plain, err := os.ReadFile(filepath.Join(dists, "Release"))
+	isok(t, err)
+	assert(t, bytes.Contains(plain, []byte("Valid-Until: Thu, 22 Oct 2026 12:00:00 UTC\n")))
+
+	/* Hashes have to be ones we know about */
+	writer = archive.ReleaseWriter{Hashes: []string{"crc32"}}
+	_, err = writer.Write(dists)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
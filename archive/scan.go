@@ -0,0 +1,277 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package archive // import "pault.ag/go/debian/archive"
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/hashio"
+)
+
+// Helpers {{{
+
+// Call fn with every file under dir with the given suffix, in lexical
+// order, so the index comes out the same every time.
+func walk(dir, suffix string, fn func(pathname string) error) error {
+	return filepath.WalkDir(dir, func(pathname string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), suffix) {
+			return nil
+		}
+		return fn(pathname)
+	})
+}
+
+// Return the path of pathname relative to root, the way it's written in an
+// index: with forward slashes, and never starting with "../".
+func relative(root, pathname string) (string, error) {
+	rel, err := filepath.Rel(root, pathname)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s is not under %s", pathname, root)
+	}
+	return rel, nil
+}
+
+// Read a whole file through the named hashes, returning the Hashers.
+func hashFile(fd io.ReadSeeker, hashes ...string) ([]*hashio.Hasher, error) {
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	writer, hashers, err := hashio.NewHasherWriters(hashes, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(writer, fd); err != nil {
+		return nil, err
+	}
+	return hashers, nil
+}
+
+// Set each of the fields in the order given just before the field named
+// before (or at the end, if there's no such field), the way the archive
+// lays out the fields it adds to each entry.
+func insertBefore(para *control.Paragraph, before string, keys []string, values map[string]string) {
+	order := []string{}
+	for _, key := range para.Order {
+		if _, ok := values[key]; !ok {
+			order = append(order, key)
+		}
+	}
+	at := len(order)
+	for i, key := range order {
+		if key == before {
+			at = i
+			break
+		}
+	}
+	para.Order = append(append(append([]string{}, order[:at]...), keys...), order[at:]...)
+	for _, key := range keys {
+		para.Values[key] = values[key]
+	}
+}
+
+// }}}
+
+// Packages {{{
+
+// Build the Packages entry for the .deb at pathname, which must be under
+// root (the top of the repository, which Filename is relative to).
+func ScanDeb(root, pathname string) (*control.BinaryIndex, error) {
+	filename, err := relative(root, pathname)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := os.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	info, err := deb.ReadControl(fd, deb.ControlOptions{SkipMD5Sums: true})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", pathname, err)
+	}
+	para := info.Control.Paragraph
+
+	hashers, err := hashFile(fd, "md5", "sha256")
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	for key, value := range para.Values {
+		values[key] = value
+	}
+	entry := control.Paragraph{Order: append([]string{}, para.Order...), Values: values}
+	insertBefore(&entry, "Description", []string{"Filename", "Size", "MD5sum", "SHA256"}, map[string]string{
+		"Filename": filename,
+		"Size":     strconv.FormatInt(hashers[0].Size(), 10),
+		"MD5sum":   fmt.Sprintf("%x", hashers[0].Sum(nil)),
+		"SHA256":   fmt.Sprintf("%x", hashers[1].Sum(nil)),
+	})
+
+	index := control.BinaryIndex{}
+	if err := control.UnpackFromParagraph(entry, &index); err != nil {
+		return nil, fmt.Errorf("%s: %s", pathname, err)
+	}
+	return &index, nil
+}
+
+// Call fn with the Packages entry of every .deb under dir, which must be
+// under root, the top of the repository. Entries are handed over one at a
+// time, so even a very large pile of .debs can be indexed.
+func ScanPackages(root, dir string, fn func(*control.BinaryIndex) error) error {
+	return walk(dir, ".deb", func(pathname string) error {
+		index, err := ScanDeb(root, pathname)
+		if err != nil {
+			return err
+		}
+		return fn(index)
+	})
+}
+
+// Write out a Packages file for every .deb under dir, with Filename
+// relative to root, like `dpkg-scanpackages`.
+func WritePackages(out io.Writer, root, dir string) error {
+	first := true
+	return ScanPackages(root, dir, func(index *control.BinaryIndex) error {
+		return writeParagraph(out, &first, index.Paragraph)
+	})
+}
+
+func writeParagraph(out io.Writer, first *bool, para control.Paragraph) error {
+	if !*first {
+		if _, err := io.WriteString(out, "\n"); err != nil {
+			return err
+		}
+	}
+	*first = false
+	return para.WriteTo(out)
+}
+
+// }}}
+
+// Sources {{{
+
+// Build the Sources entry for the .dsc at pathname, which must be under
+// root. The .dsc is added to the list of files, and the Source field is
+// renamed to Package, as in the archive.
+func ScanDsc(root, pathname string) (*control.SourceIndex, error) {
+	filename, err := relative(root, pathname)
+	if err != nil {
+		return nil, err
+	}
+
+	dsc, err := control.ParseDscFile(pathname)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", pathname, err)
+	}
+
+	fd, err := os.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	hashers, err := hashFile(fd, "md5", "sha1", "sha256")
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(filename)
+
+	entry := control.Paragraph{Order: []string{}, Values: map[string]string{}}
+	for _, key := range dsc.Order {
+		value := dsc.Values[key]
+		switch key {
+		case "Source":
+			key = "Package"
+		case "Files", "Checksums-Sha1", "Checksums-Sha256":
+			hasher := map[string]*hashio.Hasher{
+				"Files":            hashers[0],
+				"Checksums-Sha1":   hashers[1],
+				"Checksums-Sha256": hashers[2],
+			}[key]
+			value = addFile(value, fmt.Sprintf("%x %d %s", hasher.Sum(nil), hasher.Size(), name))
+		}
+		entry.Set(key, value)
+	}
+	insertBefore(&entry, "Files", []string{"Directory"}, map[string]string{
+		"Directory": path.Dir(filename),
+	})
+
+	index := control.SourceIndex{}
+	if err := control.UnpackFromParagraph(entry, &index); err != nil {
+		return nil, fmt.Errorf("%s: %s", pathname, err)
+	}
+	return &index, nil
+}
+
+// Add a line to a list of files, such as Checksums-Sha256, putting the
+// whole list on continuation lines.
+func addFile(value, line string) string {
+	lines := []string{line}
+	for _, existing := range strings.Split(value, "\n") {
+		if existing = strings.TrimSpace(existing); existing != "" {
+			lines = append(lines, existing)
+		}
+	}
+	return "\n" + strings.Join(lines, "\n")
+}
+
+// Call fn with the Sources entry of every .dsc under dir, which must be
+// under root, the top of the repository.
+func ScanSources(root, dir string, fn func(*control.SourceIndex) error) error {
+	return walk(dir, ".dsc", func(pathname string) error {
+		index, err := ScanDsc(root, pathname)
+		if err != nil {
+			return err
+		}
+		return fn(index)
+	})
+}
+
+// Write out a Sources file for every .dsc under dir, with Directory
+// relative to root, like `dpkg-scansources`.
+func WriteSources(out io.Writer, root, dir string) error {
+	first := true
+	return ScanSources(root, dir, func(index *control.SourceIndex) error {
+		return writeParagraph(out, &first, index.Paragraph)
+	})
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,182 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package archive_test
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/archive"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// Build a .deb with the given control file, and nothing in the data member.
+func buildDeb(t *testing.T, controlFile string) []byte {
+	tarball := func(files map[string]string) []byte {
+		out := bytes.Buffer{}
+		w := tar.NewWriter(&out)
+		for name, content := range files {
+			isok(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+			_, err := w.Write([]byte(content))
+			isok(t, err)
+		}
+		isok(t, w.Close())
+		return out.Bytes()
+	}
+
+	out := bytes.Buffer{}
+	w := deb.NewArWriter(&out)
+	isok(t, w.WriteEntry("debian-binary", []byte("2.0\n")))
+	isok(t, w.WriteEntry("control.tar", tarball(map[string]string{"./control": controlFile})))
+	isok(t, w.WriteEntry("data.tar", tarball(map[string]string{})))
+	return out.Bytes()
+}
+
+func writeFile(t *testing.T, pathname string, data []byte) {
+	isok(t, os.MkdirAll(filepath.Dir(pathname), 0755))
+	isok(t, os.WriteFile(pathname, data, 0644))
+}
+
+// {{{ dsc
+const helloDsc = `-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA256
+
+Format: 3.0 (quilt)
+Source: hello
+Binary: hello
+Architecture: any
+Version: 2.10-3
+Maintainer: Santiago Vila <sanvila@debian.org>
+Standards-Version: 4.6.1
+Build-Depends: debhelper-compat (= 13)
+Checksums-Sha1:
+ f7bebf6f9c62a2295e889f66e05ce9bfaed9ace3 725946 hello_2.10.orig.tar.gz
+Checksums-Sha256:
+ 31e066137a962676e89f69d1b65382de95a7ef7d914b8cb956f41ea72e0f516b 725946 hello_2.10.orig.tar.gz
+Files:
+ 6cd0ffea3884a4e79330338dcc2987d6 725946 hello_2.10.orig.tar.gz
+-----BEGIN PGP SIGNATURE-----
+
+iQ==
+-----END PGP SIGNATURE-----
+`
+
+// }}}
+
+func TestWritePackages(t *testing.T) {
+	root := t.TempDir()
+	hello := buildDeb(t, "Package: hello\nVersion: 2.10-3\nArchitecture: amd64\nMaintainer: Santiago Vila <sanvila@debian.org>\nInstalled-Size: 280\nDepends: libc6 (>= 2.34)\nDescription: example package\n greets the world\n")
+	world := buildDeb(t, "Package: world\nVersion: 1.0\nArchitecture: all\nMaintainer: Someone <someone@example.com>\nDescription: the world\n")
+	writeFile(t, filepath.Join(root, "pool/main/h/hello/hello_2.10-3_amd64.deb"), hello)
+	writeFile(t, filepath.Join(root, "pool/main/w/world/world_1.0_all.deb"), world)
+	writeFile(t, filepath.Join(root, "pool/main/w/world/README"), []byte("not a deb"))
+
+	out := bytes.Buffer{}
+	isok(t, archive.WritePackages(&out, root, filepath.Join(root, "pool")))
+
+	index, err := control.ParseBinaryIndex(bufio.NewReader(&out))
+	isok(t, err)
+	assert(t, len(index) == 2)
+	assert(t, index[0].Package == "hello")
+	assert(t, index[0].Filename == "pool/main/h/hello/hello_2.10-3_amd64.deb")
+	assert(t, index[0].Size == len(hello))
+	assert(t, index[0].MD5sum == fmt.Sprintf("%x", md5.Sum(hello)))
+	assert(t, index[0].SHA256 == fmt.Sprintf("%x", sha256.Sum256(hello)))
+	assert(t, index[0].InstalledSize == 280)
+	assert(t, index[0].GetDepends().Relations[0].Possibilities[0].Name == "libc6")
+	assert(t, index[0].Order[len(index[0].Order)-1] == "Description")
+	assert(t, index[0].Order[len(index[0].Order)-2] == "SHA256")
+	assert(t, index[1].Package == "world")
+	assert(t, index[1].SHA256 == fmt.Sprintf("%x", sha256.Sum256(world)))
+
+	/* Not a .deb, but named like one */
+	writeFile(t, filepath.Join(root, "pool/main/b/broken/broken.deb"), []byte("nope"))
+	notok(t, archive.WritePackages(&bytes.Buffer{}, root, filepath.Join(root, "pool")))
+
+	/* Everything has to be under root */
+	_, err = archive.ScanDeb(filepath.Join(root, "pool/main/w"), filepath.Join(root, "pool/main/h/hello/hello_2.10-3_amd64.deb"))
+	notok(t, err)
+}
+
+func TestWriteSources(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "pool/main/h/hello/hello_2.10-3.dsc"), []byte(helloDsc))
+
+	out := bytes.Buffer{}
+	isok(t, archive.WriteSources(&out, root, root))
+	assert(t, !strings.Contains(out.String(), "PGP"))
+
+	index, err := control.ParseSourceIndex(bufio.NewReader(&out))
+	isok(t, err)
+	assert(t, len(index) == 1)
+	assert(t, index[0].Package == "hello")
+	assert(t, index[0].Directory == "pool/main/h/hello")
+	assert(t, index[0].Version.String() == "2.10-3")
+	assert(t, len(index[0].ChecksumsSha256) == 2)
+	assert(t, index[0].ChecksumsSha256[0].Filename == "hello_2.10-3.dsc")
+	assert(t, index[0].ChecksumsSha256[0].Hash == fmt.Sprintf("%x", sha256.Sum256([]byte(helloDsc))))
+	assert(t, index[0].ChecksumsSha256[0].Size == int64(len(helloDsc)))
+	assert(t, index[0].ChecksumsSha256[1].Filename == "hello_2.10.orig.tar.gz")
+	assert(t, len(index[0].Files) == 2)
+	assert(t, len(index[0].ChecksumsSha1) == 2)
+	assert(t, index[0].GetBuildDepends().Relations[0].Possibilities[0].Name == "debhelper-compat")
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,315 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package buildinfo // import "pault.ag/go/debian/buildinfo"
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/dpkg"
+	"pault.ag/go/debian/hashio"
+	"pault.ag/go/debian/version"
+)
+
+// Package {{{
+
+// A Package is one of the Installed-Build-Depends: a package, at the exact
+// version that was installed when the package was built.
+type Package struct {
+	Name string
+
+	// Set for Multi-Arch: same packages, which dpkg-genbuildinfo qualifies
+	// with their architecture ("libc6:amd64").
+	Arch *dependency.Arch
+
+	Version version.Version
+}
+
+func (p Package) String() string {
+	name := p.Name
+	if p.Arch != nil {
+		name += ":" + p.Arch.String()
+	}
+	return name + " (= " + p.Version.String() + ")"
+}
+
+// Return the Installed-Build-Depends of a .buildinfo. Every relation must
+// be a single package at an exact version, as dpkg-genbuildinfo writes it.
+func Installed(info *control.Buildinfo) ([]Package, error) {
+	ret := []Package{}
+	for _, relation := range info.InstalledBuildDepends.Relations {
+		if len(relation.Possibilities) != 1 {
+			return nil, fmt.Errorf("Installed-Build-Depends: '%s' has alternatives", relation)
+		}
+		possi := relation.Possibilities[0]
+		if possi.Version == nil || possi.Version.Operator != "=" {
+			return nil, fmt.Errorf("Installed-Build-Depends: '%s' isn't an exact version", relation)
+		}
+		ver, err := version.Parse(possi.Version.Number)
+		if err != nil {
+			return nil, fmt.Errorf("Installed-Build-Depends: %s: %s", possi.Name, err)
+		}
+		ret = append(ret, Package{Name: possi.Name, Arch: possi.Arch, Version: ver})
+	}
+	return ret, nil
+}
+
+// Return every package that's installed (or half way through being
+// upgraded) in a dpkg status database, sorted by name, for a Snapshot.
+func InstalledFromStatus(db *dpkg.StatusDatabase) []Package {
+	ret := []Package{}
+	for _, pkg := range db.Installed() {
+		entry := Package{Name: pkg.Package, Version: pkg.Version}
+		if pkg.MultiArch == control.MultiArchSame {
+			arch := pkg.Architecture
+			entry.Arch = &arch
+		}
+		ret = append(ret, entry)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].String() < ret[j].String()
+	})
+	return ret
+}
+
+// }}}
+
+// Environment {{{
+
+// A Variable is an environment variable, from the Environment field.
+type Variable struct {
+	Name  string
+	Value string
+}
+
+// Variables dpkg-genbuildinfo records in the Environment field, since they
+// can change what a build does. Everything else (such as HOME, or anything
+// that might hold a secret) is left out.
+var AllowedEnvironment = []string{
+	/* Toolchain */
+	"CC", "CPP", "CXX", "OBJC", "OBJCXX", "PC", "FC", "M2C", "GCJ", "GDC",
+	"AS", "LD", "AR", "RANLIB", "MAKE", "AWK", "LEX", "YACC",
+	/* Toolchain flags */
+	"ASFLAGS", "CFLAGS", "CPPFLAGS", "CXXFLAGS", "OBJCFLAGS", "OBJCXXFLAGS",
+	"GCJFLAGS", "DFLAGS", "FFLAGS", "LDFLAGS", "ARFLAGS", "MAKEFLAGS",
+	/* Dynamic linker */
+	"LD_LIBRARY_PATH",
+	/* Locale */
+	"LANG", "LC_ALL", "LC_CTYPE", "LC_NUMERIC", "LC_TIME", "LC_COLLATE",
+	"LC_MONETARY", "LC_MESSAGES", "LC_PAPER", "LC_NAME", "LC_ADDRESS",
+	"LC_TELEPHONE", "LC_MEASUREMENT", "LC_IDENTIFICATION",
+	/* Build */
+	"DEB_BUILD_OPTIONS", "DEB_BUILD_PROFILES", "DEB_VENDOR",
+	"DEB_BUILD_MAINT_OPTIONS", "DEB_RULES_REQUIRES_ROOT",
+	"DPKG_ROOT", "DPKG_ADMINDIR", "DPKG_DATADIR", "DPKG_ORIGINS_DIR",
+	"SOURCE_DATE_EPOCH",
+}
+
+// Return the variables from an environment (as from os.Environ) that
+// dpkg-genbuildinfo would record.
+func FilterEnvironment(environ []string) map[string]string {
+	allowed := map[string]bool{}
+	for _, name := range AllowedEnvironment {
+		allowed[name] = true
+	}
+	ret := map[string]string{}
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if ok && allowed[name] {
+			ret[name] = value
+		}
+	}
+	return ret
+}
+
+// Return the variables of the Environment field, in the order they're
+// listed. Each line is NAME="value", with any '"' or '\' in the value
+// escaped by a '\'.
+func Environment(info *control.Buildinfo) ([]Variable, error) {
+	ret := []Variable{}
+	for _, line := range strings.Split(info.Environment, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, quoted, ok := strings.Cut(line, "=")
+		if !ok || len(quoted) < 2 || quoted[0] != '"' || quoted[len(quoted)-1] != '"' {
+			return nil, fmt.Errorf("Environment: malformed line '%s'", line)
+		}
+		value := strings.Builder{}
+		quoted = quoted[1 : len(quoted)-1]
+		for i := 0; i < len(quoted); i++ {
+			if quoted[i] == '\\' && i+1 < len(quoted) {
+				i++
+			}
+			value.WriteByte(quoted[i])
+		}
+		ret = append(ret, Variable{Name: name, Value: value.String()})
+	}
+	return ret, nil
+}
+
+func formatEnvironment(environment map[string]string) string {
+	names := []string{}
+	for name := range environment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []string{}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	for _, name := range names {
+		lines = append(lines, name+`="`+escape.Replace(environment[name])+`"`)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	/* Starting on the line after the field name, as dpkg does */
+	return "\n" + strings.Join(lines, "\n")
+}
+
+// }}}
+
+// Generate {{{
+
+// A Snapshot is what's known about a build, from which Generate writes a
+// .buildinfo.
+type Snapshot struct {
+	Source        string
+	Version       version.Version
+	Binaries      []string
+	Architectures []dependency.Arch
+
+	BuildOrigin        string
+	BuildArchitecture  dependency.Arch
+	BuildKernelVersion string
+	BuildDate          time.Time
+	BuildPath          string
+	BuildTaintedBy     []string
+
+	// What was installed during the build, such as from
+	// InstalledFromStatus.
+	Installed []Package
+
+	// The build's environment, which is run through FilterEnvironment
+	// first, so os.Environ() can be passed as it is.
+	Environment []string
+
+	// The paths of what the build produced, to be checksummed.
+	Files []string
+}
+
+// Checksum a file, returning its md5, sha1 and sha256 FileHashes.
+func checksum(path string) ([]control.FileHash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	writer, hashers, err := hashio.NewHasherWriters([]string{"md5", "sha1", "sha256"}, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(writer, f); err != nil {
+		return nil, err
+	}
+	ret := []control.FileHash{}
+	for _, hasher := range hashers {
+		ret = append(ret, control.FileHashFromHasher(filepath.Base(path), *hasher))
+	}
+	return ret, nil
+}
+
+// Create a Buildinfo describing the build in the Snapshot, checksumming
+// the files it produced. Write it out with control.Marshal (and sign it
+// with pgp.SignFile, if it's being uploaded).
+func Generate(snapshot Snapshot) (*control.Buildinfo, error) {
+	if snapshot.Source == "" {
+		return nil, fmt.Errorf("Snapshot has no Source")
+	}
+	info := control.Buildinfo{
+		Format:             "1.0",
+		Source:             snapshot.Source,
+		Binaries:           snapshot.Binaries,
+		Architectures:      snapshot.Architectures,
+		Version:            snapshot.Version,
+		BuildOrigin:        snapshot.BuildOrigin,
+		BuildArchitecture:  snapshot.BuildArchitecture,
+		BuildKernelVersion: snapshot.BuildKernelVersion,
+		BuildPath:          snapshot.BuildPath,
+		BuildTaintedBy:     snapshot.BuildTaintedBy,
+		Environment:        formatEnvironment(FilterEnvironment(snapshot.Environment)),
+	}
+	if !snapshot.BuildDate.IsZero() {
+		/* dpkg writes "+0000", not "UTC" */
+		info.BuildDate = snapshot.BuildDate.In(time.FixedZone("", 0))
+	}
+
+	for _, path := range snapshot.Files {
+		hashes, err := checksum(path)
+		if err != nil {
+			return nil, err
+		}
+		info.ChecksumsMd5 = append(info.ChecksumsMd5, control.MD5FileHash{FileHash: hashes[0]})
+		info.ChecksumsSha1 = append(info.ChecksumsSha1, control.SHA1FileHash{FileHash: hashes[1]})
+		info.ChecksumsSha256 = append(info.ChecksumsSha256, control.SHA256FileHash{FileHash: hashes[2]})
+	}
+
+	relations := []string{}
+	for _, pkg := range snapshot.Installed {
+		relations = append(relations, pkg.String())
+	}
+	installed := &dependency.Dependency{}
+	if len(relations) != 0 {
+		var err error
+		if installed, err = dependency.Parse(strings.Join(relations, ", ")); err != nil {
+			return nil, err
+		}
+	}
+	info.InstalledBuildDepends = *installed
+
+	/* One package per line, as dpkg-genbuildinfo does; Marshal keeps
+	 * this, since it only differs from what it'd write by whitespace. */
+	para, err := control.ConvertToParagraph(&info)
+	if err != nil {
+		return nil, err
+	}
+	if len(installed.Relations) != 0 {
+		para.Set("Installed-Build-Depends", installed.Format(dependency.FormatOptions{
+			Field:       "Installed-Build-Depends",
+			Column:      -1,
+			ShortIndent: true,
+		}))
+	}
+	info.Paragraph = *para
+	return &info, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,208 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package buildinfo_test
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pault.ag/go/debian/buildinfo"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/dpkg"
+	"pault.ag/go/debian/version"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// {{{ hello buildinfo
+const helloBuildinfo = `Format: 1.0
+Source: hello
+Binary: hello
+Architecture: amd64
+Version: 2.10-3
+Checksums-Md5:
+ 1ff5b9c0ef1b7d4a0c1c2ec6bd0ec0d4 53132 hello_2.10-3_amd64.deb
+Checksums-Sha1:
+ 1c10d7bc5f5a5c7c6b70cc8b7e1b0ad1f5b2f0e3 53132 hello_2.10-3_amd64.deb
+Checksums-Sha256:
+ 8f2ac8a1a3b5b66c7cf5bb5e0b0bd5f6a3e3b2b5bfa8b6df0b3cc3f5a0e6d1a2 53132 hello_2.10-3_amd64.deb
+Build-Origin: Debian
+Build-Architecture: amd64
+Build-Date: Sun, 11 Dec 2022 18:14:23 +0000
+Build-Path: /build/reproducible-path/hello-2.10
+Installed-Build-Depends:
+ autoconf (= 2.71-3),
+ base-files (= 12.4),
+ libc6:amd64 (= 2.36-9),
+ libc6-dev:amd64 (= 2.36-9)
+Environment:
+ DEB_BUILD_OPTIONS="parallel=4"
+ LANG="C.UTF-8"
+ SOURCE_DATE_EPOCH="1670782463"
+ CFLAGS="-O2 \"quoted\" \\back"
+`
+
+// }}}
+
+func TestInstalled(t *testing.T) {
+	info, err := control.ParseBuildinfo(bufio.NewReader(strings.NewReader(helloBuildinfo)), "")
+	isok(t, err)
+
+	installed, err := buildinfo.Installed(info)
+	isok(t, err)
+	assert(t, len(installed) == 4)
+	assert(t, installed[0].Name == "autoconf")
+	assert(t, installed[0].Arch == nil)
+	assert(t, installed[0].Version.String() == "2.71-3")
+	assert(t, installed[2].Name == "libc6")
+	assert(t, installed[2].Arch.String() == "amd64")
+	assert(t, installed[2].String() == "libc6:amd64 (= 2.36-9)")
+
+	dep, err := dependency.Parse("foo (>= 1.0)")
+	isok(t, err)
+	info.InstalledBuildDepends = *dep
+	_, err = buildinfo.Installed(info)
+	notok(t, err)
+}
+
+func TestEnvironment(t *testing.T) {
+	info, err := control.ParseBuildinfo(bufio.NewReader(strings.NewReader(helloBuildinfo)), "")
+	isok(t, err)
+
+	environment, err := buildinfo.Environment(info)
+	isok(t, err)
+	assert(t, len(environment) == 4)
+	assert(t, environment[0].Name == "DEB_BUILD_OPTIONS")
+	assert(t, environment[0].Value == "parallel=4")
+	assert(t, environment[3].Value == `-O2 "quoted" \back`)
+
+	info.Environment = "LANG=C"
+	_, err = buildinfo.Environment(info)
+	notok(t, err)
+
+	filtered := buildinfo.FilterEnvironment([]string{"LANG=C", "HOME=/root", "GPG_PASSPHRASE=hunter2"})
+	assert(t, len(filtered) == 1)
+	assert(t, filtered["LANG"] == "C")
+}
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	deb := filepath.Join(dir, "hello_2.10-3_amd64.deb")
+	isok(t, os.WriteFile(deb, []byte("not really a deb\n"), 0644))
+
+	status, err := dpkg.ParseStatus(strings.NewReader(`Package: libc6
+Status: install ok installed
+Architecture: amd64
+Multi-Arch: same
+Version: 2.36-9
+
+Package: base-files
+Status: install ok installed
+Architecture: amd64
+Version: 12.4
+
+Package: removed
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0
+`))
+	isok(t, err)
+
+	ver, err := version.Parse("2.10-3")
+	isok(t, err)
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	info, err := buildinfo.Generate(buildinfo.Snapshot{
+		Source:            "hello",
+		Version:           ver,
+		Binaries:          []string{"hello"},
+		Architectures:     []dependency.Arch{*arch},
+		BuildOrigin:       "Debian",
+		BuildArchitecture: *arch,
+		BuildDate:         time.Date(2022, 12, 11, 18, 14, 23, 0, time.UTC),
+		BuildPath:         "/build/hello-2.10",
+		Installed:         buildinfo.InstalledFromStatus(status),
+		Environment:       []string{"LANG=C.UTF-8", "HOME=/root", `CFLAGS=-O2 "x"`},
+		Files:             []string{deb},
+	})
+	isok(t, err)
+
+	out := strings.Builder{}
+	isok(t, control.Marshal(&out, info))
+	text := out.String()
+	assert(t, strings.Contains(text, "Installed-Build-Depends:\n base-files (= 12.4),\n libc6:amd64 (= 2.36-9)\n"))
+	assert(t, strings.Contains(text, "Environment:\n CFLAGS=\"-O2 \\\"x\\\"\"\n LANG=\"C.UTF-8\"\n"))
+	assert(t, strings.Contains(text, "Build-Date: Sun, 11 Dec 2022 18:14:23 +0000\n"))
+	assert(t, strings.Contains(text, " 17 hello_2.10-3_amd64.deb\n"))
+	assert(t, strings.Index(text, "Source:") < strings.Index(text, "Installed-Build-Depends:"))
+	assert(t, !strings.Contains(text, "HOME"))
+
+	/* And it reads back in */
+	again, err := control.ParseBuildinfo(bufio.NewReader(strings.NewReader(text)), "")
+	isok(t, err)
+	installed, err := buildinfo.Installed(again)
+	isok(t, err)
+	assert(t, len(installed) == 2)
+	environment, err := buildinfo.Environment(again)
+	isok(t, err)
+	assert(t, environment[0].Value == `-O2 "x"`)
+	assert(t, len(again.ChecksumsSha256) == 1)
+	assert(t, again.ChecksumsSha256[0].Size == 17)
+
+	_, err = buildinfo.Generate(buildinfo.Snapshot{})
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,17 @@
+/*
+Read and write .buildinfo files, as used by reproducible-builds tooling.
+
+control.Buildinfo holds a .buildinfo as it's written; this package adds
+typed access to the parts that need more parsing (the exact versions in
+Installed-Build-Depends, and the Environment), and can generate a
+.buildinfo from a Snapshot of a build environment, the way
+dpkg-genbuildinfo(1) does.
+
+	info, err := control.ParseBuildinfoFile("hello_2.10-3_amd64.buildinfo")
+	if err != nil {
+		panic(err)
+	}
+	installed, err := buildinfo.Installed(info)
+	...
+*/
+package buildinfo // import "pault.ag/go/debian/buildinfo"
@@ -25,9 +25,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
+	"pault.ag/go/debian/internal"
 	"pault.ag/go/debian/version"
 )
 
@@ -41,9 +43,26 @@ type ChangelogEntry struct {
 	Changelog string
 	ChangedBy string
 	When      time.Time
+
+	// The Target, split into each distribution the upload was targeted at.
+	Distributions []string
+	// The value of the urgency argument in the header line, lowercased.
+	Urgency string
 }
 
-const whenLayout = time.RFC1123Z // "Mon, 02 Jan 2006 15:04:05 -0700"
+// Bug numbers closed by this entry, matching the same "Closes: #1234, #5678"
+// syntax as dpkg-parsechangelog.
+var closesRegexp = regexp.MustCompile(`(?i)closes:\s*(?:bug)?#?\s?\d+(?:,\s*(?:bug)?#?\s?\d+)*`)
+var bugRegexp = regexp.MustCompile(`\d+`)
+
+// Return the bug numbers that this entry closes.
+func (c *ChangelogEntry) Closes() []string {
+	ret := []string{}
+	for _, closes := range closesRegexp.FindAllString(c.Changelog, -1) {
+		ret = append(ret, bugRegexp.FindAllString(closes, -1)...)
+	}
+	return ret
+}
 
 type ChangelogEntries []ChangelogEntry
 
@@ -60,6 +79,9 @@ func partition(line, delim string) (string, string) {
 
 }
 
+// Parse a single entry off the front of the reader. Since the newest entry
+// is always first, this is the fast path for finding the current version of
+// a package, like `dpkg-parsechangelog` does, without reading the whole file.
 func ParseOne(reader *bufio.Reader) (*ChangelogEntry, error) {
 	changeLog := ChangelogEntry{}
 
@@ -99,6 +121,7 @@ func ParseOne(reader *bufio.Reader) (*ChangelogEntry, error) {
 		return nil, err
 	}
 	changeLog.Target = trim(suite)
+	changeLog.Distributions = strings.Fields(changeLog.Target)
 
 	changeLog.Arguments = map[string]string{}
 
@@ -106,6 +129,7 @@ func ParseOne(reader *bufio.Reader) (*ChangelogEntry, error) {
 		key, value := partition(trim(entry), "=")
 		changeLog.Arguments[trim(key)] = trim(value)
 	}
+	changeLog.Urgency = strings.ToLower(changeLog.Arguments["urgency"])
 
 	var signoff string
 	/* OK, we've got the header. Let's zip down. */
@@ -130,7 +154,7 @@ func ParseOne(reader *bufio.Reader) (*ChangelogEntry, error) {
 	_, signoff = partition(signoff, "--")  /* Get rid of the leading " -- " */
 	whom, when := partition(signoff, "  ") /* Split on the "  " */
 	changeLog.ChangedBy = trim(whom)
-	changeLog.When, err = time.Parse(whenLayout, trim(when))
+	changeLog.When, err = internal.ParseDate(trim(when))
 	if err != nil {
 		return nil, fmt.Errorf("Failed parsing When %q: %v", when, err)
 	}
@@ -138,6 +162,7 @@ func ParseOne(reader *bufio.Reader) (*ChangelogEntry, error) {
 	return &changeLog, nil
 }
 
+// Parse the newest entry from the changelog at the given path.
 func ParseFileOne(path string) (*ChangelogEntry, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -148,6 +173,7 @@ func ParseFileOne(path string) (*ChangelogEntry, error) {
 	return ParseOne(bufio.NewReader(f))
 }
 
+// Parse every entry in the changelog, newest first.
 func Parse(reader io.Reader) (ChangelogEntries, error) {
 	stream := bufio.NewReader(reader)
 	ret := ChangelogEntries{}
@@ -91,6 +91,50 @@ func TestChangelogEntry(t *testing.T) {
 	changeLog, err := changelog.ParseOne(bufio.NewReader(strings.NewReader(changeLog)))
 	isok(t, err)
 	assert(t, changeLog.ChangedBy == "Santiago Vila <sanvila@debian.org>")
+	assert(t, changeLog.Source == "hello")
+	assert(t, changeLog.Version.String() == "2.10-1")
+	assert(t, changeLog.Urgency == "low")
+	assert(t, len(changeLog.Distributions) == 1)
+	assert(t, changeLog.Distributions[0] == "unstable")
+	assert(t, changeLog.When.Year() == 2015)
+	assert(t, len(changeLog.Closes()) == 0)
+}
+
+func TestChangelogCloses(t *testing.T) {
+	changeLogs, err := changelog.Parse(strings.NewReader(changeLog))
+	isok(t, err)
+	closes := changeLogs[1].Closes()
+	assert(t, len(closes) == 1)
+	assert(t, closes[0] == "767172")
+}
+
+func TestChangelogDistributions(t *testing.T) {
+	changeLog, err := changelog.ParseOne(bufio.NewReader(strings.NewReader(
+		`hello (2.10-1~bpo1) stable-backports bookworm-backports; urgency=HIGH
+
+  * Rebuild. Closes: #1234, bug#5678
+
+ -- Santiago Vila <sanvila@debian.org>  Sun, 22 Mar 2015 11:56:00 +0100
+`)))
+	isok(t, err)
+	assert(t, len(changeLog.Distributions) == 2)
+	assert(t, changeLog.Distributions[1] == "bookworm-backports")
+	assert(t, changeLog.Urgency == "high")
+	assert(t, len(changeLog.Closes()) == 2)
+}
+
+func TestChangelogOldDate(t *testing.T) {
+	changeLog, err := changelog.ParseOne(bufio.NewReader(strings.NewReader(
+		`hello (1.3-2) frozen unstable; urgency=low
+
+  * Fix typo.
+
+ -- Santiago Vila <sanvila@ctv.es>  Thur, 3 Dec 98 19:37:16 EST
+`)))
+	isok(t, err)
+	assert(t, changeLog.When.Year() == 1998)
+	assert(t, changeLog.When.UTC().Hour() == 0)
+	assert(t, changeLog.When.UTC().Day() == 4)
 }
 
 func TestChangelogEntries(t *testing.T) {
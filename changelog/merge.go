@@ -0,0 +1,215 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package changelog // import "pault.ag/go/debian/changelog"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/version"
+)
+
+// Entry blocks {{{
+
+// The header line of an entry: "hello (2.10-1) unstable; urgency=low".
+var headerRegexp = regexp.MustCompile(`^\S+ \(([^ ()]+)\)`)
+
+// The text of a single entry, from its header line to its signoff line,
+// exactly as it was in the file.
+type block struct {
+	version version.Version
+	text    string
+}
+
+// Split a changelog into the text of each entry, along with anything
+// after the last entry that isn't one (such as an Emacs "Local variables:"
+// section, or old entries in some other format). Blank lines between
+// entries are dropped.
+func splitBlocks(reader io.Reader) ([]block, string, error) {
+	blocks := []block{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	current := strings.Builder{}
+	inEntry := false
+	trailer := strings.Builder{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case trailer.Len() > 0:
+			trailer.WriteString(line + "\n")
+		case !inEntry && strings.TrimSpace(line) == "":
+			continue
+		case !inEntry:
+			match := headerRegexp.FindStringSubmatch(line)
+			if match == nil {
+				trailer.WriteString(line + "\n")
+				continue
+			}
+			if _, err := version.Parse(match[1]); err != nil {
+				return nil, "", err
+			}
+			inEntry = true
+			current.Reset()
+			current.WriteString(line + "\n")
+		default:
+			current.WriteString(line + "\n")
+			if !strings.HasPrefix(line, " -- ") {
+				continue
+			}
+			inEntry = false
+			/* Parse the whole entry, to be sure it is one */
+			entry, err := ParseOne(bufio.NewReader(strings.NewReader(current.String())))
+			if err != nil {
+				return nil, "", err
+			}
+			blocks = append(blocks, block{version: entry.Version, text: current.String()})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	if inEntry {
+		return nil, "", fmt.Errorf("Changelog entry '%s' has no signoff line", strings.SplitN(current.String(), "\n", 2)[0])
+	}
+	return blocks, trailer.String(), nil
+}
+
+// }}}
+
+// Merge {{{
+
+// A MergeConflict is an entry that was changed in different ways on both
+// sides of a Merge (or changed on one side, and removed on the other).
+// Base, Ours and Theirs are the text of the entry on each side, or empty
+// if it isn't there.
+type MergeConflict struct {
+	Version version.Version
+	Base    string
+	Ours    string
+	Theirs  string
+}
+
+func (c MergeConflict) Error() string {
+	return fmt.Sprintf("Conflicting changes to the %s entry", c.Version)
+}
+
+// Three-way merge two changelogs that were both changed from a common
+// ancestor (such as two git branches), entry by entry, as
+// dpkg-mergechangelogs does.
+//
+// Entries are matched up by version. Entries added on either side are
+// kept, so both sides adding an entry (the usual case) merges cleanly, and
+// an entry only changed on one side takes that side's text. The entries
+// are written out newest version first.
+//
+// Entries changed differently on both sides are returned as
+// MergeConflicts, and written out between git-style conflict markers for
+// someone to sort out.
+func Merge(base, ours, theirs io.Reader) ([]byte, []MergeConflict, error) {
+	baseBlocks, baseTrailer, err := splitBlocks(base)
+	if err != nil {
+		return nil, nil, err
+	}
+	ourBlocks, ourTrailer, err := splitBlocks(ours)
+	if err != nil {
+		return nil, nil, err
+	}
+	theirBlocks, theirTrailer, err := splitBlocks(theirs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byVersion := func(blocks []block) map[string]string {
+		ret := map[string]string{}
+		for _, el := range blocks {
+			ret[el.version.String()] = el.text
+		}
+		return ret
+	}
+	baseTexts, ourTexts, theirTexts := byVersion(baseBlocks), byVersion(ourBlocks), byVersion(theirBlocks)
+
+	versions := []version.Version{}
+	seen := map[string]bool{}
+	for _, blocks := range [][]block{ourBlocks, theirBlocks} {
+		for _, el := range blocks {
+			if !seen[el.version.String()] {
+				seen[el.version.String()] = true
+				versions = append(versions, el.version)
+			}
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return version.Compare(versions[i], versions[j]) > 0
+	})
+
+	out := bytes.Buffer{}
+	conflicts := []MergeConflict{}
+	write := func(text string) {
+		if out.Len() > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(text)
+	}
+
+	for _, ver := range versions {
+		key := ver.String()
+		baseText, ourText, theirText := baseTexts[key], ourTexts[key], theirTexts[key]
+		switch {
+		case ourText == theirText, theirText == baseText:
+			if ourText != "" {
+				write(ourText)
+			}
+		case ourText == baseText:
+			if theirText != "" {
+				write(theirText)
+			}
+		default:
+			conflicts = append(conflicts, MergeConflict{
+				Version: ver,
+				Base:    baseText,
+				Ours:    ourText,
+				Theirs:  theirText,
+			})
+			write("<<<<<<< ours\n" + ourText + "=======\n" + theirText + ">>>>>>> theirs\n")
+		}
+	}
+
+	/* Whatever's after the entries isn't really ours to merge; take any
+	 * change to it, preferring ours */
+	trailer := ourTrailer
+	if ourTrailer == baseTrailer {
+		trailer = theirTrailer
+	}
+	if trailer != "" {
+		write(trailer)
+	}
+	return out.Bytes(), conflicts, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,147 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package changelog_test
+
+import (
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/changelog"
+)
+
+/*
+ *
+ */
+
+// {{{ merge fixtures
+var mergeEntry210 = `hello (2.10-1) unstable; urgency=low
+
+  * New upstream release.
+
+ -- Santiago Vila <sanvila@debian.org>  Sun, 22 Mar 2015 11:56:00 +0100
+`
+
+/* With a typo, fixed in mergeEntry292 */
+var mergeEntry292Base = `hello (2.9-2) unstable; urgency=low
+
+  * Apply patch to fix i18n of default mesage.
+
+ -- Santiago Vila <sanvila@debian.org>  Sat, 01 Nov 2014 13:01:09 +0100
+`
+
+var mergeEntry292 = strings.Replace(mergeEntry292Base, "mesage", "message", 1)
+
+var mergeTrailer = `Local variables:
+mode: debian-changelog
+End:
+`
+
+var mergeBase = mergeEntry210 + "\n" + mergeEntry292Base + "\n" + mergeTrailer
+
+var mergeOurs = `hello (2.10-3) UNRELEASED; urgency=medium
+
+  * Fix the build with GCC 14.
+
+ -- Jane Doe <jane@example.org>  Mon, 01 Apr 2024 10:00:00 +0000
+
+hello (2.10-2) unstable; urgency=medium
+
+  * Switch to debhelper-compat 13.
+
+ -- Santiago Vila <sanvila@debian.org>  Sun, 01 Jan 2023 12:00:00 +0100
+
+` + mergeBase
+
+var mergeTheirs = `hello (2.10-2+deb12u1) bookworm; urgency=medium
+
+  * Fix a crash on startup.
+
+ -- John Doe <john@example.org>  Tue, 02 Apr 2024 10:00:00 +0000
+
+
+hello (2.10-2) unstable; urgency=medium
+
+  * Switch to debhelper-compat 13.
+
+ -- Santiago Vila <sanvila@debian.org>  Sun, 01 Jan 2023 12:00:00 +0100
+
+` + mergeEntry210 + "\n" + mergeEntry292 + "\n" + mergeTrailer
+
+// }}}
+
+func TestMerge(t *testing.T) {
+	merged, conflicts, err := changelog.Merge(
+		strings.NewReader(mergeBase),
+		strings.NewReader(mergeOurs),
+		strings.NewReader(mergeTheirs),
+	)
+	isok(t, err)
+	assert(t, len(conflicts) == 0)
+
+	entries, err := changelog.Parse(strings.NewReader(strings.TrimSuffix(string(merged), "\n"+mergeTrailer)))
+	isok(t, err)
+	assert(t, len(entries) == 5)
+	assert(t, entries[0].Version.String() == "2.10-3")
+	assert(t, entries[1].Version.String() == "2.10-2+deb12u1")
+	assert(t, entries[2].Version.String() == "2.10-2")
+	assert(t, strings.Contains(entries[4].Changelog, "default message"))
+	assert(t, strings.HasSuffix(string(merged), mergeEntry292+"\n"+mergeTrailer))
+	assert(t, !strings.Contains(string(merged), "\n\n\n"))
+}
+
+func TestMergeConflict(t *testing.T) {
+	ours := strings.Replace(mergeBase, "New upstream release.", "New upstream release (2.10).", 1)
+	theirs := strings.Replace(mergeBase, "New upstream release.", "New upstream release, closes: #1234.", 1)
+	theirs = strings.Replace(theirs, "mode: debian-changelog\n", "", 1)
+
+	merged, conflicts, err := changelog.Merge(
+		strings.NewReader(mergeBase),
+		strings.NewReader(ours),
+		strings.NewReader(theirs),
+	)
+	isok(t, err)
+	assert(t, len(conflicts) == 1)
+	assert(t, conflicts[0].Version.String() == "2.10-1")
+	assert(t, conflicts[0].Base == mergeEntry210)
+	assert(t, conflicts[0].Error() == "Conflicting changes to the 2.10-1 entry")
+	assert(t, strings.HasPrefix(string(merged), "<<<<<<< ours\nhello (2.10-1) unstable; urgency=low\n\n  * New upstream release (2.10).\n"))
+	assert(t, strings.Contains(string(merged), "=======\nhello (2.10-1)"))
+	assert(t, strings.HasSuffix(string(merged), ">>>>>>> theirs\n\n"+mergeEntry292Base+"\nLocal variables:\nEnd:\n"))
+
+	/* Removed on one side, and changed on the other */
+	removed := mergeEntry292 + "\n" + mergeTrailer
+	_, conflicts, err = changelog.Merge(
+		strings.NewReader(mergeBase),
+		strings.NewReader(ours),
+		strings.NewReader(removed),
+	)
+	isok(t, err)
+	assert(t, len(conflicts) == 1 && conflicts[0].Theirs == "")
+
+	_, _, err = changelog.Merge(
+		strings.NewReader(mergeBase),
+		strings.NewReader("hello (2.10-1) unstable; urgency=low\n\n  * Oops.\n"),
+		strings.NewReader(mergeBase),
+	)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
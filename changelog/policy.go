@@ -0,0 +1,190 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package changelog // import "pault.ag/go/debian/changelog"
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"pault.ag/go/debian/version"
+)
+
+// Diagnostic {{{
+
+// How bad a Diagnostic is. Errors would get an upload rejected.
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// A Diagnostic is a single problem a Policy found with a changelog entry.
+type Diagnostic struct {
+	Severity Severity
+	// A short, stable name for the check, such as "unknown-urgency".
+	Check   string
+	Version version.Version
+	Message string
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s (%s): %s", d.Severity, d.Check, d.Version, d.Message)
+}
+
+// }}}
+
+// Policy {{{
+
+// Urgencies allowed by Debian Policy, section 5.6.17.
+var Urgencies = []string{"low", "medium", "high", "critical", "emergency"}
+
+// The distribution for entries that aren't ready to be uploaded yet.
+const Unreleased = "UNRELEASED"
+
+// A Policy is what a vendor's archive accepts in the header line of a
+// changelog entry.
+type Policy struct {
+	// Distributions uploads may target. Each may be a glob, such as
+	// "*-backports".
+	Distributions []string
+
+	// Distributions that are well known, but may not be uploaded to, and
+	// why not; such as "stable", which only takes uploads through
+	// stable-proposed-updates.
+	Forbidden map[string]string
+
+	// Allow the newest entry to be UNRELEASED. Release tooling will want
+	// this off, and tooling for work in progress, on.
+	AllowUnreleased bool
+
+	// Allow an entry to target more than one distribution at once.
+	AllowMultiple bool
+}
+
+// The Debian archive's Policy.
+var DebianPolicy = Policy{
+	Distributions: []string{
+		"unstable", "experimental",
+		"*-proposed-updates", "*-security", "*-backports", "*-backports-sloppy",
+	},
+	Forbidden: map[string]string{
+		"stable":    "uploads to stable go through stable-proposed-updates",
+		"oldstable": "uploads to oldstable go through oldstable-proposed-updates",
+		"testing":   "packages reach testing by migrating from unstable",
+		"sid":       "sid is a codename; upload to unstable",
+		"rc-buggy":  "rc-buggy is a codename; upload to experimental",
+	},
+}
+
+func (p Policy) allowed(distribution string) bool {
+	for _, pattern := range p.Distributions {
+		if ok, err := path.Match(pattern, distribution); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Check a single changelog entry. newest says whether this is the first
+// entry in the changelog, which is the only one allowed to be UNRELEASED.
+func (p Policy) Validate(entry ChangelogEntry, newest bool) []Diagnostic {
+	ret := []Diagnostic{}
+	add := func(severity Severity, check, format string, args ...interface{}) {
+		ret = append(ret, Diagnostic{
+			Severity: severity,
+			Check:    check,
+			Version:  entry.Version,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	distributions := entry.Distributions
+	if len(distributions) == 0 {
+		add(Error, "missing-distribution", "no distribution given")
+	}
+	if len(distributions) > 1 && !p.AllowMultiple {
+		add(Error, "multiple-distributions", "targets more than one distribution: %s", strings.Join(distributions, " "))
+	}
+	for _, distribution := range distributions {
+		switch {
+		case distribution == Unreleased:
+			if len(distributions) > 1 {
+				add(Error, "unreleased-with-others", "UNRELEASED can't be combined with other distributions")
+			}
+			if !newest {
+				add(Error, "unreleased-not-newest", "only the newest entry may be UNRELEASED")
+			} else if !p.AllowUnreleased {
+				add(Error, "unreleased", "not ready to be released")
+			}
+		case p.Forbidden[distribution] != "":
+			add(Error, "forbidden-distribution", "%s: %s", distribution, p.Forbidden[distribution])
+		case !p.allowed(distribution):
+			add(Error, "unknown-distribution", "%s is not a known distribution", distribution)
+		}
+	}
+
+	/* "urgency=high (security fix)" is allowed, as is any case */
+	urgency := strings.Fields(entry.Urgency)
+	if len(urgency) == 0 {
+		add(Warning, "missing-urgency", "no urgency given, so it will be low")
+	} else if !contains(Urgencies, urgency[0]) {
+		add(Error, "unknown-urgency", "%s is not one of %s", urgency[0], strings.Join(Urgencies, ", "))
+	}
+
+	return ret
+}
+
+// Check every entry in the changelog. Old entries were uploaded under the
+// rules of their day (when "frozen" was a distribution), so this is mostly
+// for changelogs that were never released, such as in a new package.
+func (p Policy) ValidateAll(entries ChangelogEntries) []Diagnostic {
+	ret := []Diagnostic{}
+	for i, entry := range entries {
+		ret = append(ret, p.Validate(entry, i == 0)...)
+	}
+	return ret
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, el := range haystack {
+		if el == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,78 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package changelog_test
+
+import (
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/changelog"
+)
+
+func parseHeader(t *testing.T, header string) changelog.ChangelogEntry {
+	entries, err := changelog.Parse(strings.NewReader(header + "\n\n  * Change.\n\n -- Jane Doe <jane@example.com>  Sun, 22 Mar 2015 11:56:00 +0100\n"))
+	isok(t, err)
+	assert(t, len(entries) == 1)
+	return entries[0]
+}
+
+func checks(diagnostics []changelog.Diagnostic) string {
+	ret := []string{}
+	for _, diagnostic := range diagnostics {
+		ret = append(ret, diagnostic.Check)
+	}
+	return strings.Join(ret, " ")
+}
+
+func TestPolicyValidate(t *testing.T) {
+	policy := changelog.DebianPolicy
+	for _, el := range []struct {
+		header string
+		checks string
+	}{
+		{"hello (2.10-1) unstable; urgency=medium", ""},
+		{"hello (2.10-1) bookworm-backports; urgency=High (security fix)", ""},
+		{"hello (2.10-1) stable; urgency=low", "forbidden-distribution"},
+		{"hello (2.10-1) sid; urgency=low", "forbidden-distribution"},
+		{"hello (2.10-1) unstable experimental; urgency=low", "multiple-distributions"},
+		{"hello (2.10-1) frozen; urgency=low", "unknown-distribution"},
+		{"hello (2.10-1) unstable; urgency=whenever", "unknown-urgency"},
+		{"hello (2.10-1) unstable", "missing-urgency"},
+		{"hello (2.10-1) UNRELEASED; urgency=medium", "unreleased"},
+		{"hello (2.10-1) UNRELEASED unstable; urgency=medium", "multiple-distributions unreleased-with-others unreleased"},
+	} {
+		assert(t, checks(policy.Validate(parseHeader(t, el.header), true)) == el.checks)
+	}
+
+	policy.AllowUnreleased = true
+	entry := parseHeader(t, "hello (2.10-1) UNRELEASED; urgency=medium")
+	assert(t, len(policy.Validate(entry, true)) == 0)
+	diagnostics := policy.Validate(entry, false)
+	assert(t, checks(diagnostics) == "unreleased-not-newest")
+	assert(t, diagnostics[0].Severity == changelog.Error)
+	assert(t, diagnostics[0].Error() == "error: unreleased-not-newest (2.10-1): only the newest entry may be UNRELEASED")
+
+	entries, err := changelog.Parse(strings.NewReader(changeLog))
+	isok(t, err)
+	assert(t, len(changelog.DebianPolicy.ValidateAll(entries)) == 0)
+}
+
+// vim: foldmethod=marker
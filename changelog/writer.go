@@ -0,0 +1,251 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package changelog // import "pault.ag/go/debian/changelog"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pault.ag/go/debian/identity"
+	"pault.ag/go/debian/version"
+)
+
+// New entries {{{
+
+// The column dch wraps change bullets at.
+const wrapWidth = 80
+
+// Create a new entry, the way `dch` would write it out. Each item is a
+// single change, and becomes its own "  * " bullet, wrapped at 80 columns.
+// A blank line in an item is kept as-is, so that longer descriptions can
+// have more than one paragraph.
+func NewEntry(
+	source string,
+	ver version.Version,
+	distribution string,
+	urgency string,
+	items []string,
+	changedBy identity.Identity,
+	when time.Time,
+) ChangelogEntry {
+	urgency = strings.ToLower(urgency)
+	return ChangelogEntry{
+		Source:        source,
+		Version:       ver,
+		Target:        distribution,
+		Distributions: strings.Fields(distribution),
+		Arguments:     map[string]string{"urgency": urgency},
+		Urgency:       urgency,
+		Changelog:     formatItems(items),
+		ChangedBy:     changedBy.String(),
+		When:          when,
+	}
+}
+
+// Format the items as the body of an entry, including the blank lines
+// above and below the bullets, since that's how ParseOne hands back the
+// Changelog of an entry.
+func formatItems(items []string) string {
+	out := strings.Builder{}
+	out.WriteString("\n")
+	for _, item := range items {
+		prefix := "  * "
+		for _, line := range strings.Split(strings.TrimSpace(item), "\n") {
+			if strings.TrimSpace(line) == "" {
+				out.WriteString("\n")
+				continue
+			}
+			wrap(&out, prefix, line)
+			prefix = "    "
+		}
+	}
+	out.WriteString("\n")
+	return out.String()
+}
+
+// Write out the words in the line, starting with the prefix, and breaking
+// onto a new (indented) line when the next word would go past wrapWidth.
+// Words longer than a line (such as URLs) are never broken.
+func wrap(out *strings.Builder, prefix, line string) {
+	column := 0
+	for _, word := range strings.Fields(line) {
+		if column > 0 && column+1+len(word) > wrapWidth {
+			out.WriteString("\n")
+			column = 0
+		}
+		if column == 0 {
+			out.WriteString(prefix)
+			column = len(prefix)
+			prefix = "    "
+		} else {
+			out.WriteString(" ")
+			column++
+		}
+		out.WriteString(word)
+		column += len(word)
+	}
+	out.WriteString("\n")
+}
+
+// }}}
+
+// Formatting {{{
+
+// Return the entry in debian/changelog format, from the header line to the
+// signoff line, such that ParseOne will read the same entry back out.
+//
+// The distribution is the Target, or the Distributions, or "UNRELEASED"
+// if there's neither. The urgency goes first in the header, followed by
+// any other Arguments, sorted by name.
+func (c ChangelogEntry) String() string {
+	target := c.Target
+	if target == "" {
+		target = strings.Join(c.Distributions, " ")
+	}
+	if target == "" {
+		target = "UNRELEASED"
+	}
+
+	urgency := c.Urgency
+	if value, ok := c.Arguments["urgency"]; ok && value != "" {
+		urgency = value
+	}
+	if urgency == "" {
+		urgency = "medium"
+	}
+	arguments := []string{"urgency=" + urgency}
+	keys := []string{}
+	for key := range c.Arguments {
+		if key != "urgency" && key != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		arguments = append(arguments, key+"="+c.Arguments[key])
+	}
+
+	body := c.Changelog
+	if !strings.HasPrefix(body, "\n") {
+		body = "\n" + body
+	}
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	if !strings.HasSuffix(body, "\n\n") {
+		body += "\n"
+	}
+
+	return fmt.Sprintf(
+		"%s (%s) %s; %s\n%s -- %s  %s\n",
+		c.Source, c.Version, target, strings.Join(arguments, ", "),
+		body, c.ChangedBy, c.When.Format(time.RFC1123Z),
+	)
+}
+
+// }}}
+
+// Prepend {{{
+
+// Write the entry to the writer, followed by the changelog read from the
+// reader, like `dch` does when starting a new version. Everything from the
+// reader is written out byte for byte, after a blank line.
+//
+// If the changelog isn't empty, the entry's version must be newer than
+// the version of the first entry in it.
+func Prepend(entry ChangelogEntry, reader io.Reader, writer io.Writer) error {
+	existing, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	if len(bytes.TrimSpace(existing)) != 0 {
+		newest, err := ParseOne(bufio.NewReader(bytes.NewReader(existing)))
+		if err != nil {
+			return fmt.Errorf("Failed parsing the existing changelog: %v", err)
+		}
+		if version.Compare(entry.Version, newest.Version) <= 0 {
+			return fmt.Errorf(
+				"Version %s is not newer than %s",
+				entry.Version, newest.Version,
+			)
+		}
+	}
+
+	if _, err := io.WriteString(writer, entry.String()); err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+	if _, err := io.WriteString(writer, "\n"); err != nil {
+		return err
+	}
+	_, err = writer.Write(existing)
+	return err
+}
+
+// Prepend the entry to the changelog at the given path, as Prepend does.
+// The new changelog is written to a temporary file next to the old one,
+// and renamed over it, so the changelog is never left half-written. If
+// the file doesn't exist, it's created with just the new entry in it.
+func PrependFile(entry ChangelogEntry, path string) error {
+	mode := os.FileMode(0644)
+	existing := []byte{}
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		if existing, err = os.ReadFile(path); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(path), ".changelog-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	if err := Prepend(entry, bytes.NewReader(existing), out); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Chmod(mode); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), path)
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,140 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package changelog_test
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pault.ag/go/debian/changelog"
+	"pault.ag/go/debian/identity"
+	"pault.ag/go/debian/version"
+)
+
+/*
+ *
+ */
+
+func newEntry(t *testing.T, ver string, items ...string) changelog.ChangelogEntry {
+	v, err := version.Parse(ver)
+	isok(t, err)
+	when := time.Date(2015, time.March, 28, 14, 2, 31, 0, time.FixedZone("", 3600))
+	return changelog.NewEntry(
+		"hello", v, "unstable", "Medium", items,
+		identity.Identity{Name: "Jane Doe", Email: "jane@example.org"}, when,
+	)
+}
+
+func TestNewEntryString(t *testing.T) {
+	entry := newEntry(t, "2.10-2",
+		"Fix the thing.",
+		"Rewrite the frobnicator to use the new widget API, which is much faster and also closes a long-standing bug. Closes: #12345",
+	)
+	assert(t, entry.String() == `hello (2.10-2) unstable; urgency=medium
+
+  * Fix the thing.
+  * Rewrite the frobnicator to use the new widget API, which is much faster and
+    also closes a long-standing bug. Closes: #12345
+
+ -- Jane Doe <jane@example.org>  Sat, 28 Mar 2015 14:02:31 +0100
+`)
+}
+
+func TestNewEntryRoundTrip(t *testing.T) {
+	entry := newEntry(t, "2.10-2", "Fix the thing.", "First paragraph.\n\nSecond paragraph.")
+	parsed, err := changelog.ParseOne(bufio.NewReader(strings.NewReader(entry.String())))
+	isok(t, err)
+	assert(t, parsed.Source == "hello")
+	assert(t, parsed.Version.String() == "2.10-2")
+	assert(t, parsed.Target == "unstable")
+	assert(t, parsed.Urgency == "medium")
+	assert(t, parsed.ChangedBy == "Jane Doe <jane@example.org>")
+	assert(t, parsed.When.Equal(entry.When))
+	assert(t, parsed.Changelog == entry.Changelog)
+	assert(t, len(parsed.Closes()) == 0)
+	assert(t, parsed.String() == entry.String())
+}
+
+func TestEntryStringArguments(t *testing.T) {
+	entry := newEntry(t, "2.10-2", "Fix the thing.")
+	entry.Target = ""
+	entry.Distributions = nil
+	entry.Arguments["binary-only"] = "yes"
+	assert(t, strings.HasPrefix(entry.String(),
+		"hello (2.10-2) UNRELEASED; urgency=medium, binary-only=yes\n"))
+}
+
+func TestPrepend(t *testing.T) {
+	/* Odd spacing, to be sure nothing is reformatted */
+	existing := changeLog + "\n\n"
+	out := bytes.Buffer{}
+	entry := newEntry(t, "2.10-2", "Fix the thing.")
+	isok(t, changelog.Prepend(entry, strings.NewReader(existing), &out))
+	assert(t, out.String() == entry.String()+"\n"+existing)
+
+	entries, err := changelog.Parse(strings.NewReader(out.String()))
+	isok(t, err)
+	assert(t, len(entries) > 2)
+	assert(t, entries[0].Version.String() == "2.10-2")
+	assert(t, entries[1].Version.String() == "2.10-1")
+}
+
+func TestPrependOlderVersion(t *testing.T) {
+	out := bytes.Buffer{}
+	entry := newEntry(t, "2.10-1", "Fix the thing.")
+	notok(t, changelog.Prepend(entry, strings.NewReader(changeLog), &out))
+	assert(t, out.Len() == 0)
+}
+
+func TestPrependEmpty(t *testing.T) {
+	out := bytes.Buffer{}
+	entry := newEntry(t, "1.0-1", "Initial release.")
+	isok(t, changelog.Prepend(entry, strings.NewReader(""), &out))
+	assert(t, out.String() == entry.String())
+}
+
+func TestPrependFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changelog")
+	isok(t, os.WriteFile(path, []byte(changeLog), 0600))
+
+	entry := newEntry(t, "2.10-2", "Fix the thing.")
+	isok(t, changelog.PrependFile(entry, path))
+
+	data, err := os.ReadFile(path)
+	isok(t, err)
+	assert(t, string(data) == entry.String()+"\n"+changeLog)
+
+	info, err := os.Stat(path)
+	isok(t, err)
+	assert(t, info.Mode().Perm() == 0600)
+
+	notok(t, changelog.PrependFile(newEntry(t, "2.9-1", "Nope."), path))
+	data, err = os.ReadFile(path)
+	isok(t, err)
+	assert(t, string(data) == entry.String()+"\n"+changeLog)
+}
+
+// vim: foldmethod=marker
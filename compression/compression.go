@@ -0,0 +1,219 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package compression // import "pault.ag/go/debian/compression"
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kjk/lzma"
+	"github.com/klauspost/compress/zstd"
+	ulikunitzxz "github.com/ulikunitz/xz"
+	"github.com/xi2/xz"
+)
+
+// Backend {{{
+
+// Compressor wraps a Writer, compressing everything written to it. Close
+// must be called to flush the end of the stream; it doesn't close the
+// underlying Writer.
+type Compressor func(io.Writer) (io.WriteCloser, error)
+
+// Decompressor wraps a Reader of compressed data. Close must be called
+// when done, but doesn't close the underlying Reader.
+type Decompressor func(io.Reader) (io.ReadCloser, error)
+
+// A Backend is one implementation of a compressed format. Either of
+// Compressor or Decompressor may be nil, if the implementation can only go
+// one way.
+type Backend struct {
+	// Name of the implementation, such as "stdlib" or "pgzip", used to
+	// tell Backends for the same Extension apart.
+	Name string
+
+	// File extension of the format, without the leading dot, such as "gz".
+	Extension string
+
+	// Of all the Backends for an Extension, the one with the highest
+	// Priority is used. The built in Backends have Priority 0.
+	Priority int
+
+	Compressor   Compressor
+	Decompressor Decompressor
+}
+
+// }}}
+
+// Registry {{{
+
+var (
+	registryLock sync.RWMutex
+	registry     = map[string][]Backend{}
+)
+
+// Trim the leading dot off an extension, so both ".gz" and "gz" work.
+func normalize(ext string) string {
+	return strings.TrimPrefix(ext, ".")
+}
+
+// Register a Backend. A Backend with the same Name and Extension as one
+// already registered replaces it.
+func Register(backend Backend) {
+	backend.Extension = normalize(backend.Extension)
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	backends := []Backend{}
+	for _, existing := range registry[backend.Extension] {
+		if existing.Name != backend.Name {
+			backends = append(backends, existing)
+		}
+	}
+	backends = append(backends, backend)
+	sort.SliceStable(backends, func(i, j int) bool {
+		return backends[i].Priority > backends[j].Priority
+	})
+	registry[backend.Extension] = backends
+}
+
+// Return the Backends registered for an extension, highest Priority
+// first.
+func Backends(ext string) []Backend {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return append([]Backend{}, registry[normalize(ext)]...)
+}
+
+// Return every extension with at least one Backend, sorted.
+func Extensions() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	ret := []string{}
+	for ext := range registry {
+		ret = append(ret, ext)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Return the highest Priority Compressor for the extension.
+func CompressorFor(ext string) (Compressor, error) {
+	for _, backend := range Backends(ext) {
+		if backend.Compressor != nil {
+			return backend.Compressor, nil
+		}
+	}
+	return nil, fmt.Errorf("No such compressor: '%s'", normalize(ext))
+}
+
+// Return the highest Priority Decompressor for the extension.
+func DecompressorFor(ext string) (Decompressor, error) {
+	for _, backend := range Backends(ext) {
+		if backend.Decompressor != nil {
+			return backend.Decompressor, nil
+		}
+	}
+	return nil, fmt.Errorf("No such decompressor: '%s'", normalize(ext))
+}
+
+// }}}
+
+// Built in Backends {{{
+
+// zstd.Decoder.Close doesn't return an error, so it doesn't quite fit
+// io.Closer; it still needs to be called to stop the decoder's goroutines.
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
+
+// For the authoritative list of formats used in .deb files, see
+// https://manpages.debian.org/unstable/dpkg-dev/deb.5
+// zstd-compressed packages are not yet (08-2021) officially supported by
+// Debian, but they are used by Ubuntu.
+func init() {
+	Register(Backend{
+		Name:      "stdlib",
+		Extension: "gz",
+		Compressor: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		Decompressor: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	})
+	Register(Backend{
+		Name:      "stdlib",
+		Extension: "bz2",
+		Decompressor: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(bzip2.NewReader(r)), nil
+		},
+	})
+	Register(Backend{
+		Name:      "xz",
+		Extension: "xz",
+		Compressor: func(w io.Writer) (io.WriteCloser, error) {
+			return ulikunitzxz.NewWriter(w)
+		},
+		Decompressor: func(r io.Reader) (io.ReadCloser, error) {
+			reader, err := xz.NewReader(r, 0)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(reader), nil
+		},
+	})
+	Register(Backend{
+		Name:      "lzma",
+		Extension: "lzma",
+		Decompressor: func(r io.Reader) (io.ReadCloser, error) {
+			return lzma.NewReader(r), nil
+		},
+	})
+	Register(Backend{
+		Name:      "zstd",
+		Extension: "zst",
+		Compressor: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+		Decompressor: func(r io.Reader) (io.ReadCloser, error) {
+			reader, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return zstdReadCloser{reader}, nil
+		},
+	})
+}
+
+// }}}
+
+// vim: foldmethod=marker
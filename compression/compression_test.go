@@ -0,0 +1,157 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package compression_test
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/hashio"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+func roundTrip(t *testing.T, ext string, data string) string {
+	compress, err := compression.CompressorFor(ext)
+	isok(t, err)
+	out := bytes.Buffer{}
+	writer, err := compress(&out)
+	isok(t, err)
+	_, err = io.WriteString(writer, data)
+	isok(t, err)
+	isok(t, writer.Close())
+
+	decompress, err := compression.DecompressorFor(ext)
+	isok(t, err)
+	reader, err := decompress(&out)
+	isok(t, err)
+	defer reader.Close()
+	back, err := io.ReadAll(reader)
+	isok(t, err)
+	return string(back)
+}
+
+func TestBuiltinBackends(t *testing.T) {
+	assert(t, strings.Join(compression.Extensions(), " ") == "bz2 gz lzma xz zst")
+	for _, ext := range []string{"gz", ".xz", "zst"} {
+		assert(t, roundTrip(t, ext, "Package: hello\n") == "Package: hello\n")
+	}
+
+	/* Read only */
+	_, err := compression.CompressorFor("bz2")
+	notok(t, err)
+	_, err = compression.DecompressorFor(".bz2")
+	isok(t, err)
+
+	_, err = compression.DecompressorFor("rar")
+	notok(t, err)
+}
+
+// A "compression" that just upper-cases everything, so it's easy to tell
+// it was used.
+type upperWriter struct{ io.Writer }
+
+func (u upperWriter) Write(p []byte) (int, error) {
+	return u.Writer.Write(bytes.ToUpper(p))
+}
+
+func (u upperWriter) Close() error { return nil }
+
+func TestRegisterPriority(t *testing.T) {
+	compression.Register(compression.Backend{
+		Name:      "test-upper",
+		Extension: ".test",
+		Priority:  10,
+		Compressor: func(w io.Writer) (io.WriteCloser, error) {
+			return upperWriter{w}, nil
+		},
+	})
+	compression.Register(compression.Backend{
+		Name:      "test-plain",
+		Extension: "test",
+		Compressor: func(w io.Writer) (io.WriteCloser, error) {
+			return upperWriter{io.Discard}, nil
+		},
+		Decompressor: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(r), nil
+		},
+	})
+
+	backends := compression.Backends("test")
+	assert(t, len(backends) == 2)
+	assert(t, backends[0].Name == "test-upper")
+	assert(t, backends[1].Name == "test-plain")
+
+	/* The highest priority Compressor wins, and the Decompressor comes
+	 * from whichever Backend has one */
+	assert(t, roundTrip(t, "test", "hello") == "HELLO")
+
+	/* Every writer in the module goes through the registry */
+	out := bytes.Buffer{}
+	isok(t, hashio.Recompress(strings.NewReader("hello"), []string{"sha256"}, &hashio.Output{
+		Compression: "test",
+		Writer:      &out,
+	}))
+	assert(t, out.String() == "HELLO")
+
+	/* Registering the same Name again replaces it */
+	compression.Register(compression.Backend{
+		Name:      "test-upper",
+		Extension: "test",
+		Priority:  -1,
+	})
+	backends = compression.Backends("test")
+	assert(t, len(backends) == 2)
+	assert(t, backends[0].Name == "test-plain")
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,20 @@
+/*
+Pick the compression implementation used for each compressed format.
+
+Every reader and writer of compressed data in this module (.deb members,
+repository indices, and so on) asks this package for a Compressor or
+Decompressor by file extension, rather than using a particular library
+directly. Applications can Register their own Backend for an extension
+(such as a parallel gzip or xz implementation) at a higher Priority than
+the built in ones, and it will be used everywhere.
+
+When the format isn't known up front, NewReader works it out from the magic
+number at the start of the data:
+
+	reader, err := compression.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+*/
+package compression // import "pault.ag/go/debian/compression"
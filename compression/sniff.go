@@ -0,0 +1,86 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package compression // import "pault.ag/go/debian/compression"
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Sniffing {{{
+
+// The magic numbers compressed formats start with, by extension. Legacy
+// lzma has no real magic number; its header starts with the properties
+// byte (almost always 0x5d) and a little endian dictionary size, which
+// for any sensible size has zeros for its low two bytes.
+var magics = []struct {
+	extension string
+	magic     []byte
+}{
+	{"gz", []byte{0x1f, 0x8b}},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"bz2", []byte("BZh")},
+	{"zst", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{"lzma", []byte{0x5d, 0x00, 0x00}},
+}
+
+// The most bytes Sniff needs to look at.
+const sniffLength = 6
+
+// Return the extension (without the leading dot, such as "xz") of the
+// compressed format the data starts with, or "" if it doesn't look
+// compressed.
+func Sniff(head []byte) string {
+	for _, format := range magics {
+		if bytes.HasPrefix(head, format.magic) {
+			return format.extension
+		}
+	}
+	return ""
+}
+
+// Wrap a Reader of data that may be compressed in any of the formats with
+// a Backend (gzip, xz, bzip2, zstd or lzma, by default), working out which
+// from the first few bytes, and return a Reader of the decompressed data.
+// Data that doesn't look compressed is returned as it is. As with a
+// Decompressor, Close must be called when done, but doesn't close r.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	head, err := buffered.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	ext := Sniff(head)
+	if ext == "" {
+		return io.NopCloser(buffered), nil
+	}
+	decompress, err := DecompressorFor(ext)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(buffered)
+}
+
+// }}}
+
+// vim: foldmethod=marker
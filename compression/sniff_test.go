@@ -0,0 +1,88 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package compression_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"pault.ag/go/debian/compression"
+)
+
+/*
+ *
+ */
+
+// Compress data with the highest Priority Compressor for the extension.
+func compress(t *testing.T, ext string, data []byte) []byte {
+	compressor, err := compression.CompressorFor(ext)
+	isok(t, err)
+	out := bytes.Buffer{}
+	writer, err := compressor(&out)
+	isok(t, err)
+	_, err = writer.Write(data)
+	isok(t, err)
+	isok(t, writer.Close())
+	return out.Bytes()
+}
+
+func unhex(t *testing.T, data string) []byte {
+	ret, err := hex.DecodeString(data)
+	isok(t, err)
+	return ret
+}
+
+func TestNewReader(t *testing.T) {
+	data := []byte("Package: hello\n")
+	for ext, compressed := range map[string][]byte{
+		"gz":  compress(t, "gz", data),
+		"xz":  compress(t, "xz", data),
+		"zst": compress(t, "zst", data),
+		/* Nothing here writes bzip2 or lzma, so these are from python */
+		"bz2":  unhex(t, "425a68393141592653597f1cbfef000001db0000104000001040002acca000220019040d0343a3228e02e0ef278bb9229c28483f8e5ff780"),
+		"lzma": unhex(t, "5d00008000ffffffffffffffff0028184866dbda3085fe16e55ca878f95d4d8b3fffff460c0000"),
+		"":     data,
+	} {
+		assert(t, compression.Sniff(compressed) == ext)
+
+		reader, err := compression.NewReader(bytes.NewReader(compressed))
+		isok(t, err)
+		out, err := io.ReadAll(reader)
+		isok(t, err)
+		isok(t, reader.Close())
+		assert(t, bytes.Equal(out, data))
+	}
+
+	/* Shorter than any magic number */
+	reader, err := compression.NewReader(bytes.NewReader([]byte("P")))
+	isok(t, err)
+	out, err := io.ReadAll(reader)
+	isok(t, err)
+	assert(t, string(out) == "P")
+
+	/* Looks like gzip, but isn't */
+	_, err = compression.NewReader(bytes.NewReader([]byte{0x1f, 0x8b, 0x00}))
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,369 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package conformance // import "pault.ag/go/debian/conformance"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Report {{{
+
+// A Divergence is an input on which this module and dpkg disagree.
+type Divergence struct {
+	// Which check it was: "version", "dependency" or "control".
+	Check string
+
+	Input  string
+	Ours   string
+	Theirs string
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("%s: %s: ours %q, dpkg %q", d.Check, d.Input, d.Ours, d.Theirs)
+}
+
+// A Report is the outcome of running a Checker over a Corpus.
+type Report struct {
+	// How many inputs were checked.
+	Checked int
+
+	Divergences []Divergence
+}
+
+// Add the outcome of checking one input.
+func (r *Report) add(check, input, ours, theirs string) {
+	r.Checked++
+	if ours != theirs {
+		r.Divergences = append(r.Divergences, Divergence{
+			Check: check, Input: input, Ours: ours, Theirs: theirs,
+		})
+	}
+}
+
+// Add everything in another Report to this one.
+func (r *Report) Merge(other Report) {
+	r.Checked += other.Checked
+	r.Divergences = append(r.Divergences, other.Divergences...)
+}
+
+// Summarise the Report: how many inputs were checked, then each
+// Divergence on its own line.
+func (r Report) String() string {
+	out := strings.Builder{}
+	fmt.Fprintf(&out, "%d checked, %d divergent\n", r.Checked, len(r.Divergences))
+	for _, divergence := range r.Divergences {
+		out.WriteString(divergence.String() + "\n")
+	}
+	return out.String()
+}
+
+// }}}
+
+// Checker {{{
+
+// A Checker runs inputs through both this module and dpkg.
+type Checker struct {
+	// Paths to dpkg, and to a perl with dpkg's modules (libdpkg-perl)
+	// installed.
+	DPKG string
+	Perl string
+}
+
+// Find dpkg and perl on the PATH, and check that dpkg's Perl modules are
+// installed. An error means there's nothing here to check against.
+func NewChecker() (*Checker, error) {
+	dpkg, err := exec.LookPath("dpkg")
+	if err != nil {
+		return nil, err
+	}
+	perl, err := exec.LookPath("perl")
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(perl, "-MDpkg::Deps", "-MDpkg::Control::HashCore", "-MJSON::PP", "-e", "1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("dpkg's Perl modules aren't installed: %s", bytes.TrimSpace(out))
+	}
+	return &Checker{DPKG: dpkg, Perl: perl}, nil
+}
+
+// Run a Perl script over the input, returning what it prints. Warnings
+// (such as for input it can't parse) are ignored.
+func (c Checker) perl(script string, input []byte) ([]byte, error) {
+	cmd := exec.Command(c.Perl, "-MDpkg::Deps", "-MDpkg::Control::HashCore", "-MJSON::PP", "-e", script)
+	cmd.Stdin = bytes.NewReader(input)
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("perl: %s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// Check everything in the Corpus.
+func (c Checker) Run(corpus Corpus) (*Report, error) {
+	ret := Report{}
+	versions, err := c.Versions(corpus.Versions)
+	if err != nil {
+		return nil, err
+	}
+	ret.Merge(*versions)
+
+	dependencies, err := c.Dependencies(corpus.Dependencies)
+	if err != nil {
+		return nil, err
+	}
+	ret.Merge(*dependencies)
+
+	for _, data := range corpus.Control {
+		paragraphs, err := c.Control(data)
+		if err != nil {
+			return nil, err
+		}
+		ret.Merge(*paragraphs)
+	}
+	return &ret, nil
+}
+
+// }}}
+
+// Versions {{{
+
+// What comparing the versions came out as: "<", "=" or ">", or "invalid"
+// if either isn't a valid version.
+func ourComparison(a, b string) string {
+	aVersion, aErr := version.Parse(a)
+	bVersion, bErr := version.Parse(b)
+	if aErr != nil || bErr != nil {
+		return "invalid"
+	}
+	switch q := version.Compare(aVersion, bVersion); {
+	case q < 0:
+		return "<"
+	case q > 0:
+		return ">"
+	}
+	return "="
+}
+
+// Ask dpkg whether "a op b" holds.
+func (c Checker) compareVersions(a, op, b string) (bool, error) {
+	err := exec.Command(c.DPKG, "--compare-versions", a, op, b).Run()
+	exitErr := &exec.ExitError{}
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return false, nil
+	}
+	return false, err
+}
+
+func (c Checker) theirComparison(a, b string) string {
+	for _, op := range []struct{ op, result string }{{"lt", "<"}, {"gt", ">"}} {
+		holds, err := c.compareVersions(a, op.op, b)
+		if err != nil {
+			return "invalid"
+		}
+		if holds {
+			return op.result
+		}
+	}
+	return "="
+}
+
+// Compare each pair of versions with version.Compare, and with
+// dpkg --compare-versions.
+func (c Checker) Versions(pairs [][2]string) (*Report, error) {
+	ret := Report{}
+	for _, pair := range pairs {
+		ret.add("version", pair[0]+" vs "+pair[1], ourComparison(pair[0], pair[1]), c.theirComparison(pair[0], pair[1]))
+	}
+	return &ret, nil
+}
+
+// }}}
+
+// Dependencies {{{
+
+const simplifyScript = `
+while (my $line = <STDIN>) {
+	chomp $line;
+	my $dep = deps_parse($line);
+	if (!defined $dep) {
+		print "invalid\n";
+		next;
+	}
+	$dep->simplify_deps(Dpkg::Deps::KnownFacts->new());
+	print $dep->output(), "\n";
+}
+`
+
+// Return the Relations of a dependency field, sorted, so that the order
+// they're simplified into doesn't matter.
+func sortedRelations(value string) string {
+	relations := strings.Split(value, ", ")
+	sort.Strings(relations)
+	return strings.Join(relations, ", ")
+}
+
+// Simplify each dependency field value with Dependency.Normalize, and
+// with Dpkg::Deps' simplify_deps, ignoring the order of the Relations.
+func (c Checker) Dependencies(values []string) (*Report, error) {
+	ret := Report{}
+	if len(values) == 0 {
+		return &ret, nil
+	}
+	/* One per line, so folded fields are unfolded */
+	flattened := []string{}
+	input := bytes.Buffer{}
+	for _, value := range values {
+		value = strings.Join(strings.Fields(value), " ")
+		flattened = append(flattened, value)
+		input.WriteString(value + "\n")
+	}
+	out, err := c.perl(simplifyScript, input.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	theirs := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(theirs) != len(values) {
+		return nil, fmt.Errorf("Expected %d simplified dependencies from dpkg, got %d", len(values), len(theirs))
+	}
+
+	for i, value := range flattened {
+		ours := "invalid"
+		if dep, err := dependency.Parse(value); err == nil {
+			ours = sortedRelations(dep.Normalize().String())
+		}
+		if theirs[i] != "invalid" {
+			theirs[i] = sortedRelations(theirs[i])
+		}
+		ret.add("dependency", value, ours, theirs[i])
+	}
+	return &ret, nil
+}
+
+// }}}
+
+// Control files {{{
+
+const controlScript = `
+my @paragraphs;
+eval {
+	while (1) {
+		my $c = Dpkg::Control::HashCore->new(allow_pgp => 1);
+		last unless $c->parse(\*STDIN, "input");
+		push @paragraphs, [ map { [ $_, $c->{$_} ] } keys %$c ];
+	}
+	1;
+} or do {
+	print JSON::PP->new->encode({ error => "$@" });
+	exit 0;
+};
+print JSON::PP->new->encode({ paragraphs => \@paragraphs });
+`
+
+// What the Perl script makes of the input: the fields (name, then value)
+// of each paragraph, or an error.
+type theirParagraphs struct {
+	Error      string
+	Paragraphs [][][2]string
+}
+
+// Render a Paragraph's value as Dpkg::Control does: continuation lines of
+// just "." are blank lines, and there's no newline after the last line of
+// a multi-line value.
+func dpkgValue(value string) string {
+	lines := strings.Split(strings.TrimSuffix(value, "\n"), "\n")
+	for i, line := range lines {
+		if i > 0 && line == "." {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Parse the control file with a control.ParagraphReader, and with
+// Dpkg::Control::HashCore, comparing the fields of each paragraph.
+func (c Checker) Control(data []byte) (*Report, error) {
+	out, err := c.perl(controlScript, data)
+	if err != nil {
+		return nil, err
+	}
+	theirs := theirParagraphs{}
+	if err := json.Unmarshal(out, &theirs); err != nil {
+		return nil, err
+	}
+
+	ret := Report{}
+	ours := []control.Paragraph{}
+	reader, err := control.NewParagraphReader(bytes.NewReader(data))
+	if err == nil {
+		ours, err = reader.All()
+	}
+	ourError, theirError := "", ""
+	if err != nil {
+		ourError = "invalid"
+	}
+	if theirs.Error != "" {
+		theirError = "invalid"
+	}
+	ret.add("control", "parsing", ourError, theirError)
+	if err != nil || theirs.Error != "" {
+		return &ret, nil
+	}
+
+	ret.add("control", "paragraphs", fmt.Sprint(len(ours)), fmt.Sprint(len(theirs.Paragraphs)))
+	for i := 0; i < len(ours) && i < len(theirs.Paragraphs); i++ {
+		ourFields, theirFields := []string{}, []string{}
+		theirValues := map[string]string{}
+		for _, field := range theirs.Paragraphs[i] {
+			theirFields = append(theirFields, field[0])
+			theirValues[field[0]] = field[1]
+		}
+		for _, key := range ours[i].Order {
+			ourFields = append(ourFields, key)
+			if theirValue, ok := theirValues[key]; ok {
+				input := fmt.Sprintf("paragraph %d field %s", i+1, key)
+				ret.add("control", input, dpkgValue(ours[i].Values[key]), theirValue)
+			}
+		}
+		input := fmt.Sprintf("paragraph %d fields", i+1)
+		ret.add("control", input, strings.Join(ourFields, ", "), strings.Join(theirFields, ", "))
+	}
+	return &ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,144 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package conformance_test
+
+import (
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/conformance"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+func checker(t *testing.T) *conformance.Checker {
+	checker, err := conformance.NewChecker()
+	if err != nil {
+		t.Skipf("Nothing to check against: %s", err)
+	}
+	return checker
+}
+
+/*
+ *
+ */
+
+// {{{ test Packages
+var testPackages = `Package: hello
+Version: 2.10-3
+Architecture: amd64
+Depends: libc6 (>= 2.34), libc6 (>= 2.14)
+Description: example package based on GNU hello
+ The GNU hello program produces a familiar, friendly greeting.
+ .
+ Seriously, though: this is an example.
+
+Package: hello-traditional
+Version: 2.10-3+b1
+Architecture: amd64
+Depends: hello (>= 2.10), hello | hello-dummy
+Breaks: hello (<< 2.9~)
+
+Package: libfoo1
+Version: 1:1.0~rc1-1
+Architecture: amd64
+Pre-Depends: ${misc:Pre-Depends}
+`
+
+// }}}
+
+func TestCorpusFromIndex(t *testing.T) {
+	corpus, err := conformance.CorpusFromIndex(strings.NewReader(testPackages))
+	isok(t, err)
+	assert(t, len(corpus.Versions) == 2)
+	assert(t, corpus.Versions[1] == [2]string{"2.10-3+b1", "1:1.0~rc1-1"})
+	assert(t, len(corpus.Dependencies) == 4)
+	assert(t, len(corpus.Control) == 1)
+}
+
+func TestVersions(t *testing.T) {
+	report, err := checker(t).Versions([][2]string{
+		{"1.0", "1.0"},
+		{"1.0~rc1", "1.0"},
+		{"1:0.9", "2.0"},
+		{"1.0-1", "1.0-1+b1"},
+		{"2.10-3", "2.10-3.1"},
+		{"1.0a", "1.0+"},
+		{"0~~", "0~"},
+	})
+	isok(t, err)
+	assert(t, report.Checked == 7)
+	assert(t, len(report.Divergences) == 0)
+}
+
+func TestDependencies(t *testing.T) {
+	report, err := checker(t).Dependencies([]string{
+		"foo (>= 1), foo (>= 2)",
+		"foo (= 2), foo (>= 1)",
+		"foo (<< 2), foo (>= 1)",
+		"foo, foo | bar",
+		"baz [amd64], bar <!nocheck>",
+		"foo | foo",
+	})
+	isok(t, err)
+	assert(t, report.Checked == 6)
+
+	/* Normalize drops the duplicate alternative; dpkg doesn't */
+	assert(t, len(report.Divergences) == 1)
+	assert(t, report.Divergences[0].Input == "foo | foo")
+	assert(t, report.Divergences[0].Ours == "foo")
+	assert(t, report.Divergences[0].Theirs == "foo | foo")
+}
+
+func TestRun(t *testing.T) {
+	c := checker(t)
+	corpus, err := conformance.CorpusFromIndex(strings.NewReader(testPackages))
+	isok(t, err)
+
+	report, err := c.Run(*corpus)
+	isok(t, err)
+	assert(t, report.Checked > 10)
+
+	/* dpkg can't parse the substvar, which Normalize leaves alone */
+	assert(t, len(report.Divergences) == 1)
+	assert(t, report.Divergences[0].Check == "dependency")
+	assert(t, report.Divergences[0].Theirs == "invalid")
+	assert(t, strings.HasPrefix(report.String(), "25 checked, 1 divergent\ndependency: ${misc:Pre-Depends}: "))
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,91 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package conformance // import "pault.ag/go/debian/conformance"
+
+import (
+	"bytes"
+	"io"
+
+	"pault.ag/go/debian/control"
+)
+
+// Corpus {{{
+
+// A Corpus is the inputs for a Checker to run.
+type Corpus struct {
+	// Pairs of versions to compare.
+	Versions [][2]string
+
+	// Values of relationship fields, such as Depends, to simplify.
+	Dependencies []string
+
+	// Control files, each of any number of paragraphs, to parse.
+	Control [][]byte
+}
+
+// Fields of an index with package relationships in.
+var relationshipFields = []string{
+	"Depends", "Pre-Depends", "Recommends", "Suggests", "Enhances",
+	"Breaks", "Conflicts", "Replaces", "Provides", "Built-Using",
+	"Build-Depends", "Build-Depends-Arch", "Build-Depends-Indep",
+	"Build-Conflicts", "Build-Conflicts-Arch", "Build-Conflicts-Indep",
+}
+
+// Build a Corpus out of an index, such as a Packages or Sources file:
+// each distinct Version is compared with the one after it, every
+// relationship field is simplified, and the whole file is parsed.
+func CorpusFromIndex(reader io.Reader) (*Corpus, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	paragraphReader, err := control.NewParagraphReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	paragraphs, err := paragraphReader.All()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := Corpus{Control: [][]byte{data}}
+	seen := map[string]bool{}
+	versions := []string{}
+	for _, paragraph := range paragraphs {
+		if value := paragraph.Values["Version"]; value != "" && !seen[value] {
+			seen[value] = true
+			versions = append(versions, value)
+		}
+		for _, field := range relationshipFields {
+			if value := paragraph.Values[field]; value != "" {
+				ret.Dependencies = append(ret.Dependencies, value)
+			}
+		}
+	}
+	for i := 1; i < len(versions); i++ {
+		ret.Versions = append(ret.Versions, [2]string{versions[i-1], versions[i]})
+	}
+	return &ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,29 @@
+/*
+Cross-check this module against dpkg itself, for anyone about to replace
+calls out to dpkg tools with it, and wanting to know where (if anywhere)
+the two disagree on their data.
+
+A Checker runs the same inputs through both: version comparisons through
+`dpkg --compare-versions`, and dependency simplification and control file
+parsing through dpkg's own Perl modules (Dpkg::Deps and
+Dpkg::Control::HashCore), comparing what comes back with version.Compare,
+dependency.Dependency.Normalize and control.ParagraphReader.
+
+	checker, err := conformance.NewChecker()
+	if err != nil {
+		// dpkg isn't installed here, so there's nothing to check against
+	}
+	corpus, err := conformance.CorpusFromIndex(packagesFile)
+	...
+	report, err := checker.Run(*corpus)
+	...
+	fmt.Print(report)
+
+Every input on which they disagree is a Divergence in the Report. Not all
+of them are bugs: Normalize also drops duplicate alternatives, such as
+"foo | foo", which dpkg leaves in.
+
+This is only as good as the corpus; real Packages and Sources files are a
+good place to start.
+*/
+package conformance // import "pault.ag/go/debian/conformance"
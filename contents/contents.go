@@ -0,0 +1,272 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package contents // import "pault.ag/go/debian/contents"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/deb"
+)
+
+// Entry {{{
+
+// An Entry is one line of a Contents file: a path, and every package that
+// ships it.
+type Entry struct {
+	// Path relative to the root, without a leading "/", such as
+	// "usr/bin/hello".
+	Path string
+
+	// Where the packages live, as "section/package" (or, for components
+	// other than main, "component/section/package"), such as "devel/hello"
+	// or "contrib/utils/foo".
+	Locations []string
+}
+
+// Return the names of the packages in Locations, without their sections.
+func (e Entry) Packages() []string {
+	ret := []string{}
+	for _, location := range e.Locations {
+		ret = append(ret, location[strings.LastIndex(location, "/")+1:])
+	}
+	return ret
+}
+
+func (e Entry) String() string {
+	return e.Path + " " + strings.Join(e.Locations, ",")
+}
+
+// }}}
+
+// Reader {{{
+
+// Old Contents files start with some free-form text explaining what they
+// are, ending with a "FILE LOCATION" line. If that line doesn't turn up in
+// this many lines, there isn't a header.
+const maxHeaderLines = 64
+
+// A Reader streams Entries out of a Contents file.
+type Reader struct {
+	scanner *bufio.Scanner
+	closers []io.Closer
+	lineno  int
+
+	started bool
+	pending []string
+}
+
+// Create a Reader of the (already decompressed) Contents file.
+func NewReader(in io.Reader) *Reader {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &Reader{scanner: scanner}
+}
+
+// Open the Contents file at the given path, decompressing it if it's
+// compressed in any format the compression package knows.
+func Open(path string) (*Reader, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	decompressed, err := compression.NewReader(fd)
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	reader := NewReader(decompressed)
+	reader.closers = []io.Closer{decompressed, fd}
+	return reader, nil
+}
+
+// Close anything Open opened. Readers from NewReader have nothing to
+// close.
+func (r *Reader) Close() error {
+	var ret error
+	for _, closer := range r.closers {
+		if err := closer.Close(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	r.closers = nil
+	return ret
+}
+
+// Read the next line, from those held back while looking for a header
+// first.
+func (r *Reader) line() (string, bool) {
+	if len(r.pending) > 0 {
+		line := r.pending[0]
+		r.pending = r.pending[1:]
+		return line, true
+	}
+	if !r.scanner.Scan() {
+		return "", false
+	}
+	return r.scanner.Text(), true
+}
+
+// Split a line into its path and locations. Paths may have spaces in, but
+// the list of locations never does, so split on the last run of
+// whitespace.
+func splitLine(line string) (string, string, bool) {
+	i := strings.LastIndexAny(line, " \t")
+	if i < 0 {
+		return "", "", false
+	}
+	return strings.TrimRight(line[:i], " \t"), line[i+1:], true
+}
+
+// Look for (and throw away) an old style header.
+func (r *Reader) skipHeader() {
+	r.started = true
+	for len(r.pending) < maxHeaderLines && r.scanner.Scan() {
+		line := r.scanner.Text()
+		if pathname, locations, ok := splitLine(strings.TrimRight(line, " \t")); ok && pathname == "FILE" && locations == "LOCATION" {
+			r.lineno += len(r.pending) + 1
+			r.pending = nil
+			return
+		}
+		r.pending = append(r.pending, line)
+	}
+}
+
+// Return the next Entry, or io.EOF at the end of the file.
+func (r *Reader) Next() (*Entry, error) {
+	if !r.started {
+		r.skipHeader()
+	}
+	for {
+		line, ok := r.line()
+		if !ok {
+			break
+		}
+		r.lineno++
+
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			continue
+		}
+		pathname, locations, ok := splitLine(line)
+		if !ok {
+			return nil, fmt.Errorf("Contents line %d: no package list", r.lineno)
+		}
+		return &Entry{
+			Path:      strings.TrimPrefix(pathname, "/"),
+			Locations: strings.Split(locations, ","),
+		}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// }}}
+
+// Index {{{
+
+// An Index collects which packages ship which paths, to write out as a
+// Contents file.
+type Index struct {
+	paths map[string]map[string]bool
+}
+
+func NewIndex() *Index {
+	return &Index{paths: map[string]map[string]bool{}}
+}
+
+// Record that the package at the given location (such as "devel/hello")
+// ships a path.
+func (i *Index) Add(pathname, location string) {
+	pathname = strings.TrimPrefix(strings.TrimPrefix(pathname, "."), "/")
+	if i.paths[pathname] == nil {
+		i.paths[pathname] = map[string]bool{}
+	}
+	i.paths[pathname][location] = true
+}
+
+// Add every path in the data member of a .deb, other than directories,
+// under the package's Section and name, or just its name if it has no
+// Section. This reads deb.Data to the end.
+func (i *Index) AddDeb(debFile *deb.Deb) error {
+	location := debFile.Control.Package
+	if section := strings.TrimSpace(debFile.Control.Section); section != "" {
+		location = section + "/" + location
+	}
+	return deb.ReadTarEntries(debFile.Data, func(entry *deb.TarEntry, _ io.Reader) error {
+		if entry.Type != deb.DirectoryEntry {
+			i.Add(entry.Path, location)
+		}
+		return nil
+	})
+}
+
+// Return every path in the Index, sorted.
+func (i *Index) Paths() []string {
+	ret := []string{}
+	for pathname := range i.paths {
+		ret = append(ret, pathname)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Return the Entry for a path, with its locations sorted, or nil if no
+// package ships it.
+func (i *Index) Lookup(pathname string) *Entry {
+	locations, ok := i.paths[strings.TrimPrefix(pathname, "/")]
+	if !ok {
+		return nil
+	}
+	entry := Entry{Path: strings.TrimPrefix(pathname, "/")}
+	for location := range locations {
+		entry.Locations = append(entry.Locations, location)
+	}
+	sort.Strings(entry.Locations)
+	return &entry
+}
+
+// Write the Index out as a Contents file, sorted by path, with the
+// locations padded out to line up the way dak writes them.
+func (i *Index) WriteTo(out io.Writer) (int64, error) {
+	writer := bufio.NewWriter(out)
+	written := int64(0)
+	for _, pathname := range i.Paths() {
+		entry := i.Lookup(pathname)
+		n, err := fmt.Fprintf(writer, "%-55s %s\n", entry.Path, strings.Join(entry.Locations, ","))
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, writer.Flush()
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,185 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package contents_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/contents"
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/testsupport"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// Read every Entry out of a Reader.
+func readAll(t *testing.T, reader *contents.Reader) []*contents.Entry {
+	entries := []*contents.Entry{}
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			return entries
+		}
+		isok(t, err)
+		entries = append(entries, entry)
+	}
+}
+
+// {{{ Contents fixtures
+var withHeader = `This file maps each file available in the Debian GNU/Linux system to
+the package from which it originates.
+
+FILE                                                    LOCATION
+bin/foo                                                 utils/foo
+usr/share/doc/foo bar/README                            utils/foo,contrib/doc/bar
+`
+
+var withoutHeader = `bin/foo	utils/foo
+
+/usr/share/doc/foo bar/README                            utils/foo,contrib/doc/bar  
+`
+
+// }}}
+
+func TestReader(t *testing.T) {
+	for _, data := range []string{withHeader, withoutHeader} {
+		entries := readAll(t, contents.NewReader(strings.NewReader(data)))
+		assert(t, len(entries) == 2)
+		assert(t, entries[0].Path == "bin/foo")
+		assert(t, strings.Join(entries[0].Locations, " ") == "utils/foo")
+		assert(t, entries[1].Path == "usr/share/doc/foo bar/README")
+		assert(t, strings.Join(entries[1].Locations, " ") == "utils/foo contrib/doc/bar")
+		assert(t, strings.Join(entries[1].Packages(), " ") == "foo bar")
+	}
+
+	reader := contents.NewReader(strings.NewReader("bin/foo utils/foo\nbin/bar\n"))
+	_, err := reader.Next()
+	isok(t, err)
+	_, err = reader.Next()
+	notok(t, err)
+	assert(t, err.Error() == "Contents line 2: no package list")
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	compressed := bytes.Buffer{}
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(withHeader))
+	isok(t, err)
+	isok(t, writer.Close())
+	isok(t, os.WriteFile(filepath.Join(dir, "Contents-amd64.gz"), compressed.Bytes(), 0644))
+	isok(t, os.WriteFile(filepath.Join(dir, "Contents-amd64"), []byte(withoutHeader), 0644))
+
+	for _, name := range []string{"Contents-amd64.gz", "Contents-amd64"} {
+		reader, err := contents.Open(filepath.Join(dir, name))
+		isok(t, err)
+		entries := readAll(t, reader)
+		isok(t, reader.Close())
+		assert(t, len(entries) == 2)
+		assert(t, entries[1].Path == "usr/share/doc/foo bar/README")
+	}
+
+	_, err = contents.Open(filepath.Join(dir, "Contents-i386.gz"))
+	notok(t, err)
+}
+
+func TestIndex(t *testing.T) {
+	index := contents.NewIndex()
+	for _, pkg := range []testsupport.Deb{
+		{
+			Package: "hello",
+			Version: "2.10-1",
+			Fields:  map[string]string{"Section": "devel"},
+			Files: map[string]string{
+				"usr/bin/hello":              "#!/bin/sh\necho hello\n",
+				"usr/share/doc/hello/README": "hello\n",
+				"usr/share/common/hello.mo":  "",
+			},
+		},
+		{
+			Package: "hello-extras",
+			Version: "2.10-1",
+			Files: map[string]string{
+				"usr/share/common/hello.mo": "",
+			},
+		},
+	} {
+		data, err := pkg.Build()
+		isok(t, err)
+		debFile, err := deb.Load(bytes.NewReader(data), pkg.Package+".deb")
+		isok(t, err)
+		isok(t, index.AddDeb(debFile))
+		isok(t, debFile.Close())
+	}
+	index.Add("./usr/bin/hi", "contrib/devel/hi")
+
+	assert(t, strings.Join(index.Paths(), " ") == "usr/bin/hello usr/bin/hi usr/share/common/hello.mo usr/share/doc/hello/README")
+	assert(t, index.Lookup("/usr/share/common/hello.mo").String() == "usr/share/common/hello.mo devel/hello,hello-extras")
+	assert(t, index.Lookup("usr/bin/bye") == nil)
+
+	out := bytes.Buffer{}
+	n, err := index.WriteTo(&out)
+	isok(t, err)
+	assert(t, n == int64(out.Len()))
+
+	/* What's written reads back in */
+	entries := readAll(t, contents.NewReader(&out))
+	assert(t, len(entries) == 4)
+	assert(t, entries[0].String() == "usr/bin/hello devel/hello")
+	assert(t, entries[1].String() == "usr/bin/hi contrib/devel/hi")
+	assert(t, entries[2].String() == "usr/share/common/hello.mo devel/hello,hello-extras")
+}
+
+// vim: foldmethod=marker
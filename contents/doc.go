@@ -0,0 +1,28 @@
+/*
+Read and write Contents indices, such as
+dists/unstable/main/Contents-amd64.gz, which map each path in an archive
+to the packages that ship it, as apt-file uses.
+
+A Reader streams Entries out of a Contents file one line at a time, so even
+the largest (which run to hundreds of megabytes decompressed) don't need to
+be held in memory:
+
+	reader, err := contents.Open("Contents-amd64.gz")
+	if err != nil {
+		panic(err)
+	}
+	defer reader.Close()
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%s: %s\n", entry.Path, strings.Join(entry.Packages(), ", "))
+	}
+
+An Index goes the other way, collecting the files of a set of .debs (or
+anything else) and writing them out as a Contents file.
+*/
+package contents // import "pault.ag/go/debian/contents"
@@ -0,0 +1,195 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Artifact {{{
+
+// An Artifact is any of the files that make up an upload: a .changes, a
+// .dsc, a .buildinfo, or a .deb (deb.Deb). Upload queues, publishers and
+// verifiers can be written against an Artifact, rather than each type.
+//
+// The accessors are named Get*, as in GetDepends, since most of the types
+// already have fields named Version, Files and so on.
+type Artifact interface {
+	// Name of the source (or, for a .deb, binary) package.
+	GetName() string
+
+	GetVersion() version.Version
+	GetArchitectures() []dependency.Arch
+
+	// Files listed by the Artifact, with the strongest checksums it
+	// has for each. Filenames are relative to the directory the
+	// Artifact is in.
+	GetFiles() ([]FileHash, error)
+
+	// Check that every file listed by the Artifact is there, and matches
+	// its checksum.
+	VerifyFiles() error
+}
+
+var (
+	_ Artifact = &Changes{}
+	_ Artifact = &DSC{}
+	_ Artifact = &Buildinfo{}
+)
+
+// }}}
+
+// Helpers {{{
+
+// Return the strongest set of checksums given, as plain FileHashes. The
+// sets are given strongest first.
+func strongestFiles(sums ...Checksums) []FileHash {
+	for _, sum := range sums {
+		if len(sum.Files) != 0 {
+			return sum.Files
+		}
+	}
+	return []FileHash{}
+}
+
+// The Source field of a .changes or .buildinfo for a binNMU also has the
+// version of the source, as in "hello (2.10-3)"; drop that.
+func sourceName(source string) string {
+	if fields := strings.Fields(source); len(fields) > 0 {
+		return fields[0]
+	}
+	return source
+}
+
+// Check each file (relative to the directory of filename) against its
+// FileHash.
+func verifyFiles(filename string, files []FileHash) error {
+	dir := filepath.Dir(filename)
+	for _, file := range files {
+		if err := verifyFile(filepath.Join(dir, file.Filename), file); err != nil {
+			return fmt.Errorf("%s: %s", file.Filename, err)
+		}
+	}
+	return nil
+}
+
+func verifyFile(pathname string, hash FileHash) error {
+	f, err := os.Open(pathname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return hash.Verify(f)
+}
+
+// }}}
+
+// Changes {{{
+
+func (changes *Changes) GetName() string {
+	return sourceName(changes.Source)
+}
+
+func (changes *Changes) GetVersion() version.Version {
+	return changes.Version
+}
+
+func (changes *Changes) GetArchitectures() []dependency.Arch {
+	return changes.Architectures
+}
+
+func (changes *Changes) GetFiles() ([]FileHash, error) {
+	return strongestFiles(changes.Checksums("sha256"), changes.Checksums("sha1"), changes.Checksums("md5")), nil
+}
+
+func (changes *Changes) VerifyFiles() error {
+	files, err := changes.GetFiles()
+	if err != nil {
+		return err
+	}
+	return verifyFiles(changes.Filename, files)
+}
+
+// }}}
+
+// DSC {{{
+
+func (d *DSC) GetName() string {
+	return d.Source
+}
+
+func (d *DSC) GetVersion() version.Version {
+	return d.Version
+}
+
+func (d *DSC) GetArchitectures() []dependency.Arch {
+	return d.Architectures
+}
+
+func (d *DSC) GetFiles() ([]FileHash, error) {
+	return strongestFiles(d.Checksums("sha256"), d.Checksums("sha1"), d.Checksums("md5")), nil
+}
+
+func (d *DSC) VerifyFiles() error {
+	files, err := d.GetFiles()
+	if err != nil {
+		return err
+	}
+	return verifyFiles(d.Filename, files)
+}
+
+// }}}
+
+// Buildinfo {{{
+
+func (b *Buildinfo) GetName() string {
+	return sourceName(b.Source)
+}
+
+func (b *Buildinfo) GetVersion() version.Version {
+	return b.Version
+}
+
+func (b *Buildinfo) GetArchitectures() []dependency.Arch {
+	return b.Architectures
+}
+
+func (b *Buildinfo) GetFiles() ([]FileHash, error) {
+	return strongestFiles(b.Checksums("sha256"), b.Checksums("sha1"), b.Checksums("md5")), nil
+}
+
+func (b *Buildinfo) VerifyFiles() error {
+	files, err := b.GetFiles()
+	if err != nil {
+		return err
+	}
+	return verifyFiles(b.Filename, files)
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,123 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+func TestArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	orig := []byte("not really a tarball")
+	isok(t, os.WriteFile(filepath.Join(dir, "hello_2.10.orig.tar.gz"), orig, 0644))
+	deb := []byte("not really a .deb")
+	isok(t, os.WriteFile(filepath.Join(dir, "hello_2.10-3+b1_amd64.deb"), deb, 0644))
+
+	// {{{ artifacts
+	isok(t, os.WriteFile(filepath.Join(dir, "hello_2.10-3.dsc"), []byte(fmt.Sprintf(`Format: 3.0 (quilt)
+Source: hello
+Architecture: any
+Version: 2.10-3
+Checksums-Sha256:
+ %x %d hello_2.10.orig.tar.gz
+Files:
+ 00000000000000000000000000000000 %d hello_2.10.orig.tar.gz
+`, sha256.Sum256(orig), len(orig), len(orig))), 0644))
+
+	isok(t, os.WriteFile(filepath.Join(dir, "hello_2.10-3+b1_amd64.buildinfo"), []byte(fmt.Sprintf(`Format: 1.0
+Source: hello (2.10-3)
+Binary: hello
+Architecture: amd64
+Version: 2.10-3+b1
+Checksums-Sha256:
+ %x %d hello_2.10-3+b1_amd64.deb
+Build-Origin: Debian
+Build-Architecture: amd64
+Build-Date: Thu, 15 Oct 2026 12:00:00 +0000
+Build-Path: /build/hello-2.10
+Installed-Build-Depends:
+ base-files (= 13),
+ gcc-12 (= 12.2.0-14)
+Environment:
+ DEB_BUILD_OPTIONS="parallel=4"
+ LANG="C.UTF-8"
+`, sha256.Sum256(deb), len(deb))), 0644))
+
+	isok(t, os.WriteFile(filepath.Join(dir, "hello_2.10-3+b1_amd64.changes"), []byte(fmt.Sprintf(`Format: 1.8
+Source: hello (2.10-3)
+Binary: hello
+Architecture: amd64
+Version: 2.10-3+b1
+Distribution: unstable
+Checksums-Sha256:
+ %x %d hello_2.10-3+b1_amd64.deb
+Files:
+ %x %d devel optional hello_2.10-3+b1_amd64.deb
+`, sha256.Sum256(deb), len(deb), sha256.Sum256([]byte("wrong")), len(deb))), 0644))
+	// }}}
+
+	dsc, err := control.ParseDscFile(filepath.Join(dir, "hello_2.10-3.dsc"))
+	isok(t, err)
+	buildinfo, err := control.ParseBuildinfoFile(filepath.Join(dir, "hello_2.10-3+b1_amd64.buildinfo"))
+	isok(t, err)
+	changes, err := control.ParseChangesFile(filepath.Join(dir, "hello_2.10-3+b1_amd64.changes"))
+	isok(t, err)
+
+	assert(t, buildinfo.BuildPath == "/build/hello-2.10")
+	assert(t, buildinfo.BuildArchitecture.String() == "amd64")
+	assert(t, len(buildinfo.InstalledBuildDepends.Relations) == 2)
+	assert(t, strings.Contains(buildinfo.Environment, `LANG="C.UTF-8"`))
+
+	for _, artifact := range []control.Artifact{dsc, buildinfo, changes} {
+		assert(t, artifact.GetName() == "hello")
+		assert(t, len(artifact.GetArchitectures()) == 1)
+
+		/* Only the strongest checksums are used, so the bogus md5 in
+		 * the .changes Files doesn't matter */
+		files, err := artifact.GetFiles()
+		isok(t, err)
+		assert(t, len(files) == 1)
+		assert(t, files[0].Algorithm == "sha256")
+		isok(t, artifact.VerifyFiles())
+	}
+	assert(t, dsc.GetVersion().String() == "2.10-3")
+	assert(t, changes.GetVersion().String() == "2.10-3+b1")
+
+	assert(t, changes.Distribution == "unstable")
+
+	isok(t, os.WriteFile(filepath.Join(dir, "hello_2.10.orig.tar.gz"), []byte("changed"), 0644))
+	notok(t, dsc.VerifyFiles())
+	isok(t, os.Remove(filepath.Join(dir, "hello_2.10-3+b1_amd64.deb")))
+	notok(t, changes.VerifyFiles())
+}
+
+// vim: foldmethod=marker
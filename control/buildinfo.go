@@ -0,0 +1,114 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Buildinfo {{{
+
+// A Buildinfo is the encapsulation of a Debian .buildinfo file, which
+// records the environment a package was built in (the architecture, the
+// exact versions of every package installed, and so on), along with the
+// checksums of what the build produced, so that the build can be
+// reproduced and checked. See deb-buildinfo(5).
+type Buildinfo struct {
+	Paragraph
+
+	Filename string `control:"-"`
+
+	Format                string
+	Source                string
+	Binaries              []string          `control:"Binary,folded" delim:" "`
+	Architectures         []dependency.Arch `control:"Architecture"`
+	Version               version.Version
+	BinaryOnlyChanges     string                `control:"Binary-Only-Changes,multiline"`
+	ChecksumsMd5          []MD5FileHash         `control:"Checksums-Md5" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha1         []SHA1FileHash        `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha256       []SHA256FileHash      `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	BuildOrigin           string                `control:"Build-Origin"`
+	BuildArchitecture     dependency.Arch       `control:"Build-Architecture"`
+	BuildKernelVersion    string                `control:"Build-Kernel-Version"`
+	BuildDate             time.Time             `control:"Build-Date"`
+	BuildPath             string                `control:"Build-Path"`
+	BuildTaintedBy        []string              `control:"Build-Tainted-By" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	InstalledBuildDepends dependency.Dependency `control:"Installed-Build-Depends"`
+	Environment           string                `control:"Environment,multiline"`
+}
+
+// Given a path on the filesystem, Parse the file off the disk and return
+// a pointer to a brand new Buildinfo struct, unless error is set to a value
+// other than nil.
+func ParseBuildinfoFile(path string) (ret *Buildinfo, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseBuildinfo(bufio.NewReader(f), path)
+}
+
+// Given a bufio.Reader, consume the Reader, and return a Buildinfo object
+// for use. The "path" argument is used to set Buildinfo.Filename, which is
+// used to find the files it lists.
+func ParseBuildinfo(reader *bufio.Reader, path string) (*Buildinfo, error) {
+	ret := &Buildinfo{Filename: path}
+	return ret, Unmarshal(ret, reader)
+}
+
+// Return the files the build produced with their checksums of the given
+// algorithm ("md5", "sha1" or "sha256"), as Checksums. If there are none,
+// the list is empty.
+func (b *Buildinfo) Checksums(algorithm string) Checksums {
+	ret := Checksums{Algorithm: algorithm, Files: []FileHash{}}
+	switch algorithm {
+	case "md5":
+		for _, hash := range b.ChecksumsMd5 {
+			ret.Add(hash.FileHash)
+		}
+	case "sha1":
+		for _, hash := range b.ChecksumsSha1 {
+			ret.Add(hash.FileHash)
+		}
+	case "sha256":
+		for _, hash := range b.ChecksumsSha256 {
+			ret.Add(hash.FileHash)
+		}
+	}
+	return ret
+}
+
+// }}}
+
+// vim: foldmethod=marker
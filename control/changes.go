@@ -63,6 +63,10 @@ func (c *FileListChangesFileHash) UnmarshalControl(data string) error {
 	return nil
 }
 
+func (c FileListChangesFileHash) MarshalControl() (string, error) {
+	return fmt.Sprintf("%s %d %s %s %s", c.Hash, c.Size, c.Component, c.Priority, c.Filename), nil
+}
+
 // }}}
 
 // The Changes struct is the default encapsulation of the Debian .changes
@@ -77,11 +81,11 @@ func (c *FileListChangesFileHash) UnmarshalControl(data string) error {
 type Changes struct {
 	Paragraph
 
-	Filename string
+	Filename string `control:"-"`
 
 	Format          string
 	Source          string
-	Binaries        []string          `control:"Binary" delim:" "`
+	Binaries        []string          `control:"Binary,folded" delim:" "`
 	Architectures   []dependency.Arch `control:"Architecture"`
 	Version         version.Version
 	Origin          string
@@ -90,10 +94,10 @@ type Changes struct {
 	Maintainer      string
 	ChangedBy       string `control:"Changed-By"`
 	Closes          []string
-	Changes         string
-	ChecksumsSha1   []SHA1FileHash            `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t "`
-	ChecksumsSha256 []SHA256FileHash          `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t "`
-	Files           []FileListChangesFileHash `control:"Files" delim:"\n" strip:"\n\r\t "`
+	Changes         string                    `control:"Changes,multiline"`
+	ChecksumsSha1   []SHA1FileHash            `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha256 []SHA256FileHash          `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	Files           []FileListChangesFileHash `control:"Files" delim:"\n" strip:"\n\r\t " multiline:"true"`
 }
 
 // Given a path on the filesystem, Parse the file off the disk and return
@@ -139,6 +143,28 @@ func (changes *Changes) AbsFiles() []FileListChangesFileHash {
 	return ret
 }
 
+// Return the files listed in the .changes with their checksums of the given
+// algorithm ("md5", from Files, "sha1" or "sha256"), as Checksums. If there
+// are none, the list is empty.
+func (changes *Changes) Checksums(algorithm string) Checksums {
+	ret := Checksums{Algorithm: algorithm, Files: []FileHash{}}
+	switch algorithm {
+	case "md5":
+		for _, hash := range changes.Files {
+			ret.Add(hash.FileHash)
+		}
+	case "sha1":
+		for _, hash := range changes.ChecksumsSha1 {
+			ret.Add(hash.FileHash)
+		}
+	case "sha256":
+		for _, hash := range changes.ChecksumsSha256 {
+			ret.Add(hash.FileHash)
+		}
+	}
+	return ret
+}
+
 // Return a DSC struct for the DSC listed in the .changes file. This requires
 // Changes.Filename to be correctly set, and for the .dsc file to exist
 // in the correct place next to the .changes.
@@ -227,4 +253,182 @@ func (changes *Changes) Remove() error {
 	return os.Remove(changes.Filename)
 }
 
+// {{{ File classification
+
+// A FileClass is the kind of thing a file in an upload is, as far as the
+// archive is concerned.
+type FileClass int
+
+const (
+	// Part of the source package (.dsc, .tar.*, .diff.gz), or the
+	// .buildinfo for a source-only build.
+	SourceFile FileClass = iota
+	// A binary package built for Architecture: all.
+	ArchIndepFile
+	// A binary package built for a specific architecture.
+	ArchDepFile
+	// A .buildinfo for a binary build.
+	BuildInfoFile
+	// Anything else, such as a byhand tarball.
+	OtherFile
+)
+
+func (c FileClass) String() string {
+	switch c {
+	case SourceFile:
+		return "source"
+	case ArchIndepFile:
+		return "arch-indep"
+	case ArchDepFile:
+		return "arch-dep"
+	case BuildInfoFile:
+		return "buildinfo"
+	case OtherFile:
+		return "other"
+	default:
+		return fmt.Sprintf("FileClass(%d)", int(c))
+	}
+}
+
+// Work out the FileClass of a file from its name, following the usual
+// <package>_<version>_<arch>.<ext> naming scheme.
+func ClassifyFile(filename string) FileClass {
+	base := filepath.Base(filename)
+	for _, ext := range []string{".deb", ".udeb", ".ddeb"} {
+		if !strings.HasSuffix(base, ext) {
+			continue
+		}
+		if strings.HasSuffix(strings.TrimSuffix(base, ext), "_all") {
+			return ArchIndepFile
+		}
+		return ArchDepFile
+	}
+	if strings.HasSuffix(base, ".buildinfo") {
+		if strings.HasSuffix(base, "_source.buildinfo") {
+			return SourceFile
+		}
+		return BuildInfoFile
+	}
+	if strings.HasSuffix(base, ".dsc") || strings.HasSuffix(base, ".diff.gz") ||
+		strings.Contains(base, ".tar.") || strings.HasSuffix(base, ".tar") {
+		return SourceFile
+	}
+	return OtherFile
+}
+
+// Return the Files entries of the given classes.
+func (changes *Changes) FilesOf(classes ...FileClass) []FileListChangesFileHash {
+	ret := []FileListChangesFileHash{}
+	for _, file := range changes.Files {
+		for _, class := range classes {
+			if ClassifyFile(file.Filename) == class {
+				ret = append(ret, file)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// Return true if the upload has nothing but source files in it.
+func (changes *Changes) IsSourceOnly() bool {
+	return len(changes.Files) != 0 && len(changes.FilesOf(SourceFile)) == len(changes.Files)
+}
+
+// Return true if the upload includes any Architecture: all binaries.
+func (changes *Changes) HasArchIndep() bool {
+	return len(changes.FilesOf(ArchIndepFile)) != 0
+}
+
+// Return true if the upload includes any architecture specific binaries.
+func (changes *Changes) HasArchDep() bool {
+	return len(changes.FilesOf(ArchDepFile)) != 0
+}
+
+// Split a combined upload into a source-only upload (as dak would name
+// "<source>_<version>_source.changes") and an upload of everything else.
+// Either half will be nil if there's nothing to put in it. The new Changes
+// are not written to disk; their Filename is set to where they'd go next
+// to this one.
+func (changes *Changes) Split() (source *Changes, binary *Changes) {
+	source = changes.subset("source", func(arch dependency.Arch) bool {
+		return arch.CPU == "source"
+	}, SourceFile)
+	if source != nil {
+		source.Binaries = nil
+		source.Paragraph = withoutKeys(source.Paragraph, "Binary", "Description")
+	}
+
+	binaryArches := []string{}
+	for _, arch := range changes.Architectures {
+		if arch.CPU != "source" {
+			binaryArches = append(binaryArches, arch.String())
+		}
+	}
+	binary = changes.subset(strings.Join(binaryArches, "+"), func(arch dependency.Arch) bool {
+		return arch.CPU != "source"
+	}, ArchIndepFile, ArchDepFile, BuildInfoFile, OtherFile)
+	return source, binary
+}
+
+// Return a copy of the Changes with only files of the given classes, and
+// only the matching Architectures.
+func (changes *Changes) subset(suffix string, keepArch func(dependency.Arch) bool, classes ...FileClass) *Changes {
+	files := changes.FilesOf(classes...)
+	if len(files) == 0 {
+		return nil
+	}
+	keep := map[string]bool{}
+	for _, file := range files {
+		keep[file.Filename] = true
+	}
+
+	ret := *changes
+	ret.Paragraph = withoutKeys(changes.Paragraph)
+	ret.Files = files
+	ret.ChecksumsSha1 = []SHA1FileHash{}
+	for _, hash := range changes.ChecksumsSha1 {
+		if keep[hash.Filename] {
+			ret.ChecksumsSha1 = append(ret.ChecksumsSha1, hash)
+		}
+	}
+	ret.ChecksumsSha256 = []SHA256FileHash{}
+	for _, hash := range changes.ChecksumsSha256 {
+		if keep[hash.Filename] {
+			ret.ChecksumsSha256 = append(ret.ChecksumsSha256, hash)
+		}
+	}
+	ret.Architectures = []dependency.Arch{}
+	for _, arch := range changes.Architectures {
+		if keepArch(arch) {
+			ret.Architectures = append(ret.Architectures, arch)
+		}
+	}
+
+	ret.Filename = filepath.Join(
+		filepath.Dir(changes.Filename),
+		fmt.Sprintf("%s_%s_%s.changes", changes.Source, changes.Version.StringWithoutEpoch(), suffix),
+	)
+	return &ret
+}
+
+// Return a copy of the Paragraph, without the given keys.
+func withoutKeys(para Paragraph, keys ...string) Paragraph {
+	drop := map[string]bool{}
+	for _, key := range keys {
+		drop[key] = true
+	}
+	ret := Paragraph{Order: []string{}, Values: map[string]string{}}
+	for _, key := range para.Order {
+		if drop[key] {
+			continue
+		}
+		ret.Order = append(ret.Order, key)
+		ret.Values[key] = para.Values[key]
+	}
+	return ret
+}
+
+// }}}
+
 // vim: foldmethod=marker
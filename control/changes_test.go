@@ -22,6 +22,7 @@ package control_test
 
 import (
 	"bufio"
+	"bytes"
 	"strings"
 	"testing"
 
@@ -135,4 +136,80 @@ Files:
 	assert(t, len(changes.Files) == 2)
 }
 
+func TestClassifyFile(t *testing.T) {
+	for name, class := range map[string]control.FileClass{
+		"hello_2.10-1.dsc":              control.SourceFile,
+		"hello_2.10.orig.tar.gz":        control.SourceFile,
+		"hello_2.10-1.debian.tar.xz":    control.SourceFile,
+		"hello_2.10-1_source.buildinfo": control.SourceFile,
+		"hello_2.10-1_amd64.buildinfo":  control.BuildInfoFile,
+		"hello_2.10-1_amd64.deb":        control.ArchDepFile,
+		"hello-doc_2.10-1_all.deb":      control.ArchIndepFile,
+		"hello-udeb_2.10-1_all.udeb":    control.ArchIndepFile,
+		"hello-dbgsym_2.10-1_i386.ddeb": control.ArchDepFile,
+		"hello_2.10-1_amd64.changes":    control.OtherFile,
+	} {
+		assert(t, control.ClassifyFile(name) == class)
+	}
+}
+
+func TestChangesSplit(t *testing.T) {
+	// Test Paragraph {{{
+	reader := bufio.NewReader(strings.NewReader(`Format: 1.8
+Source: hello
+Binary: hello hello-doc
+Architecture: source amd64 all
+Version: 1:2.10-1
+Distribution: unstable
+Description:
+ hello      - example package based on GNU hello
+ hello-doc  - documentation for hello
+X-Custom: kept
+Checksums-Sha256:
+ 2489ed1a2e052ccc4c321719a2394ac4b6958209f05b1531305d2a52173aa5c1 1131 hello_2.10-1.dsc
+ 5ef401d9b67b009443f249aa79b952839c69a2b5437fbe957832599b655e1df0 82504 hello_2.10-1_amd64.deb
+ cb136f28a8c971d4299cc68e8fdad93a8ca7daf3cb136f28a8c971d4299cc68e 2048 hello-doc_2.10-1_all.deb
+Files:
+ a74c9e3e9fe05d480d24cd43b225ee0c 1131 devel optional hello_2.10-1.dsc
+ 67e67e85a267c0c8110001b1a6cfc293 82504 devel optional hello_2.10-1_amd64.deb
+ 77e97879793f57ee93cb3d59d8c5d163 2048 doc optional hello-doc_2.10-1_all.deb
+`))
+	// }}}
+	changes, err := control.ParseChanges(reader, "/srv/incoming/hello_2.10-1_multi.changes")
+	isok(t, err)
+	assert(t, !changes.IsSourceOnly())
+	assert(t, changes.HasArchIndep())
+	assert(t, changes.HasArchDep())
+
+	source, binary := changes.Split()
+	assert(t, source != nil && binary != nil)
+	assert(t, source.IsSourceOnly())
+	assert(t, source.Filename == "/srv/incoming/hello_2.10-1_source.changes")
+	assert(t, len(source.Architectures) == 1)
+	assert(t, len(source.ChecksumsSha256) == 1)
+	assert(t, binary.Filename == "/srv/incoming/hello_2.10-1_amd64+all.changes")
+	assert(t, len(binary.Files) == 2)
+	assert(t, len(binary.FilesOf(control.SourceFile)) == 0)
+
+	/* The original is left alone */
+	assert(t, len(changes.Files) == 3)
+
+	/* And the source half can be written out and read back in */
+	out := bytes.Buffer{}
+	isok(t, control.Marshal(&out, source))
+	assert(t, !strings.Contains(out.String(), "Binary:"))
+	assert(t, !strings.Contains(out.String(), "Description:"))
+	assert(t, strings.Contains(out.String(), "X-Custom: kept"))
+	assert(t, strings.Contains(out.String(), "Files:\n a74c9e3e9fe05d480d24cd43b225ee0c"))
+	reparsed, err := control.ParseChanges(bufio.NewReader(&out), "")
+	isok(t, err)
+	assert(t, reparsed.IsSourceOnly())
+	assert(t, reparsed.Architectures[0].CPU == "source")
+	assert(t, len(reparsed.ChecksumsSha256) == 1)
+
+	sourceOnly, none := source.Split()
+	assert(t, sourceOnly != nil)
+	assert(t, none == nil)
+}
+
 // vim: foldmethod=marker
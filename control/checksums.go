@@ -0,0 +1,184 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Checksums {{{
+
+// Checksums is a list of files with their sizes and hashes, all with the
+// same algorithm, as in the Files and Checksums-* fields of a .dsc or
+// .changes, or the MD5Sum, SHA1, SHA256 and SHA512 stanzas of a Release
+// file: one "hash size filename" line per file. The "hash size section
+// priority filename" lines of the Files field of a .changes are read too,
+// though the section and priority are dropped.
+//
+// DSC, Changes, Buildinfo and Release keep their own typed lists (such as
+// []SHA256FileHash) in their fields; their Checksums methods return them
+// as Checksums.
+//
+// As a struct field, the Algorithm is worked out from the length of the
+// hashes, so one type does for all of them:
+//
+//	type Upload struct {
+//		Files           control.Checksums
+//		ChecksumsSha256 control.Checksums `control:"Checksums-Sha256"`
+//	}
+type Checksums struct {
+	Algorithm string
+	Files     []FileHash
+}
+
+// The algorithm for a hex encoded digest of each length.
+var checksumAlgorithms = map[int]string{
+	32:  "md5",
+	40:  "sha1",
+	64:  "sha256",
+	128: "sha512",
+}
+
+// Parse the value of a checksums field, one "hash size filename" per line.
+// If algorithm is "", it's worked out from the length of the hashes.
+func ParseChecksums(algorithm, value string) (*Checksums, error) {
+	ret := Checksums{Algorithm: algorithm, Files: []FileHash{}}
+	for _, line := range strings.Split(value, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 3:
+		case 5:
+			/* The Files field of a .changes has the section and
+			 * priority before the filename; Changes.Files keeps
+			 * those, they're not needed here. */
+			fields = []string{fields[0], fields[1], fields[4]}
+		default:
+			return nil, fmt.Errorf("Malformed checksums line: '%s'", strings.TrimSpace(line))
+		}
+		if ret.Algorithm == "" {
+			ret.Algorithm = checksumAlgorithms[len(fields[0])]
+			if ret.Algorithm == "" {
+				return nil, fmt.Errorf("Unknown checksum algorithm for '%s'", fields[0])
+			}
+		}
+		hash := FileHash{}
+		if err := hash.unmarshalControl(ret.Algorithm, strings.Join(fields, " ")); err != nil {
+			return nil, err
+		}
+		ret.Files = append(ret.Files, hash)
+	}
+	return &ret, nil
+}
+
+// Add a file to the list. If the Checksums has no Algorithm yet, it
+// takes the hash's.
+func (c *Checksums) Add(hash FileHash) {
+	if c.Algorithm == "" {
+		c.Algorithm = hash.Algorithm
+	}
+	c.Files = append(c.Files, hash)
+}
+
+// Return the FileHash for the file with the given name, if it's listed.
+func (c Checksums) Lookup(filename string) (FileHash, bool) {
+	for _, hash := range c.Files {
+		if hash.Filename == filename {
+			return hash, true
+		}
+	}
+	return FileHash{}, false
+}
+
+// Return the names of the files listed, in order.
+func (c Checksums) Filenames() []string {
+	ret := make([]string, len(c.Files))
+	for i, hash := range c.Files {
+		ret[i] = hash.Filename
+	}
+	return ret
+}
+
+// Check the contents of the named file, read from reader, against the
+// size and hash it's listed with. It's an error for the file not to be
+// listed at all.
+func (c Checksums) Verify(filename string, reader io.Reader) error {
+	hash, ok := c.Lookup(filename)
+	if !ok {
+		return fmt.Errorf("%s: not listed in the %s checksums", filename, c.Algorithm)
+	}
+	if err := hash.Verify(reader); err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	return nil
+}
+
+// Return the value of the field, with each file on its own line.
+func (c Checksums) String() string {
+	lines := []string{""}
+	for i := range c.Files {
+		line, _ := c.Files[i].marshalControl()
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *Checksums) UnmarshalControl(value string) error {
+	checksums, err := ParseChecksums("", value)
+	if err != nil {
+		return err
+	}
+	*c = *checksums
+	return nil
+}
+
+func (c Checksums) MarshalControl() (string, error) {
+	return c.String(), nil
+}
+
+// }}}
+
+// FileHash.Verify {{{
+
+// Read everything from reader, checking that it's the right Size, and
+// has the right hash.
+func (c *FileHash) Verify(reader io.Reader) error {
+	verifier, err := c.Verifier()
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(verifier, reader)
+	if err != nil {
+		return err
+	}
+	if size != c.Size {
+		return fmt.Errorf("size mismatch: got %d, want %d", size, c.Size)
+	}
+	return verifier.Close()
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,146 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+func TestParseChecksums(t *testing.T) {
+	sums, err := control.ParseChecksums("", `
+ 2c91c414f8c7a0556372c94301b8786801a05b29aafeceb2e308e037d47d5ddc 2170 hy_0.11.0-4.dsc
+ 27610d4e31645bc888c633881082270917aedd3443e36031a0030d3dae6f7380 7536 hy_0.11.0-4.debian.tar.xz
+`)
+	isok(t, err)
+	assert(t, sums.Algorithm == "sha256")
+	assert(t, len(sums.Files) == 2)
+	assert(t, strings.Join(sums.Filenames(), " ") == "hy_0.11.0-4.dsc hy_0.11.0-4.debian.tar.xz")
+
+	hash, ok := sums.Lookup("hy_0.11.0-4.debian.tar.xz")
+	assert(t, ok)
+	assert(t, hash.Size == 7536)
+	assert(t, hash.Algorithm == "sha256")
+	_, ok = sums.Lookup("hy_0.11.0.orig.tar.gz")
+	assert(t, !ok)
+
+	sums, err = control.ParseChecksums("", "d41d8cd98f00b204e9800998ecf8427e 0 empty\n")
+	isok(t, err)
+	assert(t, sums.Algorithm == "md5")
+
+	/* The Files field of a .changes, with a section and priority */
+	sums, err = control.ParseChecksums("", `
+ d41d8cd98f00b204e9800998ecf8427e 0 devel optional hello_1.0-1_amd64.deb
+ 900150983cd24fb0d6963f7d28e17f72 3 devel optional hello_1.0-1.dsc
+`)
+	isok(t, err)
+	assert(t, sums.Algorithm == "md5")
+	assert(t, strings.Join(sums.Filenames(), " ") == "hello_1.0-1_amd64.deb hello_1.0-1.dsc")
+	hash, ok = sums.Lookup("hello_1.0-1.dsc")
+	assert(t, ok)
+	assert(t, hash.Size == 3)
+	assert(t, hash.Hash == "900150983cd24fb0d6963f7d28e17f72")
+
+	_, err = control.ParseChecksums("", "d41d8cd98f00b204e9800998ecf8427e 0 devel empty\n")
+	notok(t, err)
+
+	_, err = control.ParseChecksums("", "abc 0 empty\n")
+	notok(t, err)
+	_, err = control.ParseChecksums("md5", "d41d8cd98f00b204e9800998ecf8427e empty\n")
+	notok(t, err)
+	_, err = control.ParseChecksums("md5", "d41d8cd98f00b204e9800998ecf8427e nope empty\n")
+	notok(t, err)
+}
+
+func TestChecksumsVerify(t *testing.T) {
+	sums, err := control.ParseChecksums("sha1", `
+ a9993e364706816aba3e25717850c26c9cd0d89d 3 abc
+ da39a3ee5e6b4b0d3255bfef95601890afd80709 0 empty
+`)
+	isok(t, err)
+	isok(t, sums.Verify("abc", strings.NewReader("abc")))
+	isok(t, sums.Verify("empty", strings.NewReader("")))
+	notok(t, sums.Verify("abc", strings.NewReader("abd")))
+	notok(t, sums.Verify("abc", strings.NewReader("abcd")))
+	notok(t, sums.Verify("missing", strings.NewReader("")))
+}
+
+type checksumsStruct struct {
+	Files           control.Checksums
+	ChecksumsSha256 control.Checksums `control:"Checksums-Sha256"`
+}
+
+func TestChecksumsControl(t *testing.T) {
+	input := `Files:
+ 900150983cd24fb0d6963f7d28e17f72 3 abc
+Checksums-Sha256:
+ ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad 3 abc
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 empty
+`
+	sums := checksumsStruct{}
+	isok(t, control.Unmarshal(&sums, strings.NewReader(input)))
+	assert(t, sums.Files.Algorithm == "md5")
+	assert(t, len(sums.Files.Files) == 1)
+	assert(t, sums.ChecksumsSha256.Algorithm == "sha256")
+	assert(t, len(sums.ChecksumsSha256.Files) == 2)
+	isok(t, sums.ChecksumsSha256.Verify("abc", strings.NewReader("abc")))
+
+	out := bytes.Buffer{}
+	isok(t, control.Marshal(&out, sums))
+	assert(t, out.String() == input)
+}
+
+func TestChecksumsAccessors(t *testing.T) {
+	changes := control.Changes{}
+	isok(t, control.Unmarshal(&changes, strings.NewReader(`Source: hello
+Checksums-Sha256:
+ ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad 3 hello_1.0-1.dsc
+Files:
+ 900150983cd24fb0d6963f7d28e17f72 3 devel optional hello_1.0-1.dsc
+`)))
+	sums := changes.Checksums("md5")
+	assert(t, sums.Algorithm == "md5")
+	isok(t, sums.Verify("hello_1.0-1.dsc", strings.NewReader("abc")))
+	sums = changes.Checksums("sha256")
+	assert(t, sums.Algorithm == "sha256")
+	isok(t, sums.Verify("hello_1.0-1.dsc", strings.NewReader("abc")))
+	assert(t, len(changes.Checksums("sha1").Files) == 0)
+
+	release := control.Release{}
+	isok(t, control.Unmarshal(&release, strings.NewReader(`Suite: unstable
+SHA256:
+ ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad 3 main/binary-amd64/Packages
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 main/binary-amd64/Release
+`)))
+	assert(t, strings.Join(release.Checksums("sha256").Filenames(), " ") ==
+		"main/binary-amd64/Packages main/binary-amd64/Release")
+	assert(t, len(release.Checksums("sha512").Files) == 0)
+	assert(t, len(release.Checksums("whirlpool").Files) == 0)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,205 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+)
+
+// Clearsigned documents {{{
+
+// The parts of an OpenPGP clearsigned document (RFC 4880, section 7). This
+// only takes the document apart, so that control doesn't need an OpenPGP
+// implementation; checking the signature is up to the pgp package.
+type clearsigned struct {
+	// The text as it was written, with LF line endings, and with the
+	// dash-escaping taken off.
+	plaintext []byte
+
+	// The text as it was signed: as plaintext, but with trailing
+	// whitespace dropped, and CRLF between the lines.
+	signedData []byte
+
+	// The binary signature, with the armor taken off.
+	signature []byte
+}
+
+const (
+	clearsignBegin   = "-----BEGIN PGP SIGNED MESSAGE-----"
+	signatureBegin   = "-----BEGIN PGP SIGNATURE-----"
+	signatureEnd     = "-----END PGP SIGNATURE-----"
+	armorEnd         = "-----END "
+	armorLineMaximum = 96
+)
+
+// Return the next line of data, without its LF or CRLF, and the rest of the
+// data after it.
+func nextLine(data []byte) ([]byte, []byte) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return data, nil
+	}
+	line, rest := data[:i], data[i+1:]
+	return bytes.TrimSuffix(line, []byte("\r")), rest
+}
+
+// Take apart the first clearsigned message in data, as gpg would.
+func decodeClearsigned(data []byte) (*clearsigned, error) {
+	var rest []byte
+	if bytes.HasPrefix(data, []byte(clearsignBegin)) {
+		rest = data[len(clearsignBegin):]
+	} else if i := bytes.Index(data, []byte("\n"+clearsignBegin)); i >= 0 {
+		rest = data[i+1+len(clearsignBegin):]
+	} else {
+		return nil, fmt.Errorf("No clearsigned message")
+	}
+
+	line, rest := nextLine(rest)
+	if len(line) != 0 {
+		return nil, fmt.Errorf("Junk after %s", clearsignBegin)
+	}
+
+	/* The armor headers; only Hash is allowed here, since anything else
+	 * could be used to smuggle text past whoever reads the signed text */
+	for {
+		if len(rest) == 0 {
+			return nil, fmt.Errorf("Clearsigned message ends in its headers")
+		}
+		if line, rest = nextLine(rest); len(line) == 0 {
+			break
+		}
+		if bytes.IndexFunc(line, func(r rune) bool { return r < 0x20 || r > 0x7e }) >= 0 {
+			return nil, fmt.Errorf("Clearsigned message has a bad header")
+		}
+		colon := bytes.IndexByte(line, ':')
+		if colon < 0 || string(bytes.TrimSpace(line[:colon])) != "Hash" {
+			return nil, fmt.Errorf("Clearsigned message has a bad header")
+		}
+	}
+
+	ret := clearsigned{plaintext: []byte{}, signedData: []byte{}}
+	for first := true; ; first = false {
+		if len(rest) == 0 {
+			return nil, fmt.Errorf("Clearsigned message has no signature")
+		}
+		line, rest = nextLine(rest)
+		if string(line) == signatureBegin {
+			break
+		}
+		/* The line ending before the signature isn't signed */
+		if !first {
+			ret.signedData = append(ret.signedData, '\r', '\n')
+		}
+		line = bytes.TrimPrefix(line, []byte("- "))
+		line = bytes.TrimRight(line, " \t")
+		ret.signedData = append(ret.signedData, line...)
+		ret.plaintext = append(append(ret.plaintext, line...), '\n')
+	}
+
+	signature, err := decodeArmor(rest)
+	if err != nil {
+		return nil, fmt.Errorf("Bad signature armor: %s", err)
+	}
+	ret.signature = signature
+	return &ret, nil
+}
+
+// Decode the body of an armored signature, starting after its BEGIN line:
+// any armor headers, then a blank line, then the base64 data, an optional
+// CRC-24 checksum line, and the END line.
+func decodeArmor(data []byte) ([]byte, error) {
+	var line []byte
+	for {
+		if len(data) == 0 {
+			return nil, fmt.Errorf("No blank line after the armor headers")
+		}
+		line, data = nextLine(data)
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			break
+		}
+		if !bytes.Contains(line, []byte(": ")) {
+			return nil, fmt.Errorf("Bad armor header %q", line)
+		}
+	}
+
+	encoded := []byte{}
+	checksum := []byte(nil)
+	for {
+		if len(data) == 0 {
+			return nil, fmt.Errorf("No %s line", signatureEnd)
+		}
+		line, data = nextLine(data)
+		if bytes.HasPrefix(line, []byte(armorEnd)) {
+			break
+		}
+		if checksum != nil {
+			return nil, fmt.Errorf("Data after the armor checksum")
+		}
+		if len(line) == 5 && line[0] == '=' {
+			checksum = line[1:]
+			continue
+		}
+		if len(line) > armorLineMaximum {
+			return nil, fmt.Errorf("Armor line too long")
+		}
+		encoded = append(encoded, line...)
+	}
+
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+	n, err := base64.StdEncoding.Decode(decoded, encoded)
+	if err != nil {
+		return nil, err
+	}
+	decoded = decoded[:n]
+
+	if checksum != nil {
+		sum := make([]byte, 3)
+		if n, err := base64.StdEncoding.Decode(sum, checksum); err != nil || n != 3 {
+			return nil, fmt.Errorf("Bad armor checksum")
+		}
+		if crc24(decoded) != uint32(sum[0])<<16|uint32(sum[1])<<8|uint32(sum[2]) {
+			return nil, fmt.Errorf("Armor checksum mismatch")
+		}
+	}
+	return decoded, nil
+}
+
+// The CRC-24 armor checksum of RFC 4880, section 6.1.
+func crc24(data []byte) uint32 {
+	crc := uint32(0xb704ce)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -23,10 +23,13 @@ package control // import "pault.ag/go/debian/control"
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/identity"
 )
 
 // Encapsulation for a debian/control file, which is a series of RFC2822-like
@@ -53,15 +56,26 @@ type SourceParagraph struct {
 	Paragraph
 
 	Maintainer  string
-	Uploaders   []string `delim:","`
+	Uploaders   []string `control:"Uploaders,folded" delim:","`
 	Source      string
 	Priority    string
 	Section     string
-	Description string
+	Description string `control:"Description,multiline"`
+
+	StandardsVersion  string `control:"Standards-Version"`
+	Homepage          string
+	VcsBrowser        string `control:"Vcs-Browser"`
+	VcsGit            string `control:"Vcs-Git"`
+	VcsSvn            string `control:"Vcs-Svn"`
+	VcsBzr            string `control:"Vcs-Bzr"`
+	RulesRequiresRoot string `control:"Rules-Requires-Root"`
+	Testsuite         string
 
 	BuildDepends        dependency.Dependency `control:"Build-Depends"`
+	BuildDependsArch    dependency.Dependency `control:"Build-Depends-Arch"`
 	BuildDependsIndep   dependency.Dependency `control:"Build-Depends-Indep"`
 	BuildConflicts      dependency.Dependency `control:"Build-Conflicts"`
+	BuildConflictsArch  dependency.Dependency `control:"Build-Conflicts-Arch"`
 	BuildConflictsIndep dependency.Dependency `control:"Build-Conflicts-Indep"`
 }
 
@@ -82,7 +96,11 @@ type BinaryParagraph struct {
 	Priority      string
 	Section       string
 	Essential     bool
-	Description   string
+	MultiArch     MultiArch `control:"Multi-Arch"`
+	Homepage      string
+	PackageType   string        `control:"Package-Type"`
+	BuildProfiles string        `control:"Build-Profiles"`
+	Description   string        `control:"Description,multiline"`
 	Conffiles     []MD5FileHash `delim:"\n" strip:"\n\r\t "`
 
 	Depends    dependency.Dependency
@@ -95,9 +113,116 @@ type BinaryParagraph struct {
 	Conflicts dependency.Dependency
 	Replaces  dependency.Dependency
 
+	Provides   dependency.Dependency
 	BuiltUsing dependency.Dependency `control:"Built-Using"`
 }
 
+// Return true if the binary package is built on the given (concrete)
+// Architecture; that is, if any of its Architectures is, or is a wildcard
+// that matches, arch. Architecture "all" packages are only built for
+// "all", not for every architecture.
+func (b *BinaryParagraph) BuildsOn(arch dependency.Arch) bool {
+	for i := range b.Architectures {
+		if b.Architectures[i].Is(&arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse the Build-Profiles restriction formula of the binary package,
+// such as "<!nocheck> <stage1>". A package with no Build-Profiles field
+// has no restrictions, and an empty list is returned.
+func (b *BinaryParagraph) GetBuildProfiles() ([]dependency.StageSet, error) {
+	if strings.TrimSpace(b.BuildProfiles) == "" {
+		return []dependency.StageSet{}, nil
+	}
+	/* The formula is the same as the one that may follow a package name
+	 * in a relation, so borrow the relation parser for it. */
+	dep, err := dependency.Parse(b.Package + " " + b.BuildProfiles)
+	if err != nil {
+		return nil, fmt.Errorf("Build-Profiles: %s", err)
+	}
+	if len(dep.Relations) != 1 || len(dep.Relations[0].Possibilities) != 1 {
+		return nil, fmt.Errorf("Build-Profiles: malformed value '%s'", b.BuildProfiles)
+	}
+	return dep.Relations[0].Possibilities[0].StageSets, nil
+}
+
+// Return true if the binary package is built with the given build
+// profiles active, according to its Build-Profiles field.
+func (b *BinaryParagraph) BuildsWith(profiles []string) (bool, error) {
+	stageSets, err := b.GetBuildProfiles()
+	if err != nil {
+		return false, err
+	}
+	possi := dependency.Possibility{StageSets: stageSets}
+	return possi.ProfilesMatch(profiles), nil
+}
+
+// Return the binary packages that are built on the given Architecture (as
+// BinaryParagraph.BuildsOn), in the order they're listed.
+func (c *Control) BinariesFor(arch dependency.Arch) []BinaryParagraph {
+	ret := []BinaryParagraph{}
+	for _, binary := range c.Binaries {
+		if binary.BuildsOn(arch) {
+			ret = append(ret, binary)
+		}
+	}
+	return ret
+}
+
+// Write the Control back out as a debian/control file, the Source
+// paragraph followed by each of the Binaries. Fields that were read in
+// but aren't modelled by the structs are kept, and fields are written in
+// the order they were read.
+func (c *Control) Marshal(out io.Writer) error {
+	source, err := ConvertToParagraph(&c.Source)
+	if err != nil {
+		return err
+	}
+	paragraphs := []Paragraph{*source}
+
+	for i := range c.Binaries {
+		binary := &c.Binaries[i]
+		para, err := ConvertToParagraph(binary)
+		if err != nil {
+			return err
+		}
+		/* Nobody writes "Essential: no" by hand, so don't add one. */
+		if _, ok := binary.Values["Essential"]; !ok && !binary.Essential {
+			para = withoutField(para, "Essential")
+		}
+		paragraphs = append(paragraphs, *para)
+	}
+
+	for i, para := range paragraphs {
+		if i != 0 {
+			if _, err := out.Write([]byte("\n")); err != nil {
+				return err
+			}
+		}
+		if err := para.WriteTo(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drop a field from a Paragraph, keeping everything else (including the
+// text of the fields as they were read) as it was.
+func withoutField(para *Paragraph, key string) *Paragraph {
+	order := []string{}
+	for _, el := range para.Order {
+		if el != key {
+			order = append(order, el)
+		}
+	}
+	para.Order = order
+	delete(para.Values, key)
+	return para
+}
+
 func (para *Paragraph) getDependencyField(field string) (*dependency.Dependency, error) {
 	if val, ok := para.Values[field]; ok {
 		return dependency.Parse(val)
@@ -114,6 +239,31 @@ func (para *Paragraph) getOptionalDependencyField(field string) dependency.Depen
 	return *dep
 }
 
+// Parse the Maintainer field, and the comma separated Uploaders field (if
+// there is one), into Identities, with the Maintainer first. Unlike
+// splitting the Uploaders on commas, this copes with a comma in a quoted
+// name, such as `"Doe, Jane" <jane@example.org>`.
+func (para *Paragraph) GetMaintainers() ([]identity.Identity, error) {
+	maintainer, err := identity.Parse(para.Values["Maintainer"])
+	if err != nil {
+		return nil, fmt.Errorf("Maintainer: %s", err)
+	}
+	uploaders, err := identity.ParseList(para.Values["Uploaders"])
+	if err != nil {
+		return nil, fmt.Errorf("Uploaders: %s", err)
+	}
+	return append([]identity.Identity{*maintainer}, uploaders...), nil
+}
+
+// Parse the Changed-By field, as in a .changes file, into an Identity.
+func (para *Paragraph) GetChangedBy() (*identity.Identity, error) {
+	who, err := identity.Parse(para.Values["Changed-By"])
+	if err != nil {
+		return nil, fmt.Errorf("Changed-By: %s", err)
+	}
+	return who, nil
+}
+
 // Given a path on the filesystem, Parse the file off the disk and return
 // a pointer to a brand new Control struct, unless error is set to a value
 // other than nil.
@@ -26,6 +26,7 @@ import (
 	"testing"
 
 	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
 )
 
 /*
@@ -128,6 +129,33 @@ Description: XDG compliant autostarting app for Fluxbox
 	assert(t, len(arches) == 3)
 }
 
+func TestGetMaintainers(t *testing.T) {
+	para := control.Paragraph{Values: map[string]string{
+		"Maintainer": "Paul Tagliamonte <paultag@ubuntu.com>",
+		"Uploaders":  "\"Doe, John\" <jdoe@example.com>,\n Foo Bar <fnord@baz.fnord>",
+		"Changed-By": "Foo Bar <fnord@baz.fnord>",
+	}}
+	maintainers, err := para.GetMaintainers()
+	isok(t, err)
+	assert(t, len(maintainers) == 3)
+	assert(t, maintainers[0].Email == "paultag@ubuntu.com")
+	assert(t, maintainers[1].Name == "Doe, John")
+	assert(t, maintainers[2].Name == "Foo Bar")
+
+	changedBy, err := para.GetChangedBy()
+	isok(t, err)
+	assert(t, changedBy.Email == "fnord@baz.fnord")
+
+	para.Values["Uploaders"] = "Doe, John <jdoe@example.com>"
+	_, err = para.GetMaintainers()
+	notok(t, err)
+
+	delete(para.Values, "Uploaders")
+	maintainers, err = para.GetMaintainers()
+	isok(t, err)
+	assert(t, len(maintainers) == 1)
+}
+
 func TestConffilesControlParse(t *testing.T) {
 	// Test Control {{{
 	reader := bufio.NewReader(strings.NewReader(`Source: fbautostart
@@ -169,4 +197,122 @@ Description: XDG compliant autostarting app for Fluxbox
 	assert(t, c.Binaries[0].Conffiles[1].Hash == "db44b9cbb80456bc68c1225ee9e38fcb")
 }
 
+// {{{ test control with several binaries
+const testControl = `Source: hello
+Section: devel
+Priority: optional
+Maintainer: Jane Doe <jane@example.com>
+Build-Depends: debhelper-compat (= 13),
+               libfoo-dev <!nocheck>
+Standards-Version: 4.6.2
+Homepage: https://example.com/hello
+Vcs-Git: https://salsa.debian.org/debian/hello.git
+Rules-Requires-Root: no
+X-Python-Version: >= 3.9
+
+Package: hello
+Architecture: any
+Multi-Arch: foreign
+Depends: ${shlibs:Depends}, ${misc:Depends}
+Description: friendly greeter
+ Says hello.
+
+Package: hello-doc
+Architecture: all
+Build-Profiles: <!nodoc>
+Description: friendly greeter (documentation)
+ Says hello, in HTML.
+
+Package: hello-linux
+Architecture: linux-any
+Description: friendly greeter (Linux bits)
+ Says hello, on Linux.
+
+Package: hello-test
+Architecture: amd64 arm64
+Build-Profiles: <!nocheck !noinsttest> <pkg.hello.tests>
+Description: friendly greeter (tests)
+ Checks it says hello.
+`
+
+// }}}
+
+func TestControlBinariesFor(t *testing.T) {
+	c, err := control.ParseControl(bufio.NewReader(strings.NewReader(testControl)), "")
+	isok(t, err)
+	assert(t, c.Source.StandardsVersion == "4.6.2")
+	assert(t, c.Source.VcsGit == "https://salsa.debian.org/debian/hello.git")
+	assert(t, c.Source.RulesRequiresRoot == "no")
+	assert(t, len(c.Source.BuildDepends.Relations) == 2)
+	assert(t, c.Binaries[0].MultiArch == control.MultiArchForeign)
+
+	names := func(binaries []control.BinaryParagraph) string {
+		ret := []string{}
+		for _, binary := range binaries {
+			ret = append(ret, binary.Package)
+		}
+		return strings.Join(ret, " ")
+	}
+
+	archs, err := dependency.ParseArchitectures("amd64 armhf kfreebsd-amd64 all")
+	isok(t, err)
+	assert(t, names(c.BinariesFor(archs[0])) == "hello hello-linux hello-test")
+	assert(t, names(c.BinariesFor(archs[1])) == "hello hello-linux")
+	assert(t, names(c.BinariesFor(archs[2])) == "hello")
+	assert(t, names(c.BinariesFor(archs[3])) == "hello-doc")
+}
+
+func TestControlBuildProfiles(t *testing.T) {
+	c, err := control.ParseControl(bufio.NewReader(strings.NewReader(testControl)), "")
+	isok(t, err)
+
+	profiles, err := c.Binaries[0].GetBuildProfiles()
+	isok(t, err)
+	assert(t, len(profiles) == 0)
+	builds, err := c.Binaries[0].BuildsWith([]string{"nocheck"})
+	isok(t, err)
+	assert(t, builds)
+
+	builds, err = c.Binaries[1].BuildsWith([]string{"nodoc"})
+	isok(t, err)
+	assert(t, !builds)
+
+	profiles, err = c.Binaries[3].GetBuildProfiles()
+	isok(t, err)
+	assert(t, len(profiles) == 2)
+	assert(t, len(profiles[0].Stages) == 2)
+	builds, err = c.Binaries[3].BuildsWith([]string{"nocheck"})
+	isok(t, err)
+	assert(t, !builds)
+	builds, err = c.Binaries[3].BuildsWith([]string{"nocheck", "pkg.hello.tests"})
+	isok(t, err)
+	assert(t, builds)
+
+	c.Binaries[3].BuildProfiles = "<!nocheck"
+	_, err = c.Binaries[3].GetBuildProfiles()
+	notok(t, err)
+}
+
+func TestControlMarshal(t *testing.T) {
+	c, err := control.ParseControl(bufio.NewReader(strings.NewReader(testControl)), "")
+	isok(t, err)
+
+	out := strings.Builder{}
+	isok(t, c.Marshal(&out))
+	assert(t, out.String() == testControl)
+
+	c.Binaries[0].Essential = true
+	c.Source.StandardsVersion = "4.7.0"
+	out.Reset()
+	isok(t, c.Marshal(&out))
+	assert(t, strings.Contains(out.String(), "Standards-Version: 4.7.0\n"))
+	assert(t, strings.Contains(out.String(), "Essential: yes\n"))
+
+	again, err := control.ParseControl(bufio.NewReader(strings.NewReader(out.String())), "")
+	isok(t, err)
+	assert(t, len(again.Binaries) == 4)
+	assert(t, again.Binaries[0].Essential)
+	assert(t, again.Source.Values["X-Python-Version"] == ">= 3.9")
+}
+
 // vim: foldmethod=marker
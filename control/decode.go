@@ -24,10 +24,9 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
-
-	"golang.org/x/crypto/openpgp"
 )
 
 // Unmarshallable {{{
@@ -50,14 +49,28 @@ type Unmarshallable interface {
 // struct as needed. If a list of structs is given, unpack all RFC822
 // Paragraphs into the structs.
 //
+// The key may be followed by options in the tag, which say how to treat
+// continuation lines: `control:"Description,multiline"` keeps the value
+// exactly as read (less the leading space, and with " ." lines turned into
+// blank lines), and `control:"Uploaders,folded"` joins the lines back up
+// into one, since the line breaks aren't meaningful.
+//
 // This code will attempt to unpack it into the struct based on the
-// literal name of the key, compared byte-for-byte. If this is not
-// OK, the struct tag `control:""` can be used to define the key to use
-// in the RFC822 stream.
+// literal name of the key. If this is not OK, the struct tag `control:""`
+// can be used to define the key to use in the RFC822 stream. Other names
+// the field goes by can be given as aliases, as in
+// `control:"SHA256,alias=Sha256"`. A field is looked up by its key, then
+// by each alias; if none of those are in the Paragraph exactly as written,
+// they're looked up again ignoring case, since field names aren't case
+// sensitive (so "Md5sum" is found for a field named "MD5sum").
 //
 // If you're unpacking into a list of strings, you have the option of defining
 // a string to split tokens on (`delim:", "`), and things to strip off each
-// element (`strip:"\n\r\t "`).
+// element (`strip:"\n\r\t "`). Alternatively, a named delimiter can be
+// given in the control tag, as in `control:"Binary,delim=comma"`, which
+// trims whitespace off each element and skips empty ones ("comma",
+// "space" and "newline" are known). Each element of the list is unpacked
+// according to its type, so `[]version.Version` works as you'd hope.
 //
 // If you're unpacking into a struct, the struct will be walked according to
 // the rules above. If you wish to override how this writes to the nested
@@ -67,8 +80,12 @@ type Unmarshallable interface {
 // Structs that contain Paragraph as an Anonymous member will have that
 // member populated with the parsed RFC822 block, to allow access to the
 // .Values and .Order members.
+//
+// Any keys that don't have a home in the struct can be collected into a
+// map[string]string member tagged with `extra:"true"`. Unmarshaling into
+// a map[string]string (or a list of them) directly will get every key.
 func Unmarshal(data interface{}, reader io.Reader) error {
-	decoder, err := NewDecoder(reader, nil)
+	decoder, err := NewDecoder(reader)
 	if err != nil {
 		return err
 	}
@@ -85,12 +102,36 @@ type Decoder struct {
 
 // NewDecoder {{{
 
-func NewDecoder(reader io.Reader, keyring *openpgp.EntityList) (*Decoder, error) {
+func NewDecoder(reader io.Reader) (*Decoder, error) {
+	return NewDecoderWith(reader, DecoderOptions{})
+}
+
+// DecoderOptions are the knobs on a Decoder created with NewDecoderWith.
+type DecoderOptions struct {
+	// Reject oddities in the input (duplicate fields, stray whitespace,
+	// CRLF line endings and so on), rather than working around them and
+	// noting them in Diagnostics. See ParagraphReader.
+	Strict bool
+
+	// Where the input came from, such as its path or URL, to give as the
+	// Origin of each field. See ParagraphReader.SetSource.
+	Source string
+
+	// Note fields that aren't in the Schema, such as a misspelled
+	// "Depnds", in Diagnostics. See ParagraphReader.SetSchema.
+	Schema *Schema
+}
+
+// Create a new Decoder, as with NewDecoder, with the given options.
+func NewDecoderWith(reader io.Reader, opts DecoderOptions) (*Decoder, error) {
 	ret := Decoder{}
-	pr, err := NewParagraphReader(reader, keyring)
+	pr, err := NewParagraphReader(reader)
 	if err != nil {
 		return nil, err
 	}
+	pr.SetStrict(opts.Strict)
+	pr.SetSource(opts.Source)
+	pr.SetSchema(opts.Schema)
 	ret.paragraphReader = *pr
 	return &ret, nil
 }
@@ -111,12 +152,12 @@ func decode(p *ParagraphReader, into reflect.Value) error {
 	}
 
 	switch into.Elem().Type().Kind() {
-	case reflect.Struct:
+	case reflect.Struct, reflect.Map:
 		paragraph, err := p.Next()
 		if err != nil {
 			return err
 		}
-		return decodeStruct(*paragraph, into)
+		return decodeParagraph(*paragraph, into)
 	case reflect.Slice:
 		return decodeSlice(p, into)
 	default:
@@ -128,12 +169,239 @@ func decode(p *ParagraphReader, into reflect.Value) error {
 
 // }}}
 
+// Top-level paragraph dispatch {{{
+
+var stringMapType = reflect.TypeOf(map[string]string{})
+
+// Decode a Paragraph into either a struct, or a map[string]string, which
+// gets every field in the Paragraph.
+func decodeParagraph(p Paragraph, into reflect.Value) error {
+	if into.Type().Kind() == reflect.Ptr {
+		return decodeParagraph(p, into.Elem())
+	}
+	if into.Type().Kind() != reflect.Map {
+		return decodeStruct(p, into)
+	}
+	if into.Type() != stringMapType {
+		return fmt.Errorf("Can only Decode into a map[string]string")
+	}
+	into.Set(reflect.ValueOf(copyValues(p.Values, nil)))
+	return nil
+}
+
+// Copy every key/value in values, skipping anything in skip (which is
+// keyed by the lowercased field name).
+func copyValues(values map[string]string, skip map[string]bool) map[string]string {
+	ret := map[string]string{}
+	for key, value := range values {
+		if !skip[strings.ToLower(key)] {
+			ret[key] = value
+		}
+	}
+	return ret
+}
+
+// Return every Paragraph key that the struct type will consume.
+func knownKeys(structType reflect.Type, into map[string]bool) map[string]bool {
+	for i := 0; i < structType.NumField(); i++ {
+		fieldType := structType.Field(i)
+		if fieldType.Anonymous {
+			if fieldType.Type.Kind() == reflect.Struct {
+				knownKeys(fieldType.Type, into)
+			}
+			continue
+		}
+		paragraphKey, options := fieldKey(fieldType)
+		for _, key := range append([]string{paragraphKey}, options.aliases...) {
+			into[strings.ToLower(key)] = true
+		}
+	}
+	return into
+}
+
+// How the continuation lines of a field are to be treated, as set by the
+// options following the key in a `control:""` tag.
+type fieldOptions struct {
+	/* Whitespace and line breaks are significant, so the value is kept
+	 * exactly as read (as with Description). */
+	multiline bool
+	/* The value is one logical line, which may have been wrapped onto
+	 * continuation lines (as with Uploaders). */
+	folded bool
+	/* How to split the value up for a slice; see namedDelimiters. */
+	delim string
+	/* Other names the field may go by, such as `alias=Sha256`. */
+	aliases []string
+}
+
+// Delimiters that can be given by name, such as `control:"Binary,delim=comma"`.
+// The elements of a list split on one of these have any surrounding
+// whitespace trimmed, and empty elements are skipped.
+var namedDelimiters = map[string]struct {
+	split func(string) []string
+	join  string
+}{
+	"comma":   {func(in string) []string { return strings.Split(in, ",") }, ", "},
+	"space":   {strings.Fields, " "},
+	"newline": {func(in string) []string { return strings.Split(in, "\n") }, "\n"},
+}
+
+// Return the Paragraph key for a struct field, and any options given
+// after it, such as `control:"Uploaders,folded"`.
+func fieldKey(fieldType reflect.StructField) (string, fieldOptions) {
+	options := fieldOptions{}
+	tag := strings.Split(fieldType.Tag.Get("control"), ",")
+	for _, option := range tag[1:] {
+		switch strings.TrimSpace(option) {
+		case "multiline":
+			options.multiline = true
+		case "folded":
+			options.folded = true
+		default:
+			if strings.HasPrefix(option, "delim=") {
+				options.delim = strings.TrimPrefix(option, "delim=")
+			}
+			if strings.HasPrefix(option, "alias=") {
+				options.aliases = append(options.aliases, strings.TrimPrefix(option, "alias="))
+			}
+		}
+	}
+	if tag[0] == "" {
+		return fieldType.Name, options
+	}
+	return tag[0], options
+}
+
+// Split the value of a slice field into its elements, either by a named
+// delimiter in the `control:""` tag, or the `delim:""` and `strip:""` tags.
+func splitValue(fieldType reflect.StructField, value string) []string {
+	if _, options := fieldKey(fieldType); options.delim != "" {
+		if named, ok := namedDelimiters[options.delim]; ok {
+			ret := []string{}
+			for _, el := range named.split(value) {
+				if el = strings.TrimSpace(el); el != "" {
+					ret = append(ret, el)
+				}
+			}
+			return ret
+		}
+		return strings.Split(value, options.delim)
+	}
+
+	var delim = " "
+	if it := fieldType.Tag.Get("delim"); it != "" {
+		delim = it
+	}
+
+	var strip = ""
+	if it := fieldType.Tag.Get("strip"); it != "" {
+		strip = it
+	}
+
+	ret := []string{}
+	for _, el := range strings.Split(strings.Trim(value, strip), delim) {
+		ret = append(ret, strings.Trim(el, strip))
+	}
+	return ret
+}
+
+// Join the elements of a slice field back up, the inverse of splitValue.
+func joinValues(fieldType reflect.StructField, values []string) string {
+	delim := " "
+	if _, options := fieldKey(fieldType); options.delim != "" {
+		delim = options.delim
+		if named, ok := namedDelimiters[delim]; ok {
+			delim = named.join
+		}
+	} else if it := fieldType.Tag.Get("delim"); it != "" {
+		delim = it
+	}
+	return strings.Join(values, delim)
+}
+
+// Join the lines of a folded field back into one logical line.
+func unfold(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// }}}
+
+// Field lookup {{{
+
+// Finds the values of fields in a Paragraph, by name or by alias, falling
+// back to ignoring case.
+type fieldFinder struct {
+	p Paragraph
+
+	/* Lowercased key to the key as it is in the Paragraph; only built
+	 * the first time a field isn't found as written. */
+	lower map[string]string
+}
+
+// Return the value of the first of the names in the Paragraph.
+func (f *fieldFinder) find(names []string) (string, bool) {
+	key, ok := f.key(names)
+	if !ok {
+		return "", false
+	}
+	return f.p.Values[key], true
+}
+
+// Return the key in the Paragraph that the first of the names matches,
+// exactly if it can, or otherwise ignoring case.
+func (f *fieldFinder) key(names []string) (string, bool) {
+	for _, name := range names {
+		if _, ok := f.p.Values[name]; ok {
+			return name, true
+		}
+	}
+
+	if f.lower == nil {
+		keys := make([]string, 0, len(f.p.Values))
+		for key := range f.p.Values {
+			keys = append(keys, key)
+		}
+		/* So it's always the same key that wins, if there are two
+		 * differing only in case */
+		sort.Strings(keys)
+		f.lower = map[string]string{}
+		for _, key := range keys {
+			if _, ok := f.lower[strings.ToLower(key)]; !ok {
+				f.lower[strings.ToLower(key)] = key
+			}
+		}
+	}
+	for _, name := range names {
+		if key, ok := f.lower[strings.ToLower(name)]; ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// }}}
+
 // Top-level struct dispatch {{{
 
+// Return true if the field implements Unmarshallable.
+func unmarshallable(field reflect.Value) bool {
+	if !field.CanAddr() {
+		return false
+	}
+	_, ok := field.Addr().Interface().(Unmarshallable)
+	return ok
+}
+
 func decodeStruct(p Paragraph, into reflect.Value) error {
+	return decodeStructWith(&fieldFinder{p: p}, into)
+}
+
+func decodeStructWith(finder *fieldFinder, into reflect.Value) error {
+	p := finder.p
+
 	/* If we have a pointer, let's follow it */
 	if into.Type().Kind() == reflect.Ptr {
-		return decodeStruct(p, into.Elem())
+		return decodeStructWith(finder, into.Elem())
 	}
 
 	/* Store the Paragraph type for later use when checking Anonymous
@@ -146,8 +414,10 @@ func decodeStruct(p Paragraph, into reflect.Value) error {
 		field := into.Field(i)
 		fieldType := into.Type().Field(i)
 
-		if field.Type().Kind() == reflect.Struct {
-			err := decodeStruct(p, field)
+		/* Nested structs are filled in from the same Paragraph, unless
+		 * they know how to Unmarshal themselves from a single field. */
+		if field.Type().Kind() == reflect.Struct && !unmarshallable(field) {
+			err := decodeStructWith(finder, field)
 			if err != nil {
 				return err
 			}
@@ -155,16 +425,23 @@ func decodeStruct(p Paragraph, into reflect.Value) error {
 
 		/* First, let's get the name of the field as we'd index into the
 		 * map[string]string. */
-		paragraphKey := fieldType.Name
-		if it := fieldType.Tag.Get("control"); it != "" {
-			paragraphKey = it
-		}
+		paragraphKey, options := fieldKey(fieldType)
 
 		if paragraphKey == "-" {
 			/* If the key is "-", lets go ahead and skip it */
 			continue
 		}
 
+		if fieldType.Tag.Get("extra") == "true" {
+			/* This field gets everything that nothing else wanted */
+			if field.Type() != stringMapType {
+				return fmt.Errorf("Field '%s' tagged extra must be a map[string]string", fieldType.Name)
+			}
+			skip := knownKeys(into.Type(), map[string]bool{})
+			field.Set(reflect.ValueOf(copyValues(p.Values, skip)))
+			continue
+		}
+
 		/* Now, if we have an Anonymous field, we're either going to
 		 * set it to the Paragraph if it's the Paragraph Anonymous member,
 		 * or, more likely, continue through */
@@ -178,7 +455,10 @@ func decodeStruct(p Paragraph, into reflect.Value) error {
 			}
 		}
 
-		if value, ok := p.Values[paragraphKey]; ok {
+		if value, ok := finder.find(append([]string{paragraphKey}, options.aliases...)); ok {
+			if options.folded {
+				value = unfold(value)
+			}
 			if err := decodeStructValue(field, fieldType, value); err != nil {
 				return err
 			}
@@ -202,6 +482,14 @@ func decodeStruct(p Paragraph, into reflect.Value) error {
 // set a struct field value {{{
 
 func decodeStructValue(field reflect.Value, fieldType reflect.StructField, value string) error {
+	/* Anything that knows how to Unmarshal itself gets to, whatever
+	 * it's made of; a `type Name string` included. */
+	if field.Kind() != reflect.Struct && field.Kind() != reflect.Ptr && field.CanAddr() {
+		if unmarshal, ok := field.Addr().Interface().(Unmarshallable); ok {
+			return unmarshal.UnmarshalControl(value)
+		}
+	}
+
 	switch field.Type().Kind() {
 	case reflect.String:
 		field.SetString(value)
@@ -221,6 +509,13 @@ func decodeStructValue(field reflect.Value, fieldType reflect.StructField, value
 		return decodeStructValueSlice(field, fieldType, value)
 	case reflect.Struct:
 		return decodeStructValueStruct(field, fieldType, value)
+	case reflect.Ptr:
+		target := reflect.New(field.Type().Elem())
+		if err := decodeStructValue(target.Elem(), fieldType, value); err != nil {
+			return err
+		}
+		field.Set(target)
+		return nil
 	case reflect.Bool:
 		field.SetBool(value == "yes")
 		return nil
@@ -239,6 +534,15 @@ func decodeStructValueStruct(incoming reflect.Value, incomingField reflect.Struc
 	 * grab the method, or throw a shitfit. */
 	elem := incoming.Addr()
 
+	if incoming.Type() == timeType {
+		when, err := ParseDate(data)
+		if err != nil {
+			return err
+		}
+		incoming.Set(reflect.ValueOf(when))
+		return nil
+	}
+
 	if unmarshal, ok := elem.Interface().(Unmarshallable); ok {
 		return unmarshal.UnmarshalControl(data)
 	}
@@ -256,21 +560,7 @@ func decodeStructValueStruct(incoming reflect.Value, incomingField reflect.Struc
 func decodeStructValueSlice(field reflect.Value, fieldType reflect.StructField, value string) error {
 	underlyingType := field.Type().Elem()
 
-	var delim = " "
-	if it := fieldType.Tag.Get("delim"); it != "" {
-		delim = it
-	}
-
-	var strip = ""
-	if it := fieldType.Tag.Get("strip"); it != "" {
-		strip = it
-	}
-
-	value = strings.Trim(value, strip)
-
-	for _, el := range strings.Split(value, delim) {
-		el = strings.Trim(el, strip)
-
+	for _, el := range splitValue(fieldType, value) {
 		targetValue := reflect.New(underlyingType)
 		err := decodeStructValue(targetValue.Elem(), fieldType, el)
 		if err != nil {
@@ -300,7 +590,7 @@ func decodeSlice(p *ParagraphReader, into reflect.Value) error {
 			return err
 		}
 
-		if err := decodeStruct(*para, targetValue); err != nil {
+		if err := decodeParagraph(*para, targetValue); err != nil {
 			return err
 		}
 		into.Elem().Set(reflect.Append(into.Elem(), targetValue.Elem()))
@@ -313,10 +603,30 @@ func decodeSlice(p *ParagraphReader, into reflect.Value) error {
 
 // }}}
 
-// Signer {{{
+// Strict {{{
+
+// See ParagraphReader.SetStrict.
+func (d *Decoder) SetStrict(strict bool) {
+	d.paragraphReader.SetStrict(strict)
+}
+
+// Return every Diagnostic for the input decoded so far. See ParagraphReader.
+func (d *Decoder) Diagnostics() []Diagnostic {
+	return d.paragraphReader.Diagnostics()
+}
+
+// }}}
+
+// Signature {{{
+
+// See ParagraphReader.Signature.
+func (d *Decoder) Signature() []byte {
+	return d.paragraphReader.Signature()
+}
 
-func (d *Decoder) Signer() *openpgp.Entity {
-	return d.paragraphReader.Signer()
+// See ParagraphReader.SignedData.
+func (d *Decoder) SignedData() []byte {
+	return d.paragraphReader.SignedData()
 }
 
 // }}}
@@ -133,3 +133,91 @@ Extra-Source-Only: yes
 `)))
 	assert(t, foo.ExtraSourceOnly)
 }
+
+type packageName string
+
+func (p *packageName) UnmarshalControl(data string) error {
+	*p = packageName(strings.ToLower(data))
+	return nil
+}
+
+type typedSliceStruct struct {
+	Binaries []packageName            `control:"Binary,delim=comma"`
+	Versions []version.Version        `control:"Versions,delim=space"`
+	Latest   *version.Version         `control:"Latest"`
+	Sums     []control.SHA256FileHash `control:"Checksums-Sha256,delim=newline"`
+}
+
+func TestTypedSliceUnmarshal(t *testing.T) {
+	typed := typedSliceStruct{}
+	isok(t, control.Unmarshal(&typed, strings.NewReader(`Binary: Foo, bar,
+ baz,
+Versions: 1.0-1 1:2.0
+  3.0~rc1
+Latest: 3.0
+Checksums-Sha256:
+ 2c91c414f8c7a0556372c94301b8786801a05b29aafeceb2e308e037d47d5ddc 2170 hy_0.11.0-4.dsc
+ 27610d4e31645bc888c633881082270917aedd3443e36031a0030d3dae6f7380 7536 hy_0.11.0-4.debian.tar.xz
+`)))
+	assert(t, len(typed.Binaries) == 3)
+	assert(t, typed.Binaries[0] == "foo")
+	assert(t, typed.Binaries[2] == "baz")
+	assert(t, len(typed.Versions) == 3)
+	assert(t, typed.Versions[1].Epoch == 1)
+	assert(t, typed.Versions[2].Version == "3.0~rc1")
+	assert(t, typed.Latest != nil && typed.Latest.Version == "3.0")
+	assert(t, len(typed.Sums) == 2)
+	assert(t, typed.Sums[1].Size == 7536)
+
+	para, err := control.ConvertToParagraph(&typed)
+	isok(t, err)
+	assert(t, para.Values["Binary"] == "foo, bar, baz")
+	assert(t, para.Values["Versions"] == "1.0-1 1:2.0 3.0~rc1")
+
+	notok(t, control.Unmarshal(&typed, strings.NewReader("Versions: 1.0 not!a!version\n")))
+}
+
+type aliasStruct struct {
+	SHA256   string `control:"SHA256,alias=Sha256,alias=Checksum-Sha256"`
+	MD5sum   string
+	Filename string
+	Extra    map[string]string `extra:"true"`
+}
+
+func TestAliasUnmarshal(t *testing.T) {
+	entries := []aliasStruct{}
+	isok(t, control.Unmarshal(&entries, strings.NewReader(`Filename: a.deb
+SHA256: aaaa
+MD5sum: 1111
+
+filename: b.deb
+Sha256: bbbb
+MD5Sum: 2222
+X-Other: yes
+
+FILENAME: c.deb
+Checksum-SHA256: cccc
+`)))
+	assert(t, len(entries) == 3)
+	assert(t, entries[0].Filename == "a.deb")
+	assert(t, entries[0].SHA256 == "aaaa")
+	assert(t, entries[0].MD5sum == "1111")
+	assert(t, entries[1].Filename == "b.deb")
+	assert(t, entries[1].SHA256 == "bbbb")
+	assert(t, entries[1].MD5sum == "2222")
+	assert(t, len(entries[1].Extra) == 1 && entries[1].Extra["X-Other"] == "yes")
+	assert(t, entries[2].Filename == "c.deb")
+	assert(t, entries[2].SHA256 == "cccc")
+
+	/* The exact name wins over one that only matches ignoring case */
+	entry := aliasStruct{}
+	isok(t, control.Unmarshal(&entry, strings.NewReader("Sha256: alias\nSHA256: exact\n")))
+	assert(t, entry.SHA256 == "exact")
+
+	/* And it's written back out under its own name */
+	para, err := control.ConvertToParagraph(&entry)
+	isok(t, err)
+	assert(t, para.Values["SHA256"] == "exact")
+	_, ok := para.Values["Sha256"]
+	assert(t, !ok)
+}
@@ -0,0 +1,475 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"fmt"
+	"strings"
+
+	"pault.ag/go/debian/dependency"
+)
+
+// Relationship fields {{{
+
+// Fields holding package relationships, which are compared relation by
+// relation rather than as text.
+var relationshipFields = map[string]bool{
+	"Depends":               true,
+	"Pre-Depends":           true,
+	"Recommends":            true,
+	"Suggests":              true,
+	"Enhances":              true,
+	"Breaks":                true,
+	"Conflicts":             true,
+	"Replaces":              true,
+	"Provides":              true,
+	"Built-Using":           true,
+	"Static-Built-Using":    true,
+	"Build-Depends":         true,
+	"Build-Depends-Indep":   true,
+	"Build-Depends-Arch":    true,
+	"Build-Conflicts":       true,
+	"Build-Conflicts-Indep": true,
+	"Build-Conflicts-Arch":  true,
+}
+
+// The relations of a field, as written by dependency.Relation.String,
+// along with the key each is known by across versions of the field: the
+// names of its possibilities, without any version restrictions.
+type relations struct {
+	values []string
+	keys   []string
+}
+
+func parseRelations(value string) (*relations, error) {
+	ret := relations{}
+	if strings.TrimSpace(value) == "" {
+		return &ret, nil
+	}
+	dep, err := dependency.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, relation := range dep.Relations {
+		names := []string{}
+		for _, possi := range relation.Possibilities {
+			name := possi.Name
+			if possi.Arch != nil {
+				name += ":" + possi.Arch.String()
+			}
+			names = append(names, name)
+		}
+		ret.values = append(ret.values, relation.String())
+		ret.keys = append(ret.keys, strings.Join(names, " | "))
+	}
+	return &ret, nil
+}
+
+func (r relations) has(value string) bool {
+	for _, el := range r.values {
+		if el == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the relation with the given key, if exactly one has it.
+func (r relations) byKey(key string) (string, bool) {
+	found := ""
+	count := 0
+	for i, el := range r.keys {
+		if el == key {
+			found = r.values[i]
+			count++
+		}
+	}
+	return found, count == 1
+}
+
+func (r relations) String() string {
+	return strings.Join(r.values, ", ")
+}
+
+// }}}
+
+// Diff {{{
+
+// What happened to a field between two Paragraphs.
+type ChangeKind int
+
+const (
+	FieldAdded ChangeKind = iota
+	FieldRemoved
+	FieldChanged
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case FieldAdded:
+		return "added"
+	case FieldRemoved:
+		return "removed"
+	case FieldChanged:
+		return "changed"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// A RelationChange is a relation whose version restrictions (or
+// architecture or build profile restrictions) changed, such as
+// "libc6 (>= 2.34)" becoming "libc6 (>= 2.36)".
+type RelationChange struct {
+	Old string
+	New string
+}
+
+// RelationDiff is how the relations of a relationship field (such as
+// Depends) changed. Relations are written as by dependency.Relation.String,
+// so "foo | bar (>= 1.0)".
+type RelationDiff struct {
+	Added   []string
+	Removed []string
+	Changed []RelationChange
+}
+
+func (r RelationDiff) empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Changed) == 0
+}
+
+// Compare two versions of a relationship field. Relations that only moved
+// around aren't changes, and a relation is paired up as Changed when it's
+// the only one with those package names on either side.
+func diffRelations(old, new *relations) RelationDiff {
+	ret := RelationDiff{}
+	removed, added := relations{}, relations{}
+	for i, value := range old.values {
+		if !new.has(value) && !removed.has(value) {
+			removed.values = append(removed.values, value)
+			removed.keys = append(removed.keys, old.keys[i])
+		}
+	}
+	for i, value := range new.values {
+		if !old.has(value) && !added.has(value) {
+			added.values = append(added.values, value)
+			added.keys = append(added.keys, new.keys[i])
+		}
+	}
+
+	paired := map[string]bool{}
+	for i, value := range removed.values {
+		key := removed.keys[i]
+		if to, ok := added.byKey(key); ok {
+			if _, ok := removed.byKey(key); ok {
+				ret.Changed = append(ret.Changed, RelationChange{Old: value, New: to})
+				paired[key] = true
+				continue
+			}
+		}
+		ret.Removed = append(ret.Removed, value)
+	}
+	for i, value := range added.values {
+		if !paired[added.keys[i]] {
+			ret.Added = append(ret.Added, value)
+		}
+	}
+	return ret
+}
+
+// A FieldChange is one field that differs between two Paragraphs. Old is
+// empty for a FieldAdded, and New for a FieldRemoved.
+type FieldChange struct {
+	Field string
+	Kind  ChangeKind
+	Old   string
+	New   string
+
+	// For relationship fields (Depends, Build-Depends, Breaks and so on)
+	// that parse on both sides, which relations changed; nil otherwise.
+	Relations *RelationDiff
+}
+
+// A ParagraphDiff is every field that differs between two Paragraphs, in
+// the order they're found in the old Paragraph, followed by any new fields
+// in the order of the new one.
+type ParagraphDiff struct {
+	Changes []FieldChange
+}
+
+// Return true if the Paragraphs were the same.
+func (d ParagraphDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// Return the change to the named field, or nil if it didn't change.
+func (d ParagraphDiff) Field(name string) *FieldChange {
+	for i := range d.Changes {
+		if d.Changes[i].Field == name {
+			return &d.Changes[i]
+		}
+	}
+	return nil
+}
+
+// Write out the changes in something like unified diff format, a line
+// starting with "-" for each old field and "+" for each new one.
+func (d ParagraphDiff) String() string {
+	out := strings.Builder{}
+	for _, change := range d.Changes {
+		if change.Kind != FieldAdded {
+			out.WriteString("-" + formatField(change.Field, change.Old))
+		}
+		if change.Kind != FieldRemoved {
+			out.WriteString("+" + formatField(change.Field, change.New))
+		}
+	}
+	return out.String()
+}
+
+// Compare two versions of a field, returning nil if they're the same.
+// Relationship fields are the same if they have the same relations,
+// however they're formatted.
+func diffField(key, old, new string, oldOk, newOk bool) *FieldChange {
+	switch {
+	case !oldOk && !newOk:
+		return nil
+	case !oldOk:
+		return &FieldChange{Field: key, Kind: FieldAdded, New: new}
+	case !newOk:
+		return &FieldChange{Field: key, Kind: FieldRemoved, Old: old}
+	case old == new:
+		return nil
+	}
+
+	change := FieldChange{Field: key, Kind: FieldChanged, Old: old, New: new}
+	if relationshipFields[key] {
+		oldRelations, oldErr := parseRelations(old)
+		newRelations, newErr := parseRelations(new)
+		if oldErr == nil && newErr == nil {
+			relationDiff := diffRelations(oldRelations, newRelations)
+			if relationDiff.empty() {
+				return nil
+			}
+			change.Relations = &relationDiff
+		}
+	}
+	return &change
+}
+
+// Every key in any of the Paragraphs, in the order of the first Paragraph
+// it's found in.
+func unionOrder(paras ...Paragraph) []string {
+	ret := []string{}
+	seen := map[string]bool{}
+	for _, para := range paras {
+		for _, key := range para.Order {
+			if !seen[key] {
+				seen[key] = true
+				ret = append(ret, key)
+			}
+		}
+	}
+	return ret
+}
+
+// Compare two Paragraphs field by field, such as the same package in two
+// suites. For relationship fields, such as Depends, the relations that
+// were added, removed or had their version restrictions changed are
+// worked out too; merely folding or reordering the relations isn't a
+// change.
+func Diff(a, b Paragraph) ParagraphDiff {
+	ret := ParagraphDiff{Changes: []FieldChange{}}
+	for _, key := range unionOrder(a, b) {
+		old, oldOk := a.Values[key]
+		new, newOk := b.Values[key]
+		if change := diffField(key, old, new, oldOk, newOk); change != nil {
+			ret.Changes = append(ret.Changes, *change)
+		}
+	}
+	return ret
+}
+
+// }}}
+
+// Merge {{{
+
+// A MergeConflict is a field that was changed in different ways on both
+// sides of a Merge. Base, Ours and Theirs are empty where the field isn't
+// in that Paragraph.
+type MergeConflict struct {
+	Field  string
+	Base   string
+	Ours   string
+	Theirs string
+}
+
+func (c MergeConflict) Error() string {
+	return fmt.Sprintf("%s: changed to '%s' and to '%s'", c.Field, c.Ours, c.Theirs)
+}
+
+// Three-way merge relationship fields relation by relation, so both sides
+// adding a different relation to Depends isn't a conflict. Returns false
+// if the same relation was changed on both sides (or the fields don't
+// parse).
+func mergeRelations(base, ours, theirs string) (string, bool) {
+	baseRelations, err := parseRelations(base)
+	if err != nil {
+		return "", false
+	}
+	ourRelations, err := parseRelations(ours)
+	if err != nil {
+		return "", false
+	}
+	theirRelations, err := parseRelations(theirs)
+	if err != nil {
+		return "", false
+	}
+
+	ret := *ourRelations
+	replace := func(old, new string) {
+		for i, value := range ret.values {
+			if value == old {
+				ret.values[i] = new
+			}
+		}
+	}
+	remove := func(old string) {
+		merged := relations{}
+		for i, value := range ret.values {
+			if value != old {
+				merged.values = append(merged.values, value)
+				merged.keys = append(merged.keys, ret.keys[i])
+			}
+		}
+		ret = merged
+	}
+
+	ourDiff := diffRelations(baseRelations, ourRelations)
+	theirDiff := diffRelations(baseRelations, theirRelations)
+	ourChanges := map[string]string{}
+	for _, change := range ourDiff.Changed {
+		ourChanges[change.Old] = change.New
+	}
+
+	for _, change := range theirDiff.Changed {
+		switch to, changed := ourChanges[change.Old]; {
+		case changed && to != change.New, contains(ourDiff.Removed, change.Old):
+			return "", false
+		case !changed:
+			replace(change.Old, change.New)
+		}
+	}
+	for _, removed := range theirDiff.Removed {
+		if _, changed := ourChanges[removed]; changed {
+			return "", false
+		}
+		remove(removed)
+	}
+	for i, added := range theirRelations.values {
+		if !contains(theirDiff.Added, added) || ret.has(added) {
+			continue
+		}
+		if existing, ok := ret.byKey(theirRelations.keys[i]); ok && !baseRelations.has(existing) {
+			/* We added the same package with different restrictions */
+			return "", false
+		}
+		ret.values = append(ret.values, added)
+		ret.keys = append(ret.keys, theirRelations.keys[i])
+	}
+	return ret.String(), true
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, el := range haystack {
+		if el == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// Three-way merge two Paragraphs that were both changed from base, such as
+// a package's entry in an overrides file that was edited by two people.
+// Each field changed on only one side takes that side's value (a field
+// removed on one side, and left alone on the other, is removed), and a
+// field changed the same way on both sides is kept. Relationship fields
+// are merged relation by relation.
+//
+// Fields changed differently on both sides are returned as
+// MergeConflicts, and are left as they are in ours.
+func Merge(base, ours, theirs Paragraph) (Paragraph, []MergeConflict) {
+	ret := Paragraph{Order: []string{}, Values: map[string]string{}}
+	conflicts := []MergeConflict{}
+
+	take := func(side Paragraph, key string) {
+		value, ok := side.Values[key]
+		if !ok {
+			return
+		}
+		ret.Set(key, value)
+		if raw, found := side.raw[key]; found {
+			if ret.raw == nil {
+				ret.raw = map[string]rawField{}
+			}
+			ret.raw[key] = raw
+		}
+		if origin, found := side.origins[key]; found {
+			ret.SetOrigin(key, origin)
+		}
+	}
+
+	for _, key := range unionOrder(ours, theirs, base) {
+		baseValue, baseOk := base.Values[key]
+		ourValue, ourOk := ours.Values[key]
+		theirValue, theirOk := theirs.Values[key]
+
+		switch {
+		case diffField(key, ourValue, theirValue, ourOk, theirOk) == nil:
+			take(ours, key)
+			continue
+		case diffField(key, baseValue, ourValue, baseOk, ourOk) == nil:
+			take(theirs, key)
+			continue
+		case diffField(key, baseValue, theirValue, baseOk, theirOk) == nil:
+			take(ours, key)
+			continue
+		}
+
+		if relationshipFields[key] && ourOk && theirOk {
+			if merged, ok := mergeRelations(baseValue, ourValue, theirValue); ok {
+				ret.Set(key, merged)
+				continue
+			}
+		}
+		conflicts = append(conflicts, MergeConflict{
+			Field:  key,
+			Base:   baseValue,
+			Ours:   ourValue,
+			Theirs: theirValue,
+		})
+		take(ours, key)
+	}
+	return ret, conflicts
+}
+
+// }}}
+
+// vim: foldmethod=marker
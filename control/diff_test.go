@@ -0,0 +1,136 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+// {{{ diff fixtures
+var diffOld = `Package: hello
+Version: 2.10-2
+Architecture: amd64
+Depends: libc6 (>= 2.34),
+         libfoo1 | libfoo2
+Recommends: hello-doc
+Description: example package based on GNU hello
+`
+
+var diffNew = `Package: hello
+Version: 2.10-3
+Architecture: amd64
+Depends: libfoo1 | libfoo2, libc6 (>= 2.36), libbar0
+Multi-Arch: foreign
+Description: example package based on GNU hello
+`
+
+// }}}
+
+func TestDiff(t *testing.T) {
+	old := readParagraph(t, diffOld, "old")
+	new := readParagraph(t, diffNew, "new")
+
+	diff := control.Diff(old, new)
+	assert(t, len(diff.Changes) == 4)
+	assert(t, diff.Changes[0].Field == "Version" && diff.Changes[0].Kind == control.FieldChanged)
+	assert(t, diff.Changes[0].Relations == nil)
+	assert(t, diff.Changes[2].Field == "Recommends" && diff.Changes[2].Kind == control.FieldRemoved)
+	assert(t, diff.Changes[3].Field == "Multi-Arch" && diff.Changes[3].Kind == control.FieldAdded)
+	assert(t, diff.Field("Architecture") == nil)
+
+	depends := diff.Field("Depends")
+	assert(t, depends != nil && depends.Relations != nil)
+	assert(t, strings.Join(depends.Relations.Added, ", ") == "libbar0")
+	assert(t, len(depends.Relations.Removed) == 0)
+	assert(t, len(depends.Relations.Changed) == 1)
+	assert(t, depends.Relations.Changed[0].Old == "libc6 (>= 2.34)")
+	assert(t, depends.Relations.Changed[0].New == "libc6 (>= 2.36)")
+
+	assert(t, strings.HasPrefix(diff.String(), "-Version: 2.10-2\n+Version: 2.10-3\n-Depends:"))
+	assert(t, strings.HasSuffix(diff.String(), "-Recommends: hello-doc\n+Multi-Arch: foreign\n"))
+
+	assert(t, control.Diff(old, old).Empty())
+
+	/* Refolding and reordering relations isn't a change */
+	refolded := readParagraph(t, diffOld, "refolded")
+	refolded.Set("Depends", "libfoo1 | libfoo2, libc6 (>= 2.34)")
+	assert(t, control.Diff(old, refolded).Empty())
+}
+
+func TestMerge(t *testing.T) {
+	base := readParagraph(t, diffOld, "base")
+
+	ours := readParagraph(t, diffOld, "ours")
+	ours.Set("Version", "2.10-3")
+	ours.Set("Depends", "libc6 (>= 2.36), libfoo1 | libfoo2")
+	ours.Set("Section", "devel")
+
+	theirs := readParagraph(t, diffOld, "theirs")
+	theirs.Set("Version", "2.10-3")
+	theirs.Set("Depends", "libc6 (>= 2.34), libfoo1 | libfoo2, libbar0")
+	delete(theirs.Values, "Recommends")
+	theirs.Order = []string{"Package", "Version", "Architecture", "Depends", "Description"}
+	theirs.Set("Priority", "optional")
+
+	merged, conflicts := control.Merge(base, ours, theirs)
+	assert(t, len(conflicts) == 0)
+	assert(t, strings.Join(merged.Order, " ") == "Package Version Architecture Depends Description Section Priority")
+	assert(t, merged.Values["Version"] == "2.10-3")
+	assert(t, merged.Values["Depends"] == "libc6 (>= 2.36), libfoo1 | libfoo2, libbar0")
+	assert(t, merged.Values["Section"] == "devel")
+	assert(t, merged.Values["Priority"] == "optional")
+	origin, ok := merged.Origin("Priority")
+	assert(t, !ok)
+	origin, ok = merged.Origin("Description")
+	assert(t, ok && origin.Source == "ours")
+
+	/* Both sides bumping the same relation differently conflicts */
+	theirs.Set("Depends", "libc6 (>= 2.35), libfoo1 | libfoo2")
+	theirs.Set("Section", "utils")
+	merged, conflicts = control.Merge(base, ours, theirs)
+	assert(t, len(conflicts) == 2)
+	assert(t, conflicts[0].Field == "Depends")
+	assert(t, conflicts[0].Theirs == "libc6 (>= 2.35), libfoo1 | libfoo2")
+	assert(t, conflicts[1].Field == "Section" && conflicts[1].Base == "")
+	assert(t, conflicts[1].Error() == "Section: changed to 'devel' and to 'utils'")
+	assert(t, merged.Values["Depends"] == ours.Values["Depends"])
+	assert(t, merged.Values["Section"] == "devel")
+
+	/* Changing a relation one side removed conflicts too */
+	theirs.Set("Depends", "libfoo1 | libfoo2")
+	_, conflicts = control.Merge(base, ours, theirs)
+	assert(t, len(conflicts) == 2 && conflicts[0].Field == "Depends")
+
+	/* But not one the other side left alone */
+	theirs.Set("Depends", "libc6 (>= 2.34)")
+	merged, conflicts = control.Merge(base, ours, theirs)
+	assert(t, len(conflicts) == 1)
+	assert(t, merged.Values["Depends"] == "libc6 (>= 2.36)")
+}
+
+// vim: foldmethod=marker
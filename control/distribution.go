@@ -0,0 +1,155 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"fmt"
+	"strings"
+
+	"pault.ag/go/debian/dependency"
+)
+
+// DistributionMap {{{
+
+// A DistributionMap says how the distribution in a changelog entry (and so
+// the Distribution of the .changes built from it) maps onto a suite of the
+// archive being uploaded to. Each vendor has its own conventions: Debian
+// uploads to "unstable" land in sid, and Ubuntu uploads may target the
+// "devel" alias of whichever series is in development.
+type DistributionMap struct {
+	// The vendor the map is for, such as "Debian", for error messages.
+	Vendor string
+
+	// Changelog distribution to archive suite. A distribution with a
+	// pocket, such as "devel-proposed", is mapped by its series, so only
+	// "devel" needs listing. Distributions that aren't here are taken as
+	// they are.
+	Suites map[string]string
+
+	// Distributions that must never be uploaded, such as "UNRELEASED".
+	Reject []string
+}
+
+// The map for uploads to Debian.
+func DebianDistributionMap() DistributionMap {
+	return DistributionMap{
+		Vendor: "Debian",
+		Suites: map[string]string{
+			"unstable": "sid",
+		},
+		Reject: []string{"UNRELEASED"},
+	}
+}
+
+// The map for uploads to Ubuntu, given the series currently in
+// development (such as "noble"), which "devel" is an alias for.
+func UbuntuDistributionMap(devel string) DistributionMap {
+	return DistributionMap{
+		Vendor: "Ubuntu",
+		Suites: map[string]string{
+			"devel": devel,
+		},
+		Reject: []string{"UNRELEASED"},
+	}
+}
+
+// Map a changelog distribution, such as "unstable", onto the suite it
+// should be uploaded to, returning an error if it may not be uploaded
+// at all.
+func (m DistributionMap) Map(distribution string) (string, error) {
+	for _, reject := range m.Reject {
+		if distribution == reject {
+			return "", fmt.Errorf("%s: %s can't be uploaded", m.Vendor, distribution)
+		}
+	}
+	if suite, ok := m.Suites[distribution]; ok {
+		return suite, nil
+	}
+	if series, pocket, ok := strings.Cut(distribution, "-"); ok {
+		if suite, ok := m.Suites[series]; ok {
+			return suite + "-" + pocket, nil
+		}
+	}
+	return distribution, nil
+}
+
+// Rewrite the Distribution of a .changes, which may name more than one
+// (space separated), through the map. This is the last thing to do when
+// generating a .changes, before it's written out and signed.
+func (m DistributionMap) Apply(changes *Changes) error {
+	mapped := []string{}
+	for _, distribution := range strings.Fields(changes.Distribution) {
+		suite, err := m.Map(distribution)
+		if err != nil {
+			return err
+		}
+		mapped = append(mapped, suite)
+	}
+	if len(mapped) == 0 {
+		return fmt.Errorf("%s: .changes has no Distribution", m.Vendor)
+	}
+	changes.Distribution = strings.Join(mapped, " ")
+	if changes.Paragraph.Values != nil {
+		changes.Paragraph.Set("Distribution", changes.Distribution)
+	}
+	return nil
+}
+
+// Check that a .changes can be uploaded to the suite described by a
+// Release: that each (mapped) Distribution is that suite, by name or by
+// codename, and that every architecture it has binaries for is published
+// there.
+func (m DistributionMap) CheckTarget(changes *Changes, release *Release) error {
+	distributions := strings.Fields(changes.Distribution)
+	if len(distributions) == 0 {
+		return fmt.Errorf("%s: .changes has no Distribution", m.Vendor)
+	}
+	for _, distribution := range distributions {
+		suite, err := m.Map(distribution)
+		if err != nil {
+			return err
+		}
+		if suite != release.Suite && suite != release.Codename {
+			return fmt.Errorf(
+				"%s: %s targets %s, not %s (%s)",
+				m.Vendor, changes.Source, suite, release.Suite, release.Codename,
+			)
+		}
+	}
+
+	archs := []dependency.Arch{}
+	for _, arch := range changes.Architectures {
+		switch arch.String() {
+		case "source", "all":
+			/* Not something Release lists reliably */
+			continue
+		}
+		archs = append(archs, arch)
+	}
+	if _, err := release.SelectArchitectures(archs); err != nil {
+		return fmt.Errorf("%s: %s", m.Vendor, err)
+	}
+	return nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,103 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+func TestDistributionMap(t *testing.T) {
+	debian := control.DebianDistributionMap()
+	suite, err := debian.Map("unstable")
+	isok(t, err)
+	assert(t, suite == "sid")
+	suite, err = debian.Map("bookworm-backports")
+	isok(t, err)
+	assert(t, suite == "bookworm-backports")
+	_, err = debian.Map("UNRELEASED")
+	notok(t, err)
+
+	ubuntu := control.UbuntuDistributionMap("noble")
+	suite, err = ubuntu.Map("devel")
+	isok(t, err)
+	assert(t, suite == "noble")
+	suite, err = ubuntu.Map("devel-proposed")
+	isok(t, err)
+	assert(t, suite == "noble-proposed")
+}
+
+func parseDistributionChanges(t *testing.T, distribution, archs string) *control.Changes {
+	changes, err := control.ParseChanges(bufio.NewReader(strings.NewReader(`Format: 1.8
+Source: hello
+Binary: hello
+Architecture: `+archs+`
+Version: 2.10-3
+Distribution: `+distribution+`
+Maintainer: Santiago Vila <sanvila@debian.org>
+Changes:
+ hello (2.10-3) unstable; urgency=medium
+ .
+   * Rebuild.
+`)), "")
+	isok(t, err)
+	return changes
+}
+
+func TestDistributionMapApply(t *testing.T) {
+	changes := parseDistributionChanges(t, "unstable", "source amd64")
+	isok(t, control.DebianDistributionMap().Apply(changes))
+	assert(t, changes.Distribution == "sid")
+
+	out := strings.Builder{}
+	isok(t, control.Marshal(&out, changes))
+	assert(t, strings.Contains(out.String(), "Distribution: sid\n"))
+	assert(t, strings.Index(out.String(), "Distribution:") < strings.Index(out.String(), "Maintainer:"))
+
+	changes = parseDistributionChanges(t, "UNRELEASED", "source")
+	notok(t, control.DebianDistributionMap().Apply(changes))
+}
+
+func TestDistributionMapCheckTarget(t *testing.T) {
+	release, err := control.ParseRelease(bufio.NewReader(strings.NewReader(testRelease)))
+	isok(t, err)
+	debian := control.DebianDistributionMap()
+
+	isok(t, debian.CheckTarget(parseDistributionChanges(t, "bookworm", "source all amd64"), release))
+	isok(t, debian.CheckTarget(parseDistributionChanges(t, "stable", "source"), release))
+
+	err = debian.CheckTarget(parseDistributionChanges(t, "unstable", "source"), release)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "targets sid, not stable (bookworm)"))
+
+	err = debian.CheckTarget(parseDistributionChanges(t, "bookworm", "source riscv64"), release)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "riscv64 not published"))
+}
+
+// vim: foldmethod=marker
@@ -29,10 +29,9 @@ import (
 	"strings"
 
 	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/identity"
 	"pault.ag/go/debian/internal"
 	"pault.ag/go/debian/version"
-
-	"pault.ag/go/topsort"
 )
 
 // A DSC is the encapsulation of a Debian .dsc control file. This contains
@@ -49,12 +48,12 @@ type DSC struct {
 
 	Format           string
 	Source           string
-	Binaries         []string          `control:"Binary" delim:","`
+	Binaries         []string          `control:"Binary,folded" delim:","`
 	Architectures    []dependency.Arch `control:"Architecture"`
 	Version          version.Version
 	Origin           string
 	Maintainer       string
-	Uploaders        []string
+	Uploaders        identity.List `control:"Uploaders,folded"`
 	Homepage         string
 	StandardsVersion string `control:"Standards-Version"`
 
@@ -77,7 +76,9 @@ type DSC struct {
 // field.
 func OrderDSCForBuild(dscs []DSC, arch dependency.Arch) ([]DSC, error) {
 	sourceMapping := map[string]string{}
-	network := topsort.NewNetwork()
+	sources := map[string]DSC{}
+	order := []string{}
+	buildAfter := map[string][]string{}
 	ret := []DSC{}
 
 	/*
@@ -92,7 +93,10 @@ func OrderDSCForBuild(dscs []DSC, arch dependency.Arch) ([]DSC, error) {
 		for _, binary := range dsc.Binaries {
 			sourceMapping[binary] = dsc.Source
 		}
-		network.AddNode(dsc.Source, dsc)
+		if _, ok := sources[dsc.Source]; !ok {
+			order = append(order, dsc.Source)
+		}
+		sources[dsc.Source] = dsc
 	}
 
 	for _, dsc := range dscs {
@@ -102,21 +106,37 @@ func OrderDSCForBuild(dscs []DSC, arch dependency.Arch) ([]DSC, error) {
 		concreteBuildDepends = append(concreteBuildDepends, dsc.BuildDependsIndep.GetPossibilities(arch)...)
 		for _, relation := range concreteBuildDepends {
 			if val, ok := sourceMapping[relation.Name]; ok {
-				err := network.AddEdge(val, dsc.Source)
-				if err != nil {
-					return nil, err
-				}
+				buildAfter[dsc.Source] = append(buildAfter[dsc.Source], val)
 			}
 		}
 	}
 
-	nodes, err := network.Sort()
-	if err != nil {
-		return nil, err
-	}
-
-	for _, node := range nodes {
-		ret = append(ret, node.Value.(DSC))
+	/* Take every source whose build-dependencies have all been taken,
+	 * over and over, until there's nothing left. If a pass takes
+	 * nothing, what's left depends on itself. */
+	built := map[string]bool{}
+	for len(ret) < len(order) {
+		progress := false
+		for _, source := range order {
+			if built[source] {
+				continue
+			}
+			ready := true
+			for _, dep := range buildAfter[source] {
+				if !built[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				built[source] = true
+				ret = append(ret, sources[source])
+				progress = true
+			}
+		}
+		if !progress {
+			return nil, fmt.Errorf("Cycle detected :(")
+		}
 	}
 
 	return ret, nil
@@ -170,7 +190,11 @@ func (d *DSC) HasArchAll() bool {
 // well being. The 0th element is always the package's Maintainer,
 // with any Uploaders following.
 func (d *DSC) Maintainers() []string {
-	return append([]string{d.Maintainer}, d.Uploaders...)
+	ret := []string{d.Maintainer}
+	for _, uploader := range d.Uploaders {
+		ret = append(ret, uploader.String())
+	}
+	return ret
 }
 
 // Return a list of MD5FileHash entries from the `dsc.Files`
@@ -188,6 +212,28 @@ func (d *DSC) AbsFiles() []MD5FileHash {
 	return ret
 }
 
+// Return the files listed in the .dsc with their checksums of the given
+// algorithm ("md5", from Files, "sha1" or "sha256"), as Checksums. If there
+// are none, the list is empty.
+func (d *DSC) Checksums(algorithm string) Checksums {
+	ret := Checksums{Algorithm: algorithm, Files: []FileHash{}}
+	switch algorithm {
+	case "md5":
+		for _, hash := range d.Files {
+			ret.Add(hash.FileHash)
+		}
+	case "sha1":
+		for _, hash := range d.ChecksumsSha1 {
+			ret.Add(hash.FileHash)
+		}
+	case "sha256":
+		for _, hash := range d.ChecksumsSha256 {
+			ret.Add(hash.FileHash)
+		}
+	}
+	return ret
+}
+
 // Copy the .dsc file and all referenced files to the directory
 // listed by the dest argument. This function will error out if the dest
 // argument is not a directory, or if there is an IO operation in transfer.
@@ -203,4 +203,28 @@ Files:
 	assert(t, c.HasArchAll())
 }
 
+func TestDSCUploaders(t *testing.T) {
+	// Test DSC (folded Uploaders) {{{
+	reader := bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: fbautostart
+Binary: fbautostart
+Architecture: any
+Version: 2.718281828-1
+Maintainer: Paul Tagliamonte <paultag@ubuntu.com>
+Uploaders: "Doe, Jane" <jane@example.org>,
+ John Doe <john@example.com>
+Files:
+ 06495f9b23b1c9b1bf35c2346cb48f63 92748 fbautostart_2.718281828.orig.tar.gz
+`))
+	// }}}
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+	assert(t, len(c.Uploaders) == 2)
+	assert(t, c.Uploaders[0].Name == "Doe, Jane")
+	assert(t, c.Uploaders[1].Email == "john@example.com")
+	maintainers := c.Maintainers()
+	assert(t, len(maintainers) == 3)
+	assert(t, maintainers[2] == "John Doe <john@example.com>")
+}
+
 // vim: foldmethod=marker
@@ -24,8 +24,10 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Marshallable {{{
@@ -67,28 +69,44 @@ func convertToParagraph(data reflect.Value) (*Paragraph, error) {
 
 	paragraphType := reflect.TypeOf(Paragraph{})
 	var foundParagraph Paragraph = Paragraph{}
+	extra := map[string]string{}
+
+	for i := 0; i < data.NumField(); i++ {
+		if fieldType := data.Type().Field(i); fieldType.Anonymous && fieldType.Type == paragraphType {
+			foundParagraph = data.Field(i).Interface().(Paragraph)
+		}
+	}
+	/* Unmarshal may have matched a field by an alias, or with different
+	 * case, so look the key up the same way, and write the value back
+	 * under the key it was read from, rather than adding a second one. */
+	finder := &fieldFinder{p: foundParagraph}
 
 	for i := 0; i < data.NumField(); i++ {
 		field := data.Field(i)
 		fieldType := data.Type().Field(i)
 
 		if fieldType.Anonymous {
-			if fieldType.Type == paragraphType {
-				foundParagraph = field.Interface().(Paragraph)
-			}
 			continue
 		}
 
-		paragraphKey := fieldType.Name
-		if it := fieldType.Tag.Get("control"); it != "" {
-			paragraphKey = it
+		if fieldType.Tag.Get("extra") == "true" {
+			for key, value := range field.Interface().(map[string]string) {
+				extra[key] = value
+			}
+			continue
 		}
 
+		paragraphKey, options := fieldKey(fieldType)
+
 		if paragraphKey == "-" {
 			/* If the key is "-", lets go ahead and skip it */
 			continue
 		}
 
+		if key, ok := finder.key(append([]string{paragraphKey}, options.aliases...)); ok {
+			paragraphKey = key
+		}
+
 		data, err := marshalStructValue(field, fieldType)
 		if err != nil {
 			return nil, err
@@ -103,18 +121,96 @@ func convertToParagraph(data reflect.Value) (*Paragraph, error) {
 			data = "\n" + data
 		}
 
+		if options.folded {
+			data = fold(paragraphKey, data)
+		}
+
+		/* If the value we'd write only differs from what was read in by
+		 * whitespace (such as a Depends line that was folded), keep the
+		 * original, so it'll be written back out as it was found. That
+		 * doesn't go for multiline fields, where whitespace matters. */
+		if original, ok := foundParagraph.Values[paragraphKey]; ok && !options.multiline {
+			if unfold(original) == unfold(data) {
+				data = original
+			}
+		}
+
 		order = append(order, paragraphKey)
 		values[paragraphKey] = data
 	}
+
+	/* Fields that the struct didn't know about go last, in a stable order,
+	 * unless the Paragraph already knows where they belong. */
+	extraKeys := []string{}
+	for key := range extra {
+		extraKeys = append(extraKeys, key)
+	}
+	sort.Strings(extraKeys)
+	for _, key := range extraKeys {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		order = append(order, key)
+		values[key] = extra[key]
+	}
+
 	para := foundParagraph.Update(Paragraph{Order: order, Values: values})
 	return &para, nil
 }
 
+// Wrap the value of a folded field so the lines stay within 80 columns,
+// breaking after commas if it's a list, or between words otherwise.
+func fold(key, value string) string {
+	sep := " "
+	if strings.Contains(value, ", ") {
+		sep = ", "
+	}
+	tokens := strings.Split(unfold(value), sep)
+
+	lines := []string{}
+	line := ""
+	width := len(key) + 2
+	for i, token := range tokens {
+		if i != len(tokens)-1 {
+			token += strings.TrimSpace(sep)
+		}
+		if line != "" && width+len(line)+1+len(token) > 80 {
+			lines = append(lines, line)
+			line = ""
+			width = 1
+		}
+		if line == "" {
+			line = token
+		} else {
+			line += " " + token
+		}
+	}
+	return strings.Join(append(lines, line), "\n")
+}
+
+func convertMapToParagraph(data reflect.Value) *Paragraph {
+	para := Paragraph{Order: []string{}, Values: map[string]string{}}
+	for _, key := range data.MapKeys() {
+		para.Order = append(para.Order, key.String())
+	}
+	sort.Strings(para.Order)
+	for _, key := range para.Order {
+		para.Values[key] = data.MapIndex(reflect.ValueOf(key)).String()
+	}
+	return &para
+}
+
 // }}}
 
 // convert a struct value {{{
 
 func marshalStructValue(field reflect.Value, fieldType reflect.StructField) (string, error) {
+	if field.Kind() != reflect.Struct && field.Kind() != reflect.Ptr {
+		if marshal, ok := field.Interface().(Marshallable); ok {
+			return marshal.MarshalControl()
+		}
+	}
+
 	switch field.Type().Kind() {
 	case reflect.String:
 		return field.String(), nil
@@ -123,6 +219,9 @@ func marshalStructValue(field reflect.Value, fieldType reflect.StructField) (str
 	case reflect.Int:
 		return strconv.Itoa(int(field.Int())), nil
 	case reflect.Ptr:
+		if field.IsNil() {
+			return "", nil
+		}
 		return marshalStructValue(field.Elem(), fieldType)
 	case reflect.Slice:
 		return marshalStructValueSlice(field, fieldType)
@@ -144,6 +243,10 @@ func marshalStructValue(field reflect.Value, fieldType reflect.StructField) (str
 func marshalStructValueStruct(field reflect.Value, fieldType reflect.StructField) (string, error) {
 	/* Right, so, we've got a type we don't know what to do with. We should
 	 * grab the method, or throw a shitfit. */
+	if field.Type() == timeType {
+		return formatDate(field.Interface().(time.Time)), nil
+	}
+
 	if marshal, ok := field.Interface().(Marshallable); ok {
 		return marshal.MarshalControl()
 	}
@@ -159,10 +262,6 @@ func marshalStructValueStruct(field reflect.Value, fieldType reflect.StructField
 // convert a struct value of type slice {{{
 
 func marshalStructValueSlice(field reflect.Value, fieldType reflect.StructField) (string, error) {
-	var delim = " "
-	if it := fieldType.Tag.Get("delim"); it != "" {
-		delim = it
-	}
 	data := []string{}
 
 	for i := 0; i < field.Len(); i++ {
@@ -174,7 +273,7 @@ func marshalStructValueSlice(field reflect.Value, fieldType reflect.StructField)
 		}
 	}
 
-	return strings.Join(data, delim), nil
+	return joinValues(fieldType, data), nil
 }
 
 // }}}
@@ -194,7 +293,10 @@ func marshalStructValueSlice(field reflect.Value, fieldType reflect.StructField)
 // if) the target Struct contains a `control.Paragraph` anonymous member.
 //
 // This is handy if the Unmarshaler was given any `X-*` keys that were not
-// present on your Struct.
+// present on your Struct. Those keys are written in their original order,
+// and any field whose value is unchanged (give or take whitespace) will be
+// written exactly as it was read, folding and all. Keys in a map tagged
+// with `extra:"true"` are also written, after the rest of the struct.
 //
 // Given a struct (or list of structs), write to the io.Writer stream
 // in the RFC822-alike Debian control-file format
@@ -283,7 +385,7 @@ func (e *Encoder) encode(data reflect.Value) error {
 	switch data.Type().Kind() {
 	case reflect.Slice:
 		return e.encodeSlice(data)
-	case reflect.Struct:
+	case reflect.Struct, reflect.Map:
 		return e.encodeStruct(data)
 	}
 	return fmt.Errorf("Unknown type")
@@ -313,9 +415,17 @@ func (e *Encoder) encodeStruct(data reflect.Value) error {
 			return err
 		}
 	}
-	paragraph, err := convertToParagraph(data)
-	if err != nil {
-		return err
+	var paragraph *Paragraph
+	if data.Type().Kind() == reflect.Map {
+		if data.Type() != stringMapType {
+			return fmt.Errorf("Can only Encode a map[string]string")
+		}
+		paragraph = convertMapToParagraph(data)
+	} else {
+		var err error
+		if paragraph, err = convertToParagraph(data); err != nil {
+			return err
+		}
 	}
 	e.alreadyWritten = true
 	return paragraph.WriteTo(e.writer)
@@ -2,6 +2,7 @@ package control_test
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -136,4 +137,157 @@ func TestBoolMarshal(t *testing.T) {
 `)
 }
 
+type TestExtraMapStruct struct {
+	Foo   string
+	Extra map[string]string `extra:"true"`
+}
+
+func TestExtraMapMarshal(t *testing.T) {
+	el := TestExtraMapStruct{}
+	isok(t, control.Unmarshal(&el, strings.NewReader(`X-B: b
+Foo: test
+X-A: a
+`)))
+	assert(t, el.Foo == "test")
+	assert(t, len(el.Extra) == 2)
+	assert(t, el.Extra["X-A"] == "a")
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, el))
+	assert(t, writer.String() == `Foo: test
+X-A: a
+X-B: b
+`)
+}
+
+func TestMapMarshal(t *testing.T) {
+	els := []map[string]string{}
+	isok(t, control.Unmarshal(&els, strings.NewReader(`Foo: test
+Bar: baz
+
+Foo: second
+`)))
+	assert(t, len(els) == 2)
+	assert(t, els[0]["Bar"] == "baz")
+	assert(t, els[1]["Foo"] == "second")
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, els))
+	assert(t, writer.String() == `Bar: baz
+Foo: test
+
+Foo: second
+`)
+}
+
+// {{{ folded index paragraph
+var foldedParagraph = `Package: fonts-example
+Version: 1.0-1
+Architecture: all
+Maintainer: Example <example@example.com>
+Installed-Size: 120
+Depends: fontconfig,
+         libfoo1 (>= 1.0)
+X-Custom-Field:   keep   my spacing
+Description: Example fonts
+ Some fonts.
+ .
+ More details.
+Filename: pool/main/f/fonts-example/fonts-example_1.0-1_all.deb
+Size: 4242
+`
+
+// }}}
+
+func TestRoundTripMarshal(t *testing.T) {
+	index := control.BinaryIndex{}
+	isok(t, control.Unmarshal(&index, strings.NewReader(foldedParagraph)))
+	assert(t, len(index.GetDepends().Relations) == 2)
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, index))
+	assert(t, writer.String() == foldedParagraph)
+
+	/* Changed values get rewritten; everything else is left alone */
+	index.Version.Revision = "2"
+	index.Paragraph.Set("X-Custom-Field", "changed")
+	writer = bytes.Buffer{}
+	isok(t, control.Marshal(&writer, index))
+	assert(t, writer.String() == strings.Replace(strings.Replace(foldedParagraph,
+		"1.0-1\n", "1.0-2\n", 1),
+		"X-Custom-Field:   keep   my spacing", "X-Custom-Field: changed", 1))
+}
+
+type matchedKeyStruct struct {
+	control.Paragraph
+
+	Package string
+	MD5sum  string `control:"MD5sum"`
+	SHA256  string `control:"SHA256,alias=Checksum-Sha256"`
+}
+
+func TestRoundTripMatchedKeys(t *testing.T) {
+	/* Neither field is spelled the way the struct spells it */
+	input := "Package: foo\nMd5sum: abc\nChecksum-Sha256: 111\n"
+	entry := matchedKeyStruct{}
+	isok(t, control.Unmarshal(&entry, strings.NewReader(input)))
+	assert(t, entry.MD5sum == "abc")
+	assert(t, entry.SHA256 == "111")
+
+	entry.MD5sum = "def"
+	entry.SHA256 = "222"
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, entry))
+	assert(t, writer.String() == "Package: foo\nMd5sum: def\nChecksum-Sha256: 222\n")
+}
+
+type foldedStruct struct {
+	control.Paragraph
+
+	Package     string
+	Uploaders   []string `control:"Uploaders,folded" delim:", "`
+	Description string   `control:"Description,multiline"`
+}
+
+func TestFoldedMultilineMarshal(t *testing.T) {
+	input := `Package: foo
+Uploaders: Jane Doe <jane@example.com>,
+  John Doe <john@example.com>
+Description: a package
+   * indented
+ .
+ .
+ done
+`
+	para := foldedStruct{}
+	isok(t, control.Unmarshal(&para, strings.NewReader(input)))
+	assert(t, len(para.Uploaders) == 2)
+	assert(t, para.Uploaders[1] == "John Doe <john@example.com>")
+	assert(t, para.Description == "a package\n  * indented\n\n\ndone\n")
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, para))
+	assert(t, writer.String() == input)
+
+	/* Whitespace matters in a multiline field, so this is a real change */
+	para.Description = "a package\n * indented\n\n\ndone\n"
+	writer = bytes.Buffer{}
+	isok(t, control.Marshal(&writer, para))
+	assert(t, strings.HasSuffix(writer.String(), "Description: a package\n  * indented\n .\n .\n done\n"))
+
+	/* Long folded fields get wrapped */
+	fresh := foldedStruct{Package: "bar"}
+	for i := 0; i < 5; i++ {
+		fresh.Uploaders = append(fresh.Uploaders, fmt.Sprintf("Uploader Number%d <uploader%d@example.com>", i, i))
+	}
+	writer = bytes.Buffer{}
+	isok(t, control.Marshal(&writer, fresh))
+	for _, line := range strings.Split(writer.String(), "\n") {
+		assert(t, len(line) <= 80)
+	}
+	again := foldedStruct{}
+	isok(t, control.Unmarshal(&again, strings.NewReader(writer.String())))
+	assert(t, strings.Join(again.Uploaders, "|") == strings.Join(fresh.Uploaders, "|"))
+}
+
 // vim: foldmethod=marker
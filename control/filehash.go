@@ -22,18 +22,15 @@ package control // import "pault.ag/go/debian/control"
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
 	"hash"
 	"io"
-	"log"
 	"path/filepath"
 	"strconv"
 	"strings"
 
-	"pault.ag/go/debian/hashio"
+	"pault.ag/go/debian/internal/hashing"
 )
 
 // A FileHash is an entry as found in the Files, Checksum-Sha1, and
@@ -47,7 +44,7 @@ type FileHash struct {
 	ByHash    string
 }
 
-func FileHashFromHasher(path string, hasher hashio.Hasher) FileHash {
+func FileHashFromHasher(path string, hasher hashing.Hasher) FileHash {
 	return FileHash{
 		Algorithm: hasher.Name(),
 		Hash:      fmt.Sprintf("%x", hasher.Sum(nil)),
@@ -93,14 +90,9 @@ func (v *verifier) Close() error {
 //         return err
 //     }
 func (c *FileHash) Verifier() (io.WriteCloser, error) {
-	var h hash.Hash
-	switch c.Algorithm {
-	case "sha256":
-		h = sha256.New()
-	case "sha512":
-		h = sha512.New()
-	default:
-		log.Fatalf("BUG: FileHash.Verifier not updated after release.Indices()")
+	h, err := hashing.GetHash(c.Algorithm)
+	if err != nil {
+		return nil, err
 	}
 	sum, err := hex.DecodeString(c.Hash)
 	if err != nil {
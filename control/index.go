@@ -41,11 +41,11 @@ type BinaryIndex struct {
 	Package        string
 	Source         string
 	Version        version.Version
-	InstalledSize  int     `control:"Installed-Size"`
+	InstalledSize  int `control:"Installed-Size"`
 	Maintainer     string
 	Architecture   dependency.Arch
-	MultiArch      string `control:"Multi-Arch"`
-	Description    string
+	MultiArch      MultiArch `control:"Multi-Arch"`
+	Description    string    `control:"Description,multiline"`
 	Homepage       string
 	DescriptionMD5 string   `control:"Description-md5"`
 	Tags           []string `delim:", "`
@@ -70,6 +70,16 @@ func (index *BinaryIndex) GetDepends() dependency.Dependency {
 	return index.getOptionalDependencyField("Depends")
 }
 
+// Parse the Recommends relation on this package.
+func (index *BinaryIndex) GetRecommends() dependency.Dependency {
+	return index.getOptionalDependencyField("Recommends")
+}
+
+// Parse the Provides relation on this package.
+func (index *BinaryIndex) GetProvides() dependency.Dependency {
+	return index.getOptionalDependencyField("Provides")
+}
+
 // Parse the Depends Suggests relation on this package.
 func (index *BinaryIndex) GetSuggests() dependency.Dependency {
 	return index.getOptionalDependencyField("Suggests")
@@ -108,6 +118,19 @@ func (index *BinaryIndex) SourcePackage() string {
 	return strings.Split(index.Source, " ")[0]
 }
 
+// Return the version of the source package the binary was built from.
+// This is the binary's own Version, unless the Source field says otherwise
+// (as it will for a binNMU, such as "foo (1.0-1)").
+func (index *BinaryIndex) SourceVersion() version.Version {
+	if i := strings.Index(index.Source, "("); i >= 0 {
+		number := strings.TrimSuffix(strings.TrimSpace(index.Source[i+1:]), ")")
+		if ver, err := version.Parse(strings.TrimSpace(number)); err == nil {
+			return ver
+		}
+	}
+	return index.Version
+}
+
 // BestChecksums can be included in a struct instead of e.g. ChecksumsSha256.
 //
 // BestChecksums uses cryptographically secure checksums, so that application
@@ -152,11 +175,11 @@ type SourceIndex struct {
 	Paragraph
 
 	Package  string
-	Binaries []string `control:"Binary" delim:","`
+	Binaries []string `control:"Binary,folded" delim:","`
 
 	Version    version.Version
 	Maintainer string
-	Uploaders  string `delim:","`
+	Uploaders  string `control:"Uploaders,folded" delim:","`
 
 	Architecture []dependency.Arch
 
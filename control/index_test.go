@@ -263,4 +263,38 @@ Description-md5: d05e72aec9e53ee776fc0735e135889b
     assert(t, conflicts[0].Version.Operator == ">=")
 }
 
+// A Sources file of a thousand or so fairly typical packages.
+var benchSources = strings.Repeat(`Package: fbasics
+Binary: r-cran-fbasics
+Version: 3011.87-2
+Maintainer: Dirk Eddelbuettel <edd@debian.org>
+Build-Depends: debhelper (>= 7.0.0), r-base-dev (>= 3.2.0), cdbs, r-cran-mass, r-cran-timedate, r-cran-timeseries (>= 2100.84), r-cran-stabledist, xvfb, xauth, xfonts-base, r-cran-gss, libfoo-dev:native [linux-any] <!nocheck>
+Architecture: any
+Standards-Version: 3.9.6
+Format: 1.0
+Files:
+ 8bb6eda1e01be26c5446d21c64420e7f 1818 fbasics_3011.87-2.dsc
+ f9f6e7f84bff1ce90cdc5890b9a3f6b5 932125 fbasics_3011.87.orig.tar.gz
+Checksums-Sha256:
+ 0a4f8cc793903e366a84379a651bf1a4542d50823b4bd4e038efcdb85a1af95e 1818 fbasics_3011.87-2.dsc
+ f0a79bb3931cd145677c947d8cd87cf60869f604933e685e74225bb01ad992f4 932125 fbasics_3011.87.orig.tar.gz
+Directory: pool/main/f/fbasics
+Priority: source
+Section: gnu-r
+
+`, 1000)
+
+func BenchmarkParseSourceIndex(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sources, err := control.ParseSourceIndex(bufio.NewReader(strings.NewReader(benchSources)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, source := range sources {
+			source.GetBuildDepends()
+		}
+	}
+}
+
 // vim: foldmethod=marker
@@ -0,0 +1,105 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MultiArch {{{
+
+// The Multi-Arch field of a binary package, which says how it can be
+// installed alongside, or used by, packages of other architectures. See
+// https://wiki.debian.org/Multiarch/HOWTO for what each value means.
+//
+// A package without a Multi-Arch field has the zero value, which behaves
+// the same as MultiArchNo, but isn't written back out.
+type MultiArch string
+
+const (
+	MultiArchNo      MultiArch = "no"
+	MultiArchSame    MultiArch = "same"
+	MultiArchForeign MultiArch = "foreign"
+	MultiArchAllowed MultiArch = "allowed"
+)
+
+// Parse a Multi-Arch value, returning an error if it isn't one of "no",
+// "same", "foreign" or "allowed". An empty string is the zero MultiArch.
+func ParseMultiArch(value string) (MultiArch, error) {
+	value = strings.TrimSpace(value)
+	switch MultiArch(value) {
+	case "", MultiArchNo, MultiArchSame, MultiArchForeign, MultiArchAllowed:
+		return MultiArch(value), nil
+	}
+	return "", fmt.Errorf(
+		"Invalid Multi-Arch value '%s' (expected one of no, same, foreign or allowed)",
+		value,
+	)
+}
+
+func (m *MultiArch) UnmarshalControl(data string) error {
+	value, err := ParseMultiArch(data)
+	if err != nil {
+		return err
+	}
+	*m = value
+	return nil
+}
+
+func (m MultiArch) MarshalControl() (string, error) {
+	if _, err := ParseMultiArch(string(m)); err != nil {
+		return "", err
+	}
+	return string(m), nil
+}
+
+// Return the value as written in a control file, with "no" for the zero
+// value.
+func (m MultiArch) String() string {
+	if m == "" {
+		return string(MultiArchNo)
+	}
+	return string(m)
+}
+
+// Return true if more than one architecture of the package can be
+// installed at once ("same").
+func (m MultiArch) Coinstallable() bool {
+	return m == MultiArchSame
+}
+
+// Return true if the package can satisfy a dependency from a package of a
+// different architecture, with no ":any" qualifier needed ("foreign").
+func (m MultiArch) SatisfiesForeign() bool {
+	return m == MultiArchForeign
+}
+
+// Return true if the package can satisfy a "foo:any" dependency from a
+// package of any architecture ("allowed"). Packages that aren't "allowed"
+// can still satisfy "foo:any" when the architectures match.
+func (m MultiArch) SatisfiesAny() bool {
+	return m == MultiArchAllowed
+}
+
+// }}}
+
+// vim: foldmethod=marker
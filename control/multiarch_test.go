@@ -0,0 +1,75 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+func TestMultiArch(t *testing.T) {
+	index := []control.BinaryIndex{}
+	isok(t, control.Unmarshal(&index, strings.NewReader(`Package: libc6
+Version: 2.36-9
+Multi-Arch: same
+
+Package: make
+Version: 4.3-4.1
+Multi-Arch: foreign
+
+Package: python3
+Version: 3.11.2-1
+Multi-Arch: allowed
+
+Package: hello
+Version: 2.10-3
+`)))
+	assert(t, len(index) == 4)
+	assert(t, index[0].MultiArch == control.MultiArchSame)
+	assert(t, index[0].MultiArch.Coinstallable())
+	assert(t, index[1].MultiArch.SatisfiesForeign())
+	assert(t, index[2].MultiArch.SatisfiesAny())
+	assert(t, index[3].MultiArch == "")
+	assert(t, index[3].MultiArch.String() == "no")
+	assert(t, !index[3].MultiArch.Coinstallable())
+
+	/* Unset stays unset on the way back out */
+	out := bytes.Buffer{}
+	isok(t, control.Marshal(&out, index[3]))
+	assert(t, !strings.Contains(out.String(), "Multi-Arch"))
+
+	err := control.Unmarshal(&index, strings.NewReader("Package: foo\nMulti-Arch: Same\n"))
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "Invalid Multi-Arch value 'Same'"))
+
+	_, err = control.ParseMultiArch("sometimes")
+	notok(t, err)
+	notok(t, control.Marshal(&out, control.BinaryIndex{MultiArch: "sometimes"}))
+}
+
+// vim: foldmethod=marker
@@ -28,24 +28,45 @@ import (
 	"io/ioutil"
 	"strings"
 	"unicode"
-
-	"golang.org/x/crypto/openpgp"
-	"golang.org/x/crypto/openpgp/clearsign"
+	"unicode/utf8"
 )
 
 // A Paragraph is a block of RFC2822-like key value pairs. This struct contains
 // two methods to fetch values, a Map called Values, and a Slice called
 // Order, which maintains the ordering as defined in the RFC2822-like block
+//
+// When a Paragraph is read off a stream, the original text of any field that
+// wouldn't be written back out byte-for-byte (such as a Depends folded over
+// a few lines) is kept aside. As long as the value isn't changed, WriteTo
+// will emit the field exactly as it was read.
+//
+// A Paragraph can also keep track of where each of its fields came from (see
+// Origin), which is carried through Update, so that a Paragraph merged
+// together from a few different files can say which supplied each value.
 type Paragraph struct {
 	Values map[string]string
 	Order  []string
+
+	raw     map[string]rawField
+	origins map[string]Origin
+}
+
+// The exact text of a field as read, along with the value it parsed to, so
+// that we can tell if the value has been changed since.
+type rawField struct {
+	value string
+	text  string
 }
 
 // Paragraph Helpers {{{
 
 func (p *Paragraph) Set(key, value string) {
-	if _, found := p.Values[key]; found {
-		/* We've got the key */
+	if old, found := p.Values[key]; found {
+		/* We've got the key; if the value is new, wherever the old one
+		 * came from doesn't matter any more */
+		if old != value {
+			delete(p.origins, key)
+		}
 		p.Values[key] = value
 		return
 	}
@@ -59,18 +80,40 @@ func (p *Paragraph) WriteTo(out io.Writer) error {
 	for _, key := range p.Order {
 		value := p.Values[key]
 
-		value = strings.Replace(value, "\n", "\n ", -1)
-		value = strings.Replace(value, "\n \n", "\n .\n", -1)
+		field := formatField(key, value)
+		if raw, ok := p.raw[key]; ok && raw.value == value {
+			field = raw.text
+		}
 
-		if _, err := out.Write(
-			[]byte(fmt.Sprintf("%s: %s\n", key, value)),
-		); err != nil {
+		if _, err := out.Write([]byte(field)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Format a single field the way WriteTo would, folding any newlines in the
+// value onto continuation lines. A trailing newline (as ParagraphReader
+// leaves on every multi-line value) is dropped, so reading it back in gives
+// the same value.
+func formatField(key, value string) string {
+	if !strings.Contains(value, "\n") {
+		return key + ": " + value + "\n"
+	}
+	lines := strings.Split(strings.TrimSuffix(value, "\n"), "\n")
+	for i := 1; i < len(lines); i++ {
+		/* Blank lines are written as " ." so they don't end the paragraph */
+		if strings.TrimSpace(lines[i]) == "" {
+			lines[i] = "."
+		}
+		lines[i] = " " + lines[i]
+	}
+	if lines[0] == "" && len(lines) > 1 {
+		return fmt.Sprintf("%s:%s\n", key, strings.Join(lines, "\n"))
+	}
+	return fmt.Sprintf("%s: %s\n", key, strings.Join(lines, "\n"))
+}
+
 func (p *Paragraph) Update(other Paragraph) Paragraph {
 	ret := Paragraph{
 		Order:  []string{},
@@ -93,6 +136,27 @@ func (p *Paragraph) Update(other Paragraph) Paragraph {
 		ret.Values[el] = other.Values[el]
 	}
 
+	for _, raw := range []map[string]rawField{p.raw, other.raw} {
+		for key, field := range raw {
+			if ret.raw == nil {
+				ret.raw = map[string]rawField{}
+			}
+			ret.raw[key] = field
+		}
+	}
+
+	/* A value from other came from wherever other says it did; if other
+	 * doesn't know, but it's the same value p had, it's p's. */
+	for key := range ret.Values {
+		origin, ok := other.origins[key]
+		if _, overridden := other.Values[key]; !ok && (!overridden || other.Values[key] == p.Values[key]) {
+			origin, ok = p.origins[key]
+		}
+		if ok {
+			ret.SetOrigin(key, origin)
+		}
+	}
+
 	return ret
 }
 
@@ -102,39 +166,77 @@ func (p *Paragraph) Update(other Paragraph) Paragraph {
 
 // Wrapper to allow iteration on a set of Paragraphs without consuming them
 // all into memory at one time. This is also the level in which data is
-// signed, so information such as the entity that signed these documents
-// can be read by calling the `.Signer` method on this struct. The next
+// signed, so the signature over these documents, and the text it covers,
+// can be read by calling the `.Signature` and `.SignedData` methods on this
+// struct (the pgp package checks them against a keyring). The next
 // unread Paragraph can be returned by calling the `.Next` method on this
 // struct.
+//
+// Some oddities in the input (a UTF-8 byte order mark, CRLF line endings,
+// Latin-1 text, fields given more than once, whitespace before the colon,
+// and continuation lines with no field to continue) are worked around on
+// the way through, and noted as Diagnostics. In strict mode, the first one
+// is returned as an error from Next instead.
 type ParagraphReader struct {
 	reader *bufio.Reader
-	signer *openpgp.Entity
+
+	signedData []byte
+	signature  []byte
+
+	bom         bool
+	line        int
+	crlf        int
+	crlfLine    int
+	strict      bool
+	source      string
+	schema      *Schema
+	diagnostics []Diagnostic
+}
+
+// A Diagnostic notes something wrong with the encoding of a line of input
+// that the ParagraphReader had to fix up.
+type Diagnostic struct {
+	Line    int
+	Message string
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("line %d: %s", d.Line, d.Message)
 }
 
+// utf8BOM is the UTF-8 encoding of U+FEFF, which some editors put at the
+// start of a file.
+const utf8BOM = "\xef\xbb\xbf"
+
 // {{{ NewParagraphReader
 
-// Create a new ParagraphReader from the given `io.Reader`, and `keyring`.
-// if `keyring` is set to `nil`, this will result in all OpenPGP signature
-// checking being disabled. *including* that the contents match!
+// Create a new ParagraphReader from the given `io.Reader`. If the
+// Paragraphs are OpenPGP clearsigned, the signature is taken off and kept,
+// but *not* checked, *including* that the contents match! Use the pgp
+// package to check it against a keyring.
 //
-// Also keep in mind, `reader` may be consumed 100% in memory due to
-// the underlying OpenPGP API being hella fiddly.
-func NewParagraphReader(reader io.Reader, keyring *openpgp.EntityList) (*ParagraphReader, error) {
+// Also keep in mind, `reader` may be consumed 100% in memory if it's
+// clearsigned, since the signature comes after the text it covers.
+func NewParagraphReader(reader io.Reader) (*ParagraphReader, error) {
 	bufioReader := bufio.NewReader(reader)
 	ret := ParagraphReader{
 		reader: bufioReader,
-		signer: nil,
+	}
+
+	if bom, _ := bufioReader.Peek(len(utf8BOM)); string(bom) == utf8BOM {
+		bufioReader.Discard(len(utf8BOM))
+		ret.bom = true
 	}
 
 	// OK. We have a document. Now, let's peek ahead and see if we've got an
 	// OpenPGP Clearsigned set of Paragraphs. If we do, we're going to go ahead
 	// and do the decode dance.
-	line, _ := bufioReader.Peek(15)
-	if string(line) != "-----BEGIN PGP " {
+	// Blank lines before the armor header are skipped over, as gpg does.
+	if !hasArmorHeader(bufioReader) {
 		return &ret, nil
 	}
 
-	if err := ret.decodeClearsig(keyring); err != nil {
+	if err := ret.decodeClearsig(); err != nil {
 		return nil, err
 	}
 	return &ret, nil
@@ -142,11 +244,60 @@ func NewParagraphReader(reader io.Reader, keyring *openpgp.EntityList) (*Paragra
 
 // }}}
 
-// Signer {{{
+// Signature {{{
+
+// Return the (binary) OpenPGP signature the Paragraphs were clearsigned
+// with, or nil if they weren't. It hasn't been checked; see the pgp
+// package for that.
+func (p *ParagraphReader) Signature() []byte {
+	return p.signature
+}
+
+// Return the text covered by the clearsign signature, as it was signed
+// (that is, with CRLF line endings, and without the dash-escaping), or nil
+// if the Paragraphs weren't clearsigned.
+func (p *ParagraphReader) SignedData() []byte {
+	return p.signedData
+}
+
+// }}}
+
+// Strict {{{
+
+// If strict is set, any encoding anomaly in the input is returned from
+// Next as a Diagnostic, rather than being quietly fixed up.
+func (p *ParagraphReader) SetStrict(strict bool) {
+	p.strict = strict
+}
+
+// Return every Diagnostic for the input read so far. CRLF line endings
+// are noted once for each paragraph, with a count, when the paragraph
+// ends.
+func (p *ParagraphReader) Diagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
+// }}}
+
+// Source {{{
+
+// If source is set (say, to the path or URL being read), each field of
+// the Paragraphs read from here on is given an Origin of that source, and
+// the line the field started on.
+func (p *ParagraphReader) SetSource(source string) {
+	p.source = source
+}
+
+// }}}
+
+// Schema {{{
 
-// Return the Entity (if one exists) that signed this set of Paragraphs.
-func (p *ParagraphReader) Signer() *openpgp.Entity {
-	return p.signer
+// If schema is set, each field of the Paragraphs read from here on that
+// isn't in the Schema is noted as a Diagnostic (or, in strict mode,
+// returned as an error), suggesting the field it was probably meant to
+// be. See Schema.Check.
+func (p *ParagraphReader) SetSchema(schema *Schema) {
+	p.schema = schema
 }
 
 // }}}
@@ -178,6 +329,18 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 		Values: map[string]string{},
 	}
 	var lastKey string
+	raw := map[string]*strings.Builder{}
+
+	/* Continuation lines are gathered up here, and only joined on to the
+	 * value once the field is over, rather than copying the whole value
+	 * each line. */
+	continuation := strings.Builder{}
+	flush := func() {
+		if continuation.Len() > 0 {
+			paragraph.Values[lastKey] += continuation.String()
+			continuation.Reset()
+		}
+	}
 
 	for {
 		line, err := p.reader.ReadString('\n')
@@ -188,7 +351,10 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 		}
 		if err == io.EOF {
 			/* Let's return the parsed paragraph if we have it */
+			p.noteCRLF()
 			if len(paragraph.Order) > 0 {
+				flush()
+				paragraph.keepRaw(raw)
 				return &paragraph, nil
 			}
 			/* Else, let's go ahead and drop the EOF out raw */
@@ -197,13 +363,20 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 			return nil, err
 		}
 
-		if line == "\n" || line == "\r\n" {
+		if line, err = p.normalize(line); err != nil {
+			return nil, err
+		}
+
+		if line == "\n" {
 			if len(paragraph.Order) == 0 {
 				/* Skip over any number of blank lines between paragraphs. */
 				continue
 			}
 			/* Lines are ended by a blank line; so we're able to go ahead
 			 * and return this guy as-is. All set. Done. Finished. */
+			p.noteCRLF()
+			flush()
+			paragraph.keepRaw(raw)
 			return &paragraph, nil
 		}
 
@@ -229,6 +402,16 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 			 * right hand, because indentation under the whitespace is up to
 			 * the data format. Not us. */
 
+			if text, ok := raw[lastKey]; ok {
+				text.WriteString(line)
+			}
+
+			if lastKey == "" {
+				if err := p.diagnose("Continuation line with no field"); err != nil {
+					return nil, err
+				}
+			}
+
 			/* TrimFunc(line[1:], unicode.IsSpace) is identical to calling
 			 * TrimSpace. */
 			line = strings.TrimRightFunc(line[1:], unicode.IsSpace)
@@ -237,19 +420,18 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 				line = ""
 			}
 
-			if paragraph.Values[lastKey] == "" {
-				paragraph.Values[lastKey] = line + "\n"
-			} else {
-				if !strings.HasSuffix(paragraph.Values[lastKey], "\n") {
-					paragraph.Values[lastKey] = paragraph.Values[lastKey] + "\n"
-				}
-				paragraph.Values[lastKey] = paragraph.Values[lastKey] + line + "\n"
+			if continuation.Len() == 0 && paragraph.Values[lastKey] != "" {
+				/* The value on the key line is the first line */
+				continuation.WriteString("\n")
 			}
+			continuation.WriteString(line)
+			continuation.WriteString("\n")
 			continue
 		}
 
 		/* So, if we're here, we've got a key line. Let's go ahead and split
 		 * this on the first key, and set that guy */
+		flush()
 		els := strings.SplitN(line, ":", 2)
 		if len(els) != 2 {
 			return nil, fmt.Errorf("Bad line: '%s' has no ':'", line)
@@ -259,68 +441,168 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 		lastKey = strings.TrimSpace(els[0])
 		value := strings.TrimSpace(els[1])
 
-		paragraph.Order = append(paragraph.Order, lastKey)
+		if lastKey != els[0] {
+			if err := p.diagnose(fmt.Sprintf("Whitespace around field name '%s'", lastKey)); err != nil {
+				return nil, err
+			}
+		}
+
+		if p.schema != nil && !p.schema.Known(lastKey) {
+			if err := p.diagnose(p.schema.unknown(lastKey)); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, ok := paragraph.Values[lastKey]; ok {
+			/* The last one wins, but it stays where it was first seen */
+			if err := p.diagnose(fmt.Sprintf("Duplicate field '%s'", lastKey)); err != nil {
+				return nil, err
+			}
+		} else {
+			paragraph.Order = append(paragraph.Order, lastKey)
+		}
 		paragraph.Values[lastKey] = value
+		if p.source != "" {
+			paragraph.SetOrigin(lastKey, Origin{Source: p.source, Line: p.line})
+		}
+		raw[lastKey] = &strings.Builder{}
+		raw[lastKey].WriteString(line)
 	}
 }
 
-// }}}
+// Fix up the encoding of a line of input, noting anything we had to change
+// (or, in strict mode, refusing to).
+func (p *ParagraphReader) normalize(line string) (string, error) {
+	p.line++
+	found := []string{}
 
-// decodeClearsig {{{
+	if p.line == 1 && p.bom {
+		found = append(found, "UTF-8 byte order mark")
+	}
+	if strings.HasSuffix(line, "\r\n") {
+		line = strings.TrimSuffix(line, "\r\n") + "\n"
+		/* A file with CRLF endings has them on every line, so they're
+		 * noted once a paragraph, by noteCRLF, rather than each time */
+		if p.strict {
+			found = append(found, "CRLF line ending")
+		} else {
+			if p.crlf == 0 {
+				p.crlfLine = p.line
+			}
+			p.crlf++
+		}
+	}
+	if !utf8.ValidString(line) {
+		/* Latin-1 maps each byte straight onto the same code point;
+		 * only the bytes that aren't valid UTF-8 are read that way, so
+		 * any UTF-8 elsewhere in the line isn't mangled */
+		fixed := strings.Builder{}
+		for len(line) > 0 {
+			r, size := utf8.DecodeRuneInString(line)
+			if r == utf8.RuneError && size == 1 {
+				r = rune(line[0])
+			}
+			fixed.WriteRune(r)
+			line = line[size:]
+		}
+		line = fixed.String()
+		found = append(found, "invalid UTF-8, read as Latin-1")
+	}
 
-// Internal method to read an OpenPGP Clearsigned document, store related
-// OpenPGP information onto the shell Struct, and return any errors that
-// we encounter along the way, such as an invalid signature, unknown
-// signer, or incomplete document. If `keyring` is `nil`, checking of the
-// signed data is *not* preformed.
-func (p *ParagraphReader) decodeClearsig(keyring *openpgp.EntityList) error {
-	// One *massive* downside here is that the OpenPGP module in Go operates
-	// on byte arrays in memory, and *not* on Readers and Writers. This is a
-	// huge PITA because it doesn't need to be that way, and this forces
-	// clearsigned documents into memory. Which fucking sucks. But here
-	// we are. It's likely worth a bug or two on this.
-
-	signedData, err := ioutil.ReadAll(p.reader)
-	if err != nil {
-		return err
+	for _, message := range found {
+		if err := p.diagnose(message); err != nil {
+			return "", err
+		}
 	}
+	return line, nil
+}
 
-	block, _ := clearsign.Decode(signedData)
-	/* We're only interested in the first block. This may change in the
-	 * future, in which case, we should likely set reader back to
-	 * the remainder, and return that out to put through another
-	 * ParagraphReader, since it may have a different signer. */
+// Note the CRLF line endings seen since the last time, as one Diagnostic
+// on the first line that had one.
+func (p *ParagraphReader) noteCRLF() {
+	if p.crlf == 0 {
+		return
+	}
+	message := "CRLF line ending"
+	if p.crlf > 1 {
+		message = fmt.Sprintf("CRLF line endings on %d lines", p.crlf)
+	}
+	p.diagnostics = append(p.diagnostics, Diagnostic{Line: p.crlfLine, Message: message})
+	p.crlf, p.crlfLine = 0, 0
+}
 
-	if block == nil {
-		return fmt.Errorf("Invalid clearsigned input")
+// Note something odd about the current line. In strict mode, that's an
+// error, which is returned.
+func (p *ParagraphReader) diagnose(message string) error {
+	diagnostic := Diagnostic{Line: p.line, Message: message}
+	if p.strict {
+		return diagnostic
 	}
+	p.diagnostics = append(p.diagnostics, diagnostic)
+	return nil
+}
 
-	if keyring == nil {
-		/* As a special case, if the keyring is nil, we can go ahead
-		 * and assume this data isn't intended to be checked against the
-		 * keyring. So, we'll just pass on through. */
-		p.reader = bufio.NewReader(bytes.NewBuffer(block.Bytes))
-		return nil
+// Hang on to the original text of any field that formatField wouldn't
+// reproduce exactly.
+func (p *Paragraph) keepRaw(raw map[string]*strings.Builder) {
+	for key, text := range raw {
+		value := p.Values[key]
+		if text.String() == formatField(key, value) {
+			continue
+		}
+		if p.raw == nil {
+			p.raw = map[string]rawField{}
+		}
+		p.raw[key] = rawField{value: value, text: text.String()}
 	}
+}
 
-	/* Now, we have to go ahead and check that the signature is valid and
-	 * relates to an entity we have in our keyring */
-	signer, err := openpgp.CheckDetachedSignature(
-		keyring,
-		bytes.NewReader(block.Bytes),
-		block.ArmoredSignature.Body,
-	)
+// }}}
+
+// decodeClearsig {{{
 
+// Internal method to read an OpenPGP Clearsigned document, and store the
+// signature and the text it covers onto the shell Struct. The signature is
+// not checked here; that's up to the caller.
+func (p *ParagraphReader) decodeClearsig() error {
+	// The signature comes after the text, so the whole document has to be
+	// read into memory before any of it can be handed out.
+	data, err := ioutil.ReadAll(p.reader)
 	if err != nil {
 		return err
 	}
 
-	p.signer = signer
-	p.reader = bufio.NewReader(bytes.NewBuffer(block.Bytes))
+	/* We're only interested in the first block. This may change in the
+	 * future, in which case, we should likely set reader back to
+	 * the remainder, and return that out to put through another
+	 * ParagraphReader, since it may have a different signer. */
+	block, err := decodeClearsigned(data)
+	if err != nil {
+		return fmt.Errorf("Invalid clearsigned input: %v", err)
+	}
+	p.signedData = block.signedData
+	p.signature = block.signature
 
+	/* signedData is what was signed, which has CRLF line endings; the
+	 * plaintext is the same text with the LF line endings it was written
+	 * with. */
+	p.reader = bufio.NewReader(bytes.NewReader(block.plaintext))
 	return nil
 }
 
+// Return true if the next line of the reader that isn't blank is the start
+// of an OpenPGP armor block, such as "-----BEGIN PGP SIGNED MESSAGE-----".
+func hasArmorHeader(reader *bufio.Reader) bool {
+	const header = "-----BEGIN PGP "
+	for size := 64; ; size *= 2 {
+		data, err := reader.Peek(size)
+		rest := bytes.TrimLeft(data, "\r\n")
+		if len(rest) >= len(header) || err != nil {
+			return bytes.HasPrefix(rest, []byte(header))
+		}
+	}
+}
+
 // }}}
 
 // }}}
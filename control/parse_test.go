@@ -21,12 +21,12 @@
 package control_test
 
 import (
+	"bytes"
 	"io"
 	"log"
 	"strings"
 	"testing"
 
-	"golang.org/x/crypto/openpgp"
 	"pault.ag/go/debian/control"
 )
 
@@ -124,7 +124,7 @@ func TestBasicParagraphReader(t *testing.T) {
 Para: two
 
 Para: three
-`), nil)
+`))
 	// }}}
 	isok(t, err)
 
@@ -141,7 +141,7 @@ func TestMultipleNewlines(t *testing.T) {
 Para: two
 
 Para: three
-`), nil)
+`))
 	// }}}
 	isok(t, err)
 
@@ -182,7 +182,7 @@ func TestWhitespacePrefixedLines(t *testing.T) {
   continuation
 Key2: two
 	tabbed continuation
-`), nil)
+`))
 	// }}}
 	isok(t, err)
 
@@ -197,7 +197,7 @@ func TestCommentLines(t *testing.T) {
 	reader, err := control.NewParagraphReader(strings.NewReader(`Key1: one
 # comment
 Key2: two
-`), nil)
+`))
 	// }}}
 	isok(t, err)
 
@@ -209,7 +209,7 @@ Key2: two
 
 func TestTrailingTwoCharacterNewlines(t *testing.T) {
 	// Reader {{{
-	reader, err := control.NewDecoder(strings.NewReader("Key1: one\r\nKey2: two\r\n\r\n"), nil)
+	reader, err := control.NewDecoder(strings.NewReader("Key1: one\r\nKey2: two\r\n\r\n"))
 	// }}}
 	isok(t, err)
 
@@ -226,7 +226,7 @@ func TestTrailingTwoCharacterNewlines(t *testing.T) {
 }
 
 func TestOpenPGPParagraphReader(t *testing.T) {
-	reader, err := control.NewParagraphReader(strings.NewReader(signedParagraph), nil)
+	reader, err := control.NewParagraphReader(strings.NewReader(signedParagraph))
 	isok(t, err)
 
 	blocks, err := reader.All()
@@ -234,70 +234,41 @@ func TestOpenPGPParagraphReader(t *testing.T) {
 	assert(t, len(blocks) == 1)
 }
 
-func TestEmptyKeyringOpenPGPParagraphReader(t *testing.T) {
-	keyring := openpgp.EntityList{}
-
-	// Reader {{{
-	_, err := control.NewParagraphReader(strings.NewReader(`-----BEGIN PGP SIGNED MESSAGE-----
-Hash: SHA512
+func TestClearsignedParagraphReaderStrict(t *testing.T) {
+	/* Leading blank lines, and the CRLF line endings of the signed text,
+	 * shouldn't trip up strict mode */
+	reader, err := control.NewParagraphReader(strings.NewReader("\n\n" + signedParagraph))
+	isok(t, err)
+	reader.SetStrict(true)
 
-Format: 1.8
-Date: Mon, 16 Nov 2015 21:15:55 -0800
-Source: hy
-Binary: hy python-hy python3-hy
-Architecture: source
-Version: 0.11.0-4
-Distribution: unstable
-Urgency: medium
-Maintainer: Tianon Gravi <tianon@debian.org>
-Changed-By: Tianon Gravi <tianon@debian.org>
-Description:
- hy         - Lisp (s-expression) based frontend to Python (metapackage)
- python-hy  - Lisp (s-expression) based frontend to Python
- python3-hy - Lisp (s-expression) based frontend to Python 3
-Closes: 805204
-Changes:
- hy (0.11.0-4) unstable; urgency=medium
- .
-   * Fix FTBFS due to rply trying to write to HOME during sphinx-build.
-   * Fix build repeatability with proper override_dh_auto_clean.
-   * Fix FTBFS now that the tests actually run (Closes: #805204).
-   * Add "hyc" and "hy2py" as slaves to the "hy" alternative.
-   * Add alternatives to python-hy package also (to make testing easier).
-Checksums-Sha1:
- cbb00b96ba8ad4f27f8f6f6ceb626f0857c1d985 2170 hy_0.11.0-4.dsc
- 802ebce0dc09000a243cf809c922d5f0e1af90f0 7536 hy_0.11.0-4.debian.tar.xz
-Checksums-Sha256:
- 2c91c414f8c7a0556372c94301b8786801a05b29aafeceb2e308e037d47d5ddc 2170 hy_0.11.0-4.dsc
- 27610d4e31645bc888c633881082270917aedd3443e36031a0030d3dae6f7380 7536 hy_0.11.0-4.debian.tar.xz
-Files:
- 42d61a06f37db6f2d2fc6c35b2d4e683 2170 python optional hy_0.11.0-4.dsc
- aa8bfae41ef33a85e0f08f21e0a5e67b 7536 python optional hy_0.11.0-4.debian.tar.xz
+	blocks, err := reader.All()
+	isok(t, err)
+	assert(t, len(blocks) == 1)
+	assert(t, blocks[0].Values["Source"] == "hy")
+	assert(t, len(reader.Diagnostics()) == 0)
+	assert(t, len(reader.Signature()) > 0)
+	assert(t, bytes.HasPrefix(reader.SignedData(), []byte("Format: 1.8\r\n")))
+}
 
------BEGIN PGP SIGNATURE-----
-Version: GnuPG v1
+func TestClearsignedArmorChecksum(t *testing.T) {
+	_, err := control.NewParagraphReader(strings.NewReader(
+		strings.Replace(signedParagraph, "=dtCZ", "=dtCA", 1)))
+	notok(t, err)
 
-iQIcBAEBCgAGBQJWSrgkAAoJEANqnCW/NX3UEjQP/ikiMZWvhco6jz9ObT/Q1FbK
-fjoaZbOBLAoP/kBD4m9s/GiBNb0mHAtn3186uh5ZbXw7NEz9hfQeNAL2qHOqYsT3
-7Ha31kwjV9ZfSLbu6giCImoBPBV6kqn904QVjHiSJ/d08PdEgDPcOrDYUBPYH+O0
-BmHDlWb9mBRIMIjXl6HtZIMvJ1adU613h3T6C4VMExV1YRGaD4UlUxUkfdKMZ0kx
-GUNsyARKxXbMMr9uqnmDp3K85U6BynOiZ8aLnzWjVKDpXPQOK/3n4sfN6iNJF+9K
-nl26axBfgoj/kvNLXGOR+rpGz0IBE7QpecVh7eFUb87i4En+lZi9pl0+hC/2n+Xy
-vShNXphZZQ444P5CMX5s8OK0IbWl1wVe0OCjcQhW9juOIGdn3bxWJ68HaIbw5Y+V
-TZcmHxjJJbO+D+ng3OHqCg1tooy1dAeMZlRwsgYyDtx0Rhd7gZKzx5NkuWlBOdSH
-P+FikrKFHW6rvvO0esWqgm7GuBDrMrsPgU9T4UZ1sOOwsBdWTgp9QWceFIrrptX0
-C/hiBXZkJP/cXueZQ38GDny6ahuR5HDmNwHhvV/EuZ28GOdKzCxcOCyhoNI2xgOg
-A8Ija2WnFdScMVRuMxDxK8yMdy1/BtZQKV6uzSt7ebHfPcUopBM4yARM8C90EbJD
-/FevdZ9cGw/0bCyun86t
-=dtCZ
------END PGP SIGNATURE-----
-`), &keyring)
-	// }}}
+	_, err = control.NewParagraphReader(strings.NewReader(
+		strings.Replace(signedParagraph, "-----END PGP SIGNATURE-----", "", 1)))
 	notok(t, err)
 }
 
+func TestUnsignedParagraphReaderSignature(t *testing.T) {
+	reader, err := control.NewParagraphReader(strings.NewReader("Source: hello\n"))
+	isok(t, err)
+	assert(t, reader.Signature() == nil)
+	assert(t, reader.SignedData() == nil)
+}
+
 func TestLineWrapping(t *testing.T) {
-	reader, err := control.NewParagraphReader(strings.NewReader(signedParagraph), nil)
+	reader, err := control.NewParagraphReader(strings.NewReader(signedParagraph))
 	isok(t, err)
 
 	el, err := reader.Next()
@@ -313,4 +284,73 @@ func TestLineWrapping(t *testing.T) {
 `)
 }
 
+func TestEncodingAnomalies(t *testing.T) {
+	input := "\xef\xbb\xbfSource: hello\r\nMaintainer: Ren\xe9 Example <rene@example.com>\r\nDescription: hi\r\n there\r\n\r\nSource: bye\n"
+
+	reader, err := control.NewParagraphReader(strings.NewReader(input))
+	isok(t, err)
+	paragraphs, err := reader.All()
+	isok(t, err)
+	assert(t, len(paragraphs) == 2)
+	assert(t, paragraphs[0].Values["Source"] == "hello")
+	assert(t, paragraphs[0].Values["Maintainer"] == "Ren\u00e9 Example <rene@example.com>")
+	assert(t, paragraphs[0].Values["Description"] == "hi\nthere\n")
+	assert(t, paragraphs[1].Values["Source"] == "bye")
+
+	diagnostics := reader.Diagnostics()
+	assert(t, len(diagnostics) == 3)
+	assert(t, diagnostics[0].Line == 1 && diagnostics[0].Message == "UTF-8 byte order mark")
+	assert(t, diagnostics[1].Line == 2 && diagnostics[1].Message == "invalid UTF-8, read as Latin-1")
+	/* One for all the CRLFs of the first paragraph, not one a line */
+	assert(t, diagnostics[2].Line == 1 && diagnostics[2].Message == "CRLF line endings on 5 lines")
+
+	reader, err = control.NewParagraphReader(strings.NewReader(input))
+	isok(t, err)
+	reader.SetStrict(true)
+	_, err = reader.Next()
+	notok(t, err)
+	diagnostic, ok := err.(control.Diagnostic)
+	assert(t, ok && diagnostic.Line == 1)
+
+	reader, err = control.NewParagraphReader(strings.NewReader("Source: hello\n"))
+	isok(t, err)
+	reader.SetStrict(true)
+	_, err = reader.Next()
+	isok(t, err)
+}
+
+func TestMixedEncodingLine(t *testing.T) {
+	/* A stray Latin-1 byte shouldn't mangle the UTF-8 in the same line */
+	input := "Maintainer: Ren\xe9 \u00c5str\u00f6m \u2014 Jos\xe9 <team@example.com>\n"
+
+	reader, err := control.NewParagraphReader(strings.NewReader(input))
+	isok(t, err)
+	paragraph, err := reader.Next()
+	isok(t, err)
+	assert(t, paragraph.Values["Maintainer"] == "Ren\u00e9 \u00c5str\u00f6m \u2014 Jos\u00e9 <team@example.com>")
+	assert(t, len(reader.Diagnostics()) == 1)
+}
+
+func TestLenientDecoder(t *testing.T) {
+	input := "Source: hello\nVersion : 1.0\nSource: hello2\n\n continued\nSource: bye\n"
+
+	decoder, err := control.NewDecoderWith(strings.NewReader(input), control.DecoderOptions{})
+	isok(t, err)
+	paragraphs := []map[string]string{}
+	isok(t, decoder.Decode(&paragraphs))
+	assert(t, len(paragraphs) == 2)
+	assert(t, paragraphs[0]["Source"] == "hello2")
+	assert(t, paragraphs[0]["Version"] == "1.0")
+
+	diagnostics := decoder.Diagnostics()
+	assert(t, len(diagnostics) == 3)
+	assert(t, diagnostics[0].Line == 2)
+	assert(t, diagnostics[1].Message == "Duplicate field 'Source'")
+	assert(t, diagnostics[2].Message == "Continuation line with no field")
+
+	decoder, err = control.NewDecoderWith(strings.NewReader(input), control.DecoderOptions{Strict: true})
+	isok(t, err)
+	notok(t, decoder.Decode(&paragraphs))
+}
+
 // vim: foldmethod=marker
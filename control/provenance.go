@@ -0,0 +1,98 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"fmt"
+)
+
+// Origin {{{
+
+// An Origin is where the value of a field came from: the file (or URL, or
+// anything else that makes sense to whoever put the Paragraph together) it
+// was read out of, and on which line.
+type Origin struct {
+	// Such as "dists/sid/main/binary-amd64/Packages.xz",
+	// "i18n/Translation-en", or "override.sid.main".
+	Source string
+
+	// The line the field started on, counting from 1, or 0 if that's not
+	// known (or doesn't make sense).
+	Line int
+}
+
+func (o Origin) String() string {
+	if o.Line == 0 {
+		return o.Source
+	}
+	return fmt.Sprintf("%s:%d", o.Source, o.Line)
+}
+
+// }}}
+
+// Paragraph Provenance {{{
+
+// Return where the value of a field came from, if that's known.
+func (p Paragraph) Origin(key string) (Origin, bool) {
+	origin, ok := p.origins[key]
+	return origin, ok
+}
+
+// Record where the value of a field came from. Changing the value with Set
+// forgets it again.
+func (p *Paragraph) SetOrigin(key string, origin Origin) {
+	if p.origins == nil {
+		p.origins = map[string]Origin{}
+	}
+	p.origins[key] = origin
+}
+
+// Set the value of a field, recording where it came from.
+func (p *Paragraph) SetFrom(key, value string, origin Origin) {
+	p.Set(key, value)
+	p.SetOrigin(key, origin)
+}
+
+// Record that every field with no Origin yet came from source, such as
+// for a Paragraph built up in code, or read without
+// ParagraphReader.SetSource.
+func (p *Paragraph) SetSource(source string) {
+	for _, key := range p.Order {
+		if _, ok := p.origins[key]; !ok {
+			p.SetOrigin(key, Origin{Source: source})
+		}
+	}
+}
+
+// Return the Origin of every field where it's known, keyed by field name.
+func (p Paragraph) Provenance() map[string]Origin {
+	ret := map[string]Origin{}
+	for _, key := range p.Order {
+		if origin, ok := p.origins[key]; ok {
+			ret[key] = origin
+		}
+	}
+	return ret
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,128 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+// {{{ provenance fixtures
+var provenancePackages = `Package: hello
+Version: 2.10-3
+Architecture: amd64
+Section: devel
+Priority: optional
+Description: example package based on GNU hello
+Description-md5: 9ac6b1ea8c4c4ab8c5a6b0bd5c4e5ab7
+`
+
+var provenanceTranslation = `Package: hello
+Description-md5: 9ac6b1ea8c4c4ab8c5a6b0bd5c4e5ab7
+Description-en: example package based on GNU hello
+ The GNU hello program produces a familiar, friendly greeting.
+`
+
+// }}}
+
+func readParagraph(t *testing.T, data, source string) control.Paragraph {
+	reader, err := control.NewParagraphReader(strings.NewReader(data))
+	isok(t, err)
+	reader.SetSource(source)
+	para, err := reader.Next()
+	isok(t, err)
+	return *para
+}
+
+func TestProvenance(t *testing.T) {
+	packages := readParagraph(t, provenancePackages, "Packages")
+	origin, ok := packages.Origin("Section")
+	assert(t, ok)
+	assert(t, origin.String() == "Packages:4")
+
+	translation := readParagraph(t, provenanceTranslation, "Translation-en")
+	override := control.Paragraph{Values: map[string]string{}}
+	override.SetFrom("Section", "utils", control.Origin{Source: "override.sid.main"})
+	override.Set("Priority", "optional")
+
+	merged := packages.Update(translation)
+	merged = merged.Update(override)
+
+	provenance := merged.Provenance()
+	assert(t, len(provenance) == 8)
+	assert(t, provenance["Package"].String() == "Translation-en:1")
+	assert(t, provenance["Version"].String() == "Packages:2")
+	assert(t, provenance["Description-en"].String() == "Translation-en:3")
+	assert(t, provenance["Section"].String() == "override.sid.main")
+	/* The override didn't say where Priority came from, but didn't change
+	 * it either */
+	assert(t, provenance["Priority"].String() == "Packages:5")
+
+	/* Changing a value forgets where it came from */
+	merged.Set("Version", "2.10-4")
+	_, ok = merged.Origin("Version")
+	assert(t, !ok)
+	merged.Set("Architecture", "amd64")
+	_, ok = merged.Origin("Architecture")
+	assert(t, ok)
+
+	merged.SetSource("local")
+	origin, ok = merged.Origin("Version")
+	assert(t, ok && origin.String() == "local")
+	origin, _ = merged.Origin("Section")
+	assert(t, origin.Source == "override.sid.main")
+
+	/* Values the override changed without saying where from are unknown */
+	other := control.Paragraph{Values: map[string]string{}}
+	other.Set("Priority", "extra")
+	merged = packages.Update(other)
+	_, ok = merged.Origin("Priority")
+	assert(t, !ok)
+}
+
+func TestDecodeProvenance(t *testing.T) {
+	decoder, err := control.NewDecoderWith(strings.NewReader(provenancePackages), control.DecoderOptions{
+		Source: "dists/sid/main/binary-amd64/Packages",
+	})
+	isok(t, err)
+	index := control.BinaryIndex{}
+	isok(t, decoder.Decode(&index))
+
+	origin, ok := index.Origin("Architecture")
+	assert(t, ok && origin.String() == "dists/sid/main/binary-amd64/Packages:3")
+
+	/* Going back to a Paragraph keeps track of anything not changed */
+	index.Version.Revision = "4"
+	para, err := control.ConvertToParagraph(&index)
+	isok(t, err)
+	origin, ok = para.Origin("Package")
+	assert(t, ok && origin.Line == 1)
+	_, ok = para.Origin("Version")
+	assert(t, !ok)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,189 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Redaction {{{
+
+// What to do with the value of a privacy-sensitive field.
+type Redaction int
+
+const (
+	// Drop the field from the Paragraph entirely.
+	Remove Redaction = iota
+
+	// Replace the whole value with a pseudonym, so that equal values (the
+	// same Build-Path on two builds, say) can still be matched up.
+	Hash
+
+	// Replace only the email addresses in the value with pseudonyms,
+	// keeping the names, as in "John Doe <3f1c...@redacted.invalid>".
+	HashEmails
+)
+
+func (r Redaction) String() string {
+	switch r {
+	case Remove:
+		return "remove"
+	case Hash:
+		return "hash"
+	case HashEmails:
+		return "hash-emails"
+	default:
+		return fmt.Sprintf("Redaction(%d)", int(r))
+	}
+}
+
+// The fields redacted by DefaultRedactor: the people involved in an upload
+// or build, and the parts of a .buildinfo that describe the machine it was
+// built on.
+var DefaultRedactions = map[string]Redaction{
+	"Maintainer":  HashEmails,
+	"Uploaders":   HashEmails,
+	"Changed-By":  HashEmails,
+	"Build-Path":  Remove,
+	"Environment": Remove,
+}
+
+// }}}
+
+// Redactor {{{
+
+// Redactor strips or hashes privacy-sensitive fields out of a Paragraph (or
+// anything that can be turned into one), so that it can be published
+// somewhere public, such as a dashboard, without leaking email addresses
+// or details of the build machine.
+//
+// Field names are matched case-insensitively, as they are everywhere else
+// in deb822. Pseudonyms are the start of an HMAC-SHA256 of the original
+// value keyed with Salt; with no Salt, anyone can check a guess at the
+// original value, so set one when that matters.
+type Redactor struct {
+	Fields map[string]Redaction
+	Salt   []byte
+}
+
+// A Redactor with DefaultRedactions, and no Salt.
+func DefaultRedactor() Redactor {
+	fields := map[string]Redaction{}
+	for key, redaction := range DefaultRedactions {
+		fields[key] = redaction
+	}
+	return Redactor{Fields: fields}
+}
+
+func (r Redactor) redaction(key string) (Redaction, bool) {
+	if redaction, ok := r.Fields[key]; ok {
+		return redaction, true
+	}
+	for field, redaction := range r.Fields {
+		if strings.EqualFold(field, key) {
+			return redaction, true
+		}
+	}
+	return Remove, false
+}
+
+// Return a pseudonym for the given value: 16 hex digits, which is plenty
+// to tell apart the values in any one archive.
+func (r Redactor) pseudonym(value string) string {
+	mac := hmac.New(sha256.New, r.Salt)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+var emailRegexp = regexp.MustCompile(`[^\s<>(),"]+@[^\s<>(),"]+`)
+
+func (r Redactor) redactValue(redaction Redaction, value string) string {
+	switch redaction {
+	case Hash:
+		return r.pseudonym(value)
+	case HashEmails:
+		return emailRegexp.ReplaceAllStringFunc(value, func(email string) string {
+			return r.pseudonym(strings.ToLower(email)) + "@redacted.invalid"
+		})
+	}
+	return ""
+}
+
+// Return a copy of the Paragraph with the fields in Fields removed or
+// hashed. The Paragraph passed in is left alone.
+func (r Redactor) Paragraph(para Paragraph) Paragraph {
+	ret := Paragraph{
+		Order:  []string{},
+		Values: map[string]string{},
+	}
+	for _, key := range para.Order {
+		value := para.Values[key]
+		redaction, ok := r.redaction(key)
+		switch {
+		case !ok:
+			if raw, found := para.raw[key]; found {
+				if ret.raw == nil {
+					ret.raw = map[string]rawField{}
+				}
+				ret.raw[key] = raw
+			}
+			if origin, found := para.origins[key]; found {
+				ret.SetOrigin(key, origin)
+			}
+		case redaction == Remove:
+			continue
+		default:
+			value = r.redactValue(redaction, value)
+		}
+		ret.Order = append(ret.Order, key)
+		ret.Values[key] = value
+	}
+	return ret
+}
+
+// Redact a struct in place, such as a Changes or a BinaryIndex, given a
+// pointer to it. Struct fields that are removed are set to their zero
+// value; fields that can't hold a pseudonym (such as a version.Version)
+// will fail to decode, and should be removed instead.
+func (r Redactor) Redact(incoming interface{}) error {
+	data := reflect.ValueOf(incoming)
+	if data.Type().Kind() != reflect.Ptr || data.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Can only Redact a pointer to a Struct")
+	}
+	para, err := ConvertToParagraph(incoming)
+	if err != nil {
+		return err
+	}
+	redacted := r.Paragraph(*para)
+
+	data.Elem().Set(reflect.Zero(data.Elem().Type()))
+	return UnpackFromParagraph(redacted, incoming)
+}
+
+// }}}
+
+// vim: foldmethod=marker
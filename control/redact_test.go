@@ -0,0 +1,109 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+// {{{ buildinfo
+const redactBuildinfo = `Format: 1.0
+Source: hello
+Version: 2.10-3
+Build-Origin: Debian
+Build-Architecture: amd64
+Build-Date: Sat, 10 Oct 2026 12:00:00 +0000
+Build-Path: /home/jdoe/src/hello-2.10
+Maintainer: Santiago Vila <sanvila@debian.org>
+Changed-By: Jane Doe <Jane@example.com>, "Other, Person" <other@example.com>
+Environment:
+ DEB_BUILD_OPTIONS="parallel=8"
+ LANG="en_GB.UTF-8"
+ SOURCE_DATE_EPOCH="1602331200"
+`
+
+// }}}
+
+func TestRedactParagraph(t *testing.T) {
+	reader, err := control.NewParagraphReader(strings.NewReader(redactBuildinfo))
+	isok(t, err)
+	para, err := reader.Next()
+	isok(t, err)
+
+	redacted := control.DefaultRedactor().Paragraph(*para)
+	_, ok := redacted.Values["Build-Path"]
+	assert(t, !ok)
+	_, ok = redacted.Values["Environment"]
+	assert(t, !ok)
+	assert(t, strings.HasPrefix(redacted.Values["Maintainer"], "Santiago Vila <"))
+	assert(t, strings.HasSuffix(redacted.Values["Maintainer"], "@redacted.invalid>"))
+	assert(t, !strings.Contains(redacted.Values["Changed-By"], "example.com"))
+	assert(t, strings.Contains(redacted.Values["Changed-By"], `"Other, Person" <`))
+	assert(t, redacted.Values["Version"] == "2.10-3")
+	assert(t, redacted.Order[len(redacted.Order)-1] == "Changed-By")
+
+	/* The original is left as it was */
+	assert(t, para.Values["Build-Path"] == "/home/jdoe/src/hello-2.10")
+
+	/* Pseudonyms are stable, ignore case, and depend on the Salt */
+	again := control.DefaultRedactor().Paragraph(*para)
+	assert(t, again.Values["Changed-By"] == redacted.Values["Changed-By"])
+	other := control.Paragraph{Values: map[string]string{}}
+	other.Set("maintainer", "Jane Doe <jane@EXAMPLE.com>")
+	assert(t, strings.Contains(redacted.Values["Changed-By"],
+		control.DefaultRedactor().Paragraph(other).Values["maintainer"]))
+
+	salted := control.DefaultRedactor()
+	salted.Salt = []byte("sekrit")
+	assert(t, salted.Paragraph(*para).Values["Maintainer"] != redacted.Values["Maintainer"])
+
+	out := bytes.Buffer{}
+	isok(t, redacted.WriteTo(&out))
+	assert(t, !strings.Contains(out.String(), "jdoe"))
+	assert(t, !strings.Contains(out.String(), "DEB_BUILD_OPTIONS"))
+}
+
+func TestRedactStruct(t *testing.T) {
+	changes := control.Changes{}
+	isok(t, control.Unmarshal(&changes, strings.NewReader(redactBuildinfo)))
+
+	redactor := control.Redactor{Fields: map[string]control.Redaction{
+		"maintainer": control.Hash,
+		"Changed-By": control.Remove,
+	}}
+	isok(t, redactor.Redact(&changes))
+	assert(t, len(changes.Maintainer) == 16)
+	assert(t, changes.ChangedBy == "")
+	assert(t, changes.Source == "hello")
+	assert(t, changes.Version.String() == "2.10-3")
+
+	notok(t, redactor.Redact(changes))
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,296 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pault.ag/go/debian/dependency"
+)
+
+// The Release struct is the encapsulation of the Release (or InRelease)
+// file found at the top of each suite in a Debian archive, in
+// dists/<suite>/Release. It contains information about the suite, and the
+// size and hashes of every index file (Packages, Sources, Contents and so on)
+// contained in the suite, which is used to verify them once downloaded.
+type Release struct {
+	Paragraph
+
+	Origin        string
+	Label         string
+	Suite         string
+	Version       string
+	Codename      string
+	Changelogs    string
+	Date          time.Time
+	ValidUntil    time.Time `control:"Valid-Until"`
+	Architectures []dependency.Arch
+	Components    []string
+	Description   string
+
+	AcquireByHash        bool `control:"Acquire-By-Hash"`
+	NotAutomatic         bool `control:"NotAutomatic"`
+	ButAutomaticUpgrades bool `control:"ButAutomaticUpgrades"`
+
+	MD5Sum []MD5FileHash    `delim:"\n" strip:"\n\r\t " multiline:"true"`
+	SHA1   []SHA1FileHash   `delim:"\n" strip:"\n\r\t " multiline:"true"`
+	SHA256 []SHA256FileHash `delim:"\n" strip:"\n\r\t " multiline:"true"`
+	SHA512 []SHA512FileHash `delim:"\n" strip:"\n\r\t " multiline:"true"`
+}
+
+// ReleaseFile {{{
+
+// A ReleaseFile is a single index file listed in a Release file, with all
+// the hashes listed for it across the MD5Sum, SHA1, SHA256 and SHA512
+// stanzas cross-referenced together.
+type ReleaseFile struct {
+	Filename string
+	Size     int64
+
+	// Map of algorithm ("md5", "sha1", "sha256", "sha512") to the
+	// hex encoded digest.
+	Hashes map[string]string
+
+	byHash bool
+}
+
+// Return the strongest FileHash that we know about for this file.
+func (f ReleaseFile) BestHash() (FileHash, error) {
+	for _, algorithm := range []string{"sha512", "sha256", "sha1", "md5"} {
+		if hash, ok := f.Hashes[algorithm]; ok {
+			ret := FileHash{
+				Algorithm: algorithm,
+				Hash:      hash,
+				Size:      f.Size,
+				Filename:  f.Filename,
+			}
+			if f.byHash {
+				ret.ByHash = strings.ToUpper(algorithm)
+			}
+			return ret, nil
+		}
+	}
+	return FileHash{}, fmt.Errorf("No hashes known for '%s'", f.Filename)
+}
+
+// }}}
+
+// Indices {{{
+
+// Return every file listed in the Release, with all hashes for each file
+// cross-referenced. If two stanzas disagree on the Size of a file, an error
+// is returned, since at least one of them is lying.
+func (r *Release) Indices() ([]ReleaseFile, error) {
+	ret := []ReleaseFile{}
+	seen := map[string]int{}
+
+	add := func(hash FileHash) error {
+		i, ok := seen[hash.Filename]
+		if !ok {
+			i = len(ret)
+			seen[hash.Filename] = i
+			ret = append(ret, ReleaseFile{
+				Filename: hash.Filename,
+				Size:     hash.Size,
+				Hashes:   map[string]string{},
+				byHash:   r.AcquireByHash,
+			})
+		}
+		if ret[i].Size != hash.Size {
+			return fmt.Errorf(
+				"Release lists '%s' as both %d and %d bytes",
+				hash.Filename, ret[i].Size, hash.Size,
+			)
+		}
+		ret[i].Hashes[hash.Algorithm] = hash.Hash
+		return nil
+	}
+
+	for _, hash := range r.SHA512 {
+		if err := add(hash.FileHash); err != nil {
+			return nil, err
+		}
+	}
+	for _, hash := range r.SHA256 {
+		if err := add(hash.FileHash); err != nil {
+			return nil, err
+		}
+	}
+	for _, hash := range r.SHA1 {
+		if err := add(hash.FileHash); err != nil {
+			return nil, err
+		}
+	}
+	for _, hash := range r.MD5Sum {
+		if err := add(hash.FileHash); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// Given a path relative to the Release file (such as
+// "main/binary-amd64/Packages.xz"), return the expected Size and hashes
+// of that file, so that it can be verified after download.
+func (r *Release) IndexFor(path string) (*ReleaseFile, error) {
+	indices, err := r.Indices()
+	if err != nil {
+		return nil, err
+	}
+	path = strings.TrimPrefix(filepath.ToSlash(path), "/")
+	for _, index := range indices {
+		if index.Filename == path {
+			return &index, nil
+		}
+	}
+	return nil, fmt.Errorf("'%s' is not listed in the Release file", path)
+}
+
+// Return the files listed in the MD5Sum, SHA1, SHA256 or SHA512 stanza of
+// the Release, for the algorithm given ("md5", "sha1", "sha256" or
+// "sha512"), as Checksums. If there are none, the list is empty.
+func (r *Release) Checksums(algorithm string) Checksums {
+	ret := Checksums{Algorithm: algorithm, Files: []FileHash{}}
+	switch algorithm {
+	case "md5":
+		for _, hash := range r.MD5Sum {
+			ret.Add(hash.FileHash)
+		}
+	case "sha1":
+		for _, hash := range r.SHA1 {
+			ret.Add(hash.FileHash)
+		}
+	case "sha256":
+		for _, hash := range r.SHA256 {
+			ret.Add(hash.FileHash)
+		}
+	case "sha512":
+		for _, hash := range r.SHA512 {
+			ret.Add(hash.FileHash)
+		}
+	}
+	return ret
+}
+
+// Return true if the Release is past its Valid-Until date, as of the
+// time given. Releases without a Valid-Until never expire.
+func (r *Release) Expired(now time.Time) bool {
+	return !r.ValidUntil.IsZero() && now.After(r.ValidUntil)
+}
+
+// Work out which of the Architectures published in the Release to fetch,
+// given the ones wanted. Wanted architectures may be wildcards, such as
+// "linux-any" or "any", which stand for every published architecture
+// they match (other than "all", which has to be asked for by name). The
+// result is in the order the Release lists them.
+//
+// If any wanted architecture (or wildcard) doesn't match anything the
+// suite publishes, an error naming all of them is returned, rather than
+// quietly fetching less than was asked for.
+//
+// Some (mostly flat) repositories don't list their Architectures at all;
+// for those, the wanted architectures are taken at their word, but
+// wildcards can't be expanded, so are an error.
+func (r *Release) SelectArchitectures(wanted []dependency.Arch) ([]dependency.Arch, error) {
+	if len(r.Architectures) == 0 {
+		for i := range wanted {
+			if wanted[i].IsWildcard() {
+				return nil, fmt.Errorf(
+					"%s does not list its Architectures, so %s can't be expanded",
+					r.Suite, wanted[i].String(),
+				)
+			}
+		}
+		return wanted, nil
+	}
+
+	selected := map[int]bool{}
+	missing := []string{}
+	for i := range wanted {
+		want := wanted[i]
+		found := false
+		for j := range r.Architectures {
+			published := r.Architectures[j]
+			if want.Is(&published) {
+				selected[j] = true
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, want.String())
+		}
+	}
+
+	if len(missing) != 0 {
+		published := []string{}
+		for _, arch := range r.Architectures {
+			published = append(published, arch.String())
+		}
+		return nil, fmt.Errorf(
+			"%s not published in %s (only %s)",
+			strings.Join(missing, ", "), r.Suite, strings.Join(published, " "),
+		)
+	}
+
+	ret := []dependency.Arch{}
+	for j, arch := range r.Architectures {
+		if selected[j] {
+			ret = append(ret, arch)
+		}
+	}
+	return ret, nil
+}
+
+// }}}
+
+// Parse {{{
+
+// Given a path on the filesystem, Parse the file off the disk and return
+// a pointer to a brand new Release struct, unless error is set to a value
+// other than nil. The signature on an InRelease file is not checked.
+func ParseReleaseFile(path string) (*Release, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseRelease(bufio.NewReader(f))
+}
+
+// Given a bufio.Reader, consume the Reader, and return a Release object
+// for use. Clearsigned InRelease files are accepted, but the signature
+// is not checked, use pgp.ParseSignedRelease for that.
+func ParseRelease(reader *bufio.Reader) (*Release, error) {
+	ret := Release{}
+	if err := Unmarshal(&ret, reader); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,145 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+/*
+ *
+ */
+
+// Test Release {{{
+const testRelease = `Origin: Debian
+Label: Debian
+Suite: stable
+Version: 12.1
+Codename: bookworm
+Date: Sat, 22 Jul 2023 09:30:21 UTC
+Valid-Until: Sat, 29 Jul 2023 09:30:21 UTC
+Acquire-By-Hash: yes
+Architectures: all amd64 arm64
+Components: main contrib non-free-firmware
+Description: Debian 12.1 Released 22 July 2023
+MD5Sum:
+ 0ed6d4c8891eb86358b94bb35d9e4da4  1484322 contrib/Contents-all
+ d0a0325a97c42fd5f66a8c3e29bcea64    57319 contrib/Contents-all.gz
+SHA256:
+ 3957f28db16e3f28c7b34ae84f1c929c567de6970f3f1b95dac9b498dd80fe63   738242 contrib/Contents-all
+ 3e9a121d599b56c08bc8f144e4830807c77c29d7114316d6984ba54695d3db7b    57319 contrib/Contents-all.gz
+`
+
+// }}}
+
+func TestReleaseParse(t *testing.T) {
+	release, err := control.ParseRelease(bufio.NewReader(strings.NewReader(testRelease)))
+	isok(t, err)
+
+	assert(t, release.Codename == "bookworm")
+	assert(t, release.AcquireByHash)
+	assert(t, len(release.Architectures) == 3)
+	assert(t, release.Architectures[1].CPU == "amd64")
+	assert(t, len(release.Components) == 3)
+	assert(t, release.Date.Equal(time.Date(2023, 7, 22, 9, 30, 21, 0, time.UTC)))
+	assert(t, release.Expired(time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)))
+	assert(t, !release.Expired(time.Date(2023, 7, 23, 0, 0, 0, 0, time.UTC)))
+	assert(t, len(release.SHA256) == 2)
+}
+
+func TestReleaseIndexFor(t *testing.T) {
+	release, err := control.ParseRelease(bufio.NewReader(strings.NewReader(testRelease)))
+	isok(t, err)
+
+	/* The MD5Sum stanza above disagrees with the SHA256 on the size of
+	 * Contents-all, so that should be flagged. */
+	_, err = release.IndexFor("contrib/Contents-all.gz")
+	notok(t, err)
+
+	release.MD5Sum = release.MD5Sum[1:]
+	index, err := release.IndexFor("contrib/Contents-all.gz")
+	isok(t, err)
+	assert(t, index.Size == 57319)
+	assert(t, index.Hashes["md5"] == "d0a0325a97c42fd5f66a8c3e29bcea64")
+	assert(t, index.Hashes["sha256"] == "3e9a121d599b56c08bc8f144e4830807c77c29d7114316d6984ba54695d3db7b")
+
+	best, err := index.BestHash()
+	isok(t, err)
+	assert(t, best.Algorithm == "sha256")
+	assert(t, best.ByHashPath("dists/bookworm/"+best.Filename) ==
+		"dists/bookworm/contrib/by-hash/SHA256/3e9a121d599b56c08bc8f144e4830807c77c29d7114316d6984ba54695d3db7b")
+
+	_, err = release.IndexFor("main/binary-amd64/Packages.xz")
+	notok(t, err)
+}
+
+func TestReleaseRoundTrip(t *testing.T) {
+	release, err := control.ParseRelease(bufio.NewReader(strings.NewReader(testRelease)))
+	isok(t, err)
+
+	out := strings.Builder{}
+	isok(t, control.Marshal(&out, release))
+	assert(t, strings.Contains(out.String(), "Date: Sat, 22 Jul 2023 09:30:21 UTC\n"))
+}
+
+func TestReleaseSelectArchitectures(t *testing.T) {
+	release, err := control.ParseRelease(bufio.NewReader(strings.NewReader(testRelease)))
+	isok(t, err)
+
+	wanted, err := dependency.ParseArchitectures("arm64 linux-any")
+	isok(t, err)
+	archs, err := release.SelectArchitectures(wanted)
+	isok(t, err)
+	assert(t, len(archs) == 2)
+	assert(t, archs[0].CPU == "amd64")
+	assert(t, archs[1].CPU == "arm64")
+
+	wanted, err = dependency.ParseArchitectures("all any")
+	isok(t, err)
+	archs, err = release.SelectArchitectures(wanted)
+	isok(t, err)
+	assert(t, len(archs) == 3)
+
+	wanted, err = dependency.ParseArchitectures("amd64 riscv64 kfreebsd-any")
+	isok(t, err)
+	_, err = release.SelectArchitectures(wanted)
+	notok(t, err)
+	assert(t, strings.HasPrefix(err.Error(), "riscv64, kfreebsd-any not published in stable"))
+
+	release.Architectures = nil
+	wanted, err = dependency.ParseArchitectures("riscv64")
+	isok(t, err)
+	archs, err = release.SelectArchitectures(wanted)
+	isok(t, err)
+	assert(t, len(archs) == 1)
+	wanted, err = dependency.ParseArchitectures("linux-any")
+	isok(t, err)
+	_, err = release.SelectArchitectures(wanted)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,227 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+// {{{ scanner test input
+var scannerInput = "\xef\xbb\xbf# A comment\n\n\n" + `Package: hello
+Version: 2.10-1
+Description: example package
+ The GNU hello program produces a familiar, friendly greeting.
+ .
+  It allows non-programmers to use a classic computer science tool.
+Checksums-Sha256:
+ 2c91c414f8c7a0556372c94301b8786801a05b29aafeceb2e308e037d47d5ddc 2170 hy_0.11.0-4.dsc
+ 27610d4e31645bc888c633881082270917aedd3443e36031a0030d3dae6f7380 7536 hy_0.11.0-4.debian.tar.xz
+# Comments can go in the middle, too
+Depends: libc6 (>= 2.34),
+         libfoo1
+Empty:
+Spaced  :   value with trailing space   
+
+Package: bye
+Version: 1.0
+Version: 1.1`
+
+// }}}
+
+// Read every Paragraph with a Scanner.
+func scanAll(t *testing.T, scanner *control.Scanner) []control.Paragraph {
+	ret := []control.Paragraph{}
+	for scanner.NextParagraph() {
+		para, err := scanner.Paragraph()
+		isok(t, err)
+		ret = append(ret, *para)
+	}
+	isok(t, scanner.Err())
+	return ret
+}
+
+func TestScannerMatchesParagraphReader(t *testing.T) {
+	for _, input := range []string{scannerInput, benchSources} {
+		reader, err := control.NewParagraphReader(strings.NewReader(input))
+		isok(t, err)
+		want, err := reader.All()
+		isok(t, err)
+
+		for _, scanner := range []*control.Scanner{
+			control.NewScanner(strings.NewReader(input)),
+			control.NewScanner(iotest.OneByteReader(strings.NewReader(input))),
+		} {
+			got := scanAll(t, scanner)
+			assert(t, len(got) == len(want))
+			for i := range want {
+				assert(t, strings.Join(got[i].Order, " ") == strings.Join(want[i].Order, " "))
+				for key, value := range want[i].Values {
+					if got[i].Values[key] != value {
+						t.Errorf("%s: got %q, want %q", key, got[i].Values[key], value)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestScannerRaw(t *testing.T) {
+	scanner := control.NewScanner(strings.NewReader(scannerInput))
+	assert(t, scanner.NextParagraph())
+
+	fields := map[string]string{}
+	for scanner.Scan() {
+		fields[string(scanner.Key())] = string(scanner.Value())
+	}
+	isok(t, scanner.Err())
+	assert(t, fields["Package"] == "hello")
+	assert(t, fields["Depends"] == "libc6 (>= 2.34),\n         libfoo1")
+	assert(t, strings.HasSuffix(fields["Description"], "greeting.\n .\n  It allows non-programmers to use a classic computer science tool."))
+	assert(t, fields["Empty"] == "")
+	assert(t, fields["Spaced"] == "value with trailing space")
+
+	/* Skip straight past the rest of the next one */
+	assert(t, scanner.NextParagraph())
+	assert(t, scanner.Scan())
+	assert(t, string(scanner.Key()) == "Package")
+	assert(t, !scanner.NextParagraph())
+	isok(t, scanner.Err())
+}
+
+func TestScannerLongField(t *testing.T) {
+	long := strings.Repeat(" "+strings.Repeat("x", 79)+"\n", 4096)
+	scanner := control.NewScanner(strings.NewReader("Package: hello\nFiles:\n" + long + "Version: 1.0\n"))
+	para := scanAll(t, scanner)
+	assert(t, len(para) == 1)
+	assert(t, len(para[0].Values["Files"]) == 80*4096)
+	assert(t, para[0].Values["Version"] == "1.0")
+}
+
+func TestScannerErrors(t *testing.T) {
+	for _, input := range []string{
+		"Package: hello\nnot a field\n",
+		"\n continuation\nPackage: hello\n",
+	} {
+		scanner := control.NewScanner(strings.NewReader(input))
+		for scanner.NextParagraph() {
+			for scanner.Scan() {
+			}
+		}
+		notok(t, scanner.Err())
+	}
+}
+
+func TestScannerHydrate(t *testing.T) {
+	scanner := control.NewScanner(strings.NewReader(benchSources))
+	count := 0
+	for scanner.NextParagraph() {
+		para, err := scanner.Paragraph()
+		isok(t, err)
+		source := control.SourceIndex{}
+		isok(t, control.UnpackFromParagraph(*para, &source))
+		assert(t, source.Package == "fbasics")
+		count++
+	}
+	isok(t, scanner.Err())
+	assert(t, count > 1)
+}
+
+/*
+ *
+ */
+
+// Pull the Package and Version out of every paragraph, without a Paragraph
+// or a struct.
+func BenchmarkScanner(b *testing.B) {
+	data := []byte(benchSources)
+	pkg, ver := []byte("Package"), []byte("Version")
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		scanner := control.NewScanner(bytes.NewReader(data))
+		found := 0
+		for scanner.NextParagraph() {
+			for scanner.Scan() {
+				if bytes.Equal(scanner.Key(), pkg) || bytes.Equal(scanner.Key(), ver) {
+					found++
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil || found == 0 {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The same, with a Paragraph built for each.
+func BenchmarkScannerParagraph(b *testing.B) {
+	data := []byte(benchSources)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		scanner := control.NewScanner(bytes.NewReader(data))
+		for scanner.NextParagraph() {
+			if _, err := scanner.Paragraph(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkParagraphReader(b *testing.B) {
+	data := []byte(benchSources)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reader, err := control.NewParagraphReader(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := reader.All(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The reflection path, all the way into structs.
+func BenchmarkUnmarshal(b *testing.B) {
+	data := []byte(benchSources)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sources := []control.SourceIndex{}
+		if err := control.Unmarshal(&sources, bufio.NewReader(bytes.NewReader(data))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// vim: foldmethod=marker
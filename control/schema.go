@@ -0,0 +1,260 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Schema {{{
+
+// A Schema lists the fields a kind of control file paragraph (such as a
+// .dsc, or a binary package in debian/control) is expected to have, so
+// that misspelled ones can be caught.
+type Schema struct {
+	// Name of the Schema, as registered, such as "dsc".
+	Name string
+
+	Fields []string
+}
+
+// Fields anyone may add to any control file, as described in Policy 5.7:
+// an X, any of S, B or C (for where dpkg copies them to), then a hyphen.
+var userDefinedField = regexp.MustCompile(`^(?i:X[SBC]*-)`)
+
+// Return a Schema with every field that decoding into the given struct
+// (or pointer to one) consumes, plus any extra fields, which the struct
+// leaves in its Paragraph.
+func SchemaOf(name string, v interface{}, extra ...string) Schema {
+	structType := reflect.TypeOf(v)
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	known := schemaFields(structType, map[string]bool{})
+	for _, field := range extra {
+		known[field] = true
+	}
+
+	ret := Schema{Name: name, Fields: []string{}}
+	for field := range known {
+		ret.Fields = append(ret.Fields, field)
+	}
+	sort.Strings(ret.Fields)
+	return ret
+}
+
+var paragraphType = reflect.TypeOf(Paragraph{})
+
+// Return the Paragraph key of every exported field of the struct type, as
+// knownKeys does, but without the fields of an embedded Paragraph.
+func schemaFields(structType reflect.Type, into map[string]bool) map[string]bool {
+	for i := 0; i < structType.NumField(); i++ {
+		fieldType := structType.Field(i)
+		if fieldType.Anonymous {
+			if fieldType.Type.Kind() == reflect.Struct && fieldType.Type != paragraphType {
+				schemaFields(fieldType.Type, into)
+			}
+			continue
+		}
+		if fieldType.PkgPath != "" {
+			continue
+		}
+		if key, options := fieldKey(fieldType); key != "-" {
+			into[key] = true
+			for _, alias := range options.aliases {
+				into[alias] = true
+			}
+		}
+	}
+	return into
+}
+
+// Return true if the field is in the Schema (field names aren't case
+// sensitive), or is user-defined, such as "XS-Autobuild".
+func (s Schema) Known(field string) bool {
+	if userDefinedField.MatchString(field) {
+		return true
+	}
+	for _, known := range s.Fields {
+		if strings.EqualFold(known, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the field in the Schema nearest to the given one, such as
+// "Depends" for "Depnds", if any is close enough to be a likely typo:
+// within two typing mistakes (a character added, dropped, changed, or
+// swapped with the next), and fewer than a third of the characters.
+func (s Schema) Suggest(field string) (string, bool) {
+	best, bestDistance := "", 0
+	for _, known := range s.Fields {
+		distance := editDistance(strings.ToLower(field), strings.ToLower(known))
+		if distance > 2 || distance*3 >= len(field) {
+			continue
+		}
+		if best == "" || distance < bestDistance {
+			best, bestDistance = known, distance
+		}
+	}
+	return best, best != ""
+}
+
+// Return the message for an unknown field, with the Suggestion, if any.
+func (s Schema) unknown(field string) string {
+	if suggestion, ok := s.Suggest(field); ok {
+		return fmt.Sprintf("Unknown field '%s' (did you mean '%s'?)", field, suggestion)
+	}
+	return fmt.Sprintf("Unknown field '%s'", field)
+}
+
+// Return a Diagnostic for each field of the Paragraph not in the Schema,
+// suggesting what it may have been meant to be. The Line is where the
+// field was read from, if the ParagraphReader had a source set, or 0.
+func (s Schema) Check(p Paragraph) []Diagnostic {
+	ret := []Diagnostic{}
+	for _, field := range p.Order {
+		if s.Known(field) {
+			continue
+		}
+		origin, _ := p.Origin(field)
+		ret = append(ret, Diagnostic{Line: origin.Line, Message: s.unknown(field)})
+	}
+	return ret
+}
+
+// The optimal string alignment distance between a and b: how many
+// characters have to be added, dropped, changed, or swapped with the one
+// next to them, to get from one to the other.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	d := make([][]int, len(ar)+1)
+	for i := range d {
+		d[i] = make([]int, len(br)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ar[i-1] == br[j-2] && ar[i-2] == br[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ar)][len(br)]
+}
+
+func min(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+	return first
+}
+
+// }}}
+
+// Registry {{{
+
+var (
+	schemasLock sync.RWMutex
+	schemas     = map[string]Schema{}
+)
+
+// Register a Schema under its Name, replacing any already registered
+// with that Name.
+func RegisterSchema(schema Schema) {
+	schemasLock.Lock()
+	defer schemasLock.Unlock()
+	schemas[schema.Name] = schema
+}
+
+// Return the Schema registered with the given Name.
+func SchemaFor(name string) (Schema, bool) {
+	schemasLock.RLock()
+	defer schemasLock.RUnlock()
+	schema, ok := schemas[name]
+	return schema, ok
+}
+
+// Return the Names of every registered Schema, sorted.
+func Schemas() []string {
+	schemasLock.RLock()
+	defer schemasLock.RUnlock()
+	ret := []string{}
+	for name := range schemas {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Fields of binary packages that the structs for them leave in the
+// Paragraph.
+var binaryFields = []string{
+	"Depends", "Pre-Depends", "Recommends", "Suggests", "Enhances",
+	"Breaks", "Conflicts", "Replaces", "Provides",
+	"Built-Using", "Static-Built-Using",
+	"Essential", "Protected", "Build-Essential", "Important",
+	"Tag", "Task", "Original-Maintainer", "Description-md5",
+}
+
+// Fields of source packages that the structs for them leave in the
+// Paragraph.
+var sourceFields = []string{
+	"Vcs-Arch", "Vcs-Bzr", "Vcs-Cvs", "Vcs-Darcs", "Vcs-Git", "Vcs-Hg",
+	"Vcs-Mtn", "Vcs-Svn", "Testsuite", "Testsuite-Triggers",
+	"Build-Conflicts", "Build-Conflicts-Arch", "Build-Conflicts-Indep",
+	"Package-List", "Checksums-Sha512", "Dgit", "Original-Maintainer",
+	"Rules-Requires-Root", "Build-Driver",
+}
+
+func init() {
+	RegisterSchema(SchemaOf("control-source", SourceParagraph{},
+		append(sourceFields, "Origin", "Bugs", "Standards-Version")...))
+	RegisterSchema(SchemaOf("control-binary", BinaryParagraph{},
+		append(binaryFields, "Subarchitecture", "Kernel-Version", "Installer-Menu-Item")...))
+	RegisterSchema(SchemaOf("dsc", DSC{}, sourceFields...))
+	RegisterSchema(SchemaOf("sources", SourceIndex{}, append(sourceFields, "Build-Depends",
+		"Build-Depends-Arch", "Build-Depends-Indep", "Extra-Source-Only")...))
+	RegisterSchema(SchemaOf("packages", BinaryIndex{}, binaryFields...))
+	RegisterSchema(SchemaOf("changes", Changes{}, "Date", "Description", "Binary-Only", "Checksums-Sha512"))
+	RegisterSchema(SchemaOf("buildinfo", Buildinfo{}, "Build-Kernel-Version", "Checksums-Sha512"))
+	RegisterSchema(SchemaOf("release", Release{}, "No-Support-for-Architecture-all", "Signed-By"))
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,123 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+// {{{ misspelled debian/control binary paragraph
+var misspelledBinary = `Package: hello
+Architecture: any
+Depnds: ${shlibs:Depends}, ${misc:Depends}
+Sugests: hello-doc
+multi-arch: foreign
+XB-Custom: yes
+Frobnication-Level: 11
+Description: example package based on GNU hello
+`
+
+// }}}
+
+func TestSchemaSuggest(t *testing.T) {
+	schema, ok := control.SchemaFor("control-binary")
+	assert(t, ok)
+
+	for field, want := range map[string]string{
+		"Depnds":      "Depends",
+		"depnds":      "Depends",
+		"Sugests":     "Suggests",
+		"Pre-Depnds":  "Pre-Depends",
+		"Sectoin":     "Section",
+		"Architeture": "Architecture",
+		"Breaks":      "Breaks",
+		"Frobnicate":  "",
+		"Dep":         "",
+	} {
+		got, ok := schema.Suggest(field)
+		assert(t, ok == (want != ""))
+		assert(t, got == want)
+	}
+
+	assert(t, schema.Known("depends"))
+	assert(t, schema.Known("XB-Anything"))
+	assert(t, schema.Known("XSBC-Original-Maintainer"))
+	assert(t, !schema.Known("Depnds"))
+}
+
+func TestSchemaCheck(t *testing.T) {
+	schema, ok := control.SchemaFor("control-binary")
+	assert(t, ok)
+
+	diagnostics := schema.Check(readParagraph(t, misspelledBinary, "debian/control"))
+	assert(t, len(diagnostics) == 3)
+	assert(t, diagnostics[0].Line == 3)
+	assert(t, diagnostics[0].Error() == "line 3: Unknown field 'Depnds' (did you mean 'Depends'?)")
+	assert(t, diagnostics[1].Message == "Unknown field 'Sugests' (did you mean 'Suggests'?)")
+	assert(t, diagnostics[2].Message == "Unknown field 'Frobnication-Level'")
+}
+
+func TestSchemaOf(t *testing.T) {
+	type Widget struct {
+		control.Paragraph
+
+		Name   string
+		Colour string `control:"Colour-Name"`
+		Secret string `control:"-"`
+	}
+	schema := control.SchemaOf("widget", Widget{}, "Size")
+	assert(t, schema.Name == "widget")
+	assert(t, strings.Join(schema.Fields, " ") == "Colour-Name Name Size")
+
+	control.RegisterSchema(schema)
+	registered, ok := control.SchemaFor("widget")
+	assert(t, ok)
+	assert(t, registered.Known("colour-name"))
+	assert(t, strings.Contains(strings.Join(control.Schemas(), " "), "dsc"))
+}
+
+func TestDecoderSchema(t *testing.T) {
+	schema, ok := control.SchemaFor("control-binary")
+	assert(t, ok)
+
+	decoder, err := control.NewDecoderWith(strings.NewReader(misspelledBinary), control.DecoderOptions{Schema: &schema})
+	isok(t, err)
+	binary := control.BinaryParagraph{}
+	isok(t, decoder.Decode(&binary))
+	assert(t, binary.Package == "hello")
+	assert(t, len(decoder.Diagnostics()) == 3)
+	assert(t, decoder.Diagnostics()[1].Line == 4)
+
+	decoder, err = control.NewDecoderWith(strings.NewReader(misspelledBinary), control.DecoderOptions{Schema: &schema, Strict: true})
+	isok(t, err)
+	err = decoder.Decode(&binary)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "did you mean 'Depends'"))
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,50 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"bytes"
+)
+
+// Paragraph signatures {{{
+
+// The field that a Paragraph's own signature is stored in (see pgp.SignParagraph),
+// so each Paragraph in a file can be checked on its own.
+const SignatureField = "Signature"
+
+// Return the bytes of the Paragraph that get signed: every field other than
+// the signature, in order, formatted the same way WriteTo would write a
+// freshly set value. This means that re-folding a field won't break the
+// signature, but changing the value (or the order of the fields) will.
+func (p *Paragraph) SignedData() []byte {
+	out := bytes.Buffer{}
+	for _, key := range p.Order {
+		if key == SignatureField {
+			continue
+		}
+		out.WriteString(formatField(key, p.Values[key]))
+	}
+	return out.Bytes()
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,249 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Variables {{{
+
+// A VariableProvider knows the values of some of the variables used in a
+// Template, such as the "shlibs:Depends" of "${shlibs:Depends}".
+type VariableProvider interface {
+	Variable(name string) (string, bool)
+}
+
+// Variables is the simplest VariableProvider, a map of name to value.
+type Variables map[string]string
+
+func (v Variables) Variable(name string) (string, bool) {
+	value, ok := v[name]
+	return value, ok
+}
+
+// VariableFunc turns a function into a VariableProvider.
+type VariableFunc func(name string) (string, bool)
+
+func (f VariableFunc) Variable(name string) (string, bool) {
+	return f(name)
+}
+
+// Read variables from a file of "name=value" lines, such as
+// debian/substvars. Blank lines and lines starting with "#" are skipped,
+// and "name?=value" (an assignment dpkg won't warn about if unused) is
+// read the same as "name=value".
+func ReadVariables(reader io.Reader) (Variables, error) {
+	ret := Variables{}
+	err := ScanVariables(reader, func(name, value string, optional bool) {
+		ret[name] = value
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Read a file of "name=value" lines, as in deb-substvars(5), calling set
+// with each variable in turn. optional is set for "name?=value", which
+// dpkg won't warn about if it goes unused. Blank lines, and lines starting
+// with "#", are skipped.
+func ScanVariables(reader io.Reader, set func(name, value string, optional bool)) error {
+	scanner := bufio.NewScanner(reader)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return fmt.Errorf("Line %d: expected 'name=value'", lineno)
+		}
+		name, value := line[:i], line[i+1:]
+		optional := strings.HasSuffix(name, "?")
+		name = strings.TrimSuffix(name, "?")
+		if !validVariableName(name) {
+			return fmt.Errorf("Line %d: bad variable name '%s'", lineno, name)
+		}
+		set(name, value, optional)
+	}
+	return scanner.Err()
+}
+
+// Names are alphanumerics, plus "-", ":" and "_", and can't start with one
+// of those, as in deb-substvars(5).
+func validVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case i > 0 && (r == '-' || r == ':' || r == '_'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Provide the process environment, as variables named with the given
+// prefix, such as "env:" for "${env:DEB_VERSION}".
+func EnvironmentVariables(prefix string) VariableProvider {
+	return VariableFunc(func(name string) (string, bool) {
+		if !strings.HasPrefix(name, prefix) {
+			return "", false
+		}
+		return os.LookupEnv(strings.TrimPrefix(name, prefix))
+	})
+}
+
+// }}}
+
+// Template {{{
+
+// A Template expands "${name}" variables in field values, as dpkg-gencontrol
+// does for debian/control. Each variable is looked up in each of the
+// Providers in turn, and the first one that knows it wins. Values may use
+// variables themselves, and are expanded in turn.
+type Template struct {
+	Providers []VariableProvider
+
+	// If set, a variable no Provider knows about is an error. Otherwise,
+	// it expands to nothing, like dpkg.
+	Strict bool
+}
+
+// How deep variables may refer to other variables before we give up and
+// assume there's a loop.
+const maxExpansionDepth = 50
+
+func (t Template) lookup(name string) (string, bool) {
+	for _, provider := range t.Providers {
+		if value, ok := provider.Variable(name); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Expand every variable in the string.
+func (t Template) ExpandString(value string) (string, error) {
+	return t.expand(value, 0)
+}
+
+func (t Template) expand(value string, depth int) (string, error) {
+	if depth > maxExpansionDepth {
+		return "", fmt.Errorf("Too many nested variables expanding '%s'; is there a loop?", value)
+	}
+
+	out := strings.Builder{}
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			out.WriteString(value)
+			return out.String(), nil
+		}
+		end := strings.Index(value[start:], "}")
+		if end < 0 {
+			/* Not a variable, just a stray "${" */
+			out.WriteString(value)
+			return out.String(), nil
+		}
+		end += start
+
+		name := value[start+2 : end]
+		out.WriteString(value[:start])
+		value = value[end+1:]
+
+		replacement, ok := t.lookup(name)
+		if !ok {
+			if t.Strict {
+				return "", fmt.Errorf("Unknown variable '${%s}'", name)
+			}
+			continue
+		}
+		expanded, err := t.expand(replacement, depth+1)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(expanded)
+	}
+}
+
+// Return a copy of the Paragraph with every variable in every field
+// expanded. Fields that expand to nothing (or only whitespace) are
+// dropped, as dpkg-gencontrol does.
+func (t Template) Paragraph(para Paragraph) (Paragraph, error) {
+	ret := Paragraph{Order: []string{}, Values: map[string]string{}}
+	for _, key := range para.Order {
+		value, err := t.ExpandString(para.Values[key])
+		if err != nil {
+			return Paragraph{}, fmt.Errorf("%s: %s", key, err)
+		}
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		ret.Set(key, value)
+	}
+	return ret, nil
+}
+
+// Marshal data (a struct, or slice of structs, as for Marshal) to writer,
+// expanding variables in every field on the way.
+func (t Template) Marshal(writer io.Writer, data interface{}) error {
+	out := bytes.Buffer{}
+	if err := Marshal(&out, data); err != nil {
+		return err
+	}
+	reader, err := NewParagraphReader(&out)
+	if err != nil {
+		return err
+	}
+	paragraphs, err := reader.All()
+	if err != nil {
+		return err
+	}
+	for i, para := range paragraphs {
+		expanded, err := t.Paragraph(para)
+		if err != nil {
+			return err
+		}
+		if i != 0 {
+			if _, err := io.WriteString(writer, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := expanded.WriteTo(writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,144 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+/*
+ *
+ */
+
+func TestTemplateExpand(t *testing.T) {
+	vars, err := control.ReadVariables(strings.NewReader(`# generated by dh_shlibdeps
+shlibs:Depends=libc6 (>= 2.34)
+misc:Depends=
+misc:Pre-Depends?=${misc:Depends}
+binary:Version=${source:Version}+b1
+`))
+	isok(t, err)
+	assert(t, len(vars) == 4)
+
+	template := control.Template{Providers: []control.VariableProvider{
+		vars,
+		control.Variables{"source:Version": "2.10-3"},
+		control.VariableFunc(func(name string) (string, bool) {
+			return strings.ToUpper(name), strings.HasPrefix(name, "upper:")
+		}),
+	}}
+
+	value, err := template.ExpandString("${shlibs:Depends}, foo (= ${binary:Version}), ${upper:x}")
+	isok(t, err)
+	assert(t, value == "libc6 (>= 2.34), foo (= 2.10-3+b1), UPPER:X")
+
+	/* Unknown variables are dropped, unless Strict */
+	value, err = template.ExpandString("a${nope}b ${ not closed")
+	isok(t, err)
+	assert(t, value == "ab ${ not closed")
+	template.Strict = true
+	_, err = template.ExpandString("${nope}")
+	notok(t, err)
+
+	loop := control.Template{Providers: []control.VariableProvider{control.Variables{"a": "${b}", "b": "${a}"}}}
+	_, err = loop.ExpandString("${a}")
+	notok(t, err)
+
+	_, err = control.ReadVariables(strings.NewReader("no equals sign\n"))
+	notok(t, err)
+	_, err = control.ReadVariables(strings.NewReader("-leading=dash\n"))
+	notok(t, err)
+}
+
+func TestScanVariables(t *testing.T) {
+	optional := map[string]bool{}
+	isok(t, control.ScanVariables(strings.NewReader("a=1\r\n# comment\n\nb?=2\n"), func(name, value string, opt bool) {
+		optional[name+"="+value] = opt
+	}))
+	assert(t, len(optional) == 2)
+	assert(t, !optional["a=1"])
+	assert(t, optional["b=2"])
+
+	for _, file := range []string{"=value\n", "has space=1\n", "${x}=1\n"} {
+		notok(t, control.ScanVariables(strings.NewReader(file), func(string, string, bool) {}))
+	}
+}
+
+func TestTemplateEnvironment(t *testing.T) {
+	isok(t, os.Setenv("GO_DEBIAN_TEMPLATE_TEST", "hello"))
+	defer os.Unsetenv("GO_DEBIAN_TEMPLATE_TEST")
+
+	template := control.Template{Providers: []control.VariableProvider{control.EnvironmentVariables("env:")}}
+	value, err := template.ExpandString("${env:GO_DEBIAN_TEMPLATE_TEST} ${GO_DEBIAN_TEMPLATE_TEST}")
+	isok(t, err)
+	assert(t, value == "hello ")
+}
+
+type templatedPackage struct {
+	control.Paragraph
+
+	Package    string
+	Version    string
+	Depends    dependency.Dependency
+	Recommends dependency.Dependency
+	Built      string `control:"Built-Using"`
+}
+
+func TestTemplateMarshal(t *testing.T) {
+	depends, err := dependency.Parse("${shlibs:Depends}, ${misc:Depends}")
+	isok(t, err)
+	recommends, err := dependency.Parse("${misc:Recommends}")
+	isok(t, err)
+
+	template := control.Template{Providers: []control.VariableProvider{control.Variables{
+		"binary:Version":  "2.10-3",
+		"shlibs:Depends":  "libc6 (>= 2.34)",
+		"misc:Depends":    "debconf",
+		"misc:Recommends": "",
+	}}}
+
+	out := bytes.Buffer{}
+	isok(t, template.Marshal(&out, []templatedPackage{{
+		Package:    "hello",
+		Version:    "${binary:Version}",
+		Depends:    *depends,
+		Recommends: *recommends,
+	}, {
+		Package: "hello-doc",
+		Version: "${binary:Version}",
+		Built:   "${unknown}",
+	}}))
+	assert(t, out.String() == `Package: hello
+Version: 2.10-3
+Depends: libc6 (>= 2.34), debconf
+
+Package: hello-doc
+Version: 2.10-3
+`)
+}
+
+// vim: foldmethod=marker
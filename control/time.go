@@ -0,0 +1,59 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control // import "pault.ag/go/debian/control"
+
+import (
+	"reflect"
+	"time"
+
+	"pault.ag/go/debian/internal"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Parse an RFC 2822 style date, as found in Date and Valid-Until fields
+// and changelog trailer lines, such as "Sat, 10 Oct 2026 12:00:00 +0000".
+//
+// Real world dates go wrong in all sorts of ways, so this is forgiving
+// about the things that don't change the meaning: the day of the week
+// (which may be missing, or wrong) and the case of names are ignored, as
+// are a trailing comment like "(UTC)" and extra whitespace. Full month
+// names, two digit years (00-49 being 20xx, as RFC 2822 says), times
+// without seconds, "+01:00" style offsets and common zone names (such as "CEST";
+// RFC 2822 says an unknown one means "-0000", so they're taken as UTC)
+// are all understood.
+func ParseDate(value string) (time.Time, error) {
+	return internal.ParseDate(value)
+}
+
+// Dates in UTC are written out the way the archive does it ("UTC"), and
+// everything else gets the numeric zone, like dpkg.
+func formatDate(when time.Time) string {
+	if when.IsZero() {
+		return ""
+	}
+	if when.Location() == time.UTC {
+		return when.Format("Mon, 02 Jan 2006 15:04:05 UTC")
+	}
+	return when.Format(time.RFC1123Z)
+}
+
+// vim: foldmethod=marker
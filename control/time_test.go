@@ -0,0 +1,73 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"pault.ag/go/debian/control"
+)
+
+/*
+ *
+ */
+
+func TestParseDate(t *testing.T) {
+	for input, want := range map[string]string{
+		"Sat, 22 Jul 2023 09:30:21 UTC":            "2023-07-22T09:30:21Z",
+		"Sat, 22 Jul 2023 09:30:21 +0000":          "2023-07-22T09:30:21Z",
+		"Sat,  2 Jul 2023 09:30:21 -0400":          "2023-07-02T09:30:21-04:00",
+		"Mon, 2 Jan 2006 15:04:05 MST":             "2006-01-02T15:04:05-07:00",
+		"Tue, 14 Jun 05 21:37:01 +0200":            "2005-06-14T21:37:01+02:00",
+		"Fri, 01 Jan 99 00:00:00 GMT":              "1999-01-01T00:00:00Z",
+		"Thur, 3 Feb 2000 10:00:00 CET":            "2000-02-03T10:00:00+01:00",
+		"Wed, 29 Apr 2015 21:29:13 -0400 (EDT)":    "2015-04-29T21:29:13-04:00",
+		"29 April 2015 21:29 +02:00":               "2015-04-29T21:29:00+02:00",
+		"Mon 10 oct 2016 10:00:00 +0100":           "2016-10-10T10:00:00+01:00",
+		"Sat, 22 Jul 2023 09:30:21 XYZ":            "2023-07-22T09:30:21Z",
+		"Sat, 22 Jul 2023 09:30:21":                "2023-07-22T09:30:21Z",
+		"Sun, 31 Sep 2023 09:30:21 +0000":          "",
+		"Sat, 22 Jul 2023 25:30:21 +0000":          "",
+		"Sat, 22 Jul 2023 09:30:21 +0000 trailing": "",
+		"yesterday": "",
+		"":          "",
+	} {
+		when, err := control.ParseDate(input)
+		if want == "" {
+			notok(t, err)
+			continue
+		}
+		isok(t, err)
+		if when.Format(time.RFC3339) != want {
+			t.Errorf("%q: got %s, want %s", input, when.Format(time.RFC3339), want)
+		}
+	}
+}
+
+func TestDecodeOldDate(t *testing.T) {
+	release := control.Release{}
+	isok(t, control.Unmarshal(&release, strings.NewReader("Suite: woody\nDate: Sat, 17 Jul 04 10:22:53 UTC\n")))
+	assert(t, release.Date.Equal(time.Date(2004, 7, 17, 10, 22, 53, 0, time.UTC)))
+}
+
+// vim: foldmethod=marker
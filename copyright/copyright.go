@@ -0,0 +1,307 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package copyright // import "pault.ag/go/debian/copyright"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"pault.ag/go/debian/control"
+)
+
+// License {{{
+
+// A License is the value of a `License` field. The first line is the short
+// name of the license (or an expression such as `GPL-2+ or Artistic`), and
+// any following lines are the full license text.
+type License struct {
+	Name string `control:"-"`
+	Text string `control:"-"`
+}
+
+func (l *License) UnmarshalControl(data string) error {
+	name, text, _ := strings.Cut(data, "\n")
+	l.Name = strings.TrimSpace(name)
+	l.Text = strings.TrimRight(text, "\n")
+	return nil
+}
+
+func (l License) MarshalControl() (string, error) {
+	if l.Text == "" {
+		return l.Name, nil
+	}
+	return l.Name + "\n" + l.Text, nil
+}
+
+// }}}
+
+// Paragraphs {{{
+
+// The Header is the first paragraph of the copyright file, and describes
+// the upstream work as a whole.
+type Header struct {
+	control.Paragraph
+
+	Format          string
+	UpstreamName    string `control:"Upstream-Name"`
+	UpstreamContact string `control:"Upstream-Contact"`
+	Source          string
+	Disclaimer      string
+	Comment         string
+	License         License
+	Copyright       string
+
+	// Paths that were removed from the upstream tarball when it was
+	// repacked, as DEP-5 wildcards.
+	FilesExcluded []string `control:"-"`
+
+	excluded []*regexp.Regexp
+}
+
+// Compile the FilesExcluded patterns for Excluded to match against. Parse
+// does this itself; a Header built by hand, or with FilesExcluded changed
+// after parsing, has to be compiled again, or Excluded won't match the
+// new patterns.
+func (h *Header) Compile() error {
+	excluded := []*regexp.Regexp{}
+	for _, glob := range h.FilesExcluded {
+		pattern, err := compileGlob(glob)
+		if err != nil {
+			return err
+		}
+		excluded = append(excluded, pattern)
+	}
+	h.excluded = excluded
+	return nil
+}
+
+// Return true if the given path (relative to the root of the source tree)
+// matches one of the Files-Excluded patterns, or is inside a directory
+// that does, as mk-origtargz(1) would remove it. See Compile.
+func (h *Header) Excluded(pathname string) bool {
+	pathname = strings.TrimPrefix(path.Clean("/"+pathname), "/")
+	for pathname != "." && pathname != "" {
+		for _, pattern := range h.excluded {
+			if pattern.MatchString(pathname) {
+				return true
+			}
+		}
+		pathname = path.Dir(pathname)
+	}
+	return false
+}
+
+// A FilesParagraph gives the copyright and license of every file matching
+// one of its Files patterns.
+type FilesParagraph struct {
+	control.Paragraph
+
+	Files     []string `control:"-"`
+	Copyright string
+	License   License
+	Comment   string
+
+	patterns []*regexp.Regexp
+}
+
+// Return true if the given path (relative to the root of the source tree)
+// matches any of the Files patterns of this paragraph.
+func (f *FilesParagraph) Matches(pathname string) bool {
+	pathname = strings.TrimPrefix(path.Clean("/"+pathname), "/")
+	for _, pattern := range f.patterns {
+		if pattern.MatchString(pathname) {
+			return true
+		}
+	}
+	return false
+}
+
+// A LicenseParagraph is a stand-alone License paragraph, which gives the
+// full text for a license named by other paragraphs.
+type LicenseParagraph struct {
+	control.Paragraph
+
+	License License
+	Comment string
+}
+
+// }}}
+
+// Copyright {{{
+
+// Copyright is an entire machine-readable `debian/copyright` file.
+type Copyright struct {
+	Header   Header
+	Files    []FilesParagraph
+	Licenses []LicenseParagraph
+}
+
+// Return the Files paragraph that applies to the given path, or nil if no
+// paragraph matches. As per DEP-5, when more than one paragraph matches,
+// the last one in the file wins.
+func (c *Copyright) FilesFor(pathname string) *FilesParagraph {
+	for i := len(c.Files) - 1; i >= 0; i-- {
+		if c.Files[i].Matches(pathname) {
+			return &c.Files[i]
+		}
+	}
+	return nil
+}
+
+// Return the License that applies to the given path. If the matching Files
+// paragraph only gives the name of the License, the full text is filled in
+// from a stand-alone License paragraph of the same name, if there is one.
+func (c *Copyright) LicenseFor(pathname string) (*License, error) {
+	files := c.FilesFor(pathname)
+	if files == nil {
+		return nil, fmt.Errorf("No Files paragraph matches '%s'", pathname)
+	}
+	license := files.License
+	if license.Text == "" {
+		if standalone := c.LicenseText(license.Name); standalone != "" {
+			license.Text = standalone
+		}
+	}
+	return &license, nil
+}
+
+// Return the full text of the named license, as found in either a
+// stand-alone License paragraph or the Header.
+func (c *Copyright) LicenseText(name string) string {
+	for _, license := range c.Licenses {
+		if license.License.Name == name {
+			return license.License.Text
+		}
+	}
+	if c.Header.License.Name == name {
+		return c.Header.License.Text
+	}
+	return ""
+}
+
+// }}}
+
+// Parsing {{{
+
+// Given a path on the filesystem, Parse the copyright file off the disk.
+func ParseFile(pathname string) (*Copyright, error) {
+	f, err := os.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Given an io.Reader, parse out a Copyright. The first paragraph must be
+// the Header, and every later paragraph must either have a Files field, or
+// be a stand-alone License paragraph.
+func Parse(reader io.Reader) (*Copyright, error) {
+	paragraphReader, err := control.NewParagraphReader(bufio.NewReader(reader))
+	if err != nil {
+		return nil, err
+	}
+	paragraphs, err := paragraphReader.All()
+	if err != nil {
+		return nil, err
+	}
+	if len(paragraphs) == 0 {
+		return nil, fmt.Errorf("No Header paragraph found")
+	}
+
+	ret := Copyright{}
+	if err := control.UnpackFromParagraph(paragraphs[0], &ret.Header); err != nil {
+		return nil, err
+	}
+	if ret.Header.Format == "" {
+		return nil, fmt.Errorf("Header paragraph is missing the Format field")
+	}
+	ret.Header.FilesExcluded = strings.Fields(paragraphs[0].Values["Files-Excluded"])
+	if err := ret.Header.Compile(); err != nil {
+		return nil, err
+	}
+
+	for _, paragraph := range paragraphs[1:] {
+		if files, ok := paragraph.Values["Files"]; ok {
+			entry := FilesParagraph{}
+			if err := control.UnpackFromParagraph(paragraph, &entry); err != nil {
+				return nil, err
+			}
+			entry.Files = strings.Fields(files)
+			for _, glob := range entry.Files {
+				pattern, err := compileGlob(glob)
+				if err != nil {
+					return nil, err
+				}
+				entry.patterns = append(entry.patterns, pattern)
+			}
+			ret.Files = append(ret.Files, entry)
+			continue
+		}
+		if _, ok := paragraph.Values["License"]; ok {
+			entry := LicenseParagraph{}
+			if err := control.UnpackFromParagraph(paragraph, &entry); err != nil {
+				return nil, err
+			}
+			ret.Licenses = append(ret.Licenses, entry)
+			continue
+		}
+		return nil, fmt.Errorf("Paragraph has neither a Files nor a License field")
+	}
+
+	return &ret, nil
+}
+
+// Turn a DEP-5 wildcard into a regular expression. Only `*` (any number of
+// characters, including `/`) and `?` (any single character) are special,
+// and they, along with `\`, may be escaped with a backslash.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	expr := strings.Builder{}
+	expr.WriteString("^")
+	glob = strings.TrimPrefix(glob, "./")
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		case '\\':
+			i++
+			if i == len(glob) || strings.IndexByte(`*?\`, glob[i]) == -1 {
+				return nil, fmt.Errorf("Bad escape in Files pattern '%s'", glob)
+			}
+			expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// }}}
+
+// vim: foldmethod=marker
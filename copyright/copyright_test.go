@@ -0,0 +1,177 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package copyright_test
+
+import (
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/copyright"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// {{{ copyright file
+var copyrightFile = `Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+Upstream-Name: hello
+Upstream-Contact: bug-hello@gnu.org
+Source: https://ftp.gnu.org/gnu/hello/
+
+Files: *
+Copyright: 1992-2014 Free Software Foundation, Inc.
+License: GPL-3+
+
+Files: debian/*
+Copyright: 2015 Santiago Vila <sanvila@debian.org>
+License: GPL-3+
+
+Files: lib/*.c
+ lib/*.h
+ doc/fdl?.texi
+Copyright: 1997-2014 Free Software Foundation, Inc.
+License: LGPL-2.1+
+ This library is free software; you can redistribute it and/or modify
+ it under the terms of the GNU Lesser General Public License.
+
+Files: lib/weird\*name.c
+Copyright: 2014 Someone
+License: public-domain
+
+License: GPL-3+
+ This program is free software: you can redistribute it and/or modify
+ it under the terms of the GNU General Public License.
+ .
+ On Debian systems, see /usr/share/common-licenses/GPL-3.
+`
+
+// }}}
+
+func TestCopyrightParse(t *testing.T) {
+	c, err := copyright.Parse(strings.NewReader(copyrightFile))
+	isok(t, err)
+	assert(t, c.Header.UpstreamName == "hello")
+	assert(t, len(c.Files) == 4)
+	assert(t, len(c.Files[2].Files) == 3)
+	assert(t, c.Files[2].License.Name == "LGPL-2.1+")
+	assert(t, len(c.Licenses) == 1)
+	assert(t, c.Licenses[0].License.Name == "GPL-3+")
+}
+
+func TestCopyrightLicenseFor(t *testing.T) {
+	c, err := copyright.Parse(strings.NewReader(copyrightFile))
+	isok(t, err)
+
+	for path, name := range map[string]string{
+		"src/hello.c":        "GPL-3+",
+		"debian/rules":       "GPL-3+",
+		"./lib/sub/getopt.c": "LGPL-2.1+",
+		"lib/getopt.h":       "LGPL-2.1+",
+		"lib/getopt.o":       "GPL-3+",
+		"doc/fdl1.texi":      "LGPL-2.1+",
+		"doc/fdl12.texi":     "GPL-3+",
+		"lib/weird*name.c":   "public-domain",
+		"lib/weirdxname.c":   "LGPL-2.1+",
+	} {
+		license, err := c.LicenseFor(path)
+		isok(t, err)
+		assert(t, license.Name == name)
+	}
+
+	license, err := c.LicenseFor("debian/control")
+	isok(t, err)
+	assert(t, strings.Contains(license.Text, "common-licenses/GPL-3"))
+	assert(t, strings.Contains(license.Text, "\n\nOn Debian"))
+}
+
+func TestCopyrightExcluded(t *testing.T) {
+	c, err := copyright.Parse(strings.NewReader(`Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+Files-Excluded: doc/*.pdf
+ vendor
+ */*.min.js
+
+Files: *
+Copyright: 2020 Someone
+License: MIT
+`))
+	isok(t, err)
+	assert(t, len(c.Header.FilesExcluded) == 3)
+
+	for path, excluded := range map[string]bool{
+		"doc/manual.pdf":       true,
+		"doc/manual.txt":       false,
+		"vendor":               true,
+		"vendor/lib/foo.go":    true,
+		"./vendor/bar":         true,
+		"src/vendor":           false,
+		"static/js/app.min.js": true,
+		"app.min.js":           false,
+		"src/hello.c":          false,
+	} {
+		assert(t, c.Header.Excluded(path) == excluded)
+	}
+}
+
+func TestCopyrightErrors(t *testing.T) {
+	for _, el := range []string{
+		``,
+		"Upstream-Name: hello\n",
+		"Format: 1.0\n\nCopyright: 2015 Nobody\n",
+		"Format: 1.0\n\nFiles: foo\\\nLicense: MIT\n",
+	} {
+		_, err := copyright.Parse(strings.NewReader(el))
+		notok(t, err)
+	}
+
+	c, err := copyright.Parse(strings.NewReader("Format: 1.0\n\nFiles: debian/*\nLicense: MIT\n"))
+	isok(t, err)
+	_, err = c.LicenseFor("src/main.c")
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
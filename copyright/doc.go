@@ -0,0 +1,10 @@
+/*
+Parse machine-readable `debian/copyright` files, as described by DEP-5
+(Copyright Format 1.0).
+
+A copyright file is made of a Header paragraph, followed by any number of
+Files paragraphs (which map a set of wildcard patterns to their copyright
+holders and license), and stand-alone License paragraphs (which carry the
+full text of a license referenced by name elsewhere in the file).
+*/
+package copyright // import "pault.ag/go/debian/copyright"
@@ -74,27 +74,98 @@ func LoadAr(in io.ReaderAt) (*Ar, error) {
 // Function to jump to the next file in the Debian `ar(1)` archive, and
 // return the next member.
 func (d *Ar) Next() (*ArEntry, error) {
-	line := make([]byte, 60)
-
-	count, err := d.in.ReadAt(line, d.offset)
+	entry, next, err := d.entryAt(d.offset)
 	if err != nil {
 		return nil, err
 	}
+	d.offset = next
+	return entry, nil
+}
+
+// Read the member header at the given offset, returning the ArEntry, and
+// the offset of the member after it.
+func (d *Ar) entryAt(offset int64) (*ArEntry, int64, error) {
+	line := make([]byte, 60)
+
+	count, err := d.in.ReadAt(line, offset)
 	if count == 1 && line[0] == '\n' {
-		return nil, io.EOF
+		return nil, 0, io.EOF
+	}
+	if count == 0 {
+		return nil, 0, err
 	}
 	if count != 60 {
-		return nil, fmt.Errorf("Caught a short read at the end")
+		return nil, 0, fmt.Errorf("Caught a short read at the end")
 	}
 	entry, err := parseArEntry(line)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entry.Data = io.NewSectionReader(d.in, offset+int64(count), entry.Size)
+	return entry, offset + int64(count) + entry.Size + (entry.Size % 2), nil
+}
+
+// }}}
+
+// Reset {{{
+
+// Rewind the archive, so that the next call to Next will return the first
+// member again.
+func (d *Ar) Reset() {
+	d.offset = int64(len(arMagic))
+}
+
+// }}}
+
+// Entries {{{
+
+// Return every member of the archive, in order. This doesn't change where
+// Next will pick up from.
+func (d *Ar) Entries() ([]*ArEntry, error) {
+	ret := []*ArEntry{}
+	offset := int64(len(arMagic))
+	for {
+		entry, next, err := d.entryAt(offset)
+		if err == io.EOF {
+			return ret, nil
+		} else if err != nil {
+			return nil, err
+		}
+		ret = append(ret, entry)
+		offset = next
+	}
+}
+
+// }}}
+
+// Find {{{
+
+// Return the member with the given name, no matter where in the archive it
+// is, or where Next is up to. Members are matched exactly, unless name ends
+// in a `.`, in which case the first member starting with name is returned
+// (so "data.tar." will find "data.tar.xz" or "data.tar.gz").
+func (d *Ar) Find(name string) (*ArEntry, error) {
+	entries, err := d.Entries()
 	if err != nil {
 		return nil, err
 	}
+	for _, entry := range entries {
+		if entry.Name == name || (strings.HasSuffix(name, ".") && strings.HasPrefix(entry.Name, name)) {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("No member named '%s' in the archive", name)
+}
 
-	entry.Data = io.NewSectionReader(d.in, d.offset+int64(count), entry.Size)
-	d.offset += int64(count) + entry.Size + (entry.Size % 2)
+// }}}
 
-	return entry, nil
+// CopyTo {{{
+
+// Copy the entire contents of the member to the given io.Writer, no matter
+// how much of Data has already been read.
+func (e *ArEntry) CopyTo(w io.Writer) (int64, error) {
+	return io.Copy(w, io.NewSectionReader(e.Data, 0, e.Size))
 }
 
 // }}}
@@ -112,6 +183,48 @@ func toDecimal(input []byte) (int64, error) {
 
 // }}}
 
+// ArWriter {{{
+
+// ArWriter writes out a Debian .deb flavored `ar(1)` archive, one member
+// at a time. Timestamps and owners are written as zero, so the same members
+// always make the same archive.
+type ArWriter struct {
+	out     io.Writer
+	started bool
+}
+
+// Create an ArWriter writing to the given io.Writer. Nothing is written
+// until the first member.
+func NewArWriter(out io.Writer) *ArWriter {
+	return &ArWriter{out: out}
+}
+
+// Write a member with the given name and contents to the archive.
+func (w *ArWriter) WriteEntry(name string, data []byte) error {
+	if len(name) > 16 || strings.ContainsAny(name, " /") {
+		return fmt.Errorf("Invalid ar member name: '%s'", name)
+	}
+	if !w.started {
+		if _, err := io.WriteString(w.out, arMagic); err != nil {
+			return err
+		}
+		w.started = true
+	}
+	if _, err := fmt.Fprintf(w.out, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", name, 0, 0, 0, "100644", len(data)); err != nil {
+		return err
+	}
+	if _, err := w.out.Write(data); err != nil {
+		return err
+	}
+	if len(data)%2 == 1 {
+		_, err := io.WriteString(w.out, "\n")
+		return err
+	}
+	return nil
+}
+
+// }}}
+
 // AR Format Hackery {{{
 
 // parseArEntry {{{
@@ -164,14 +277,16 @@ func parseArEntry(line []byte) (*ArEntry, error) {
 
 // checkAr {{{
 
+const arMagic = "!<arch>\n"
+
 // Given a brand spank'n new os.File entry, go ahead and make sure it looks
 // like an `ar(1)` archive, and not some random file.
 func checkAr(reader io.ReaderAt) (int64, error) {
-	header := make([]byte, 8)
+	header := make([]byte, len(arMagic))
 	if _, err := reader.ReadAt(header, 0); err != nil {
 		return 0, err
 	}
-	if string(header) != "!<arch>\n" {
+	if string(header) != arMagic {
 		return 0, fmt.Errorf("Header doesn't look right!")
 	}
 	return int64(len(header)), nil
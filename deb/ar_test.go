@@ -1,6 +1,7 @@
 package deb_test
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
 	"log"
@@ -77,3 +78,73 @@ func TestAr(t *testing.T) {
 	isok(t, err)
 	assert(t, string(firstContent) == string(firstRereadContent))
 }
+
+func TestArRandomAccess(t *testing.T) {
+	file, err := os.Open("testdata/multi_archive.a")
+	isok(t, err)
+
+	ar, err := deb.LoadAr(file)
+	isok(t, err)
+
+	entries, err := ar.Entries()
+	isok(t, err)
+	assert(t, len(entries) == 2)
+	assert(t, entries[1].Name == "lamp.txt")
+
+	// Read through to the end, then go back for the first member.
+	for {
+		if _, err := ar.Next(); err != nil {
+			assert(t, err == io.EOF)
+			break
+		}
+	}
+	entry, err := ar.Find("hello.txt")
+	isok(t, err)
+	out := bytes.Buffer{}
+	n, err := entry.CopyTo(&out)
+	isok(t, err)
+	assert(t, n == entry.Size)
+	assert(t, out.String() == "Hello world!\n")
+
+	// CopyTo always copies the whole member, even if Data was read from.
+	_, err = entry.Data.Seek(3, io.SeekStart)
+	isok(t, err)
+	out.Reset()
+	_, err = entry.CopyTo(&out)
+	isok(t, err)
+	assert(t, out.String() == "Hello world!\n")
+
+	entry, err = ar.Find("lamp.")
+	isok(t, err)
+	assert(t, entry.Name == "lamp.txt")
+
+	_, err = ar.Find("missing.txt")
+	notok(t, err)
+
+	ar.Reset()
+	entry, err = ar.Next()
+	isok(t, err)
+	assert(t, entry.Name == "hello.txt")
+}
+
+func TestArWriter(t *testing.T) {
+	out := bytes.Buffer{}
+	writer := deb.NewArWriter(&out)
+	isok(t, writer.WriteEntry("debian-binary", []byte("2.0\n")))
+	isok(t, writer.WriteEntry("odd", []byte("abc")))
+	isok(t, writer.WriteEntry("empty", nil))
+	notok(t, writer.WriteEntry("a-name-that-is-far-too-long", nil))
+
+	ar, err := deb.LoadAr(bytes.NewReader(out.Bytes()))
+	isok(t, err)
+	entries, err := ar.Entries()
+	isok(t, err)
+	assert(t, len(entries) == 3)
+	assert(t, entries[1].Name == "odd")
+	assert(t, entries[1].Size == 3)
+	data := bytes.Buffer{}
+	_, err = entries[1].CopyTo(&data)
+	isok(t, err)
+	assert(t, data.String() == "abc")
+	assert(t, entries[2].Size == 0)
+}
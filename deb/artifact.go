@@ -0,0 +1,168 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Artifact {{{
+
+var _ control.Artifact = &Deb{}
+
+func (deb *Deb) GetName() string {
+	return deb.Control.Package
+}
+
+func (deb *Deb) GetVersion() version.Version {
+	return deb.Control.Version
+}
+
+func (deb *Deb) GetArchitectures() []dependency.Arch {
+	return []dependency.Arch{deb.Control.Architecture}
+}
+
+// Return the files listed in md5sums, sorted by path. md5sums doesn't say
+// how big each file is, so Size is always -1.
+func (deb *Deb) GetFiles() ([]control.FileHash, error) {
+	sums, err := deb.MD5Sums()
+	if err != nil {
+		return nil, err
+	}
+	ret := []control.FileHash{}
+	for pathname, hash := range sums {
+		ret = append(ret, control.FileHash{
+			Algorithm: "md5",
+			Hash:      hash,
+			Size:      -1,
+			Filename:  pathname,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Filename < ret[j].Filename })
+	return ret, nil
+}
+
+// Check the data member against md5sums, as VerifyChecksums does. Files
+// that md5sums doesn't list are not an error here.
+func (deb *Deb) VerifyFiles() error {
+	report, err := deb.VerifyChecksums(false)
+	if err != nil {
+		return err
+	}
+	problems := []string{}
+	for _, mismatch := range report.Mismatched {
+		problems = append(problems, mismatch.Path+" doesn't match md5sums")
+	}
+	for _, missing := range report.Missing {
+		problems = append(problems, missing+" is missing")
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("%s: %s", deb.Control.Package, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// The ar member debsigs(1) keeps an "origin" signature in.
+const originSignatureMember = "_gpgorigin"
+
+// Sign the .deb at deb.Path the way debsigs(1) does: a detached signature
+// over the debian-binary, control and data members (one after the other)
+// is stored in the _gpgorigin member. Any other signature members are
+// kept. The .deb is rewritten in place, and this Deb should not be read
+// from afterwards; Load it again instead.
+func (deb *Deb) SignFile(signer *openpgp.Entity) error {
+	if deb.Path == "" {
+		return fmt.Errorf("Can't sign a .deb with no Path")
+	}
+
+	names := []string{"debian-binary", "control." + deb.ControlExt, "data." + deb.DataExt}
+	members := map[string][]byte{}
+	for _, name := range names {
+		member, ok := deb.ArContent[name]
+		if !ok {
+			return fmt.Errorf("Missing .deb member '%s'", name)
+		}
+		data, err := io.ReadAll(io.NewSectionReader(member.Data, 0, member.Size))
+		if err != nil {
+			return err
+		}
+		members[name] = data
+	}
+
+	signed := bytes.Buffer{}
+	for _, name := range names {
+		signed.Write(members[name])
+	}
+	signature := bytes.Buffer{}
+	if err := openpgp.DetachSign(&signature, signer, &signed, nil); err != nil {
+		return err
+	}
+
+	/* Any other signatures (such as _gpgmaint) stay where they were */
+	others := []string{}
+	for name, member := range deb.ArContent {
+		if strings.HasPrefix(name, "_gpg") && name != originSignatureMember {
+			data, err := io.ReadAll(io.NewSectionReader(member.Data, 0, member.Size))
+			if err != nil {
+				return err
+			}
+			members[name] = data
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+	names = append(names, originSignatureMember)
+	members[originSignatureMember] = signature.Bytes()
+
+	out := bytes.Buffer{}
+	writer := NewArWriter(&out)
+	for _, name := range names {
+		if err := writer.WriteEntry(name, members[name]); err != nil {
+			return err
+		}
+	}
+
+	info, err := os.Stat(deb.Path)
+	if err != nil {
+		return err
+	}
+	tmp := deb.Path + ".new"
+	if err := os.WriteFile(tmp, out.Bytes(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, deb.Path)
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,166 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"pault.ag/go/debian/control"
+)
+
+// LoadControl {{{
+
+// ControlOptions are the knobs on LoadControlWith and ReadControl.
+type ControlOptions struct {
+	// Don't read the md5sums file. Since dpkg-deb puts it after the
+	// control file, this means reading stops as soon as the control file
+	// has been decoded.
+	SkipMD5Sums bool
+}
+
+// ControlInfo is what ReadControl reads out of a .deb's control member.
+type ControlInfo struct {
+	Control Control
+
+	// The extension of the control member, such as "tar.xz".
+	ControlExt string
+
+	// The package's md5sums, as returned by Deb.MD5Sums, or nil if they
+	// were skipped, or the .deb doesn't have any.
+	MD5Sums map[string]string
+}
+
+// Read just the Control of the .deb at pathname, without reading (or even
+// starting to decompress) the data member, or anything in the control
+// member after the control file. This is a lot less I/O than LoadFile,
+// for when all that's wanted is the Control, such as when indexing a pile
+// of .debs.
+func LoadControl(pathname string) (*Control, error) {
+	info, err := LoadControlWith(pathname, ControlOptions{SkipMD5Sums: true})
+	if err != nil {
+		return nil, err
+	}
+	return &info.Control, nil
+}
+
+// Read the control member of the .deb at pathname, as ReadControl does.
+func LoadControlWith(pathname string, opts ControlOptions) (*ControlInfo, error) {
+	fd, err := os.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	info, err := ReadControl(fd, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", pathname, err)
+	}
+	return info, nil
+}
+
+// Read the control member of a .deb, and nothing after it; the ar members
+// after it (such as data.tar) aren't read at all.
+func ReadControl(in io.ReaderAt, opts ControlOptions) (*ControlInfo, error) {
+	ar, err := LoadAr(in)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := map[string]*ArEntry{}
+	var member *ArEntry
+	for member == nil {
+		entry, err := ar.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("Missing or out of order .deb member 'control'")
+		}
+		if err != nil {
+			return nil, err
+		}
+		contents[entry.Name] = entry
+		if strings.HasPrefix(entry.Name, "control.") {
+			member = entry
+		}
+	}
+	if err := checkBinaryVersion(contents); err != nil {
+		return nil, err
+	}
+	return readControlMember(member, opts)
+}
+
+// Read the control file (and, unless skipped, the md5sums file) out of
+// the control member.
+func readControlMember(member *ArEntry, opts ControlOptions) (*ControlInfo, error) {
+	archive, closer, err := member.Tarfile()
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	ret := ControlInfo{ControlExt: member.Name[8:]}
+	found := false
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch path.Clean(header.Name) {
+		case "control":
+			if err := control.Unmarshal(&ret.Control, archive); err != nil {
+				return nil, err
+			}
+			found = true
+		case "md5sums":
+			if opts.SkipMD5Sums {
+				continue
+			}
+			data, err := io.ReadAll(archive)
+			if err != nil {
+				return nil, err
+			}
+			if ret.MD5Sums, err = parseMD5Sums(data); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+
+		if found && (opts.SkipMD5Sums || ret.MD5Sums != nil) {
+			break
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("Missing or out of order .deb member 'control'")
+	}
+	return &ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,72 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+func TestLoadControl(t *testing.T) {
+	/* The data member can't even be decompressed, which doesn't matter,
+	 * since it's never read */
+	data := buildDebWith(t, ".xz", ".foo", map[string]string{
+		"md5sums": "d41d8cd98f00b204e9800998ecf8427e  usr/bin/hello\n",
+	}, nil)
+	_, err := deb.Load(bytes.NewReader(data), "hello.deb")
+	notok(t, err)
+
+	pathname := filepath.Join(t.TempDir(), "hello.deb")
+	isok(t, os.WriteFile(pathname, data, 0644))
+	debControl, err := deb.LoadControl(pathname)
+	isok(t, err)
+	assert(t, debControl.Package == "hello")
+	assert(t, debControl.Version.String() == "2.10-1")
+
+	info, err := deb.LoadControlWith(pathname, deb.ControlOptions{})
+	isok(t, err)
+	assert(t, info.Control.Package == "hello")
+	assert(t, info.ControlExt == "tar.xz")
+	assert(t, info.MD5Sums["usr/bin/hello"] == "d41d8cd98f00b204e9800998ecf8427e")
+
+	info, err = deb.ReadControl(bytes.NewReader(data), deb.ControlOptions{SkipMD5Sums: true})
+	isok(t, err)
+	assert(t, info.Control.Package == "hello")
+	assert(t, info.MD5Sums == nil)
+}
+
+func TestLoadControlBroken(t *testing.T) {
+	_, err := deb.ReadControl(bytes.NewReader([]byte("!<arch>\n")), deb.ControlOptions{})
+	notok(t, err)
+
+	_, err = deb.LoadControl(filepath.Join(t.TempDir(), "missing.deb"))
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
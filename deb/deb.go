@@ -44,28 +44,82 @@ type Control struct {
 
 	Package       string `required:"true"`
 	Source        string
-	Version       version.Version `required:"true"`
-	Architecture  dependency.Arch `required:"true"`
-	Maintainer    string          `required:"true"`
-	InstalledSize int             `control:"Installed-Size"`
-	MultiArch     string          `control:"Multi-Arch"`
+	Version       version.Version   `required:"true"`
+	Architecture  dependency.Arch   `required:"true"`
+	Maintainer    string            `required:"true"`
+	InstalledSize int               `control:"Installed-Size"`
+	MultiArch     control.MultiArch `control:"Multi-Arch"`
+	Essential     bool
+	PreDepends    dependency.Dependency `control:"Pre-Depends"`
 	Depends       dependency.Dependency
 	Recommends    dependency.Dependency
 	Suggests      dependency.Dependency
+	Enhances      dependency.Dependency
 	Breaks        dependency.Dependency
+	Conflicts     dependency.Dependency
 	Replaces      dependency.Dependency
+	Provides      dependency.Dependency
 	BuiltUsing    dependency.Dependency `control:"Built-Using"`
 	Section       string
 	Priority      string
 	Homepage      string
-	Description   string `required:"true"`
+	Tags          []string `control:"Tag" delim:"," strip:" \n\r\t"`
+
+	// The build profiles that were active when the package was built.
+	BuiltForProfiles []string `control:"Built-For-Profiles" delim:" " strip:" \n\r\t"`
+
+	Description string `control:"Description,multiline" required:"true"`
 }
 
+// Return the name of the source package the binary was built from. This
+// is the Package, unless the Source field says otherwise; any version in
+// the Source field (as there will be for a binNMU, such as "foo (1.0-1)")
+// is dropped.
 func (c Control) SourceName() string {
 	if c.Source == "" {
 		return c.Package
 	}
-	return c.Source
+	name, _, _ := strings.Cut(c.Source, "(")
+	return strings.TrimSpace(name)
+}
+
+// Return the version of the source package the binary was built from.
+// This is the binary's own Version, unless the Source field says
+// otherwise.
+func (c Control) SourceVersion() version.Version {
+	if _, number, ok := strings.Cut(c.Source, "("); ok {
+		number = strings.TrimSuffix(strings.TrimSpace(number), ")")
+		if ver, err := version.Parse(strings.TrimSpace(number)); err == nil {
+			return ver
+		}
+	}
+	return c.Version
+}
+
+// Return the first line of the Description: the short, one line summary
+// of what the package is.
+func (c Control) Synopsis() string {
+	synopsis, _, _ := strings.Cut(c.Description, "\n")
+	return strings.TrimSpace(synopsis)
+}
+
+// Return the rest of the Description after the Synopsis, with the leading
+// space of each line removed, and lines of just "." turned back into the
+// blank lines they stand for.
+func (c Control) ExtendedDescription() string {
+	_, extended, ok := strings.Cut(c.Description, "\n")
+	if !ok {
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(extended, "\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimPrefix(line, " ")
+		if line == "." {
+			line = ""
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
 }
 
 // }}}
@@ -180,21 +234,28 @@ func loadDeb(archive *Ar) (*Deb, error) {
 		}
 		contents[member.Name] = member
 	}
+	if err := checkBinaryVersion(contents); err != nil {
+		return nil, err
+	}
+	return loadDeb2(contents)
+}
+
+// Make sure the debian-binary member says this is a 2.x series .deb, the
+// only kind there is.
+func checkBinaryVersion(contents map[string]*ArEntry) error {
 	member, ok := contents["debian-binary"]
 	if !ok {
-		return nil, fmt.Errorf("Archive contains no binary version member!")
+		return fmt.Errorf("Archive contains no binary version member!")
 	}
 	reader := bufio.NewReader(member.Data)
 	version, err := reader.ReadString('\n')
 	if err != nil {
-		return nil, err
+		return err
 	}
-	switch version {
-	case "2.0\n":
-		return loadDeb2(contents)
-	default:
-		return nil, fmt.Errorf("Unknown binary version: '%s'", version)
+	if version != "2.0\n" {
+		return fmt.Errorf("Unknown binary version: '%s'", version)
 	}
+	return nil
 }
 
 // }}}
@@ -0,0 +1,498 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+// Write out a tar file with the given files in it. Scripts are made
+// executable.
+func tarball(t *testing.T, files map[string]string) []byte {
+	out := bytes.Buffer{}
+	w := tar.NewWriter(&out)
+	for name, content := range files {
+		mode := int64(0644)
+		if strings.HasPrefix(content, "#!") {
+			mode = 0755
+		}
+		isok(t, w.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: int64(len(content))}))
+		_, err := w.Write([]byte(content))
+		isok(t, err)
+	}
+	isok(t, w.Close())
+	return out.Bytes()
+}
+
+// Compress data in the format matching the extension.
+func compress(t *testing.T, ext string, data []byte) []byte {
+	out := bytes.Buffer{}
+	var w io.WriteCloser
+	switch ext {
+	case ".gz":
+		w = gzip.NewWriter(&out)
+	case ".zst":
+		var err error
+		w, err = zstd.NewWriter(&out)
+		isok(t, err)
+	case ".xz":
+		var err error
+		w, err = xz.NewWriter(&out)
+		isok(t, err)
+	default:
+		return data
+	}
+	_, err := w.Write(data)
+	isok(t, err)
+	isok(t, w.Close())
+	return out.Bytes()
+}
+
+// Build a .deb, using the given extensions for the control and data
+// members.
+func buildDeb(t *testing.T, controlExt, dataExt string) []byte {
+	return buildDebWith(t, controlExt, dataExt, nil, nil)
+}
+
+// Build a .deb with extra files (such as maintainer scripts) in the
+// control member, and the given files in the data member (or a single
+// /usr/bin/hello if nil).
+func buildDebWith(t *testing.T, controlExt, dataExt string, extra, data map[string]string) []byte {
+	controlFiles := map[string]string{
+		"./control": "Package: hello\nVersion: 2.10-1\nArchitecture: amd64\nMaintainer: Santiago Vila <sanvila@debian.org>\nDescription: example package\n",
+	}
+	for name, content := range extra {
+		controlFiles["./"+name] = content
+	}
+	if data == nil {
+		data = map[string]string{"./usr/bin/hello": "#!/bin/sh\necho hello\n"}
+	}
+
+	members := []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar" + controlExt, compress(t, controlExt, tarball(t, controlFiles))},
+		{"data.tar" + dataExt, compress(t, dataExt, tarball(t, data))},
+	}
+
+	out := bytes.Buffer{}
+	out.WriteString("!<arch>\n")
+	for _, member := range members {
+		fmt.Fprintf(&out, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, 0, 0, 0, "100644", len(member.data))
+		out.Write(member.data)
+		if len(member.data)%2 == 1 {
+			out.WriteString("\n")
+		}
+	}
+	return out.Bytes()
+}
+
+/*
+ *
+ */
+
+func TestLoadCompressions(t *testing.T) {
+	for _, exts := range [][2]string{
+		{".gz", ".gz"},
+		{".zst", ".zst"},
+		{"", ".zst"},
+		{".zst", ""},
+	} {
+		debFile, err := deb.Load(bytes.NewReader(buildDeb(t, exts[0], exts[1])), "hello.deb")
+		isok(t, err)
+		assert(t, debFile.Control.Package == "hello")
+		assert(t, debFile.DataExt == "tar"+exts[1])
+
+		header, err := debFile.Data.Next()
+		isok(t, err)
+		assert(t, header.Name == "./usr/bin/hello")
+		isok(t, debFile.Close())
+	}
+}
+
+func TestLoadUnknownCompression(t *testing.T) {
+	_, err := deb.Load(bytes.NewReader(buildDeb(t, ".gz", ".foo")), "hello.deb")
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "unknown compression format '.foo'"))
+}
+
+func TestControlFields(t *testing.T) {
+	debControl := deb.Control{}
+	isok(t, control.Unmarshal(&debControl, strings.NewReader(`Package: libhello1
+Source: hello (2.10-1)
+Version: 2.10-1+b1
+Architecture: amd64
+Maintainer: Santiago Vila <sanvila@debian.org>
+Multi-Arch: same
+Essential: yes
+Pre-Depends: libc6 (>= 2.34)
+Depends: hello-data
+Enhances: hello-extras
+Conflicts: libhello0
+Provides: libhello
+Built-For-Profiles: nocheck nodoc
+Tag: devel::library, role::shared-lib
+Description: example library
+ The GNU hello library.
+ .
+ It says hello.
+`)))
+	assert(t, debControl.SourceName() == "hello")
+	assert(t, debControl.SourceVersion().String() == "2.10-1")
+	assert(t, debControl.Essential)
+	assert(t, debControl.MultiArch == control.MultiArchSame)
+	assert(t, debControl.PreDepends.String() == "libc6 (>= 2.34)")
+	assert(t, debControl.Enhances.String() == "hello-extras")
+	assert(t, debControl.Conflicts.String() == "libhello0")
+	assert(t, debControl.Provides.String() == "libhello")
+	assert(t, len(debControl.BuiltForProfiles) == 2 && debControl.BuiltForProfiles[1] == "nodoc")
+	assert(t, len(debControl.Tags) == 2 && debControl.Tags[0] == "devel::library")
+	assert(t, debControl.Synopsis() == "example library")
+	assert(t, debControl.ExtendedDescription() == "The GNU hello library.\n\nIt says hello.")
+
+	debControl = deb.Control{}
+	isok(t, control.Unmarshal(&debControl, strings.NewReader(
+		"Package: hello\nVersion: 2.10-1\nArchitecture: amd64\nMaintainer: Santiago Vila <sanvila@debian.org>\nDescription: example package\n",
+	)))
+	assert(t, debControl.SourceName() == "hello")
+	assert(t, debControl.SourceVersion().String() == "2.10-1")
+	assert(t, !debControl.Essential)
+	assert(t, debControl.Synopsis() == "example package")
+	assert(t, debControl.ExtendedDescription() == "")
+
+	/* Tag is often folded, after any of the commas */
+	debControl = deb.Control{}
+	isok(t, control.Unmarshal(&debControl, strings.NewReader(
+		"Package: hello\nVersion: 2.10-1\nArchitecture: amd64\nMaintainer: Santiago Vila <sanvila@debian.org>\nDescription: example package\nTag: devel::library,\n role::shared-lib,implemented-in::c\n",
+	)))
+	assert(t, strings.Join(debControl.Tags, "|") == "devel::library|role::shared-lib|implemented-in::c")
+}
+
+func TestControlFiles(t *testing.T) {
+	debFile, err := deb.Load(bytes.NewReader(buildDebWith(t, ".gz", ".gz", map[string]string{
+		"postinst":  "#!/bin/sh\nset -e\nldconfig\n",
+		"preinst":   "#!/bin/sh\nexit 0\n",
+		"conffiles": "/etc/hello.conf\nremove-on-upgrade /etc/hello/old.conf\n\n",
+		"md5sums":   "0123456789abcdef0123456789abcdef  usr/bin/hello\n",
+	}, nil)), "hello.deb")
+	isok(t, err)
+	defer debFile.Close()
+
+	scripts, err := debFile.MaintainerScripts()
+	isok(t, err)
+	assert(t, len(scripts) == 2)
+	assert(t, scripts[0].Name == "preinst")
+	assert(t, scripts[1].Name == "postinst")
+	assert(t, scripts[1].Executable())
+	assert(t, strings.Contains(string(scripts[1].Data), "ldconfig"))
+
+	conffiles, err := debFile.Conffiles()
+	isok(t, err)
+	assert(t, strings.Join(conffiles, " ") == "/etc/hello.conf /etc/hello/old.conf")
+
+	sums, err := debFile.MD5Sums()
+	isok(t, err)
+	assert(t, sums["usr/bin/hello"] == "0123456789abcdef0123456789abcdef")
+
+	_, ok, err := debFile.ControlFile("prerm")
+	isok(t, err)
+	assert(t, !ok)
+
+	control, ok, err := debFile.ControlFile("control")
+	isok(t, err)
+	assert(t, ok && !control.Executable())
+
+	/* The data member is still there to be read */
+	header, err := debFile.Data.Next()
+	isok(t, err)
+	assert(t, header.Name == "./usr/bin/hello")
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	data := map[string]string{
+		"./usr/bin/hello":                "#!/bin/sh\necho hello\n",
+		"./usr/share/doc/hello/README":   "hello\n",
+		"./usr/share/doc/hello/NEWS":     "nothing new\n",
+		"./etc/hello.conf":               "greeting=hello\n",
+		"./usr/share/hello/unlisted.txt": "surprise\n",
+	}
+	md5sums := fmt.Sprintf("%x  usr/bin/hello\n%x  usr/share/doc/hello/README\n%x  usr/share/doc/hello/NEWS\n%x  usr/share/hello/gone\n",
+		md5.Sum([]byte(data["./usr/bin/hello"])),
+		md5.Sum([]byte(data["./usr/share/doc/hello/README"])),
+		md5.Sum([]byte("something else")),
+		md5.Sum([]byte("gone")))
+
+	debFile, err := deb.Load(bytes.NewReader(buildDebWith(t, ".gz", ".gz", map[string]string{
+		"md5sums":   md5sums,
+		"conffiles": "/etc/hello.conf\n",
+	}, data)), "hello.deb")
+	isok(t, err)
+	defer debFile.Close()
+
+	report, err := debFile.VerifyChecksums(true)
+	isok(t, err)
+	assert(t, !report.OK())
+	assert(t, len(report.Mismatched) == 1)
+	assert(t, report.Mismatched[0].Path == "usr/share/doc/hello/NEWS")
+	assert(t, report.Mismatched[0].Actual == fmt.Sprintf("%x", md5.Sum([]byte("nothing new\n"))))
+	assert(t, strings.Join(report.Missing, " ") == "usr/share/hello/gone")
+	assert(t, strings.Join(report.Unlisted, " ") == "usr/share/hello/unlisted.txt")
+	assert(t, report.SHA256["etc/hello.conf"] == fmt.Sprintf("%x", sha256.Sum256([]byte("greeting=hello\n"))))
+
+	/* No md5sums at all */
+	debFile, err = deb.Load(bytes.NewReader(buildDeb(t, ".gz", ".gz")), "hello.deb")
+	isok(t, err)
+	defer debFile.Close()
+	_, err = debFile.VerifyChecksums(false)
+	notok(t, err)
+}
+
+func TestVerifyChecksumsWhileReading(t *testing.T) {
+	/* Big enough that the decompressor can't have buffered all of it */
+	blob := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(blob)
+	data := map[string]string{
+		"./usr/bin/hello":        "#!/bin/sh\necho hello\n",
+		"./usr/share/hello/blob": string(blob),
+	}
+	md5sums := fmt.Sprintf("%x  usr/bin/hello\n%x  usr/share/hello/blob\n",
+		md5.Sum([]byte(data["./usr/bin/hello"])),
+		md5.Sum(blob))
+
+	debFile, err := deb.Load(bytes.NewReader(buildDebWith(t, ".gz", ".gz", map[string]string{
+		"md5sums": md5sums,
+	}, data)), "hello.deb")
+	isok(t, err)
+	defer debFile.Close()
+
+	/* Part way through deb.Data, verifying mustn't move us */
+	seen := 0
+	for seen < 1 {
+		hdr, err := debFile.Data.Next()
+		isok(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			seen++
+		}
+	}
+	report, err := debFile.VerifyChecksums(false)
+	isok(t, err)
+	assert(t, report.OK())
+	for {
+		hdr, err := debFile.Data.Next()
+		if err == io.EOF {
+			break
+		}
+		isok(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			seen++
+		}
+	}
+	assert(t, seen == 2)
+}
+
+func TestArtifact(t *testing.T) {
+	data := map[string]string{"./usr/bin/hello": "#!/bin/sh\necho hello\n"}
+	pathname := filepath.Join(t.TempDir(), "hello_2.10-1_amd64.deb")
+	isok(t, os.WriteFile(pathname, buildDebWith(t, ".gz", ".xz", map[string]string{
+		"md5sums": fmt.Sprintf("%x  usr/bin/hello\n", md5.Sum([]byte(data["./usr/bin/hello"]))),
+	}, data), 0644))
+
+	debFile, closer, err := deb.LoadFile(pathname)
+	isok(t, err)
+	var artifact control.Artifact = debFile
+	assert(t, artifact.GetName() == "hello")
+	assert(t, artifact.GetVersion().String() == "2.10-1")
+	assert(t, artifact.GetArchitectures()[0].String() == "amd64")
+	files, err := artifact.GetFiles()
+	isok(t, err)
+	assert(t, len(files) == 1 && files[0].Filename == "usr/bin/hello")
+	isok(t, artifact.VerifyFiles())
+
+	signer, err := openpgp.NewEntity("Test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	isok(t, err)
+	isok(t, debFile.SignFile(signer))
+	isok(t, closer())
+
+	/* The signed .deb still loads, and the signature covers the members */
+	raw, err := os.ReadFile(pathname)
+	isok(t, err)
+	debFile, err = deb.Load(bytes.NewReader(raw), pathname)
+	isok(t, err)
+	defer debFile.Close()
+	assert(t, debFile.Control.Package == "hello")
+	isok(t, debFile.VerifyFiles())
+
+	signed := bytes.Buffer{}
+	for _, name := range []string{"debian-binary", "control.tar.gz", "data.tar.xz"} {
+		member := debFile.ArContent[name]
+		_, err := io.Copy(&signed, io.NewSectionReader(member.Data, 0, member.Size))
+		isok(t, err)
+	}
+	signer2, err := openpgp.CheckDetachedSignature(openpgp.EntityList{signer}, &signed, debFile.ArContent["_gpgorigin"].Data)
+	isok(t, err)
+	assert(t, signer2.PrimaryKey.KeyId == signer.PrimaryKey.KeyId)
+}
+
+func TestAnalyze(t *testing.T) {
+	data := tarball(t, map[string]string{
+		"./usr/bin/foo":                            "\x7fELF" + strings.Repeat("\x00", 1000),
+		"./usr/bin/foo-helper":                     "#!/usr/bin/env python3\nprint('hi')\n",
+		"./usr/lib/foo/hook":                       "#! /bin/sh -e\nexit 0\n",
+		"./usr/share/doc/foo/copyright":            "Do what you like",
+		"./usr/share/man/man1/foo.1.gz":            "not really gzip",
+		"./usr/share/locale/de/LC_MESSAGES/foo.mo": "Hallo",
+		"./usr/share/foo/data.bin":                 "data",
+	})
+
+	stats, err := deb.Analyze(tar.NewReader(bytes.NewReader(data)))
+	isok(t, err)
+	assert(t, stats.Total.Count == 7)
+	assert(t, stats.Types[deb.ELFFile].Size == 1004)
+	assert(t, stats.Types[deb.ScriptFile].Count == 2)
+	assert(t, stats.Types[deb.DocumentationFile].Count == 2)
+	assert(t, stats.Types[deb.LocaleFile].Count == 1)
+	assert(t, stats.Types[deb.OtherFile].Count == 1)
+	assert(t, stats.Interpreters["python3"].Count == 1)
+	assert(t, stats.Interpreters["sh"].Count == 1)
+
+	largest := stats.Largest(2)
+	assert(t, len(largest) == 2)
+	assert(t, largest[0].Path == "./usr/bin/foo")
+	assert(t, largest[0].Type.String() == "elf")
+	assert(t, len(stats.Largest(-1)) == 0)
+	assert(t, len(stats.Largest(len(stats.Files)+10)) == len(stats.Files))
+}
+
+func TestELFFiles(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs the test binary to be an ELF file")
+	}
+	self, err := os.Executable()
+	isok(t, err)
+	binary, err := os.ReadFile(self)
+	isok(t, err)
+
+	data := tarball(t, map[string]string{
+		"./usr/bin/test":   string(binary),
+		"./usr/bin/script": "#!/bin/sh\n",
+		"./usr/lib/broken": "\x7fELF but not really",
+	})
+
+	files, err := deb.ELFFiles(tar.NewReader(bytes.NewReader(data)))
+	isok(t, err)
+	assert(t, len(files) == 1)
+	assert(t, files[0].Path == "./usr/bin/test")
+	assert(t, files[0].Type == elf.ET_EXEC || files[0].Type == elf.ET_DYN)
+	assert(t, files[0].SONAME == "")
+
+	/* Whatever the toolchain did, it should match reading it directly */
+	f, err := elf.Open(self)
+	isok(t, err)
+	defer f.Close()
+	assert(t, files[0].Stripped == (f.Section(".symtab") == nil))
+	assert(t, (files[0].BuildID != "") == (f.Section(".note.gnu.build-id") != nil))
+}
+
+// Build a little-endian ELF64 object with nothing in it but a
+// .note.gnu.build-id section holding note.
+func elfWithNote(t *testing.T, note []byte) []byte {
+	shstrtab := []byte("\x00.note.gnu.build-id\x00.shstrtab\x00")
+	noteOff := uint64(64)
+	strOff := noteOff + uint64(len(note))
+	shOff := strOff + uint64(len(shstrtab))
+
+	out := bytes.Buffer{}
+	header := elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     shOff,
+		Ehsize:    64,
+		Shentsize: 64,
+		Shnum:     3,
+		Shstrndx:  2,
+	}
+	copy(header.Ident[:], "\x7fELF")
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	isok(t, binary.Write(&out, binary.LittleEndian, header))
+	out.Write(note)
+	out.Write(shstrtab)
+	for _, section := range []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_NOTE), Off: noteOff, Size: uint64(len(note)), Addralign: 4},
+		{Name: 20, Type: uint32(elf.SHT_STRTAB), Off: strOff, Size: uint64(len(shstrtab)), Addralign: 1},
+	} {
+		isok(t, binary.Write(&out, binary.LittleEndian, section))
+	}
+	return out.Bytes()
+}
+
+func TestELFBuildID(t *testing.T) {
+	note := func(namesz, descsz uint32, rest string) []byte {
+		out := bytes.Buffer{}
+		binary.Write(&out, binary.LittleEndian, []uint32{namesz, descsz, 3})
+		out.WriteString(rest)
+		return out.Bytes()
+	}
+
+	info, err := deb.ReadELF("good", bytes.NewReader(elfWithNote(t, note(4, 4, "GNU\x00\xde\xad\xbe\xef"))))
+	isok(t, err)
+	assert(t, info.BuildID == "deadbeef")
+
+	/* Sizes that would wrap around if padded in 32 bits */
+	for _, sizes := range [][2]uint32{{0xffffffff, 4}, {4, 0xfffffffe}, {0xfffffffd, 0xfffffffd}} {
+		info, err := deb.ReadELF("bad", bytes.NewReader(elfWithNote(t, note(sizes[0], sizes[1], "GNU\x00\xde\xad\xbe\xef"))))
+		isok(t, err)
+		assert(t, info.BuildID == "")
+	}
+}
+
+// vim: foldmethod=marker
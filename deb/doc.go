@@ -36,5 +36,15 @@ Here's a trivial example, which will print out the Package name for a
 		log.Printf("Package: %s\n", debFile.Control.Package)
 	}
 
+The data member can be walked with ReadTarEntries, which hands back each
+file as a TarEntry, with everything an installer needs to recreate it:
+symlink and hardlink targets, device numbers, setuid bits and extended
+attributes. A TarWriter writes TarEntries back out as a data.tar.
+
+Deb.Lint checks a .deb for the more common structural problems lintian
+would flag, such as missing control fields, maintainer scripts without a
+#! line, absolute symlinks or files in /usr/local, returning them as
+Findings with a Severity. It reads the data member to do so.
+
 */
 package deb // import "pault.ag/go/debian/deb"
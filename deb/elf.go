@@ -0,0 +1,181 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"archive/tar"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+)
+
+// ELFInfo {{{
+
+// What we know about an ELF object shipped in a .deb, as needed to work out
+// shared library dependencies, or match a binary up with its dbgsym.
+type ELFInfo struct {
+	Path    string
+	Type    elf.Type
+	Machine elf.Machine
+	Class   elf.Class
+
+	// DT_SONAME, if this is a shared library that has one.
+	SONAME string
+	// Every DT_NEEDED entry, in order.
+	Needed []string
+	// The GNU Build-ID (from .note.gnu.build-id), as lowercase hex.
+	BuildID string
+	// Set if the symbol table has been stripped out.
+	Stripped bool
+	// Set if the object carries DWARF debug info.
+	HasDebugInfo bool
+}
+
+// Read the ELF metadata out of the object at r. The pathname is only used
+// to fill in the Path of the returned ELFInfo.
+func ReadELF(pathname string, r io.ReaderAt) (*ELFInfo, error) {
+	file, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info := ELFInfo{
+		Path:    pathname,
+		Type:    file.Type,
+		Machine: file.Machine,
+		Class:   file.Class,
+		Needed:  []string{},
+	}
+
+	/* Objects without a dynamic section (static binaries, .o files)
+	 * have neither of these, which isn't an error. */
+	if sonames, err := file.DynString(elf.DT_SONAME); err == nil && len(sonames) > 0 {
+		info.SONAME = sonames[0]
+	}
+	if needed, err := file.DynString(elf.DT_NEEDED); err == nil {
+		info.Needed = append(info.Needed, needed...)
+	}
+
+	info.Stripped = file.Section(".symtab") == nil
+	info.HasDebugInfo = file.Section(".debug_info") != nil
+
+	if section := file.Section(".note.gnu.build-id"); section != nil {
+		data, err := section.Data()
+		if err != nil {
+			return nil, err
+		}
+		info.BuildID = buildID(data, file.ByteOrder)
+	}
+
+	return &info, nil
+}
+
+// Pull the Build-ID out of the contents of a .note.gnu.build-id section,
+// which is a list of notes, each laid out as namesz, descsz and type,
+// followed by the name and the descriptor, each padded out to 4 bytes.
+func buildID(data []byte, order binary.ByteOrder) string {
+	const ntGNUBuildID = 3
+	/* Sizes come straight from the file, so do the sums in 64 bits, where
+	 * two padded uint32s can't overflow, and check before slicing. */
+	align := func(n uint32) uint64 { return (uint64(n) + 3) &^ 3 }
+
+	for len(data) >= 12 {
+		namesz := order.Uint32(data[0:4])
+		descsz := order.Uint32(data[4:8])
+		noteType := order.Uint32(data[8:12])
+		data = data[12:]
+
+		if align(namesz)+align(descsz) > uint64(len(data)) {
+			return ""
+		}
+		name := data[:namesz]
+		desc := data[align(namesz) : align(namesz)+uint64(descsz)]
+		data = data[align(namesz)+align(descsz):]
+
+		if noteType == ntGNUBuildID && string(name) == "GNU\x00" {
+			return hex.EncodeToString(desc)
+		}
+	}
+	return ""
+}
+
+// }}}
+
+// ELFFiles {{{
+
+// Walk the tar stream, and read the ELF metadata of every regular file
+// that starts with the ELF magic. debug/elf needs random access, so each
+// ELF file is read into memory in turn; everything else is skipped over.
+func ELFFiles(data *tar.Reader) ([]ELFInfo, error) {
+	ret := []ELFInfo{}
+	magic := make([]byte, len(elfMagic))
+
+	for {
+		hdr, err := data.Next()
+		if err == io.EOF {
+			return ret, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		if _, err := io.ReadFull(data, magic); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				continue
+			}
+			return nil, err
+		}
+		if !bytes.Equal(magic, elfMagic) {
+			continue
+		}
+
+		/* hdr.Size is whatever the tar header claims; let the buffer
+		 * grow with what is actually there instead. */
+		contents := bytes.Buffer{}
+		contents.Write(magic)
+		if _, err := io.Copy(&contents, data); err != nil {
+			return nil, err
+		}
+
+		info, err := ReadELF(hdr.Name, bytes.NewReader(contents.Bytes()))
+		if err != nil {
+			/* Something with the magic, but not a valid ELF file;
+			 * that's not our problem to report. */
+			continue
+		}
+		ret = append(ret, *info)
+	}
+}
+
+// Read the ELF metadata of every ELF object in the data member of the
+// .deb. Like Stats, this consumes deb.Data.
+func (deb *Deb) ELFFiles() ([]ELFInfo, error) {
+	return ELFFiles(deb.Data)
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,341 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Finding {{{
+
+// Severity of a Finding. An Error is a policy violation that will cause
+// trouble (or get the package rejected); a Warning is something that
+// likely will; Info is merely worth knowing about.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	}
+	return "info"
+}
+
+// A Finding is a structural problem with a .deb, of the sort lintian
+// would flag.
+type Finding struct {
+	Severity Severity
+	// Short, stable name of the check, such as "dir-or-file-in-usr-local",
+	// named after the matching lintian tag where there is one.
+	Tag string
+	// The file (in the data member, or a control member such as
+	// "postinst") the Finding is about, if any.
+	Path    string
+	Message string
+}
+
+func (f Finding) String() string {
+	if f.Path == "" {
+		return fmt.Sprintf("%s: %s (%s)", f.Severity, f.Message, f.Tag)
+	}
+	return fmt.Sprintf("%s: %s: %s (%s)", f.Severity, f.Path, f.Message, f.Tag)
+}
+
+// }}}
+
+// Control {{{
+
+var packageName = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+
+// Fields every binary package must have (policy 5.3), and those it
+// should.
+var (
+	mandatoryFields   = []string{"Package", "Version", "Architecture", "Maintainer", "Description"}
+	recommendedFields = []string{"Section", "Priority", "Installed-Size"}
+)
+
+// Check the fields of a binary package's control file: that the mandatory
+// ones are all there, and that the package name, version, architecture and
+// maintainer are valid.
+func LintControl(para control.Paragraph) []Finding {
+	findings := []Finding{}
+	add := func(severity Severity, tag, message string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Severity: severity,
+			Tag:      tag,
+			Message:  fmt.Sprintf(message, args...),
+		})
+	}
+
+	for _, field := range mandatoryFields {
+		if strings.TrimSpace(para.Values[field]) == "" {
+			add(Error, "missing-control-field", "Missing mandatory field %s", field)
+		}
+	}
+	for _, field := range recommendedFields {
+		if strings.TrimSpace(para.Values[field]) == "" {
+			add(Warning, "recommended-field", "Missing recommended field %s", field)
+		}
+	}
+
+	if name := para.Values["Package"]; name != "" && !packageName.MatchString(name) {
+		add(Error, "bad-package-name", "Invalid package name '%s'", name)
+	}
+	if value := para.Values["Version"]; value != "" {
+		if _, err := version.Parse(value); err != nil {
+			add(Error, "bad-version-number", "Invalid version '%s': %s", value, err)
+		}
+	}
+	if value := strings.TrimSpace(para.Values["Architecture"]); value != "" {
+		arch, err := dependency.ParseArch(value)
+		switch {
+		case err != nil || strings.ContainsAny(value, " ,"):
+			add(Error, "bad-architecture", "Invalid architecture '%s'", value)
+		case arch.IsWildcard() || value == "source":
+			add(Error, "arch-wildcard-in-binary-package", "Architecture '%s' isn't a real architecture", value)
+		}
+	}
+	if value := para.Values["Maintainer"]; value != "" {
+		open, at, close := strings.Index(value, "<"), strings.LastIndex(value, "@"), strings.LastIndex(value, ">")
+		if open <= 0 || at < open || close < at || close != len(strings.TrimSpace(value))-1 {
+			add(Error, "malformed-maintainer-field", "Maintainer '%s' isn't 'Name <address>'", value)
+		}
+	}
+	if schema, ok := control.SchemaFor("packages"); ok {
+		for _, field := range para.Order {
+			if schema.Known(field) {
+				continue
+			}
+			/* A likely typo is worth a warning; anything else is probably
+			 * just a field we don't know about */
+			if suggestion, ok := schema.Suggest(field); ok {
+				add(Warning, "unknown-field", "Unknown field '%s' (did you mean '%s'?)", field, suggestion)
+			} else {
+				add(Info, "unknown-field", "Unknown field '%s'", field)
+			}
+		}
+	}
+	return findings
+}
+
+// Check the members of the control tarball: that maintainer scripts start
+// with a #! line (or are ELF binaries), and are executable, and that
+// nothing else is.
+func LintControlFiles(files map[string]ControlFile) []Finding {
+	findings := []Finding{}
+	scripts := map[string]bool{}
+	for _, name := range MaintainerScripts {
+		scripts[name] = true
+		file, ok := files[name]
+		if !ok {
+			continue
+		}
+		if !bytes.HasPrefix(file.Data, []byte("#!")) && !bytes.HasPrefix(file.Data, []byte("\x7fELF")) {
+			findings = append(findings, Finding{
+				Severity: Error,
+				Tag:      "maintainer-script-lacks-shebang",
+				Path:     name,
+				Message:  "Maintainer script doesn't start with #!",
+			})
+		}
+		if !file.Executable() {
+			findings = append(findings, Finding{
+				Severity: Error,
+				Tag:      "control-file-has-bad-permissions",
+				Path:     name,
+				Message:  fmt.Sprintf("Maintainer script isn't executable (%04o)", file.Mode.Perm()),
+			})
+		}
+	}
+	for _, name := range sortedControlFiles(files) {
+		if file := files[name]; !scripts[name] && file.Executable() {
+			findings = append(findings, Finding{
+				Severity: Warning,
+				Tag:      "control-file-has-bad-permissions",
+				Path:     name,
+				Message:  fmt.Sprintf("Control file is executable (%04o)", file.Mode.Perm()),
+			})
+		}
+	}
+	return findings
+}
+
+func sortedControlFiles(files map[string]ControlFile) []string {
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// }}}
+
+// Data {{{
+
+// Top level directories (or directories within /usr and /var) that
+// packages mustn't ship anything in (policy 9.1).
+var forbiddenDirs = []string{"usr/local", "opt", "home", "tmp", "var/tmp", "srv", "mnt"}
+
+// The first directory a path is in, such as "usr" for "usr/bin/foo".
+func topLevel(pathname string) string {
+	return strings.SplitN(strings.TrimPrefix(pathname, "/"), "/", 2)[0]
+}
+
+// Check a single entry of the data tarball.
+func lintEntry(entry *TarEntry) []Finding {
+	findings := []Finding{}
+	add := func(severity Severity, tag, message string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Severity: severity,
+			Tag:      tag,
+			Path:     "/" + entry.Path,
+			Message:  fmt.Sprintf(message, args...),
+		})
+	}
+
+	for _, dir := range forbiddenDirs {
+		if strings.HasPrefix(entry.Path, dir+"/") {
+			add(Error, "dir-or-file-in-"+strings.ReplaceAll(dir, "/", "-"), "Packages mustn't ship anything in /%s", dir)
+		}
+	}
+
+	if entry.Type == SymlinkEntry {
+		/* Policy 10.5: relative within a top level directory, absolute
+		 * between them */
+		target := entry.LinkTarget
+		if strings.HasPrefix(target, "/") {
+			if topLevel(target) == topLevel(entry.Path) {
+				add(Warning, "symlink-should-be-relative", "Absolute symlink to %s within /%s", target, topLevel(target))
+			}
+		} else if resolved := path.Join(path.Dir(entry.Path), target); topLevel(resolved) != topLevel(entry.Path) {
+			add(Warning, "symlink-should-be-absolute", "Relative symlink to %s leaves /%s", target, topLevel(entry.Path))
+		}
+		return findings
+	}
+
+	if entry.Mode&0002 != 0 && !(entry.Type == DirectoryEntry && entry.Mode&os.ModeSticky != 0) {
+		add(Error, "world-writable-file", "World writable (%04o)", entry.Mode.Perm())
+	}
+	if entry.Type == RegularEntry && entry.Mode&(os.ModeSetuid|os.ModeSetgid) != 0 {
+		add(Warning, "setuid-or-setgid-binary", "Installed setuid or setgid")
+	}
+	/* IDs from 100 to 64999 are allocated dynamically, so differ from one
+	 * system to the next */
+	if (entry.Uid >= 100 && entry.Uid < 65000) || (entry.Gid >= 100 && entry.Gid < 65000) {
+		add(Error, "wrong-file-owner-uid-or-gid", "Owned by %d:%d", entry.Uid, entry.Gid)
+	}
+	return findings
+}
+
+// Check every entry of a data tarball, for files in places packages
+// mustn't put them (such as /usr/local), symlinks that don't follow
+// policy, and bad ownership or permissions. This reads the tarball to the
+// end. The paths of the regular files are returned too, to check conffiles
+// against.
+func LintData(data *tar.Reader) ([]Finding, map[string]bool, error) {
+	findings := []Finding{}
+	files := map[string]bool{}
+	err := ReadTarEntries(data, func(entry *TarEntry, _ io.Reader) error {
+		if entry.Type == RegularEntry {
+			files["/"+entry.Path] = true
+		}
+		findings = append(findings, lintEntry(entry)...)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return findings, files, nil
+}
+
+// }}}
+
+// Lint {{{
+
+// Check the .deb for common structural problems, in its control file, its
+// control members and its data member, and that its conffiles are all
+// files it ships. This consumes deb.Data, so it can't be read again
+// afterwards.
+func (deb *Deb) Lint() ([]Finding, error) {
+	findings := LintControl(deb.Control.Paragraph)
+
+	files, err := deb.ControlFiles()
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, LintControlFiles(files)...)
+
+	conffiles, err := deb.Conffiles()
+	if err != nil {
+		return nil, err
+	}
+
+	dataFindings, shipped, err := LintData(deb.Data)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, dataFindings...)
+
+	for _, conffile := range conffiles {
+		if !shipped[conffile] {
+			findings = append(findings, Finding{
+				Severity: Error,
+				Tag:      "conffile-is-not-in-package",
+				Path:     conffile,
+				Message:  "Listed in conffiles, but not shipped",
+			})
+		}
+		if !strings.HasPrefix(conffile, "/etc/") {
+			findings = append(findings, Finding{
+				Severity: Warning,
+				Tag:      "non-etc-file-marked-as-conffile",
+				Path:     conffile,
+				Message:  "Conffile outside /etc",
+			})
+		}
+	}
+	return findings, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
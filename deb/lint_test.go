@@ -0,0 +1,182 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+// The tags of the findings with at least the given severity, sorted, and
+// joined with spaces.
+func findingTags(findings []deb.Finding, severity deb.Severity) string {
+	tags := []string{}
+	for _, finding := range findings {
+		if finding.Severity >= severity {
+			tags = append(tags, finding.Tag)
+		}
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, " ")
+}
+
+func paragraph(t *testing.T, data string) control.Paragraph {
+	reader, err := control.NewParagraphReader(strings.NewReader(data))
+	isok(t, err)
+	para, err := reader.Next()
+	isok(t, err)
+	return *para
+}
+
+/*
+ *
+ */
+
+func TestLintControl(t *testing.T) {
+	findings := deb.LintControl(paragraph(t, `Package: hello
+Version: 2.10-1
+Architecture: amd64
+Maintainer: Santiago Vila <sanvila@debian.org>
+Section: devel
+Priority: optional
+Installed-Size: 280
+Description: example package
+`))
+	assert(t, len(findings) == 0)
+
+	findings = deb.LintControl(paragraph(t, `Package: Hello_World
+Version: 2.10-1:a
+Architecture: any
+Maintainer: sanvila@debian.org
+`))
+	assert(t, findingTags(findings, deb.Error) == "arch-wildcard-in-binary-package bad-package-name bad-version-number malformed-maintainer-field missing-control-field")
+	assert(t, findingTags(findings, deb.Warning) == findingTags(findings, deb.Error)+" recommended-field recommended-field recommended-field")
+	assert(t, findings[0].String() == "error: Missing mandatory field Description (missing-control-field)")
+
+	findings = deb.LintControl(paragraph(t, `Package: hello
+Version: 2.10-1
+Architecture: amd64 i386
+Maintainer: Santiago Vila <sanvila@debian.org>
+Description: example package
+`))
+	assert(t, findingTags(findings, deb.Error) == "bad-architecture")
+
+	findings = deb.LintControl(paragraph(t, `Package: hello
+Version: 2.10-1
+Architecture: amd64
+Maintainer: Santiago Vila <sanvila@debian.org>
+Section: devel
+Priority: optional
+Installed-Size: 280
+Description: example package
+Depnds: libc6
+XB-Custom: yes
+Frobnication-Level: 11
+`))
+	assert(t, findingTags(findings, deb.Warning) == "unknown-field")
+	assert(t, findingTags(findings, deb.Info) == "unknown-field unknown-field")
+	assert(t, findings[len(findings)-2].Message == "Unknown field 'Depnds' (did you mean 'Depends'?)")
+	assert(t, findings[len(findings)-1].Message == "Unknown field 'Frobnication-Level'")
+}
+
+func TestLintControlFiles(t *testing.T) {
+	findings := deb.LintControlFiles(map[string]deb.ControlFile{
+		"postinst":  {Name: "postinst", Mode: 0755, Data: []byte("#!/bin/sh\nset -e\n")},
+		"prerm":     {Name: "prerm", Mode: 0644, Data: []byte("set -e\n")},
+		"config":    {Name: "config", Mode: 0755, Data: []byte("\x7fELF\x02\x01\x01")},
+		"conffiles": {Name: "conffiles", Mode: 0755, Data: []byte("/etc/hello.conf\n")},
+		"control":   {Name: "control", Mode: 0644, Data: []byte("Package: hello\n")},
+	})
+	assert(t, len(findings) == 3)
+	assert(t, findings[0].Path == "prerm" && findings[0].Tag == "maintainer-script-lacks-shebang")
+	assert(t, findings[1].Path == "prerm" && findings[1].Tag == "control-file-has-bad-permissions")
+	assert(t, findings[1].Severity == deb.Error)
+	assert(t, findings[2].Path == "conffiles" && findings[2].Severity == deb.Warning)
+	assert(t, findings[2].String() == "warning: conffiles: Control file is executable (0755) (control-file-has-bad-permissions)")
+}
+
+func TestLintData(t *testing.T) {
+	out := bytes.Buffer{}
+	w := deb.NewTarWriter(&out)
+	for _, entry := range []deb.TarEntry{
+		{Path: "usr/bin/hello", Type: deb.RegularEntry, Mode: 0755},
+		{Path: "usr/bin/ping", Type: deb.RegularEntry, Mode: 0755 | os.ModeSetuid},
+		{Path: "usr/bin/hi", Type: deb.SymlinkEntry, Mode: 0777, LinkTarget: "hello"},
+		{Path: "usr/bin/hey", Type: deb.SymlinkEntry, Mode: 0777, LinkTarget: "/usr/bin/hello"},
+		{Path: "usr/lib/hello/hello.conf", Type: deb.SymlinkEntry, Mode: 0777, LinkTarget: "../../../etc/hello.conf"},
+		{Path: "usr/lib/hello/data", Type: deb.SymlinkEntry, Mode: 0777, LinkTarget: "/var/lib/hello"},
+		{Path: "usr/local/bin/hello", Type: deb.RegularEntry, Mode: 0755},
+		{Path: "var/lib/hello", Type: deb.DirectoryEntry, Mode: 0777},
+		{Path: "var/spool/hello", Type: deb.DirectoryEntry, Mode: 0777 | os.ModeSticky},
+		{Path: "etc/hello.conf", Type: deb.RegularEntry, Mode: 0644, Uid: 1000, Gid: 1000},
+	} {
+		entry := entry
+		isok(t, w.WriteEntry(&entry, bytes.NewReader(nil)))
+	}
+	isok(t, w.Close())
+
+	findings, files, err := deb.LintData(tar.NewReader(&out))
+	isok(t, err)
+	assert(t, findingTags(findings, deb.Info) == "dir-or-file-in-usr-local setuid-or-setgid-binary symlink-should-be-absolute symlink-should-be-relative world-writable-file wrong-file-owner-uid-or-gid")
+	for _, finding := range findings {
+		switch finding.Tag {
+		case "symlink-should-be-relative":
+			assert(t, finding.Path == "/usr/bin/hey")
+		case "symlink-should-be-absolute":
+			assert(t, finding.Path == "/usr/lib/hello/hello.conf")
+		case "world-writable-file":
+			assert(t, finding.Path == "/var/lib/hello")
+		}
+	}
+	assert(t, files["/etc/hello.conf"] && files["/usr/bin/hello"] && !files["/usr/bin/hi"])
+}
+
+func TestLint(t *testing.T) {
+	debFile, err := deb.Load(bytes.NewReader(buildDebWith(t, ".gz", ".gz", map[string]string{
+		"postinst":  "#!/bin/sh\nset -e\n",
+		"postrm":    "set -e\n",
+		"conffiles": "/etc/hello.conf\n/usr/share/hello/hello.conf\n",
+	}, map[string]string{
+		"./usr/bin/hello":                "#!/bin/sh\necho hello\n",
+		"./usr/share/hello/hello.conf":   "greeting=hello\n",
+		"./usr/local/share/hello/README": "hello\n",
+	})), "hello.deb")
+	isok(t, err)
+	defer debFile.Close()
+
+	findings, err := debFile.Lint()
+	isok(t, err)
+	assert(t, findingTags(findings, deb.Error) == "conffile-is-not-in-package control-file-has-bad-permissions dir-or-file-in-usr-local maintainer-script-lacks-shebang")
+	assert(t, findingTags(findings, deb.Warning) == "conffile-is-not-in-package control-file-has-bad-permissions dir-or-file-in-usr-local maintainer-script-lacks-shebang non-etc-file-marked-as-conffile recommended-field recommended-field recommended-field")
+}
+
+// vim: foldmethod=marker
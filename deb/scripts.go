@@ -0,0 +1,175 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ControlFile {{{
+
+// A ControlFile is one member of the control tarball of a .deb, such as a
+// maintainer script, or the conffiles or md5sums list.
+type ControlFile struct {
+	Name string
+	Mode os.FileMode
+	Data []byte
+}
+
+// Return true if the file is executable by its owner, as maintainer scripts
+// need to be for dpkg to run them.
+func (f ControlFile) Executable() bool {
+	return f.Mode&0100 != 0
+}
+
+// The maintainer scripts dpkg knows how to run, in the order they'd appear
+// in a package's control tarball.
+var MaintainerScripts = []string{"preinst", "postinst", "prerm", "postrm", "config"}
+
+// }}}
+
+// Accessors {{{
+
+// Read every regular file out of the control tarball, keyed by its name
+// (such as "postinst", or "control" itself).
+func (deb *Deb) ControlFiles() (map[string]ControlFile, error) {
+	member, ok := deb.ArContent["control."+deb.ControlExt]
+	if !ok {
+		return nil, fmt.Errorf("Missing .deb member 'control.%s'", deb.ControlExt)
+	}
+	if _, err := member.Data.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	archive, closer, err := member.Tarfile()
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	ret := map[string]ControlFile{}
+	for {
+		hdr, err := archive.Next()
+		if err == io.EOF {
+			return ret, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(hdr.Name)
+		ret[name] = ControlFile{
+			Name: name,
+			Mode: hdr.FileInfo().Mode(),
+			Data: data,
+		}
+	}
+}
+
+// Return a single file out of the control tarball. If it's not there, the
+// bool will be false.
+func (deb *Deb) ControlFile(name string) (ControlFile, bool, error) {
+	files, err := deb.ControlFiles()
+	if err != nil {
+		return ControlFile{}, false, err
+	}
+	file, ok := files[name]
+	return file, ok, nil
+}
+
+// Return each of the package's maintainer scripts, in the order of
+// MaintainerScripts. Scripts the package doesn't have are left out.
+func (deb *Deb) MaintainerScripts() ([]ControlFile, error) {
+	files, err := deb.ControlFiles()
+	if err != nil {
+		return nil, err
+	}
+	ret := []ControlFile{}
+	for _, name := range MaintainerScripts {
+		if file, ok := files[name]; ok {
+			ret = append(ret, file)
+		}
+	}
+	return ret, nil
+}
+
+// Return the paths listed in the package's conffiles, if any. Entries
+// flagged with "remove-on-upgrade" are returned without the flag.
+func (deb *Deb) Conffiles() ([]string, error) {
+	file, ok, err := deb.ControlFile("conffiles")
+	if err != nil || !ok {
+		return nil, err
+	}
+	ret := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(file.Data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimSpace(strings.TrimPrefix(line, "remove-on-upgrade "))
+		if line == "" {
+			continue
+		}
+		ret = append(ret, line)
+	}
+	return ret, scanner.Err()
+}
+
+// Return the package's md5sums, as a map of path (relative to the root,
+// as dpkg writes them) to hex digest.
+func (deb *Deb) MD5Sums() (map[string]string, error) {
+	file, ok, err := deb.ControlFile("md5sums")
+	if err != nil || !ok {
+		return nil, err
+	}
+	return parseMD5Sums(file.Data)
+}
+
+// Parse an md5sums file: a digest and a path on each line, separated by
+// two spaces.
+func parseMD5Sums(data []byte) (map[string]string, error) {
+	ret := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "  ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Malformed md5sums line: '%s'", line)
+		}
+		ret[fields[1]] = fields[0]
+	}
+	return ret, scanner.Err()
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,213 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// FileType {{{
+
+// The broad class of a file in the data member of a .deb, as figured out
+// from its path and its first few bytes.
+type FileType int
+
+const (
+	OtherFile FileType = iota
+	ELFFile
+	ScriptFile
+	DocumentationFile
+	LocaleFile
+)
+
+func (t FileType) String() string {
+	switch t {
+	case ELFFile:
+		return "elf"
+	case ScriptFile:
+		return "script"
+	case DocumentationFile:
+		return "documentation"
+	case LocaleFile:
+		return "locale"
+	}
+	return "other"
+}
+
+var elfMagic = []byte("\x7fELF")
+
+// Work out what sort of file this is, given the path and the start of the
+// contents. For scripts, the name of the interpreter from the shebang line
+// is returned as well (looking through "/usr/bin/env").
+func classifyFile(pathname string, head []byte) (FileType, string) {
+	if bytes.HasPrefix(head, elfMagic) {
+		return ELFFile, ""
+	}
+	if bytes.HasPrefix(head, []byte("#!")) {
+		return ScriptFile, interpreter(head)
+	}
+
+	pathname = "/" + strings.TrimPrefix(path.Clean("/"+pathname), "/")
+	switch {
+	case strings.HasPrefix(pathname, "/usr/share/locale/"),
+		strings.HasPrefix(pathname, "/usr/share/locale-langpack/"),
+		strings.HasSuffix(pathname, ".mo"):
+		return LocaleFile, ""
+	case strings.HasPrefix(pathname, "/usr/share/doc/"),
+		strings.HasPrefix(pathname, "/usr/share/man/"),
+		strings.HasPrefix(pathname, "/usr/share/info/"),
+		strings.HasPrefix(pathname, "/usr/share/gtk-doc/"):
+		return DocumentationFile, ""
+	}
+	return OtherFile, ""
+}
+
+func interpreter(head []byte) string {
+	line := string(head[2:])
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	name := path.Base(fields[0])
+	if name == "env" {
+		for _, arg := range fields[1:] {
+			if !strings.HasPrefix(arg, "-") {
+				return path.Base(arg)
+			}
+		}
+	}
+	return name
+}
+
+// }}}
+
+// Stats {{{
+
+// A single file from the data member of a .deb.
+type FileEntry struct {
+	Path        string
+	Size        int64
+	Type        FileType
+	Interpreter string
+}
+
+// A count of files, and how much space they take up.
+type FileStat struct {
+	Count int
+	Size  int64
+}
+
+func (s *FileStat) add(size int64) {
+	s.Count++
+	s.Size += size
+}
+
+// Stats breaks down the (regular) files shipped in a .deb by type, in order
+// to answer questions like "why is this package so big?".
+type Stats struct {
+	Files []FileEntry
+
+	Total        FileStat
+	Types        map[FileType]FileStat
+	Interpreters map[string]FileStat
+}
+
+// Return the n largest files, biggest first. If n is negative, no files
+// are returned; if there are fewer than n, all of them are.
+func (s *Stats) Largest(n int) []FileEntry {
+	if n < 0 {
+		n = 0
+	}
+	files := make([]FileEntry, len(s.Files))
+	copy(files, s.Files)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Size > files[j].Size
+	})
+	if n < len(files) {
+		files = files[:n]
+	}
+	return files
+}
+
+// Walk the tar stream, reading only the first few bytes of each file to
+// classify it, and total up the sizes.
+func Analyze(data *tar.Reader) (*Stats, error) {
+	stats := Stats{
+		Files:        []FileEntry{},
+		Types:        map[FileType]FileStat{},
+		Interpreters: map[string]FileStat{},
+	}
+	head := make([]byte, 256)
+
+	for {
+		hdr, err := data.Next()
+		if err == io.EOF {
+			return &stats, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		n, err := io.ReadFull(data, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		fileType, interp := classifyFile(hdr.Name, head[:n])
+
+		stats.Files = append(stats.Files, FileEntry{
+			Path:        hdr.Name,
+			Size:        hdr.Size,
+			Type:        fileType,
+			Interpreter: interp,
+		})
+		stats.Total.add(hdr.Size)
+
+		typeStat := stats.Types[fileType]
+		typeStat.add(hdr.Size)
+		stats.Types[fileType] = typeStat
+
+		if fileType == ScriptFile {
+			interpStat := stats.Interpreters[interp]
+			interpStat.add(hdr.Size)
+			stats.Interpreters[interp] = interpStat
+		}
+	}
+}
+
+// Analyze the data member of the .deb. This consumes deb.Data, so it can't
+// be read again afterwards.
+func (deb *Deb) Stats() (*Stats, error) {
+	return Analyze(deb.Data)
+}
+
+// }}}
+
+// vim: foldmethod=marker
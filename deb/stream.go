@@ -0,0 +1,117 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LoadReaderAt {{{
+
+// Load a .deb from an io.ReaderAt of the given size, such as a blob in
+// object storage read with ranged requests. This is Load, for readers that
+// don't return io.EOF at the end of the .deb on their own.
+func LoadReaderAt(in io.ReaderAt, size int64, pathname string) (*Deb, error) {
+	return Load(io.NewSectionReader(in, 0, size), pathname)
+}
+
+// }}}
+
+// LoadStream {{{
+
+// The most LoadStream will hold in memory for a member before data.tar.
+const maxStreamedMember = 256 << 20
+
+// Load a .deb from an io.Reader (such as an HTTP response body), reading
+// it front to back without seeking, and without writing it anywhere.
+//
+// Everything up to the data member is read into memory, and Data reads
+// the data member straight from in, so Data has to be read (if at all)
+// before in is closed, and only once. As the data member is still being
+// read, it's not in ArContent, and nor is anything after it (such as a
+// debsigs signature). It is the caller's responsibility to call Close()
+// when done, which doesn't close in.
+func LoadStream(in io.Reader, pathname string) (*Deb, error) {
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(in, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != arMagic {
+		return nil, fmt.Errorf("Header doesn't look right!")
+	}
+
+	contents := map[string]*ArEntry{}
+	for {
+		line := make([]byte, 60)
+		if _, err := io.ReadFull(in, line); err == io.EOF {
+			return nil, fmt.Errorf("Missing or out of order .deb member 'data'")
+		} else if err != nil {
+			return nil, err
+		}
+		entry, err := parseArEntry(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(entry.Name, "data.") {
+			return loadStreamData(contents, entry, in, pathname)
+		}
+
+		if entry.Size < 0 || entry.Size > maxStreamedMember {
+			return nil, fmt.Errorf("%s: too big to read into memory (%d bytes)", entry.Name, entry.Size)
+		}
+		/* Members are padded out to an even number of bytes */
+		data := make([]byte, entry.Size+entry.Size%2)
+		if _, err := io.ReadFull(in, data); err != nil {
+			return nil, fmt.Errorf("%s: %s", entry.Name, err)
+		}
+		entry.Data = io.NewSectionReader(bytes.NewReader(data), 0, entry.Size)
+		contents[entry.Name] = entry
+	}
+}
+
+// Having read everything before the data member into contents, load the
+// control file, and set Data up to read the data member from in.
+func loadStreamData(contents map[string]*ArEntry, data *ArEntry, in io.Reader, pathname string) (*Deb, error) {
+	if err := checkBinaryVersion(contents); err != nil {
+		return nil, err
+	}
+	deb := Deb{ArContent: contents, Path: pathname}
+	if err := loadDeb2Control(contents, &deb); err != nil {
+		return nil, err
+	}
+
+	archive, closer, err := openTarfile(data.Name, io.LimitReader(in, data.Size))
+	if err != nil {
+		return nil, err
+	}
+	deb.DataExt = data.Name[5:]
+	deb.Data = archive
+	deb.Closer = closer
+	return &deb, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,88 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+func TestLoadStream(t *testing.T) {
+	for _, exts := range [][2]string{
+		{".gz", ".xz"},
+		{"", ""},
+	} {
+		data := buildDebWith(t, exts[0], exts[1], map[string]string{"postinst": "#!/bin/sh\n"}, nil)
+
+		/* MultiReader hides bytes.Reader's ReadAt, so this is a stream */
+		debFile, err := deb.LoadStream(io.MultiReader(bytes.NewReader(data)), "hello.deb")
+		isok(t, err)
+		assert(t, debFile.Control.Package == "hello")
+		assert(t, debFile.Path == "hello.deb")
+		assert(t, debFile.DataExt == "tar"+exts[1])
+		_, ok := debFile.ArContent["control.tar"+exts[0]]
+		assert(t, ok)
+		_, ok = debFile.ArContent["data.tar"+exts[1]]
+		assert(t, !ok)
+
+		scripts, err := debFile.MaintainerScripts()
+		isok(t, err)
+		assert(t, len(scripts) == 1)
+
+		header, err := debFile.Data.Next()
+		isok(t, err)
+		assert(t, header.Name == "./usr/bin/hello")
+		contents, err := io.ReadAll(debFile.Data)
+		isok(t, err)
+		assert(t, string(contents) == "#!/bin/sh\necho hello\n")
+		isok(t, debFile.Close())
+	}
+
+	data := buildDeb(t, ".gz", ".gz")
+	_, err := deb.LoadStream(bytes.NewReader(data[:100]), "hello.deb")
+	notok(t, err)
+	_, err = deb.LoadStream(bytes.NewReader([]byte("!<arch>\n")), "hello.deb")
+	notok(t, err)
+	_, err = deb.LoadStream(bytes.NewReader([]byte("PK\x03\x04 not a deb")), "hello.deb")
+	notok(t, err)
+}
+
+func TestLoadReaderAt(t *testing.T) {
+	data := buildDeb(t, ".gz", ".gz")
+	padded := append(append([]byte{}, data...), bytes.Repeat([]byte("x"), 100)...)
+
+	_, err := deb.Load(bytes.NewReader(padded), "hello.deb")
+	notok(t, err)
+
+	debFile, err := deb.LoadReaderAt(bytes.NewReader(padded), int64(len(data)), "hello.deb")
+	isok(t, err)
+	assert(t, debFile.Control.Package == "hello")
+	isok(t, debFile.Close())
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,324 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// TarEntry {{{
+
+// The kind of thing a TarEntry is.
+type EntryType int
+
+const (
+	RegularEntry EntryType = iota
+	DirectoryEntry
+	SymlinkEntry
+	HardlinkEntry
+	CharDeviceEntry
+	BlockDeviceEntry
+	FIFOEntry
+)
+
+func (t EntryType) String() string {
+	switch t {
+	case RegularEntry:
+		return "file"
+	case DirectoryEntry:
+		return "directory"
+	case SymlinkEntry:
+		return "symlink"
+	case HardlinkEntry:
+		return "hardlink"
+	case CharDeviceEntry:
+		return "character device"
+	case BlockDeviceEntry:
+		return "block device"
+	case FIFOEntry:
+		return "fifo"
+	}
+	return "unknown"
+}
+
+var entryTypeflags = map[EntryType]byte{
+	RegularEntry:     tar.TypeReg,
+	DirectoryEntry:   tar.TypeDir,
+	SymlinkEntry:     tar.TypeSymlink,
+	HardlinkEntry:    tar.TypeLink,
+	CharDeviceEntry:  tar.TypeChar,
+	BlockDeviceEntry: tar.TypeBlock,
+	FIFOEntry:        tar.TypeFifo,
+}
+
+// The PAX record prefix for extended attributes, as written by GNU tar
+// and read by dpkg.
+const xattrPrefix = "SCHILY.xattr."
+
+// A TarEntry is one member of a .deb's data.tar, with everything needed to
+// recreate it on disk: not just regular files and directories, but
+// symlinks, hardlinks and device nodes, along with their ownership,
+// permissions (including setuid and friends) and extended attributes.
+type TarEntry struct {
+	// Path relative to the root, such as "usr/bin/foo", with no leading
+	// "./" or "/", or trailing "/".
+	Path string
+	Type EntryType
+
+	// Permission bits, along with os.ModeSetuid, os.ModeSetgid and
+	// os.ModeSticky. The file type is in Type, not here.
+	Mode os.FileMode
+
+	Uid, Gid     int
+	Uname, Gname string
+	ModTime      time.Time
+
+	// Size of the data of a RegularEntry.
+	Size int64
+
+	// The target of a SymlinkEntry, as written (so it may be relative to
+	// the symlink), or the Path of the file a HardlinkEntry is a second
+	// name for.
+	LinkTarget string
+
+	// Device numbers of a CharDeviceEntry or BlockDeviceEntry.
+	DevMajor, DevMinor int64
+
+	// Extended attributes (such as "security.capability"), by name.
+	Xattrs map[string]string
+
+	// Any other PAX extended header records, other than those the tar
+	// package deals with itself (such as "path" or "mtime").
+	PAXRecords map[string]string
+}
+
+// Convert a tar.Header from a data.tar into a TarEntry.
+func NewTarEntry(hdr *tar.Header) (*TarEntry, error) {
+	entry := TarEntry{
+		Path:       relativePath(hdr.Name),
+		Uid:        hdr.Uid,
+		Gid:        hdr.Gid,
+		Uname:      hdr.Uname,
+		Gname:      hdr.Gname,
+		ModTime:    hdr.ModTime,
+		Xattrs:     map[string]string{},
+		PAXRecords: map[string]string{},
+	}
+
+	entry.Mode = os.FileMode(hdr.Mode & 0777)
+	if hdr.Mode&04000 != 0 {
+		entry.Mode |= os.ModeSetuid
+	}
+	if hdr.Mode&02000 != 0 {
+		entry.Mode |= os.ModeSetgid
+	}
+	if hdr.Mode&01000 != 0 {
+		entry.Mode |= os.ModeSticky
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		entry.Type = RegularEntry
+		entry.Size = hdr.Size
+	case tar.TypeDir:
+		entry.Type = DirectoryEntry
+	case tar.TypeSymlink:
+		entry.Type = SymlinkEntry
+		entry.LinkTarget = hdr.Linkname
+	case tar.TypeLink:
+		entry.Type = HardlinkEntry
+		entry.LinkTarget = relativePath(hdr.Linkname)
+	case tar.TypeChar:
+		entry.Type = CharDeviceEntry
+		entry.DevMajor, entry.DevMinor = hdr.Devmajor, hdr.Devminor
+	case tar.TypeBlock:
+		entry.Type = BlockDeviceEntry
+		entry.DevMajor, entry.DevMinor = hdr.Devmajor, hdr.Devminor
+	case tar.TypeFifo:
+		entry.Type = FIFOEntry
+	default:
+		return nil, fmt.Errorf("%s: unsupported tar entry type '%c'", entry.Path, hdr.Typeflag)
+	}
+
+	for key, value := range hdr.PAXRecords {
+		if strings.HasPrefix(key, xattrPrefix) {
+			entry.Xattrs[strings.TrimPrefix(key, xattrPrefix)] = value
+			continue
+		}
+		if !paxHandled[key] {
+			entry.PAXRecords[key] = value
+		}
+	}
+	return &entry, nil
+}
+
+// PAX records the tar package reads into (and writes from) tar.Header
+// fields, so that aren't kept in PAXRecords.
+var paxHandled = map[string]bool{
+	"path": true, "linkpath": true, "size": true, "uid": true, "gid": true,
+	"uname": true, "gname": true, "mtime": true, "atime": true, "ctime": true,
+}
+
+// Convert the TarEntry into a tar.Header, named the way dpkg-deb names
+// things ("./usr/bin/foo", with a trailing "/" on directories).
+func (e *TarEntry) Header() (*tar.Header, error) {
+	typeflag, ok := entryTypeflags[e.Type]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown entry type %d", e.Path, e.Type)
+	}
+
+	name := "./" + relativePath(e.Path)
+	if e.Type == DirectoryEntry && name != "./" {
+		name += "/"
+	}
+	hdr := tar.Header{
+		Typeflag: typeflag,
+		Name:     name,
+		Mode:     int64(e.Mode.Perm()),
+		Uid:      e.Uid,
+		Gid:      e.Gid,
+		Uname:    e.Uname,
+		Gname:    e.Gname,
+		ModTime:  e.ModTime,
+	}
+	if e.Mode&os.ModeSetuid != 0 {
+		hdr.Mode |= 04000
+	}
+	if e.Mode&os.ModeSetgid != 0 {
+		hdr.Mode |= 02000
+	}
+	if e.Mode&os.ModeSticky != 0 {
+		hdr.Mode |= 01000
+	}
+
+	switch e.Type {
+	case RegularEntry:
+		hdr.Size = e.Size
+	case SymlinkEntry:
+		if e.LinkTarget == "" {
+			return nil, fmt.Errorf("%s: symlink has no target", e.Path)
+		}
+		hdr.Linkname = e.LinkTarget
+	case HardlinkEntry:
+		if e.LinkTarget == "" {
+			return nil, fmt.Errorf("%s: hardlink has no target", e.Path)
+		}
+		hdr.Linkname = "./" + relativePath(e.LinkTarget)
+	case CharDeviceEntry, BlockDeviceEntry:
+		hdr.Devmajor, hdr.Devminor = e.DevMajor, e.DevMinor
+	}
+
+	if len(e.Xattrs) != 0 || len(e.PAXRecords) != 0 {
+		hdr.Format = tar.FormatPAX
+		hdr.PAXRecords = map[string]string{}
+		for key, value := range e.PAXRecords {
+			hdr.PAXRecords[key] = value
+		}
+		for name, value := range e.Xattrs {
+			hdr.PAXRecords[xattrPrefix+name] = value
+		}
+	}
+	return &hdr, nil
+}
+
+// }}}
+
+// Reading {{{
+
+// Call fn with each entry of a data.tar (such as Deb.Data), and a reader
+// of its contents, which are empty for anything but a RegularEntry.
+func ReadTarEntries(data *tar.Reader, fn func(*TarEntry, io.Reader) error) error {
+	for {
+		hdr, err := data.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		entry, err := NewTarEntry(hdr)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry, data); err != nil {
+			return err
+		}
+	}
+}
+
+// }}}
+
+// Writing {{{
+
+// A TarWriter writes TarEntries out as a data.tar, in the format dpkg-deb
+// builds: GNU tar, with PAX headers where they're needed.
+type TarWriter struct {
+	tw      *tar.Writer
+	written map[string]EntryType
+}
+
+// Create a TarWriter writing to w. The caller has to Close it to finish
+// the archive (this doesn't close w).
+func NewTarWriter(w io.Writer) *TarWriter {
+	return &TarWriter{tw: tar.NewWriter(w), written: map[string]EntryType{}}
+}
+
+// Write an entry, and (for a RegularEntry) Size bytes of data. A
+// HardlinkEntry has to come after the file it links to, as that's where
+// dpkg will look for it.
+func (w *TarWriter) WriteEntry(entry *TarEntry, data io.Reader) error {
+	if entry.Type == HardlinkEntry {
+		target := relativePath(entry.LinkTarget)
+		if kind, ok := w.written[target]; !ok || kind == DirectoryEntry {
+			return fmt.Errorf("%s: hardlink to %s, which hasn't been written", entry.Path, target)
+		}
+	}
+	hdr, err := entry.Header()
+	if err != nil {
+		return err
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if entry.Type == RegularEntry && entry.Size > 0 {
+		if data == nil {
+			return fmt.Errorf("%s: no data", entry.Path)
+		}
+		if _, err := io.CopyN(w.tw, data, entry.Size); err != nil {
+			return fmt.Errorf("%s: %s", entry.Path, err)
+		}
+	}
+	w.written[relativePath(entry.Path)] = entry.Type
+	return nil
+}
+
+// Finish the archive.
+func (w *TarWriter) Close() error {
+	return w.tw.Close()
+}
+
+// }}}
+
+// vim: foldmethod=marker
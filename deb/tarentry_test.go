@@ -0,0 +1,121 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"pault.ag/go/debian/deb"
+)
+
+/*
+ *
+ */
+
+func TestTarEntryRoundTrip(t *testing.T) {
+	when := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	entries := []deb.TarEntry{
+		{Path: "usr/bin", Type: deb.DirectoryEntry, Mode: 0755, ModTime: when},
+		{Path: "usr/bin/ping", Type: deb.RegularEntry, Mode: 0755 | os.ModeSetuid, Size: 5,
+			Uname: "root", Gname: "root", ModTime: when,
+			Xattrs: map[string]string{"security.capability": "\x01\x00\x00\x02"}},
+		{Path: "usr/bin/ping6", Type: deb.HardlinkEntry, Mode: 0755, LinkTarget: "usr/bin/ping", ModTime: when},
+		{Path: "usr/bin/pong", Type: deb.SymlinkEntry, Mode: 0777, LinkTarget: "ping", ModTime: when},
+		{Path: "dev/null", Type: deb.CharDeviceEntry, Mode: 0666, DevMajor: 1, DevMinor: 3, ModTime: when},
+		{Path: "dev/sda", Type: deb.BlockDeviceEntry, Mode: 0660, Gid: 6, DevMajor: 8, DevMinor: 0, ModTime: when},
+		{Path: "run/fifo", Type: deb.FIFOEntry, Mode: 0600, ModTime: when,
+			PAXRecords: map[string]string{"LIBARCHIVE.creationtime": "1"}},
+		{Path: "tmp", Type: deb.DirectoryEntry, Mode: 0777 | os.ModeSticky, ModTime: when},
+	}
+
+	out := bytes.Buffer{}
+	writer := deb.NewTarWriter(&out)
+	for i := range entries {
+		var data io.Reader
+		if entries[i].Type == deb.RegularEntry {
+			data = strings.NewReader("ping\n")
+		}
+		isok(t, writer.WriteEntry(&entries[i], data))
+	}
+	isok(t, writer.Close())
+
+	names := []string{}
+	read := []deb.TarEntry{}
+	isok(t, deb.ReadTarEntries(tar.NewReader(&out), func(entry *deb.TarEntry, data io.Reader) error {
+		read = append(read, *entry)
+		contents, err := io.ReadAll(data)
+		if err != nil {
+			return err
+		}
+		names = append(names, entry.Path+":"+string(contents))
+		return nil
+	}))
+	assert(t, len(read) == len(entries))
+	assert(t, names[1] == "usr/bin/ping:ping\n")
+
+	for i, entry := range read {
+		want := entries[i]
+		assert(t, entry.Path == want.Path)
+		assert(t, entry.Type == want.Type)
+		assert(t, entry.Mode == want.Mode)
+		assert(t, entry.LinkTarget == want.LinkTarget)
+		assert(t, entry.DevMajor == want.DevMajor && entry.DevMinor == want.DevMinor)
+		assert(t, entry.Gid == want.Gid)
+		assert(t, entry.ModTime.Equal(want.ModTime))
+		assert(t, len(entry.Xattrs) == len(want.Xattrs))
+		assert(t, len(entry.PAXRecords) == len(want.PAXRecords))
+	}
+	assert(t, read[1].Xattrs["security.capability"] == "\x01\x00\x00\x02")
+	assert(t, read[1].Uname == "root")
+	assert(t, read[6].PAXRecords["LIBARCHIVE.creationtime"] == "1")
+}
+
+func TestTarEntryHeader(t *testing.T) {
+	hdr, err := (&deb.TarEntry{Path: "/usr/share/doc/", Type: deb.DirectoryEntry, Mode: 0755}).Header()
+	isok(t, err)
+	assert(t, hdr.Name == "./usr/share/doc/")
+	assert(t, hdr.Typeflag == tar.TypeDir)
+
+	hdr, err = (&deb.TarEntry{Path: "./usr/bin/b", Type: deb.HardlinkEntry, LinkTarget: "/usr/bin/a"}).Header()
+	isok(t, err)
+	assert(t, hdr.Name == "./usr/bin/b")
+	assert(t, hdr.Linkname == "./usr/bin/a")
+
+	_, err = (&deb.TarEntry{Path: "usr/bin/c", Type: deb.SymlinkEntry}).Header()
+	notok(t, err)
+
+	/* Hardlinks have to follow what they link to */
+	writer := deb.NewTarWriter(io.Discard)
+	notok(t, writer.WriteEntry(&deb.TarEntry{Path: "b", Type: deb.HardlinkEntry, LinkTarget: "a"}, nil))
+	isok(t, writer.WriteEntry(&deb.TarEntry{Path: "a", Type: deb.RegularEntry, Size: 1}, strings.NewReader("a")))
+	isok(t, writer.WriteEntry(&deb.TarEntry{Path: "b", Type: deb.HardlinkEntry, LinkTarget: "./a"}, nil))
+
+	_, err = deb.NewTarEntry(&tar.Header{Name: "./x", Typeflag: 'Z'})
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
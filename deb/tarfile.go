@@ -28,63 +28,19 @@ import (
 
 	"archive/tar"
 
-	"compress/bzip2"
-	"compress/gzip"
-
-	"github.com/kjk/lzma"
-	"github.com/klauspost/compress/zstd"
-	"github.com/xi2/xz"
+	"pault.ag/go/debian/compression"
 )
 
 // known compression types {{{
 
 type DecompressorFunc func(io.Reader) (io.ReadCloser, error)
 
-func gzipNewReader(r io.Reader) (io.ReadCloser, error) {
-	return gzip.NewReader(r)
-}
-
-func xzNewReader(r io.Reader) (io.ReadCloser, error) {
-	reader, err := xz.NewReader(r, 0)
-	if err != nil {
-		return nil, err
-	}
-	return io.NopCloser(reader), nil
-}
-
-func lzmaNewReader(r io.Reader) (io.ReadCloser, error) {
-	return lzma.NewReader(r), nil
-}
-
-func bzipNewReader(r io.Reader) (io.ReadCloser, error) {
-	return io.NopCloser(bzip2.NewReader(r)), nil
-}
-
-func zstdNewReader(r io.Reader) (io.ReadCloser, error) {
-	reader, err := zstd.NewReader(r)
-	if err != nil {
-		return nil, err
-	}
-	return io.NopCloser(reader), err
-}
-
-// For the authoritative list of supported file formats, see
-// https://manpages.debian.org/unstable/dpkg-dev/deb.5
-// zstd-compressed packages are not yet (08-2021) officially supported by Debian, but they
-// are used by Ubuntu.
-var knownCompressionAlgorithms = map[string]DecompressorFunc{
-	".gz":   gzipNewReader,
-	".bz2":  bzipNewReader,
-	".xz":   xzNewReader,
-	".lzma": lzmaNewReader,
-	".zst":  zstdNewReader,
-}
-
-// DecompressorFn returns a decompressing reader for the specified reader and its
-// corresponding file extension ext.
+// DecompressorFor returns a decompressing reader for the specified reader and
+// its corresponding file extension ext, using whichever compression.Backend
+// has been registered for it.
 func DecompressorFor(ext string) DecompressorFunc {
-	if fn, ok := knownCompressionAlgorithms[ext]; ok {
-		return fn
+	if fn, err := compression.DecompressorFor(ext); err == nil {
+		return DecompressorFunc(fn)
 	}
 	return func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil } // uncompressed file or unknown compression scheme
 }
@@ -109,14 +65,27 @@ func (e *ArEntry) IsTarfile() bool {
 // Tarfile {{{
 
 // `.Tarfile()` will return a `tar.Reader` created from the ArEntry member
-// to allow further inspection of the contents of the `.deb`.
+// to allow further inspection of the contents of the `.deb`. The member may
+// be uncompressed, or compressed with any format the compression package
+// has a Backend for (gzip, bzip2, xz, lzma and zstd out of the box), going
+// by its extension; anything else is an error.
 func (e *ArEntry) Tarfile() (*tar.Reader, io.Closer, error) {
 	if !e.IsTarfile() {
 		return nil, nil, fmt.Errorf("%s appears to not be a tarfile", e.Name)
 	}
-	readCloser, err := DecompressorFor(filepath.Ext(e.Name))(e.Data)
+	return openTarfile(e.Name, e.Data)
+}
+
+// Decompress (going by the extension of name) and read a tar file.
+func openTarfile(name string, in io.Reader) (*tar.Reader, io.Closer, error) {
+	ext := filepath.Ext(name)
+	decompressor := DecompressorFor(ext)
+	if _, err := compression.DecompressorFor(ext); err != nil && ext != ".tar" {
+		return nil, nil, fmt.Errorf("%s: unknown compression format '%s'", name, ext)
+	}
+	readCloser, err := decompressor(in)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("%s: %s", name, err)
 	}
 	return tar.NewReader(readCloser), readCloser, nil
 }
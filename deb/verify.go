@@ -0,0 +1,190 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package deb // import "pault.ag/go/debian/deb"
+
+import (
+	"archive/tar"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ChecksumReport {{{
+
+// A file in the data member whose contents don't match md5sums.
+type ChecksumMismatch struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+// The result of checking the data member of a .deb against its md5sums.
+// Paths are relative to the root, as in md5sums ("usr/bin/foo").
+type ChecksumReport struct {
+	Mismatched []ChecksumMismatch
+
+	// Listed in md5sums, but not shipped in the data member.
+	Missing []string
+
+	// Regular files shipped in the data member that md5sums doesn't list.
+	// Conffiles are left out of md5sums on purpose, so aren't counted.
+	Unlisted []string
+
+	// The SHA256 of every regular file in the data member, if asked for.
+	SHA256 map[string]string
+}
+
+// Return true if every file matched, and nothing was missing from either
+// side.
+func (r ChecksumReport) OK() bool {
+	return len(r.Mismatched) == 0 && len(r.Missing) == 0 && len(r.Unlisted) == 0
+}
+
+// }}}
+
+// VerifyChecksums {{{
+
+// Read the md5sums control member, and check every regular file in the
+// data member against it. If withSHA256 is set, the SHA256 of each file
+// is computed along the way, and returned in the report.
+//
+// The data member is read through a reader of its own, so this doesn't
+// disturb (and isn't disturbed by) reading deb.Data. A .deb without an md5sums
+// member is an error.
+func (deb *Deb) VerifyChecksums(withSHA256 bool) (*ChecksumReport, error) {
+	sums, err := deb.MD5Sums()
+	if err != nil {
+		return nil, err
+	}
+	if sums == nil {
+		return nil, fmt.Errorf("%s has no md5sums member", deb.Control.Package)
+	}
+	conffiles, err := deb.Conffiles()
+	if err != nil {
+		return nil, err
+	}
+	isConffile := map[string]bool{}
+	for _, conffile := range conffiles {
+		isConffile[relativePath(conffile)] = true
+	}
+
+	member, ok := deb.ArContent["data."+deb.DataExt]
+	if !ok {
+		return nil, fmt.Errorf("Missing .deb member 'data.%s'", deb.DataExt)
+	}
+	if !member.IsTarfile() {
+		return nil, fmt.Errorf("%s appears to not be a tarfile", member.Name)
+	}
+	archive, closer, err := openTarfile(member.Name, io.NewSectionReader(member.Data, 0, member.Size))
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	report := ChecksumReport{}
+	if withSHA256 {
+		report.SHA256 = map[string]string{}
+	}
+
+	/* Hardlinks have no data of their own, so remember what we've seen */
+	md5s := map[string]string{}
+	sha256s := map[string]string{}
+	for {
+		hdr, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := relativePath(hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			md5sum, sha256sum, err := digest(archive, withSHA256)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", name, err)
+			}
+			md5s[name], sha256s[name] = md5sum, sha256sum
+		case tar.TypeLink:
+			target := relativePath(hdr.Linkname)
+			md5s[name], sha256s[name] = md5s[target], sha256s[target]
+		default:
+			continue
+		}
+
+		if withSHA256 {
+			report.SHA256[name] = sha256s[name]
+		}
+		expected, ok := sums[name]
+		if !ok {
+			if !isConffile[name] {
+				report.Unlisted = append(report.Unlisted, name)
+			}
+			continue
+		}
+		if !strings.EqualFold(expected, md5s[name]) {
+			report.Mismatched = append(report.Mismatched, ChecksumMismatch{
+				Path:     name,
+				Expected: expected,
+				Actual:   md5s[name],
+			})
+		}
+	}
+
+	for name := range sums {
+		if _, ok := md5s[name]; !ok {
+			report.Missing = append(report.Missing, name)
+		}
+	}
+	sort.Strings(report.Missing)
+	return &report, nil
+}
+
+// Turn a tar member name ("./usr/bin/foo") or an absolute path into the
+// form used in md5sums ("usr/bin/foo").
+func relativePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func digest(reader io.Reader, withSHA256 bool) (string, string, error) {
+	md5sum, sha256sum := md5.New(), sha256.New()
+	var writer io.Writer = md5sum
+	if withSHA256 {
+		writer = io.MultiWriter(md5sum, sha256sum)
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		return "", "", err
+	}
+	sha := ""
+	if withSHA256 {
+		sha = hex.EncodeToString(sha256sum.Sum(nil))
+	}
+	return hex.EncodeToString(md5sum.Sum(nil)), sha, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
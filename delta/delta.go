@@ -0,0 +1,231 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package delta // import "pault.ag/go/debian/delta"
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// The first member of a delta names the format. It's deliberately not
+// anything debdelta(1) uses, since the two formats are unrelated.
+const (
+	formatMember  = "go-delta"
+	formatVersion = "go-1\n"
+)
+
+// Info {{{
+
+// Info describes the two .debs a Delta is between.
+type Info struct {
+	control.Paragraph
+
+	Package      string          `required:"true"`
+	Architecture dependency.Arch `required:"true"`
+	OldVersion   version.Version `control:"Old-Version" required:"true"`
+	NewVersion   version.Version `control:"New-Version" required:"true"`
+	OldSize      int             `control:"Old-Size" required:"true"`
+	OldSHA256    string          `control:"Old-SHA256" required:"true"`
+	NewSize      int             `control:"New-Size" required:"true"`
+	NewSHA256    string          `control:"New-SHA256" required:"true"`
+}
+
+// }}}
+
+// Delta {{{
+
+// A Delta turns one .deb into another. This is not a debdelta(1) delta,
+// and the two don't interoperate; see the package documentation.
+type Delta struct {
+	Info Info
+
+	// The gzipped instructions, as they are in the delta file.
+	patch []byte
+}
+
+// The instructions in the patch.
+const (
+	opCopy   = 'c' // offset, length: copy bytes from the old .deb
+	opInsert = 'i' // length, data: bytes that are only in the new .deb
+)
+
+// Read a Delta, as written by Write.
+func Load(in io.ReaderAt) (*Delta, error) {
+	ar, err := deb.LoadAr(in)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ar.Find(formatMember); err != nil {
+		return nil, fmt.Errorf("Not a delta made by this package (debdelta(1) deltas aren't supported)")
+	}
+	members := map[string][]byte{}
+	for _, name := range []string{formatMember, "info", "patch.gz"} {
+		entry, err := ar.Find(name)
+		if err != nil {
+			return nil, err
+		}
+		data := bytes.Buffer{}
+		if _, err := entry.CopyTo(&data); err != nil {
+			return nil, err
+		}
+		members[name] = data.Bytes()
+	}
+	if string(members[formatMember]) != formatVersion {
+		return nil, fmt.Errorf("Unknown delta format: '%s'", bytes.TrimSpace(members[formatMember]))
+	}
+
+	ret := Delta{patch: members["patch.gz"]}
+	if err := control.Unmarshal(&ret.Info, bytes.NewReader(members["info"])); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Write the Delta out, ready to be read back with Load.
+func (d *Delta) Write(out io.Writer) error {
+	info := bytes.Buffer{}
+	if err := control.Marshal(&info, d.Info); err != nil {
+		return err
+	}
+	writer := deb.NewArWriter(out)
+	if err := writer.WriteEntry(formatMember, []byte(formatVersion)); err != nil {
+		return err
+	}
+	if err := writer.WriteEntry("info", info.Bytes()); err != nil {
+		return err
+	}
+	return writer.WriteEntry("patch.gz", d.patch)
+}
+
+// How many bytes the Delta takes up on the wire, roughly.
+func (d *Delta) Size() int {
+	return len(d.patch)
+}
+
+// }}}
+
+// Apply {{{
+
+// Rebuild the new .deb from the bytes of the old .deb (not from the
+// installed files of the old version), writing it to out. The old .deb is
+// checked before anything is written, and the new one is checked as it
+// is written; if it doesn't match, an error is returned once the whole
+// thing has been written, and the output must be thrown away.
+func (d *Delta) Apply(old io.ReaderAt, out io.Writer) error {
+	if err := check(io.NewSectionReader(old, 0, int64(d.Info.OldSize)), d.Info.OldSize, d.Info.OldSHA256); err != nil {
+		return fmt.Errorf("Old .deb doesn't match the delta: %s", err)
+	}
+
+	decompress, err := compression.DecompressorFor("gz")
+	if err != nil {
+		return err
+	}
+	patch, err := decompress(bytes.NewReader(d.patch))
+	if err != nil {
+		return err
+	}
+	defer patch.Close()
+	reader := bufio.NewReader(patch)
+
+	hash := sha256.New()
+	var written countingWriter
+	out = io.MultiWriter(out, hash, &written)
+
+	for {
+		op, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		switch op {
+		case opCopy:
+			offset, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return err
+			}
+			length, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return err
+			}
+			if offset+length > uint64(d.Info.OldSize) {
+				return fmt.Errorf("Delta copies past the end of the old .deb")
+			}
+			if _, err := io.Copy(out, io.NewSectionReader(old, int64(offset), int64(length))); err != nil {
+				return err
+			}
+		case opInsert:
+			length, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return err
+			}
+			if _, err := io.CopyN(out, reader, int64(length)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Unknown delta instruction: 0x%02x", op)
+		}
+	}
+
+	if int(written) != d.Info.NewSize {
+		return fmt.Errorf("New .deb size mismatch: got %d, want %d", written, d.Info.NewSize)
+	}
+	if sum := fmt.Sprintf("%x", hash.Sum(nil)); sum != d.Info.NewSHA256 {
+		return fmt.Errorf("New .deb hash mismatch: got %s, want %s", sum, d.Info.NewSHA256)
+	}
+	return nil
+}
+
+type countingWriter int64
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
+
+func check(in io.Reader, size int, sha string) error {
+	hash := sha256.New()
+	n, err := io.Copy(hash, in)
+	if err != nil {
+		return err
+	}
+	if int(n) != size {
+		return fmt.Errorf("size mismatch: got %d, want %d", n, size)
+	}
+	if sum := fmt.Sprintf("%x", hash.Sum(nil)); sum != sha {
+		return fmt.Errorf("hash mismatch: got %s, want %s", sum, sha)
+	}
+	return nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
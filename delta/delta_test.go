@@ -0,0 +1,158 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package delta_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/delta"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// Build an uncompressed .deb of the given package and version, shipping
+// the given files.
+func buildDeb(t *testing.T, pkg, ver string, files map[string][]byte, order []string) []byte {
+	tarball := func(files map[string][]byte, order []string) []byte {
+		out := bytes.Buffer{}
+		w := tar.NewWriter(&out)
+		for _, name := range order {
+			isok(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name]))}))
+			_, err := w.Write(files[name])
+			isok(t, err)
+		}
+		isok(t, w.Close())
+		return out.Bytes()
+	}
+
+	control := fmt.Sprintf("Package: %s\nVersion: %s\nArchitecture: amd64\nMaintainer: Example <example@example.com>\nDescription: example\n", pkg, ver)
+	out := bytes.Buffer{}
+	writer := deb.NewArWriter(&out)
+	isok(t, writer.WriteEntry("debian-binary", []byte("2.0\n")))
+	isok(t, writer.WriteEntry("control.tar", tarball(map[string][]byte{"./control": []byte(control)}, []string{"./control"})))
+	isok(t, writer.WriteEntry("data.tar", tarball(files, order)))
+	return out.Bytes()
+}
+
+func TestDelta(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	library := make([]byte, 256*1024)
+	random.Read(library)
+	changed := append([]byte{}, library...)
+	copy(changed[100000:], "a small security fix")
+
+	order := []string{"./usr/lib/libfoo.so.1", "./usr/share/doc/foo/changelog"}
+	old := buildDeb(t, "foo", "1.0-1", map[string][]byte{
+		order[0]: library,
+		order[1]: []byte("foo (1.0-1) unstable; urgency=medium\n"),
+	}, order)
+	new := buildDeb(t, "foo", "1.0-2", map[string][]byte{
+		order[0]: changed,
+		order[1]: []byte("foo (1.0-2) unstable; urgency=high\n\nfoo (1.0-1) unstable; urgency=medium\n"),
+	}, order)
+
+	d, err := delta.Generate(old, new)
+	isok(t, err)
+	assert(t, d.Info.Package == "foo")
+	assert(t, d.Info.OldVersion.String() == "1.0-1")
+	assert(t, d.Info.NewVersion.String() == "1.0-2")
+	assert(t, d.Size() < len(new)/20)
+
+	/* Through the file format and back */
+	file := bytes.Buffer{}
+	isok(t, d.Write(&file))
+	d, err = delta.Load(bytes.NewReader(file.Bytes()))
+	isok(t, err)
+
+	out := bytes.Buffer{}
+	isok(t, d.Apply(bytes.NewReader(old), &out))
+	assert(t, bytes.Equal(out.Bytes(), new))
+
+	/* Only from the right old .deb */
+	out.Reset()
+	notok(t, d.Apply(bytes.NewReader(new), &out))
+	assert(t, out.Len() == 0)
+
+	/* Not between different packages */
+	other := buildDeb(t, "bar", "1.0-2", map[string][]byte{order[0]: library}, order[:1])
+	_, err = delta.Generate(old, other)
+	notok(t, err)
+}
+
+func TestDeltaNothingShared(t *testing.T) {
+	order := []string{"./a"}
+	old := buildDeb(t, "foo", "1", map[string][]byte{"./a": []byte("old")}, order)
+	new := buildDeb(t, "foo", "2", map[string][]byte{"./a": []byte("new")}, order)
+
+	d, err := delta.Generate(old, new)
+	isok(t, err)
+	out := bytes.Buffer{}
+	isok(t, d.Apply(bytes.NewReader(old), &out))
+	assert(t, bytes.Equal(out.Bytes(), new))
+}
+
+func TestDeltaDebdelta(t *testing.T) {
+	/* Roughly what debdelta(1) writes; we can't read it, but should say so */
+	out := bytes.Buffer{}
+	writer := deb.NewArWriter(&out)
+	isok(t, writer.WriteEntry("info", []byte("NAME: foo\n")))
+	isok(t, writer.WriteEntry("patch.sh.xz", []byte("not really xz")))
+
+	_, err := delta.Load(bytes.NewReader(out.Bytes()))
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "debdelta"))
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,17 @@
+/*
+Build and apply binary deltas between two versions of a .deb, so that a
+machine that already has the old .deb (say, in /var/cache/apt/archives)
+only needs to download the difference to get the new one.
+
+This is a private, rsync-style format of our own. It is NOT debdelta(1):
+deltas made here can't be applied by debpatch, and debdelta's can't be
+applied here. A delta is an ar archive holding an "info" paragraph and a
+gzipped list of copy and insert instructions against the bytes of the old
+.deb; it never runs any scripts. Both .debs are checked against their
+SHA256 when a delta is applied.
+
+Unlike debpatch, which can rebuild the new .deb from the files of the old
+version as installed on the system, Apply needs the old .deb itself, byte
+for byte.
+*/
+package delta // import "pault.ag/go/debian/delta"
@@ -0,0 +1,231 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package delta // import "pault.ag/go/debian/delta"
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/deb"
+)
+
+// Generate {{{
+
+// Size of the blocks of the old .deb that are looked for in the new one.
+// Anything shorter than this that didn't change is sent again.
+const blockSize = 512
+
+// Work out the Delta between two .debs, which must be of the same package
+// and architecture. Both are held in memory while this runs.
+//
+// The delta only finds runs of bytes the two files have in common, so
+// compressed members only share much when the compressor was rsyncable,
+// or the member didn't change at all (usually control.tar.*, and often
+// much of data.tar.* for uncompressed or zstd --rsyncable packages).
+func Generate(old, new []byte) (*Delta, error) {
+	oldDeb, err := deb.Load(bytes.NewReader(old), "old.deb")
+	if err != nil {
+		return nil, fmt.Errorf("old: %s", err)
+	}
+	defer oldDeb.Close()
+	newDeb, err := deb.Load(bytes.NewReader(new), "new.deb")
+	if err != nil {
+		return nil, fmt.Errorf("new: %s", err)
+	}
+	defer newDeb.Close()
+
+	if oldDeb.Control.Package != newDeb.Control.Package {
+		return nil, fmt.Errorf("Can't build a delta from %s to %s", oldDeb.Control.Package, newDeb.Control.Package)
+	}
+	if oldDeb.Control.Architecture != newDeb.Control.Architecture {
+		return nil, fmt.Errorf("Can't build a delta from %s to %s", oldDeb.Control.Architecture.String(), newDeb.Control.Architecture.String())
+	}
+
+	compress, err := compression.CompressorFor("gz")
+	if err != nil {
+		return nil, err
+	}
+	patch := bytes.Buffer{}
+	writer, err := compress(&patch)
+	if err != nil {
+		return nil, err
+	}
+	encoder := encoder{out: writer}
+	diff(old, new, &encoder)
+	if encoder.err != nil {
+		return nil, encoder.err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return &Delta{
+		Info: Info{
+			Package:      newDeb.Control.Package,
+			Architecture: newDeb.Control.Architecture,
+			OldVersion:   oldDeb.Control.Version,
+			NewVersion:   newDeb.Control.Version,
+			OldSize:      len(old),
+			OldSHA256:    fmt.Sprintf("%x", sha256.Sum256(old)),
+			NewSize:      len(new),
+			NewSHA256:    fmt.Sprintf("%x", sha256.Sum256(new)),
+		},
+		patch: patch.Bytes(),
+	}, nil
+}
+
+// }}}
+
+// Diff {{{
+
+// The rsync weak checksum, which can be rolled along a byte at a time.
+type rolling struct {
+	a, b uint32
+}
+
+func newRolling(block []byte) rolling {
+	r := rolling{}
+	for i, c := range block {
+		r.a += uint32(c)
+		r.b += uint32(len(block)-i) * uint32(c)
+	}
+	return r
+}
+
+func (r *rolling) roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - blockSize*uint32(out)
+}
+
+func (r rolling) sum() uint32 {
+	return (r.a & 0xffff) | (r.b << 16)
+}
+
+// Find the runs of new that are in old, and hand the encoder the
+// instructions to build new out of old.
+func diff(old, new []byte, out *encoder) {
+	index := map[uint32][]int{}
+	for offset := 0; offset+blockSize <= len(old); offset += blockSize {
+		sum := newRolling(old[offset : offset+blockSize]).sum()
+		index[sum] = append(index[sum], offset)
+	}
+
+	pending := 0
+	i := 0
+	var weak rolling
+	if len(new) >= blockSize {
+		weak = newRolling(new[:blockSize])
+	}
+
+	for i+blockSize <= len(new) {
+		matched := false
+		for _, offset := range index[weak.sum()] {
+			if !bytes.Equal(old[offset:offset+blockSize], new[i:i+blockSize]) {
+				continue
+			}
+
+			/* Make the match as long as we can, both ways */
+			length := blockSize
+			for offset+length < len(old) && i+length < len(new) && old[offset+length] == new[i+length] {
+				length++
+			}
+			back := 0
+			for i-back > pending && offset-back > 0 && old[offset-back-1] == new[i-back-1] {
+				back++
+			}
+
+			out.insert(new[pending : i-back])
+			out.copy(offset-back, length+back)
+			i += length
+			pending = i
+			if i+blockSize <= len(new) {
+				weak = newRolling(new[i : i+blockSize])
+			}
+			matched = true
+			break
+		}
+		if matched {
+			continue
+		}
+		if i+blockSize < len(new) {
+			weak.roll(new[i], new[i+blockSize])
+		}
+		i++
+	}
+	out.insert(new[pending:])
+	out.flush()
+}
+
+// Writes out the instructions, merging copies that follow on from each
+// other.
+type encoder struct {
+	out io.Writer
+	err error
+
+	copyOffset, copyLength int
+}
+
+func (e *encoder) write(data []byte) {
+	if e.err == nil {
+		_, e.err = e.out.Write(data)
+	}
+}
+
+func (e *encoder) op(op byte, values ...int) {
+	buf := []byte{op}
+	for _, value := range values {
+		buf = binary.AppendUvarint(buf, uint64(value))
+	}
+	e.write(buf)
+}
+
+func (e *encoder) flush() {
+	if e.copyLength > 0 {
+		e.op(opCopy, e.copyOffset, e.copyLength)
+		e.copyLength = 0
+	}
+}
+
+func (e *encoder) copy(offset, length int) {
+	if e.copyLength > 0 && e.copyOffset+e.copyLength == offset {
+		e.copyLength += length
+		return
+	}
+	e.flush()
+	e.copyOffset, e.copyLength = offset, length
+}
+
+func (e *encoder) insert(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	e.flush()
+	e.op(opInsert, len(data))
+	e.write(data)
+}
+
+// }}}
+
+// vim: foldmethod=marker
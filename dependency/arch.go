@@ -74,6 +74,11 @@ func parseArchInto(ret *Arch, arch string) error {
 	 * kfreebsd-amd64 (implicitly any-kfreebsd-any)
 	 * bsd-openbsd-i386 */
 	flavors := strings.SplitN(arch, "-", 3)
+	if special, ok := specialArches[arch]; ok {
+		/* Something like armhf, which is gnueabihf-linux-arm */
+		*ret = special
+		return nil
+	}
 	switch len(flavors) {
 	case 1:
 		flavor := flavors[0]
@@ -92,9 +97,17 @@ func parseArchInto(ret *Arch, arch string) error {
 		}
 	case 2:
 		/* Right, this is something like kfreebsd-amd64, which is implicitly
-		 * gnu-kfreebsd-amd64 */
+		 * gnu-kfreebsd-amd64, or a wildcard like linux-any, which is
+		 * any-linux-any */
+		ret.ABI = "gnu"
+		if abi, ok := osABIs[flavors[0]]; ok {
+			ret.ABI = abi
+		}
 		ret.OS = flavors[0]
 		ret.CPU = flavors[1]
+		if ret.OS == "any" || ret.CPU == "any" {
+			ret.ABI = "any"
+		}
 	case 3:
 		/* This is something like bsd-openbsd-amd64 */
 		ret.ABI = flavors[0]
@@ -145,6 +158,12 @@ func (arch *Arch) IsWildcard() bool {
 /*
  */
 func (arch *Arch) Is(other *Arch) bool {
+	if canonical := arch.canonical(); canonical != *arch {
+		return canonical.Is(other)
+	}
+	if canonical := other.canonical(); canonical != *other {
+		return arch.Is(&canonical)
+	}
 
 	if arch.IsWildcard() && other.IsWildcard() {
 		/* We can't compare wildcards to other wildcards. That's just
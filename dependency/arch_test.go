@@ -119,4 +119,110 @@ func TestArchSetCompare(t *testing.T) {
 	assert(t, barArch.Matches(iAmNot))
 }
 
+/*
+ */
+func TestArchTwoPart(t *testing.T) {
+	/* Decoding into a zero Arch has to agree with ParseArch */
+	for _, el := range []string{"linux-any", "kfreebsd-amd64", "any-amd64"} {
+		parsed, err := dependency.ParseArch(el)
+		isok(t, err)
+		decoded := dependency.Arch{}
+		isok(t, decoded.UnmarshalControl(el))
+		assert(t, *parsed == decoded)
+		assert(t, decoded.String() == el || el == "any-amd64")
+	}
+
+	kfreebsd, err := dependency.ParseArch("kfreebsd-amd64")
+	isok(t, err)
+	assert(t, !kfreebsd.IsWildcard())
+
+	linuxAny := dependency.Arch{}
+	isok(t, linuxAny.UnmarshalControl("linux-any"))
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	assert(t, amd64.Is(&linuxAny))
+	assert(t, !kfreebsd.Is(&linuxAny))
+}
+
+/*
+ */
+func TestArchTupleTable(t *testing.T) {
+	triplets := map[string]dependency.Arch{
+		"amd64":            {ABI: "gnu", OS: "linux", CPU: "amd64"},
+		"armhf":            {ABI: "gnueabihf", OS: "linux", CPU: "arm"},
+		"armel":            {ABI: "gnueabi", OS: "linux", CPU: "arm"},
+		"x32":              {ABI: "gnux32", OS: "linux", CPU: "amd64"},
+		"hurd-i386":        {ABI: "gnu", OS: "hurd", CPU: "i386"},
+		"freebsd-amd64":    {ABI: "bsd", OS: "freebsd", CPU: "amd64"},
+		"musl-linux-armhf": {ABI: "musleabihf", OS: "linux", CPU: "arm"},
+		"musl-linux-amd64": {ABI: "musl", OS: "linux", CPU: "amd64"},
+		"any-arm":          {ABI: "any", OS: "any", CPU: "arm"},
+		"linux-any":        {ABI: "any", OS: "linux", CPU: "any"},
+	}
+	for name, triplet := range triplets {
+		arch, err := dependency.ParseArch(name)
+		isok(t, err)
+		assert(t, *arch == triplet)
+		assert(t, arch.String() == name)
+	}
+
+	/* Built by hand, the old way */
+	armhf := dependency.Arch{ABI: "gnu", OS: "linux", CPU: "armhf"}
+	assert(t, armhf.String() == "armhf")
+	assert(t, armhf.Equal(dependency.ARMHF))
+	assert(t, !dependency.ARMHF.Equal(dependency.ARMEL))
+}
+
+func TestArchMatches(t *testing.T) {
+	armhf := dependency.ARMHF
+	assert(t, armhf.Matches("armhf"))
+	assert(t, armhf.Matches("any-arm"))
+	assert(t, armhf.Matches("linux-any"))
+	assert(t, armhf.Matches("any"))
+	assert(t, !armhf.Matches("armel"))
+	assert(t, !armhf.Matches("any-amd64"))
+	assert(t, !armhf.Matches("all"))
+
+	x32 := dependency.Arch{ABI: "gnux32", OS: "linux", CPU: "amd64"}
+	assert(t, x32.Matches("any-amd64"))
+	assert(t, !x32.Matches("amd64"))
+
+	dep, err := dependency.Parse("foo [any-arm]")
+	isok(t, err)
+	assert(t, dep.Relations[0].Possibilities[0].Architectures.Matches(&armhf))
+	assert(t, !dep.Relations[0].Possibilities[0].Architectures.Matches(&dependency.ARM64))
+}
+
+func TestArchMultiarchTuple(t *testing.T) {
+	tuples := map[string]string{
+		"amd64":          "x86_64-linux-gnu",
+		"arm64":          "aarch64-linux-gnu",
+		"armhf":          "arm-linux-gnueabihf",
+		"i386":           "i386-linux-gnu",
+		"ppc64el":        "powerpc64le-linux-gnu",
+		"mips64el":       "mips64el-linux-gnuabi64",
+		"x32":            "x86_64-linux-gnux32",
+		"hurd-i386":      "i386-gnu",
+		"kfreebsd-amd64": "x86_64-kfreebsd-gnu",
+	}
+	for name, tuple := range tuples {
+		arch, err := dependency.ParseArch(name)
+		isok(t, err)
+		got, err := arch.MultiarchTuple()
+		isok(t, err)
+		assert(t, got == tuple)
+	}
+
+	_, err := dependency.Any.MultiarchTuple()
+	notok(t, err)
+	_, err = dependency.All.MultiarchTuple()
+	notok(t, err)
+
+	arch, err := dependency.ArchForMultiarchTuple("arm-linux-gnueabihf", dependency.ReleaseArchitectures)
+	isok(t, err)
+	assert(t, arch.String() == "armhf")
+	_, err = dependency.ArchForMultiarchTuple("sparc64-linux-gnu", dependency.ReleaseArchitectures)
+	notok(t, err)
+}
+
 // vim: foldmethod=marker
@@ -0,0 +1,184 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dependency // import "pault.ag/go/debian/dependency"
+
+import (
+	"fmt"
+)
+
+// Tuple table {{{
+
+// Architecture names whose ABI-OS-CPU triplet isn't the obvious one, from
+// dpkg's tupletable. Everything else named by a bare CPU is gnu-linux-CPU.
+var specialArches = map[string]Arch{
+	"armhf":              {ABI: "gnueabihf", OS: "linux", CPU: "arm"},
+	"armel":              {ABI: "gnueabi", OS: "linux", CPU: "arm"},
+	"mips64el":           {ABI: "gnuabi64", OS: "linux", CPU: "mips64el"},
+	"mipsn32el":          {ABI: "gnuabin32", OS: "linux", CPU: "mips64el"},
+	"powerpcspe":         {ABI: "gnuspe", OS: "linux", CPU: "powerpc"},
+	"x32":                {ABI: "gnux32", OS: "linux", CPU: "amd64"},
+	"musl-linux-armhf":   {ABI: "musleabihf", OS: "linux", CPU: "arm"},
+	"uclibc-linux-armel": {ABI: "uclibceabi", OS: "linux", CPU: "arm"},
+	"uclinux-armel":      {ABI: "uclibceabi", OS: "uclinux", CPU: "arm"},
+}
+
+// The ABI implied by an OS-CPU architecture name, such as hurd-i386.
+var osABIs = map[string]string{
+	"linux":        "gnu",
+	"kfreebsd":     "gnu",
+	"knetbsd":      "gnu",
+	"kopensolaris": "gnu",
+	"hurd":         "gnu",
+	"darwin":       "bsd",
+	"freebsd":      "bsd",
+	"netbsd":       "bsd",
+	"openbsd":      "bsd",
+	"solaris":      "sysv",
+	"uclinux":      "uclibc",
+}
+
+// Return the dpkg name of a concrete architecture triplet.
+func archName(arch Arch) string {
+	for name, special := range specialArches {
+		if special == arch {
+			return name
+		}
+	}
+	if arch.ABI == "gnu" && arch.OS == "linux" {
+		return arch.CPU
+	}
+	if osABIs[arch.OS] == arch.ABI && arch.OS != "linux" {
+		return arch.OS + "-" + arch.CPU
+	}
+	return arch.ABI + "-" + arch.OS + "-" + arch.CPU
+}
+
+// Return the dpkg name of a wildcard, such as linux-any or any-arm.
+func wildcardName(arch Arch) string {
+	switch {
+	case arch.ABI != "any":
+		return arch.ABI + "-" + arch.OS + "-" + arch.CPU
+	case arch.OS == "any" && arch.CPU == "any":
+		return "any"
+	case arch.OS != "any" && arch.CPU != "any":
+		return "any-" + arch.OS + "-" + arch.CPU
+	default:
+		return arch.OS + "-" + arch.CPU
+	}
+}
+
+// Put an Arch built by hand, such as gnu-linux-armhf (or just a CPU),
+// into the form parsing its name would have given.
+func (arch Arch) canonical() Arch {
+	if arch.OS == "" && arch.CPU != "" {
+		arch.OS = "linux"
+	}
+	if arch.ABI == "" && arch.OS != "" {
+		arch.ABI = "gnu"
+		if abi, ok := osABIs[arch.OS]; ok {
+			arch.ABI = abi
+		}
+	}
+	if arch.ABI == "gnu" && arch.OS == "linux" {
+		if special, ok := specialArches[arch.CPU]; ok {
+			return special
+		}
+	}
+	return arch
+}
+
+// }}}
+
+// Comparison {{{
+
+// Return true if both are the same architecture (or wildcard). Unlike
+// comparing the structs, this knows that gnu-linux-armhf and
+// gnueabihf-linux-arm are both armhf.
+func (arch Arch) Equal(other Arch) bool {
+	return arch.canonical() == other.canonical()
+}
+
+// Return true if the architecture is, or matches, the named architecture
+// or wildcard, such as "linux-any" or "any-arm", the way
+// dpkg-architecture -i does. An unparsable name matches nothing.
+func (arch *Arch) Matches(name string) bool {
+	other, err := ParseArch(name)
+	if err != nil {
+		return false
+	}
+	return arch.Is(other)
+}
+
+// }}}
+
+// Multiarch {{{
+
+// GNU names of CPUs, where they differ from Debian's.
+var gnuCPUs = map[string]string{
+	"amd64":   "x86_64",
+	"arm64":   "aarch64",
+	"loong64": "loongarch64",
+	"ppc64el": "powerpc64le",
+	"ppc64":   "powerpc64",
+}
+
+// Return the multiarch tuple of the architecture, as used for library
+// paths such as /usr/lib/x86_64-linux-gnu, and as dpkg-architecture's
+// DEB_HOST_MULTIARCH. Only Linux, kFreeBSD and the Hurd have one.
+func (arch Arch) MultiarchTuple() (string, error) {
+	arch = arch.canonical()
+	if arch.IsWildcard() || arch.CPU == "all" {
+		return "", fmt.Errorf("%s has no multiarch tuple", arch.String())
+	}
+	cpu := arch.CPU
+	if gnu, ok := gnuCPUs[cpu]; ok {
+		cpu = gnu
+	}
+	if arch.ABI == "gnux32" {
+		cpu = "x86_64"
+	}
+
+	switch arch.OS {
+	case "linux":
+		return cpu + "-linux-" + arch.ABI, nil
+	case "kfreebsd":
+		return cpu + "-kfreebsd-" + arch.ABI, nil
+	case "hurd":
+		return cpu + "-gnu", nil
+	}
+	return "", fmt.Errorf("%s has no multiarch tuple", arch.String())
+}
+
+// Return the architecture with the given multiarch tuple, such as
+// x86_64-linux-gnu, among those given (such as ReleaseArchitectures).
+func ArchForMultiarchTuple(tuple string, arches []Arch) (*Arch, error) {
+	for _, arch := range arches {
+		if got, err := arch.MultiarchTuple(); err == nil && got == tuple {
+			arch := arch
+			return &arch, nil
+		}
+	}
+	return nil, fmt.Errorf("No architecture has the multiarch tuple %s", tuple)
+}
+
+// }}}
+
+// vim: foldmethod=marker
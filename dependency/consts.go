@@ -25,4 +25,19 @@ var (
 	All = Arch{ABI: "all", OS: "all", CPU: "all"}
 )
 
+// Debian's release architectures (as of trixie), and i386, which is still
+// built for, but only to run 32-bit software on amd64.
+var (
+	AMD64   = Arch{ABI: "gnu", OS: "linux", CPU: "amd64"}
+	ARM64   = Arch{ABI: "gnu", OS: "linux", CPU: "arm64"}
+	ARMEL   = Arch{ABI: "gnueabi", OS: "linux", CPU: "arm"}
+	ARMHF   = Arch{ABI: "gnueabihf", OS: "linux", CPU: "arm"}
+	I386    = Arch{ABI: "gnu", OS: "linux", CPU: "i386"}
+	PPC64EL = Arch{ABI: "gnu", OS: "linux", CPU: "ppc64el"}
+	RISCV64 = Arch{ABI: "gnu", OS: "linux", CPU: "riscv64"}
+	S390X   = Arch{ABI: "gnu", OS: "linux", CPU: "s390x"}
+
+	ReleaseArchitectures = []Arch{AMD64, ARM64, ARMEL, ARMHF, I386, PPC64EL, RISCV64, S390X}
+)
+
 // vim: foldmethod=marker
@@ -75,6 +75,16 @@ func (dep *Dependency) GetSubstvars() []Possibility {
 	return possies
 }
 
+// ArchQualifier returns the multi-arch qualifier of the Possibility as it
+// was written ("any", "native" or an architecture name), or "" if there
+// isn't one.
+func (possi Possibility) ArchQualifier() string {
+	if possi.Arch == nil {
+		return ""
+	}
+	return possi.Arch.String()
+}
+
 func (v VersionRelation) SatisfiedBy(ver version.Version) bool {
 	vVer, err := version.Parse(v.Number)
 	if err != nil {
@@ -99,4 +109,34 @@ func (v VersionRelation) SatisfiedBy(ver version.Version) bool {
 	return false
 }
 
+// Return true if a package at the given version satisfies the
+// Possibility's version restriction, or if there isn't one. The name,
+// architecture and build profiles of the Possibility aren't checked.
+func (possi Possibility) SatisfiedBy(ver version.Version) bool {
+	return possi.Version == nil || possi.Version.SatisfiedBy(ver)
+}
+
+// Return true if any Possibility of the Relation is satisfied by one of
+// the candidates, a map of package name to version (such as what's
+// installed). A Possibility with a multi-arch qualifier, such as
+// "libc6:amd64", is checked against a candidate with the qualified name
+// first, then the plain name. Substvars are never satisfied.
+func (relation Relation) SatisfiedBy(candidates map[string]version.Version) bool {
+	for _, possi := range relation.Possibilities {
+		if possi.Substvar {
+			continue
+		}
+		ver, ok := candidates[possi.Name]
+		if qualifier := possi.ArchQualifier(); qualifier != "" {
+			if qualified, found := candidates[possi.Name+":"+qualifier]; found {
+				ver, ok = qualified, true
+			}
+		}
+		if ok && possi.SatisfiedBy(ver) {
+			return true
+		}
+	}
+	return false
+}
+
 // vim: foldmethod=marker
@@ -118,4 +118,53 @@ func TestVersionRelationSatisfiedBy(t *testing.T) {
 	}
 }
 
+func TestPossibilitySatisfiedBy(t *testing.T) {
+	dep, err := dependency.Parse("foo (>= 1:2.0~rc1), bar")
+	isok(t, err)
+
+	for _, test := range []struct {
+		Version string
+		Match   bool
+	}{
+		{"1:2.0~rc1", true},
+		{"1:2.0", true},
+		{"2.0", false},
+		{"1:1.9", false},
+	} {
+		v, err := version.Parse(test.Version)
+		isok(t, err)
+		assert(t, dep.Relations[0].Possibilities[0].SatisfiedBy(v) == test.Match)
+		/* No version restriction at all */
+		assert(t, dep.Relations[1].Possibilities[0].SatisfiedBy(v))
+	}
+}
+
+func TestRelationSatisfiedBy(t *testing.T) {
+	dep, err := dependency.Parse("default-mta (>= 4.96) | mail-transport-agent, libc6:amd64 (>= 2.36), ${misc:Depends}")
+	isok(t, err)
+
+	installed := func(pairs ...string) map[string]version.Version {
+		ret := map[string]version.Version{}
+		for i := 0; i < len(pairs); i += 2 {
+			v, err := version.Parse(pairs[i+1])
+			isok(t, err)
+			ret[pairs[i]] = v
+		}
+		return ret
+	}
+
+	mta := dep.Relations[0]
+	assert(t, mta.SatisfiedBy(installed("default-mta", "4.96-15")))
+	assert(t, !mta.SatisfiedBy(installed("default-mta", "4.94-1")))
+	assert(t, mta.SatisfiedBy(installed("default-mta", "4.94-1", "mail-transport-agent", "0")))
+	assert(t, !mta.SatisfiedBy(installed()))
+
+	libc := dep.Relations[1]
+	assert(t, libc.SatisfiedBy(installed("libc6", "2.36-9")))
+	assert(t, libc.SatisfiedBy(installed("libc6", "2.31-13", "libc6:amd64", "2.36-9")))
+	assert(t, !libc.SatisfiedBy(installed("libc6", "2.36-9", "libc6:amd64", "2.31-13")))
+
+	assert(t, !dep.Relations[2].SatisfiedBy(installed("misc:Depends", "1.0")))
+}
+
 // vim: foldmethod=marker
@@ -4,12 +4,16 @@ The Dependency module provides an interface to parse and inspect Debian
 Dependency relationships.
 
 
- Dependency                |               foo, bar (>= 1.0) [amd64] | baz
-   -> Relations            | -> Relation        bar (>= 1.0) [amd64] | baz
-        -> Possibilities   | -> Possibility     bar (>= 1.0) [amd64]
+ Dependency                |               foo, bar (>= 1.0) [amd64] <!nocheck> | baz
+   -> Relations            | -> Relation        bar (>= 1.0) [amd64] <!nocheck> | baz
+        -> Possibilities   | -> Possibility     bar (>= 1.0) [amd64] <!nocheck>
            | Name          | -> Name            bar
            | Version       | -> Version             (>= 1.0)
            | Architectures | -> Arch                          amd64
-           | Stages        |
+           | StageSets     | -> Build profiles                       !nocheck
+
+Architectures are ABI-OS-CPU triplets, following dpkg's tuple table, so
+armhf is gnueabihf-linux-arm, and matches wildcards like linux-any and
+any-arm.
 */
 package dependency // import "pault.ag/go/debian/dependency"
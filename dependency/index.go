@@ -0,0 +1,148 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dependency // import "pault.ag/go/debian/dependency"
+
+import (
+	"sort"
+
+	"pault.ag/go/debian/version"
+)
+
+// PackageIndex {{{
+
+// A Candidate is a package that can satisfy a Possibility, either because
+// it has the right name, or because it Provides it.
+type Candidate struct {
+	Package string
+	Version version.Version
+
+	// Name of the virtual package, if this Candidate satisfies the
+	// Possibility through Provides.
+	Virtual string
+}
+
+type provided struct {
+	pkg     string
+	version version.Version
+
+	// Version the virtual package is provided at, set only for versioned
+	// Provides (`Provides: foo (= 1.2)`).
+	virtualVersion *version.Version
+}
+
+// A PackageIndex keeps track of every real package name, and every
+// virtual package name Provided by one, so that relations like
+// `Depends: mail-transport-agent` can be checked.
+type PackageIndex struct {
+	real    map[string][]version.Version
+	virtual map[string][]provided
+}
+
+// Create a new, empty PackageIndex.
+func NewPackageIndex() *PackageIndex {
+	return &PackageIndex{
+		real:    map[string][]version.Version{},
+		virtual: map[string][]provided{},
+	}
+}
+
+// Add a package, along with the parsed value of its Provides field.
+func (i *PackageIndex) Add(name string, ver version.Version, provides Dependency) {
+	i.real[name] = append(i.real[name], ver)
+	for _, possi := range provides.GetAllPossibilities() {
+		entry := provided{pkg: name, version: ver}
+		if possi.Version != nil && possi.Version.Operator == "=" {
+			if v, err := version.Parse(possi.Version.Number); err == nil {
+				entry.virtualVersion = &v
+			}
+		}
+		i.virtual[possi.Name] = append(i.virtual[possi.Name], entry)
+	}
+}
+
+// Return true if there is a real package with the given name.
+func (i *PackageIndex) IsReal(name string) bool {
+	return len(i.real[name]) != 0
+}
+
+// Return true if some package Provides the given name.
+func (i *PackageIndex) IsVirtual(name string) bool {
+	return len(i.virtual[name]) != 0
+}
+
+// Return every Candidate that satisfies the Possibility. Real packages
+// must match any version restriction. As in dpkg, an unversioned Provides
+// never satisfies a versioned relation, but a versioned Provides is checked
+// against the version it Provides.
+func (i *PackageIndex) Candidates(possi Possibility) []Candidate {
+	ret := []Candidate{}
+	for _, ver := range i.real[possi.Name] {
+		if possi.SatisfiedBy(ver) {
+			ret = append(ret, Candidate{Package: possi.Name, Version: ver})
+		}
+	}
+	for _, entry := range i.virtual[possi.Name] {
+		if possi.Version != nil {
+			if entry.virtualVersion == nil || !possi.Version.SatisfiedBy(*entry.virtualVersion) {
+				continue
+			}
+		}
+		ret = append(ret, Candidate{Package: entry.pkg, Version: entry.version, Virtual: possi.Name})
+	}
+	sort.SliceStable(ret, func(a, b int) bool {
+		if ret[a].Package != ret[b].Package {
+			return ret[a].Package < ret[b].Package
+		}
+		return version.Compare(ret[a].Version, ret[b].Version) > 0
+	})
+	return ret
+}
+
+// Return true if anything in the PackageIndex satisfies the Possibility.
+func (i *PackageIndex) Satisfies(possi Possibility) bool {
+	return len(i.Candidates(possi)) != 0
+}
+
+// Return true if any of the Relation's Possibilities can be satisfied.
+func (i *PackageIndex) SatisfiesRelation(relation Relation) bool {
+	for _, possi := range relation.Possibilities {
+		if i.Satisfies(possi) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return every Relation in the Dependency that nothing in the PackageIndex
+// can satisfy.
+func (i *PackageIndex) Unsatisfied(dep Dependency) []Relation {
+	ret := []Relation{}
+	for _, relation := range dep.Relations {
+		if !i.SatisfiesRelation(relation) {
+			ret = append(ret, relation)
+		}
+	}
+	return ret
+}
+
+// }}}
+
+// vim: foldmethod=marker
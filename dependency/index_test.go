@@ -0,0 +1,88 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dependency_test
+
+import (
+	"testing"
+
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+/*
+ *
+ */
+
+func newPackageIndex(t *testing.T) *dependency.PackageIndex {
+	index := dependency.NewPackageIndex()
+	for _, el := range []struct{ name, version, provides string }{
+		{"postfix", "3.7-1", "mail-transport-agent"},
+		{"exim4-daemon-light", "4.96-15", "mail-transport-agent"},
+		{"libfoo1", "1.2-1", ""},
+		{"libfoo-compat", "2.0-1", "libfoo1 (= 1.5)"},
+		{"awk-provider", "1.0-1", "awk"},
+	} {
+		ver, err := version.Parse(el.version)
+		isok(t, err)
+		provides, err := dependency.Parse(el.provides)
+		isok(t, err)
+		index.Add(el.name, ver, *provides)
+	}
+	return index
+}
+
+func TestPackageIndexCandidates(t *testing.T) {
+	index := newPackageIndex(t)
+	assert(t, index.IsVirtual("mail-transport-agent"))
+	assert(t, !index.IsReal("mail-transport-agent"))
+	assert(t, index.IsReal("libfoo1"))
+
+	dep, err := dependency.Parse("mail-transport-agent")
+	isok(t, err)
+	candidates := index.Candidates(dep.Relations[0].Possibilities[0])
+	assert(t, len(candidates) == 2)
+	assert(t, candidates[0].Package == "exim4-daemon-light")
+	assert(t, candidates[0].Virtual == "mail-transport-agent")
+
+	dep, err = dependency.Parse("libfoo1 (>= 1.4)")
+	isok(t, err)
+	candidates = index.Candidates(dep.Relations[0].Possibilities[0])
+	assert(t, len(candidates) == 1)
+	assert(t, candidates[0].Package == "libfoo-compat")
+	assert(t, candidates[0].Version.String() == "2.0-1")
+
+	dep, err = dependency.Parse("libfoo1 (>= 1.0)")
+	isok(t, err)
+	assert(t, len(index.Candidates(dep.Relations[0].Possibilities[0])) == 2)
+}
+
+func TestPackageIndexUnsatisfied(t *testing.T) {
+	index := newPackageIndex(t)
+	dep, err := dependency.Parse("mail-transport-agent, awk (>= 1.0), libfoo1 (>= 3) | libbar, libfoo1 (<< 2)")
+	isok(t, err)
+	unsatisfied := index.Unsatisfied(*dep)
+	assert(t, len(unsatisfied) == 2)
+	assert(t, unsatisfied[0].Possibilities[0].Name == "awk")
+	assert(t, unsatisfied[1].Possibilities[1].Name == "libbar")
+	assert(t, index.SatisfiesRelation(dep.Relations[3]))
+}
+
+// vim: foldmethod=marker
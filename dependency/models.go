@@ -43,15 +43,46 @@ type VersionRelation struct {
 	Operator string
 }
 
+// Stage is a single term of a build profile restriction, such as the
+// "!nocheck" of "<!nocheck>": the name of a build profile (historically,
+// a bootstrap "stage", such as "stage1"), and whether it is negated.
+//
+// A Stage is satisfied if the profile is active, or, if Not is set, if it
+// isn't.
 type Stage struct {
 	Not  bool
 	Name string
 }
 
+// StageSet is one restriction list, written between angle brackets, such
+// as "<stage1 !cross>". Every Stage in the list has to be satisfied for the
+// StageSet to be.
 type StageSet struct {
 	Stages []Stage
 }
 
+// Return true if the Stage is satisfied with the given build profiles
+// active.
+func (stage Stage) Matches(profiles []string) bool {
+	for _, profile := range profiles {
+		if profile == stage.Name {
+			return !stage.Not
+		}
+	}
+	return stage.Not
+}
+
+// Return true if every Stage in the set is satisfied with the given build
+// profiles active.
+func (stageSet StageSet) Matches(profiles []string) bool {
+	for _, stage := range stageSet.Stages {
+		if !stage.Matches(profiles) {
+			return false
+		}
+	}
+	return true
+}
+
 // Possibility models a concrete Possibility that may be satisfied in order
 // to satisfy the Dependency Relation. Given the Dependency line:
 //
@@ -59,10 +90,17 @@ type StageSet struct {
 //
 // All of foo, bar and baz are Possibilities. Possibilities may come with
 // further restrictions, such as restrictions on Version, Architecture, or
-// Build Stage.
+// build profile, as in "foo <!nocheck> <stage1 cross>".
+//
+// StageSets is the build profile restriction formula (see the BuildProfileSpec
+// page on the Debian wiki): the Possibility applies if any one of the
+// StageSets matches the active profiles (see ProfilesMatch), or if there
+// are no StageSets at all.
 //
 type Possibility struct {
-	Name          string
+	Name string
+	// The multi-arch qualifier, such as the "any" of "python3:any", or the
+	// "amd64" of "libfoo-dev:amd64". This is nil if there wasn't one.
 	Arch          *Arch
 	Architectures *ArchSet
 	StageSets     []StageSet
@@ -70,6 +108,21 @@ type Possibility struct {
 	Substvar      bool
 }
 
+// Return true if the Possibility applies when building with the given
+// build profiles active; that is, if it has no build profile restrictions,
+// or any one of its StageSets matches.
+func (possi Possibility) ProfilesMatch(profiles []string) bool {
+	if len(possi.StageSets) == 0 {
+		return true
+	}
+	for _, stageSet := range possi.StageSets {
+		if stageSet.Matches(profiles) {
+			return true
+		}
+	}
+	return false
+}
+
 // }}}
 
 // A Relation is a set of Possibilities that must be satisfied. Given the
@@ -0,0 +1,165 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dependency // import "pault.ag/go/debian/dependency"
+
+import (
+	"sort"
+
+	"pault.ag/go/debian/version"
+)
+
+// Implication {{{
+
+// Return true if every version that satisfies the VersionRelation also
+// satisfies other; so "(>= 2)" implies "(>= 1)", and "(= 2)" implies
+// "(<< 3)". Relations that can't be compared (such as those with an
+// unparsable version) only imply themselves.
+func (v VersionRelation) Implies(other VersionRelation) bool {
+	if v == other {
+		return true
+	}
+	vVer, err := version.Parse(v.Number)
+	if err != nil {
+		return false
+	}
+	otherVer, err := version.Parse(other.Number)
+	if err != nil {
+		return false
+	}
+
+	q := version.Compare(vVer, otherVer)
+	switch v.Operator + other.Operator {
+	case "=" + ">=", "=" + "<=", "=" + ">>", "=" + "<<", "=" + "=":
+		return other.SatisfiedBy(vVer)
+	case ">=" + ">=", ">>" + ">=", ">>" + ">>":
+		return q >= 0
+	case ">=" + ">>":
+		return q > 0
+	case "<=" + "<=", "<<" + "<=", "<<" + "<<":
+		return q <= 0
+	case "<=" + "<<":
+		return q < 0
+	}
+	return false
+}
+
+// Return the Possibility without its version restriction, as a string, so
+// that Possibilities on the same package, with the same multi-arch
+// qualifier, architecture and build profile restrictions, compare equal.
+func (possi Possibility) unversioned() string {
+	possi.Version = nil
+	return possi.String()
+}
+
+// Return true if anything that satisfies the Possibility also satisfies
+// other. Substvars only imply themselves.
+func (possi Possibility) implies(other Possibility) bool {
+	if possi.Substvar || other.Substvar {
+		return possi.String() == other.String()
+	}
+	if possi.unversioned() != other.unversioned() {
+		return false
+	}
+	switch {
+	case other.Version == nil:
+		return true
+	case possi.Version == nil:
+		return false
+	}
+	return possi.Version.Implies(*other.Version)
+}
+
+// }}}
+
+// Normalize {{{
+
+// Return the Relation without any Possibility that's an exact duplicate of
+// one before it.
+func (relation Relation) dedupe() Relation {
+	seen := map[string]bool{}
+	ret := Relation{Possibilities: []Possibility{}}
+	for _, possi := range relation.Possibilities {
+		key := possi.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ret.Possibilities = append(ret.Possibilities, possi)
+	}
+	return ret
+}
+
+// Return true if the Relation at index i is already implied by another
+// Relation with a single Possibility; when two are equivalent, the first
+// is kept.
+func redundant(relations []Relation, i int) bool {
+	for j, other := range relations {
+		if j == i || len(other.Possibilities) != 1 {
+			continue
+		}
+		possi := other.Possibilities[0]
+		for _, candidate := range relations[i].Possibilities {
+			if !possi.implies(candidate) {
+				continue
+			}
+			if i < j && len(relations[i].Possibilities) == 1 && candidate.implies(possi) {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Return a copy of the Dependency cleaned up for writing out, for tooling
+// that appends Relations programmatically:
+//
+// Exact duplicate Possibilities within a Relation are dropped, as is any
+// Relation that another one already implies, so "foo (>= 1), foo (>= 2)"
+// becomes "foo (>= 2)", and "foo, foo | bar" becomes "foo". Relations
+// are then sorted as Format does, by package name with substvars last.
+//
+// Relations are never combined into one that neither said, so
+// "foo (>= 1), foo (<< 2)" is left alone.
+func (dep Dependency) Normalize() Dependency {
+	relations := []Relation{}
+	for _, relation := range dep.Relations {
+		if len(relation.Possibilities) == 0 {
+			continue
+		}
+		relations = append(relations, relation.dedupe())
+	}
+
+	ret := Dependency{Relations: []Relation{}}
+	for i, relation := range relations {
+		if !redundant(relations, i) {
+			ret.Relations = append(ret.Relations, relation)
+		}
+	}
+	sort.SliceStable(ret.Relations, func(i, j int) bool {
+		return relationLess(ret.Relations[i].String(), ret.Relations[j].String())
+	})
+	return ret
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,90 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dependency_test
+
+import (
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/dependency"
+)
+
+/*
+ *
+ */
+
+func TestVersionRelationImplies(t *testing.T) {
+	for _, test := range []struct {
+		A, B    string
+		Implies bool
+	}{
+		{">= 2", ">= 1", true},
+		{">= 1", ">= 2", false},
+		{">= 1", ">= 1", true},
+		{">> 1", ">= 1", true},
+		{">= 1", ">> 1", false},
+		{"= 2", ">= 1", true},
+		{"= 2", "<< 2", false},
+		{"<< 2", "<= 2", true},
+		{"<= 2", "<< 2", false},
+		{"<= 1", "<< 2", true},
+		{">= 1", "<= 2", false},
+	} {
+		var a, b dependency.VersionRelation
+		a.Operator, a.Number, _ = strings.Cut(test.A, " ")
+		b.Operator, b.Number, _ = strings.Cut(test.B, " ")
+		if a.Implies(b) != test.Implies {
+			t.Errorf("(%s) implies (%s) should be %t", test.A, test.B, test.Implies)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for in, out := range map[string]string{
+		"foo (>= 1), foo (>= 2)":                  "foo (>= 2)",
+		"foo (>= 2), foo (>= 1)":                  "foo (>= 2)",
+		"foo, foo (>= 1)":                         "foo (>= 1)",
+		"foo, foo | bar":                          "foo",
+		"foo | foo | bar, baz":                    "baz, foo | bar",
+		"bar, foo, bar":                           "bar, foo",
+		"foo (>= 1), foo (<< 2)":                  "foo (<< 2), foo (>= 1)",
+		"foo:any (>= 2), foo (>= 1)":              "foo (>= 1), foo:any (>= 2)",
+		"foo [amd64], foo [i386]":                 "foo [amd64], foo [i386]",
+		"foo <!nocheck> (>= 1), foo <!nocheck>":   "foo (>= 1) <!nocheck>",
+		"${misc:Depends}, bar, ${misc:Depends}":   "bar, ${misc:Depends}",
+		"${shlibs:Depends}, ${misc:Depends}, abc": "abc, ${misc:Depends}, ${shlibs:Depends}",
+	} {
+		dep, err := dependency.Parse(in)
+		isok(t, err)
+		if got := dep.Normalize().String(); got != out {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, out)
+		}
+	}
+}
+
+func TestNormalizeDoesNotModify(t *testing.T) {
+	dep, err := dependency.Parse("foo | foo, foo (>= 1)")
+	isok(t, err)
+	dep.Normalize()
+	assert(t, dep.String() == "foo | foo, foo (>= 1)")
+}
+
+// vim: foldmethod=marker
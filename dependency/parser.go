@@ -23,20 +23,130 @@ package dependency // import "pault.ag/go/debian/dependency"
 import (
 	"errors"
 	"fmt"
+	"strings"
+
+	"pault.ag/go/debian/version"
 )
 
 // Parse a string into a Dependency object. The input should look something
 // like "foo, bar | baz".
+//
+// If the input can't be parsed, the error is a *ParseError, which says
+// where in the input things went wrong. Parse is lenient, in the same way
+// as ParseWith with the zero ParseOptions, and drops any warnings.
 func Parse(in string) (*Dependency, error) {
-	ibuf := input{Index: 0, Data: in}
+	dep, _, err := ParseWith(in, ParseOptions{})
+	return dep, err
+}
+
+// ParseOptions {{{
+
+// ParseOptions control how forgiving ParseWith is of the oddities found in
+// real-world relationship fields, such as trailing commas, empty
+// alternatives, obsolete "<" and ">" operators, or version numbers that
+// aren't valid versions.
+type ParseOptions struct {
+	// If set, any of those oddities is an error. Otherwise, they're
+	// worked around, and returned as warnings.
+	Strict bool
+}
+
+// Parse a string into a Dependency object, as with Parse, according to the
+// given options. Anything odd (but not fatal) about the input is returned
+// as a list of warnings, unless opts.Strict is set, in which case the first
+// one is returned as the error.
+func ParseWith(in string, opts ParseOptions) (*Dependency, []*ParseError, error) {
+	ibuf := input{Index: 0, Data: in, strict: opts.Strict, warnings: []*ParseError{}}
 	dep := &Dependency{Relations: []Relation{}}
 	err := parseDependency(&ibuf, dep)
 	if err != nil {
-		return nil, err
+		if parseErr, ok := err.(*ParseError); ok {
+			return nil, ibuf.warnings, parseErr
+		}
+		return nil, ibuf.warnings, newParseError(&ibuf, err)
 	}
-	return dep, nil
+	return dep, ibuf.warnings, nil
+}
+
+// }}}
+
+// ParseError {{{
+
+// A ParseError is returned by Parse when the input isn't a valid
+// relationship field, and has enough information to point at the problem
+// in a long (say, 40 line Build-Depends) field.
+type ParseError struct {
+	// What went wrong.
+	Err error
+	// Byte offset into the input where parsing stopped.
+	Offset int
+	// Line and Column (both counting from 1) of Offset, since relationship
+	// fields are often spread over a few lines.
+	Line   int
+	Column int
+	// The token (package name, version, arch and so on) that was being
+	// parsed at the time.
+	Token string
+	// A snippet of the input around Offset.
+	Context string
 }
 
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s (line %d, column %d, near %q)", e.Err, e.Line, e.Column, e.Context)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// How much input either side of the error to show.
+const parseErrorContext = 20
+
+// Bytes that separate one token from the next.
+const tokenSeparators = " \t\r\n,|()[]<>"
+
+func newParseError(input *input, err error) *ParseError {
+	data := input.Data
+	offset := input.Index
+	if offset > len(data) {
+		offset = len(data)
+	}
+
+	ret := ParseError{
+		Err:    err,
+		Offset: offset,
+		Line:   strings.Count(data[:offset], "\n") + 1,
+		Column: offset - strings.LastIndex(data[:offset], "\n"),
+	}
+
+	/* The token is whatever run of non-separators the offset is in (or
+	 * just after, since we've usually just read it) */
+	start := strings.LastIndexAny(data[:offset], tokenSeparators) + 1
+	end := offset
+	if i := strings.IndexAny(data[offset:], tokenSeparators); i >= 0 {
+		end = offset + i
+	} else {
+		end = len(data)
+	}
+	if start == end && end < len(data) {
+		end++ /* The separator itself was the problem */
+	}
+	ret.Token = data[start:end]
+
+	from, to := offset-parseErrorContext, offset+parseErrorContext
+	if from < 0 {
+		from = 0
+	}
+	if to > len(data) {
+		to = len(data)
+	}
+	ret.Context = strings.Join(strings.Fields(data[from:to]), " ")
+
+	return &ret
+}
+
+// }}}
+
 // input Model {{{
 
 /*
@@ -44,6 +154,20 @@ func Parse(in string) (*Dependency, error) {
 type input struct {
 	Data  string
 	Index int
+
+	strict   bool
+	warnings []*ParseError
+}
+
+/* Note something odd at the current position. In strict mode, that's an
+ * error (which is returned); otherwise, it's added to the warnings. */
+func (i *input) warn(message string) error {
+	err := newParseError(i, errors.New(message))
+	if i.strict {
+		return err
+	}
+	i.warnings = append(i.warnings, err)
+	return nil
 }
 
 /*
@@ -63,6 +187,20 @@ func (i *input) Next() byte {
 	return chr
 }
 
+/* Consume everything up to (but not including) the first of the stop bytes,
+ * or the end of the input, and return it. This is a slice of the input,
+ * rather than a copy, so it's cheap. */
+func (i *input) TakeUntil(stop string) string {
+	start := i.Index
+	for i.Index < len(i.Data) && strings.IndexByte(stop, i.Data[i.Index]) < 0 {
+		i.Index++
+	}
+	if i.Index > len(i.Data) {
+		return ""
+	}
+	return i.Data[start:i.Index]
+}
+
 // }}}
 
 // Parse Helpers {{{
@@ -88,6 +226,12 @@ func eatWhitespace(input *input) {
 func parseDependency(input *input, ret *Dependency) error {
 	eatWhitespace(input)
 
+	if input.Peek() == ',' {
+		if err := input.warn("Empty relation"); err != nil {
+			return err
+		}
+	}
+
 	for {
 		peek := input.Peek()
 		switch peek {
@@ -96,6 +240,12 @@ func parseDependency(input *input, ret *Dependency) error {
 		case ',': /* Next relation set */
 			input.Next()
 			eatWhitespace(input)
+			if next := input.Peek(); next == ',' || next == 0 {
+				/* e.g. a trailing comma in Build-Depends */
+				if err := input.warn("Empty relation"); err != nil {
+					return err
+				}
+			}
 			continue
 		}
 		err := parseRelation(input, ret)
@@ -124,6 +274,11 @@ func parseRelation(input *input, dependency *Dependency) error {
 		case '|': /* Next Possi */
 			input.Next()
 			eatWhitespace(input)
+			if next := input.Peek(); next == '|' || next == ',' || next == 0 {
+				if err := input.warn("Empty alternative"); err != nil {
+					return err
+				}
+			}
 			continue
 		}
 		err := parsePossibility(input, ret)
@@ -166,7 +321,7 @@ func parsePossibility(input *input, relation *Relation) error {
 				return err
 			}
 			continue
-		case ' ', '(':
+		case ' ', '\t', '\r', '\n', '(':
 			err := parsePossibilityControllers(input, ret)
 			if err != nil {
 				return err
@@ -180,7 +335,7 @@ func parsePossibility(input *input, relation *Relation) error {
 			return nil
 		}
 		/* Not a control, let's append */
-		ret.Name += string(input.Next())
+		ret.Name += input.TakeUntil(":( \t\r\n,|\x00")
 	}
 }
 
@@ -205,18 +360,24 @@ func parseSubstvar(input *input, relation *Relation) error {
 			relation.Possibilities = append(relation.Possibilities, *ret)
 			return nil
 		}
-		ret.Name += string(input.Next())
+		ret.Name += input.TakeUntil("}\x00")
 	}
 }
 
 /* */
 func parseMultiarch(input *input, possi *Possibility) error {
 	input.Next() /* mandated to be a : */
+	if possi.Arch != nil {
+		return fmt.Errorf("Only one arch qualifier per Possibility, please! (%s)", possi.Name)
+	}
 	name := ""
 	for {
 		peek := input.Peek()
 		switch peek {
-		case ',', '|', 0, ' ', '(', '[', '<':
+		case ',', '|', 0, ' ', '(', '[', '<', ':':
+			if err := validArchQualifier(name); err != nil {
+				return fmt.Errorf("%s: %s", possi.Name, err)
+			}
 			arch, err := ParseArch(name)
 			if err != nil {
 				return err
@@ -224,12 +385,39 @@ func parseMultiarch(input *input, possi *Possibility) error {
 			possi.Arch = arch
 			return nil
 		default:
-			name += string(input.Next())
+			name += input.TakeUntil(",|\x00 ([<:")
 		}
 	}
 	return nil
 }
 
+/* An arch qualifier is either "any", "native", or a single, concrete
+ * architecture name; wildcards like "linux-any" and "all" make no sense
+ * there. */
+func validArchQualifier(name string) error {
+	switch name {
+	case "any", "native":
+		return nil
+	case "":
+		return errors.New("Empty arch qualifier")
+	case "all":
+		return errors.New("Arch qualifier can't be 'all'")
+	}
+	for _, chr := range name {
+		if !(chr >= 'a' && chr <= 'z') && !(chr >= '0' && chr <= '9') && chr != '-' {
+			return fmt.Errorf("Invalid character '%c' in arch qualifier '%s'", chr, name)
+		}
+	}
+	arch, err := ParseArch(name)
+	if err != nil {
+		return err
+	}
+	if arch.IsWildcard() {
+		return fmt.Errorf("Arch qualifier '%s' can't be a wildcard", name)
+	}
+	return nil
+}
+
 /* */
 func parsePossibilityControllers(input *input, possi *Possibility) error {
 	for {
@@ -288,6 +476,12 @@ func parsePossibilityVersion(input *input, possi *Possibility) error {
 	if err != nil {
 		return err
 	}
+	version.Number = strings.TrimSpace(version.Number)
+	if !validVersion(version.Number) {
+		if err := input.warn(fmt.Sprintf("Invalid version '%s'", version.Number)); err != nil {
+			return err
+		}
+	}
 
 	input.Next() /* OK, let's tidy up */
 	// assert ch == ')'
@@ -296,6 +490,16 @@ func parsePossibilityVersion(input *input, possi *Possibility) error {
 	return nil
 }
 
+/* Substvars (such as "${binary:Version}") stand in for a valid version, so
+ * get the benefit of the doubt. */
+func validVersion(number string) bool {
+	if strings.Contains(number, "${") {
+		return true
+	}
+	_, err := version.Parse(number)
+	return err == nil
+}
+
 /* */
 func parsePossibilityOperator(input *input, version *VersionRelation) error {
 	eatWhitespace(input)
@@ -314,6 +518,14 @@ func parsePossibilityOperator(input *input, version *VersionRelation) error {
 		return errors.New("Oh no. Reached EOF before Operator finished")
 	}
 
+	if (leader == '<' || leader == '>') && secondary != '<' && secondary != '>' && secondary != '=' {
+		/* The long-obsolete "<" and ">", which dpkg reads as "<=" and
+		 * ">=" (not "<<" and ">>", as you might think) */
+		input.Index--
+		version.Operator = string(leader) + "="
+		return input.warn(fmt.Sprintf("Obsolete operator '%c', meaning '%s'", leader, version.Operator))
+	}
+
 	operator := string([]rune{rune(leader), rune(secondary)})
 
 	switch operator {
@@ -340,7 +552,7 @@ func parsePossibilityNumber(input *input, version *VersionRelation) error {
 		case ')':
 			return nil
 		}
-		version.Number += string(input.Next())
+		version.Number += input.TakeUntil(")\x00")
 	}
 }
 
@@ -402,7 +614,7 @@ func parsePossibilityArch(input *input, possi *Possibility) error {
 			)
 			return nil
 		}
-		arch += string(input.Next())
+		arch += input.TakeUntil("]! \x00")
 	}
 }
 
@@ -413,12 +625,16 @@ func parsePossibilityStageSet(input *input, possi *Possibility) error {
 
 	stageSet := StageSet{}
 	for {
+		eatWhitespace(input)
 		peek := input.Peek()
 		switch peek {
 		case 0:
 			return errors.New("Oh no. Reached EOF before StageSet finished")
 		case '>':
 			input.Next()
+			if len(stageSet.Stages) == 0 {
+				return errors.New("Empty build profile restriction (<>)")
+			}
 			possi.StageSets = append(possi.StageSets, stageSet)
 			return nil
 		}
@@ -447,10 +663,13 @@ func parsePossibilityStage(input *input, stageSet *StageSet) error {
 			}
 			stage.Not = !stage.Not
 		case '>', ' ': /* Let our parent deal with both of these */
+			if stage.Name == "" {
+				return errors.New("Build profile name missing after '!'")
+			}
 			stageSet.Stages = append(stageSet.Stages, stage)
 			return nil
 		}
-		stage.Name += string(input.Next())
+		stage.Name += input.TakeUntil("!> \x00")
 	}
 }
 
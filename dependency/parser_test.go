@@ -23,6 +23,7 @@ package dependency_test
 import (
 	"log"
 	"runtime/debug"
+	"strings"
 	"testing"
 
 	"pault.ag/go/debian/dependency"
@@ -86,6 +87,24 @@ func TestMultiarchParse(t *testing.T) {
 	assert(t, dep.Relations[0].Possibilities[0].Architectures.Architectures[1].CPU == "sparc")
 }
 
+func TestArchQualifier(t *testing.T) {
+	dep, err := dependency.Parse("python3:any (>= 3.11), libfoo-dev:native | libfoo-dev:amd64 [amd64], bar")
+	isok(t, err)
+
+	assert(t, dep.Relations[0].Possibilities[0].Name == "python3")
+	assert(t, dep.Relations[0].Possibilities[0].ArchQualifier() == "any")
+	assert(t, dep.Relations[1].Possibilities[0].Name == "libfoo-dev")
+	assert(t, dep.Relations[1].Possibilities[0].ArchQualifier() == "native")
+	assert(t, dep.Relations[1].Possibilities[1].ArchQualifier() == "amd64")
+	assert(t, dep.Relations[2].Possibilities[0].ArchQualifier() == "")
+	assert(t, dep.String() == "python3:any (>= 3.11), libfoo-dev:native | libfoo-dev:amd64 [amd64], bar")
+
+	for _, invalid := range []string{"foo:", "foo:all", "foo:linux-any", "foo:Amd64", "foo:any:amd64"} {
+		_, err := dependency.Parse(invalid)
+		notok(t, err)
+	}
+}
+
 func TestTwoRelations(t *testing.T) {
 	dep, err := dependency.Parse("foo, bar")
 	isok(t, err)
@@ -245,6 +264,25 @@ func TestTwoStages(t *testing.T) {
 	assert(t, possi.StageSets[1].Stages[1].Name == "cross")
 }
 
+func TestProfilesMatch(t *testing.T) {
+	dep, err := dependency.Parse("foo <stage1 !cross> <!stage1 cross>, bar <!nocheck>, baz")
+	isok(t, err)
+	foo := dep.Relations[0].Possibilities[0]
+	bar := dep.Relations[1].Possibilities[0]
+	baz := dep.Relations[2].Possibilities[0]
+
+	assert(t, !foo.ProfilesMatch(nil))
+	assert(t, foo.ProfilesMatch([]string{"stage1"}))
+	assert(t, foo.ProfilesMatch([]string{"cross"}))
+	assert(t, !foo.ProfilesMatch([]string{"stage1", "cross"}))
+
+	assert(t, bar.ProfilesMatch(nil))
+	assert(t, bar.ProfilesMatch([]string{"stage1"}))
+	assert(t, !bar.ProfilesMatch([]string{"nocheck"}))
+
+	assert(t, baz.ProfilesMatch([]string{"nocheck"}))
+}
+
 func TestBadVersion(t *testing.T) {
 	vers := []string{
 		"foo (>= 1.0",
@@ -292,6 +330,10 @@ func TestBadStages(t *testing.T) {
 		"foo <st",
 		"foo <s",
 		"foo <",
+		"foo <>",
+		"foo < >",
+		"foo <!>",
+		"foo <stage1 !>",
 	}
 
 	for _, ver := range vers {
@@ -333,4 +375,61 @@ func TestInsaneRoundTrip(t *testing.T) {
 	assert(t, dep.String() == rtDep.String())
 }
 
+func TestParseError(t *testing.T) {
+	_, err := dependency.Parse("debhelper-compat (= 13),\n foo (>= 1.0),\n bar (>= 2.0) baz,\n quux")
+	notok(t, err)
+	parseErr, ok := err.(*dependency.ParseError)
+	assert(t, ok)
+	assert(t, parseErr.Line == 3)
+	assert(t, parseErr.Column == 15)
+	assert(t, parseErr.Token == "baz")
+	assert(t, strings.Contains(parseErr.Context, "(>= 2.0) baz"))
+	assert(t, strings.Contains(err.Error(), "Trailing garbage"))
+	assert(t, strings.Contains(err.Error(), "line 3"))
+
+	_, err = dependency.Parse("foo, bar:linux-any")
+	notok(t, err)
+	parseErr, ok = err.(*dependency.ParseError)
+	assert(t, ok)
+	assert(t, parseErr.Offset == 18)
+	assert(t, parseErr.Token == "bar:linux-any")
+}
+
+func TestParseWith(t *testing.T) {
+	in := "foo (> 1.0), bar | | baz (>= 2.0 ), quux (= ${binary:Version}), frob (>= not_a_version),"
+
+	dep, warnings, err := dependency.ParseWith(in, dependency.ParseOptions{})
+	isok(t, err)
+	assert(t, len(dep.Relations) == 4)
+	assert(t, len(warnings) == 4)
+	assert(t, strings.Contains(warnings[0].Error(), "Obsolete operator"))
+	assert(t, strings.Contains(warnings[1].Error(), "Empty alternative"))
+	assert(t, strings.Contains(warnings[2].Error(), "Invalid version"))
+	assert(t, strings.Contains(warnings[3].Error(), "Empty relation"))
+	assert(t, dep.Relations[0].Possibilities[0].Version.Operator == ">=")
+	assert(t, len(dep.Relations[1].Possibilities) == 2)
+	assert(t, dep.Relations[1].Possibilities[1].Version.Number == "2.0")
+
+	_, _, err = dependency.ParseWith(in, dependency.ParseOptions{Strict: true})
+	notok(t, err)
+	parseErr, ok := err.(*dependency.ParseError)
+	assert(t, ok && parseErr.Offset == 6)
+
+	_, warnings, err = dependency.ParseWith("foo (>= 1.0), bar", dependency.ParseOptions{Strict: true})
+	isok(t, err)
+	assert(t, len(warnings) == 0)
+}
+
+// A Build-Depends about the size of the larger ones in the archive.
+var bigBuildDepends = strings.Repeat("debhelper-compat (= 13), dh-sequence-python3, libfoo-dev:native (>= 1.2.3~) [linux-any] <!nocheck>, python3-all:any | python3:any, ", 40) + "bar"
+
+func BenchmarkParse(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := dependency.Parse(bigBuildDepends); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // vim: foldmethod=marker
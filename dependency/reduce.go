@@ -0,0 +1,63 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dependency // import "pault.ag/go/debian/dependency"
+
+// Reduce {{{
+
+// Return the Dependency as it applies when building on the given
+// architecture with the given build profiles active, the way
+// dpkg-checkbuilddeps reduces Build-Depends before checking them.
+//
+// Possibilities whose architecture restriction (such as "[!amd64]") or
+// build profile restriction (such as "<!nocheck>") doesn't match are
+// dropped, and the restrictions are removed from the rest. A Relation
+// left with no Possibilities at all is dropped, so "foo [i386]" on amd64
+// goes away entirely, rather than becoming unsatisfiable. Substvars are
+// left as they are.
+func (dep Dependency) Reduce(arch Arch, profiles []string) Dependency {
+	ret := Dependency{Relations: []Relation{}}
+	for _, relation := range dep.Relations {
+		reduced := Relation{Possibilities: []Possibility{}}
+		for _, possi := range relation.Possibilities {
+			if possi.Substvar {
+				reduced.Possibilities = append(reduced.Possibilities, possi)
+				continue
+			}
+			if possi.Architectures != nil && !possi.Architectures.Matches(&arch) {
+				continue
+			}
+			if !possi.ProfilesMatch(profiles) {
+				continue
+			}
+			possi.Architectures = &ArchSet{Architectures: []Arch{}}
+			possi.StageSets = []StageSet{}
+			reduced.Possibilities = append(reduced.Possibilities, possi)
+		}
+		if len(reduced.Possibilities) != 0 {
+			ret.Relations = append(ret.Relations, reduced)
+		}
+	}
+	return ret
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,70 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dependency_test
+
+import (
+	"testing"
+
+	"pault.ag/go/debian/dependency"
+)
+
+/*
+ *
+ */
+
+func TestReduce(t *testing.T) {
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	amd64 := *arch
+	for _, test := range []struct {
+		In       string
+		Arch     dependency.Arch
+		Profiles []string
+		Out      string
+	}{
+		{"foo, bar [amd64], baz [!amd64]", amd64, nil, "foo, bar"},
+		{"foo [i386] | bar [amd64]", amd64, nil, "bar"},
+		{"foo [i386]", amd64, nil, ""},
+		{"foo [linux-any]", amd64, nil, "foo"},
+		{"foo [!linux-any]", amd64, nil, ""},
+		{"foo <!nocheck>, bar <nocheck>", amd64, nil, "foo"},
+		{"foo <!nocheck>, bar <nocheck>", amd64, []string{"nocheck"}, "bar"},
+		{"foo <stage1 cross> <nodoc>", amd64, []string{"stage1"}, ""},
+		{"foo <stage1 cross> <nodoc>", amd64, []string{"nodoc"}, "foo"},
+		{"foo (>= 1.0) [amd64] <!nocheck> | bar:any", amd64, nil, "foo (>= 1.0) | bar:any"},
+		{"foo, ${misc:Depends}", amd64, nil, "foo, ${misc:Depends}"},
+	} {
+		dep, err := dependency.Parse(test.In)
+		isok(t, err)
+		reduced := dep.Reduce(test.Arch, test.Profiles)
+		if reduced.String() != test.Out {
+			t.Errorf("%q reduced to %q, not %q", test.In, reduced.String(), test.Out)
+		}
+	}
+
+	/* The original is left as it was */
+	dep, err := dependency.Parse("foo [amd64] <!nocheck>")
+	isok(t, err)
+	dep.Reduce(amd64, nil)
+	assert(t, dep.String() == "foo [amd64] <!nocheck>")
+}
+
+// vim: foldmethod=marker
@@ -21,6 +21,7 @@
 package dependency // import "pault.ag/go/debian/dependency"
 
 import (
+	"sort"
 	"strings"
 )
 
@@ -29,18 +30,16 @@ func (a Arch) MarshalControl() (string, error) {
 }
 
 func (a Arch) String() string {
-	/* ABI-OS-CPU -- gnu-linux-amd64 */
-	els := []string{}
-	if a.ABI != "any" && a.ABI != "all" && a.ABI != "gnu" && a.ABI != "" {
-		els = append(els, a.ABI)
-	}
-
-	if a.OS != "any" && a.OS != "all" && a.OS != "linux" {
-		els = append(els, a.OS)
+	/* ABI-OS-CPU -- gnu-linux-amd64 is amd64, gnueabihf-linux-arm is armhf */
+	switch {
+	case a == Arch{}:
+		return ""
+	case a.CPU == "all":
+		return "all"
+	case a.IsWildcard():
+		return wildcardName(a)
 	}
-
-	els = append(els, a.CPU)
-	return strings.Join(els, "-")
+	return archName(a.canonical())
 }
 
 func (set ArchSet) String() string {
@@ -81,6 +80,9 @@ func (stageSet StageSet) String() string {
 }
 
 func (possi Possibility) String() string {
+	if possi.Substvar {
+		return "${" + possi.Name + "}"
+	}
 	str := possi.Name
 	if possi.Arch != nil {
 		str += ":" + possi.Arch.String()
@@ -117,4 +119,78 @@ func (dependency Dependency) String() string {
 	return strings.Join(relations, ", ")
 }
 
+// FormatOptions controls how Dependency.Format lays out a relationship
+// field, such as Build-Depends, for writing to a control file.
+type FormatOptions struct {
+	// The field the value is for, such as "Build-Depends". The first line
+	// is written after "Build-Depends: ", so that's counted when deciding
+	// whether to wrap, and continuation lines are lined up under it.
+	Field string
+
+	// Wrap, with one relation per line, when the field would otherwise
+	// run past this column. Zero never wraps, and a negative Column always
+	// does.
+	Column int
+
+	// Start the relations on the line after the field name, indented by a
+	// single space, rather than lining them up under the first relation.
+	ShortIndent bool
+
+	// End the last relation with a comma too, when wrapped, so adding a
+	// relation later only touches one line.
+	TrailingComma bool
+
+	// Sort the relations by package name, with substvars last.
+	Sort bool
+}
+
+// Order two Relations, as strings, by package name, with substvars last.
+func relationLess(a, b string) bool {
+	aSubst := strings.HasPrefix(a, "${")
+	bSubst := strings.HasPrefix(b, "${")
+	if aSubst != bSubst {
+		return bSubst
+	}
+	return a < b
+}
+
+// Format the Dependency as the value of a control file field, optionally
+// sorted, and wrapped with one relation per continuation line (as
+// wrap-and-sort does) if it's long enough. The value is as a
+// control.Paragraph holds it: continuation lines don't start with the
+// single space that writing the Paragraph out adds.
+func (dependency Dependency) Format(opts FormatOptions) string {
+	relations := []string{}
+	for _, relation := range dependency.Relations {
+		relations = append(relations, relation.String())
+	}
+	if opts.Sort {
+		sort.SliceStable(relations, func(i, j int) bool {
+			return relationLess(relations[i], relations[j])
+		})
+	}
+
+	prefix := 0
+	if opts.Field != "" {
+		prefix = len(opts.Field) + 2
+	}
+	oneLine := strings.Join(relations, ", ")
+	if opts.Column == 0 || len(relations) < 2 || (opts.Column > 0 && prefix+len(oneLine) <= opts.Column) {
+		return oneLine
+	}
+
+	/* Continuation lines get their first space when the Paragraph is
+	 * written out, so only what's beyond that goes in here. */
+	ret := ""
+	if opts.ShortIndent || prefix == 0 {
+		ret = "\n" + strings.Join(relations, ",\n")
+	} else {
+		ret = strings.Join(relations, ",\n"+strings.Repeat(" ", prefix-1))
+	}
+	if opts.TrailingComma {
+		ret += ","
+	}
+	return ret
+}
+
 // vim: foldmethod=marker
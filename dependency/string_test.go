@@ -42,4 +42,57 @@ func TestArchString(t *testing.T) {
 	}
 }
 
+func TestDependencyRoundTrip(t *testing.T) {
+	equivs := map[string]string{
+		"foo <!nocheck>":                       "foo <!nocheck>",
+		"foo  <stage1   !cross >  < !stage1 >": "foo <stage1 !cross> <!stage1>",
+		"foo (>= 1.0) <!nocheck>":              "foo (>= 1.0) <!nocheck>",
+		"foo <pkg.foo.nopython> | bar":         "foo <pkg.foo.nopython> | bar",
+		"${shlibs:Depends},${misc:Depends}":    "${shlibs:Depends}, ${misc:Depends}",
+	}
+
+	for in, out := range equivs {
+		dep, err := dependency.Parse(in)
+		isok(t, err)
+		assert(t, dep.String() == out)
+
+		/* And it reads back in the same */
+		again, err := dependency.Parse(dep.String())
+		isok(t, err)
+		assert(t, again.String() == out)
+	}
+}
+
+func TestDependencyFormat(t *testing.T) {
+	dep, err := dependency.Parse("${misc:Depends}, libfoo-dev (>= 1.2), debhelper-compat (= 13), bar [amd64] | baz")
+	isok(t, err)
+
+	assert(t, dep.Format(dependency.FormatOptions{}) == dep.String())
+	assert(t, dep.Format(dependency.FormatOptions{Field: "Depends", Column: 200}) == dep.String())
+	assert(t, dep.Format(dependency.FormatOptions{Sort: true}) ==
+		"bar [amd64] | baz, debhelper-compat (= 13), libfoo-dev (>= 1.2), ${misc:Depends}")
+
+	assert(t, dep.Format(dependency.FormatOptions{Field: "Build-Depends", Column: 79, Sort: true}) ==
+		"bar [amd64] | baz,\n"+
+			"              debhelper-compat (= 13),\n"+
+			"              libfoo-dev (>= 1.2),\n"+
+			"              ${misc:Depends}")
+
+	assert(t, dep.Format(dependency.FormatOptions{
+		Field:         "Build-Depends",
+		Column:        -1,
+		ShortIndent:   true,
+		TrailingComma: true,
+	}) == "\n${misc:Depends},\nlibfoo-dev (>= 1.2),\ndebhelper-compat (= 13),\nbar [amd64] | baz,")
+
+	/* Wrapped, it still reads back in the same */
+	again, err := dependency.Parse(dep.Format(dependency.FormatOptions{Field: "Depends", Column: -1, TrailingComma: true}))
+	isok(t, err)
+	assert(t, again.String() == dep.String())
+
+	one, err := dependency.Parse("foo")
+	isok(t, err)
+	assert(t, one.Format(dependency.FormatOptions{Column: -1}) == "foo")
+}
+
 // vim: foldmethod=marker
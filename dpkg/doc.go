@@ -0,0 +1,28 @@
+/*
+Read the state dpkg keeps about the packages on a system, starting with
+/var/lib/dpkg/status: what's installed, at which version, in which state,
+and with which conffiles.
+
+	db, err := dpkg.ParseStatusFile(dpkg.StatusPath)
+	if err != nil {
+		panic(err)
+	}
+	if ver, ok := db.InstalledVersion("hello"); ok {
+		log.Printf("hello %s is installed", ver)
+	}
+
+A Verifier checks the files of an installed package against the checksums
+dpkg recorded for them (as dpkg --verify and debsums do), and, given the
+.deb it came from, their types and permissions too.
+
+An InfoDatabase reads the rest of what dpkg keeps in /var/lib/dpkg/info:
+the files each package installed, their checksums, its conffiles, and its
+triggers, keyed by package (and, for Multi-Arch: same packages,
+architecture).
+
+Selections are what the administrator wants done with each package:
+install it, hold it at its current version, or remove or purge it. They
+can be read from the status file, or from dpkg --get-selections output,
+and the resolver package uses them to keep held packages back.
+*/
+package dpkg // import "pault.ag/go/debian/dpkg"
@@ -0,0 +1,320 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dpkg // import "pault.ag/go/debian/dpkg"
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// InfoKey {{{
+
+// An InfoKey names a package in the info database. dpkg only puts the
+// architecture in the names of the info files of Multi-Arch: same packages
+// ("libc6:amd64.list"), since only they can be installed for more than one
+// architecture at once; for everything else Architecture is empty.
+type InfoKey struct {
+	Package      string
+	Architecture string
+}
+
+// Parse a key such as "libc6:amd64", or "hello".
+func ParseInfoKey(key string) (InfoKey, error) {
+	name, arch, _ := strings.Cut(key, ":")
+	if name == "" {
+		return InfoKey{}, fmt.Errorf("Invalid package key: '%s'", key)
+	}
+	return InfoKey{Package: name, Architecture: arch}, nil
+}
+
+// Return the key of an installed package. Since dpkg only uses the
+// architecture for Multi-Arch: same packages, the database will fall back
+// to the bare package name when looking up by it.
+func KeyFor(pkg *InstalledPackage) InfoKey {
+	key := InfoKey{Package: pkg.Package}
+	if pkg.Architecture.CPU != "" {
+		key.Architecture = pkg.Architecture.String()
+	}
+	return key
+}
+
+// Return the key as dpkg writes it, "libc6:amd64" or "hello".
+func (k InfoKey) String() string {
+	if k.Architecture == "" {
+		return k.Package
+	}
+	return k.Package + ":" + k.Architecture
+}
+
+// }}}
+
+// Trigger {{{
+
+// A Trigger is a line of a package's .triggers file, such as
+// "interest-noawait /usr/share/icons" or "activate-noawait ldconfig".
+type Trigger struct {
+	// One of interest, interest-await, interest-noawait, activate,
+	// activate-await or activate-noawait.
+	Directive string
+
+	// The trigger name, or the path, being declared or activated.
+	Name string
+}
+
+// Return true if the package is interested in (that is, will be run for)
+// the trigger, rather than activating it.
+func (t Trigger) IsInterest() bool {
+	return strings.HasPrefix(t.Directive, "interest")
+}
+
+// Return true if the package's triggers should be processed before
+// anything depending on it is considered configured.
+func (t Trigger) Await() bool {
+	return !strings.HasSuffix(t.Directive, "-noawait")
+}
+
+func (t Trigger) String() string {
+	return t.Directive + " " + t.Name
+}
+
+// }}}
+
+// InfoDatabase {{{
+
+// An InfoDatabase reads dpkg's per-package info files, found in
+// /var/lib/dpkg/info: the paths each package installed (.list), their
+// checksums (.md5sums), its conffiles (.conffiles) and the triggers it
+// declares or activates (.triggers). The status file says what's
+// installed; this says what it put where.
+type InfoDatabase struct {
+	// The root of the system, "/" if empty.
+	Root string
+
+	// dpkg's info directory, within Root. InfoPath if empty.
+	Dir string
+}
+
+func (db InfoDatabase) dir() string {
+	root := db.Root
+	if root == "" {
+		root = "/"
+	}
+	dir := db.Dir
+	if dir == "" {
+		dir = InfoPath
+	}
+	return filepath.Join(root, filepath.FromSlash(path.Clean("/"+dir)))
+}
+
+// Open one of a package's info files, such as its ".md5sums", falling
+// back to the name without the architecture.
+func (db InfoDatabase) open(key InfoKey, ext string) (*os.File, error) {
+	names := []string{key.Package + ext}
+	if key.Architecture != "" {
+		names = append([]string{key.String() + ext}, names...)
+	}
+	var err error
+	for _, name := range names {
+		var f *os.File
+		if f, err = os.Open(filepath.Join(db.dir(), name)); err == nil {
+			return f, nil
+		}
+	}
+	return nil, err
+}
+
+// Read each non-empty line of an info file, calling fn on it. A missing
+// file has no lines.
+func (db InfoDatabase) lines(key InfoKey, ext string, fn func(string) error) error {
+	f, err := db.open(key, ext)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return fmt.Errorf("%s%s: %s", key, ext, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Return the key of every package with a .list file, which is every
+// package with files unpacked on the system, sorted.
+func (db InfoDatabase) Keys() ([]InfoKey, error) {
+	entries, err := os.ReadDir(db.dir())
+	if err != nil {
+		return nil, err
+	}
+	ret := []InfoKey{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".list") {
+			continue
+		}
+		key, err := ParseInfoKey(strings.TrimSuffix(entry.Name(), ".list"))
+		if err != nil {
+			continue
+		}
+		ret = append(ret, key)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].String() < ret[j].String()
+	})
+	return ret, nil
+}
+
+// Return every path the package installed, directories included, as
+// listed in its .list file (such as "/usr/bin/hello"), in dpkg's order.
+// A package without a .list file has no paths.
+func (db InfoDatabase) List(key InfoKey) ([]string, error) {
+	ret := []string{}
+	err := db.lines(key, ".list", func(line string) error {
+		ret = append(ret, line)
+		return nil
+	})
+	return ret, err
+}
+
+// Return the checksum of each path (as "/usr/bin/hello") in the package's
+// .md5sums file. Conffiles aren't in there; their checksums are in the
+// status file.
+func (db InfoDatabase) MD5Sums(key InfoKey) (map[string]string, error) {
+	ret := map[string]string{}
+	err := db.lines(key, ".md5sums", func(line string) error {
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok {
+			return fmt.Errorf("Malformed line: '%s'", line)
+		}
+		ret[path.Clean("/"+name)] = strings.ToLower(sum)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Return the paths listed in the package's .conffiles file.
+func (db InfoDatabase) Conffiles(key InfoKey) ([]string, error) {
+	ret := []string{}
+	err := db.lines(key, ".conffiles", func(line string) error {
+		/* dpkg 1.20 allows "remove-on-upgrade /etc/foo" */
+		fields := strings.Fields(line)
+		ret = append(ret, fields[len(fields)-1])
+		return nil
+	})
+	return ret, err
+}
+
+// Return the triggers the package's .triggers file declares an interest
+// in, or activates.
+func (db InfoDatabase) Triggers(key InfoKey) ([]Trigger, error) {
+	ret := []Trigger{}
+	err := db.lines(key, ".triggers", func(line string) error {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			return nil
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("Malformed line: '%s'", line)
+		}
+		switch fields[0] {
+		case "interest", "interest-await", "interest-noawait",
+			"activate", "activate-await", "activate-noawait":
+		default:
+			return fmt.Errorf("Unknown trigger directive '%s'", fields[0])
+		}
+		ret = append(ret, Trigger{Directive: fields[0], Name: fields[1]})
+		return nil
+	})
+	return ret, err
+}
+
+// PackageInfo is everything in the info database about one package.
+type PackageInfo struct {
+	Key       InfoKey
+	Files     []string
+	MD5Sums   map[string]string
+	Conffiles []string
+	Triggers  []Trigger
+}
+
+// Read all of a package's info files at once.
+func (db InfoDatabase) Info(key InfoKey) (*PackageInfo, error) {
+	var err error
+	info := PackageInfo{Key: key}
+	if info.Files, err = db.List(key); err != nil {
+		return nil, err
+	}
+	if info.MD5Sums, err = db.MD5Sums(key); err != nil {
+		return nil, err
+	}
+	if info.Conffiles, err = db.Conffiles(key); err != nil {
+		return nil, err
+	}
+	if info.Triggers, err = db.Triggers(key); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Return the key of every package that installed the path (which must be
+// absolute, as "/usr/bin/hello"), as dpkg -S does. This reads every .list
+// file, so is slow on a large system.
+func (db InfoDatabase) Owners(pathname string) ([]InfoKey, error) {
+	keys, err := db.Keys()
+	if err != nil {
+		return nil, err
+	}
+	ret := []InfoKey{}
+	for _, key := range keys {
+		found := false
+		err := db.lines(key, ".list", func(line string) error {
+			found = found || line == pathname
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			ret = append(ret, key)
+		}
+	}
+	return ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,137 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dpkg_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/dpkg"
+)
+
+/*
+ *
+ */
+
+// Lay out an info database with libc6 (Multi-Arch: same) and hello.
+func infoSystem(t *testing.T) string {
+	root := t.TempDir()
+	write := func(name, content string) {
+		name = filepath.Join(root, "var/lib/dpkg/info", name)
+		isok(t, os.MkdirAll(filepath.Dir(name), 0755))
+		isok(t, os.WriteFile(name, []byte(content), 0644))
+	}
+	write("libc6:amd64.list", "/.\n/etc\n/etc/ld.so.conf.d\n/lib/x86_64-linux-gnu/libc.so.6\n")
+	write("libc6:amd64.md5sums", "C4CA4238A0B923820DCC509A6F75849B  lib/x86_64-linux-gnu/libc.so.6\n")
+	write("libc6:amd64.triggers", "# Triggers added by dh_makeshlibs\nactivate-noawait ldconfig\n")
+	write("libc6:i386.list", "/.\n/lib/i386-linux-gnu/libc.so.6\n")
+	write("hello.list", "/.\n/etc\n/etc/hello.conf\n/usr/bin/hello\n")
+	write("hello.conffiles", "/etc/hello.conf\nremove-on-upgrade /etc/hello.old\n")
+	write("hello.postinst", "#!/bin/sh\n")
+	write("man-db.triggers", "interest-noawait /usr/share/man\n")
+	return root
+}
+
+func TestInfoKey(t *testing.T) {
+	key, err := dpkg.ParseInfoKey("libc6:amd64")
+	isok(t, err)
+	assert(t, key.Package == "libc6")
+	assert(t, key.Architecture == "amd64")
+	assert(t, key.String() == "libc6:amd64")
+
+	key, err = dpkg.ParseInfoKey("hello")
+	isok(t, err)
+	assert(t, key.String() == "hello")
+
+	_, err = dpkg.ParseInfoKey(":amd64")
+	notok(t, err)
+
+	key = dpkg.KeyFor(&dpkg.InstalledPackage{
+		Package:      "hello",
+		Architecture: dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"},
+	})
+	assert(t, key.String() == "hello:amd64")
+	assert(t, dpkg.KeyFor(&dpkg.InstalledPackage{Package: "hello"}).String() == "hello")
+}
+
+func TestInfoDatabase(t *testing.T) {
+	db := dpkg.InfoDatabase{Root: infoSystem(t)}
+
+	keys, err := db.Keys()
+	isok(t, err)
+	assert(t, len(keys) == 3)
+	assert(t, keys[0].String() == "hello")
+	assert(t, keys[1].String() == "libc6:amd64")
+	assert(t, keys[2].String() == "libc6:i386")
+
+	files, err := db.List(dpkg.InfoKey{Package: "libc6", Architecture: "i386"})
+	isok(t, err)
+	assert(t, len(files) == 2)
+	assert(t, files[1] == "/lib/i386-linux-gnu/libc.so.6")
+
+	/* hello isn't Multi-Arch: same, so falls back to hello.list */
+	info, err := db.Info(dpkg.InfoKey{Package: "hello", Architecture: "amd64"})
+	isok(t, err)
+	assert(t, len(info.Files) == 4)
+	assert(t, len(info.MD5Sums) == 0)
+	assert(t, len(info.Conffiles) == 2)
+	assert(t, info.Conffiles[1] == "/etc/hello.old")
+	assert(t, len(info.Triggers) == 0)
+
+	sums, err := db.MD5Sums(dpkg.InfoKey{Package: "libc6", Architecture: "amd64"})
+	isok(t, err)
+	assert(t, sums["/lib/x86_64-linux-gnu/libc.so.6"] == "c4ca4238a0b923820dcc509a6f75849b")
+
+	triggers, err := db.Triggers(dpkg.InfoKey{Package: "libc6", Architecture: "amd64"})
+	isok(t, err)
+	assert(t, len(triggers) == 1)
+	assert(t, triggers[0].Name == "ldconfig")
+	assert(t, !triggers[0].IsInterest())
+	assert(t, !triggers[0].Await())
+
+	triggers, err = db.Triggers(dpkg.InfoKey{Package: "man-db"})
+	isok(t, err)
+	assert(t, triggers[0].IsInterest())
+	assert(t, triggers[0].String() == "interest-noawait /usr/share/man")
+
+	owners, err := db.Owners("/etc")
+	isok(t, err)
+	assert(t, len(owners) == 2)
+	assert(t, owners[0].Package == "hello")
+	assert(t, owners[1].String() == "libc6:amd64")
+}
+
+func TestInfoDatabaseErrors(t *testing.T) {
+	root := infoSystem(t)
+	name := filepath.Join(root, "var/lib/dpkg/info/broken.triggers")
+	isok(t, os.WriteFile(name, []byte("frobnicate /usr\n"), 0644))
+
+	db := dpkg.InfoDatabase{Root: root}
+	_, err := db.Triggers(dpkg.InfoKey{Package: "broken"})
+	notok(t, err)
+
+	_, err = dpkg.InfoDatabase{Root: filepath.Join(root, "nope")}.Keys()
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,173 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dpkg // import "pault.ag/go/debian/dpkg"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/control"
+)
+
+// Selections {{{
+
+// Selections are what the administrator wants done with each package, as
+// set by dpkg --set-selections or apt-mark, keyed by package name. Names
+// may be qualified with an architecture, as in "libc6:amd64", the way
+// dpkg --get-selections writes Multi-Arch: same packages.
+type Selections map[string]Want
+
+// Parse selections in the format dpkg --get-selections writes: a package
+// name, some whitespace, and the selection, one per line. Blank lines, and
+// lines starting with "#", are skipped.
+func ParseSelections(reader io.Reader) (Selections, error) {
+	ret := Selections{}
+	scanner := bufio.NewScanner(reader)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Selections line %d: malformed line '%s'", lineno, line)
+		}
+		want := Want(fields[1])
+		if !want.valid() || want == WantUnknown {
+			return nil, fmt.Errorf("Selections line %d: unknown selection '%s'", lineno, fields[1])
+		}
+		ret[fields[0]] = want
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Parse the selections file at the given path.
+func ParseSelectionsFile(path string) (Selections, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSelections(f)
+}
+
+// Return the selections recorded in the Want of each package's Status,
+// the same as dpkg --get-selections would print. Multi-Arch: same packages
+// are qualified with their architecture.
+func (db *StatusDatabase) Selections() Selections {
+	ret := Selections{}
+	for _, pkg := range db.Packages {
+		if pkg.Status.Want == WantUnknown {
+			continue
+		}
+		name := pkg.Package
+		if pkg.MultiArch == control.MultiArchSame && pkg.Architecture.String() != "" {
+			name += ":" + pkg.Architecture.String()
+		}
+		ret[name] = pkg.Status.Want
+	}
+	return ret
+}
+
+// Return the selection for the named package, which may be qualified with
+// an architecture. A qualified name falls back to the unqualified
+// selection; an unqualified one matches a selection for any architecture,
+// and if the package is held for any of them, it's held. Packages with no
+// selection are WantUnknown.
+func (s Selections) Want(name string) Want {
+	if want, ok := s[name]; ok {
+		return want
+	}
+	if bare, _, qualified := strings.Cut(name, ":"); qualified {
+		if want, ok := s[bare]; ok {
+			return want
+		}
+		return WantUnknown
+	}
+
+	ret := WantUnknown
+	for _, key := range s.names() {
+		if bare, _, _ := strings.Cut(key, ":"); bare != name {
+			continue
+		}
+		if s[key] == WantHold {
+			return WantHold
+		}
+		if ret == WantUnknown {
+			ret = s[key]
+		}
+	}
+	return ret
+}
+
+// Return true if the named package is on hold, so mustn't be upgraded or
+// removed without being asked to explicitly.
+func (s Selections) IsHeld(name string) bool {
+	return s.Want(name) == WantHold
+}
+
+// Return the (possibly qualified) names of every held package, sorted.
+func (s Selections) Held() []string {
+	ret := []string{}
+	for _, name := range s.names() {
+		if s[name] == WantHold {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+func (s Selections) names() []string {
+	ret := []string{}
+	for name := range s {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Write the Selections out, sorted by name, in the format dpkg
+// --set-selections reads.
+func (s Selections) WriteTo(out io.Writer) (int64, error) {
+	written := int64(0)
+	for _, name := range s.names() {
+		if s[name] == WantUnknown {
+			continue
+		}
+		n, err := fmt.Fprintf(out, "%s\t%s\n", name, s[name])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
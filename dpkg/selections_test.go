@@ -0,0 +1,96 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dpkg_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/dpkg"
+)
+
+/*
+ *
+ */
+
+// {{{ selections
+var selectionsFile = `# dpkg --get-selections
+libc6:amd64					install
+libc6:i386					hold
+postfix						hold
+exim4-config					deinstall
+
+hello						purge
+`
+
+// }}}
+
+func TestParseSelections(t *testing.T) {
+	selections, err := dpkg.ParseSelections(strings.NewReader(selectionsFile))
+	isok(t, err)
+	assert(t, len(selections) == 5)
+	assert(t, selections.Want("postfix") == dpkg.WantHold)
+	assert(t, selections.Want("postfix:amd64") == dpkg.WantHold)
+	assert(t, selections.Want("libc6:amd64") == dpkg.WantInstall)
+	assert(t, selections.Want("libc6:arm64") == dpkg.WantUnknown)
+	assert(t, selections.IsHeld("libc6"))
+	assert(t, !selections.IsHeld("libc6:amd64"))
+	assert(t, selections.Want("hello") == dpkg.WantPurge)
+	assert(t, selections.Want("bash") == dpkg.WantUnknown)
+	assert(t, strings.Join(selections.Held(), " ") == "libc6:i386 postfix")
+
+	out := bytes.Buffer{}
+	n, err := selections.WriteTo(&out)
+	isok(t, err)
+	assert(t, n == int64(out.Len()))
+	assert(t, out.String() == "exim4-config\tdeinstall\nhello\tpurge\nlibc6:amd64\tinstall\nlibc6:i386\thold\npostfix\thold\n")
+
+	again, err := dpkg.ParseSelections(&out)
+	isok(t, err)
+	assert(t, len(again) == 5)
+}
+
+func TestParseSelectionsErrors(t *testing.T) {
+	for _, data := range []string{
+		"hello\n",
+		"hello install now\n",
+		"hello unknown\n",
+		"hello remove\n",
+	} {
+		_, err := dpkg.ParseSelections(strings.NewReader(data))
+		notok(t, err)
+	}
+}
+
+func TestStatusSelections(t *testing.T) {
+	db, err := dpkg.ParseStatus(strings.NewReader(statusFile))
+	isok(t, err)
+
+	selections := db.Selections()
+	assert(t, selections.Want("libc6:amd64") == dpkg.WantInstall)
+	assert(t, selections.Want("libc6:i386") == dpkg.WantInstall)
+	assert(t, selections.Want("exim4-config") == dpkg.WantDeinstall)
+	assert(t, selections.IsHeld("postfix"))
+	assert(t, strings.Join(selections.Held(), " ") == "postfix")
+}
+
+// vim: foldmethod=marker
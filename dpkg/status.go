@@ -0,0 +1,334 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dpkg // import "pault.ag/go/debian/dpkg"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Status {{{
+
+// What the administrator wants done with a package.
+type Want string
+
+const (
+	WantUnknown   Want = "unknown"
+	WantInstall   Want = "install"
+	WantHold      Want = "hold"
+	WantDeinstall Want = "deinstall"
+	WantPurge     Want = "purge"
+)
+
+func (w Want) valid() bool {
+	switch w {
+	case WantUnknown, WantInstall, WantHold, WantDeinstall, WantPurge:
+		return true
+	}
+	return false
+}
+
+// Whether something went wrong with the package.
+type Flag string
+
+const (
+	FlagOK        Flag = "ok"
+	FlagReinstReq Flag = "reinstreq"
+)
+
+// How far along being installed the package is.
+type State string
+
+const (
+	NotInstalled    State = "not-installed"
+	ConfigFiles     State = "config-files"
+	HalfInstalled   State = "half-installed"
+	Unpacked        State = "unpacked"
+	HalfConfigured  State = "half-configured"
+	TriggersAwaited State = "triggers-awaited"
+	TriggersPending State = "triggers-pending"
+	Installed       State = "installed"
+)
+
+// Status is the "want flag state" triplet from the Status field, such as
+// "install ok installed".
+type Status struct {
+	Want  Want
+	Flag  Flag
+	State State
+}
+
+func (s *Status) UnmarshalControl(data string) error {
+	fields := strings.Fields(data)
+	if len(fields) != 3 {
+		return fmt.Errorf("Malformed Status: '%s'", data)
+	}
+	status := Status{Want: Want(fields[0]), Flag: Flag(fields[1]), State: State(fields[2])}
+
+	if !status.Want.valid() {
+		return fmt.Errorf("Unknown Status want: '%s'", fields[0])
+	}
+	switch status.Flag {
+	case FlagOK, FlagReinstReq:
+	default:
+		return fmt.Errorf("Unknown Status flag: '%s'", fields[1])
+	}
+	switch status.State {
+	case NotInstalled, ConfigFiles, HalfInstalled, Unpacked, HalfConfigured,
+		TriggersAwaited, TriggersPending, Installed:
+	default:
+		return fmt.Errorf("Unknown Status state: '%s'", fields[2])
+	}
+
+	*s = status
+	return nil
+}
+
+func (s Status) MarshalControl() (string, error) {
+	return s.String(), nil
+}
+
+func (s Status) String() string {
+	return fmt.Sprintf("%s %s %s", s.Want, s.Flag, s.State)
+}
+
+// Return true if the package is installed, and configured; waiting on
+// triggers still counts.
+func (s Status) IsInstalled() bool {
+	switch s.State {
+	case Installed, TriggersAwaited, TriggersPending:
+		return true
+	}
+	return false
+}
+
+// }}}
+
+// Conffile {{{
+
+// A Conffile is a line of the Conffiles field: a configuration file the
+// package ships, and the MD5 of the version it shipped.
+type Conffile struct {
+	Path string
+	MD5  string
+
+	// No longer shipped by the package, but still on the system.
+	Obsolete bool
+	// Will be removed when the package is next upgraded.
+	RemoveOnUpgrade bool
+}
+
+func (c *Conffile) UnmarshalControl(data string) error {
+	fields := strings.Fields(data)
+	if len(fields) < 2 {
+		return fmt.Errorf("Malformed Conffiles line: '%s'", data)
+	}
+	*c = Conffile{Path: fields[0], MD5: fields[1]}
+	for _, flag := range fields[2:] {
+		switch flag {
+		case "obsolete":
+			c.Obsolete = true
+		case "remove-on-upgrade":
+			c.RemoveOnUpgrade = true
+		default:
+			return fmt.Errorf("Unknown Conffiles flag: '%s'", flag)
+		}
+	}
+	return nil
+}
+
+func (c Conffile) MarshalControl() (string, error) {
+	ret := c.Path + " " + c.MD5
+	if c.Obsolete {
+		ret += " obsolete"
+	}
+	if c.RemoveOnUpgrade {
+		ret += " remove-on-upgrade"
+	}
+	return ret, nil
+}
+
+// }}}
+
+// InstalledPackage {{{
+
+// An InstalledPackage is a paragraph of the dpkg status file. Packages
+// that were removed, but not purged, are still there (in state
+// config-files), as are some that dpkg only knows about from selections.
+type InstalledPackage struct {
+	control.Paragraph
+
+	Package       string `required:"true"`
+	Status        Status `required:"true"`
+	Priority      string
+	Section       string
+	InstalledSize int `control:"Installed-Size"`
+	Maintainer    string
+	Architecture  dependency.Arch
+	MultiArch     control.MultiArch `control:"Multi-Arch"`
+	Source        string
+	Version       version.Version
+	Conffiles     []Conffile `control:"Conffiles,delim=newline"`
+	Description   string     `control:"Description,multiline"`
+}
+
+// The source package the package was built from.
+func (p *InstalledPackage) SourcePackage() string {
+	if p.Source == "" {
+		return p.Package
+	}
+	return strings.Fields(p.Source)[0]
+}
+
+func (p *InstalledPackage) dependencyField(field string) dependency.Dependency {
+	value, ok := p.Values[field]
+	if !ok || strings.TrimSpace(value) == "" {
+		return dependency.Dependency{}
+	}
+	dep, err := dependency.Parse(value)
+	if err != nil {
+		return dependency.Dependency{}
+	}
+	return *dep
+}
+
+// Parse the Depends relation on this package.
+func (p *InstalledPackage) GetDepends() dependency.Dependency {
+	return p.dependencyField("Depends")
+}
+
+// Parse the Pre-Depends relation on this package.
+func (p *InstalledPackage) GetPreDepends() dependency.Dependency {
+	return p.dependencyField("Pre-Depends")
+}
+
+// Parse the Provides relation on this package.
+func (p *InstalledPackage) GetProvides() dependency.Dependency {
+	return p.dependencyField("Provides")
+}
+
+// Parse the Breaks relation on this package.
+func (p *InstalledPackage) GetBreaks() dependency.Dependency {
+	return p.dependencyField("Breaks")
+}
+
+// Parse the Conflicts relation on this package.
+func (p *InstalledPackage) GetConflicts() dependency.Dependency {
+	return p.dependencyField("Conflicts")
+}
+
+// }}}
+
+// Database {{{
+
+// Where dpkg keeps its status file.
+const StatusPath = "/var/lib/dpkg/status"
+
+// StatusDatabase is every package in the status file.
+type StatusDatabase struct {
+	Packages []InstalledPackage
+}
+
+// Parse a dpkg status file from a reader.
+func ParseStatus(reader io.Reader) (*StatusDatabase, error) {
+	ret := StatusDatabase{}
+	if err := control.Unmarshal(&ret.Packages, bufio.NewReader(reader)); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Parse the dpkg status file at the given path, usually StatusPath.
+func ParseStatusFile(path string) (*StatusDatabase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseStatus(f)
+}
+
+// Return every entry for the named package; more than one if it's
+// installed for more than one architecture. A name may be qualified with
+// an architecture, as in "libc6:amd64".
+func (db *StatusDatabase) Lookup(name string) []*InstalledPackage {
+	name, arch, qualified := strings.Cut(name, ":")
+	ret := []*InstalledPackage{}
+	for i, pkg := range db.Packages {
+		if pkg.Package != name {
+			continue
+		}
+		if qualified && pkg.Architecture.CPU != arch && pkg.Architecture.String() != arch {
+			continue
+		}
+		ret = append(ret, &db.Packages[i])
+	}
+	return ret
+}
+
+// Return true if the named package is installed (for any architecture,
+// unless the name is qualified with one).
+func (db *StatusDatabase) IsInstalled(name string) bool {
+	_, ok := db.InstalledVersion(name)
+	return ok
+}
+
+// Return the installed version of the named package, if it's installed.
+func (db *StatusDatabase) InstalledVersion(name string) (version.Version, bool) {
+	for _, pkg := range db.Lookup(name) {
+		if pkg.Status.IsInstalled() {
+			return pkg.Version, true
+		}
+	}
+	return version.Version{}, false
+}
+
+// Return every package that's installed.
+func (db *StatusDatabase) Installed() []*InstalledPackage {
+	ret := []*InstalledPackage{}
+	for i, pkg := range db.Packages {
+		if pkg.Status.IsInstalled() {
+			ret = append(ret, &db.Packages[i])
+		}
+	}
+	return ret
+}
+
+// Build a dependency.PackageIndex of the installed packages, to check
+// which relations the system already satisfies.
+func (db *StatusDatabase) Index() *dependency.PackageIndex {
+	index := dependency.NewPackageIndex()
+	for _, pkg := range db.Installed() {
+		index.Add(pkg.Package, pkg.Version, pkg.GetProvides())
+	}
+	return index
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,170 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dpkg_test
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/dpkg"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// {{{ status file
+var statusFile = `Package: libc6
+Status: install ok installed
+Priority: optional
+Section: libs
+Installed-Size: 12987
+Maintainer: GNU Libc Maintainers <debian-glibc@lists.debian.org>
+Architecture: amd64
+Multi-Arch: same
+Source: glibc
+Version: 2.36-9+deb12u3
+Depends: libgcc-s1
+Conffiles:
+ /etc/ld.so.conf.d/x86_64-linux-gnu.conf d4e7a7b88a71b5ffd9e2644e71a0cfab
+Description: GNU C Library: Shared libraries
+ Contains the standard libraries.
+
+Package: libc6
+Status: install ok installed
+Architecture: i386
+Multi-Arch: same
+Source: glibc
+Version: 2.36-9+deb12u3
+Description: GNU C Library: Shared libraries
+
+Package: exim4-config
+Status: deinstall ok config-files
+Architecture: all
+Version: 4.96-15
+Provides: exim4-config-2
+Conffiles:
+ /etc/exim4/exim4.conf.template 0bd5a0ea0f4ae05e2a0bb5f5a4a8f69c
+ /etc/exim4/conf.d/old 1c2d obsolete
+Description: configuration for the exim MTA
+
+Package: postfix
+Status: hold ok installed
+Architecture: amd64
+Version: 3.7.10-0+deb12u1
+Provides: mail-transport-agent
+Description: High-performance mail transport agent
+
+Package: hello
+Status: install reinstreq half-installed
+Architecture: amd64
+Version: 2.10-3
+Description: example package
+`
+
+// }}}
+
+func TestParseStatus(t *testing.T) {
+	db, err := dpkg.ParseStatus(strings.NewReader(statusFile))
+	isok(t, err)
+	assert(t, len(db.Packages) == 5)
+
+	libc := db.Packages[0]
+	assert(t, libc.Status == dpkg.Status{Want: dpkg.WantInstall, Flag: dpkg.FlagOK, State: dpkg.Installed})
+	assert(t, libc.SourcePackage() == "glibc")
+	assert(t, len(libc.Conffiles) == 1)
+	assert(t, libc.Conffiles[0].Path == "/etc/ld.so.conf.d/x86_64-linux-gnu.conf")
+	assert(t, libc.GetDepends().Relations[0].Possibilities[0].Name == "libgcc-s1")
+
+	exim := db.Packages[2]
+	assert(t, exim.Status.State == dpkg.ConfigFiles)
+	assert(t, len(exim.Conffiles) == 2)
+	assert(t, exim.Conffiles[1].Obsolete)
+
+	assert(t, db.IsInstalled("libc6"))
+	assert(t, len(db.Lookup("libc6")) == 2)
+	assert(t, len(db.Lookup("libc6:i386")) == 1)
+	assert(t, !db.IsInstalled("libc6:arm64"))
+	assert(t, !db.IsInstalled("exim4-config"))
+	assert(t, !db.IsInstalled("hello"))
+	assert(t, !db.IsInstalled("missing"))
+	assert(t, db.Packages[3].Status.Want == dpkg.WantHold)
+
+	ver, ok := db.InstalledVersion("postfix")
+	assert(t, ok && ver.String() == "3.7.10-0+deb12u1")
+	assert(t, len(db.Installed()) == 3)
+
+	/* Nothing installed provides exim4-config-2 any more */
+	index := db.Index()
+	dep, err := dependency.Parse("mail-transport-agent, exim4-config-2")
+	isok(t, err)
+	unsatisfied := index.Unsatisfied(*dep)
+	assert(t, len(unsatisfied) == 1)
+	assert(t, unsatisfied[0].Possibilities[0].Name == "exim4-config-2")
+
+	/* Untouched paragraphs are written back out as they were read */
+	out := bytes.Buffer{}
+	isok(t, control.Marshal(&out, db.Packages[0]))
+	assert(t, strings.HasPrefix(statusFile, out.String()+"\n"))
+}
+
+func TestParseStatusErrors(t *testing.T) {
+	for _, el := range []string{
+		"Package: foo\nStatus: install ok\n",
+		"Package: foo\nStatus: install ok sideways\n",
+		"Package: foo\nStatus: install ok installed\nConffiles:\n /etc/foo\n",
+		"Status: install ok installed\n",
+	} {
+		_, err := dpkg.ParseStatus(strings.NewReader(el))
+		notok(t, err)
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,344 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dpkg // import "pault.ag/go/debian/dpkg"
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/deb"
+)
+
+// Problem {{{
+
+// Where dpkg keeps what it knows about each package: the files it
+// installed (in .list files), their checksums (.md5sums), and so on.
+const InfoPath = "/var/lib/dpkg/info"
+
+// Where dpkg keeps the diversions set up with dpkg-divert.
+const DiversionsPath = "/var/lib/dpkg/diversions"
+
+// A Problem is a file of an installed package that isn't as the package
+// left it.
+type Problem struct {
+	Path     string
+	Conffile bool
+	Missing  bool
+
+	// What was wrong with the file, in the format of dpkg --verify (which
+	// is that of rpm -V): nine characters, for the size, mode (including
+	// the file type), checksum, device numbers, link target, owner, group,
+	// modification time and capabilities. Each is "." if it checked out,
+	// a letter ("S", "M", "5", "D", "L", "U", "G", "T" or "P") if it
+	// didn't, or "?" if it wasn't checked.
+	Attributes string
+}
+
+// Return true if the contents of the file have changed.
+func (p Problem) Modified() bool {
+	return strings.Contains(p.Attributes, "5")
+}
+
+// Return true if the file type or permissions have changed.
+func (p Problem) ModeChanged() bool {
+	return strings.Contains(p.Attributes, "M")
+}
+
+// Format the Problem as dpkg --verify does, such as
+// "??5?????? c /etc/foo.conf".
+func (p Problem) String() string {
+	attributes := p.Attributes
+	if p.Missing {
+		attributes = "missing  "
+	}
+	conffile := " "
+	if p.Conffile {
+		conffile = "c"
+	}
+	return fmt.Sprintf("%s %s %s", attributes, conffile, p.Path)
+}
+
+// Attribute positions, in Problem.Attributes.
+const (
+	attrSize = iota
+	attrMode
+	attrChecksum
+	attrDevice
+	attrLink
+	attrUser
+	attrGroup
+	attrTime
+	attrCaps
+)
+
+const attrLetters = "SM5DLUGTP"
+
+// The Attributes for a file, as a set of checks done and failed.
+type attributes []byte
+
+func newAttributes() attributes {
+	return attributes("?????????")
+}
+
+func (a attributes) check(attr int, ok bool) {
+	if ok {
+		if a[attr] == '?' {
+			a[attr] = '.'
+		}
+		return
+	}
+	a[attr] = attrLetters[attr]
+}
+
+func (a attributes) failed() bool {
+	return strings.ContainsAny(string(a), attrLetters)
+}
+
+// }}}
+
+// Verifier {{{
+
+// A Verifier checks the files of installed packages against what dpkg
+// recorded when it installed them, as dpkg --verify (or debsums) does.
+type Verifier struct {
+	// The root of the system to check, "/" if empty. Paths in the info
+	// files are taken relative to this.
+	Root string
+
+	// dpkg's info directory, and the diversions file, within Root.
+	// InfoPath and DiversionsPath if empty.
+	InfoDir    string
+	Diversions string
+}
+
+func (v Verifier) root() string {
+	if v.Root == "" {
+		return "/"
+	}
+	return v.Root
+}
+
+// Return the path on disk of a path within Root.
+func (v Verifier) onDisk(pathname string) string {
+	return filepath.Join(v.root(), filepath.FromSlash(path.Clean("/"+pathname)))
+}
+
+// The info database of the system being checked.
+func (v Verifier) info() InfoDatabase {
+	return InfoDatabase{Root: v.Root, Dir: v.InfoDir}
+}
+
+// Read the diversions file, returning where each diverted path has been
+// moved to, for those diverted by a package other than pkg.
+func (v Verifier) diversions(pkg *InstalledPackage) (map[string]string, error) {
+	diversions := v.Diversions
+	if diversions == "" {
+		diversions = DiversionsPath
+	}
+	ret := map[string]string{}
+	f, err := os.Open(v.onDisk(diversions))
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	/* Three lines per diversion: the path, where it's diverted to, and
+	 * the package that diverted it (or ":" for a local diversion). */
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i := 0; i+2 < len(lines); i += 3 {
+		if lines[i+2] != pkg.Package {
+			ret[lines[i]] = lines[i+1]
+		}
+	}
+	return ret, nil
+}
+
+// Check the files of an installed package against its md5sums and
+// Conffiles, returning a Problem for each that's missing or has changed,
+// sorted by path. Files diverted away from the package are checked where
+// they were diverted to. Obsolete conffiles aren't checked.
+func (v Verifier) Verify(pkg *InstalledPackage) ([]Problem, error) {
+	sums, err := v.info().MD5Sums(KeyFor(pkg))
+	if err != nil {
+		return nil, err
+	}
+	diversions, err := v.diversions(pkg)
+	if err != nil {
+		return nil, err
+	}
+	conffiles := map[string]bool{}
+	for _, conffile := range pkg.Conffiles {
+		if conffile.Obsolete || conffile.MD5 == "newconffile" {
+			continue
+		}
+		name := path.Clean("/" + conffile.Path)
+		sums[name] = strings.ToLower(conffile.MD5)
+		conffiles[name] = true
+	}
+
+	names := []string{}
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := []Problem{}
+	for _, name := range names {
+		onDisk := name
+		if diverted, ok := diversions[name]; ok {
+			onDisk = diverted
+		}
+		problem := Problem{Path: name, Conffile: conffiles[name]}
+
+		f, err := os.Open(v.onDisk(onDisk))
+		if os.IsNotExist(err) {
+			problem.Missing = true
+			ret = append(ret, problem)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		hash := md5.New()
+		_, err = io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+
+		attrs := newAttributes()
+		attrs.check(attrChecksum, hex.EncodeToString(hash.Sum(nil)) == sums[name])
+		if attrs.failed() {
+			problem.Attributes = string(attrs)
+			ret = append(ret, problem)
+		}
+	}
+	return ret, nil
+}
+
+// Check the files of an installed package against the .deb it was
+// installed from, returning a Problem for each that's missing, or whose
+// type, permissions (including setuid bits), size or link target have
+// changed, sorted by path. dpkg doesn't keep any of that itself, so this
+// catches what Verify can't, such as a binary made world-writable.
+//
+// Conffiles aren't checked (an admin is free to change them), and nor is
+// anything in the .deb that was diverted away from the package.
+func (v Verifier) VerifyDeb(pkg *InstalledPackage, data *tar.Reader) ([]Problem, error) {
+	diversions, err := v.diversions(pkg)
+	if err != nil {
+		return nil, err
+	}
+	conffiles := map[string]bool{}
+	for _, conffile := range pkg.Conffiles {
+		conffiles[path.Clean("/"+conffile.Path)] = true
+	}
+
+	ret := []Problem{}
+	err = deb.ReadTarEntries(data, func(entry *deb.TarEntry, _ io.Reader) error {
+		name := path.Clean("/" + entry.Path)
+		if conffiles[name] || name == "/" {
+			return nil
+		}
+		onDisk := name
+		if diverted, ok := diversions[name]; ok {
+			onDisk = diverted
+		}
+		problem := Problem{Path: name}
+
+		info, err := os.Lstat(v.onDisk(onDisk))
+		if os.IsNotExist(err) {
+			problem.Missing = true
+			ret = append(ret, problem)
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		attrs := newAttributes()
+		attrs.check(attrMode, fileMode(info) == entryMode(entry))
+		switch entry.Type {
+		case deb.RegularEntry:
+			attrs.check(attrSize, info.Mode().IsRegular() && info.Size() == entry.Size)
+		case deb.SymlinkEntry:
+			target, err := os.Readlink(v.onDisk(onDisk))
+			attrs.check(attrLink, err == nil && target == entry.LinkTarget)
+		}
+		if attrs.failed() {
+			problem.Attributes = string(attrs)
+			ret = append(ret, problem)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret, nil
+}
+
+// The parts of a file's mode VerifyDeb compares: the type, permissions,
+// and setuid, setgid and sticky bits. Symlink permissions mean nothing.
+func fileMode(info os.FileInfo) os.FileMode {
+	mode := info.Mode()
+	if mode&os.ModeSymlink != 0 {
+		return os.ModeSymlink
+	}
+	return mode & (os.ModeType | os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+func entryMode(entry *deb.TarEntry) os.FileMode {
+	mode := entry.Mode
+	switch entry.Type {
+	case deb.DirectoryEntry:
+		mode |= os.ModeDir
+	case deb.SymlinkEntry:
+		return os.ModeSymlink
+	case deb.CharDeviceEntry:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case deb.BlockDeviceEntry:
+		mode |= os.ModeDevice
+	case deb.FIFOEntry:
+		mode |= os.ModeNamedPipe
+	}
+	return mode
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,144 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dpkg_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/dpkg"
+)
+
+/*
+ *
+ */
+
+// Lay out a system with hello installed, and return its root.
+func helloSystem(t *testing.T) string {
+	root := t.TempDir()
+	write := func(name, content string, mode os.FileMode) {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		isok(t, os.MkdirAll(filepath.Dir(name), 0755))
+		isok(t, os.WriteFile(name, []byte(content), mode))
+		isok(t, os.Chmod(name, mode))
+	}
+	sum := func(content string) string {
+		return fmt.Sprintf("%x", md5.Sum([]byte(content)))
+	}
+
+	write("usr/bin/hello", "#!/bin/sh\necho hello\n", 0755)
+	write("usr/share/doc/hello/README", "Hello!\n", 0644)
+	write("usr/bin/hello.real", "#!/bin/sh\necho diverted\n", 0755)
+	write("etc/hello.conf", "greeting=hi\n", 0644)
+	isok(t, os.Symlink("hello", filepath.Join(root, "usr/bin/hi")))
+
+	write("var/lib/dpkg/info/hello:amd64.md5sums", strings.Join([]string{
+		sum("#!/bin/sh\necho hello\n") + "  usr/bin/hello",
+		sum("Hello!\n") + "  usr/share/doc/hello/README",
+		sum("#!/bin/sh\necho gone\n") + "  usr/share/doc/hello/NEWS",
+		sum("#!/bin/sh\necho original\n") + "  usr/bin/hello-diverted",
+		"",
+	}, "\n"), 0644)
+	write("var/lib/dpkg/diversions", "/usr/bin/hello-diverted\n/usr/bin/hello.real\nhello-wrapper\n", 0644)
+	return root
+}
+
+func helloPackage() *dpkg.InstalledPackage {
+	return &dpkg.InstalledPackage{
+		Package:      "hello",
+		Architecture: dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"},
+		Conffiles: []dpkg.Conffile{
+			{Path: "/etc/hello.conf", MD5: fmt.Sprintf("%x", md5.Sum([]byte("greeting=hello\n")))},
+			{Path: "/etc/hello.old", MD5: "d41d8cd98f00b204e9800998ecf8427e", Obsolete: true},
+		},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	root := helloSystem(t)
+	verifier := dpkg.Verifier{Root: root}
+
+	problems, err := verifier.Verify(helloPackage())
+	isok(t, err)
+	assert(t, len(problems) == 3)
+
+	assert(t, problems[0].Path == "/etc/hello.conf")
+	assert(t, problems[0].Conffile)
+	assert(t, problems[0].Modified())
+	assert(t, problems[0].String() == "??5?????? c /etc/hello.conf")
+
+	/* Diverted to hello.real, which doesn't match */
+	assert(t, problems[1].Path == "/usr/bin/hello-diverted")
+	assert(t, problems[1].Modified())
+
+	assert(t, problems[2].Path == "/usr/share/doc/hello/NEWS")
+	assert(t, problems[2].Missing)
+	assert(t, problems[2].String() == "missing     /usr/share/doc/hello/NEWS")
+
+	/* Nothing recorded, nothing to check */
+	problems, err = verifier.Verify(&dpkg.InstalledPackage{Package: "bash"})
+	isok(t, err)
+	assert(t, len(problems) == 0)
+}
+
+func TestVerifyDeb(t *testing.T) {
+	root := helloSystem(t)
+	isok(t, os.Chmod(filepath.Join(root, "usr/bin/hello"), 0777|os.ModeSetuid))
+
+	out := bytes.Buffer{}
+	writer := deb.NewTarWriter(&out)
+	for _, entry := range []deb.TarEntry{
+		{Path: "usr/bin", Type: deb.DirectoryEntry, Mode: 0755},
+		{Path: "usr/bin/hello", Type: deb.RegularEntry, Mode: 0755, Size: 21},
+		{Path: "usr/bin/hi", Type: deb.SymlinkEntry, LinkTarget: "hello.real"},
+		{Path: "usr/share/doc/hello/README", Type: deb.RegularEntry, Mode: 0644, Size: 7},
+		{Path: "usr/share/doc/hello/NEWS", Type: deb.RegularEntry, Mode: 0644},
+		{Path: "etc/hello.conf", Type: deb.RegularEntry, Mode: 0600},
+	} {
+		entry := entry
+		isok(t, writer.WriteEntry(&entry, strings.NewReader(strings.Repeat("x", int(entry.Size)))))
+	}
+	isok(t, writer.Close())
+
+	problems, err := dpkg.Verifier{Root: root}.VerifyDeb(helloPackage(), tar.NewReader(&out))
+	isok(t, err)
+	assert(t, len(problems) == 3)
+
+	assert(t, problems[0].Path == "/usr/bin/hello")
+	assert(t, problems[0].ModeChanged())
+	assert(t, problems[0].Attributes == ".M???????")
+
+	assert(t, problems[1].Path == "/usr/bin/hi")
+	assert(t, problems[1].Attributes == "?.??L????")
+
+	assert(t, problems[2].Path == "/usr/share/doc/hello/NEWS")
+	assert(t, problems[2].Missing)
+}
+
+// vim: foldmethod=marker
@@ -3,9 +3,12 @@ module pault.ag/go/debian
 go 1.19
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/kjk/lzma v0.0.0-20161016003348-3fd93898850d
 	github.com/klauspost/compress v1.16.5
+	github.com/ulikunitz/xz v0.5.11
 	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8
 	golang.org/x/crypto v0.9.0
-	pault.ag/go/topsort v0.1.1
 )
+
+require golang.org/x/sys v0.8.0 // indirect
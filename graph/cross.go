@@ -0,0 +1,403 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package graph // import "pault.ag/go/debian/graph"
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Side {{{
+
+// Side is which architecture of a cross build a package is installed for:
+// the build architecture (the machine doing the building, which runs the
+// compilers and tools), or the host architecture (the one being built
+// for, whose libraries and headers are linked against).
+type Side int
+
+const (
+	BuildSide Side = iota
+	HostSide
+)
+
+func (s Side) String() string {
+	switch s {
+	case BuildSide:
+		return "build"
+	case HostSide:
+		return "host"
+	default:
+		return fmt.Sprintf("Side(%d)", int(s))
+	}
+}
+
+// }}}
+
+// CrossNode {{{
+
+// A CrossNode is a package installed on one Side of a cross build.
+// Architecture: all packages count as the build architecture, as they do
+// to dpkg and apt.
+type CrossNode struct {
+	Package string
+	Side    Side
+
+	// The Architecture of the package, which may be "all".
+	Arch dependency.Arch
+}
+
+// Return the package name, qualified with its architecture.
+func (n CrossNode) String() string {
+	if arch := n.Arch.String(); arch != "" {
+		return n.Package + ":" + arch
+	}
+	return n.Package
+}
+
+// A CrossEdge is a relation followed while working out a CrossBuild. The
+// source package itself is the CrossNode "src:name", with no Arch.
+type CrossEdge struct {
+	From CrossNode
+	To   CrossNode
+	Kind Kind
+
+	// If the Edge goes through a virtual package, the name of the virtual
+	// package provided by To.
+	Virtual string
+}
+
+func (e CrossEdge) String() string {
+	if e.Virtual != "" {
+		return fmt.Sprintf("%s %s %s (via %s)", e.From, e.Kind, e.To, e.Virtual)
+	}
+	return fmt.Sprintf("%s %s %s", e.From, e.Kind, e.To)
+}
+
+// A relation nothing on the right Side can satisfy.
+type CrossUnsatisfied struct {
+	From     CrossNode
+	Kind     Kind
+	Relation dependency.Relation
+}
+
+func (u CrossUnsatisfied) String() string {
+	return fmt.Sprintf("%s %s %s", u.From, u.Kind, u.Relation)
+}
+
+// }}}
+
+// CrossGraph {{{
+
+// CrossOptions are the architectures (and build profiles) of a cross
+// build.
+type CrossOptions struct {
+	Build dependency.Arch
+	Host  dependency.Arch
+
+	// Build profiles that are active, such as "cross" and "nocheck".
+	// Restrictions like "<!nocheck>" are checked against these.
+	Profiles []string
+
+	// Follow Build-Depends-Indep as well. Cross builds are nearly always
+	// arch-only (dpkg-buildpackage -B), so they're left out by default.
+	Indep bool
+}
+
+// The packages of one architecture.
+type crossSide struct {
+	packages map[string]control.BinaryIndex
+	index    *dependency.PackageIndex
+}
+
+func newCrossSide(packages []control.BinaryIndex, arches ...string) crossSide {
+	side := crossSide{
+		packages: map[string]control.BinaryIndex{},
+		index:    dependency.NewPackageIndex(),
+	}
+	for _, pkg := range packages {
+		wanted := false
+		for _, arch := range arches {
+			wanted = wanted || pkg.Architecture.String() == arch
+		}
+		if !wanted {
+			continue
+		}
+		if current, ok := side.packages[pkg.Package]; ok && version.Compare(current.Version, pkg.Version) >= 0 {
+			continue
+		}
+		side.packages[pkg.Package] = pkg
+	}
+	names := []string{}
+	for name := range side.packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pkg := side.packages[name]
+		side.index.Add(name, pkg.Version, pkg.GetProvides())
+	}
+	return side
+}
+
+// A CrossGraph works out which packages a cross build needs installed for
+// the build architecture, and which for the host architecture, following
+// the Multi-Arch rules apt and dpkg use:
+//
+// A relation qualified with ":native" is always on the build side, and one
+// qualified with ":any" is satisfied on the build side by a package that's
+// Multi-Arch: allowed. Otherwise a package that's Multi-Arch: foreign is
+// used from the build side, as it can run there. Anything else has to be
+// the same architecture as whatever needs it: the host architecture for
+// the source package's build dependencies, and the architecture of the
+// package itself for the dependencies of binary packages (the build
+// architecture, for Architecture: all packages).
+//
+// If the build and host architectures are the same, it isn't a cross
+// build, and everything is on the build side.
+type CrossGraph struct {
+	options CrossOptions
+	sides   map[Side]crossSide
+}
+
+// Build a CrossGraph of the packages available for the build
+// architecture (including Architecture: all packages), and those for the
+// host architecture. Packages of any other architecture are ignored. When
+// more than one version of a package is given, only the newest is used.
+func NewCross(build, host []control.BinaryIndex, options CrossOptions) *CrossGraph {
+	return &CrossGraph{
+		options: options,
+		sides: map[Side]crossSide{
+			BuildSide: newCrossSide(build, options.Build.String(), "all"),
+			HostSide:  newCrossSide(host, options.Host.String()),
+		},
+	}
+}
+
+func (g *CrossGraph) node(side Side, name string) CrossNode {
+	pkg := g.sides[side].packages[name]
+	return CrossNode{Package: name, Side: side, Arch: pkg.Architecture}
+}
+
+// Return the Candidates on the given Side that can satisfy the
+// Possibility, and whose Multi-Arch is acceptable to the filter.
+func (g *CrossGraph) candidates(side Side, possi dependency.Possibility, filter func(control.MultiArch) bool) []dependency.Candidate {
+	unqualified := possi
+	unqualified.Arch = nil
+	ret := []dependency.Candidate{}
+	for _, candidate := range g.sides[side].index.Candidates(unqualified) {
+		if filter == nil || filter(g.sides[side].packages[candidate.Package].MultiArch) {
+			ret = append(ret, candidate)
+		}
+	}
+	return ret
+}
+
+// Work out which Side, and which package on it, satisfies a Possibility
+// of a package on the given Side.
+func (g *CrossGraph) resolve(from Side, possi dependency.Possibility) (Side, []dependency.Candidate) {
+	if g.options.Host.Equal(g.options.Build) {
+		/* Not a cross build at all; everything's native */
+		from = BuildSide
+	}
+	if possi.Arch != nil {
+		switch name := possi.Arch.String(); {
+		case name == "native":
+			return BuildSide, g.candidates(BuildSide, possi, nil)
+		case name == "any":
+			return BuildSide, g.candidates(BuildSide, possi, func(multiArch control.MultiArch) bool {
+				return multiArch == control.MultiArchAllowed
+			})
+		case possi.Arch.Equal(g.options.Build):
+			return BuildSide, g.candidates(BuildSide, possi, nil)
+		case possi.Arch.Equal(g.options.Host):
+			return HostSide, g.candidates(HostSide, possi, nil)
+		}
+		return from, nil
+	}
+
+	if from == BuildSide {
+		return BuildSide, g.candidates(BuildSide, possi, nil)
+	}
+	foreign := func(multiArch control.MultiArch) bool {
+		return multiArch == control.MultiArchForeign
+	}
+	if candidates := g.candidates(BuildSide, possi, foreign); len(candidates) > 0 {
+		return BuildSide, candidates
+	}
+	return HostSide, g.candidates(HostSide, possi, nil)
+}
+
+// }}}
+
+// CrossBuild {{{
+
+// The relations of one field, and the Kind of Edge they make.
+type relationField struct {
+	kind      Kind
+	relations dependency.Dependency
+}
+
+// A CrossBuild is everything a source package needs installed to be cross
+// built.
+type CrossBuild struct {
+	// Names of the packages to install for the build architecture
+	// (including Architecture: all packages), and for the host
+	// architecture, sorted.
+	Build []string
+	Host  []string
+
+	// Every relation followed, from the source package down.
+	Edges []CrossEdge
+
+	// Relations nothing could satisfy; if there are any, the source
+	// package can't be cross built with these packages.
+	Unsatisfied []CrossUnsatisfied
+}
+
+// Work out what the source package needs to be cross built. As apt does
+// when installing build dependencies, only the first alternative of each
+// relation that can be satisfied is taken (and only Depends and
+// Pre-Depends of binary packages are followed, as with
+// --no-install-recommends). Architecture restrictions on build
+// dependencies are checked against the host architecture, and build
+// profile restrictions against CrossOptions.Profiles.
+func (g *CrossGraph) BuildDepends(source *control.SourceIndex) CrossBuild {
+	ret := CrossBuild{Build: []string{}, Host: []string{}, Edges: []CrossEdge{}, Unsatisfied: []CrossUnsatisfied{}}
+	seen := map[Side]map[string]bool{BuildSide: {}, HostSide: {}}
+	queue := []CrossNode{}
+
+	follow := func(from CrossNode, kind Kind, relation dependency.Relation) {
+		applies := false
+		for _, possi := range relation.Possibilities {
+			if possi.Substvar || !possi.ProfilesMatch(g.options.Profiles) {
+				continue
+			}
+			if possi.Architectures != nil && !possi.Architectures.Matches(&g.options.Host) {
+				continue
+			}
+			applies = true
+			side, candidates := g.resolve(from.Side, possi)
+			if len(candidates) == 0 {
+				continue
+			}
+			to := g.node(side, candidates[0].Package)
+			ret.Edges = append(ret.Edges, CrossEdge{From: from, To: to, Kind: kind, Virtual: candidates[0].Virtual})
+			if !seen[side][to.Package] {
+				seen[side][to.Package] = true
+				queue = append(queue, to)
+			}
+			return
+		}
+		if applies {
+			ret.Unsatisfied = append(ret.Unsatisfied, CrossUnsatisfied{From: from, Kind: kind, Relation: relation})
+		}
+	}
+
+	root := CrossNode{Package: "src:" + source.Package, Side: HostSide}
+	fields := []relationField{
+		{BuildDepends, source.GetBuildDepends()},
+		{BuildDependsArch, source.GetBuildDependsArch()},
+	}
+	if g.options.Indep {
+		fields = append(fields, relationField{BuildDependsIndep, source.GetBuildDependsIndep()})
+	}
+	for _, field := range fields {
+		for _, relation := range field.relations.Relations {
+			follow(root, field.kind, relation)
+		}
+	}
+
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		pkg := g.sides[node.Side].packages[node.Package]
+		for _, field := range []relationField{
+			{PreDepends, pkg.GetPreDepends()},
+			{Depends, pkg.GetDepends()},
+		} {
+			for _, relation := range field.relations.Relations {
+				follow(node, field.kind, relation)
+			}
+		}
+	}
+
+	for side, names := range seen {
+		for name := range names {
+			if side == BuildSide {
+				ret.Build = append(ret.Build, name)
+			} else {
+				ret.Host = append(ret.Host, name)
+			}
+		}
+	}
+	sort.Strings(ret.Build)
+	sort.Strings(ret.Host)
+	return ret
+}
+
+// Write the CrossBuild out in Graphviz DOT format, with the packages for
+// each Side grouped into a cluster.
+func (c CrossBuild) WriteDOT(w io.Writer) error {
+	nodes := map[Side][]string{}
+	seen := map[string]bool{}
+	for _, edge := range c.Edges {
+		for _, node := range []CrossNode{edge.From, edge.To} {
+			if !seen[node.String()] && node.Arch.String() != "" {
+				seen[node.String()] = true
+				nodes[node.Side] = append(nodes[node.Side], node.String())
+			}
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "digraph crossbuild {\n"); err != nil {
+		return err
+	}
+	for _, side := range []Side{BuildSide, HostSide} {
+		sort.Strings(nodes[side])
+		if _, err := fmt.Fprintf(w, "\tsubgraph \"cluster_%s\" {\n\t\tlabel=%q;\n", side, side.String()); err != nil {
+			return err
+		}
+		for _, name := range nodes[side] {
+			if _, err := fmt.Fprintf(w, "\t\t%q;\n", name); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "\t}\n"); err != nil {
+			return err
+		}
+	}
+	for _, edge := range c.Edges {
+		if _, err := fmt.Fprintf(w, "\t%q -> %q [label=%q];\n", edge.From.String(), edge.To.String(), edge.Kind.String()); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "}\n")
+	return err
+}
+
+// }}}
+
+// vim: foldmethod=marker
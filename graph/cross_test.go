@@ -0,0 +1,207 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package graph_test
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/graph"
+)
+
+/*
+ *
+ */
+
+// {{{ Cross build indices
+var buildPackages = `Package: debhelper
+Version: 13.11.4
+Architecture: all
+Multi-Arch: foreign
+Depends: perl:any, dpkg-dev
+
+Package: dpkg-dev
+Version: 1.21.22
+Architecture: all
+Multi-Arch: foreign
+Depends: make
+
+Package: make
+Version: 4.3-4.1
+Architecture: amd64
+Multi-Arch: foreign
+Depends: libc6
+
+Package: perl
+Version: 5.36.0-7
+Architecture: amd64
+Multi-Arch: allowed
+Depends: libc6
+
+Package: python3
+Version: 3.11.2-1
+Architecture: amd64
+Multi-Arch: allowed
+Depends: libc6
+
+Package: pkgconf
+Version: 1.8.1-1
+Architecture: amd64
+Multi-Arch: foreign
+Provides: pkg-config
+Depends: libc6
+
+Package: libc6
+Version: 2.36-9
+Architecture: amd64
+Multi-Arch: same
+
+Package: libssl-dev
+Version: 3.0.11-1
+Architecture: amd64
+Multi-Arch: same
+Depends: libssl3 (= 3.0.11-1)
+
+Package: libssl3
+Version: 3.0.11-1
+Architecture: amd64
+Multi-Arch: same
+Depends: libc6
+
+Package: check
+Version: 0.15.2-2
+Architecture: amd64
+
+Package: libjs-jquery
+Version: 3.6.1
+Architecture: all
+`
+
+var hostPackages = `Package: libssl-dev
+Version: 3.0.11-1
+Architecture: armhf
+Multi-Arch: same
+Depends: libssl3 (= 3.0.11-1)
+
+Package: libssl3
+Version: 3.0.11-1
+Architecture: armhf
+Multi-Arch: same
+Depends: libc6
+
+Package: libc6
+Version: 2.36-9
+Architecture: armhf
+Multi-Arch: same
+
+Package: make
+Version: 4.3-4.1
+Architecture: armhf
+Multi-Arch: foreign
+Depends: libc6
+
+Package: libjs-jquery
+Version: 3.6.1
+Architecture: all
+`
+
+var crossSource = `Package: hello
+Version: 2.10-3
+Build-Depends: debhelper (>= 13), pkg-config, libssl-dev,
+ python3:native, check <!nocheck>, libsystemd-dev [amd64],
+ libjs-jquery
+Build-Depends-Indep: doxygen
+`
+
+// }}}
+
+func parseIndex(t *testing.T, data string) []control.BinaryIndex {
+	index, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(data)))
+	isok(t, err)
+	return index
+}
+
+func TestCrossBuild(t *testing.T) {
+	sources, err := control.ParseSourceIndex(bufio.NewReader(strings.NewReader(crossSource)))
+	isok(t, err)
+
+	g := graph.NewCross(parseIndex(t, buildPackages), parseIndex(t, hostPackages), graph.CrossOptions{
+		Build:    dependency.AMD64,
+		Host:     dependency.ARMHF,
+		Profiles: []string{"nocheck"},
+	})
+	build := g.BuildDepends(&sources[0])
+	assert(t, strings.Join(build.Build, " ") == "debhelper dpkg-dev libc6 make perl pkgconf python3")
+	assert(t, strings.Join(build.Host, " ") == "libc6 libssl-dev libssl3")
+
+	/* Architecture: all, but not Multi-Arch: foreign, so it can't satisfy
+	 * a host architecture build dependency */
+	assert(t, len(build.Unsatisfied) == 1)
+	assert(t, build.Unsatisfied[0].String() == "src:hello Build-Depends libjs-jquery")
+
+	edges := []string{}
+	for _, edge := range build.Edges {
+		edges = append(edges, edge.String())
+	}
+	edgeList := strings.Join(edges, "\n") + "\n"
+	assert(t, strings.Contains(edgeList, "src:hello Build-Depends debhelper:all\n"))
+	assert(t, strings.Contains(edgeList, "src:hello Build-Depends pkgconf:amd64 (via pkg-config)\n"))
+	assert(t, strings.Contains(edgeList, "src:hello Build-Depends libssl-dev:armhf\n"))
+	assert(t, strings.Contains(edgeList, "debhelper:all Depends perl:amd64\n"))
+	assert(t, strings.Contains(edgeList, "libssl-dev:armhf Depends libssl3:armhf\n"))
+	assert(t, !strings.Contains(edgeList, "check"))
+
+	out := bytes.Buffer{}
+	isok(t, build.WriteDOT(&out))
+	assert(t, strings.Contains(out.String(), "subgraph \"cluster_host\" {\n\t\tlabel=\"host\";\n\t\t\"libc6:armhf\";\n"))
+	assert(t, strings.Contains(out.String(), "\t\"src:hello\" -> \"libssl-dev:armhf\" [label=\"Build-Depends\"];\n"))
+
+	/* Without nocheck, check is needed (for the host), and isn't there;
+	 * with Indep, so is doxygen */
+	g = graph.NewCross(parseIndex(t, buildPackages), parseIndex(t, hostPackages), graph.CrossOptions{
+		Build: dependency.AMD64,
+		Host:  dependency.ARMHF,
+		Indep: true,
+	})
+	build = g.BuildDepends(&sources[0])
+	assert(t, len(build.Unsatisfied) == 3)
+	assert(t, build.Unsatisfied[0].Relation.String() == "check <!nocheck>")
+	assert(t, build.Unsatisfied[2].Kind == graph.BuildDependsIndep)
+
+	/* Natively, everything comes from the one architecture, and
+	 * restrictions to it apply */
+	g = graph.NewCross(parseIndex(t, buildPackages), parseIndex(t, buildPackages), graph.CrossOptions{
+		Build:    dependency.AMD64,
+		Host:     dependency.AMD64,
+		Profiles: []string{"nocheck"},
+	})
+	build = g.BuildDepends(&sources[0])
+	assert(t, len(build.Unsatisfied) == 1)
+	assert(t, build.Unsatisfied[0].Relation.String() == "libsystemd-dev [amd64]")
+	assert(t, len(build.Host) == 0)
+	assert(t, strings.Join(build.Build, " ") == "debhelper dpkg-dev libc6 libjs-jquery libssl-dev libssl3 make perl pkgconf python3")
+}
+
+// vim: foldmethod=marker
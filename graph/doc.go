@@ -0,0 +1,16 @@
+/*
+Build and query the dependency graph of a set of binary packages, such as
+every package in a Packages index.
+
+Each package is a node, and each Depends, Pre-Depends, Recommends or
+Suggests Possibility that can be satisfied (either by a real package, or
+through Provides) is an edge. The graph can be walked forwards or backwards,
+checked for cycles, and written out in Graphviz DOT format.
+
+A CrossGraph holds the packages of two architectures, to work out what a
+source package needs to be cross built: which packages have to be
+installed for the build architecture (compilers, and other tools that run
+during the build), and which for the host architecture (libraries to link
+against), following the same Multi-Arch rules as apt.
+*/
+package graph // import "pault.ag/go/debian/graph"
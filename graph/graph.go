@@ -0,0 +1,339 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package graph // import "pault.ag/go/debian/graph"
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Kind {{{
+
+// Kind is the type of relationship an Edge was created from.
+type Kind int
+
+const (
+	Depends Kind = iota
+	PreDepends
+	Recommends
+	Suggests
+
+	// Edges from a source package to what it needs to build, in a
+	// CrossBuild.
+	BuildDepends
+	BuildDependsArch
+	BuildDependsIndep
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Depends:
+		return "Depends"
+	case PreDepends:
+		return "Pre-Depends"
+	case Recommends:
+		return "Recommends"
+	case Suggests:
+		return "Suggests"
+	case BuildDepends:
+		return "Build-Depends"
+	case BuildDependsArch:
+		return "Build-Depends-Arch"
+	case BuildDependsIndep:
+		return "Build-Depends-Indep"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+var allKinds = []Kind{Depends, PreDepends, Recommends, Suggests}
+
+// }}}
+
+// Edge {{{
+
+// An Edge is a relationship from one package to another.
+type Edge struct {
+	From string
+	To   string
+	Kind Kind
+
+	// Set if the Relation had more than one Possibility (`foo | bar`), so
+	// this Edge is only one way of satisfying it.
+	Alternative bool
+
+	// If the Edge goes through a virtual package, the name of the virtual
+	// package provided by To.
+	Virtual string
+}
+
+func (e Edge) String() string {
+	if e.Virtual != "" {
+		return fmt.Sprintf("%s %s %s (via %s)", e.From, e.Kind, e.To, e.Virtual)
+	}
+	return fmt.Sprintf("%s %s %s", e.From, e.Kind, e.To)
+}
+
+// }}}
+
+// Graph {{{
+
+// A Graph is the dependency graph of a set of binary packages. When more
+// than one version of a package is given, only the newest is used.
+type Graph struct {
+	packages map[string]control.BinaryIndex
+	names    []string
+	forward  map[string][]Edge
+	reverse  map[string][]Edge
+}
+
+// Build the Graph for the given packages.
+func New(packages []control.BinaryIndex) *Graph {
+	g := Graph{
+		packages: map[string]control.BinaryIndex{},
+		forward:  map[string][]Edge{},
+		reverse:  map[string][]Edge{},
+	}
+
+	for _, pkg := range packages {
+		if current, ok := g.packages[pkg.Package]; ok && version.Compare(current.Version, pkg.Version) >= 0 {
+			continue
+		}
+		g.packages[pkg.Package] = pkg
+	}
+	for name := range g.packages {
+		g.names = append(g.names, name)
+	}
+	sort.Strings(g.names)
+
+	index := dependency.NewPackageIndex()
+	for _, name := range g.names {
+		pkg := g.packages[name]
+		index.Add(name, pkg.Version, pkg.GetProvides())
+	}
+
+	for _, name := range g.names {
+		pkg := g.packages[name]
+		for kind, relations := range map[Kind]dependency.Dependency{
+			Depends:    pkg.GetDepends(),
+			PreDepends: pkg.GetPreDepends(),
+			Recommends: pkg.GetRecommends(),
+			Suggests:   pkg.GetSuggests(),
+		} {
+			for _, relation := range relations.Relations {
+				for _, possi := range relation.Possibilities {
+					for _, candidate := range index.Candidates(possi) {
+						edge := Edge{
+							From:        name,
+							To:          candidate.Package,
+							Kind:        kind,
+							Alternative: len(relation.Possibilities) > 1,
+							Virtual:     candidate.Virtual,
+						}
+						g.forward[name] = append(g.forward[name], edge)
+						g.reverse[edge.To] = append(g.reverse[edge.To], edge)
+					}
+				}
+			}
+		}
+	}
+
+	for _, edges := range []map[string][]Edge{g.forward, g.reverse} {
+		for _, list := range edges {
+			sort.Slice(list, func(i, j int) bool { return list[i].String() < list[j].String() })
+		}
+	}
+	return &g
+}
+
+// Return the names of every package in the Graph, sorted.
+func (g *Graph) Packages() []string {
+	return g.names
+}
+
+// Return the package with the given name, or nil if it's not in the Graph.
+func (g *Graph) Package(name string) *control.BinaryIndex {
+	if pkg, ok := g.packages[name]; ok {
+		return &pkg
+	}
+	return nil
+}
+
+func filter(edges []Edge, kinds []Kind) []Edge {
+	if len(kinds) == 0 {
+		kinds = allKinds
+	}
+	ret := []Edge{}
+	for _, edge := range edges {
+		for _, kind := range kinds {
+			if edge.Kind == kind {
+				ret = append(ret, edge)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// Return every Edge out of the named package, of any of the given Kinds
+// (or of every Kind, if none are given).
+func (g *Graph) Depends(name string, kinds ...Kind) []Edge {
+	return filter(g.forward[name], kinds)
+}
+
+// Return every Edge into the named package, of any of the given Kinds
+// (or of every Kind, if none are given).
+func (g *Graph) ReverseDepends(name string, kinds ...Kind) []Edge {
+	return filter(g.reverse[name], kinds)
+}
+
+// Return the names of every package reachable from the seeds (including
+// the seeds themselves) by following Edges of the given Kinds. Every
+// alternative is followed, so this is everything that might be needed,
+// not the minimal set.
+func (g *Graph) Closure(seeds []string, kinds ...Kind) []string {
+	seen := map[string]bool{}
+	queue := append([]string{}, seeds...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		for _, edge := range g.Depends(name, kinds...) {
+			queue = append(queue, edge.To)
+		}
+	}
+	ret := []string{}
+	for name := range seen {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// }}}
+
+// Cycles {{{
+
+// Return every dependency cycle among Edges of the given Kinds, as a set of
+// strongly connected packages. A package depending on itself is a cycle
+// of one.
+func (g *Graph) Cycles(kinds ...Kind) [][]string {
+	/* Tarjan's strongly connected components algorithm */
+	index := map[string]int{}
+	lowlink := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+	ret := [][]string{}
+
+	var connect func(string)
+	connect = func(name string) {
+		index[name] = len(index)
+		lowlink[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+
+		selfLoop := false
+		for _, edge := range g.Depends(name, kinds...) {
+			if edge.To == name {
+				selfLoop = true
+			}
+			if _, ok := index[edge.To]; !ok {
+				connect(edge.To)
+				if lowlink[edge.To] < lowlink[name] {
+					lowlink[name] = lowlink[edge.To]
+				}
+			} else if onStack[edge.To] && index[edge.To] < lowlink[name] {
+				lowlink[name] = index[edge.To]
+			}
+		}
+
+		if lowlink[name] != index[name] {
+			return
+		}
+		component := []string{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == name {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop {
+			sort.Strings(component)
+			ret = append(ret, component)
+		}
+	}
+
+	for _, name := range g.names {
+		if _, ok := index[name]; !ok {
+			connect(name)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i][0] < ret[j][0] })
+	return ret
+}
+
+// }}}
+
+// DOT {{{
+
+// Write the Graph out in Graphviz DOT format, including only Edges of the
+// given Kinds. Alternatives are drawn dashed, and Edges other than Depends
+// and Pre-Depends are drawn dotted.
+func (g *Graph) WriteDOT(w io.Writer, kinds ...Kind) error {
+	if _, err := fmt.Fprintf(w, "digraph packages {\n"); err != nil {
+		return err
+	}
+	for _, name := range g.names {
+		if _, err := fmt.Fprintf(w, "\t%q;\n", name); err != nil {
+			return err
+		}
+	}
+	for _, name := range g.names {
+		for _, edge := range g.Depends(name, kinds...) {
+			attrs := fmt.Sprintf("label=%q", edge.Kind.String())
+			if edge.Alternative {
+				attrs += ", style=dashed"
+			} else if edge.Kind != Depends && edge.Kind != PreDepends {
+				attrs += ", style=dotted"
+			}
+			if _, err := fmt.Fprintf(w, "\t%q -> %q [%s];\n", edge.From, edge.To, attrs); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "}\n")
+	return err
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,153 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package graph_test
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/graph"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+// {{{ Packages index
+var packages = `Package: app
+Version: 1.0-1
+Depends: libfoo1 (>= 1.1), mail-transport-agent, default-dbus-session-bus | dbus-session-bus
+Recommends: docs
+
+Package: libfoo1
+Version: 1.0-1
+Depends: libc6
+
+Package: libfoo1
+Version: 1.2-1
+Depends: libc6
+
+Package: libc6
+Version: 2.36-9
+Depends: libgcc-s1
+
+Package: libgcc-s1
+Version: 12.2.0-14
+Depends: libc6 (>= 2.35)
+
+Package: postfix
+Version: 3.7-1
+Provides: mail-transport-agent
+
+Package: dbus-user-session
+Version: 1.14-1
+Provides: default-dbus-session-bus, dbus-session-bus (= 1.14)
+
+Package: docs
+Version: 1.0-1
+Depends: docs
+
+Package: unrelated
+Version: 1.0-1
+Depends: libfoo1 (>= 2.0)
+`
+
+// }}}
+
+func newGraph(t *testing.T) *graph.Graph {
+	index, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(packages)))
+	isok(t, err)
+	return graph.New(index)
+}
+
+/*
+ *
+ */
+
+func TestGraphDepends(t *testing.T) {
+	g := newGraph(t)
+	assert(t, len(g.Packages()) == 8)
+	assert(t, g.Package("libfoo1").Version.String() == "1.2-1")
+	assert(t, g.Package("missing") == nil)
+
+	edges := g.Depends("app", graph.Depends)
+	assert(t, len(edges) == 4)
+	assert(t, edges[0].To == "dbus-user-session")
+	assert(t, edges[0].Alternative)
+	assert(t, edges[2].To == "libfoo1")
+	assert(t, edges[3].To == "postfix")
+	assert(t, edges[3].Virtual == "mail-transport-agent")
+
+	assert(t, len(g.Depends("app")) == 5)
+	assert(t, len(g.Depends("unrelated")) == 0)
+
+	rdeps := g.ReverseDepends("libc6")
+	assert(t, len(rdeps) == 2)
+	assert(t, rdeps[0].From == "libfoo1")
+	assert(t, rdeps[1].From == "libgcc-s1")
+}
+
+func TestGraphClosure(t *testing.T) {
+	g := newGraph(t)
+	closure := g.Closure([]string{"app"}, graph.Depends, graph.PreDepends)
+	assert(t, strings.Join(closure, " ") == "app dbus-user-session libc6 libfoo1 libgcc-s1 postfix")
+	closure = g.Closure([]string{"app"})
+	assert(t, len(closure) == 7)
+}
+
+func TestGraphCycles(t *testing.T) {
+	g := newGraph(t)
+	cycles := g.Cycles()
+	assert(t, len(cycles) == 2)
+	assert(t, strings.Join(cycles[0], " ") == "docs")
+	assert(t, strings.Join(cycles[1], " ") == "libc6 libgcc-s1")
+	assert(t, len(g.Cycles(graph.Recommends)) == 0)
+}
+
+func TestGraphDOT(t *testing.T) {
+	g := newGraph(t)
+	out := bytes.Buffer{}
+	isok(t, g.WriteDOT(&out, graph.Depends))
+	assert(t, strings.HasPrefix(out.String(), "digraph packages {\n"))
+	assert(t, strings.Contains(out.String(), `"app" -> "postfix" [label="Depends"];`))
+	assert(t, strings.Contains(out.String(), `"app" -> "dbus-user-session" [label="Depends", style=dashed];`))
+	assert(t, !strings.Contains(out.String(), `"app" -> "docs"`))
+}
+
+// vim: foldmethod=marker
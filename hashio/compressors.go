@@ -1,25 +1,13 @@
 package hashio // import "pault.ag/go/debian/hashio"
 
 import (
-	"fmt"
-	"io"
-
-	"compress/gzip"
+	"pault.ag/go/debian/compression"
 )
 
-type Compressor func(io.Writer) (io.WriteCloser, error)
-
-func gzipCompressor(in io.Writer) (io.WriteCloser, error) {
-	return gzip.NewWriter(in), nil
-}
-
-var knownCompressors = map[string]Compressor{
-	"gz": gzipCompressor,
-}
+type Compressor = compression.Compressor
 
+// Return the Compressor for the named format ("gz", "xz", "zst", ...), as
+// picked by the compression package.
 func GetCompressor(name string) (Compressor, error) {
-	if compressor, ok := knownCompressors[name]; ok {
-		return compressor, nil
-	}
-	return nil, fmt.Errorf("No such compressor: '%s'", name)
+	return compression.CompressorFor(name)
 }
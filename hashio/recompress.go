@@ -0,0 +1,78 @@
+package hashio // import "pault.ag/go/debian/hashio"
+
+import (
+	"io"
+)
+
+// An Output is one of the files Recompress writes. Compression is the name
+// of a known Compressor ("gz", "xz", "zst"), or "" for the data as-is. Once
+// Recompress returns, Hashers holds the hashes of what was written to
+// Writer (that is, of the compressed data).
+type Output struct {
+	Compression string
+	Writer      io.Writer
+	Hashers     []*Hasher
+}
+
+// Extension returns the file extension used for this Output's compression,
+// including the leading dot, or "" if it's uncompressed.
+func (o Output) Extension() string {
+	if o.Compression == "" {
+		return ""
+	}
+	return "." + o.Compression
+}
+
+// Recompress reads in (which must be uncompressed) exactly once, and writes
+// it to every Output, compressing as needed, and hashing each compressed
+// stream with every algorithm in hashes as it goes.
+//
+// This is handy for publishing an index such as Packages or Sources, which
+// is expected to be on disk in a number of compressions, each of which
+// needs to be listed in the Release file.
+func Recompress(in io.Reader, hashes []string, outputs ...*Output) error {
+	writers := []io.Writer{}
+	closers := []io.Closer{}
+	defer func() {
+		/* Anything still open here is on the way out through an error */
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}()
+
+	for _, output := range outputs {
+		target, hashers, err := NewHasherWriters(hashes, output.Writer)
+		if err != nil {
+			return err
+		}
+		output.Hashers = hashers
+
+		if output.Compression != "" {
+			compressor, err := GetCompressor(output.Compression)
+			if err != nil {
+				return err
+			}
+			compressed, err := compressor(target)
+			if err != nil {
+				return err
+			}
+			closers = append(closers, compressed)
+			target = compressed
+		}
+		writers = append(writers, target)
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), in); err != nil {
+		return err
+	}
+
+	/* Flush each compressor, so the trailing bytes get hashed too */
+	for len(closers) > 0 {
+		closer := closers[0]
+		closers = closers[1:]
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package hashio_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/hashio"
+)
+
+func TestRecompress(t *testing.T) {
+	data := bytes.Repeat([]byte("Package: foo\nVersion: 1.0\n\n"), 100)
+
+	outputs := []*hashio.Output{}
+	buffers := []*bytes.Buffer{}
+	for _, compression := range []string{"", "gz", "xz", "zst"} {
+		buffer := &bytes.Buffer{}
+		buffers = append(buffers, buffer)
+		outputs = append(outputs, &hashio.Output{Compression: compression, Writer: buffer})
+	}
+	if err := hashio.Recompress(bytes.NewReader(data), []string{"md5", "sha256"}, outputs...); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, output := range outputs {
+		written := buffers[i].Bytes()
+		if len(output.Hashers) != 2 || output.Hashers[1].Size() != int64(len(written)) {
+			t.Fatalf("%s: wrong hashers", output.Compression)
+		}
+		if fmt.Sprintf("%x", output.Hashers[1].Sum(nil)) != fmt.Sprintf("%x", sha256.Sum256(written)) {
+			t.Fatalf("%s: wrong sha256", output.Compression)
+		}
+
+		var reader io.Reader = bytes.NewReader(written)
+		var err error
+		switch output.Compression {
+		case "gz":
+			reader, err = gzip.NewReader(reader)
+		case "xz":
+			reader, err = xz.NewReader(reader)
+		case "zst":
+			reader, err = zstd.NewReader(reader)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plain, data) {
+			t.Fatalf("%s: round-trip failed", output.Compression)
+		}
+	}
+
+	if err := hashio.Recompress(bytes.NewReader(data), nil, &hashio.Output{Compression: "lzma"}); err == nil {
+		t.Fatal("unknown compression accepted")
+	}
+}
+
+type countingCloser struct {
+	io.Writer
+	closed *int
+}
+
+func (c countingCloser) Close() error {
+	*c.closed++
+	return nil
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, fmt.Errorf("read failed")
+}
+
+func TestRecompressClosesOnError(t *testing.T) {
+	closed := 0
+	compression.Register(compression.Backend{
+		Name:      "test",
+		Extension: "recompress-test",
+		Compressor: func(w io.Writer) (io.WriteCloser, error) {
+			return countingCloser{Writer: w, closed: &closed}, nil
+		},
+	})
+
+	output := &hashio.Output{Compression: "recompress-test", Writer: &bytes.Buffer{}}
+	if err := hashio.Recompress(failingReader{}, []string{"sha256"}, output); err == nil {
+		t.Fatal("expected the read error")
+	}
+	if closed != 1 {
+		t.Fatalf("compressor closed %d times after a read error", closed)
+	}
+
+	/* A bad Output after a good one */
+	closed = 0
+	bad := &hashio.Output{Compression: "no-such-compression", Writer: &bytes.Buffer{}}
+	if err := hashio.Recompress(bytes.NewReader(nil), []string{"sha256"}, output, bad); err == nil {
+		t.Fatal("expected an unknown compression error")
+	}
+	if closed != 1 {
+		t.Fatalf("compressor closed %d times after a bad Output", closed)
+	}
+
+	closed = 0
+	if err := hashio.Recompress(bytes.NewReader([]byte("data")), []string{"sha256"}, output); err != nil {
+		t.Fatal(err)
+	}
+	if closed != 1 {
+		t.Fatalf("compressor closed %d times", closed)
+	}
+}
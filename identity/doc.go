@@ -0,0 +1,19 @@
+/*
+Work out who's making a change, from the environment variables the Debian
+tools (dch, debchange, dpkg-buildpackage) read, and write it out the way a
+Maintainer or Changed-By field wants it.
+
+	who, err := identity.FromEnvironment()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf(" -- %s  %s\n", who, time.Now().Format(time.RFC1123Z))
+
+Parse and ParseList go the other way, reading Maintainer, Changed-By and
+Uploaders fields back into Identities, quoted names (with commas in them)
+and all.
+
+This package only uses the standard library, so the changelog package can
+use it too.
+*/
+package identity // import "pault.ag/go/debian/identity"
@@ -0,0 +1,134 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package identity // import "pault.ag/go/debian/identity"
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+)
+
+// Identity {{{
+
+// An Identity is a person (or team), as in a Maintainer, Uploaders or
+// Changed-By field: "Jane Doe <jane@example.org>".
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// Characters that RFC 5322 won't allow unquoted in a display name. Dots
+// are allowed, since "Jane Q. Doe" is common, and mail readers cope.
+const specials = `()<>[]:;@\,"`
+
+// Return the Identity as "Name <email>", quoting the name if it has
+// anything in it (such as a comma) that would otherwise be misread.
+func (i Identity) String() string {
+	name := i.Name
+	if strings.ContainsAny(name, specials) {
+		name = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+	}
+	switch {
+	case name == "":
+		return "<" + i.Email + ">"
+	case i.Email == "":
+		return name
+	}
+	return name + " <" + i.Email + ">"
+}
+
+func (i Identity) MarshalControl() (string, error) {
+	return i.String(), nil
+}
+
+// }}}
+
+// Environment {{{
+
+// Split "Jane Doe <jane@example.org>" into a name and address, or return
+// the whole thing as the address if there's no name.
+func splitAddress(value string) (string, string) {
+	value = strings.TrimSpace(value)
+	open := strings.LastIndex(value, "<")
+	if open < 0 || !strings.HasSuffix(value, ">") {
+		return "", value
+	}
+	name := strings.Trim(strings.TrimSpace(value[:open]), `"`)
+	return name, strings.TrimSpace(value[open+1 : len(value)-1])
+}
+
+// Work out the Identity from environment variables, the way dch does:
+//
+// The address is DEBEMAIL, or EMAIL. Either may also be "Name <address>",
+// and the name is the first of DEBFULLNAME, the name in DEBEMAIL, the name
+// in EMAIL, and NAME, that's set. So a name given along with the address
+// wins over NAME, which is often set to something else entirely.
+//
+// getenv is called for each variable, so os.Getenv does the obvious thing.
+// An error is returned if no address is set, or it doesn't look like one.
+func Lookup(getenv func(string) string) (*Identity, error) {
+	ret := Identity{Name: strings.TrimSpace(getenv("DEBFULLNAME"))}
+	for _, variable := range []string{"DEBEMAIL", "EMAIL"} {
+		value := strings.TrimSpace(getenv(variable))
+		if value == "" {
+			continue
+		}
+		name, email := splitAddress(value)
+		if ret.Name == "" {
+			ret.Name = name
+		}
+		if ret.Email == "" {
+			ret.Email = email
+		}
+	}
+	if ret.Name == "" {
+		ret.Name = strings.TrimSpace(getenv("NAME"))
+	}
+
+	if ret.Email == "" {
+		return nil, fmt.Errorf("No email address set; set DEBEMAIL (or EMAIL)")
+	}
+	if !strings.Contains(ret.Email, "@") || strings.ContainsAny(ret.Email, " <>") {
+		return nil, fmt.Errorf("Invalid email address: '%s'", ret.Email)
+	}
+	return &ret, nil
+}
+
+// Work out the Identity from the environment, as Lookup does, falling back
+// to the full name in the user's passwd entry if no name is set.
+func FromEnvironment() (*Identity, error) {
+	ret, err := Lookup(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Name == "" {
+		if current, err := user.Current(); err == nil {
+			/* The GECOS field is "Full Name,Room,Phone,..." */
+			ret.Name = strings.TrimSpace(strings.SplitN(current.Name, ",", 2)[0])
+		}
+	}
+	return ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,127 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package identity_test
+
+import (
+	"log"
+	"testing"
+
+	"pault.ag/go/debian/identity"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+func env(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func TestIdentityString(t *testing.T) {
+	assert(t, identity.Identity{Name: "Jane Q. Doe", Email: "jane@example.org"}.String() ==
+		"Jane Q. Doe <jane@example.org>")
+	assert(t, identity.Identity{Name: "Doe, Jane", Email: "jane@example.org"}.String() ==
+		`"Doe, Jane" <jane@example.org>`)
+	assert(t, identity.Identity{Name: `Jane "JD" Doe`, Email: "jane@example.org"}.String() ==
+		`"Jane \"JD\" Doe" <jane@example.org>`)
+	assert(t, identity.Identity{Email: "jane@example.org"}.String() == "<jane@example.org>")
+}
+
+func TestLookup(t *testing.T) {
+	who, err := identity.Lookup(env(map[string]string{
+		"DEBFULLNAME": "Jane Doe",
+		"DEBEMAIL":    "jane@debian.org",
+		"NAME":        "Jane",
+		"EMAIL":       "jane@example.org",
+	}))
+	isok(t, err)
+	assert(t, who.String() == "Jane Doe <jane@debian.org>")
+
+	who, err = identity.Lookup(env(map[string]string{
+		"NAME":  "Jane",
+		"EMAIL": "jane@example.org",
+	}))
+	isok(t, err)
+	assert(t, who.String() == "Jane <jane@example.org>")
+
+	/* The name may come along with DEBEMAIL, but DEBFULLNAME wins */
+	who, err = identity.Lookup(env(map[string]string{
+		"DEBEMAIL": "Jane Doe <jane@debian.org>",
+	}))
+	isok(t, err)
+	assert(t, who.Name == "Jane Doe")
+	assert(t, who.Email == "jane@debian.org")
+	who, err = identity.Lookup(env(map[string]string{
+		"DEBEMAIL":    "Jane Doe <jane@debian.org>",
+		"DEBFULLNAME": "J. Doe",
+	}))
+	isok(t, err)
+	assert(t, who.String() == "J. Doe <jane@debian.org>")
+
+	/* ... and it wins over NAME, as in dch */
+	who, err = identity.Lookup(env(map[string]string{
+		"DEBEMAIL": "Jane Doe <jane@debian.org>",
+		"NAME":     "jane",
+	}))
+	isok(t, err)
+	assert(t, who.String() == "Jane Doe <jane@debian.org>")
+	who, err = identity.Lookup(env(map[string]string{
+		"DEBEMAIL": "jane@debian.org",
+		"EMAIL":    "Jane Doe <jane@example.org>",
+		"NAME":     "jane",
+	}))
+	isok(t, err)
+	assert(t, who.String() == "Jane Doe <jane@debian.org>")
+
+	_, err = identity.Lookup(env(map[string]string{"DEBFULLNAME": "Jane Doe"}))
+	notok(t, err)
+	_, err = identity.Lookup(env(map[string]string{"DEBEMAIL": "jane"}))
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
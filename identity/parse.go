@@ -0,0 +1,208 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package identity // import "pault.ag/go/debian/identity"
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parse {{{
+
+// Parse a single address, as in a Maintainer or Changed-By field. The
+// forms RFC 5322 allows (and that turn up in the archive) are understood:
+//
+//	Jane Doe <jane@example.org>
+//	"Doe, Jane" <jane@example.org>
+//	<jane@example.org>
+//	jane@example.org
+//	jane@example.org (Jane Doe)
+//
+// An error is returned if there's no address, or if a quote or angle
+// bracket is never closed.
+func Parse(value string) (*Identity, error) {
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return nil, fmt.Errorf("Empty address")
+	}
+
+	ret := Identity{}
+	name := strings.Builder{}
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '"':
+			unquoted, end, err := unquote(value, i)
+			if err != nil {
+				return nil, err
+			}
+			name.WriteString(unquoted)
+			i = end
+		case '<':
+			end := strings.IndexByte(value[i:], '>')
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated '<' in '%s'", value)
+			}
+			if ret.Email != "" {
+				return nil, fmt.Errorf("More than one address in '%s'", value)
+			}
+			ret.Email = strings.TrimSpace(value[i+1 : i+end])
+			i += end
+		case '(':
+			end := strings.IndexByte(value[i:], ')')
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated '(' in '%s'", value)
+			}
+			/* "jane@example.org (Jane Doe)" is the old way to give a
+			 * name; anywhere else, it's just a comment. */
+			if comment := strings.TrimSpace(value[i+1 : i+end]); ret.Email == "" {
+				ret.Name = comment
+			}
+			i += end
+		default:
+			name.WriteByte(value[i])
+		}
+	}
+
+	text := strings.TrimSpace(name.String())
+	switch {
+	case ret.Email != "":
+		if text != "" {
+			ret.Name = text
+		}
+	case strings.Contains(text, "@") && !strings.Contains(text, " "):
+		ret.Email = text
+	default:
+		return nil, fmt.Errorf("No email address in '%s'", value)
+	}
+	if ret.Email == "" {
+		return nil, fmt.Errorf("Empty email address in '%s'", value)
+	}
+	return &ret, nil
+}
+
+// Return the text of the quoted string starting at value[start], and the
+// index of its closing quote.
+func unquote(value string, start int) (string, int, error) {
+	ret := strings.Builder{}
+	for i := start + 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if i+1 < len(value) {
+				i++
+				ret.WriteByte(value[i])
+			}
+		case '"':
+			return ret.String(), i, nil
+		default:
+			ret.WriteByte(value[i])
+		}
+	}
+	return "", 0, fmt.Errorf("Unterminated quote in '%s'", value)
+}
+
+// Split a list of addresses, such as an Uploaders field, on the commas
+// between them, and Parse each one. Commas in a quoted name, a comment or
+// an address don't count, so `"Doe, Jane" <jane@example.org>` stays in
+// one piece. Empty entries (from a trailing comma, say) are skipped.
+func ParseList(value string) ([]Identity, error) {
+	ret := []Identity{}
+	for _, part := range splitList(value) {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		who, err := Parse(part)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *who)
+	}
+	return ret, nil
+}
+
+func splitList(value string) []string {
+	ret := []string{}
+	quoted := false
+	var closer byte
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"' && closer == 0:
+			quoted = !quoted
+		case quoted:
+		case closer != 0:
+			if c == closer {
+				closer = 0
+			}
+		case c == '<':
+			closer = '>'
+		case c == '(':
+			closer = ')'
+		case c == ',':
+			ret = append(ret, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(ret, value[start:])
+}
+
+// }}}
+
+// Control {{{
+
+func (i *Identity) UnmarshalControl(value string) error {
+	who, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	*i = *who
+	return nil
+}
+
+// A List is a list of Identities, as in an Uploaders field.
+type List []Identity
+
+// Return the Identities, separated by commas.
+func (l List) String() string {
+	parts := make([]string, len(l))
+	for i, who := range l {
+		parts[i] = who.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (l *List) UnmarshalControl(value string) error {
+	who, err := ParseList(value)
+	if err != nil {
+		return err
+	}
+	*l = who
+	return nil
+}
+
+func (l List) MarshalControl() (string, error) {
+	return l.String(), nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,128 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package identity_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/identity"
+)
+
+/*
+ *
+ */
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		In          string
+		Name, Email string
+	}{
+		{"Jane Doe <jane@example.org>", "Jane Doe", "jane@example.org"},
+		{"  Jane   Q. Doe\n <jane@example.org> ", "Jane Q. Doe", "jane@example.org"},
+		{`"Doe, Jane" <jane@example.org>`, "Doe, Jane", "jane@example.org"},
+		{`"Jane \"JD\" Doe" <jane@example.org>`, `Jane "JD" Doe`, "jane@example.org"},
+		{"<jane@example.org>", "", "jane@example.org"},
+		{"jane@example.org", "", "jane@example.org"},
+		{"jane@example.org (Jane Doe)", "Jane Doe", "jane@example.org"},
+		{"Debian QA Group <packages@qa.debian.org>", "Debian QA Group", "packages@qa.debian.org"},
+	} {
+		who, err := identity.Parse(test.In)
+		isok(t, err)
+		if who.Name != test.Name || who.Email != test.Email {
+			t.Errorf("%q parsed as %q <%q>", test.In, who.Name, who.Email)
+		}
+	}
+
+	for _, bad := range []string{
+		"",
+		"Jane Doe",
+		"Jane Doe <jane@example.org",
+		`"Jane Doe <jane@example.org>`,
+		"Jane <jane@example.org> <doe@example.org>",
+		"Jane Doe <>",
+	} {
+		_, err := identity.Parse(bad)
+		notok(t, err)
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	for _, who := range []identity.Identity{
+		{Name: "Jane Doe", Email: "jane@example.org"},
+		{Name: "Doe, Jane", Email: "jane@example.org"},
+		{Name: `Jane "JD" Doe (maybe)`, Email: "jane@example.org"},
+		{Email: "jane@example.org"},
+	} {
+		parsed, err := identity.Parse(who.String())
+		isok(t, err)
+		assert(t, *parsed == who)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	list, err := identity.ParseList(`Jane Doe <jane@example.org>, "Roe, Richard" <richard@example.org>,
+ Bob <bob+a,b@example.org> (Bob, really),`)
+	isok(t, err)
+	assert(t, len(list) == 3)
+	assert(t, list[0].Name == "Jane Doe")
+	assert(t, list[1].Name == "Roe, Richard")
+	assert(t, list[2].Email == "bob+a,b@example.org")
+	assert(t, identity.List(list).String() ==
+		`Jane Doe <jane@example.org>, "Roe, Richard" <richard@example.org>, Bob <bob+a,b@example.org>`)
+
+	/* An unquoted comma splits the name off from the address */
+	_, err = identity.ParseList("Doe, Jane <jane@example.org>")
+	notok(t, err)
+
+	list, err = identity.ParseList("")
+	isok(t, err)
+	assert(t, len(list) == 0)
+}
+
+func TestUnmarshalControl(t *testing.T) {
+	type Upload struct {
+		Maintainer identity.Identity
+		Uploaders  identity.List
+		ChangedBy  *identity.Identity `control:"Changed-By"`
+	}
+	upload := Upload{}
+	isok(t, control.Unmarshal(&upload, strings.NewReader(`Maintainer: Jane Doe <jane@example.org>
+Uploaders: "Roe, Richard" <richard@example.org>,
+ Bob <bob@example.org>
+Changed-By: Bob <bob@example.org>
+`)))
+	assert(t, upload.Maintainer.Email == "jane@example.org")
+	assert(t, len(upload.Uploaders) == 2)
+	assert(t, upload.Uploaders[0].Name == "Roe, Richard")
+	assert(t, upload.ChangedBy.Name == "Bob")
+
+	out := bytes.Buffer{}
+	isok(t, control.Marshal(&out, upload))
+	assert(t, out.String() == `Maintainer: Jane Doe <jane@example.org>
+Uploaders: "Roe, Richard" <richard@example.org>, Bob <bob@example.org>
+Changed-By: Bob <bob@example.org>
+`)
+}
+
+// vim: foldmethod=marker
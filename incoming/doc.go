@@ -0,0 +1,12 @@
+/*
+Process an incoming queue of uploads, the way the Debian archive software
+(dak) handles its `incoming` directory.
+
+Uploaders (such as `dput`) copy every file named by a .changes into the
+queue directory, and then copy the .changes itself last. A Queue watches the
+directory, waits until every file referenced by a .changes has arrived,
+checks the OpenPGP signature and every checksum, and then hands the
+complete, validated Upload to a callback, which might go on to publish it
+into an archive.
+*/
+package incoming // import "pault.ag/go/debian/incoming"
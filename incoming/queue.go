@@ -0,0 +1,373 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package incoming // import "pault.ag/go/debian/incoming"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/crypto/openpgp"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/pgp"
+)
+
+// Upload {{{
+
+// An Upload is a .changes file which has had its signature and the
+// checksums of every file it references checked.
+type Upload struct {
+	Changes *control.Changes
+
+	// Entity that signed the .changes, or nil if the Queue has no Keyring.
+	Signer *openpgp.Entity
+}
+
+// Return the absolute paths of every file in the Upload, with the .changes
+// file last.
+func (u *Upload) Paths() []string {
+	ret := []string{}
+	for _, file := range u.Changes.AbsFiles() {
+		ret = append(ret, file.Filename)
+	}
+	return append(ret, u.Changes.Filename)
+}
+
+// }}}
+
+// Queue {{{
+
+// ErrIncomplete is returned by Queue.Process when a file named by the
+// .changes hasn't (fully) arrived yet. The .changes should be tried again
+// later.
+var ErrIncomplete = errors.New("Upload is incomplete")
+
+// A Queue is a directory that uploads are placed into.
+type Queue struct {
+	Directory string
+
+	// Keys trusted to sign uploads. If nil, signatures are not checked at
+	// all, which is only sensible for testing.
+	Keyring openpgp.EntityList
+
+	// Called with each complete and valid Upload. It's up to the Handler to
+	// move the files out of the queue (for instance, with Changes.Move or
+	// Changes.Remove); files left behind will be handed over again the next
+	// time the queue is scanned.
+	Handler func(*Upload) error
+
+	// Called with the path to each .changes that fails validation. If nil,
+	// rejected uploads are left in place and silently skipped.
+	Reject func(path string, err error)
+
+	// How long Watch waits for a .changes that fails validation to stop
+	// changing before it's rejected. If zero, one second.
+	Settle time.Duration
+}
+
+// Create a new Queue on the given directory.
+func New(directory string, keyring openpgp.EntityList, handler func(*Upload) error) *Queue {
+	return &Queue{Directory: directory, Keyring: keyring, Handler: handler}
+}
+
+// Parse and validate a single .changes file. ErrIncomplete is returned if
+// any of the referenced files are missing or shorter than they should be;
+// any other error means the upload is bad.
+func (q *Queue) Process(path string) (*Upload, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keyring *openpgp.EntityList
+	if q.Keyring != nil {
+		keyring = &q.Keyring
+	}
+	decoder, err := pgp.NewDecoder(f, keyring)
+	if err != nil {
+		return nil, err
+	}
+	changes := control.Changes{Filename: path}
+	if err := decoder.Decode(&changes); err != nil {
+		return nil, err
+	}
+	if keyring != nil && decoder.Signer() == nil {
+		return nil, fmt.Errorf("%s is not signed", filepath.Base(path))
+	}
+
+	if err := checkFiles(&changes); err != nil {
+		return nil, err
+	}
+
+	/* The strongest set of checksums in the .changes */
+	files, err := changes.GetFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range files {
+		if err := verify(filepath.Join(filepath.Dir(path), hash.Filename), hash); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Upload{Changes: &changes, Signer: decoder.Signer()}, nil
+}
+
+// Make sure every file named in the .changes is in the queue directory,
+// and that each set of checksums lists exactly the files Files does, so
+// that the set we end up verifying against can't name something else.
+func checkFiles(changes *control.Changes) error {
+	if len(changes.Files) == 0 {
+		return fmt.Errorf("No Files listed in %s", filepath.Base(changes.Filename))
+	}
+	sizes := map[string]int64{}
+	for _, file := range changes.Files {
+		if filepath.Base(file.Filename) != file.Filename {
+			return fmt.Errorf("Refusing to handle file '%s' outside the queue", file.Filename)
+		}
+		sizes[file.Filename] = file.Size
+	}
+
+	lists := []struct {
+		field  string
+		hashes []control.FileHash
+	}{
+		{field: "Checksums-Sha1", hashes: changes.Checksums("sha1").Files},
+		{field: "Checksums-Sha256", hashes: changes.Checksums("sha256").Files},
+	}
+
+	for _, list := range lists {
+		if len(list.hashes) == 0 {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, hash := range list.hashes {
+			if filepath.Base(hash.Filename) != hash.Filename {
+				return fmt.Errorf("Refusing to handle file '%s' outside the queue", hash.Filename)
+			}
+			size, ok := sizes[hash.Filename]
+			if !ok || seen[hash.Filename] {
+				return fmt.Errorf("%s and Files don't list the same files", list.field)
+			}
+			if size != hash.Size {
+				return fmt.Errorf("%s and Files disagree on the size of '%s'", list.field, hash.Filename)
+			}
+			seen[hash.Filename] = true
+		}
+		if len(seen) != len(sizes) {
+			return fmt.Errorf("%s and Files don't list the same files", list.field)
+		}
+	}
+	return nil
+}
+
+func verify(path string, hash control.FileHash) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ErrIncomplete
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < hash.Size {
+		return ErrIncomplete
+	} else if info.Size() > hash.Size {
+		return fmt.Errorf("%s: size mismatch: got %d, want %d", hash.Filename, info.Size(), hash.Size)
+	}
+
+	verifier, err := hash.Verifier()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(verifier, f); err != nil {
+		return err
+	}
+	if err := verifier.Close(); err != nil {
+		return fmt.Errorf("%s: %s", hash.Filename, err)
+	}
+	return nil
+}
+
+// Try to handle the .changes at path. Returns true if the .changes is
+// still waiting on files. A .changes that fails validation is only
+// rejected if stable says it's done changing; otherwise it's left waiting,
+// too.
+func (q *Queue) handle(path string, stable func(string) bool) (bool, error) {
+	upload, err := q.Process(path)
+	if err == ErrIncomplete {
+		return true, nil
+	} else if os.IsNotExist(err) {
+		/* Handled (and moved) by someone else in the meantime */
+		return false, nil
+	} else if err != nil {
+		if !stable(path) {
+			return true, nil
+		}
+		if q.Reject != nil {
+			q.Reject(path, err)
+		}
+		return false, nil
+	}
+	return false, q.Handler(upload)
+}
+
+// Process every .changes currently in the queue directory, returning the
+// paths of those that are still incomplete.
+func (q *Queue) Scan() ([]string, error) {
+	return q.scan(func(string) bool { return true })
+}
+
+func (q *Queue) scan(stable func(string) bool) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(q.Directory, "*.changes"))
+	if err != nil {
+		return nil, err
+	}
+	pending := []string{}
+	for _, path := range matches {
+		waiting, err := q.handle(path, stable)
+		if err != nil {
+			return nil, err
+		}
+		if waiting {
+			pending = append(pending, path)
+		}
+	}
+	return pending, nil
+}
+
+// How a .changes that failed validation looked when we first saw it fail.
+type unsettled struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// Watch the queue directory until the context is canceled (or the Handler
+// returns an error), handing each Upload to the Handler as it completes.
+// Anything already in the queue is handled first.
+//
+// Incomplete .changes are kept track of, and tried again whenever another
+// file in the directory is written to. Since a .changes that's still being
+// uploaded may well not parse yet, one that fails validation is only
+// rejected once it has gone unchanged for Settle.
+func (q *Queue) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watcher.Add(q.Directory); err != nil {
+		return err
+	}
+
+	settle := q.Settle
+	if settle <= 0 {
+		settle = time.Second
+	}
+	failing := map[string]unsettled{}
+	stable := func(path string) bool {
+		info, err := os.Stat(path)
+		if err != nil {
+			return true
+		}
+		last, ok := failing[path]
+		if ok && last.size == info.Size() && last.modTime.Equal(info.ModTime()) {
+			return time.Since(last.since) >= settle
+		}
+		failing[path] = unsettled{size: info.Size(), modTime: info.ModTime(), since: time.Now()}
+		return false
+	}
+	retry := func(pending map[string]bool, paths map[string]bool) error {
+		for path := range paths {
+			waiting, err := q.handle(path, stable)
+			if err != nil {
+				return err
+			}
+			if !waiting {
+				delete(pending, path)
+				delete(failing, path)
+			}
+		}
+		return nil
+	}
+
+	pending := map[string]bool{}
+	scanned, err := q.scan(stable)
+	if err != nil {
+		return err
+	}
+	for _, path := range scanned {
+		pending[path] = true
+	}
+
+	ticker := time.NewTicker(settle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-watcher.Errors:
+			return err
+		case <-ticker.C:
+			/* Nothing else may happen in the directory, so check on
+			 * anything that's failing by itself */
+			unsettledPaths := map[string]bool{}
+			for path := range failing {
+				unsettledPaths[path] = true
+			}
+			if err := retry(pending, unsettledPaths); err != nil {
+				return err
+			}
+		case event := <-watcher.Events:
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			if strings.HasSuffix(event.Name, ".changes") {
+				pending[event.Name] = true
+			}
+			if err := retry(pending, pending); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,277 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package incoming_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"pault.ag/go/debian/incoming"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+var debData = []byte("not really a deb")
+
+func changesFor(name string, data []byte) []byte {
+	return []byte(fmt.Sprintf(`Format: 1.8
+Source: hello
+Version: 1.0-1
+Distribution: unstable
+Architecture: amd64
+Checksums-Sha256:
+ %x %d %s
+Files:
+ %x %d devel optional %s
+`, sha256.Sum256(data), len(data), name, md5.Sum(data), len(data), name))
+}
+
+func sign(t *testing.T, signer *openpgp.Entity, data []byte) []byte {
+	out := bytes.Buffer{}
+	w, err := clearsign.Encode(&out, signer.PrivateKey, nil)
+	isok(t, err)
+	_, err = w.Write(data)
+	isok(t, err)
+	isok(t, w.Close())
+	return out.Bytes()
+}
+
+/*
+ *
+ */
+
+func TestQueueScan(t *testing.T) {
+	dir := t.TempDir()
+	uploads := []*incoming.Upload{}
+	rejected := []string{}
+	queue := incoming.New(dir, nil, func(upload *incoming.Upload) error {
+		uploads = append(uploads, upload)
+		return nil
+	})
+	queue.Reject = func(path string, err error) {
+		rejected = append(rejected, filepath.Base(path))
+	}
+
+	isok(t, os.WriteFile(filepath.Join(dir, "good.changes"), changesFor("good.deb", debData), 0644))
+	isok(t, os.WriteFile(filepath.Join(dir, "bad.changes"), changesFor("bad.deb", debData), 0644))
+	isok(t, os.WriteFile(filepath.Join(dir, "bad.deb"), []byte("not really a DEB"), 0644))
+
+	/* good.deb hasn't arrived yet */
+	pending, err := queue.Scan()
+	isok(t, err)
+	assert(t, len(pending) == 1)
+	assert(t, len(uploads) == 0)
+	assert(t, len(rejected) == 1)
+	assert(t, rejected[0] == "bad.changes")
+
+	/* A partial file is still incomplete */
+	isok(t, os.WriteFile(filepath.Join(dir, "good.deb"), debData[:4], 0644))
+	_, err = queue.Process(filepath.Join(dir, "good.changes"))
+	assert(t, err == incoming.ErrIncomplete)
+
+	isok(t, os.WriteFile(filepath.Join(dir, "good.deb"), debData, 0644))
+	pending, err = queue.Scan()
+	isok(t, err)
+	assert(t, len(pending) == 0)
+	assert(t, len(uploads) == 1)
+	assert(t, uploads[0].Changes.Source == "hello")
+	paths := uploads[0].Paths()
+	assert(t, len(paths) == 2)
+	assert(t, paths[1] == filepath.Join(dir, "good.changes"))
+
+	isok(t, os.WriteFile(filepath.Join(dir, "evil.changes"), changesFor("../evil.deb", debData), 0644))
+	_, err = queue.Process(filepath.Join(dir, "evil.changes"))
+	notok(t, err)
+}
+
+func TestQueueChecksumLists(t *testing.T) {
+	dir := t.TempDir()
+	queue := incoming.New(dir, nil, nil)
+	isok(t, os.WriteFile(filepath.Join(dir, "hello.deb"), debData, 0644))
+	isok(t, os.WriteFile(filepath.Join(dir, "other.deb"), debData, 0644))
+
+	md5sum, sha256sum := md5.Sum(debData), sha256.Sum256(debData)
+	for _, changes := range []string{
+		/* Checksums-Sha256 names something outside the queue */
+		fmt.Sprintf("Checksums-Sha256:\n %x %d ../hello.deb\nFiles:\n %x %d devel optional hello.deb\n",
+			sha256sum, len(debData), md5sum, len(debData)),
+		/* ... or something Files doesn't */
+		fmt.Sprintf("Checksums-Sha256:\n %x %d other.deb\nFiles:\n %x %d devel optional hello.deb\n",
+			sha256sum, len(debData), md5sum, len(debData)),
+		/* ... or misses something out */
+		fmt.Sprintf("Checksums-Sha256:\n %x %d hello.deb\nFiles:\n %x %d devel optional hello.deb\n %x %d devel optional other.deb\n",
+			sha256sum, len(debData), md5sum, len(debData), md5sum, len(debData)),
+		/* ... or has the size wrong */
+		fmt.Sprintf("Checksums-Sha1:\n %x %d hello.deb\nFiles:\n %x %d devel optional hello.deb\n",
+			sha1.Sum(debData), len(debData)+1, md5sum, len(debData)),
+		/* No Files at all */
+		fmt.Sprintf("Checksums-Sha256:\n %x %d hello.deb\n", sha256sum, len(debData)),
+	} {
+		path := filepath.Join(dir, "hello.changes")
+		isok(t, os.WriteFile(path, []byte("Format: 1.8\nSource: hello\nVersion: 1.0-1\n"+changes), 0644))
+		_, err := queue.Process(path)
+		notok(t, err)
+		assert(t, err != incoming.ErrIncomplete)
+	}
+}
+
+func TestQueueSignatures(t *testing.T) {
+	signer, err := openpgp.NewEntity("Test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	isok(t, err)
+	stranger, err := openpgp.NewEntity("Stranger", "", "stranger@example.com", &packet.Config{RSABits: 1024})
+	isok(t, err)
+
+	dir := t.TempDir()
+	queue := incoming.New(dir, openpgp.EntityList{signer}, nil)
+	isok(t, os.WriteFile(filepath.Join(dir, "hello.deb"), debData, 0644))
+
+	path := filepath.Join(dir, "hello.changes")
+	isok(t, os.WriteFile(path, changesFor("hello.deb", debData), 0644))
+	_, err = queue.Process(path)
+	notok(t, err)
+
+	isok(t, os.WriteFile(path, sign(t, stranger, changesFor("hello.deb", debData)), 0644))
+	_, err = queue.Process(path)
+	notok(t, err)
+
+	isok(t, os.WriteFile(path, sign(t, signer, changesFor("hello.deb", debData)), 0644))
+	upload, err := queue.Process(path)
+	isok(t, err)
+	assert(t, upload.Signer != nil)
+	assert(t, upload.Signer.PrimaryKey.KeyId == signer.PrimaryKey.KeyId)
+}
+
+func TestQueueWatch(t *testing.T) {
+	dir := t.TempDir()
+	uploads := make(chan *incoming.Upload, 1)
+	queue := incoming.New(dir, nil, func(upload *incoming.Upload) error {
+		uploads <- upload
+		return upload.Changes.Remove()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- queue.Watch(ctx) }()
+
+	/* Upload the .changes first, so the queue has to wait on the .deb */
+	time.Sleep(100 * time.Millisecond)
+	isok(t, os.WriteFile(filepath.Join(dir, "hello.changes"), changesFor("hello.deb", debData), 0644))
+	time.Sleep(100 * time.Millisecond)
+	isok(t, os.WriteFile(filepath.Join(dir, "hello.deb"), debData, 0644))
+
+	select {
+	case upload := <-uploads:
+		assert(t, upload.Changes.Version.String() == "1.0-1")
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the upload")
+	}
+	cancel()
+	assert(t, <-done == context.Canceled)
+
+	_, err := os.Stat(filepath.Join(dir, "hello.deb"))
+	assert(t, os.IsNotExist(err))
+}
+
+func TestQueueWatchPartial(t *testing.T) {
+	dir := t.TempDir()
+	uploads := make(chan *incoming.Upload, 1)
+	rejected := make(chan string, 2)
+	queue := incoming.New(dir, nil, func(upload *incoming.Upload) error {
+		uploads <- upload
+		return upload.Changes.Remove()
+	})
+	queue.Reject = func(path string, err error) { rejected <- filepath.Base(path) }
+	queue.Settle = 500 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- queue.Watch(ctx) }()
+
+	/* Half a .changes doesn't validate, but it isn't rejected while it's
+	 * still being written */
+	changes := changesFor("hello.deb", debData)
+	path := filepath.Join(dir, "hello.changes")
+	time.Sleep(100 * time.Millisecond)
+	isok(t, os.WriteFile(filepath.Join(dir, "hello.deb"), debData, 0644))
+	isok(t, os.WriteFile(path, changes[:bytes.Index(changes, []byte("Files:"))], 0644))
+	time.Sleep(200 * time.Millisecond)
+	isok(t, os.WriteFile(path, changes, 0644))
+
+	select {
+	case upload := <-uploads:
+		assert(t, upload.Changes.Version.String() == "1.0-1")
+	case name := <-rejected:
+		t.Fatalf("%s was rejected while it was being written", name)
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the upload")
+	}
+
+	/* One that stays broken is rejected once it settles */
+	isok(t, os.WriteFile(filepath.Join(dir, "broken.changes"), changes[:bytes.Index(changes, []byte("Files:"))], 0644))
+	select {
+	case name := <-rejected:
+		assert(t, name == "broken.changes")
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the rejection")
+	}
+	cancel()
+	assert(t, <-done == context.Canceled)
+}
+
+// vim: foldmethod=marker
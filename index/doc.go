@@ -0,0 +1,16 @@
+/*
+Query binary packages across a set of merged indices.
+
+An Index is built up from any number of Packages indices (say, one per
+suite or per mirror), each with an APT-style priority. Find answers
+questions like "which versions of libssl-dev >= 3.0 are available for
+amd64?", returning every matching candidate, best first, the way APT would
+pick between them.
+
+Packages is for holding a whole archive's worth of Packages indices in
+memory at once: values are interned, paragraphs share their field lists,
+and lookups by name, by name and architecture, or by Provides are map
+lookups. It's safe to query from many goroutines while more indices are
+being added.
+*/
+package index // import "pault.ag/go/debian/index"
@@ -0,0 +1,149 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package index // import "pault.ag/go/debian/index"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Candidate {{{
+
+// A Candidate is a single binary package, along with where it came from.
+type Candidate struct {
+	control.BinaryIndex
+
+	// Name of the index this Candidate was Added from, such as "bookworm".
+	Origin string
+
+	// APT-style pin priority of the index this Candidate was Added from.
+	// Higher priorities are preferred over higher versions.
+	Priority int
+}
+
+// }}}
+
+// Index {{{
+
+// An Index is a set of binary packages, merged from any number of indices.
+type Index struct {
+	candidates map[string][]Candidate
+}
+
+// Create a new, empty Index.
+func New() *Index {
+	return &Index{candidates: map[string][]Candidate{}}
+}
+
+// Add every package in a Packages index to the Index, recording the
+// name of the index and its priority on each Candidate.
+func (i *Index) Add(origin string, priority int, packages []control.BinaryIndex) {
+	for _, pkg := range packages {
+		i.candidates[pkg.Package] = append(i.candidates[pkg.Package], Candidate{
+			BinaryIndex: pkg,
+			Origin:      origin,
+			Priority:    priority,
+		})
+	}
+}
+
+// Parse a version constraint, as it'd be written in the parenthesis of a
+// Depends field, such as ">= 3.0".
+func parseConstraint(constraint string) (*dependency.VersionRelation, error) {
+	constraint = strings.TrimSpace(constraint)
+	if constraint == "" {
+		return nil, nil
+	}
+	for _, operator := range []string{">=", "<=", ">>", "<<", "="} {
+		if strings.HasPrefix(constraint, operator) {
+			number := strings.TrimSpace(strings.TrimPrefix(constraint, operator))
+			if number == "" {
+				break
+			}
+			return &dependency.VersionRelation{Operator: operator, Number: number}, nil
+		}
+	}
+	return nil, fmt.Errorf("Malformed version constraint: '%s'", constraint)
+}
+
+// Return every Candidate with the given name whose version matches the
+// constraint (such as ">= 3.0", or "" to match any version), and that is
+// installable on one of the given architectures (Architecture: all packages
+// always are). If no architectures are given, every architecture matches.
+//
+// Candidates are sorted best first: highest Priority, then highest version,
+// then by Origin.
+func (i *Index) Find(name, constraint string, archs ...dependency.Arch) ([]Candidate, error) {
+	relation, err := parseConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []Candidate{}
+	for _, candidate := range i.candidates[name] {
+		if relation != nil && !relation.SatisfiedBy(candidate.Version) {
+			continue
+		}
+		if !installableOn(candidate.Architecture, archs) {
+			continue
+		}
+		ret = append(ret, candidate)
+	}
+	sortCandidates(ret)
+	return ret, nil
+}
+
+func installableOn(arch dependency.Arch, archs []dependency.Arch) bool {
+	if len(archs) == 0 || arch.CPU == "all" {
+		return true
+	}
+	for _, el := range archs {
+		if arch.Is(&el) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sort Candidates the way APT would choose between them: highest
+// Priority, then highest version. Ties are broken by Origin, so the order
+// is stable across runs.
+func sortCandidates(candidates []Candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if cmp := version.Compare(a.Version, b.Version); cmp != 0 {
+			return cmp > 0
+		}
+		return a.Origin < b.Origin
+	})
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,124 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package index_test
+
+import (
+	"bufio"
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/index"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+func parse(t *testing.T, data string) []control.BinaryIndex {
+	ret, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(data)))
+	isok(t, err)
+	return ret
+}
+
+/*
+ *
+ */
+
+func TestFind(t *testing.T) {
+	idx := index.New()
+	idx.Add("bookworm", 500, parse(t, `Package: libssl-dev
+Version: 3.0.11-1~deb12u2
+Architecture: amd64
+
+Package: libssl-dev
+Version: 3.0.11-1~deb12u2
+Architecture: arm64
+
+Package: libssl-doc
+Version: 3.0.11-1~deb12u2
+Architecture: all
+`))
+	idx.Add("bookworm-backports", 100, parse(t, `Package: libssl-dev
+Version: 3.1.4-1~bpo12+1
+Architecture: amd64
+`))
+	idx.Add("bullseye", 500, parse(t, `Package: libssl-dev
+Version: 1.1.1w-0+deb11u1
+Architecture: amd64
+`))
+
+	amd64 := dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"}
+	candidates, err := idx.Find("libssl-dev", ">= 3.0", amd64)
+	isok(t, err)
+	assert(t, len(candidates) == 2)
+	assert(t, candidates[0].Origin == "bookworm")
+	assert(t, candidates[1].Version.String() == "3.1.4-1~bpo12+1")
+
+	candidates, err = idx.Find("libssl-dev", "")
+	isok(t, err)
+	assert(t, len(candidates) == 4)
+	assert(t, candidates[2].Origin == "bullseye")
+
+	candidates, err = idx.Find("libssl-dev", "<< 2")
+	isok(t, err)
+	assert(t, len(candidates) == 1)
+
+	arm64, err := dependency.ParseArch("arm64")
+	isok(t, err)
+	candidates, err = idx.Find("libssl-doc", "", *arm64)
+	isok(t, err)
+	assert(t, len(candidates) == 1)
+
+	candidates, err = idx.Find("missing", "")
+	isok(t, err)
+	assert(t, len(candidates) == 0)
+
+	_, err = idx.Find("libssl-dev", "~= 3")
+	notok(t, err)
+	_, err = idx.Find("libssl-dev", ">=")
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,260 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package index // import "pault.ag/go/debian/index"
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+// Interning {{{
+
+// An Interner hands back one shared copy of each distinct string it's
+// given, so that values repeated across thousands of paragraphs (such as
+// "Section: libs", or a Maintainer) are only held in memory once. It's
+// safe for concurrent use.
+type Interner struct {
+	lock    sync.Mutex
+	strings map[string]string
+}
+
+func NewInterner() *Interner {
+	return &Interner{strings: map[string]string{}}
+}
+
+// Return the shared copy of value.
+func (i *Interner) Intern(value string) string {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if shared, ok := i.strings[value]; ok {
+		return shared
+	}
+	/* Copy, so we don't keep whatever buffer value is a slice of alive */
+	shared := strings.Clone(value)
+	i.strings[shared] = shared
+	return shared
+}
+
+// Return how many distinct strings have been interned.
+func (i *Interner) Len() int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return len(i.strings)
+}
+
+// }}}
+
+// Packages {{{
+
+// Fields that are (more or less) unique to each package, so aren't worth
+// interning.
+var uniqueFields = map[string]bool{
+	"Filename":        true,
+	"Size":            true,
+	"MD5sum":          true,
+	"SHA1":            true,
+	"SHA256":          true,
+	"SHA512":          true,
+	"Description":     true,
+	"Description-md5": true,
+	"Installed-Size":  true,
+}
+
+// A packed paragraph: the field names (shared between every paragraph
+// with the same fields in the same order), and the values.
+type packed struct {
+	keys   []string
+	values []string
+}
+
+// Packages holds a full Packages index (or several) in memory, as
+// compactly as it can: repeated values are interned, paragraphs with the
+// same fields share one list of field names, and the raw text parsing
+// kept around is dropped. Entries are only decoded into a
+// control.BinaryIndex when they're looked up.
+//
+// Packages is safe for concurrent use; any number of lookups can run at
+// once, alongside Adds.
+type Packages struct {
+	lock     sync.RWMutex
+	interner *Interner
+	layouts  map[string][]string
+
+	entries    []packed
+	byName     map[string][]int
+	byNameArch map[string][]int
+	byProvides map[string][]int
+}
+
+// Create an empty Packages.
+func NewPackages() *Packages {
+	return &Packages{
+		interner:   NewInterner(),
+		layouts:    map[string][]string{},
+		byName:     map[string][]int{},
+		byNameArch: map[string][]int{},
+		byProvides: map[string][]int{},
+	}
+}
+
+func nameArchKey(name, arch string) string {
+	return name + ":" + arch
+}
+
+// Add a single paragraph of a Packages index.
+func (p *Packages) Add(para control.Paragraph) error {
+	name := para.Values["Package"]
+	if name == "" {
+		return fmt.Errorf("Paragraph has no Package field")
+	}
+	provides := []string{}
+	if value := strings.TrimSpace(para.Values["Provides"]); value != "" {
+		dep, err := dependency.Parse(value)
+		if err != nil {
+			return fmt.Errorf("%s: Provides: %s", name, err)
+		}
+		for _, possi := range dep.GetAllPossibilities() {
+			provides = append(provides, possi.Name)
+		}
+	}
+
+	entry := packed{values: make([]string, len(para.Order))}
+	for i, key := range para.Order {
+		value := para.Values[key]
+		if !uniqueFields[key] {
+			value = p.interner.Intern(value)
+		}
+		entry.values[i] = value
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	layout := strings.Join(para.Order, "\n")
+	keys, ok := p.layouts[layout]
+	if !ok {
+		keys = make([]string, len(para.Order))
+		for i, key := range para.Order {
+			keys[i] = p.interner.Intern(key)
+		}
+		p.layouts[layout] = keys
+	}
+	entry.keys = keys
+
+	id := len(p.entries)
+	p.entries = append(p.entries, entry)
+	name = p.interner.Intern(name)
+	p.byName[name] = append(p.byName[name], id)
+	arch := strings.TrimSpace(para.Values["Architecture"])
+	p.byNameArch[nameArchKey(name, arch)] = append(p.byNameArch[nameArchKey(name, arch)], id)
+	for _, provided := range provides {
+		p.byProvides[provided] = append(p.byProvides[provided], id)
+	}
+	return nil
+}
+
+// Add every paragraph of a Packages index, read from reader.
+func (p *Packages) AddIndex(reader io.Reader) error {
+	paragraphs, err := control.NewParagraphReader(reader)
+	if err != nil {
+		return err
+	}
+	for {
+		para, err := paragraphs.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := p.Add(*para); err != nil {
+			return err
+		}
+	}
+}
+
+// Return how many paragraphs have been added.
+func (p *Packages) Len() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return len(p.entries)
+}
+
+// Return the Paragraph of an entry. The caller must hold the lock.
+func (p *Packages) paragraph(id int) control.Paragraph {
+	entry := p.entries[id]
+	para := control.Paragraph{Order: entry.keys, Values: make(map[string]string, len(entry.keys))}
+	for i, key := range entry.keys {
+		para.Values[key] = entry.values[i]
+	}
+	return para
+}
+
+// Decode the entries with the given ids.
+func (p *Packages) decode(ids []int) ([]control.BinaryIndex, error) {
+	paragraphs := make([]control.Paragraph, len(ids))
+	p.lock.RLock()
+	for i, id := range ids {
+		paragraphs[i] = p.paragraph(id)
+	}
+	p.lock.RUnlock()
+
+	ret := make([]control.BinaryIndex, len(paragraphs))
+	for i, para := range paragraphs {
+		/* Order is shared, so hand the decoder its own copy */
+		para.Order = append([]string{}, para.Order...)
+		if err := control.UnpackFromParagraph(para, &ret[i]); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func (p *Packages) lookup(table map[string][]int, key string) []int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return append([]int{}, table[key]...)
+}
+
+// Return every entry for the named package, in the order they were added.
+func (p *Packages) Lookup(name string) ([]control.BinaryIndex, error) {
+	return p.decode(p.lookup(p.byName, name))
+}
+
+// Return every entry for the named package built for the given
+// architecture, such as ("libc6", amd64). This is an exact match on the
+// Architecture field, so Architecture: all packages are found with "all".
+func (p *Packages) LookupArch(name string, arch dependency.Arch) ([]control.BinaryIndex, error) {
+	return p.decode(p.lookup(p.byNameArch, nameArchKey(name, arch.String())))
+}
+
+// Return every entry that Provides the named (virtual) package.
+func (p *Packages) Providers(name string) ([]control.BinaryIndex, error) {
+	return p.decode(p.lookup(p.byProvides, name))
+}
+
+// }}}
+
+// vim: foldmethod=marker
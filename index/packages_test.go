@@ -0,0 +1,189 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package index_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/index"
+)
+
+/*
+ *
+ */
+
+// {{{ packages fixture
+var packagesFixture = `Package: libc6
+Version: 2.36-9
+Architecture: amd64
+Section: libs
+Priority: optional
+Maintainer: GNU Libc Maintainers <debian-glibc@lists.debian.org>
+Filename: pool/main/g/glibc/libc6_2.36-9_amd64.deb
+Size: 2757936
+
+Package: libc6
+Version: 2.36-9
+Architecture: arm64
+Section: libs
+Priority: optional
+Maintainer: GNU Libc Maintainers <debian-glibc@lists.debian.org>
+Filename: pool/main/g/glibc/libc6_2.36-9_arm64.deb
+Size: 2322128
+
+Package: exim4-daemon-light
+Version: 4.96-15
+Architecture: amd64
+Section: mail
+Priority: optional
+Maintainer: Exim4 Maintainers <pkg-exim4-maintainers@lists.alioth.debian.org>
+Provides: mail-transport-agent
+Filename: pool/main/e/exim4/exim4-daemon-light_4.96-15_amd64.deb
+Size: 579412
+
+Package: postfix
+Version: 3.7.6-0+deb12u2
+Architecture: amd64
+Section: mail
+Priority: optional
+Maintainer: LaMont Jones <lamont@debian.org>
+Provides: default-mta, mail-transport-agent
+Filename: pool/main/p/postfix/postfix_3.7.6-0+deb12u2_amd64.deb
+Size: 1544336
+`
+
+// }}}
+
+func arch(t *testing.T, name string) *dependency.Arch {
+	ret, err := dependency.ParseArch(name)
+	isok(t, err)
+	return ret
+}
+
+func loadPackages(t *testing.T) *index.Packages {
+	packages := index.NewPackages()
+	isok(t, packages.AddIndex(strings.NewReader(packagesFixture)))
+	return packages
+}
+
+func TestPackagesLookup(t *testing.T) {
+	packages := loadPackages(t)
+	assert(t, packages.Len() == 4)
+
+	entries, err := packages.Lookup("libc6")
+	isok(t, err)
+	assert(t, len(entries) == 2)
+	assert(t, entries[0].Architecture.CPU == "amd64")
+	assert(t, entries[1].Architecture.CPU == "arm64")
+	assert(t, entries[1].Size == 2322128)
+	assert(t, entries[1].Version.String() == "2.36-9")
+
+	entries, err = packages.LookupArch("libc6", *arch(t, "arm64"))
+	isok(t, err)
+	assert(t, len(entries) == 1)
+	assert(t, entries[0].Filename == "pool/main/g/glibc/libc6_2.36-9_arm64.deb")
+
+	entries, err = packages.LookupArch("libc6", *arch(t, "armhf"))
+	isok(t, err)
+	assert(t, len(entries) == 0)
+
+	entries, err = packages.Lookup("no-such-package")
+	isok(t, err)
+	assert(t, len(entries) == 0)
+}
+
+func TestPackagesProviders(t *testing.T) {
+	packages := loadPackages(t)
+
+	entries, err := packages.Providers("mail-transport-agent")
+	isok(t, err)
+	assert(t, len(entries) == 2)
+	assert(t, entries[0].Package == "exim4-daemon-light")
+	assert(t, entries[1].Package == "postfix")
+
+	entries, err = packages.Providers("default-mta")
+	isok(t, err)
+	assert(t, len(entries) == 1)
+}
+
+func TestPackagesParagraphOrder(t *testing.T) {
+	packages := loadPackages(t)
+	entries, err := packages.Lookup("postfix")
+	isok(t, err)
+	assert(t, len(entries) == 1)
+	assert(t, entries[0].Order[0] == "Package")
+	assert(t, entries[0].Order[len(entries[0].Order)-1] == "Size")
+
+	/* Mangling what we were given mustn't reach other entries */
+	entries[0].Order[0] = "Mangled"
+	entries, err = packages.Lookup("libc6")
+	isok(t, err)
+	assert(t, entries[0].Order[0] == "Package")
+}
+
+func TestPackagesAddInvalid(t *testing.T) {
+	packages := index.NewPackages()
+	notok(t, packages.Add(control.Paragraph{
+		Order:  []string{"Version"},
+		Values: map[string]string{"Version": "1.0"},
+	}))
+	assert(t, packages.Len() == 0)
+}
+
+func TestPackagesConcurrent(t *testing.T) {
+	packages := loadPackages(t)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				entries, err := packages.Lookup("libc6")
+				if err != nil || len(entries) < 2 {
+					t.Error("Lookup failed while adding")
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := packages.AddIndex(strings.NewReader(packagesFixture)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert(t, packages.Len() == 4*9)
+}
+
+func TestInterner(t *testing.T) {
+	interner := index.NewInterner()
+	one := interner.Intern(strings.Repeat("x", 3))
+	two := interner.Intern("xxx")
+	assert(t, one == two)
+	assert(t, interner.Len() == 1)
+}
+
+// vim: foldmethod=marker
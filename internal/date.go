@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Zone names found in the wild, beyond the numeric offsets RFC 2822 asks
+// for. RFC 822 only defined the North American ones (and "Z", "UT" and
+// "GMT"); the rest turn up in old changelogs and Release files anyway.
+var zoneOffsets = map[string]int{
+	"UT": 0, "UTC": 0, "GMT": 0, "Z": 0, "WET": 0,
+	"EST": -5, "EDT": -4, "CST": -6, "CDT": -5,
+	"MST": -7, "MDT": -6, "PST": -8, "PDT": -7,
+	"BST": 1, "IST": 1, "WEST": 1, "CET": 1, "MET": 1,
+	"CEST": 2, "MEST": 2, "EET": 2, "EEST": 3, "MSK": 3,
+	"JST": 9, "KST": 9, "AEST": 10, "AEDT": 11, "NZST": 12, "NZDT": 13,
+}
+
+var monthNames = map[string]time.Month{}
+
+func init() {
+	for month := time.January; month <= time.December; month++ {
+		monthNames[strings.ToLower(month.String())] = month
+		monthNames[strings.ToLower(month.String()[:3])] = month
+	}
+	monthNames["sept"] = time.September
+}
+
+// Parse an RFC 2822 style date; see control.ParseDate, which this is
+// behind, so that changelog can parse dates without importing control.
+func ParseDate(value string) (time.Time, error) {
+	fail := func() (time.Time, error) {
+		return time.Time{}, fmt.Errorf("Unable to parse date '%s'", value)
+	}
+
+	text := value
+	if i := strings.Index(text, "("); i >= 0 {
+		text = text[:i]
+	}
+	if i := strings.Index(text, ","); i >= 0 {
+		text = text[i+1:]
+	}
+	fields := strings.Fields(text)
+	if len(fields) > 0 && !isDigits(fields[0]) {
+		/* A day of the week with no comma after it */
+		fields = fields[1:]
+	}
+	if len(fields) != 4 && len(fields) != 5 {
+		return fail()
+	}
+
+	day, err := strconv.Atoi(fields[0])
+	if err != nil || day < 1 || day > 31 {
+		return fail()
+	}
+	month, ok := monthNames[strings.ToLower(strings.TrimSuffix(fields[1], "."))]
+	if !ok {
+		return fail()
+	}
+	year, err := strconv.Atoi(fields[2])
+	if err != nil || !isDigits(fields[2]) {
+		return fail()
+	}
+	switch len(fields[2]) {
+	case 2:
+		if year < 50 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+	case 3:
+		year += 1900
+	case 4:
+	default:
+		return fail()
+	}
+
+	clock := strings.Split(fields[3], ":")
+	if len(clock) != 2 && len(clock) != 3 {
+		return fail()
+	}
+	hms := []int{0, 0, 0}
+	for i, part := range clock {
+		if hms[i], err = strconv.Atoi(part); err != nil || !isDigits(part) {
+			return fail()
+		}
+	}
+	if hms[0] > 23 || hms[1] > 59 || hms[2] > 60 {
+		return fail()
+	}
+
+	zone := time.UTC
+	if len(fields) == 5 {
+		if zone, ok = parseZone(fields[4]); !ok {
+			return fail()
+		}
+	}
+
+	when := time.Date(year, month, day, hms[0], hms[1], hms[2], 0, zone)
+	if when.Day() != day {
+		/* Such as the 31st of February */
+		return fail()
+	}
+	return when, nil
+}
+
+// Return the Location of a zone given as "+hhmm", "+hh:mm" or a name.
+// Numeric offsets get a Location with no name, so they're written back out
+// the same way; names for UTC (and unknown names) get time.UTC.
+func parseZone(zone string) (*time.Location, bool) {
+	if strings.HasPrefix(zone, "+") || strings.HasPrefix(zone, "-") {
+		digits := strings.Replace(zone[1:], ":", "", 1)
+		if len(digits) != 4 || !isDigits(digits) {
+			return nil, false
+		}
+		hours, _ := strconv.Atoi(digits[:2])
+		minutes, _ := strconv.Atoi(digits[2:])
+		if minutes > 59 {
+			return nil, false
+		}
+		offset := hours*3600 + minutes*60
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		return time.FixedZone("", offset), true
+	}
+	for _, r := range zone {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return nil, false
+		}
+	}
+	name := strings.ToUpper(zone)
+	if hours, ok := zoneOffsets[name]; ok && hours != 0 {
+		return time.FixedZone(name, hours*3600), true
+	}
+	return time.UTC, true
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
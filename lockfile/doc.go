@@ -0,0 +1,20 @@
+/*
+Pin a resolved set of packages down to the exact bytes, so the same set
+can be fetched again later (or elsewhere), and anything that changed in
+the meantime is caught rather than silently installed.
+
+A Lockfile is a deb822 file with one paragraph per package, naming the
+package, version and architecture, the SHA256 and size of its .deb, and
+the mirror, suite and component it came from.
+
+	Package: hello
+	Version: 2.10-3
+	Architecture: amd64
+	Filename: pool/main/h/hello/hello_2.10-3_amd64.deb
+	Size: 56000
+	SHA256: 5a2f...
+	Mirror: https://deb.debian.org/debian
+	Suite: bookworm
+	Component: main
+*/
+package lockfile // import "pault.ag/go/debian/lockfile"
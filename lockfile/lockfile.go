@@ -0,0 +1,232 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package lockfile // import "pault.ag/go/debian/lockfile"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/repo"
+	"pault.ag/go/debian/version"
+)
+
+// Entry {{{
+
+// An Entry pins a single package.
+type Entry struct {
+	control.Paragraph
+
+	Package      string          `required:"true"`
+	Version      version.Version `required:"true"`
+	Architecture dependency.Arch `required:"true"`
+	Filename     string          `required:"true"`
+	Size         int
+	SHA256       string `required:"true"`
+
+	// Where the package was found.
+	Mirror    string
+	Suite     string
+	Component string
+}
+
+// Pin a package, as found in the Packages index of the given component
+// of the client's suite.
+func EntryFor(client *repo.Client, component string, pkg control.BinaryIndex) Entry {
+	return Entry{
+		Package:      pkg.Package,
+		Version:      pkg.Version,
+		Architecture: pkg.Architecture,
+		Filename:     pkg.Filename,
+		Size:         pkg.Size,
+		SHA256:       pkg.SHA256,
+		Mirror:       client.Mirror,
+		Suite:        client.Suite,
+		Component:    component,
+	}
+}
+
+// The FileHash the .deb has to match.
+func (e Entry) FileHash() control.FileHash {
+	return control.FileHash{
+		Algorithm: "sha256",
+		Hash:      e.SHA256,
+		Size:      int64(e.Size),
+		Filename:  e.Filename,
+	}
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("%s:%s (%s)", e.Package, e.Architecture.String(), e.Version)
+}
+
+// }}}
+
+// Lockfile {{{
+
+// A Lockfile is the full set of pinned packages.
+type Lockfile struct {
+	Entries []Entry
+}
+
+// Add an Entry, replacing any Entry for the same package and architecture.
+func (l *Lockfile) Add(entry Entry) {
+	for i, existing := range l.Entries {
+		if existing.Package == entry.Package && existing.Architecture == entry.Architecture {
+			l.Entries[i] = entry
+			return
+		}
+	}
+	l.Entries = append(l.Entries, entry)
+}
+
+// Parse a Lockfile from a reader.
+func Parse(reader io.Reader) (*Lockfile, error) {
+	ret := Lockfile{}
+	if err := control.Unmarshal(&ret.Entries, bufio.NewReader(reader)); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Parse a Lockfile off the disk.
+func ParseFile(path string) (*Lockfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Write the Lockfile out, sorted by package and architecture, so the same
+// set of packages always makes the same file.
+func (l *Lockfile) Write(out io.Writer) error {
+	entries := append([]Entry{}, l.Entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Package != entries[j].Package {
+			return entries[i].Package < entries[j].Package
+		}
+		return entries[i].Architecture.String() < entries[j].Architecture.String()
+	})
+	return control.Marshal(out, entries)
+}
+
+// }}}
+
+// Verification {{{
+
+// A Mismatch is an Entry that the packages on offer no longer match.
+type Mismatch struct {
+	Entry Entry
+	// The package with the same name, version and architecture, if any.
+	Found *control.BinaryIndex
+}
+
+func (m Mismatch) String() string {
+	if m.Found == nil {
+		return fmt.Sprintf("%s is no longer available", m.Entry)
+	}
+	return fmt.Sprintf("%s has changed: SHA256 %s, was %s", m.Entry, m.Found.SHA256, m.Entry.SHA256)
+}
+
+// Check the Lockfile against the packages available (as read from a
+// Packages index), returning every Entry that's missing, or whose .deb
+// isn't the one that was pinned.
+func (l *Lockfile) Check(available []control.BinaryIndex) []Mismatch {
+	ret := []Mismatch{}
+	for _, entry := range l.Entries {
+		var found *control.BinaryIndex
+		for i, pkg := range available {
+			if pkg.Package == entry.Package && pkg.Architecture == entry.Architecture &&
+				version.Compare(pkg.Version, entry.Version) == 0 {
+				found = &available[i]
+				break
+			}
+		}
+		if found == nil || found.SHA256 != entry.SHA256 || found.Size != entry.Size {
+			ret = append(ret, Mismatch{Entry: entry, Found: found})
+		}
+	}
+	return ret
+}
+
+// Fetch every Entry for arch (and Architecture: all) from client's suite
+// into the directory dest, checking each against the Packages index first,
+// and then the downloaded .deb against the pinned SHA256. Nothing is
+// downloaded unless every Entry checks out. Entries from other mirrors or
+// suites are skipped.
+func (l *Lockfile) Restore(client *repo.Client, arch dependency.Arch, dest string) error {
+	entries := map[string][]Entry{}
+	for _, entry := range l.Entries {
+		if entry.Mirror != client.Mirror || entry.Suite != client.Suite {
+			continue
+		}
+		if entry.Architecture != arch && entry.Architecture.CPU != "all" {
+			continue
+		}
+		entries[entry.Component] = append(entries[entry.Component], entry)
+	}
+
+	components := []string{}
+	for component := range entries {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+
+	for _, component := range components {
+		available := []control.BinaryIndex{}
+		if err := client.Packages(component, arch, func(pkg *control.BinaryIndex) error {
+			available = append(available, *pkg)
+			return nil
+		}); err != nil {
+			return err
+		}
+		subset := Lockfile{Entries: entries[component]}
+		switch mismatches := subset.Check(available); len(mismatches) {
+		case 0:
+		case 1:
+			return fmt.Errorf("%s", mismatches[0])
+		default:
+			return fmt.Errorf("%s (and %d more)", mismatches[0], len(mismatches)-1)
+		}
+	}
+
+	for _, component := range components {
+		for _, entry := range entries[component] {
+			target := filepath.Join(dest, path.Base(entry.Filename))
+			if err := client.Download(entry.Filename, entry.FileHash(), target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,159 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package lockfile_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/lockfile"
+	"pault.ag/go/debian/repo"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+var amd64 = dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"}
+
+// Serve a mirror with the suite "test", holding the given .debs (by
+// filename) in main/binary-amd64. Each file's contents are its name, with
+// a "v" prefix.
+func newMirror(t *testing.T, debs map[string]string) *httptest.Server {
+	packages := bytes.Buffer{}
+	for _, name := range []string{"hello", "cowsay"} {
+		ver, ok := debs[name]
+		if !ok {
+			continue
+		}
+		arch := "amd64"
+		if name == "cowsay" {
+			arch = "all"
+		}
+		filename := fmt.Sprintf("pool/main/%s_%s_%s.deb", name, ver, arch)
+		data := "v" + filename
+		fmt.Fprintf(&packages, "Package: %s\nVersion: %s\nArchitecture: %s\nFilename: %s\nSize: %d\nSHA256: %x\n\n",
+			name, ver, arch, filename, len(data), sha256.Sum256([]byte(data)))
+	}
+	release := fmt.Sprintf("Suite: test\nSHA256:\n %x %d main/binary-amd64/Packages\n",
+		sha256.Sum256(packages.Bytes()), packages.Len())
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/dists/test/InRelease":
+			w.Write([]byte(release))
+		case r.URL.Path == "/dists/test/main/binary-amd64/Packages":
+			w.Write(packages.Bytes())
+		case strings.HasPrefix(r.URL.Path, "/pool/"):
+			w.Write([]byte("v" + r.URL.Path[1:]))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestLockfile(t *testing.T) {
+	server := newMirror(t, map[string]string{"hello": "2.10-3", "cowsay": "3.03-8"})
+	defer server.Close()
+	client, err := repo.New(server.URL, "test", nil)
+	isok(t, err)
+
+	lock := lockfile.Lockfile{}
+	isok(t, client.Packages("main", amd64, func(pkg *control.BinaryIndex) error {
+		lock.Add(lockfile.EntryFor(client, "main", *pkg))
+		return nil
+	}))
+	assert(t, len(lock.Entries) == 2)
+
+	/* Through the file format and back; the output is sorted */
+	out := bytes.Buffer{}
+	isok(t, lock.Write(&out))
+	assert(t, strings.HasPrefix(out.String(), "Package: cowsay\n"))
+	parsed, err := lockfile.Parse(&out)
+	isok(t, err)
+	assert(t, len(parsed.Entries) == 2)
+	assert(t, parsed.Entries[1].Version.String() == "2.10-3")
+	assert(t, parsed.Entries[1].Mirror == server.URL)
+
+	dest := t.TempDir()
+	isok(t, parsed.Restore(client, amd64, dest))
+	data, err := os.ReadFile(filepath.Join(dest, "hello_2.10-3_amd64.deb"))
+	isok(t, err)
+	assert(t, string(data) == "vpool/main/hello_2.10-3_amd64.deb")
+
+	/* The mirror moved on; the pinned hello is gone */
+	moved := newMirror(t, map[string]string{"hello": "2.10-4", "cowsay": "3.03-8"})
+	defer moved.Close()
+	client, err = repo.New(moved.URL, "test", nil)
+	isok(t, err)
+	for i := range parsed.Entries {
+		parsed.Entries[i].Mirror = moved.URL
+	}
+	err = parsed.Restore(client, amd64, t.TempDir())
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "hello:amd64 (2.10-3) is no longer available"))
+
+	/* Or the .deb changed under the same version */
+	parsed.Entries[1].Version.Revision = "4"
+	parsed.Entries[1].SHA256 = strings.Repeat("0", 64)
+	mismatches := parsed.Check([]control.BinaryIndex{{
+		Package: "hello", Version: parsed.Entries[1].Version, Architecture: amd64, SHA256: "abc",
+	}})
+	assert(t, len(mismatches) == 2)
+	assert(t, mismatches[1].Found != nil)
+}
+
+// vim: foldmethod=marker
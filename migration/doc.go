@@ -0,0 +1,8 @@
+/*
+Work out which source packages are ready to migrate from one suite to
+another (such as unstable to testing), and why the rest aren't, in the
+style of britney's excuses. Anything that britney gets from outside the
+archive (how long a source has been in unstable, RC bugs, autopkgtest
+results) is supplied by the caller.
+*/
+package migration // import "pault.ag/go/debian/migration"
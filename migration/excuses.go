@@ -0,0 +1,332 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package migration // import "pault.ag/go/debian/migration"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Suite {{{
+
+// A Suite is the Sources index, and the Packages index for each
+// architecture, of a suite such as unstable or testing. Architecture: all
+// packages are expected to be in every architecture's index, as they are
+// on a mirror.
+type Suite struct {
+	Sources  []control.SourceIndex
+	Binaries map[string][]control.BinaryIndex
+}
+
+// Return the newest version of each source in the Suite.
+func (s Suite) sources() map[string]control.SourceIndex {
+	ret := map[string]control.SourceIndex{}
+	for _, source := range s.Sources {
+		if current, ok := ret[source.Package]; ok && version.Compare(current.Version, source.Version) >= 0 {
+			continue
+		}
+		ret[source.Package] = source
+	}
+	return ret
+}
+
+// }}}
+
+// Inputs from outside the archive {{{
+
+// The result of running a source's autopkgtests (and those of its reverse
+// dependencies) against the candidate.
+type TestResult int
+
+const (
+	NoTests TestResult = iota
+	Pass
+	Neutral
+	Running
+	Regression
+)
+
+// Days a source needs to have been in unstable before it can migrate, by
+// the urgency of the upload. These are britney's defaults.
+var DefaultMinAge = map[string]int{
+	"low":       10,
+	"medium":    5,
+	"high":      2,
+	"critical":  0,
+	"emergency": 0,
+}
+
+// }}}
+
+// Excuse {{{
+
+// An Excuse says whether a source can migrate, and if not, why not.
+type Excuse struct {
+	Source     string
+	OldVersion *version.Version
+	NewVersion version.Version
+
+	Age    int
+	MinAge int
+
+	// Everything stopping this source from migrating; if there's nothing
+	// here, it's a valid candidate.
+	Reasons []string
+}
+
+// Return true if nothing is blocking the source from migrating.
+func (e Excuse) Valid() bool {
+	return len(e.Reasons) == 0
+}
+
+func (e Excuse) String() string {
+	old := "-"
+	if e.OldVersion != nil {
+		old = e.OldVersion.String()
+	}
+	if e.Valid() {
+		return fmt.Sprintf("%s (%s to %s): valid candidate", e.Source, old, e.NewVersion)
+	}
+	return fmt.Sprintf("%s (%s to %s): %s", e.Source, old, e.NewVersion, strings.Join(e.Reasons, "; "))
+}
+
+func (e *Excuse) block(format string, args ...interface{}) {
+	e.Reasons = append(e.Reasons, fmt.Sprintf(format, args...))
+}
+
+// }}}
+
+// Evaluator {{{
+
+// An Evaluator computes the Excuses for every source that's newer in
+// Unstable than in Testing.
+type Evaluator struct {
+	Unstable Suite
+	Testing  Suite
+
+	// How many days each source (at its version in Unstable) has been
+	// there, and the urgency it was uploaded with ("medium" if unset).
+	Age     map[string]int
+	Urgency map[string]string
+	// Days needed to migrate, by urgency. DefaultMinAge if nil.
+	MinAge map[string]int
+
+	// RC bug numbers affecting each source in each suite; a source may not
+	// migrate if it has any that the version in Testing doesn't.
+	UnstableBugs map[string][]string
+	TestingBugs  map[string][]string
+
+	// Autopkgtest results for each source's candidate version.
+	Autopkgtest map[string]TestResult
+}
+
+// Return an Excuse for every source that's newer in Unstable than in
+// Testing (or not in Testing at all), sorted by name.
+func (e *Evaluator) Evaluate() []Excuse {
+	testing := e.Testing.sources()
+	unstable := e.Unstable.sources()
+
+	names := []string{}
+	for name := range unstable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	excuses := []Excuse{}
+	for _, name := range names {
+		source := unstable[name]
+		excuse := Excuse{Source: name, NewVersion: source.Version}
+		if old, ok := testing[name]; ok {
+			if version.Compare(old.Version, source.Version) >= 0 {
+				continue
+			}
+			excuse.OldVersion = &old.Version
+		}
+
+		e.checkAge(&excuse)
+		e.checkBugs(&excuse)
+		e.checkAutopkgtest(&excuse)
+		e.checkBuilds(&excuse, source)
+		e.checkInstallability(&excuse)
+
+		excuses = append(excuses, excuse)
+	}
+	return excuses
+}
+
+func (e *Evaluator) checkAge(excuse *Excuse) {
+	urgency := e.Urgency[excuse.Source]
+	if urgency == "" {
+		urgency = "medium"
+	}
+	minAge := e.MinAge
+	if minAge == nil {
+		minAge = DefaultMinAge
+	}
+	excuse.Age = e.Age[excuse.Source]
+	excuse.MinAge = minAge[urgency]
+	if excuse.Age < excuse.MinAge {
+		excuse.block("too young: %d of %d days (urgency %s)", excuse.Age, excuse.MinAge, urgency)
+	}
+}
+
+func (e *Evaluator) checkBugs(excuse *Excuse) {
+	old := map[string]bool{}
+	for _, bug := range e.TestingBugs[excuse.Source] {
+		old[bug] = true
+	}
+	bugs := []string{}
+	for _, bug := range e.UnstableBugs[excuse.Source] {
+		if !old[bug] {
+			bugs = append(bugs, "#"+bug)
+		}
+	}
+	if len(bugs) > 0 {
+		excuse.block("introduces RC bugs: %s", strings.Join(bugs, ", "))
+	}
+}
+
+func (e *Evaluator) checkAutopkgtest(excuse *Excuse) {
+	switch e.Autopkgtest[excuse.Source] {
+	case Running:
+		excuse.block("autopkgtests still running")
+	case Regression:
+		excuse.block("autopkgtest regression")
+	}
+}
+
+// Sorted list of the architectures in a Suite.
+func (s Suite) architectures() []string {
+	ret := []string{}
+	for arch := range s.Binaries {
+		ret = append(ret, arch)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Return true if the source builds architecture dependent packages on arch.
+func buildsOn(source control.SourceIndex, arch string) bool {
+	target, err := dependency.ParseArch(arch)
+	if err != nil {
+		return false
+	}
+	for _, el := range source.Architecture {
+		if el.CPU != "all" && target.Is(&el) {
+			return true
+		}
+	}
+	return false
+}
+
+// Every binary must have been built from the new version, on every
+// architecture the source is meant to build on.
+func (e *Evaluator) checkBuilds(excuse *Excuse, source control.SourceIndex) {
+	for _, arch := range e.Unstable.architectures() {
+		built := false
+		outdated := []string{}
+		for _, pkg := range e.Unstable.Binaries[arch] {
+			if pkg.SourcePackage() != excuse.Source || pkg.Architecture.CPU == "all" {
+				continue
+			}
+			if version.Compare(pkg.SourceVersion(), excuse.NewVersion) < 0 {
+				outdated = append(outdated, pkg.Package)
+			} else {
+				built = true
+			}
+		}
+		if len(outdated) > 0 {
+			sort.Strings(outdated)
+			excuse.block("out of date on %s: %s", arch, strings.Join(outdated, ", "))
+		} else if !built && buildsOn(source, arch) {
+			excuse.block("missing build on %s", arch)
+		}
+	}
+}
+
+// Binaries in Testing on arch once the source has migrated: the source's
+// old binaries are swapped out for its new ones.
+func (e *Evaluator) migrated(source, arch string) (after []control.BinaryIndex, added []control.BinaryIndex) {
+	for _, pkg := range e.Testing.Binaries[arch] {
+		if pkg.SourcePackage() != source {
+			after = append(after, pkg)
+		}
+	}
+	for _, pkg := range e.Unstable.Binaries[arch] {
+		if pkg.SourcePackage() == source {
+			after = append(after, pkg)
+			added = append(added, pkg)
+		}
+	}
+	return after, added
+}
+
+func packageIndex(packages []control.BinaryIndex) *dependency.PackageIndex {
+	index := dependency.NewPackageIndex()
+	for _, pkg := range packages {
+		index.Add(pkg.Package, pkg.Version, pkg.GetProvides())
+	}
+	return index
+}
+
+func relations(pkg control.BinaryIndex) dependency.Dependency {
+	dep := dependency.Dependency{}
+	dep.Relations = append(dep.Relations, pkg.GetPreDepends().Relations...)
+	dep.Relations = append(dep.Relations, pkg.GetDepends().Relations...)
+	return dep
+}
+
+// After migrating, the new binaries need to be installable in Testing,
+// and nothing that was installable in Testing may stop being so.
+func (e *Evaluator) checkInstallability(excuse *Excuse) {
+	for _, arch := range e.Testing.architectures() {
+		before := packageIndex(e.Testing.Binaries[arch])
+		after, added := e.migrated(excuse.Source, arch)
+		index := packageIndex(after)
+
+		for _, pkg := range added {
+			for _, relation := range index.Unsatisfied(relations(pkg)) {
+				excuse.block("%s/%s would be uninstallable: %s", pkg.Package, arch, relation)
+			}
+		}
+
+		for _, pkg := range e.Testing.Binaries[arch] {
+			if pkg.SourcePackage() == excuse.Source {
+				continue
+			}
+			dep := relations(pkg)
+			broken := index.Unsatisfied(dep)
+			if len(broken) == 0 || len(before.Unsatisfied(dep)) != 0 {
+				continue
+			}
+			excuse.block("would break %s/%s: %s", pkg.Package, arch, broken[0])
+		}
+	}
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,203 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package migration_test
+
+import (
+	"bufio"
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/migration"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+func suite(t *testing.T, sources, amd64 string) migration.Suite {
+	srcs, err := control.ParseSourceIndex(bufio.NewReader(strings.NewReader(sources)))
+	isok(t, err)
+	bins, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(amd64)))
+	isok(t, err)
+	return migration.Suite{
+		Sources:  srcs,
+		Binaries: map[string][]control.BinaryIndex{"amd64": bins},
+	}
+}
+
+// {{{ testing and unstable indices
+var testingSources = `Package: foo
+Version: 1.0-1
+Architecture: any
+
+Package: bar
+Version: 2.0-1
+Architecture: any
+
+Package: baz
+Version: 1.0-1
+Architecture: all
+`
+
+var testingBinaries = `Package: libfoo1
+Source: foo
+Version: 1.0-1
+Architecture: amd64
+
+Package: bar
+Version: 2.0-1
+Architecture: amd64
+Depends: libfoo1
+
+Package: baz
+Version: 1.0-1
+Architecture: all
+`
+
+var unstableSources = `Package: foo
+Version: 2.0-1
+Architecture: any
+
+Package: bar
+Version: 2.1-1
+Architecture: any
+
+Package: baz
+Version: 1.1-1
+Architecture: all
+
+Package: qux
+Version: 0.1-1
+Architecture: any
+`
+
+var unstableBinaries = `Package: libfoo2
+Source: foo
+Version: 2.0-1
+Architecture: amd64
+
+Package: bar
+Version: 2.0-1+b1
+Source: bar (2.0-1)
+Architecture: amd64
+Depends: libfoo1
+
+Package: baz
+Version: 1.1-1
+Architecture: all
+Depends: libfoo2
+`
+
+// }}}
+
+func TestEvaluate(t *testing.T) {
+	evaluator := migration.Evaluator{
+		Testing:  suite(t, testingSources, testingBinaries),
+		Unstable: suite(t, unstableSources, unstableBinaries),
+		Age:      map[string]int{"foo": 5, "bar": 10, "baz": 1, "qux": 20},
+		Urgency:  map[string]string{"baz": "high"},
+		UnstableBugs: map[string][]string{
+			"foo": {"1234", "5678"},
+		},
+		TestingBugs: map[string][]string{
+			"foo": {"1234"},
+		},
+		Autopkgtest: map[string]migration.TestResult{
+			"bar": migration.Running,
+		},
+	}
+
+	excuses := evaluator.Evaluate()
+	assert(t, len(excuses) == 4)
+	byName := map[string]migration.Excuse{}
+	for _, excuse := range excuses {
+		byName[excuse.Source] = excuse
+	}
+
+	/* foo drops libfoo1, which bar in testing needs */
+	foo := byName["foo"]
+	assert(t, !foo.Valid())
+	assert(t, foo.OldVersion.String() == "1.0-1")
+	assert(t, len(foo.Reasons) == 2)
+	assert(t, foo.Reasons[0] == "introduces RC bugs: #5678")
+	assert(t, strings.HasPrefix(foo.Reasons[1], "would break bar/amd64"))
+
+	/* bar's binary is a binNMU of an older version */
+	bar := byName["bar"]
+	assert(t, len(bar.Reasons) == 2)
+	assert(t, bar.Reasons[0] == "autopkgtests still running")
+	assert(t, bar.Reasons[1] == "out of date on amd64: bar")
+
+	/* baz is high urgency, but libfoo2 isn't in testing yet */
+	baz := byName["baz"]
+	assert(t, baz.MinAge == 2)
+	assert(t, len(baz.Reasons) == 2)
+	assert(t, baz.Reasons[0] == "too young: 1 of 2 days (urgency high)")
+	assert(t, strings.HasPrefix(baz.Reasons[1], "baz/amd64 would be uninstallable: libfoo2"))
+
+	qux := byName["qux"]
+	assert(t, qux.OldVersion == nil)
+	assert(t, len(qux.Reasons) == 1)
+	assert(t, qux.Reasons[0] == "missing build on amd64")
+
+	/* Once bar is rebuilt against libfoo2, and libfoo2 has migrated, bar can go */
+	evaluator.UnstableBugs = nil
+	evaluator.Autopkgtest = nil
+	evaluator.Unstable = suite(t, unstableSources, `Package: libfoo2
+Source: foo
+Version: 2.0-1
+Architecture: amd64
+
+Package: bar
+Version: 2.1-1
+Architecture: amd64
+Depends: libfoo2
+`)
+	evaluator.Testing.Binaries["amd64"] = append(evaluator.Testing.Binaries["amd64"],
+		evaluator.Unstable.Binaries["amd64"][0])
+	for _, excuse := range evaluator.Evaluate() {
+		if excuse.Source == "bar" {
+			assert(t, excuse.Valid())
+		}
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,130 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package mirror // import "pault.ag/go/debian/mirror"
+
+import (
+	"fmt"
+
+	"pault.ag/go/debian/repo"
+)
+
+// Job {{{
+
+// A Job is a Subset (or, for a Mirror with no Seeds, a full Sync), along
+// with where it's to be written, as loaded from a Mirror paragraph of a
+// repo.Config. Exactly one of Subset and Sync is set.
+type Job struct {
+	Name        string
+	Destination string
+	Subset      *Subset
+	Sync        *Sync
+}
+
+// Write the Subset out to, or Sync, the Destination.
+func (j Job) Run() error {
+	var err error
+	if j.Subset != nil {
+		err = j.Subset.Write(j.Destination)
+	} else {
+		_, err = j.Sync.Run(j.Destination)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", j.Name, err)
+	}
+	return nil
+}
+
+// Create a Job for every Mirror in the Config, wiring up the Clients for
+// its Upstream, its signing key, and a Pool shared between every Mirror
+// with the same Link mode. Mirrors without Seeds mirror every package,
+// keeping the upstream InRelease, so can't have a Signing-Key.
+func Load(config *repo.Config) ([]Job, error) {
+	pools := map[LinkMode]*Pool{}
+	ret := []Job{}
+
+	for _, mirror := range config.Mirrors {
+		upstream := config.Upstream(mirror.Upstream)
+		if upstream == nil {
+			return nil, fmt.Errorf("Mirror '%s' uses unknown Upstream '%s'", mirror.Mirror, mirror.Upstream)
+		}
+		clients, err := upstream.Clients()
+		if err != nil {
+			return nil, err
+		}
+
+		var pool *Pool
+		if mirror.Link != "" {
+			mode, err := ParseLinkMode(mirror.Link)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", mirror.Mirror, err)
+			}
+			if pools[mode] == nil {
+				pools[mode] = NewPool(mode)
+			}
+			pool = pools[mode]
+		}
+
+		if len(mirror.Seeds) == 0 {
+			if mirror.SigningKey != "" {
+				return nil, fmt.Errorf("%s: a Signing-Key needs Seeds", mirror.Mirror)
+			}
+			ret = append(ret, Job{
+				Name:        mirror.Mirror,
+				Destination: mirror.Destination,
+				Sync: &Sync{
+					Clients:       clients,
+					Components:    mirror.Components,
+					Architectures: mirror.Architectures,
+					Sources:       mirror.Sources,
+					Pool:          pool,
+				},
+			})
+			continue
+		}
+
+		subset := Subset{
+			Clients:       clients,
+			Components:    mirror.Components,
+			Architectures: mirror.Architectures,
+			Seeds:         mirror.Seeds,
+			Recommends:    mirror.Recommends,
+			Sources:       mirror.Sources,
+			Pool:          pool,
+		}
+
+		if mirror.SigningKey != "" {
+			if subset.Signer, err = repo.LoadSigningKey(mirror.SigningKey); err != nil {
+				return nil, err
+			}
+		}
+
+		ret = append(ret, Job{
+			Name:        mirror.Mirror,
+			Destination: mirror.Destination,
+			Subset:      &subset,
+		})
+	}
+	return ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
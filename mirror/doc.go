@@ -0,0 +1,14 @@
+/*
+Build local mirrors of APT repositories.
+
+The Subset type computes the dependency closure of a set of seed packages
+against one or more suites, downloads only the packages (and optionally
+sources) needed, and writes out a self-consistent (and optionally signed)
+repository that can be used as an APT source, such as for airgapped
+deployments.
+
+The Sync type keeps a full mirror of one or more suites up to date,
+fetching only the indices and pool files that changed since the last run,
+and removing anything no longer referenced.
+*/
+package mirror // import "pault.ag/go/debian/mirror"
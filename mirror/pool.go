@@ -0,0 +1,214 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package mirror // import "pault.ag/go/debian/mirror"
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"pault.ag/go/debian/control"
+)
+
+// LinkMode {{{
+
+// LinkMode controls how a Pool places a file that it already has a copy of
+// somewhere else on disk.
+type LinkMode int
+
+const (
+	// Write a full copy of the file.
+	Copy LinkMode = iota
+	// Hardlink the existing file into place. Both paths must be on the same
+	// filesystem.
+	Hardlink
+	// Symlink to the existing file, using a relative path.
+	Symlink
+)
+
+func (m LinkMode) String() string {
+	switch m {
+	case Copy:
+		return "copy"
+	case Hardlink:
+		return "hardlink"
+	case Symlink:
+		return "symlink"
+	default:
+		return fmt.Sprintf("LinkMode(%d)", int(m))
+	}
+}
+
+// Parse a LinkMode from its name, as returned by String.
+func ParseLinkMode(name string) (LinkMode, error) {
+	for _, mode := range []LinkMode{Copy, Hardlink, Symlink} {
+		if mode.String() == name {
+			return mode, nil
+		}
+	}
+	return Copy, fmt.Errorf("Unknown link mode: %s", name)
+}
+
+// }}}
+
+// Pool {{{
+
+// A Pool keeps track of every file written out while publishing, keyed by
+// checksum, so that when more than one suite (or more than one output
+// directory) references the same artifact, it's only fetched once, and disk
+// usage stays proportional to the unique content.
+//
+// Every file is verified against its checksum before it's reused, so a
+// file that was changed or truncated on disk is fetched again rather than
+// being linked into place.
+type Pool struct {
+	Mode LinkMode
+
+	files map[string]string
+}
+
+// Create a new, empty Pool that places duplicate files using the given
+// LinkMode.
+func NewPool(mode LinkMode) *Pool {
+	return &Pool{Mode: mode, files: map[string]string{}}
+}
+
+// Make sure the file described by hash exists at dest. If dest already has
+// the right content, nothing is done. If the Pool has already placed a file
+// with the same checksum, it's linked (or copied) into place. Otherwise,
+// fetch is called to write the file to dest.
+func (p *Pool) Place(hash control.FileHash, dest string, fetch func(dest string) error) error {
+	key := hash.Algorithm + ":" + hash.Hash
+
+	if err := verifyFile(dest, hash); err == nil {
+		p.remember(key, dest)
+		return nil
+	}
+
+	if existing, ok := p.files[key]; ok {
+		if err := verifyFile(existing, hash); err == nil {
+			if err := p.link(existing, dest); err != nil {
+				return err
+			}
+			return verifyFile(dest, hash)
+		}
+		delete(p.files, key)
+	}
+
+	if err := fetch(dest); err != nil {
+		return err
+	}
+	p.remember(key, dest)
+	return nil
+}
+
+func (p *Pool) remember(key, pathname string) {
+	if _, ok := p.files[key]; ok {
+		return
+	}
+	if abs, err := filepath.Abs(pathname); err == nil {
+		pathname = abs
+	}
+	p.files[key] = pathname
+}
+
+// Put a copy of (or link to) existing at dest, swapping it in atomically.
+func (p *Pool) link(existing, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(dest), "."+filepath.Base(dest)+".link")
+	os.Remove(tmp)
+
+	switch p.Mode {
+	case Hardlink:
+		if err := os.Link(existing, tmp); err != nil {
+			return err
+		}
+	case Symlink:
+		target, err := filepath.Rel(filepath.Dir(dest), existing)
+		if err != nil {
+			target = existing
+		}
+		if err := os.Symlink(target, tmp); err != nil {
+			return err
+		}
+	case Copy:
+		if err := copyFile(existing, tmp); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown link mode: %s", p.Mode)
+	}
+	return os.Rename(tmp, dest)
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Check that the file at pathname has the size and checksum given in hash.
+func verifyFile(pathname string, hash control.FileHash) error {
+	f, err := os.Open(pathname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if hash.Size != 0 && info.Size() != hash.Size {
+		return fmt.Errorf("%s: size mismatch: got %d, want %d", pathname, info.Size(), hash.Size)
+	}
+
+	verifier, err := hash.Verifier()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(verifier, f); err != nil {
+		return err
+	}
+	if err := verifier.Close(); err != nil {
+		return fmt.Errorf("%s: %s", pathname, err)
+	}
+	return nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
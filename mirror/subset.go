@@ -0,0 +1,328 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package mirror // import "pault.ag/go/debian/mirror"
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/openpgp"
+
+	"pault.ag/go/debian/archive"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/hashio"
+	"pault.ag/go/debian/repo"
+	"pault.ag/go/debian/version"
+)
+
+// Subset {{{
+
+// A Subset describes a partial mirror: the set of seed packages that need
+// to be installable, and where to find them.
+type Subset struct {
+	// One Client for each suite to be mirrored. Each suite is written to
+	// dists/<suite> in the output directory.
+	Clients []*repo.Client
+
+	Components []string
+
+	// Architectures to mirror, which may include wildcards such as
+	// "linux-any" (see control.Release.SelectArchitectures).
+	Architectures []dependency.Arch
+
+	// Packages that must be installable from the partial mirror. Every
+	// seed must exist in every suite and architecture.
+	Seeds []string
+
+	// Follow Recommends as well as Depends and Pre-Depends.
+	Recommends bool
+
+	// Also download the source packages that the selected binaries were
+	// built from.
+	Sources bool
+
+	// If set, an InRelease file is written, clearsigned with this entity.
+	// The entity's private key must already be decrypted.
+	Signer *openpgp.Entity
+
+	// If set, pool files are placed through the Pool, so files that are
+	// already on disk (from this or an earlier Write) aren't downloaded
+	// again, and can be hardlinked or symlinked between output directories
+	// sharing the same Pool.
+	Pool *Pool
+}
+
+// Write the partial mirror out to the directory dest, creating it if
+// needed. Without a Pool, every file is re-downloaded.
+func (s *Subset) Write(dest string) error {
+	for _, client := range s.Clients {
+		if err := s.writeSuite(client, dest); err != nil {
+			return fmt.Errorf("%s: %s", client.Suite, err)
+		}
+	}
+	return nil
+}
+
+// }}}
+
+// Suite writer {{{
+
+func (s *Subset) writeSuite(client *repo.Client, dest string) error {
+	upstream, err := client.Release()
+	if err != nil {
+		return err
+	}
+	architectures, err := upstream.SelectArchitectures(s.Architectures)
+	if err != nil {
+		return err
+	}
+
+	indices := map[string][]byte{}
+	sources := map[string]map[string]bool{}
+
+	for _, component := range s.Components {
+		sources[component] = map[string]bool{}
+		for _, arch := range architectures {
+			candidates := []control.BinaryIndex{}
+			if err := client.Packages(component, arch, func(pkg *control.BinaryIndex) error {
+				candidates = append(candidates, *pkg)
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			selected, err := Closure(candidates, s.Seeds, s.Recommends)
+			if err != nil {
+				return fmt.Errorf("%s/%s: %s", component, arch, err)
+			}
+
+			packages := bytes.Buffer{}
+			for i, pkg := range selected {
+				if err := s.download(client, pkg.Filename, "sha256", pkg.SHA256, int64(pkg.Size), dest); err != nil {
+					return err
+				}
+				if i != 0 {
+					packages.WriteString("\n")
+				}
+				if err := pkg.Paragraph.WriteTo(&packages); err != nil {
+					return err
+				}
+				sources[component][pkg.SourcePackage()] = true
+			}
+			indices[path.Join(component, "binary-"+arch.String(), "Packages")] = packages.Bytes()
+		}
+	}
+
+	if s.Sources {
+		for _, component := range s.Components {
+			index := bytes.Buffer{}
+			if err := client.Sources(component, func(src *control.SourceIndex) error {
+				if !sources[component][src.Package] {
+					return nil
+				}
+				for _, file := range src.ChecksumsSha256 {
+					pathname := path.Join(src.Directory, file.Filename)
+					if err := s.download(client, pathname, "sha256", file.Hash, file.Size, dest); err != nil {
+						return err
+					}
+				}
+				if index.Len() != 0 {
+					index.WriteString("\n")
+				}
+				return src.Paragraph.WriteTo(&index)
+			}); err != nil {
+				return err
+			}
+			indices[path.Join(component, "source", "Sources")] = index.Bytes()
+		}
+	}
+
+	return s.writeDists(upstream, architectures, indices, filepath.Join(dest, "dists", client.Suite))
+}
+
+func (s *Subset) download(client *repo.Client, pathname, algorithm, hash string, size int64, dest string) error {
+	fileHash := control.FileHash{
+		Algorithm: algorithm,
+		Hash:      hash,
+		Size:      size,
+		Filename:  pathname,
+	}
+	dest = filepath.Join(dest, filepath.FromSlash(pathname))
+	if s.Pool == nil {
+		return client.Download(pathname, fileHash, dest)
+	}
+	return s.Pool.Place(fileHash, dest, func(dest string) error {
+		return client.Download(pathname, fileHash, dest)
+	})
+}
+
+// Each index is written out in every one of these compressions ("" being
+// the uncompressed index).
+var indexCompressions = []string{"", "gz", "xz"}
+
+// Write out each index (in each of the indexCompressions), and a Release
+// file listing them all.
+func (s *Subset) writeDists(upstream *control.Release, architectures []dependency.Arch, indices map[string][]byte, dists string) error {
+	names := []string{}
+	for name := range indices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		outputs := []*hashio.Output{}
+		buffers := []*bytes.Buffer{}
+		for _, compression := range indexCompressions {
+			buffer := &bytes.Buffer{}
+			buffers = append(buffers, buffer)
+			outputs = append(outputs, &hashio.Output{Compression: compression, Writer: buffer})
+		}
+		if err := hashio.Recompress(bytes.NewReader(indices[name]), nil, outputs...); err != nil {
+			return err
+		}
+
+		for i, output := range outputs {
+			filename := name + output.Extension()
+			if err := writeFile(filepath.Join(dists, filepath.FromSlash(filename)), buffers[i].Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer := archive.ReleaseWriter{
+		Release: control.Release{
+			Origin:        upstream.Origin,
+			Label:         upstream.Label,
+			Suite:         upstream.Suite,
+			Codename:      upstream.Codename,
+			Version:       upstream.Version,
+			Architectures: architectures,
+			Components:    s.Components,
+			Description:   "Partial mirror of " + upstream.Suite,
+		},
+		Hashes: []string{"sha256"},
+		Signer: s.Signer,
+	}
+	_, err := writer.Write(dists)
+	return err
+}
+
+func writeFile(pathname string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(pathname, data, 0644)
+}
+
+// }}}
+
+// Closure {{{
+
+// Given every package available on an architecture, return the newest
+// version of each package needed to satisfy the seeds and all of their
+// (transitive) Depends and Pre-Depends, and Recommends if asked. For each
+// Relation, the first Possibility that can be satisfied (either by a real
+// package of the right version, or via Provides) is used.
+func Closure(candidates []control.BinaryIndex, seeds []string, recommends bool) ([]control.BinaryIndex, error) {
+	newest := map[string]control.BinaryIndex{}
+	for _, pkg := range candidates {
+		if current, ok := newest[pkg.Package]; ok && version.Compare(current.Version, pkg.Version) >= 0 {
+			continue
+		}
+		newest[pkg.Package] = pkg
+	}
+	index := dependency.NewPackageIndex()
+	for name, pkg := range newest {
+		index.Add(name, pkg.Version, pkg.GetProvides())
+	}
+
+	/* Prefer the real package, and then the first provider by name */
+	resolve := func(possi dependency.Possibility) (string, bool) {
+		found := index.Candidates(possi)
+		for _, candidate := range found {
+			if candidate.Virtual == "" {
+				return candidate.Package, true
+			}
+		}
+		if len(found) > 0 {
+			return found[0].Package, true
+		}
+		return "", false
+	}
+
+	selected := map[string]bool{}
+	order := []string{}
+	queue := []string{}
+	for _, seed := range seeds {
+		if _, ok := newest[seed]; !ok {
+			return nil, fmt.Errorf("Seed package '%s' is not available", seed)
+		}
+		queue = append(queue, seed)
+	}
+
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if selected[name] {
+			continue
+		}
+		selected[name] = true
+		order = append(order, name)
+
+		pkg := newest[name]
+		relations := []dependency.Relation{}
+		relations = append(relations, pkg.GetPreDepends().Relations...)
+		relations = append(relations, pkg.GetDepends().Relations...)
+		if recommends {
+			relations = append(relations, pkg.GetRecommends().Relations...)
+		}
+
+		for _, relation := range relations {
+			found := false
+			for _, possi := range relation.Possibilities {
+				if target, ok := resolve(possi); ok {
+					queue = append(queue, target)
+					found = true
+					break
+				}
+			}
+			if !found && len(relation.Possibilities) > 0 {
+				return nil, fmt.Errorf("%s: unable to satisfy '%s'", name, relation)
+			}
+		}
+	}
+
+	sort.Strings(order)
+	ret := []control.BinaryIndex{}
+	for _, name := range order {
+		ret = append(ret, newest[name])
+	}
+	return ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,303 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package mirror_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/mirror"
+	"pault.ag/go/debian/pgp"
+	"pault.ag/go/debian/repo"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+var amd64 = dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"}
+
+// Serve a fake mirror with the suite "test", containing a handful of
+// packages, and the (fake) .deb files for each of them.
+func newMirror(t *testing.T) *httptest.Server {
+	debs := map[string][]byte{}
+	packages := bytes.Buffer{}
+	for _, el := range []struct{ name, version, relations string }{
+		{"app", "1.0-1", "Depends: libfoo1 (>= 1.0), mail-transport-agent\nRecommends: docs\n"},
+		{"libfoo1", "1.0-1", "Depends: libc6\n"},
+		{"libfoo1", "1.2-1", "Depends: libc6\n"},
+		{"libc6", "2.36-9", ""},
+		{"postfix", "3.7-1", "Provides: mail-transport-agent\n"},
+		{"docs", "1.0-1", ""},
+		{"unrelated", "1.0-1", ""},
+	} {
+		filename := fmt.Sprintf("pool/main/%s_%s_amd64.deb", el.name, el.version)
+		data := []byte("not really a deb: " + filename)
+		debs["/"+filename] = data
+		fmt.Fprintf(&packages, "Package: %s\nVersion: %s\nArchitecture: amd64\n%sFilename: %s\nSize: %d\nSHA256: %x\n\n",
+			el.name, el.version, el.relations, filename, len(data), sha256.Sum256(data))
+	}
+
+	release := fmt.Sprintf(`Origin: Test
+Suite: test
+Codename: test
+SHA256:
+ %x %d main/binary-amd64/Packages
+`, sha256.Sum256(packages.Bytes()), packages.Len())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dists/test/InRelease", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(release))
+	})
+	mux.HandleFunc("/dists/test/main/binary-amd64/Packages", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(packages.Bytes())
+	})
+	mux.HandleFunc("/pool/", func(w http.ResponseWriter, r *http.Request) {
+		data, ok := debs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestClosure(t *testing.T) {
+	index, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(`Package: a
+Version: 1.0
+Depends: b | c, d
+
+Package: c
+Version: 1.0
+
+Package: d
+Version: 1.0
+Pre-Depends: e
+
+Package: e
+Version: 1.0
+`)))
+	isok(t, err)
+
+	selected, err := mirror.Closure(index, []string{"a"}, false)
+	isok(t, err)
+	assert(t, len(selected) == 4)
+	assert(t, selected[1].Package == "c")
+
+	_, err = mirror.Closure(index, []string{"b"}, false)
+	notok(t, err)
+
+	_, err = mirror.Closure(index[:1], []string{"a"}, false)
+	notok(t, err)
+}
+
+func TestSubsetWrite(t *testing.T) {
+	server := newMirror(t)
+	defer server.Close()
+
+	client, err := repo.New(server.URL, "test", nil)
+	isok(t, err)
+
+	signer, err := openpgp.NewEntity("Test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	isok(t, err)
+
+	dest := t.TempDir()
+	subset := mirror.Subset{
+		Clients:       []*repo.Client{client},
+		Components:    []string{"main"},
+		Architectures: []dependency.Arch{amd64},
+		Seeds:         []string{"app"},
+		Signer:        signer,
+	}
+	isok(t, subset.Write(dest))
+
+	f, err := os.Open(filepath.Join(dest, "dists/test/InRelease"))
+	isok(t, err)
+	defer f.Close()
+	release, _, err := pgp.ParseSignedRelease(f, openpgp.EntityList{signer})
+	isok(t, err)
+	assert(t, release.Origin == "Test")
+	assert(t, len(release.SHA256) == 3)
+
+	f, err = os.Open(filepath.Join(dest, "dists/test/main/binary-amd64/Packages"))
+	isok(t, err)
+	defer f.Close()
+	index, err := control.ParseBinaryIndex(bufio.NewReader(f))
+	isok(t, err)
+
+	names := []string{}
+	for _, pkg := range index {
+		names = append(names, pkg.Package+"="+pkg.Version.String())
+		_, err := os.Stat(filepath.Join(dest, pkg.Filename))
+		isok(t, err)
+	}
+	assert(t, strings.Join(names, " ") == "app=1.0-1 libc6=2.36-9 libfoo1=1.2-1 postfix=3.7-1")
+
+	/* Now, the partial mirror should itself be a usable mirror */
+	local := httptest.NewServer(http.FileServer(http.Dir(dest)))
+	defer local.Close()
+	client, err = repo.New(local.URL, "test", openpgp.EntityList{signer})
+	isok(t, err)
+	count := 0
+	isok(t, client.Packages("main", amd64, func(*control.BinaryIndex) error {
+		count++
+		return nil
+	}))
+	assert(t, count == 4)
+}
+
+func TestSubsetPool(t *testing.T) {
+	server := newMirror(t)
+	defer server.Close()
+
+	requests := 0
+	counting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/pool/") {
+			requests++
+		}
+		http.Redirect(w, r, server.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer counting.Close()
+
+	client, err := repo.New(counting.URL, "test", nil)
+	isok(t, err)
+
+	pool := mirror.NewPool(mirror.Hardlink)
+	subset := mirror.Subset{
+		Clients:       []*repo.Client{client},
+		Components:    []string{"main"},
+		Architectures: []dependency.Arch{amd64},
+		Seeds:         []string{"app"},
+		Pool:          pool,
+	}
+
+	one, two := t.TempDir(), t.TempDir()
+	isok(t, subset.Write(one))
+	assert(t, requests == 4)
+	isok(t, subset.Write(two))
+	assert(t, requests == 4)
+
+	deb := "pool/main/libc6_2.36-9_amd64.deb"
+	a, err := os.Stat(filepath.Join(one, deb))
+	isok(t, err)
+	b, err := os.Stat(filepath.Join(two, deb))
+	isok(t, err)
+	assert(t, os.SameFile(a, b))
+
+	/* A corrupted file is never linked, and gets fetched again */
+	three := t.TempDir()
+	isok(t, os.WriteFile(filepath.Join(one, deb), []byte("corrupt"), 0644))
+	isok(t, subset.Write(three))
+	assert(t, requests == 5)
+	data, err := os.ReadFile(filepath.Join(three, deb))
+	isok(t, err)
+	assert(t, strings.HasPrefix(string(data), "not really a deb"))
+}
+
+func TestLoadConfig(t *testing.T) {
+	server := newMirror(t)
+	defer server.Close()
+
+	dest := t.TempDir()
+	config, err := repo.ParseConfig(strings.NewReader(fmt.Sprintf(`Upstream: fake
+URI: %s
+Suites: test
+
+Mirror: one
+Upstream: fake
+Destination: %s
+Components: main
+Architectures: amd64
+Seeds: app
+Link: symlink
+
+Mirror: two
+Upstream: fake
+Destination: %s
+Components: main
+Architectures: amd64
+Seeds: libc6
+Link: symlink
+`, server.URL, filepath.Join(dest, "one"), filepath.Join(dest, "two"))))
+	isok(t, err)
+
+	jobs, err := mirror.Load(config)
+	isok(t, err)
+	assert(t, len(jobs) == 2)
+	assert(t, jobs[0].Subset.Pool == jobs[1].Subset.Pool)
+	for _, job := range jobs {
+		isok(t, job.Run())
+	}
+
+	deb := "pool/main/libc6_2.36-9_amd64.deb"
+	info, err := os.Lstat(filepath.Join(dest, "two", deb))
+	isok(t, err)
+	assert(t, info.Mode()&os.ModeSymlink != 0)
+	data, err := os.ReadFile(filepath.Join(dest, "two", deb))
+	isok(t, err)
+	assert(t, strings.HasPrefix(string(data), "not really a deb"))
+
+	config.Mirrors[0].Link = "reflink"
+	_, err = mirror.Load(config)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,609 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package mirror // import "pault.ag/go/debian/mirror"
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/repo"
+)
+
+// Events {{{
+
+// Action is what a Sync did with a file.
+type Action int
+
+const (
+	// The file on disk was already up to date.
+	Keep Action = iota
+	// The file was downloaded and verified.
+	Fetch
+	// The file is no longer referenced, and was removed.
+	Remove
+)
+
+func (a Action) String() string {
+	switch a {
+	case Keep:
+		return "keep"
+	case Fetch:
+		return "fetch"
+	case Remove:
+		return "remove"
+	default:
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+}
+
+// An Event is handed to the Sync's Progress hook for each file it looks at.
+type Event struct {
+	Action Action
+
+	// Path of the file, relative to the root of the mirror, such as
+	// "dists/bookworm/main/binary-amd64/Packages.xz".
+	Pathname string
+
+	// Size of the file, if known.
+	Size int64
+}
+
+// Stats is a count of what a Sync did.
+type Stats struct {
+	Kept    int
+	Fetched int
+	Removed int
+
+	// Bytes downloaded.
+	FetchedBytes int64
+}
+
+// }}}
+
+// Sync {{{
+
+// A Sync keeps a full mirror of one or more suites up to date. Each run
+// fetches the InRelease of every suite, and compares the index hashes it
+// lists against what's on disk, so only indices that changed are fetched,
+// and only pool files that aren't already on disk. Every byte fetched is
+// checked against the hash chain: the InRelease against the Client's
+// Keyring (and its Valid-Until date, unless the Client has AllowExpired
+// set), the indices against the InRelease, and the pool files against
+// the indices. Anything no longer referenced by any suite is removed.
+//
+// The new InRelease is only written once everything it refers to is in
+// place, so a Sync that's interrupted leaves the old InRelease behind, and
+// the next run picks up where it left off.
+//
+// How many connections are made to the mirror, and how quickly it's read
+// from, is limited by each Client's Throttle (see repo.Throttle).
+type Sync struct {
+	// One Client for each suite to be mirrored. Suites that share a
+	// destination share its pool.
+	Clients []*repo.Client
+
+	// Components to mirror. If empty, every Component the Release lists.
+	Components []string
+
+	// Architectures to mirror, which may include wildcards such as
+	// "linux-any". If empty, every Architecture the Release lists.
+	// Architecture "all" indices are always mirrored.
+	Architectures []dependency.Arch
+
+	// Also mirror the Sources indices, and the source packages in them.
+	Sources bool
+
+	// Check the hash of every file on disk on each run. Otherwise, an index
+	// is trusted if its size is right and the last InRelease listed the same
+	// hash, and a pool file is trusted if its size is right, since pool
+	// filenames are never reused for different content.
+	Verify bool
+
+	// If set, pool files are placed through the Pool, as with Subset.
+	Pool *Pool
+
+	// If set, called for each file kept, fetched or removed.
+	Progress func(Event)
+}
+
+// Bring the mirror in the directory dest up to date, creating it if
+// needed, and return a count of what was done.
+func (s *Sync) Run(dest string) (*Stats, error) {
+	stats := Stats{}
+	referenced := map[string]bool{}
+	for _, client := range s.Clients {
+		if err := s.syncSuite(client, dest, referenced, &stats); err != nil {
+			return nil, fmt.Errorf("%s: %s", client.Suite, err)
+		}
+	}
+	if err := s.prune(dest, "pool", referenced, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (s *Sync) report(stats *Stats, action Action, pathname string, size int64) {
+	switch action {
+	case Keep:
+		stats.Kept++
+	case Fetch:
+		stats.Fetched++
+		stats.FetchedBytes += size
+	case Remove:
+		stats.Removed++
+	}
+	if s.Progress != nil {
+		s.Progress(Event{Action: action, Pathname: pathname, Size: size})
+	}
+}
+
+// }}}
+
+// Suite {{{
+
+func (s *Sync) syncSuite(client *repo.Client, dest string, referenced map[string]bool, stats *Stats) error {
+	dists := path.Join("dists", client.Suite)
+
+	/* Read the InRelease ourselves, so the exact bytes that were checked
+	 * are the ones written out at the end. */
+	body, err := client.Open(path.Join(dists, "InRelease"))
+	if err != nil {
+		return err
+	}
+	inRelease, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+	release, err := client.ParseRelease(inRelease)
+	if err != nil {
+		return err
+	}
+
+	/* What the last run left behind; if there's nothing usable, every
+	 * index is hashed instead. */
+	previous := map[string]control.FileHash{}
+	if old, err := control.ParseReleaseFile(filepath.Join(dest, filepath.FromSlash(dists), "InRelease")); err == nil {
+		if indices, err := old.Indices(); err == nil {
+			for _, index := range indices {
+				if hash, err := index.BestHash(); err == nil {
+					previous[index.Filename] = hash
+				}
+			}
+		}
+	}
+
+	files, err := s.selectIndices(release)
+	if err != nil {
+		return err
+	}
+
+	keep := map[string]bool{path.Join(dists, "InRelease"): true}
+	for _, file := range files {
+		hash, err := file.BestHash()
+		if err != nil {
+			return err
+		}
+		pathname := path.Join(dists, file.Filename)
+		keep[pathname] = true
+
+		old, ok := previous[file.Filename]
+		trusted := ok && old.Algorithm == hash.Algorithm && old.Hash == hash.Hash
+		remote := pathname
+		if release.AcquireByHash {
+			remote = hash.ByHashPath(pathname)
+		}
+		if err := s.place(client, remote, pathname, hash, trusted, dest, stats); err != nil {
+			return err
+		}
+
+		if release.AcquireByHash {
+			if err := s.placeByHash(file, pathname, dest, keep); err != nil {
+				return err
+			}
+		}
+	}
+
+	pool, err := s.poolFiles(files, dists, dest)
+	if err != nil {
+		return err
+	}
+	for _, hash := range pool {
+		if err := checkInside(hash.Filename); err != nil {
+			return err
+		}
+		referenced[hash.Filename] = true
+		if err := s.place(client, hash.Filename, hash.Filename, hash, true, dest, stats); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFile(filepath.Join(dest, filepath.FromSlash(dists), "InRelease"), inRelease); err != nil {
+		return err
+	}
+	return s.prune(dest, dists, keep, stats)
+}
+
+// Names of the by-hash directories for each algorithm, as apt expects.
+var byHashNames = map[string]string{
+	"md5":    "MD5Sum",
+	"sha1":   "SHA1",
+	"sha256": "SHA256",
+	"sha512": "SHA512",
+}
+
+// Put a copy of the index at pathname in place under by-hash/, for every
+// hash the Release lists for it, so apt can fetch it by hash from the
+// mirror, as it would from upstream. These are copies of files already
+// accounted for, so aren't reported.
+func (s *Sync) placeByHash(file control.ReleaseFile, pathname, dest string, keep map[string]bool) error {
+	algorithms := []string{}
+	for algorithm := range file.Hashes {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+
+	source := filepath.Join(dest, filepath.FromSlash(pathname))
+	for _, algorithm := range algorithms {
+		name, ok := byHashNames[algorithm]
+		if !ok {
+			continue
+		}
+		hash := control.FileHash{
+			Algorithm: algorithm,
+			Hash:      file.Hashes[algorithm],
+			Size:      file.Size,
+			ByHash:    name,
+		}
+		byHash := hash.ByHashPath(pathname)
+		keep[byHash] = true
+
+		local := filepath.Join(dest, filepath.FromSlash(byHash))
+		if s.current(local, hash, true) {
+			continue
+		}
+		if err := linkOrCopy(source, local); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// }}}
+
+// Selection {{{
+
+// Pick out the indices listed in the Release that belong to the
+// Components and Architectures being mirrored.
+func (s *Sync) selectIndices(release *control.Release) ([]control.ReleaseFile, error) {
+	components := map[string]bool{}
+	for _, component := range s.Components {
+		components[component] = true
+	}
+	if len(components) == 0 {
+		for _, component := range release.Components {
+			components[component] = true
+		}
+	}
+
+	/* nil means any; a Release that doesn't list Architectures, with none
+	 * asked for, can only be mirrored whole. */
+	var architectures map[string]bool
+	selected := release.Architectures
+	if len(s.Architectures) != 0 {
+		var err error
+		if selected, err = release.SelectArchitectures(s.Architectures); err != nil {
+			return nil, err
+		}
+	}
+	if len(selected) != 0 {
+		architectures = map[string]bool{"all": true}
+		for _, arch := range selected {
+			architectures[arch.String()] = true
+		}
+	}
+
+	indices, err := release.Indices()
+	if err != nil {
+		return nil, err
+	}
+	ret := []control.ReleaseFile{}
+	for _, index := range indices {
+		if err := checkInside(index.Filename); err != nil {
+			return nil, err
+		}
+		component, rest, ok := strings.Cut(index.Filename, "/")
+		if !ok || !components[component] {
+			continue
+		}
+		if arch, ok := indexArch(rest); ok {
+			if arch == "source" {
+				if !s.Sources {
+					continue
+				}
+			} else if architectures != nil && !architectures[arch] {
+				continue
+			}
+		}
+		ret = append(ret, index)
+	}
+	return ret, nil
+}
+
+// Refuse a path (from a Release or an index) that would end up outside
+// the directory it's relative to.
+func checkInside(pathname string) error {
+	if clean := path.Clean(pathname); path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("Refusing to write '%s' outside of the mirror", pathname)
+	}
+	return nil
+}
+
+// Return the architecture an index (relative to its component) is for,
+// such as "amd64" for "binary-amd64/Packages.xz" or "Contents-amd64.gz",
+// or "source" for source indices. Indices for no architecture in
+// particular, such as translations, return false.
+func indexArch(pathname string) (string, bool) {
+	for _, segment := range strings.Split(pathname, "/") {
+		segment, _, _ = strings.Cut(segment, ".")
+		switch {
+		case segment == "source":
+			return "source", true
+		case strings.HasPrefix(segment, "binary-"):
+			return strings.TrimPrefix(segment, "binary-"), true
+		case strings.HasPrefix(segment, "installer-"):
+			return strings.TrimPrefix(segment, "installer-"), true
+		case strings.HasPrefix(segment, "Contents-"):
+			segment = strings.TrimPrefix(segment, "Contents-")
+			return strings.TrimPrefix(segment, "udeb-"), true
+		}
+	}
+	return "", false
+}
+
+// }}}
+
+// Pool {{{
+
+// Compressed variants of an index, in the order they're read from disk.
+var localExtensions = []string{"", ".gz", ".xz", ".zst", ".bz2", ".lzma"}
+
+// Read every Packages and Sources index among the files (which must
+// already be on disk), and return the pool files they list, by path.
+func (s *Sync) poolFiles(files []control.ReleaseFile, dists, dest string) ([]control.FileHash, error) {
+	listed := map[string]bool{}
+	for _, file := range files {
+		listed[file.Filename] = true
+	}
+
+	indices := []string{}
+	seen := map[string]bool{}
+	for _, file := range files {
+		name := file.Filename
+		for _, ext := range localExtensions[1:] {
+			name = strings.TrimSuffix(name, ext)
+		}
+		switch path.Base(name) {
+		case "Packages", "Sources":
+		default:
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			indices = append(indices, name)
+		}
+	}
+
+	ret := []control.FileHash{}
+	for _, name := range indices {
+		for _, ext := range localExtensions {
+			if !listed[name+ext] {
+				continue
+			}
+			pathname := filepath.Join(dest, filepath.FromSlash(path.Join(dists, name+ext)))
+			hashes, err := readPoolFiles(pathname, path.Base(name) == "Sources")
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", name+ext, err)
+			}
+			ret = append(ret, hashes...)
+			break
+		}
+	}
+	return ret, nil
+}
+
+// Return the pool files listed in a (possibly compressed) Packages or
+// Sources index.
+func readPoolFiles(pathname string, sources bool) ([]control.FileHash, error) {
+	f, err := os.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader, err := compression.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoder, err := control.NewDecoder(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []control.FileHash{}
+	for {
+		if sources {
+			src := control.SourceIndex{}
+			if err := decoder.Decode(&src); err == io.EOF {
+				return ret, nil
+			} else if err != nil {
+				return nil, err
+			}
+			files := []control.FileHash{}
+			for _, file := range src.ChecksumsSha256 {
+				files = append(files, file.FileHash)
+			}
+			if len(files) == 0 {
+				for _, file := range src.Files {
+					files = append(files, file.FileHash)
+				}
+			}
+			for _, file := range files {
+				file.Filename = path.Join(src.Directory, file.Filename)
+				ret = append(ret, file)
+			}
+			continue
+		}
+
+		pkg := control.BinaryIndex{}
+		if err := decoder.Decode(&pkg); err == io.EOF {
+			return ret, nil
+		} else if err != nil {
+			return nil, err
+		}
+		hash := control.FileHash{Algorithm: "sha256", Hash: pkg.SHA256, Size: int64(pkg.Size), Filename: pkg.Filename}
+		if hash.Hash == "" {
+			hash.Algorithm, hash.Hash = "md5", pkg.MD5sum
+		}
+		ret = append(ret, hash)
+	}
+}
+
+// }}}
+
+// Files {{{
+
+// Return true if the file at pathname matches hash. If trusted, and not
+// told to Verify, only the size is checked.
+func (s *Sync) current(pathname string, hash control.FileHash, trusted bool) bool {
+	info, err := os.Stat(pathname)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != hash.Size {
+		return false
+	}
+	if trusted && !s.Verify {
+		return true
+	}
+	return verifyFile(pathname, hash) == nil
+}
+
+// Make sure the file at pathname (relative to the mirror root) matches
+// hash, fetching it from remote on the Client if it doesn't.
+func (s *Sync) place(client *repo.Client, remote, pathname string, hash control.FileHash, trusted bool, dest string, stats *Stats) error {
+	local := filepath.Join(dest, filepath.FromSlash(pathname))
+	if s.current(local, hash, trusted) {
+		s.report(stats, Keep, pathname, hash.Size)
+		return nil
+	}
+
+	fetched := false
+	fetch := func(local string) error {
+		fetched = true
+		return client.Download(remote, hash, local)
+	}
+	var err error
+	if s.Pool == nil {
+		err = fetch(local)
+	} else {
+		err = s.Pool.Place(hash, local, fetch)
+	}
+	if err != nil {
+		return err
+	}
+	if fetched {
+		s.report(stats, Fetch, pathname, hash.Size)
+	} else {
+		s.report(stats, Keep, pathname, hash.Size)
+	}
+	return nil
+}
+
+// Hardlink from to to, or copy it if it can't be linked, swapping it in
+// atomically.
+func linkOrCopy(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(to), "."+filepath.Base(to)+".link")
+	os.Remove(tmp)
+	if err := os.Link(from, tmp); err != nil {
+		if err := copyFile(from, tmp); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, to)
+}
+
+// Remove every file under the directory dir (relative to the mirror root)
+// that isn't in keep, along with any directories left empty.
+func (s *Sync) prune(dest, dir string, keep map[string]bool, stats *Stats) error {
+	root := filepath.Join(dest, filepath.FromSlash(dir))
+	dirs := []string{}
+	err := filepath.Walk(root, func(pathname string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && pathname == root {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if pathname != root {
+				dirs = append(dirs, pathname)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dest, pathname)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if keep[rel] {
+			return nil
+		}
+		if err := os.Remove(pathname); err != nil {
+			return err
+		}
+		s.report(stats, Remove, rel, info.Size())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	/* Deepest first, so parents empty out after their children */
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if entries, err := os.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+			os.Remove(dirs[i])
+		}
+	}
+	return nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,263 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package mirror_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/crypto/openpgp"
+
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/mirror"
+	"pault.ag/go/debian/repo"
+	"pault.ag/go/debian/testsupport"
+)
+
+/*
+ *
+ */
+
+// Build a signed archive with hello at the given version (along with an
+// arch: all library, and an i386 package that shouldn't be mirrored).
+func buildArchive(t *testing.T, signer *openpgp.Entity, version string) fstest.MapFS {
+	files, err := testsupport.Archive{
+		Debs: map[string][]testsupport.Deb{
+			"main": {
+				{Package: "hello", Version: version},
+				{Package: "libhello-data", Version: "1.0-1", Architecture: "all"},
+				{Package: "hello", Version: version, Architecture: "i386"},
+			},
+			"contrib": {{Package: "extra", Version: "1.0-1"}},
+		},
+		Sources: map[string][]testsupport.Source{
+			"main": {{Package: "hello", Version: version}},
+		},
+		Signer: signer,
+	}.Build()
+	isok(t, err)
+	return files
+}
+
+// Serve whichever archive is in *files, counting requests by path.
+func serveArchive(files *fstest.MapFS, requests map[string]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		http.FileServer(http.FS(*files)).ServeHTTP(w, r)
+	}))
+}
+
+func TestSync(t *testing.T) {
+	signer, err := testsupport.NewSigner()
+	isok(t, err)
+	files := buildArchive(t, signer, "1.0-1")
+	requests := map[string]int{}
+	server := serveArchive(&files, requests)
+	defer server.Close()
+
+	client, err := repo.New(server.URL, "unstable", testsupport.Keyring(signer))
+	isok(t, err)
+
+	events := []mirror.Event{}
+	sync := mirror.Sync{
+		Clients:       []*repo.Client{client},
+		Components:    []string{"main"},
+		Architectures: []dependency.Arch{amd64},
+		Sources:       true,
+		Progress:      func(event mirror.Event) { events = append(events, event) },
+	}
+
+	dest := t.TempDir()
+	stats, err := sync.Run(dest)
+	isok(t, err)
+	assert(t, stats.Kept == 0)
+	assert(t, stats.Removed == 0)
+	assert(t, stats.Fetched == len(events))
+
+	inRelease, err := os.ReadFile(filepath.Join(dest, "dists/unstable/InRelease"))
+	isok(t, err)
+	assert(t, bytes.Equal(inRelease, files["dists/unstable/InRelease"].Data))
+
+	for _, pathname := range []string{
+		"dists/unstable/main/binary-amd64/Packages.gz",
+		"dists/unstable/main/source/Sources",
+		"pool/main/h/hello/hello_1.0-1_amd64.deb",
+		"pool/main/h/hello/hello_1.0-1.dsc",
+		"pool/main/libh/libhello-data/libhello-data_1.0-1_all.deb",
+	} {
+		data, err := os.ReadFile(filepath.Join(dest, pathname))
+		isok(t, err)
+		assert(t, bytes.Equal(data, files[pathname].Data))
+	}
+	for _, pathname := range []string{
+		"dists/unstable/main/binary-i386/Packages",
+		"dists/unstable/contrib/binary-amd64/Packages",
+		"pool/main/h/hello/hello_1.0-1_i386.deb",
+		"pool/contrib/e/extra/extra_1.0-1_amd64.deb",
+	} {
+		_, err := os.Stat(filepath.Join(dest, pathname))
+		assert(t, os.IsNotExist(err))
+	}
+
+	/* Nothing changed, so only the InRelease is fetched */
+	for pathname := range requests {
+		delete(requests, pathname)
+	}
+	fetchedFirst := len(events)
+	stats, err = sync.Run(dest)
+	isok(t, err)
+	assert(t, stats.Fetched == 0)
+	assert(t, stats.Kept == fetchedFirst)
+	assert(t, len(requests) == 1)
+	assert(t, requests["/dists/unstable/InRelease"] == 1)
+
+	/* A new upload replaces the old one in the pool */
+	files = buildArchive(t, signer, "2.0-1")
+	events = events[:0]
+	stats, err = sync.Run(dest)
+	isok(t, err)
+	assert(t, stats.Fetched > 0)
+	assert(t, stats.Removed > 0)
+
+	fetched, removed := map[string]bool{}, map[string]bool{}
+	for _, event := range events {
+		switch event.Action {
+		case mirror.Fetch:
+			fetched[event.Pathname] = true
+		case mirror.Remove:
+			removed[event.Pathname] = true
+		}
+	}
+	assert(t, fetched["pool/main/h/hello/hello_2.0-1_amd64.deb"])
+	assert(t, fetched["dists/unstable/main/binary-amd64/Packages"])
+	assert(t, !fetched["pool/main/libh/libhello-data/libhello-data_1.0-1_all.deb"])
+	assert(t, removed["pool/main/h/hello/hello_1.0-1_amd64.deb"])
+	assert(t, removed["pool/main/h/hello/hello_1.0-1.dsc"])
+	assert(t, !removed["pool/main/libh/libhello-data/libhello-data_1.0-1_all.deb"])
+
+	_, err = os.Stat(filepath.Join(dest, "pool/main/h/hello/hello_1.0-1_amd64.deb"))
+	assert(t, os.IsNotExist(err))
+}
+
+func TestSyncVerify(t *testing.T) {
+	signer, err := testsupport.NewSigner()
+	isok(t, err)
+	files := buildArchive(t, signer, "1.0-1")
+	server := serveArchive(&files, map[string]int{})
+	defer server.Close()
+
+	client, err := repo.New(server.URL, "unstable", testsupport.Keyring(signer))
+	isok(t, err)
+	sync := mirror.Sync{
+		Clients:       []*repo.Client{client},
+		Components:    []string{"main"},
+		Architectures: []dependency.Arch{amd64},
+	}
+	dest := t.TempDir()
+	_, err = sync.Run(dest)
+	isok(t, err)
+
+	/* Same size, different content: only caught when verifying */
+	deb := filepath.Join(dest, "pool/main/h/hello/hello_1.0-1_amd64.deb")
+	corrupt := bytes.Repeat([]byte{'x'}, len(files["pool/main/h/hello/hello_1.0-1_amd64.deb"].Data))
+	isok(t, os.WriteFile(deb, corrupt, 0644))
+
+	stats, err := sync.Run(dest)
+	isok(t, err)
+	assert(t, stats.Fetched == 0)
+
+	sync.Verify = true
+	stats, err = sync.Run(dest)
+	isok(t, err)
+	assert(t, stats.Fetched == 1)
+	data, err := os.ReadFile(deb)
+	isok(t, err)
+	assert(t, !bytes.Equal(data, corrupt))
+
+	/* An InRelease signed by the wrong key leaves the mirror alone */
+	other, err := testsupport.NewSigner()
+	isok(t, err)
+	files = buildArchive(t, other, "2.0-1")
+	_, err = sync.Run(dest)
+	notok(t, err)
+	_, err = os.Stat(deb)
+	isok(t, err)
+}
+
+func TestSyncOutsideMirror(t *testing.T) {
+	data := []byte("evil\n")
+	files := fstest.MapFS{
+		"dists/unstable/InRelease": &fstest.MapFile{Data: []byte(fmt.Sprintf(`Suite: unstable
+Components: main
+SHA256:
+ %x %d main/../../../../evil
+`, sha256.Sum256(data), len(data)))},
+		"evil": &fstest.MapFile{Data: data},
+	}
+	server := serveArchive(&files, map[string]int{})
+	defer server.Close()
+
+	client, err := repo.New(server.URL, "unstable", nil)
+	isok(t, err)
+	sync := mirror.Sync{Clients: []*repo.Client{client}}
+
+	root := t.TempDir()
+	dest := filepath.Join(root, "a", "b")
+	_, err = sync.Run(dest)
+	notok(t, err)
+	_, err = os.Stat(filepath.Join(root, "evil"))
+	assert(t, os.IsNotExist(err))
+}
+
+func TestLoadSync(t *testing.T) {
+	config, err := repo.ParseConfig(strings.NewReader(fmt.Sprintf(`Upstream: fake
+URI: file:///srv/mirror
+Suites: unstable
+
+Mirror: full
+Upstream: fake
+Destination: %s
+Components: main
+Architectures: amd64
+Sources: yes
+`, t.TempDir())))
+	isok(t, err)
+
+	jobs, err := mirror.Load(config)
+	isok(t, err)
+	assert(t, len(jobs) == 1)
+	assert(t, jobs[0].Subset == nil)
+	assert(t, jobs[0].Sync.Sources)
+
+	config.Mirrors[0].SigningKey = "/etc/mirror/key.asc"
+	_, err = mirror.Load(config)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,214 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package pgp // import "pault.ag/go/debian/pgp"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+
+	"pault.ag/go/debian/control"
+)
+
+// Clearsigned {{{
+
+// Clearsigned is anything that has been read from a clearsigned document,
+// such as a control.ParagraphReader or control.Decoder.
+type Clearsigned interface {
+	Signature() []byte
+	SignedData() []byte
+}
+
+// Check the clearsign signature against the keyring, returning the Entity
+// that made it.
+func CheckClearsigned(signed Clearsigned, keyring openpgp.EntityList) (*openpgp.Entity, error) {
+	if signed.Signature() == nil {
+		return nil, fmt.Errorf("Paragraphs are not clearsigned")
+	}
+	return openpgp.CheckDetachedSignature(
+		keyring,
+		bytes.NewReader(signed.SignedData()),
+		bytes.NewReader(signed.Signature()),
+	)
+}
+
+// }}}
+
+// ParagraphReader {{{
+
+// A control.ParagraphReader that checks the signature on the Paragraphs.
+type ParagraphReader struct {
+	*control.ParagraphReader
+
+	signer *openpgp.Entity
+}
+
+// Create a new ParagraphReader from the given `io.Reader`, and `keyring`.
+// If the Paragraphs are clearsigned, the signature must have been made by
+// a key in the keyring, or an error is returned. Paragraphs that aren't
+// signed at all are read as they are, with no Signer.
+//
+// If `keyring` is set to `nil`, this will result in all OpenPGP signature
+// checking being disabled. *including* that the contents match! The
+// signature is kept, though, so it can still be checked with Verify.
+func NewParagraphReader(reader io.Reader, keyring *openpgp.EntityList) (*ParagraphReader, error) {
+	paragraphReader, err := control.NewParagraphReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	ret := ParagraphReader{ParagraphReader: paragraphReader}
+	if keyring != nil && ret.Signature() != nil {
+		if _, err := ret.Verify(*keyring); err != nil {
+			return nil, err
+		}
+	}
+	return &ret, nil
+}
+
+// Return the Entity (if one exists) that signed this set of Paragraphs.
+func (p *ParagraphReader) Signer() *openpgp.Entity {
+	return p.signer
+}
+
+// Check the clearsign signature against the keyring, for a ParagraphReader
+// that was created without one. On success, the Entity that signed the
+// Paragraphs is returned, and is the Signer from then on.
+func (p *ParagraphReader) Verify(keyring openpgp.EntityList) (*openpgp.Entity, error) {
+	signer, err := CheckClearsigned(p.ParagraphReader, keyring)
+	if err != nil {
+		return nil, err
+	}
+	p.signer = signer
+	return signer, nil
+}
+
+// }}}
+
+// Decoder {{{
+
+// A control.Decoder that checks the signature on what it decodes.
+type Decoder struct {
+	*control.Decoder
+
+	signer *openpgp.Entity
+}
+
+// Create a new Decoder, checking the signature against the keyring as for
+// NewParagraphReader.
+func NewDecoder(reader io.Reader, keyring *openpgp.EntityList) (*Decoder, error) {
+	decoder, err := control.NewDecoder(reader)
+	if err != nil {
+		return nil, err
+	}
+	ret := Decoder{Decoder: decoder}
+	if keyring != nil && ret.Signature() != nil {
+		if _, err := ret.Verify(*keyring); err != nil {
+			return nil, err
+		}
+	}
+	return &ret, nil
+}
+
+// Return the Entity (if one exists) that signed what's being decoded.
+func (d *Decoder) Signer() *openpgp.Entity {
+	return d.signer
+}
+
+// See ParagraphReader.Verify.
+func (d *Decoder) Verify(keyring openpgp.EntityList) (*openpgp.Entity, error) {
+	signer, err := CheckClearsigned(d.Decoder, keyring)
+	if err != nil {
+		return nil, err
+	}
+	d.signer = signer
+	return signer, nil
+}
+
+// }}}
+
+// Release {{{
+
+// Given an io.Reader of an InRelease file, check the signature against the
+// keyring, and return the parsed Release, and the Entity that signed it. If
+// the data is not signed by a key in the keyring (or not signed at all), an
+// error is returned.
+func ParseSignedRelease(reader io.Reader, keyring openpgp.EntityList) (*control.Release, *openpgp.Entity, error) {
+	decoder, err := NewDecoder(reader, &keyring)
+	if err != nil {
+		return nil, nil, err
+	}
+	ret := control.Release{}
+	if err := decoder.Decode(&ret); err != nil {
+		return nil, nil, err
+	}
+	if decoder.Signer() == nil {
+		return nil, nil, fmt.Errorf("Release file is not signed")
+	}
+	return &ret, decoder.Signer(), nil
+}
+
+// }}}
+
+// SignFile {{{
+
+// Clearsign the file at filename (such as the Filename of a control.Changes,
+// control.DSC or control.Buildinfo) in place, with the signer, whose
+// private key must already be decrypted. If it's already clearsigned, the
+// old signature is thrown away, and the text it covered is signed.
+func SignFile(filename string, signer *openpgp.Entity) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if block, _ := clearsign.Decode(data); block != nil {
+		data = block.Plaintext
+	}
+
+	out := bytes.Buffer{}
+	writer, err := clearsign.Encode(&out, signer.PrivateKey, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".new"
+	if err := os.WriteFile(tmp, out.Bytes(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,76 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package pgp // import "pault.ag/go/debian/pgp"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+
+	"pault.ag/go/debian/control"
+)
+
+// Paragraph signatures {{{
+
+// Write an armored detached signature over the Paragraph to the given
+// io.Writer, for storing in a sidecar file. The signer's private key must
+// already be decrypted.
+func DetachSignParagraph(w io.Writer, p *control.Paragraph, signer *openpgp.Entity) error {
+	return openpgp.ArmoredDetachSign(w, signer, bytes.NewReader(p.SignedData()), nil)
+}
+
+// Check an armored detached signature (as written by DetachSignParagraph)
+// over the Paragraph, returning the Entity that made it.
+func CheckParagraphSignature(p *control.Paragraph, signature io.Reader, keyring openpgp.EntityList) (*openpgp.Entity, error) {
+	return openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(p.SignedData()), signature)
+}
+
+// Sign the Paragraph, storing the armored signature in its
+// control.SignatureField, so each Paragraph in a file can be checked on
+// its own. Any existing signature is replaced.
+func SignParagraph(p *control.Paragraph, signer *openpgp.Entity) error {
+	signature := bytes.Buffer{}
+	if err := DetachSignParagraph(&signature, p, signer); err != nil {
+		return err
+	}
+	if p.Values == nil {
+		p.Values = map[string]string{}
+	}
+	p.Set(control.SignatureField, "\n"+strings.TrimSpace(signature.String()))
+	return nil
+}
+
+// Check the signature stored in the control.SignatureField of the
+// Paragraph, returning the Entity that made it.
+func VerifyParagraph(p *control.Paragraph, keyring openpgp.EntityList) (*openpgp.Entity, error) {
+	signature, ok := p.Values[control.SignatureField]
+	if !ok {
+		return nil, fmt.Errorf("Paragraph has no %s field", control.SignatureField)
+	}
+	return CheckParagraphSignature(p, strings.NewReader(strings.TrimSpace(signature)), keyring)
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,112 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package pgp_test
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/pgp"
+)
+
+/*
+ *
+ */
+
+func TestParagraphSign(t *testing.T) {
+	signer, err := openpgp.NewEntity("Test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	isok(t, err)
+	stranger, err := openpgp.NewEntity("Stranger", "", "stranger@example.com", &packet.Config{RSABits: 1024})
+	isok(t, err)
+
+	records, err := control.NewParagraphReader(strings.NewReader(`Name: first
+Depends: foo,
+ bar
+
+Name: second
+Description: multiple
+ lines
+`))
+	isok(t, err)
+	paragraphs, err := records.All()
+	isok(t, err)
+
+	out := bytes.Buffer{}
+	for i := range paragraphs {
+		isok(t, pgp.SignParagraph(&paragraphs[i], signer))
+		if i != 0 {
+			out.WriteString("\n")
+		}
+		isok(t, paragraphs[i].WriteTo(&out))
+	}
+
+	records, err = control.NewParagraphReader(bufio.NewReader(&out))
+	isok(t, err)
+	reread, err := records.All()
+	isok(t, err)
+	assert(t, len(reread) == 2)
+
+	for i := range reread {
+		entity, err := pgp.VerifyParagraph(&reread[i], openpgp.EntityList{signer})
+		isok(t, err)
+		assert(t, entity.PrimaryKey.KeyId == signer.PrimaryKey.KeyId)
+
+		_, err = pgp.VerifyParagraph(&reread[i], openpgp.EntityList{stranger})
+		notok(t, err)
+	}
+
+	reread[1].Set("Description", "tampered")
+	_, err = pgp.VerifyParagraph(&reread[1], openpgp.EntityList{signer})
+	notok(t, err)
+
+	unsigned := control.Paragraph{Values: map[string]string{"Name": "x"}, Order: []string{"Name"}}
+	_, err = pgp.VerifyParagraph(&unsigned, openpgp.EntityList{signer})
+	notok(t, err)
+}
+
+func TestParagraphDetachSign(t *testing.T) {
+	signer, err := openpgp.NewEntity("Test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	isok(t, err)
+
+	paragraph := control.Paragraph{Values: map[string]string{}, Order: []string{}}
+	paragraph.Set("Name", "record")
+	paragraph.Set("Value", "42")
+
+	sidecar := bytes.Buffer{}
+	isok(t, pgp.DetachSignParagraph(&sidecar, &paragraph, signer))
+	assert(t, strings.HasPrefix(sidecar.String(), "-----BEGIN PGP SIGNATURE-----"))
+
+	entity, err := pgp.CheckParagraphSignature(&paragraph, bytes.NewReader(sidecar.Bytes()), openpgp.EntityList{signer})
+	isok(t, err)
+	assert(t, entity.PrimaryKey.KeyId == signer.PrimaryKey.KeyId)
+
+	paragraph.Set("Value", "43")
+	_, err = pgp.CheckParagraphSignature(&paragraph, bytes.NewReader(sidecar.Bytes()), openpgp.EntityList{signer})
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
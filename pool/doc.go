@@ -0,0 +1,16 @@
+/*
+Manage the pool of an APT repository: the tree of .deb, .dsc and source
+files under pool/, laid out the way the Debian archive does it, as
+pool/<component>/<prefix>/<source>/<file> (such as
+pool/main/h/hello/hello_2.10-3_amd64.deb, or pool/main/libf/libfoo/...).
+
+Files are checked against any checksums given for them on the way in, and
+are deduplicated by SHA256: importing a file that's already in the pool
+somewhere else hardlinks the existing copy into place, rather than writing
+out another one. A file is never silently replaced with different content.
+
+ImportDeb and ImportDsc hand back the Packages (or Sources) entry for what
+was imported, with the Filename (or Directory) filled in relative to the
+top of the repository, ready for the indices; see package archive.
+*/
+package pool // import "pault.ag/go/debian/pool"
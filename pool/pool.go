@@ -0,0 +1,311 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package pool // import "pault.ag/go/debian/pool"
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"pault.ag/go/debian/archive"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/hashio"
+)
+
+// Paths {{{
+
+// Return the prefix of the pool directory a source package goes in: the
+// first letter of its name, or the first four for "lib" packages; "h" for
+// "hello", or "libf" for "libfoo".
+func Prefix(source string) string {
+	if strings.HasPrefix(source, "lib") && len(source) > 3 {
+		return source[:4]
+	}
+	if source == "" {
+		return ""
+	}
+	return source[:1]
+}
+
+// Return the directory of the pool the files of a source package (and the
+// binary packages built from it) go in, such as "pool/main/h/hello".
+func Dir(component, source string) string {
+	return path.Join("pool", component, Prefix(source), source)
+}
+
+// Return the Filename of a file of a source package in the pool, such as
+// "pool/main/h/hello/hello_2.10-3.dsc".
+func Path(component, source, name string) string {
+	return path.Join(Dir(component, source), name)
+}
+
+// }}}
+
+// Pool {{{
+
+// A Pool is the pool/ directory of the repository at Root, along with the
+// SHA256 of every file in it.
+type Pool struct {
+	Root string
+
+	files map[string]string
+}
+
+// Open the pool of the repository at root, hashing every file that's
+// already in it. The pool directory doesn't need to exist yet.
+func Open(root string) (*Pool, error) {
+	ret := Pool{Root: root, files: map[string]string{}}
+	err := filepath.WalkDir(filepath.Join(root, "pool"), func(pathname string, entry fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && pathname == filepath.Join(root, "pool") {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		sum, err := sha256File(pathname)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, pathname)
+		if err != nil {
+			return err
+		}
+		ret.remember(sum, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Return the Filename of a file in the pool with the given SHA256, if
+// there is one.
+func (p *Pool) Lookup(sha256 string) (string, bool) {
+	filename, ok := p.files[strings.ToLower(sha256)]
+	return filename, ok
+}
+
+func (p *Pool) remember(sha256, filename string) {
+	if _, ok := p.files[sha256]; !ok {
+		p.files[sha256] = filename
+	}
+}
+
+// }}}
+
+// Import {{{
+
+// Put the file at pathname into the pool as filename (as returned by
+// Path), having checked it against each of the hashes given. The Size of
+// a hash is checked too, unless it's 0.
+//
+// If there's already a file at filename, it must have the same content,
+// in which case nothing is done. If the same content is elsewhere in the
+// pool, it's hardlinked into place (or copied, if that fails).
+func (p *Pool) Import(filename, pathname string, hashes ...control.FileHash) error {
+	filename = path.Clean(filename)
+	if !strings.HasPrefix(filename, "pool/") || strings.Contains(filename, "/../") {
+		return fmt.Errorf("%s is not a path in the pool", filename)
+	}
+
+	sum, err := verify(pathname, hashes)
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(p.Root, filepath.FromSlash(filename))
+	if existing, err := sha256File(dest); err == nil {
+		if existing != sum {
+			return fmt.Errorf("%s is already in the pool, with different contents", filename)
+		}
+		p.remember(sum, filename)
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	from := pathname
+	if existing, ok := p.files[sum]; ok {
+		from = filepath.Join(p.Root, filepath.FromSlash(existing))
+		if err := os.Link(from, dest); err == nil {
+			return nil
+		}
+	}
+	if err := copyFile(from, dest); err != nil {
+		return err
+	}
+	p.remember(sum, filename)
+	return nil
+}
+
+// Import the .deb at pathname into the pool, under the directory of its
+// source package, with the name the archive would give it
+// (name_version_arch.deb, without any epoch). The Packages entry for it
+// is returned.
+func (p *Pool) ImportDeb(component, pathname string) (*control.BinaryIndex, error) {
+	debControl, err := deb.LoadControl(pathname)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf(
+		"%s_%s_%s.deb",
+		debControl.Package,
+		debControl.Version.StringWithoutEpoch(),
+		debControl.Architecture,
+	)
+	filename := Path(component, debControl.SourceName(), name)
+	if err := p.Import(filename, pathname); err != nil {
+		return nil, err
+	}
+	return archive.ScanDeb(p.Root, filepath.Join(p.Root, filepath.FromSlash(filename)))
+}
+
+// Import the .dsc at pathname, along with every file it lists (which must
+// match the checksums in the .dsc), into the pool. The Sources entry for
+// it is returned.
+func (p *Pool) ImportDsc(component, pathname string) (*control.SourceIndex, error) {
+	dsc, err := control.ParseDscFile(pathname)
+	if err != nil {
+		return nil, err
+	}
+	files, err := dsc.GetFiles()
+	if err != nil {
+		return nil, err
+	}
+	if dsc.Source == "" {
+		return nil, fmt.Errorf("%s: no Source", pathname)
+	}
+
+	dir := filepath.Dir(pathname)
+	for _, file := range files {
+		if file.Filename != path.Base(file.Filename) {
+			return nil, fmt.Errorf("%s: bad filename '%s'", pathname, file.Filename)
+		}
+		err := p.Import(
+			Path(component, dsc.Source, file.Filename),
+			filepath.Join(dir, file.Filename),
+			file,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	filename := Path(component, dsc.Source, filepath.Base(pathname))
+	if err := p.Import(filename, pathname); err != nil {
+		return nil, err
+	}
+	return archive.ScanDsc(p.Root, filepath.Join(p.Root, filepath.FromSlash(filename)))
+}
+
+// }}}
+
+// Helpers {{{
+
+// Read the file at pathname, checking it against the hashes, and return
+// its SHA256.
+func verify(pathname string, hashes []control.FileHash) (string, error) {
+	fd, err := os.Open(pathname)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	writers := []io.Writer{}
+	verifiers := []io.WriteCloser{}
+	for i := range hashes {
+		verifier, err := hashes[i].Verifier()
+		if err != nil {
+			return "", err
+		}
+		writers = append(writers, verifier)
+		verifiers = append(verifiers, verifier)
+	}
+	writer, hasher, err := hashio.NewHasherWriter("sha256", io.MultiWriter(writers...))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(writer, fd); err != nil {
+		return "", err
+	}
+
+	for i, verifier := range verifiers {
+		if err := verifier.Close(); err != nil {
+			return "", fmt.Errorf("%s: %s: %s", pathname, hashes[i].Algorithm, err)
+		}
+		if hashes[i].Size != 0 && hashes[i].Size != hasher.Size() {
+			return "", fmt.Errorf(
+				"%s: size mismatch: got %d, want %d",
+				pathname, hasher.Size(), hashes[i].Size,
+			)
+		}
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+func sha256File(pathname string) (string, error) {
+	return verify(pathname, nil)
+}
+
+// Copy from to a temporary file next to to, and rename it into place, so
+// that a half-written file never shows up in the pool.
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(to), "."+filepath.Base(to)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Chmod(0644); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), to)
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,212 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package pool_test
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/pool"
+	"pault.ag/go/debian/testsupport"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+// Write out a file, returning its path.
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	pathname := filepath.Join(dir, name)
+	isok(t, os.WriteFile(pathname, data, 0644))
+	return pathname
+}
+
+// Build the Deb fixture, returning the path to it.
+func buildDeb(t *testing.T, dir string, fixture testsupport.Deb) string {
+	data, err := fixture.Build()
+	isok(t, err)
+	name, err := fixture.Filename()
+	isok(t, err)
+	return writeFile(t, dir, name, data)
+}
+
+/*
+ *
+ */
+
+func TestPaths(t *testing.T) {
+	assert(t, pool.Prefix("hello") == "h")
+	assert(t, pool.Prefix("libfoo") == "libf")
+	assert(t, pool.Prefix("lib") == "l")
+	assert(t, pool.Dir("main", "libfoo") == "pool/main/libf/libfoo")
+	assert(t, pool.Path("contrib", "hello", "hello_1.0.dsc") == "pool/contrib/h/hello/hello_1.0.dsc")
+}
+
+func TestImportDeb(t *testing.T) {
+	root, incoming := t.TempDir(), t.TempDir()
+	p, err := pool.Open(root)
+	isok(t, err)
+
+	debPath := buildDeb(t, incoming, testsupport.Deb{
+		Package: "libhello1",
+		Source:  "hello",
+		Version: "1:2.10-1",
+	})
+	index, err := p.ImportDeb("main", debPath)
+	isok(t, err)
+	assert(t, index.Package == "libhello1")
+	assert(t, index.Filename == "pool/main/h/hello/libhello1_2.10-1_amd64.deb")
+	assert(t, len(index.SHA256) == 64)
+
+	filename, ok := p.Lookup(index.SHA256)
+	assert(t, ok)
+	assert(t, filename == index.Filename)
+
+	/* Importing it again is fine */
+	_, err = p.ImportDeb("main", debPath)
+	isok(t, err)
+
+	/* But importing something else over it isn't */
+	other := buildDeb(t, t.TempDir(), testsupport.Deb{
+		Package: "libhello1",
+		Source:  "hello",
+		Version: "1:2.10-1",
+		Files:   map[string]string{"usr/lib/libhello.so.1": "different"},
+	})
+	_, err = p.ImportDeb("main", other)
+	notok(t, err)
+}
+
+func TestImportDedupe(t *testing.T) {
+	root := t.TempDir()
+	p, err := pool.Open(root)
+	isok(t, err)
+
+	debPath := buildDeb(t, t.TempDir(), testsupport.Deb{Package: "hello", Version: "2.10-1"})
+	first, err := p.ImportDeb("main", debPath)
+	isok(t, err)
+	second, err := p.ImportDeb("contrib", debPath)
+	isok(t, err)
+	assert(t, second.Filename == "pool/contrib/h/hello/hello_2.10-1_amd64.deb")
+
+	one, err := os.Stat(filepath.Join(root, first.Filename))
+	isok(t, err)
+	two, err := os.Stat(filepath.Join(root, second.Filename))
+	isok(t, err)
+	assert(t, os.SameFile(one, two))
+
+	/* A freshly opened Pool finds what's already there */
+	p, err = pool.Open(root)
+	isok(t, err)
+	filename, ok := p.Lookup(first.SHA256)
+	assert(t, ok)
+	assert(t, filename == first.Filename || filename == second.Filename)
+}
+
+func TestImportVerify(t *testing.T) {
+	root, incoming := t.TempDir(), t.TempDir()
+	p, err := pool.Open(root)
+	isok(t, err)
+
+	pathname := writeFile(t, incoming, "hello_1.0.orig.tar.gz", []byte("not really a tarball"))
+	filename := pool.Path("main", "hello", "hello_1.0.orig.tar.gz")
+
+	notok(t, p.Import(filename, pathname, control.FileHash{
+		Algorithm: "sha256",
+		Hash:      "0000000000000000000000000000000000000000000000000000000000000000",
+	}))
+	_, err = os.Stat(filepath.Join(root, filename))
+	assert(t, os.IsNotExist(err))
+
+	notok(t, p.Import(filename, pathname, control.FileHash{
+		Algorithm: "md5",
+		Hash:      "a4d1df8b81d5ebbd3ec9e6e2f2ef3b7e",
+		Size:      1,
+	}))
+	notok(t, p.Import("dists/unstable/Release", pathname))
+	notok(t, p.Import("pool/../Release", pathname))
+
+	isok(t, p.Import(filename, pathname))
+	_, err = os.Stat(filepath.Join(root, filename))
+	isok(t, err)
+}
+
+func TestImportDsc(t *testing.T) {
+	root, incoming := t.TempDir(), t.TempDir()
+	p, err := pool.Open(root)
+	isok(t, err)
+
+	files, order, err := testsupport.Source{
+		Package:  "hello",
+		Version:  "2.10-1",
+		Files:    map[string]string{"debian/rules": "#!/usr/bin/make -f\n"},
+		Upstream: map[string]string{"hello.c": "int main() {}\n"},
+	}.Build()
+	isok(t, err)
+	for name, data := range files {
+		writeFile(t, incoming, name, data)
+	}
+
+	index, err := p.ImportDsc("main", filepath.Join(incoming, order[0]))
+	isok(t, err)
+	assert(t, index.Package == "hello")
+	assert(t, index.Directory == "pool/main/h/hello")
+	for _, name := range order {
+		_, err := os.Stat(filepath.Join(root, index.Directory, name))
+		isok(t, err)
+	}
+
+	/* A file that doesn't match the .dsc is refused */
+	root = t.TempDir()
+	p, err = pool.Open(root)
+	isok(t, err)
+	writeFile(t, incoming, order[1], []byte("corrupted"))
+	_, err = p.ImportDsc("main", filepath.Join(incoming, order[0]))
+	notok(t, err)
+	_, err = os.Stat(filepath.Join(root, "pool/main/h/hello", order[0]))
+	assert(t, os.IsNotExist(err))
+}
+
+// vim: foldmethod=marker
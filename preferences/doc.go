@@ -0,0 +1,14 @@
+/*
+Parse APT preferences (as in /etc/apt/preferences and
+/etc/apt/preferences.d/), and work out the pin priority of each version
+of a package, and which version APT would pick as the install candidate,
+following apt_preferences(5).
+
+	prefs, err := preferences.ParseFile("/etc/apt/preferences")
+	if err != nil {
+		panic(err)
+	}
+	origin := preferences.OriginFromRelease(release, "main", "deb.debian.org")
+	priority := prefs.Priority(preferences.CandidateFor(pkg, &origin))
+*/
+package preferences // import "pault.ag/go/debian/preferences"
@@ -0,0 +1,337 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package preferences // import "pault.ag/go/debian/preferences"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/version"
+)
+
+// Preference {{{
+
+// A Preference is a single stanza of an APT preferences file.
+//
+//	Package: firefox* src:thunderbird
+//	Pin: release a=unstable
+//	Pin-Priority: 900
+type Preference struct {
+	control.Paragraph
+
+	// Package names (or "src:" source package names) this stanza applies
+	// to, separated by spaces. Each may be a glob, or a /regex/. A single
+	// "*" makes this a general stanza, which applies to every package.
+	Package     string `required:"true"`
+	Pin         string `required:"true"`
+	PinPriority int    `control:"Pin-Priority" required:"true"`
+	Explanation string
+}
+
+// Return true if this stanza applies to every package ("Package: *").
+func (p Preference) IsGeneral() bool {
+	return strings.TrimSpace(p.Package) == "*"
+}
+
+// Return true if the stanza's Package field covers the Candidate.
+func (p Preference) matchesPackage(c Candidate) bool {
+	for _, name := range strings.Fields(p.Package) {
+		if source := strings.TrimPrefix(name, "src:"); source != name {
+			if c.Source != "" && match(source, c.Source) {
+				return true
+			}
+			continue
+		}
+		if match(name, c.Package) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return true if the stanza's Pin selects the Candidate.
+func (p Preference) matchesPin(c Candidate) (bool, error) {
+	kind, value, _ := strings.Cut(strings.TrimSpace(p.Pin), " ")
+	value = strings.TrimSpace(value)
+	switch kind {
+	case "version":
+		return match(value, c.Version.String()), nil
+	case "origin":
+		return c.Origin != nil && match(strings.Trim(value, `"`), c.Origin.Host), nil
+	case "release":
+		if c.Origin == nil {
+			return false, nil
+		}
+		return c.Origin.matchesRelease(value)
+	}
+	return false, fmt.Errorf("Unknown pin type: '%s'", p.Pin)
+}
+
+// }}}
+
+// Matching {{{
+
+// Match a value against a pattern from a preferences file, which may be a
+// glob, or a regular expression between slashes.
+func match(pattern, value string) bool {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		return err == nil && re.MatchString(value)
+	}
+	ok, err := path.Match(pattern, value)
+	return err == nil && ok
+}
+
+// }}}
+
+// Origin {{{
+
+// An Origin is where a Candidate can be fetched from: one component of a
+// suite, on a mirror.
+type Origin struct {
+	Origin       string // o=
+	Label        string // l=
+	Archive      string // a=, the Suite
+	Codename     string // n=
+	Version      string // v=
+	Component    string // c=
+	Architecture string // b=
+
+	// Hostname of the mirror, as used by "Pin: origin".
+	Host string
+
+	NotAutomatic         bool
+	ButAutomaticUpgrades bool
+}
+
+// Create an Origin for a component of the suite described by release,
+// fetched from host.
+func OriginFromRelease(release *control.Release, component, host string) Origin {
+	return Origin{
+		Origin:               release.Origin,
+		Label:                release.Label,
+		Archive:              release.Suite,
+		Codename:             release.Codename,
+		Version:              release.Version,
+		Component:            component,
+		Host:                 host,
+		NotAutomatic:         release.NotAutomatic,
+		ButAutomaticUpgrades: release.ButAutomaticUpgrades,
+	}
+}
+
+// Check the Origin against a release pin, such as "a=stable, c=main". As
+// with APT, a value without a key is taken as the version if it starts with
+// a digit, and the archive otherwise.
+func (o Origin) matchesRelease(pin string) (bool, error) {
+	for _, term := range strings.Split(pin, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(term, "=")
+		if !ok {
+			value = key
+			if value != "" && value[0] >= '0' && value[0] <= '9' {
+				key = "v"
+			} else {
+				key = "a"
+			}
+		}
+		var field string
+		switch key {
+		case "o":
+			field = o.Origin
+		case "l":
+			field = o.Label
+		case "a":
+			field = o.Archive
+		case "n":
+			field = o.Codename
+		case "v":
+			field = o.Version
+		case "c":
+			field = o.Component
+		case "b":
+			field = o.Architecture
+		default:
+			return false, fmt.Errorf("Unknown release pin key: '%s'", key)
+		}
+		if !match(strings.Trim(value, `"`), field) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// }}}
+
+// Candidate {{{
+
+// A Candidate is one version of a package, as found in one Origin (or
+// installed on the system, or both).
+type Candidate struct {
+	Package string
+	Source  string
+	Version version.Version
+
+	// Where the version can be fetched from. nil if it's only installed.
+	Origin *Origin
+	// This version is the one installed on the system.
+	Installed bool
+}
+
+// Create a Candidate for a package from an index, found in origin.
+func CandidateFor(pkg control.BinaryIndex, origin *Origin) Candidate {
+	return Candidate{
+		Package: pkg.Package,
+		Source:  pkg.SourcePackage(),
+		Version: pkg.Version,
+		Origin:  origin,
+	}
+}
+
+// }}}
+
+// Preferences {{{
+
+// Default pin priorities, as given in apt_preferences(5).
+const (
+	NotAutomaticPriority  = 1
+	InstalledPriority     = 100
+	DefaultPriority       = 500
+	TargetReleasePriority = 990
+)
+
+// Preferences is every stanza from the preferences files, in the order
+// APT reads them, along with the target release (APT::Default-Release),
+// if any.
+type Preferences struct {
+	Pins          []Preference
+	TargetRelease string
+}
+
+// Parse preferences from a reader.
+func Parse(reader io.Reader) (*Preferences, error) {
+	pins := []Preference{}
+	if err := control.Unmarshal(&pins, bufio.NewReader(reader)); err != nil {
+		return nil, err
+	}
+	for _, pin := range pins {
+		kind, _, _ := strings.Cut(strings.TrimSpace(pin.Pin), " ")
+		switch kind {
+		case "version", "release", "origin":
+		default:
+			return nil, fmt.Errorf("%s: unknown pin type: '%s'", pin.Package, pin.Pin)
+		}
+	}
+	return &Preferences{Pins: pins}, nil
+}
+
+// Parse a preferences file off the disk.
+func ParseFile(path string) (*Preferences, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Return the pin priority of the Candidate. The first stanza naming the
+// package that matches wins; then the first general stanza that matches;
+// and if none do, the priority is the default APT would give it.
+func (p *Preferences) Priority(c Candidate) int {
+	for _, general := range []bool{false, true} {
+		for _, pin := range p.Pins {
+			if pin.IsGeneral() != general || !pin.matchesPackage(c) {
+				continue
+			}
+			if ok, err := pin.matchesPin(c); err == nil && ok {
+				return pin.PinPriority
+			}
+		}
+	}
+	return p.defaultPriority(c)
+}
+
+func (p *Preferences) defaultPriority(c Candidate) int {
+	priority := 0
+	if c.Origin != nil {
+		switch {
+		case c.Origin.NotAutomatic && c.Origin.ButAutomaticUpgrades:
+			priority = InstalledPriority
+		case c.Origin.NotAutomatic:
+			priority = NotAutomaticPriority
+		case p.TargetRelease != "" && (c.Origin.Archive == p.TargetRelease || c.Origin.Codename == p.TargetRelease):
+			priority = TargetReleasePriority
+		default:
+			priority = DefaultPriority
+		}
+	}
+	if c.Installed && priority < InstalledPriority {
+		priority = InstalledPriority
+	}
+	return priority
+}
+
+// Pick the version APT would install out of the candidates (which should
+// all be versions of the same package, including the installed one, if
+// any): the one with the highest priority, and then the highest version.
+// A negative priority is never picked, and unless a pin is over 1000, the
+// installed version is never downgraded. false is returned if nothing can
+// be picked.
+func (p *Preferences) Select(candidates []Candidate) (Candidate, bool) {
+	var best *Candidate
+	bestPriority := 0
+	var installed *Candidate
+	for i, c := range candidates {
+		if c.Installed {
+			installed = &candidates[i]
+		}
+		priority := p.Priority(c)
+		if priority < 0 {
+			continue
+		}
+		if best == nil || priority > bestPriority ||
+			(priority == bestPriority && version.Compare(c.Version, best.Version) > 0) {
+			best = &candidates[i]
+			bestPriority = priority
+		}
+	}
+	if best == nil {
+		return Candidate{}, false
+	}
+	if installed != nil && bestPriority < 1000 && version.Compare(best.Version, installed.Version) < 0 {
+		return *installed, true
+	}
+	return *best, true
+}
+
+// }}}
+
+// vim: foldmethod=marker
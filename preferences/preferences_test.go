@@ -0,0 +1,157 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package preferences_test
+
+import (
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/preferences"
+	"pault.ag/go/debian/version"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// {{{ preferences file
+var preferencesFile = `Explanation: Keep the browser from unstable
+Package: firefox*
+Pin: release a=unstable
+Pin-Priority: 900
+
+Package: src:openssl
+Pin: version 3.0.*
+Pin-Priority: 1001
+
+Package: /^lib.*-dev$/
+Pin: origin "ppa.example.com"
+Pin-Priority: -1
+
+Package: *
+Pin: release o=Debian, n=sid
+Pin-Priority: 50
+`
+
+// }}}
+
+var (
+	bookworm  = preferences.Origin{Origin: "Debian", Archive: "stable", Codename: "bookworm", Component: "main", Host: "deb.debian.org"}
+	sid       = preferences.Origin{Origin: "Debian", Archive: "unstable", Codename: "sid", Component: "main", Host: "deb.debian.org"}
+	ppa       = preferences.Origin{Origin: "PPA", Archive: "stable", Host: "ppa.example.com"}
+	backports = preferences.Origin{Origin: "Debian", Archive: "stable-backports", Codename: "bookworm-backports",
+		NotAutomatic: true, ButAutomaticUpgrades: true}
+	experimental = preferences.Origin{Origin: "Debian", Archive: "experimental", NotAutomatic: true}
+)
+
+func candidate(name, source, ver string, origin *preferences.Origin) preferences.Candidate {
+	return preferences.Candidate{Package: name, Source: source, Version: version.MustParse(ver), Origin: origin}
+}
+
+func TestPriority(t *testing.T) {
+	prefs, err := preferences.Parse(strings.NewReader(preferencesFile))
+	isok(t, err)
+	assert(t, len(prefs.Pins) == 4)
+	assert(t, prefs.Pins[0].Explanation == "Keep the browser from unstable")
+
+	for _, el := range []struct {
+		candidate preferences.Candidate
+		priority  int
+	}{
+		{candidate("firefox-esr", "firefox-esr", "115.0-1", &sid), 900},
+		{candidate("firefox-esr", "firefox-esr", "102.0-1", &bookworm), 500},
+		{candidate("libssl3", "openssl", "3.0.11-1", &bookworm), 1001},
+		{candidate("libssl3", "openssl", "3.1.0-1", &sid), 50},
+		{candidate("libfoo-dev", "foo", "1.0", &ppa), -1},
+		{candidate("libfoo1", "foo", "1.0", &ppa), 500},
+		{candidate("hello", "hello", "2.10-3", &backports), 100},
+		{candidate("hello", "hello", "2.10-4", &experimental), 1},
+		{preferences.Candidate{Package: "hello", Version: version.MustParse("2.10-2"), Installed: true}, 100},
+	} {
+		assert(t, prefs.Priority(el.candidate) == el.priority)
+	}
+
+	prefs.TargetRelease = "bookworm"
+	assert(t, prefs.Priority(candidate("hello", "hello", "2.10-3", &bookworm)) == 990)
+}
+
+func TestSelect(t *testing.T) {
+	prefs, err := preferences.Parse(strings.NewReader(preferencesFile))
+	isok(t, err)
+
+	installed := preferences.Candidate{Package: "hello", Version: version.MustParse("2.11-1"), Installed: true}
+	candidates := []preferences.Candidate{
+		candidate("hello", "hello", "2.10-3", &bookworm),
+		candidate("hello", "hello", "2.12-1", &sid),
+		candidate("hello", "hello", "2.13-1", &experimental),
+	}
+
+	/* bookworm wins on priority, but won't downgrade what's installed */
+	best, ok := prefs.Select(candidates)
+	assert(t, ok && best.Version.String() == "2.10-3")
+	best, ok = prefs.Select(append(candidates, installed))
+	assert(t, ok && best.Installed)
+
+	/* A pin over 1000 can downgrade */
+	best, ok = prefs.Select([]preferences.Candidate{
+		candidate("libssl3", "openssl", "3.0.11-1", &bookworm),
+		{Package: "libssl3", Version: version.MustParse("3.1.0-1"), Installed: true},
+	})
+	assert(t, ok && best.Version.String() == "3.0.11-1")
+
+	_, ok = prefs.Select([]preferences.Candidate{candidate("libfoo-dev", "foo", "1.0", &ppa)})
+	assert(t, !ok)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := preferences.Parse(strings.NewReader("Package: foo\nPin: codename bookworm\nPin-Priority: 1\n"))
+	notok(t, err)
+	_, err = preferences.Parse(strings.NewReader("Package: foo\nPin: release a=stable\n"))
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,161 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package qa // import "pault.ag/go/debian/qa"
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"io"
+	"path"
+	"strings"
+
+	"pault.ag/go/debian/contents"
+	"pault.ag/go/debian/deb"
+)
+
+// Files {{{
+
+// Files is what each package in a suite ships, and which paths are
+// diverted (and by which package), as needed by CheckFileOverlaps.
+type Files struct {
+	// Package name to the paths it ships. Paths are absolute and clean,
+	// such as "/usr/bin/foo".
+	Packages map[string][]string
+
+	// Path to the package that diverts it with dpkg-divert. That package
+	// may ship the path alongside the package it diverts it from.
+	Diversions map[string]string
+}
+
+func NewFiles() *Files {
+	return &Files{
+		Packages:   map[string][]string{},
+		Diversions: map[string]string{},
+	}
+}
+
+// Turn "usr/bin/foo" or "./usr/bin/foo" into "/usr/bin/foo".
+func cleanPath(in string) string {
+	return path.Clean("/" + in)
+}
+
+// }}}
+
+// Contents {{{
+
+// Read a Contents index (such as dists/unstable/main/Contents-amd64, once
+// decompressed) into Files. Each line is a path, some whitespace, and a
+// comma separated list of the (section qualified) packages that ship it.
+//
+// Contents can't say anything about diversions, so Diversions is left
+// empty.
+func ReadContents(in io.Reader) (*Files, error) {
+	files := NewFiles()
+	reader := contents.NewReader(in)
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		pathname := cleanPath(entry.Path)
+		for _, name := range entry.Packages() {
+			files.Packages[name] = append(files.Packages[name], pathname)
+		}
+	}
+}
+
+// }}}
+
+// Debs {{{
+
+// Add the contents of a .deb to Files: every path in the data member
+// (other than directories), and any path diverted by dpkg-divert in the
+// maintainer scripts.
+func (f *Files) AddDeb(debFile *deb.Deb) error {
+	name := debFile.Control.Package
+
+	for {
+		hdr, err := debFile.Data.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		f.Packages[name] = append(f.Packages[name], cleanPath(hdr.Name))
+	}
+
+	scripts, err := debFile.MaintainerScripts()
+	if err != nil {
+		return err
+	}
+	for _, script := range scripts {
+		switch script.Name {
+		case "preinst", "postinst":
+			if err := f.addDiversions(name, bytes.NewReader(script.Data)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Look through a maintainer script for dpkg-divert invocations that add a
+// diversion. This is a heuristic, but catches the usual
+// "dpkg-divert --package foo --rename --add /usr/bin/bar".
+func (f *Files) addDiversions(name string, script io.Reader) error {
+	scanner := bufio.NewScanner(script)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		divert := false
+		skip := false
+		target := ""
+		for _, field := range fields {
+			field = strings.Trim(field, `"'`)
+			switch {
+			case skip:
+				/* The argument to an option, such as --divert's */
+				skip = false
+			case path.Base(field) == "dpkg-divert":
+				divert = true
+			case field == "--remove" || field == "--list":
+				divert = false
+			case field == "--divert" || field == "--package" || field == "--admindir" || field == "--instdir" || field == "--root":
+				skip = true
+			case divert && strings.HasPrefix(field, "/"):
+				target = field
+			}
+		}
+		if divert && target != "" {
+			f.Diversions[cleanPath(target)] = name
+		}
+	}
+	return scanner.Err()
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,118 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package qa_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/qa"
+)
+
+// Write out an uncompressed tar file with the given files in it.
+func tarball(t *testing.T, files map[string]string) []byte {
+	out := bytes.Buffer{}
+	w := tar.NewWriter(&out)
+	for name, content := range files {
+		isok(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content))}))
+		_, err := w.Write([]byte(content))
+		isok(t, err)
+	}
+	isok(t, w.Close())
+	return out.Bytes()
+}
+
+// Build (and load) a .deb with the given control and data members.
+func buildDeb(t *testing.T, control, data map[string]string) *deb.Deb {
+	out := bytes.Buffer{}
+	out.WriteString("!<arch>\n")
+	for _, member := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar", tarball(t, control)},
+		{"data.tar", tarball(t, data)},
+	} {
+		fmt.Fprintf(&out, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, 0, 0, 0, "100644", len(member.data))
+		out.Write(member.data)
+		if len(member.data)%2 == 1 {
+			out.WriteString("\n")
+		}
+	}
+	debFile, err := deb.Load(bytes.NewReader(out.Bytes()), "test.deb")
+	isok(t, err)
+	return debFile
+}
+
+// {{{ Contents fixture
+var contents = `This file maps each file available in the Debian GNU/Linux system to
+the package from which it originates.
+
+FILE                                                    LOCATION
+usr/bin/foo                                             utils/foo
+usr/share/doc/common file.txt                           doc/foo,doc/bar
+usr/lib/libbar.so.1                                     libs/bar
+`
+
+// }}}
+
+func TestReadContents(t *testing.T) {
+	files, err := qa.ReadContents(strings.NewReader(contents))
+	isok(t, err)
+	assert(t, len(files.Packages) == 2)
+	assert(t, len(files.Packages["foo"]) == 2)
+	assert(t, files.Packages["foo"][1] == "/usr/share/doc/common file.txt")
+	assert(t, files.Packages["bar"][0] == "/usr/share/doc/common file.txt")
+
+	problems := qa.CheckFileOverlaps(parse(t, "Package: foo\nVersion: 1.0\n\nPackage: bar\nVersion: 1.0\n"), files)
+	assert(t, len(problems) == 1)
+	assert(t, problems[0].Package == "bar" && problems[0].Related == "foo")
+	assert(t, problems[0].Paths[0] == "/usr/share/doc/common file.txt")
+}
+
+func TestAddDeb(t *testing.T) {
+	files := qa.NewFiles()
+	isok(t, files.AddDeb(buildDeb(t, map[string]string{
+		"./control": "Package: foo\nVersion: 1.0\nArchitecture: all\nMaintainer: Foo <foo@example.com>\nDescription: foo\n",
+		"./preinst": "#!/bin/sh\nset -e\ndpkg-divert --package foo --divert /usr/bin/bar.real --rename --add /usr/bin/bar\n",
+	}, map[string]string{
+		"./usr/bin/bar": "#!/bin/sh\n",
+	})))
+	isok(t, files.AddDeb(buildDeb(t, map[string]string{
+		"./control": "Package: bar\nVersion: 1.0\nArchitecture: all\nMaintainer: Bar <bar@example.com>\nDescription: bar\n",
+	}, map[string]string{
+		"./usr/bin/bar":   "#!/bin/sh\n",
+		"./usr/bin/other": "#!/bin/sh\n",
+	})))
+
+	assert(t, len(files.Packages["bar"]) == 2)
+	assert(t, files.Diversions["/usr/bin/bar"] == "foo")
+
+	problems := qa.CheckFileOverlaps(parse(t, "Package: foo\nVersion: 1.0\n\nPackage: bar\nVersion: 1.0\n"), files)
+	assert(t, len(problems) == 0)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,6 @@
+/*
+Archive QA checks over sets of binary packages, flagging the sort of
+packaging mistakes that are easy to make and painful for users to run into,
+such as taking over files from another package without declaring it.
+*/
+package qa // import "pault.ag/go/debian/qa"
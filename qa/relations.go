@@ -0,0 +1,245 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package qa // import "pault.ag/go/debian/qa"
+
+import (
+	"fmt"
+	"sort"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Problem {{{
+
+// Severity of a Problem. An Error is something that will break upgrades or
+// installs; a Warning is something that likely will, or is odd enough to
+// look at.
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// A Problem found with a package, or between two packages.
+type Problem struct {
+	Severity Severity
+	// Short, stable name of the check that found this, such as
+	// "replaces-without-breaks", to filter or suppress on.
+	Check   string
+	Package string
+	// The other package involved, if any.
+	Related string
+	Message string
+	// Paths involved, for problems to do with files.
+	Paths []string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", p.Severity, p.Package, p.Message, p.Check)
+}
+
+// }}}
+
+// Relationships {{{
+
+// Return the names of every package mentioned in a relationship field.
+func names(dep dependency.Dependency) map[string]bool {
+	ret := map[string]bool{}
+	for _, possi := range dep.GetAllPossibilities() {
+		ret[possi.Name] = true
+	}
+	return ret
+}
+
+// Check the relationship fields of a single package against each other:
+//
+//   - Replaces on a package, without a Breaks or Conflicts on it to make
+//     sure the old version is upgraded (or removed) first (policy 7.6.1).
+//   - Conflicts on a name that the package also Provides, without a
+//     Replaces on it, so that only one provider can be installed, but none
+//     of them can take over from another (policy 7.6.2).
+func CheckRelationships(pkg control.BinaryIndex) []Problem {
+	problems := []Problem{}
+
+	breaks := names(pkg.GetBreaks())
+	conflicts := names(pkg.GetConflicts())
+	provides := names(pkg.GetProvides())
+	replaces := names(pkg.GetReplaces())
+
+	for _, name := range sortedKeys(replaces) {
+		if breaks[name] || conflicts[name] || provides[name] {
+			continue
+		}
+		problems = append(problems, Problem{
+			Severity: Warning,
+			Check:    "replaces-without-breaks",
+			Package:  pkg.Package,
+			Related:  name,
+			Message:  fmt.Sprintf("Replaces %s without Breaks or Conflicts", name),
+		})
+	}
+
+	for _, name := range sortedKeys(conflicts) {
+		if !provides[name] || replaces[name] {
+			continue
+		}
+		problems = append(problems, Problem{
+			Severity: Warning,
+			Check:    "conflicts-with-provides",
+			Package:  pkg.Package,
+			Related:  name,
+			Message:  fmt.Sprintf("Conflicts with and Provides %s, but doesn't Replace it", name),
+		})
+	}
+
+	return problems
+}
+
+func sortedKeys(in map[string]bool) []string {
+	ret := []string{}
+	for key := range in {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// }}}
+
+// File overlaps {{{
+
+// Return true if pkg declares that it Replaces other, at the version of
+// other that we have.
+func replaces(pkg, other control.BinaryIndex) bool {
+	dep := pkg.GetReplaces()
+	for _, possi := range dep.GetAllPossibilities() {
+		if possi.Name != other.Package {
+			continue
+		}
+		if possi.SatisfiedBy(other.Version) {
+			return true
+		}
+	}
+	return false
+}
+
+// Look for paths shipped by more than one package, where neither package
+// Replaces the other (nor diverts the path), which dpkg will refuse to
+// unpack. Files can be read from a Contents index with ReadContents, or
+// built up from .deb files with AddDeb.
+func CheckFileOverlaps(packages []control.BinaryIndex, files *Files) []Problem {
+	byName := map[string]control.BinaryIndex{}
+	for _, pkg := range packages {
+		if current, ok := byName[pkg.Package]; ok && version.Compare(current.Version, pkg.Version) >= 0 {
+			continue
+		}
+		byName[pkg.Package] = pkg
+	}
+
+	owners := map[string][]string{}
+	for _, name := range sortedKeys(toSet(byName)) {
+		for _, path := range files.Packages[name] {
+			owners[path] = append(owners[path], name)
+		}
+	}
+
+	/* One Problem per pair of packages, listing the first path */
+	type pair struct{ a, b string }
+	shared := map[pair][]string{}
+	for path, names := range owners {
+		for i := 0; i < len(names); i++ {
+			for j := i + 1; j < len(names); j++ {
+				a, b := byName[names[i]], byName[names[j]]
+				if replaces(a, b) || replaces(b, a) {
+					continue
+				}
+				if diverter, ok := files.Diversions[path]; ok && (diverter == a.Package || diverter == b.Package) {
+					continue
+				}
+				key := pair{a.Package, b.Package}
+				shared[key] = append(shared[key], path)
+			}
+		}
+	}
+
+	problems := []Problem{}
+	for key, paths := range shared {
+		sort.Strings(paths)
+		message := fmt.Sprintf("Ships %s, as does %s", paths[0], key.b)
+		if len(paths) > 1 {
+			message = fmt.Sprintf("Ships %s (and %d other files), as does %s", paths[0], len(paths)-1, key.b)
+		}
+		problems = append(problems, Problem{
+			Severity: Error,
+			Check:    "file-overlap",
+			Package:  key.a,
+			Related:  key.b,
+			Message:  message,
+			Paths:    paths,
+		})
+	}
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Package != problems[j].Package {
+			return problems[i].Package < problems[j].Package
+		}
+		return problems[i].Related < problems[j].Related
+	})
+	return problems
+}
+
+func toSet(in map[string]control.BinaryIndex) map[string]bool {
+	ret := map[string]bool{}
+	for key := range in {
+		ret[key] = true
+	}
+	return ret
+}
+
+// }}}
+
+// CheckIndex {{{
+
+// Run every check over a set of packages, such as a Packages index. files
+// is as for CheckFileOverlaps, and may be nil to skip that check.
+func CheckIndex(packages []control.BinaryIndex, files *Files) []Problem {
+	problems := []Problem{}
+	for _, pkg := range packages {
+		problems = append(problems, CheckRelationships(pkg)...)
+	}
+	if files != nil {
+		problems = append(problems, CheckFileOverlaps(packages, files)...)
+	}
+	return problems
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,124 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package qa_test
+
+import (
+	"bufio"
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/qa"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+func parse(t *testing.T, in string) []control.BinaryIndex {
+	index, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(in)))
+	isok(t, err)
+	return index
+}
+
+/*
+ *
+ */
+
+// {{{ index fixture
+var packages = `Package: libfoo2
+Version: 2.0-1
+Replaces: libfoo1 (<< 2.0), libfoo-data
+Breaks: libfoo1 (<< 2.0)
+
+Package: libfoo1
+Version: 1.0-1
+
+Package: libfoo-data
+Version: 1.0-1
+
+Package: postfix
+Version: 3.7-1
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent
+Replaces: mail-transport-agent
+
+Package: exim4
+Version: 4.96-1
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent
+
+Package: other
+Version: 1.0-1
+`
+
+// }}}
+
+func TestCheckRelationships(t *testing.T) {
+	problems := qa.CheckIndex(parse(t, packages), nil)
+	assert(t, len(problems) == 2)
+
+	assert(t, problems[0].Package == "libfoo2")
+	assert(t, problems[0].Related == "libfoo-data")
+	assert(t, problems[0].Check == "replaces-without-breaks")
+
+	assert(t, problems[1].Package == "exim4")
+	assert(t, problems[1].Check == "conflicts-with-provides")
+	assert(t, problems[1].Severity == qa.Warning)
+}
+
+func TestCheckFileOverlaps(t *testing.T) {
+	files := qa.NewFiles()
+	files.Packages = map[string][]string{
+		"libfoo1":     {"/usr/lib/libfoo.so.1", "/usr/share/foo/data"},
+		"libfoo2":     {"/usr/lib/libfoo.so.2", "/usr/share/foo/data"},
+		"libfoo-data": {"/usr/share/foo/data"},
+		"postfix":     {"/usr/sbin/sendmail", "/usr/share/man/man8/sendmail.8.gz"},
+		"exim4":       {"/usr/sbin/sendmail", "/usr/share/man/man8/sendmail.8.gz"},
+		"other":       {"/usr/bin/other"},
+	}
+	problems := qa.CheckFileOverlaps(parse(t, packages), files)
+	assert(t, len(problems) == 2)
+
+	/* libfoo2 Replaces both others, which doesn't help libfoo1 vs
+	 * libfoo-data; postfix Replaces the virtual package, not exim4 */
+	assert(t, problems[0].Package == "exim4" && problems[0].Related == "postfix")
+	assert(t, problems[0].Severity == qa.Error)
+	assert(t, strings.Contains(problems[0].Message, "and 1 other files"))
+	assert(t, problems[1].Package == "libfoo-data" && problems[1].Related == "libfoo1")
+}
+
+// vim: foldmethod=marker
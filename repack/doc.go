@@ -0,0 +1,17 @@
+/*
+Repack upstream tarballs without the files Debian can't (or won't) ship,
+as mk-origtargz(1) does for uscan.
+
+What to remove usually comes from the Files-Excluded field of
+debian/copyright:
+
+	c, err := copyright.ParseFile("debian/copyright")
+	...
+	repacker := repack.FromCopyright(c, "+dfsg")
+	path, report, err := repacker.OrigTarball("hello-2.10.tar.gz", "..", "hello", "2.10")
+
+which writes ../hello_2.10+dfsg.orig.tar.xz, and lists what was taken out
+in the Report. If nothing matched, the original tarball is good as it is,
+and nothing is written.
+*/
+package repack // import "pault.ag/go/debian/repack"
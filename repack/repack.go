@@ -0,0 +1,250 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repack // import "pault.ag/go/debian/repack"
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/copyright"
+)
+
+// Repacker {{{
+
+// A Repacker rewrites tarballs without the paths it's told to exclude.
+type Repacker struct {
+	// Return true if the path, relative to the top of the source tree
+	// (such as "doc/manual.pdf"), should be removed. Everything under a
+	// removed directory goes with it.
+	Excluded func(pathname string) bool
+
+	// Added to the upstream version of a repacked tarball, such as
+	// "+dfsg" or "+ds". It may be empty.
+	Suffix string
+
+	// Extension of the compression to use for a repacked tarball, such
+	// as "gz". If empty, xz is used, as mk-origtargz does.
+	Compression string
+}
+
+// Return a Repacker removing anything matching the Files-Excluded
+// patterns of the copyright file, and marking the version with suffix.
+func FromCopyright(c *copyright.Copyright, suffix string) Repacker {
+	return Repacker{Excluded: c.Header.Excluded, Suffix: suffix}
+}
+
+// A Report says what a Repacker removed from a tarball, relative to the
+// top of the source tree, in the order they were in the tarball.
+type Report struct {
+	Removed []string
+}
+
+// Return true if anything was removed, so the tarball was changed.
+func (r Report) Repacked() bool {
+	return len(r.Removed) != 0
+}
+
+// Characters allowed in an upstream version, which has no epoch in a
+// filename, and a source package name, as in Debian Policy 5.6.
+var (
+	upstreamVersion = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+~-]*$`)
+	packageName     = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+)
+
+// Check that upstream is a valid upstream version. Upstream versions
+// usually come from upstream's web site, and end up in a filename such
+// as "hello_2.10.orig.tar.xz", so one like "1/../../evil" would otherwise
+// write outside of the directory it's meant to be in.
+func CheckUpstreamVersion(upstream string) error {
+	if !upstreamVersion.MatchString(upstream) {
+		return fmt.Errorf("Invalid upstream version '%s'", upstream)
+	}
+	return nil
+}
+
+// Return the upstream version with the Suffix on the end, unless it's
+// already there.
+func (r Repacker) Version(upstream string) string {
+	if strings.HasSuffix(upstream, r.Suffix) {
+		return upstream
+	}
+	return upstream + r.Suffix
+}
+
+func (r Repacker) compression() string {
+	if r.Compression == "" {
+		return "xz"
+	}
+	return r.Compression
+}
+
+// }}}
+
+// Repacking {{{
+
+// Open the tarball at pathname, whatever it's compressed with.
+func open(pathname string) (*tar.Reader, func(), error) {
+	f, err := os.Open(pathname)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := compression.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return tar.NewReader(r), func() { r.Close(); f.Close() }, nil
+}
+
+// Work out the directory every member of the tarball is in, if there's
+// just the one, such as "hello-2.10/", since what to exclude is given
+// relative to it.
+func topDirectory(pathname string) (string, error) {
+	tr, closer, err := open(pathname)
+	if err != nil {
+		return "", err
+	}
+	defer closer()
+
+	top := ""
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			if top == "" {
+				return "", nil
+			}
+			return top + "/", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		first, _, nested := strings.Cut(strings.TrimPrefix(hdr.Name, "./"), "/")
+		if !nested && hdr.Typeflag != tar.TypeDir {
+			return "", nil
+		}
+		if top != "" && first != top {
+			return "", nil
+		}
+		top = first
+	}
+}
+
+// Rewrite the tarball at src (compressed or not) to w, compressed as the
+// Repacker's Compression, leaving out everything Excluded.
+func (r Repacker) Repack(src string, w io.Writer) (*Report, error) {
+	compress, err := compression.CompressorFor(r.compression())
+	if err != nil {
+		return nil, err
+	}
+	top, err := topDirectory(src)
+	if err != nil {
+		return nil, err
+	}
+	tr, closer, err := open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	cw, err := compress(w)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(cw)
+	report := Report{Removed: []string{}}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(hdr.Name, "./"), top)
+		if name != "" && hdr.Typeflag != tar.TypeXGlobalHeader && r.Excluded(name) {
+			report.Removed = append(report.Removed, strings.TrimSuffix(name, "/"))
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Repack the upstream tarball at src into dir, as the .orig.tar of the
+// given source package, such as "hello_2.10+dfsg.orig.tar.xz", and
+// return its path. If nothing was Excluded, the original tarball will do,
+// so nothing is written, and the path returned is "". It's an error for
+// pkg or upstream not to be valid in a filename.
+func (r Repacker) OrigTarball(src, dir, pkg, upstream string) (string, *Report, error) {
+	if !packageName.MatchString(pkg) {
+		return "", nil, fmt.Errorf("Invalid source package name '%s'", pkg)
+	}
+	if err := CheckUpstreamVersion(r.Version(upstream)); err != nil {
+		return "", nil, err
+	}
+
+	out, err := os.CreateTemp(dir, ".repack-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.Remove(out.Name())
+
+	report, err := r.Repack(src, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if !report.Repacked() {
+		return "", report, nil
+	}
+
+	pathname := filepath.Join(dir, fmt.Sprintf("%s_%s.orig.tar.%s", pkg, r.Version(upstream), r.compression()))
+	if err := os.Rename(out.Name(), pathname); err != nil {
+		return "", nil, err
+	}
+	return pathname, report, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,206 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repack_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/copyright"
+	"pault.ag/go/debian/repack"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// Write a .tar.gz of the given members (directories end in "/") into
+// dir, returning its path.
+func writeTarball(t *testing.T, dir string, names ...string) string {
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		hdr := tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg}
+		body := "contents of " + name
+		if strings.HasSuffix(name, "/") {
+			hdr.Mode, hdr.Typeflag, body = 0755, tar.TypeDir, ""
+		}
+		hdr.Size = int64(len(body))
+		isok(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(body))
+		isok(t, err)
+	}
+	isok(t, tw.Close())
+	isok(t, gz.Close())
+
+	pathname := filepath.Join(dir, "upstream.tar.gz")
+	isok(t, os.WriteFile(pathname, buf.Bytes(), 0644))
+	return pathname
+}
+
+func members(t *testing.T, r io.Reader) string {
+	decompressed, err := compression.NewReader(r)
+	isok(t, err)
+	defer decompressed.Close()
+
+	names := []string{}
+	tr := tar.NewReader(decompressed)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return strings.Join(names, " ")
+		}
+		isok(t, err)
+		body, err := io.ReadAll(tr)
+		isok(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			assert(t, string(body) == "contents of "+hdr.Name)
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+func excluding(t *testing.T, patterns string) repack.Repacker {
+	c, err := copyright.Parse(strings.NewReader(
+		"Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/\n" +
+			"Files-Excluded: " + patterns + "\n"))
+	isok(t, err)
+	return repack.FromCopyright(c, "+dfsg")
+}
+
+func TestRepack(t *testing.T) {
+	src := writeTarball(t, t.TempDir(),
+		"hello-2.10/",
+		"hello-2.10/README",
+		"hello-2.10/vendor/",
+		"hello-2.10/vendor/lib.c",
+		"hello-2.10/doc/manual.pdf",
+		"hello-2.10/doc/manual.texi",
+	)
+
+	out := bytes.Buffer{}
+	report, err := excluding(t, "vendor *.pdf").Repack(src, &out)
+	isok(t, err)
+	assert(t, report.Repacked())
+	assert(t, strings.Join(report.Removed, " ") == "vendor vendor/lib.c doc/manual.pdf")
+	assert(t, compression.Sniff(out.Bytes()) == "xz")
+	assert(t, members(t, &out) == "hello-2.10/ hello-2.10/README hello-2.10/doc/manual.texi")
+}
+
+func TestRepackNoTopDirectory(t *testing.T) {
+	src := writeTarball(t, t.TempDir(), "README", "vendor/", "vendor/lib.c")
+
+	repacker := excluding(t, "vendor")
+	repacker.Compression = "gz"
+	out := bytes.Buffer{}
+	report, err := repacker.Repack(src, &out)
+	isok(t, err)
+	assert(t, strings.Join(report.Removed, " ") == "vendor vendor/lib.c")
+	assert(t, compression.Sniff(out.Bytes()) == "gz")
+	assert(t, members(t, &out) == "README")
+}
+
+func TestOrigTarball(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTarball(t, dir, "hello-2.10/", "hello-2.10/README", "hello-2.10/blob.bin")
+
+	repacker := excluding(t, "*.bin")
+	pathname, report, err := repacker.OrigTarball(src, dir, "hello", "2.10")
+	isok(t, err)
+	assert(t, pathname == filepath.Join(dir, "hello_2.10+dfsg.orig.tar.xz"))
+	assert(t, strings.Join(report.Removed, " ") == "blob.bin")
+
+	f, err := os.Open(pathname)
+	isok(t, err)
+	defer f.Close()
+	assert(t, members(t, f) == "hello-2.10/ hello-2.10/README")
+
+	/* Nothing to take out, so nothing's written */
+	pathname, report, err = excluding(t, "*.exe").OrigTarball(src, dir, "hello", "2.10")
+	isok(t, err)
+	assert(t, pathname == "")
+	assert(t, !report.Repacked())
+
+	entries, err := os.ReadDir(dir)
+	isok(t, err)
+	assert(t, len(entries) == 2)
+
+	/* Nothing outside dir is ever written */
+	_, _, err = repacker.OrigTarball(src, dir, "hello", "1/../../../evil")
+	notok(t, err)
+	_, _, err = repacker.OrigTarball(src, dir, "../hello", "2.10")
+	notok(t, err)
+	entries, err = os.ReadDir(dir)
+	isok(t, err)
+	assert(t, len(entries) == 2)
+}
+
+func TestCheckUpstreamVersion(t *testing.T) {
+	isok(t, repack.CheckUpstreamVersion("2.10"))
+	isok(t, repack.CheckUpstreamVersion("1.0~rc1+dfsg"))
+	notok(t, repack.CheckUpstreamVersion(""))
+	notok(t, repack.CheckUpstreamVersion("1:2.10"))
+	notok(t, repack.CheckUpstreamVersion("1/../evil"))
+	notok(t, repack.CheckUpstreamVersion("2.10 evil"))
+}
+
+func TestVersion(t *testing.T) {
+	repacker := repack.Repacker{Suffix: "+ds"}
+	assert(t, repacker.Version("2.10") == "2.10+ds")
+	assert(t, repacker.Version("2.10+ds") == "2.10+ds")
+	assert(t, repack.Repacker{}.Version("2.10") == "2.10")
+}
+
+// vim: foldmethod=marker
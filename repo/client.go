@@ -0,0 +1,359 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo // import "pault.ag/go/debian/repo"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/contents"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/pgp"
+)
+
+// Client {{{
+
+// A Client knows how to talk to a single suite of an APT repository, such as
+// "bookworm" on "https://deb.debian.org/debian".
+type Client struct {
+	Mirror string
+	Suite  string
+
+	// Keyring to check the InRelease signature against. If this is nil,
+	// signature checking is *disabled*, and the Release file is trusted as-is.
+	// Index files are always checked against the hashes in the Release file.
+	Keyring openpgp.EntityList
+
+	// If set, a Release that's past its Valid-Until date is accepted, as
+	// apt does with Check-Valid-Until set to no. Otherwise, it's an error,
+	// so an old (but correctly signed) InRelease can't be replayed to hold
+	// back updates.
+	AllowExpired bool
+
+	// HTTP client to use for all requests. If nil, http.DefaultClient
+	// is used.
+	HTTPClient *http.Client
+
+	// Transports for URI schemes, used in preference to any registered
+	// with RegisterTransport.
+	Transports map[string]Transport
+
+	// If set, limits how many files are fetched from each host at once, and
+	// how quickly. Share one Throttle between every Client using a mirror.
+	Throttle *Throttle
+
+	// If set, indices are downloaded in their own goroutine, up to this
+	// many bytes ahead of what's been parsed (see NewReadAhead), so the
+	// transfer and the parsing don't hold each other up. Either way,
+	// giving up on an index part way through (such as when the function
+	// given to Packages returns an error) stops its transfer.
+	ReadAhead int
+
+	releaseLock sync.Mutex
+	release     *control.Release
+}
+
+// Create a new Client for the given mirror URL and suite name.
+func New(mirror, suite string, keyring openpgp.EntityList) (*Client, error) {
+	if mirror == "" || suite == "" {
+		return nil, fmt.Errorf("Both a mirror and a suite are required")
+	}
+	return &Client{
+		Mirror:  strings.TrimSuffix(mirror, "/"),
+		Suite:   suite,
+		Keyring: keyring,
+	}, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Return the URL of a path relative to the root of the mirror.
+func (c *Client) URL(pathname string) string {
+	return c.Mirror + "/" + strings.TrimPrefix(pathname, "/")
+}
+
+// Return the path, relative to the mirror root, of a file in the suite's
+// dists directory.
+func (c *Client) distsPath(pathname string) string {
+	return path.Join("dists", c.Suite, pathname)
+}
+
+// }}}
+
+// Fetching {{{
+
+// Open the given path, relative to the mirror root, using the Transport
+// for the mirror's URI scheme. The caller must Close the returned
+// io.ReadCloser.
+func (c *Client) Open(pathname string) (io.ReadCloser, error) {
+	u, err := url.Parse(c.URL(pathname))
+	if err != nil {
+		return nil, err
+	}
+	transport, err := c.transport(u.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	if c.Throttle == nil {
+		return transport.Open(u)
+	}
+
+	release := c.Throttle.acquire(u.Host, priorityFor(pathname))
+	body, err := transport.Open(u)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &throttledReader{ReadCloser: body, throttle: c.Throttle, release: release}, nil
+}
+
+// }}}
+
+// Release {{{
+
+// Fetch, verify and parse the suite's InRelease file. The result is cached
+// on the Client, so subsequent calls will not hit the network.
+func (c *Client) Release() (*control.Release, error) {
+	c.releaseLock.Lock()
+	defer c.releaseLock.Unlock()
+	if c.release != nil {
+		return c.release, nil
+	}
+
+	body, err := c.Open(c.distsPath("InRelease"))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := c.ParseRelease(data)
+	if err != nil {
+		return nil, err
+	}
+
+	c.release = release
+	return release, nil
+}
+
+// Parse the data of the suite's InRelease file, checking it just as
+// Release does: the signature against the Keyring (if set), and that it
+// hasn't expired (unless AllowExpired is set).
+func (c *Client) ParseRelease(data []byte) (*control.Release, error) {
+	var release *control.Release
+	var err error
+	if c.Keyring == nil {
+		release, err = control.ParseRelease(bufioReader(data))
+	} else {
+		release, _, err = pgp.ParseSignedRelease(bytes.NewReader(data), c.Keyring)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !c.AllowExpired && release.Expired(time.Now()) {
+		return nil, fmt.Errorf(
+			"The Release for %s expired on %s",
+			c.Suite, release.ValidUntil.Format(time.RFC1123),
+		)
+	}
+	return release, nil
+}
+
+// }}}
+
+// Indices {{{
+
+// Compressed variants of an index, in order of preference. Variants with no
+// compression.Backend to read them are skipped.
+var indexExtensions = []string{".xz", ".gz", ".bz2", ".lzma", ".zst", ""}
+
+// Open an index file (such as "main/binary-amd64/Packages"), picking the
+// best compressed variant listed in the Release file, and return a reader
+// of the decompressed data. The raw data is checked against the Release
+// hashes as it is read; a mismatch is returned as an error from Read once
+// the end of the file is reached, so callers should not trust any data until
+// they have seen io.EOF.
+func (c *Client) OpenIndex(name string) (io.ReadCloser, error) {
+	release, err := c.Release()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ext := range indexExtensions {
+		decompress := compression.Decompressor(func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(r), nil
+		})
+		if ext != "" {
+			if decompress, err = compression.DecompressorFor(ext); err != nil {
+				continue
+			}
+		}
+
+		file, err := release.IndexFor(name + ext)
+		if err != nil {
+			continue
+		}
+		hash, err := file.BestHash()
+		if err != nil {
+			return nil, err
+		}
+
+		pathname := c.distsPath(file.Filename)
+		if release.AcquireByHash {
+			pathname = hash.ByHashPath(pathname)
+		}
+
+		body, err := c.Open(pathname)
+		if err != nil {
+			return nil, err
+		}
+		if c.ReadAhead > 0 {
+			body = NewReadAhead(body, c.ReadAhead)
+		}
+		verifying, err := newVerifyingReader(body, hash)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		reader, err := decompress(verifying)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		return &multiCloser{
+			Reader:  &drainingReader{reader: reader, raw: verifying},
+			closers: []io.Closer{reader, body},
+		}, nil
+	}
+	return nil, fmt.Errorf("'%s' is not listed in the Release for %s", name, c.Suite)
+}
+
+// Iterate over every entry in the Packages index of the given component
+// and architecture, in the order they appear in the index. If fn returns
+// an error, iteration stops and that error is returned.
+//
+// Entries are handed to fn as the index is read, before the index has been
+// checked against the Release (see OpenIndex), so they can't be trusted
+// until this returns nil. An index that doesn't match may not be noticed
+// until its end, after fn has already seen every entry in it.
+func (c *Client) Packages(component string, arch dependency.Arch, fn func(*control.BinaryIndex) error) error {
+	reader, err := c.OpenIndex(path.Join(component, "binary-"+arch.String(), "Packages"))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	decoder, err := control.NewDecoder(reader)
+	if err != nil {
+		return err
+	}
+	for {
+		entry := control.BinaryIndex{}
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+}
+
+// Iterate over every entry in the Sources index of the given component.
+// If fn returns an error, iteration stops and that error is returned.
+//
+// Entries are handed to fn as the index is read, before the index has been
+// checked against the Release (as for Packages), so they can't be trusted
+// until this returns nil.
+func (c *Client) Sources(component string, fn func(*control.SourceIndex) error) error {
+	reader, err := c.OpenIndex(path.Join(component, "source", "Sources"))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	decoder, err := control.NewDecoder(reader)
+	if err != nil {
+		return err
+	}
+	for {
+		entry := control.SourceIndex{}
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+}
+
+// Iterate over every entry in the Contents index of the given component
+// and architecture (such as main/Contents-amd64), as apt-file would. If fn
+// returns an error, iteration stops and that error is returned. As with
+// Packages, entries can't be trusted until this returns nil.
+func (c *Client) Contents(component string, arch dependency.Arch, fn func(*contents.Entry) error) error {
+	reader, err := c.OpenIndex(path.Join(component, "Contents-"+arch.String()))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	entries := contents.NewReader(reader)
+	for {
+		entry, err := entries.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,318 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pault.ag/go/debian/contents"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/repo"
+	"pault.ag/go/debian/testsupport"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+const testPackages = `Package: foo
+Version: 1.0-1
+Architecture: amd64
+Filename: pool/main/f/foo/foo_1.0-1_amd64.deb
+
+Package: bar
+Version: 2.0-1
+Architecture: all
+Depends: foo (>= 1.0)
+Filename: pool/main/b/bar/bar_2.0-1_all.deb
+`
+
+const testContents = `usr/bin/foo                                             utils/foo
+usr/share/doc/bar/README                                utils/bar,utils/foo
+`
+
+// The files of a fake mirror with a single suite, "test", holding
+// testPackages in main/binary-amd64, and testContents for them. If corrupt is set, the Packages file
+// does not match the hash in the Release file.
+func mirrorFiles(t *testing.T, corrupt bool) map[string][]byte {
+	compressed := bytes.Buffer{}
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(testPackages))
+	isok(t, err)
+	isok(t, writer.Close())
+	packagesGz := compressed.Bytes()
+
+	compressed = bytes.Buffer{}
+	writer = gzip.NewWriter(&compressed)
+	_, err = writer.Write([]byte(testContents))
+	isok(t, err)
+	isok(t, writer.Close())
+	contentsGz := compressed.Bytes()
+
+	release := fmt.Sprintf(`Suite: test
+Codename: test
+Architectures: amd64
+Components: main
+SHA256:
+ %x %d main/binary-amd64/Packages.gz
+ %x %d main/Contents-amd64.gz
+`, sha256.Sum256(packagesGz), len(packagesGz), sha256.Sum256(contentsGz), len(contentsGz))
+
+	if corrupt {
+		packagesGz = append([]byte{}, packagesGz...)
+		packagesGz[len(packagesGz)-1] ^= 0xFF
+	}
+
+	return map[string][]byte{
+		"dists/test/InRelease":                     []byte(release),
+		"dists/test/main/binary-amd64/Packages.gz": packagesGz,
+		"dists/test/main/Contents-amd64.gz":        contentsGz,
+	}
+}
+
+// Serve up the mirrorFiles over HTTP.
+func newMirror(t *testing.T, corrupt bool) *httptest.Server {
+	mux := http.NewServeMux()
+	for name, data := range mirrorFiles(t, corrupt) {
+		data := data
+		mux.HandleFunc("/"+name, func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		})
+	}
+	return httptest.NewServer(mux)
+}
+
+func TestClientPackages(t *testing.T) {
+	server := newMirror(t, false)
+	defer server.Close()
+
+	client, err := repo.New(server.URL, "test", nil)
+	isok(t, err)
+
+	release, err := client.Release()
+	isok(t, err)
+	assert(t, release.Suite == "test")
+
+	names := []string{}
+	isok(t, client.Packages("main", dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"},
+		func(pkg *control.BinaryIndex) error {
+			names = append(names, pkg.Package)
+			return nil
+		}))
+	assert(t, len(names) == 2)
+	assert(t, names[0] == "foo")
+	assert(t, names[1] == "bar")
+
+	notok(t, client.Sources("main", func(*control.SourceIndex) error { return nil }))
+}
+
+func TestClientContents(t *testing.T) {
+	server := newMirror(t, false)
+	defer server.Close()
+
+	client, err := repo.New(server.URL, "test", nil)
+	isok(t, err)
+
+	owners := map[string]string{}
+	isok(t, client.Contents("main", dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"},
+		func(entry *contents.Entry) error {
+			owners[entry.Path] = strings.Join(entry.Packages(), " ")
+			return nil
+		}))
+	assert(t, len(owners) == 2)
+	assert(t, owners["usr/bin/foo"] == "foo")
+	assert(t, owners["usr/share/doc/bar/README"] == "bar foo")
+
+	notok(t, client.Contents("contrib", dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"},
+		func(*contents.Entry) error { return nil }))
+}
+
+func TestClientCorruptIndex(t *testing.T) {
+	server := newMirror(t, true)
+	defer server.Close()
+
+	client, err := repo.New(server.URL, "test", nil)
+	isok(t, err)
+
+	err = client.Packages("main", dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"},
+		func(pkg *control.BinaryIndex) error { return nil })
+	notok(t, err)
+}
+
+func TestClientExpiredRelease(t *testing.T) {
+	signer, err := testsupport.NewSigner()
+	isok(t, err)
+	validUntil := testsupport.Epoch.Add(7 * 24 * time.Hour)
+	files, err := testsupport.Archive{
+		Signer:     signer,
+		ValidUntil: validUntil,
+		Sources:    map[string][]testsupport.Source{"main": {helloSource}},
+	}.Build()
+	isok(t, err)
+	server := httptest.NewServer(http.FileServer(http.FS(files)))
+	defer server.Close()
+
+	/* Correctly signed, but long past its Valid-Until */
+	client, err := repo.New(server.URL, "unstable", testsupport.Keyring(signer))
+	isok(t, err)
+	_, err = client.Release()
+	notok(t, err)
+	notok(t, client.Sources("main", func(*control.SourceIndex) error { return nil }))
+
+	client.AllowExpired = true
+	release, err := client.Release()
+	isok(t, err)
+	assert(t, release.ValidUntil.Equal(validUntil))
+	isok(t, client.Sources("main", func(*control.SourceIndex) error { return nil }))
+}
+
+func TestClientTransports(t *testing.T) {
+	amd64 := dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"}
+	files := mirrorFiles(t, false)
+
+	/* A local mirror, over file:// */
+	dir := t.TempDir()
+	for name, data := range files {
+		isok(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		isok(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+	client, err := repo.New("file://"+filepath.ToSlash(dir), "test", nil)
+	isok(t, err)
+	count := 0
+	isok(t, client.Packages("main", amd64, func(*control.BinaryIndex) error {
+		count++
+		return nil
+	}))
+	assert(t, count == 2)
+
+	/* A custom scheme, with data that doesn't match the Release file */
+	requested := []string{}
+	corrupt := mirrorFiles(t, true)
+	client, err = repo.New("mem://bucket/debian", "test", nil)
+	isok(t, err)
+	_, err = client.Release()
+	notok(t, err)
+
+	client.Transports = map[string]repo.Transport{
+		"mem": repo.TransportFunc(func(u *url.URL) (io.ReadCloser, error) {
+			requested = append(requested, u.Host+u.Path)
+			data, ok := corrupt[strings.TrimPrefix(u.Path, "/debian/")]
+			if !ok {
+				return nil, fmt.Errorf("%s: not found", u)
+			}
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}),
+	}
+	notok(t, client.Packages("main", amd64, func(*control.BinaryIndex) error { return nil }))
+	assert(t, len(requested) == 2)
+	assert(t, requested[0] == "bucket/debian/dists/test/InRelease")
+}
+
+func TestClientThrottle(t *testing.T) {
+	lock := sync.Mutex{}
+	requested := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requested = append(requested, r.URL.Path)
+		lock.Unlock()
+		w.Write(bytes.Repeat([]byte("x"), 30000))
+	}))
+	defer server.Close()
+
+	client, err := repo.New(server.URL, "test", nil)
+	isok(t, err)
+	client.Throttle = repo.NewThrottle(1, 0)
+
+	/* Hold the only connection, and queue a package before the metadata */
+	first, err := client.Open("pool/main/a.deb")
+	isok(t, err)
+	wg := sync.WaitGroup{}
+	for _, pathname := range []string{"pool/main/b.deb", "dists/test/InRelease"} {
+		wg.Add(1)
+		go func(pathname string) {
+			defer wg.Done()
+			body, err := client.Open(pathname)
+			if err == nil {
+				body.Close()
+			}
+		}(pathname)
+		time.Sleep(50 * time.Millisecond)
+	}
+	lock.Lock()
+	assert(t, len(requested) == 1)
+	lock.Unlock()
+	isok(t, first.Close())
+	wg.Wait()
+	assert(t, strings.Join(requested, " ") == "/pool/main/a.deb /dists/test/InRelease /pool/main/b.deb")
+
+	/* A second's worth of bytes comes straight away; the rest is paced */
+	client.Throttle = repo.NewThrottle(0, 20000)
+	start := time.Now()
+	body, err := client.Open("pool/main/a.deb")
+	isok(t, err)
+	data, err := io.ReadAll(body)
+	isok(t, err)
+	isok(t, body.Close())
+	assert(t, len(data) == 30000)
+	assert(t, time.Since(start) >= 400*time.Millisecond)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,243 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo // import "pault.ag/go/debian/repo"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+// Config {{{
+
+// An Upstream paragraph describes an APT repository to pull from.
+//
+//	Upstream: debian
+//	URI: https://deb.debian.org/debian
+//	Suites: bookworm bookworm-updates
+//	Keyring: /usr/share/keyrings/debian-archive-keyring.gpg
+//	Max-Connections: 4
+//	Rate-Limit: 1048576
+type UpstreamConfig struct {
+	control.Paragraph
+
+	Upstream string   `required:"true"`
+	URI      string   `required:"true"`
+	Suites   []string `required:"true"`
+
+	// Path to an OpenPGP keyring (armored or not) to check the InRelease
+	// files against. If empty, signatures are not checked.
+	Keyring string
+
+	// Accept InRelease files that are past their Valid-Until date, as for
+	// an archive that's no longer updated (see Client.AllowExpired).
+	AllowExpired bool `control:"Allow-Expired"`
+
+	// Files fetched from the mirror at once, and bytes per second read from
+	// it, across every Suite. Zero (or unset) means no limit.
+	MaxConnections int `control:"Max-Connections"`
+	RateLimit      int `control:"Rate-Limit"`
+}
+
+// A Mirror paragraph describes a repository to be written out, made up of
+// packages from one of the Upstreams. Without Seeds, every package in the
+// Components and Architectures is mirrored.
+//
+//	Mirror: airgap
+//	Upstream: debian
+//	Destination: /srv/mirror/airgap
+//	Components: main
+//	Architectures: amd64 arm64
+//	Seeds: openssh-server
+//	Signing-Key: /etc/mirror/airgap.asc
+//	Link: hardlink
+type MirrorConfig struct {
+	control.Paragraph
+
+	Mirror        string            `required:"true"`
+	Upstream      string            `required:"true"`
+	Destination   string            `required:"true"`
+	Components    []string          `required:"true"`
+	Architectures []dependency.Arch `required:"true"`
+	Seeds         []string
+	Recommends    bool
+	Sources       bool
+
+	// Path to an armored, unencrypted OpenPGP secret key to sign the
+	// InRelease file with.
+	SigningKey string `control:"Signing-Key"`
+
+	// How to place pool files that more than one Mirror shares; one of
+	// "copy", "hardlink" or "symlink". If empty, files are always
+	// downloaded.
+	Link string
+}
+
+// Config is a set of Upstreams, and the Mirrors to build from them. It's
+// written as a deb822 file, with one paragraph for each Upstream or Mirror.
+type Config struct {
+	Upstreams []UpstreamConfig
+	Mirrors   []MirrorConfig
+}
+
+// Return the Upstream with the given name, or nil.
+func (c *Config) Upstream(name string) *UpstreamConfig {
+	for i := range c.Upstreams {
+		if c.Upstreams[i].Upstream == name {
+			return &c.Upstreams[i]
+		}
+	}
+	return nil
+}
+
+// Create a Client for every Suite of the Upstream, loading the Keyring off
+// disk if one is set. If the Upstream has limits, the Clients share one
+// Throttle.
+func (u *UpstreamConfig) Clients() ([]*Client, error) {
+	var keyring openpgp.EntityList
+	if u.Keyring != "" {
+		var err error
+		if keyring, err = LoadKeyring(u.Keyring); err != nil {
+			return nil, err
+		}
+	}
+	var throttle *Throttle
+	if u.MaxConnections > 0 || u.RateLimit > 0 {
+		throttle = NewThrottle(u.MaxConnections, int64(u.RateLimit))
+	}
+	ret := []*Client{}
+	for _, suite := range u.Suites {
+		client, err := New(u.URI, suite, keyring)
+		if err != nil {
+			return nil, err
+		}
+		client.Throttle = throttle
+		client.AllowExpired = u.AllowExpired
+		ret = append(ret, client)
+	}
+	return ret, nil
+}
+
+// }}}
+
+// Parsing {{{
+
+// Given a path on the filesystem, parse the Config off the disk.
+func ParseConfigFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseConfig(f)
+}
+
+// Given an io.Reader, parse out a Config. Every Mirror must refer to an
+// Upstream defined in the same file.
+func ParseConfig(reader io.Reader) (*Config, error) {
+	paragraphReader, err := control.NewParagraphReader(bufio.NewReader(reader))
+	if err != nil {
+		return nil, err
+	}
+	paragraphs, err := paragraphReader.All()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := Config{}
+	for _, paragraph := range paragraphs {
+		switch {
+		case paragraph.Values["Mirror"] != "":
+			mirror := MirrorConfig{}
+			if err := control.UnpackFromParagraph(paragraph, &mirror); err != nil {
+				return nil, err
+			}
+			ret.Mirrors = append(ret.Mirrors, mirror)
+		case paragraph.Values["Upstream"] != "":
+			upstream := UpstreamConfig{}
+			if err := control.UnpackFromParagraph(paragraph, &upstream); err != nil {
+				return nil, err
+			}
+			if ret.Upstream(upstream.Upstream) != nil {
+				return nil, fmt.Errorf("Upstream '%s' is defined twice", upstream.Upstream)
+			}
+			ret.Upstreams = append(ret.Upstreams, upstream)
+		default:
+			return nil, fmt.Errorf("Paragraph is neither an Upstream nor a Mirror: %s", strings.Join(paragraph.Order, ", "))
+		}
+	}
+
+	for _, mirror := range ret.Mirrors {
+		if ret.Upstream(mirror.Upstream) == nil {
+			return nil, fmt.Errorf("Mirror '%s' uses unknown Upstream '%s'", mirror.Mirror, mirror.Upstream)
+		}
+	}
+	return &ret, nil
+}
+
+// }}}
+
+// Keys {{{
+
+// Load an OpenPGP keyring off the disk, in either armored or binary form.
+func LoadKeyring(path string) (openpgp.EntityList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	if header, _ := reader.Peek(5); string(header) == "-----" {
+		return openpgp.ReadArmoredKeyRing(reader)
+	}
+	return openpgp.ReadKeyRing(reader)
+}
+
+// Load a secret key to sign with off the disk. The private key must not be
+// encrypted.
+func LoadSigningKey(path string) (*openpgp.Entity, error) {
+	keyring, err := LoadKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entity := range keyring {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if entity.PrivateKey.Encrypted {
+			return nil, fmt.Errorf("%s: private key is encrypted", path)
+		}
+		return entity, nil
+	}
+	return nil, fmt.Errorf("%s: no private key found", path)
+}
+
+// }}}
+
+// vim: foldmethod=marker
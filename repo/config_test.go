@@ -0,0 +1,120 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"pault.ag/go/debian/repo"
+)
+
+// {{{ config file
+var configFile = `Upstream: debian
+URI: https://deb.debian.org/debian
+Suites: bookworm bookworm-updates
+Max-Connections: 2
+Allow-Expired: yes
+
+Mirror: airgap
+Upstream: debian
+Destination: /srv/mirror/airgap
+Components: main contrib
+Architectures: amd64 arm64
+Seeds: openssh-server
+Recommends: yes
+Link: hardlink
+`
+
+// }}}
+
+func TestParseConfig(t *testing.T) {
+	config, err := repo.ParseConfig(strings.NewReader(configFile))
+	isok(t, err)
+	assert(t, len(config.Upstreams) == 1)
+	assert(t, len(config.Mirrors) == 1)
+
+	mirror := config.Mirrors[0]
+	assert(t, mirror.Destination == "/srv/mirror/airgap")
+	assert(t, len(mirror.Architectures) == 2)
+	assert(t, mirror.Architectures[1].CPU == "arm64")
+	assert(t, mirror.Recommends)
+	assert(t, !mirror.Sources)
+
+	clients, err := config.Upstream(mirror.Upstream).Clients()
+	isok(t, err)
+	assert(t, len(clients) == 2)
+	assert(t, clients[1].Suite == "bookworm-updates")
+	assert(t, clients[1].Keyring == nil)
+	assert(t, clients[1].AllowExpired)
+	assert(t, clients[0].Throttle != nil && clients[0].Throttle == clients[1].Throttle)
+	assert(t, clients[0].Throttle.PerHost == 2)
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, el := range []string{
+		"Upstream: debian\nSuites: bookworm\n",
+		"Mirror: airgap\nUpstream: missing\nDestination: /srv\nComponents: main\nArchitectures: amd64\n",
+		"Upstream: a\nURI: http://a\nSuites: a\n\nUpstream: a\nURI: http://b\nSuites: b\n",
+		"Foo: bar\n",
+	} {
+		_, err := repo.ParseConfig(strings.NewReader(el))
+		notok(t, err)
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	isok(t, err)
+	dir := t.TempDir()
+
+	secret, err := os.Create(filepath.Join(dir, "secret.asc"))
+	isok(t, err)
+	w, err := armor.Encode(secret, openpgp.PrivateKeyType, nil)
+	isok(t, err)
+	isok(t, entity.SerializePrivate(w, nil))
+	isok(t, w.Close())
+	isok(t, secret.Close())
+
+	public, err := os.Create(filepath.Join(dir, "public.gpg"))
+	isok(t, err)
+	isok(t, entity.Serialize(public))
+	isok(t, public.Close())
+
+	signer, err := repo.LoadSigningKey(filepath.Join(dir, "secret.asc"))
+	isok(t, err)
+	assert(t, signer.PrimaryKey.KeyId == entity.PrimaryKey.KeyId)
+
+	keyring, err := repo.LoadKeyring(filepath.Join(dir, "public.gpg"))
+	isok(t, err)
+	assert(t, len(keyring) == 1)
+
+	_, err = repo.LoadSigningKey(filepath.Join(dir, "public.gpg"))
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,32 @@
+/*
+Fetch and iterate over the indices of an APT repository.
+
+A Client is pointed at a mirror and a suite, and will download and verify the
+InRelease file, and then fetch the (compressed) Packages and Sources indices
+it lists, checking every byte against the hashes in the Release file, and
+hand back each entry as a control.BinaryIndex or control.SourceIndex.
+
+	client, err := repo.New("https://deb.debian.org/debian", "bookworm", keyring)
+	if err != nil {
+		panic(err)
+	}
+	err = client.Packages("main", arch, func(pkg *control.BinaryIndex) error {
+		log.Printf("%s %s", pkg.Package, pkg.Version)
+		return nil
+	})
+
+Tools after a handful of packages can use PackagesNamed and SourcesNamed,
+which only fetch the per-name shards of an index where the repository
+publishes them.
+
+Entries are handed over as the index arrives, rather than once it's all been
+downloaded; set ReadAhead on the Client to download in the background while
+entries are being parsed. Returning an error from the function stops the
+download there.
+
+Mirrors are fetched over HTTP(S), or from "file://" URIs. Other schemes (such
+as "s3://") can be supported by registering a Transport with
+RegisterTransport, or setting one on the Client; whatever it returns goes
+through the same verification as anything fetched over HTTP.
+*/
+package repo // import "pault.ag/go/debian/repo"
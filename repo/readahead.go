@@ -0,0 +1,125 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo // import "pault.ag/go/debian/repo"
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ReadAhead {{{
+
+// How much is read from the source at a time.
+const readAheadChunk = 32 * 1024
+
+type readAhead struct {
+	src     io.ReadCloser
+	chunks  chan []byte
+	err     error
+	current []byte
+
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Read src in its own goroutine, keeping up to about size bytes of it
+// buffered ahead of whatever is reading the returned io.ReadCloser. That
+// lets a download carry on while what's already arrived is decompressed
+// and parsed, but once the buffer is full, the download waits for the
+// reader to catch up, so a slow parser never has a whole index in memory.
+//
+// Closing the returned io.ReadCloser closes src, which (for an HTTP
+// response) stops the transfer, even if it's waiting on the network.
+func NewReadAhead(src io.ReadCloser, size int) io.ReadCloser {
+	chunks := size / readAheadChunk
+	if chunks < 1 {
+		chunks = 1
+	}
+	r := &readAhead{
+		src:    src,
+		chunks: make(chan []byte, chunks),
+		done:   make(chan struct{}),
+	}
+	go r.fill()
+	return r
+}
+
+func (r *readAhead) fill() {
+	defer close(r.chunks)
+	for {
+		buf := make([]byte, readAheadChunk)
+		n, err := r.src.Read(buf)
+		if n > 0 {
+			select {
+			case r.chunks <- buf[:n]:
+			case <-r.done:
+				return
+			}
+		}
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			/* Written before chunks is closed, so Read will see it */
+			r.err = err
+			return
+		}
+	}
+}
+
+func (r *readAhead) Read(p []byte) (int, error) {
+	select {
+	case <-r.done:
+		return 0, fmt.Errorf("Read from a closed download")
+	default:
+	}
+	if len(r.current) == 0 {
+		select {
+		case <-r.done:
+			return 0, fmt.Errorf("Read from a closed download")
+		case chunk, ok := <-r.chunks:
+			if !ok {
+				if r.err != nil {
+					return 0, r.err
+				}
+				return 0, io.EOF
+			}
+			r.current = chunk
+		}
+	}
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	return n, nil
+}
+
+// Stop reading ahead, and close the source.
+func (r *readAhead) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.closeErr = r.src.Close()
+	})
+	return r.closeErr
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,168 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/repo"
+)
+
+/*
+ *
+ */
+
+// An endless source of zeros, keeping count of how much was read.
+type countingSource struct {
+	lock   sync.Mutex
+	read   int
+	closed bool
+}
+
+func (c *countingSource) Read(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return 0, fmt.Errorf("closed")
+	}
+	c.read += len(p)
+	return len(p), nil
+}
+
+func (c *countingSource) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *countingSource) count() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.read
+}
+
+func TestReadAheadBackpressure(t *testing.T) {
+	src := &countingSource{}
+	reader := repo.NewReadAhead(src, 64*1024)
+
+	/* Nothing's reading, so it has to stop once the buffer's full: two
+	 * chunks queued, and a third waiting to be */
+	time.Sleep(50 * time.Millisecond)
+	assert(t, src.count() <= 3*32*1024)
+
+	buf := make([]byte, 10)
+	n, err := reader.Read(buf)
+	isok(t, err)
+	assert(t, n == 10)
+
+	isok(t, reader.Close())
+	assert(t, src.closed)
+	_, err = reader.Read(buf)
+	notok(t, err)
+}
+
+type failingSource struct {
+	io.Reader
+}
+
+func (f failingSource) Read(p []byte) (int, error) {
+	n, err := f.Reader.Read(p)
+	if err == io.EOF {
+		return n, fmt.Errorf("connection reset")
+	}
+	return n, err
+}
+
+func (f failingSource) Close() error { return nil }
+
+func TestReadAheadContents(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+	got, err := io.ReadAll(repo.NewReadAhead(io.NopCloser(bytes.NewReader(data)), 1))
+	isok(t, err)
+	assert(t, bytes.Equal(got, data))
+
+	got, err = io.ReadAll(repo.NewReadAhead(failingSource{bytes.NewReader(data)}, 64*1024))
+	notok(t, err)
+	assert(t, err.Error() == "connection reset")
+	assert(t, bytes.Equal(got, data))
+}
+
+func TestClientReadAheadAbort(t *testing.T) {
+	/* Plenty of packages, only the first half of which ever arrive */
+	index := strings.Builder{}
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&index, "Package: pkg%d\nVersion: 1.0\nArchitecture: amd64\n\n", i)
+	}
+	packages := []byte(index.String())
+	release := fmt.Sprintf("Suite: test\nArchitectures: amd64\nComponents: main\nSHA256:\n %x %d main/binary-amd64/Packages\n",
+		sha256.Sum256(packages), len(packages))
+
+	aborted := make(chan bool, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dists/test/InRelease", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(release))
+	})
+	mux.HandleFunc("/dists/test/main/binary-amd64/Packages", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(packages[:len(packages)/2])
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+			aborted <- true
+		case <-time.After(10 * time.Second):
+			aborted <- false
+			w.Write(packages[len(packages)/2:])
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := repo.New(server.URL, "test", nil)
+	isok(t, err)
+	client.ReadAhead = 64 * 1024
+
+	seen := 0
+	err = client.Packages("main", dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"},
+		func(pkg *control.BinaryIndex) error {
+			seen++
+			if pkg.Package == "pkg10" {
+				return fmt.Errorf("Enough")
+			}
+			return nil
+		})
+	notok(t, err)
+	assert(t, err.Error() == "Enough")
+	assert(t, seen == 11)
+	assert(t, <-aborted)
+}
+
+// vim: foldmethod=marker
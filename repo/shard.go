@@ -0,0 +1,186 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo // import "pault.ag/go/debian/repo"
+
+import (
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+// Shards {{{
+
+// Return the shard of a sharded index (see PackagesNamed) that a package
+// name falls in: the first letter of the name, or the first four for
+// "lib" packages, as in the pool; "f" for "foo", or "libf" for "libfoo1".
+func ShardFor(name string) string {
+	if strings.HasPrefix(name, "lib") && len(name) > 3 {
+		return name[:4]
+	}
+	if name == "" {
+		return ""
+	}
+	return name[:1]
+}
+
+// Return the path of the shard of an index (such as
+// "main/binary-amd64/Packages") that the named package would be in.
+func ShardPath(index, name string) string {
+	dir, file := path.Split(index)
+	return path.Join(dir, "by-name", ShardFor(name), file)
+}
+
+// Return true if the Release lists the index, in any form we can read.
+func (c *Client) hasIndex(name string) (bool, error) {
+	release, err := c.Release()
+	if err != nil {
+		return false, err
+	}
+	for _, ext := range indexExtensions {
+		if ext != "" {
+			if _, err := compression.DecompressorFor(ext); err != nil {
+				continue
+			}
+		}
+		if _, err := release.IndexFor(name + ext); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Call fn with every paragraph of the index whose Package field is one of
+// names, reading just the shards those names fall in, where the
+// repository publishes them, and the full index (once) otherwise.
+func (c *Client) namedParagraphs(index string, names []string, fn func(control.Paragraph) error) error {
+	shards := map[string]map[string]bool{}
+	for _, name := range names {
+		shard := ShardPath(index, name)
+		if shards[shard] == nil {
+			shards[shard] = map[string]bool{}
+		}
+		shards[shard][name] = true
+	}
+	paths := []string{}
+	for shard := range shards {
+		paths = append(paths, shard)
+	}
+	sort.Strings(paths)
+
+	/* Names in shards that aren't published have to come out of the full
+	 * index, but there's no sense reading that more than once. */
+	rest := map[string]bool{}
+	for _, shard := range paths {
+		ok, err := c.hasIndex(shard)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			for name := range shards[shard] {
+				rest[name] = true
+			}
+			continue
+		}
+		if err := c.scanIndex(shard, shards[shard], fn); err != nil {
+			return err
+		}
+	}
+	if len(rest) == 0 {
+		return nil
+	}
+	return c.scanIndex(index, rest, fn)
+}
+
+func (c *Client) scanIndex(index string, names map[string]bool, fn func(control.Paragraph) error) error {
+	reader, err := c.OpenIndex(index)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	paragraphs, err := control.NewParagraphReader(reader)
+	if err != nil {
+		return err
+	}
+	for {
+		para, err := paragraphs.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		/* Only bother decoding the entries that were asked for */
+		if !names[para.Values["Package"]] {
+			continue
+		}
+		if err := fn(*para); err != nil {
+			return err
+		}
+	}
+}
+
+// }}}
+
+// Named Packages and Sources {{{
+
+// Iterate over the entries in the Packages index of the given component
+// and architecture for the named binary packages. Names with no entry in
+// the index are skipped.
+//
+// Some repositories split their indices by package name, as well as by
+// component and architecture, with each shard beside the full index, as
+// "main/binary-amd64/by-name/libf/Packages" (see ShardFor and ShardPath),
+// listed in the Release file like any other index. Where those are
+// published, only the shards the names fall in are fetched, rather than
+// the whole index, which is what's fetched otherwise.
+func (c *Client) PackagesNamed(component string, arch dependency.Arch, names []string, fn func(*control.BinaryIndex) error) error {
+	index := path.Join(component, "binary-"+arch.String(), "Packages")
+	return c.namedParagraphs(index, names, func(para control.Paragraph) error {
+		entry := control.BinaryIndex{}
+		if err := control.UnpackFromParagraph(para, &entry); err != nil {
+			return err
+		}
+		return fn(&entry)
+	})
+}
+
+// Iterate over the entries in the Sources index of the given component for
+// the named source packages, as Sources, but fetching only the shards of
+// the index they fall in where the repository publishes them.
+func (c *Client) SourcesNamed(component string, names []string, fn func(*control.SourceIndex) error) error {
+	index := path.Join(component, "source", "Sources")
+	return c.namedParagraphs(index, names, func(para control.Paragraph) error {
+		entry := control.SourceIndex{}
+		if err := control.UnpackFromParagraph(para, &entry); err != nil {
+			return err
+		}
+		return fn(&entry)
+	})
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,133 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/repo"
+)
+
+/*
+ *
+ */
+
+func TestShardPath(t *testing.T) {
+	assert(t, repo.ShardFor("foo") == "f")
+	assert(t, repo.ShardFor("libfoo1") == "libf")
+	assert(t, repo.ShardFor("lib") == "l")
+	assert(t, repo.ShardPath("main/binary-amd64/Packages", "libc6") ==
+		"main/binary-amd64/by-name/libc/Packages")
+}
+
+// A mirror like newMirror's, which also publishes the "f" shard of the
+// Packages index (but no others). Every path requested is recorded.
+func newShardedMirror(t *testing.T, requested *[]string) *httptest.Server {
+	gz := func(data string) []byte {
+		compressed := bytes.Buffer{}
+		writer := gzip.NewWriter(&compressed)
+		_, err := writer.Write([]byte(data))
+		isok(t, err)
+		isok(t, writer.Close())
+		return compressed.Bytes()
+	}
+	packagesGz := gz(testPackages)
+	shardGz := gz(testPackages[:strings.Index(testPackages, "\n\n")+1])
+
+	files := map[string][]byte{
+		"dists/test/InRelease": []byte(fmt.Sprintf(`Suite: test
+Architectures: amd64
+Components: main
+SHA256:
+ %x %d main/binary-amd64/Packages.gz
+ %x %d main/binary-amd64/by-name/f/Packages.gz
+`, sha256.Sum256(packagesGz), len(packagesGz), sha256.Sum256(shardGz), len(shardGz))),
+		"dists/test/main/binary-amd64/Packages.gz":           packagesGz,
+		"dists/test/main/binary-amd64/by-name/f/Packages.gz": shardGz,
+	}
+
+	lock := sync.Mutex{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		*requested = append(*requested, r.URL.Path)
+		lock.Unlock()
+		data, ok := files[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+}
+
+func TestClientPackagesNamed(t *testing.T) {
+	amd64 := dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"}
+	requested := []string{}
+	server := newShardedMirror(t, &requested)
+	defer server.Close()
+
+	client, err := repo.New(server.URL, "test", nil)
+	isok(t, err)
+
+	/* foo is in a published shard, so the full index is never fetched */
+	names := []string{}
+	isok(t, client.PackagesNamed("main", amd64, []string{"foo", "fnord"},
+		func(pkg *control.BinaryIndex) error {
+			names = append(names, pkg.Package)
+			return nil
+		}))
+	assert(t, len(names) == 1)
+	assert(t, names[0] == "foo")
+	assert(t, len(requested) == 2)
+	assert(t, requested[1] == "/dists/test/main/binary-amd64/by-name/f/Packages.gz")
+
+	/* bar's shard isn't published, so that falls back to the full index,
+	 * after the shards that are */
+	names = []string{}
+	requested = []string{}
+	isok(t, client.PackagesNamed("main", amd64, []string{"bar", "baz", "foo"},
+		func(pkg *control.BinaryIndex) error {
+			names = append(names, pkg.Package)
+			return nil
+		}))
+	assert(t, len(names) == 2)
+	assert(t, names[0] == "foo")
+	assert(t, names[1] == "bar")
+	assert(t, len(requested) == 2)
+	assert(t, requested[1] == "/dists/test/main/binary-amd64/Packages.gz")
+
+	/* With neither shards nor a full index, there's nothing to fall back to */
+	notok(t, client.SourcesNamed("main", []string{"foo"}, func(*control.SourceIndex) error {
+		return nil
+	}))
+}
+
+// vim: foldmethod=marker
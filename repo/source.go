@@ -0,0 +1,126 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo // import "pault.ag/go/debian/repo"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/pgp"
+)
+
+// Source packages {{{
+
+// Download the .dsc at the given path (relative to the mirror root), and
+// every file it lists, from the same directory, into dir, as dget(1)
+// does. Each file is checked against the strongest hashes in the .dsc.
+// If the Client has a Keyring, the .dsc has to be signed by a key in it.
+//
+// The .dsc is returned, with its Filename set to where it was written, so
+// it's ready for source.Unpack.
+func (c *Client) DownloadSource(pathname, dir string) (*control.DSC, error) {
+	body, err := c.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var keyring *openpgp.EntityList
+	if c.Keyring != nil {
+		keyring = &c.Keyring
+	}
+	decoder, err := pgp.NewDecoder(bytes.NewReader(data), keyring)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", pathname, err)
+	}
+	dsc := control.DSC{}
+	if err := decoder.Decode(&dsc); err != nil {
+		return nil, fmt.Errorf("%s: %s", pathname, err)
+	}
+	if c.Keyring != nil && decoder.Signer() == nil {
+		return nil, fmt.Errorf("%s: not signed", pathname)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	dsc.Filename, err = filepath.Abs(filepath.Join(dir, path.Base(pathname)))
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := dsc.GetFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.Filename != path.Base(file.Filename) {
+			return nil, fmt.Errorf("%s: bad filename '%s'", pathname, file.Filename)
+		}
+		remote := path.Join(path.Dir(pathname), file.Filename)
+		if err := c.Download(remote, file, filepath.Join(dir, file.Filename)); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(dsc.Filename, data, 0644); err != nil {
+		return nil, err
+	}
+	return &dsc, nil
+}
+
+// Download a source package from the mirror, as DownloadSource does,
+// given its entry in the Sources index.
+func (c *Client) DownloadSourceIndex(src *control.SourceIndex, dir string) (*control.DSC, error) {
+	for _, file := range src.Files {
+		if strings.HasSuffix(file.Filename, ".dsc") {
+			return c.DownloadSource(path.Join(src.Directory, file.Filename), dir)
+		}
+	}
+	return nil, fmt.Errorf("%s has no .dsc", src.Package)
+}
+
+// Download the .dsc at the given URL, and every file it lists, into dir,
+// as Client.DownloadSource does. If keyring is nil, the signature on the
+// .dsc isn't checked.
+func DownloadSource(dscURL, dir string, keyring openpgp.EntityList) (*control.DSC, error) {
+	slash := strings.LastIndex(dscURL, "/")
+	if slash < 0 {
+		return nil, fmt.Errorf("'%s' isn't a URL", dscURL)
+	}
+	c := Client{Mirror: dscURL[:slash], Keyring: keyring}
+	return c.DownloadSource(dscURL[slash+1:], dir)
+}
+
+// }}}
+
+// vim: foldmethod=marker
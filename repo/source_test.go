@@ -0,0 +1,141 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/repo"
+	"pault.ag/go/debian/testsupport"
+)
+
+/*
+ *
+ */
+
+var helloSource = testsupport.Source{
+	Package:  "hello",
+	Version:  "2.10-3",
+	Upstream: map[string]string{"hello.c": "int main(void) { return 0; }\n"},
+	Files:    map[string]string{"debian/rules": "#!/usr/bin/make -f\n"},
+}
+
+// Serve an archive with the source package in pool/main/h/hello, with
+// the .dsc clearsigned by signer, if it's set.
+func sourceMirror(t *testing.T, signer *openpgp.Entity) *httptest.Server {
+	archiveSigner, err := testsupport.NewSigner()
+	isok(t, err)
+	files, err := testsupport.Archive{
+		Signer:  archiveSigner,
+		Sources: map[string][]testsupport.Source{"main": {helloSource}},
+	}.Build()
+	isok(t, err)
+
+	if signer != nil {
+		dsc := files["pool/main/h/hello/hello_2.10-3.dsc"]
+		signed := bytes.Buffer{}
+		w, err := clearsign.Encode(&signed, signer.PrivateKey, nil)
+		isok(t, err)
+		_, err = w.Write(dsc.Data)
+		isok(t, err)
+		isok(t, w.Close())
+		files["pool/main/h/hello/hello_2.10-3.dsc"] = &fstest.MapFile{Data: signed.Bytes()}
+	}
+
+	server := httptest.NewServer(http.FileServer(http.FS(files)))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadSource(t *testing.T) {
+	server := sourceMirror(t, nil)
+	client, err := repo.New(server.URL, "unstable", nil)
+	isok(t, err)
+
+	sources := []*control.SourceIndex{}
+	isok(t, client.Sources("main", func(src *control.SourceIndex) error {
+		sources = append(sources, src)
+		return nil
+	}))
+	assert(t, len(sources) == 1)
+
+	dir := t.TempDir()
+	dsc, err := client.DownloadSourceIndex(sources[0], dir)
+	isok(t, err)
+	assert(t, dsc.Source == "hello")
+	assert(t, dsc.Filename == filepath.Join(dir, "hello_2.10-3.dsc"))
+	isok(t, dsc.VerifyFiles())
+
+	for _, name := range []string{"hello_2.10-3.dsc", "hello_2.10.orig.tar.gz", "hello_2.10-3.debian.tar.gz"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		isok(t, err)
+	}
+}
+
+func TestDownloadSourceURL(t *testing.T) {
+	signer, err := testsupport.NewSigner()
+	isok(t, err)
+	other, err := testsupport.NewSigner()
+	isok(t, err)
+	server := sourceMirror(t, signer)
+	dscURL := server.URL + "/pool/main/h/hello/hello_2.10-3.dsc"
+
+	dsc, err := repo.DownloadSource(dscURL, t.TempDir(), testsupport.Keyring(signer))
+	isok(t, err)
+	assert(t, dsc.Version.String() == "2.10-3")
+
+	/* Signed by someone else */
+	_, err = repo.DownloadSource(dscURL, t.TempDir(), testsupport.Keyring(other))
+	notok(t, err)
+
+	/* Not signed at all */
+	unsigned := sourceMirror(t, nil)
+	_, err = repo.DownloadSource(unsigned.URL+"/pool/main/h/hello/hello_2.10-3.dsc", t.TempDir(), testsupport.Keyring(signer))
+	notok(t, err)
+}
+
+func TestDownloadSourceCorrupt(t *testing.T) {
+	files, err := testsupport.Archive{
+		Sources: map[string][]testsupport.Source{"main": {helloSource}},
+	}.Build()
+	isok(t, err)
+	files["pool/main/h/hello/hello_2.10.orig.tar.gz"] = &fstest.MapFile{Data: []byte("corrupt")}
+	server := httptest.NewServer(http.FileServer(http.FS(files)))
+	defer server.Close()
+
+	dir := t.TempDir()
+	_, err = repo.DownloadSource(server.URL+"/pool/main/h/hello/hello_2.10-3.dsc", dir, nil)
+	notok(t, err)
+	_, err = os.Stat(filepath.Join(dir, "hello_2.10.orig.tar.gz"))
+	assert(t, os.IsNotExist(err))
+}
+
+// vim: foldmethod=marker
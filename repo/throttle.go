@@ -0,0 +1,189 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo // import "pault.ag/go/debian/repo"
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority {{{
+
+// Priority decides which waiting request gets the next free connection to
+// a host. Lower values go first.
+type Priority int
+
+const (
+	// InRelease and the indices; a sync can't go anywhere without them.
+	MetadataPriority Priority = iota
+	// Everything else, such as .deb files in the pool.
+	PackagePriority
+)
+
+// Anything under dists/ is metadata, everything else is a package.
+func priorityFor(pathname string) Priority {
+	if strings.HasPrefix(strings.TrimPrefix(pathname, "/"), "dists/") {
+		return MetadataPriority
+	}
+	return PackagePriority
+}
+
+// }}}
+
+// Throttle {{{
+
+// A Throttle limits how hard Clients lean on mirrors: how many files may
+// be fetched from each host at once, and how many bytes per second may be
+// read across every host. The same Throttle may (and usually should) be
+// shared by every Client talking to the same mirror, and is safe to use
+// from many goroutines.
+//
+// When a host has no free connections, requests wait, and metadata is
+// handed the next free connection before any package.
+type Throttle struct {
+	// Connections allowed to each host at once. Zero means no limit.
+	PerHost int
+	// Bytes per second read across every host. Zero means no limit.
+	BytesPerSecond int64
+
+	lock   sync.Mutex
+	hosts  map[string]*hostSlots
+	tokens float64
+	last   time.Time
+}
+
+// Create a new Throttle. Either limit may be zero, for no limit.
+func NewThrottle(perHost int, bytesPerSecond int64) *Throttle {
+	return &Throttle{PerHost: perHost, BytesPerSecond: bytesPerSecond}
+}
+
+type hostSlots struct {
+	active  int
+	waiting [PackagePriority + 1][]chan struct{}
+}
+
+// Wait for a connection to host, and return the function to call to give
+// it back.
+func (t *Throttle) acquire(host string, priority Priority) func() {
+	if t.PerHost <= 0 {
+		return func() {}
+	}
+	if priority < MetadataPriority || priority > PackagePriority {
+		priority = PackagePriority
+	}
+
+	t.lock.Lock()
+	if t.hosts == nil {
+		t.hosts = map[string]*hostSlots{}
+	}
+	slots, ok := t.hosts[host]
+	if !ok {
+		slots = &hostSlots{}
+		t.hosts[host] = slots
+	}
+	if slots.active < t.PerHost {
+		slots.active++
+		t.lock.Unlock()
+		return func() { t.release(slots) }
+	}
+	ready := make(chan struct{})
+	slots.waiting[priority] = append(slots.waiting[priority], ready)
+	t.lock.Unlock()
+
+	<-ready
+	return func() { t.release(slots) }
+}
+
+// Hand the connection to the most important waiting request, if there is
+// one; otherwise, free it up.
+func (t *Throttle) release(slots *hostSlots) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for priority := range slots.waiting {
+		if len(slots.waiting[priority]) == 0 {
+			continue
+		}
+		next := slots.waiting[priority][0]
+		slots.waiting[priority] = slots.waiting[priority][1:]
+		close(next)
+		return
+	}
+	slots.active--
+}
+
+// Account for n bytes having been read, sleeping if that puts us over the
+// rate limit. Up to a second's worth of bytes may be read in a burst.
+func (t *Throttle) wait(n int) {
+	if t.BytesPerSecond <= 0 || n <= 0 {
+		return
+	}
+	rate := float64(t.BytesPerSecond)
+
+	t.lock.Lock()
+	now := time.Now()
+	if t.last.IsZero() {
+		t.tokens = rate
+	} else {
+		t.tokens += now.Sub(t.last).Seconds() * rate
+		if t.tokens > rate {
+			t.tokens = rate
+		}
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	debt := t.tokens
+	t.lock.Unlock()
+
+	if debt < 0 {
+		time.Sleep(time.Duration(-debt / rate * float64(time.Second)))
+	}
+}
+
+// }}}
+
+// Throttled reader {{{
+
+// Reads through the Throttle's rate limit, and gives the connection back
+// when Closed.
+type throttledReader struct {
+	io.ReadCloser
+	throttle *Throttle
+	release  func()
+	once     sync.Once
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.throttle.wait(n)
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,118 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo // import "pault.ag/go/debian/repo"
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// Transport {{{
+
+// A Transport fetches files for a URI scheme, such as "s3" or "oci". The
+// Client only ever asks a Transport for the raw bytes; everything it hands
+// back is checked against the Release file (and the Release file against
+// the Keyring), exactly as if it had come over HTTP.
+type Transport interface {
+	// Open the file at the given URL. The caller must Close the returned
+	// io.ReadCloser. A file that doesn't exist should be an error.
+	Open(u *url.URL) (io.ReadCloser, error)
+}
+
+// An ordinary function that can be used as a Transport.
+type TransportFunc func(u *url.URL) (io.ReadCloser, error)
+
+func (fn TransportFunc) Open(u *url.URL) (io.ReadCloser, error) {
+	return fn(u)
+}
+
+// }}}
+
+// Registry {{{
+
+var (
+	transportsLock sync.RWMutex
+	transports     = map[string]Transport{
+		"file": TransportFunc(openFile),
+	}
+)
+
+// Register a Transport for every Client to use for URIs with the given
+// scheme, replacing any Transport already registered for it. This is
+// usually called from an init function. "http" and "https" are handled by
+// each Client's HTTPClient, unless a Transport is registered for them.
+func RegisterTransport(scheme string, transport Transport) {
+	transportsLock.Lock()
+	defer transportsLock.Unlock()
+	transports[scheme] = transport
+}
+
+// Return the Transport to use for a scheme: the Client's own, then the
+// registered ones, and finally HTTP.
+func (c *Client) transport(scheme string) (Transport, error) {
+	if transport, ok := c.Transports[scheme]; ok {
+		return transport, nil
+	}
+	transportsLock.RLock()
+	transport, ok := transports[scheme]
+	transportsLock.RUnlock()
+	if ok {
+		return transport, nil
+	}
+	switch scheme {
+	case "http", "https":
+		return httpTransport{client: c.httpClient()}, nil
+	}
+	return nil, fmt.Errorf("No transport for URI scheme '%s'", scheme)
+}
+
+// }}}
+
+// Built in transports {{{
+
+type httpTransport struct {
+	client *http.Client
+}
+
+func (t httpTransport) Open(u *url.URL) (io.ReadCloser, error) {
+	resp, err := t.client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// A mirror on the local filesystem, such as "file:///srv/mirror/debian".
+func openFile(u *url.URL) (io.ReadCloser, error) {
+	return os.Open(u.Path)
+}
+
+// }}}
+
+// vim: foldmethod=marker
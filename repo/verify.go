@@ -0,0 +1,125 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package repo // import "pault.ag/go/debian/repo"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"pault.ag/go/debian/control"
+)
+
+// verifyingReader {{{
+
+// verifyingReader passes data through from the underlying reader, and
+// checks the size and hash of what went by once EOF is hit.
+type verifyingReader struct {
+	reader   io.Reader
+	verifier io.WriteCloser
+	hash     control.FileHash
+	read     int64
+	err      error
+}
+
+func newVerifyingReader(reader io.Reader, hash control.FileHash) (*verifyingReader, error) {
+	verifier, err := hash.Verifier()
+	if err != nil {
+		return nil, err
+	}
+	return &verifyingReader{reader: reader, verifier: verifier, hash: hash}, nil
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.reader.Read(p)
+	v.read += int64(n)
+	v.verifier.Write(p[:n])
+
+	if v.read > v.hash.Size {
+		v.err = fmt.Errorf("%s: more than the expected %d bytes", v.hash.Filename, v.hash.Size)
+		return n, v.err
+	}
+	if err == io.EOF {
+		if v.read != v.hash.Size {
+			v.err = fmt.Errorf("%s: got %d bytes, expected %d", v.hash.Filename, v.read, v.hash.Size)
+			return n, v.err
+		}
+		if cerr := v.verifier.Close(); cerr != nil {
+			v.err = fmt.Errorf("%s: %s", v.hash.Filename, cerr)
+			return n, v.err
+		}
+	}
+	return n, err
+}
+
+// }}}
+
+// drainingReader {{{
+
+// Decompressors are free to stop reading before the end of the compressed
+// stream, so once the decompressed data is done, the rest of the raw data
+// is drained through the verifyingReader to make sure the hash is checked.
+type drainingReader struct {
+	reader io.Reader
+	raw    *verifyingReader
+}
+
+func (d *drainingReader) Read(p []byte) (int, error) {
+	n, err := d.reader.Read(p)
+	if err == io.EOF {
+		if _, derr := io.Copy(ioutil.Discard, d.raw); derr != nil {
+			return n, derr
+		}
+	}
+	return n, err
+}
+
+// }}}
+
+// multiCloser {{{
+
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *multiCloser) Close() error {
+	var ret error
+	for _, closer := range m.closers {
+		if err := closer.Close(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+// }}}
+
+func bufioReader(data []byte) *bufio.Reader {
+	return bufio.NewReader(bytes.NewReader(data))
+}
+
+// vim: foldmethod=marker
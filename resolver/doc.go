@@ -0,0 +1,19 @@
+/*
+Model the set of operations a dependency resolver hands to dpkg, and reason
+about what running them would do.
+
+A Plan is an ordered list of Steps (install, upgrade, remove or purge a
+single package). Nothing in this package touches the running system, it only
+describes what would happen.
+
+A Solver works out the Plan that carries out a Request (such as "install
+hello"), given the packages available and what's installed, respecting
+Depends, Pre-Depends, Conflicts and Breaks, and explaining itself when
+there's no way to do it. Order then splits a Plan into the batches dpkg
+has to run it in.
+
+CheckHolds holds a Plan up against dpkg's selections, refusing one that
+changes a package on hold, as apt would. To have the Solver leave held
+packages alone in the first place, set Solver.Selections.
+*/
+package resolver // import "pault.ag/go/debian/resolver"
@@ -0,0 +1,79 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package resolver // import "pault.ag/go/debian/resolver"
+
+import (
+	"fmt"
+	"strings"
+
+	"pault.ag/go/debian/dpkg"
+)
+
+// Holds {{{
+
+// HoldError is returned by CheckHolds when a Plan would change packages
+// that are on hold. Steps are the offending Steps, in Plan order.
+type HoldError struct {
+	Steps []Step
+}
+
+func (e *HoldError) Error() string {
+	names := []string{}
+	for _, step := range e.Steps {
+		names = append(names, step.Package)
+	}
+	return fmt.Sprintf("Held packages would be changed: %s", strings.Join(names, ", "))
+}
+
+// The name to look the Step's package up in dpkg.Selections with,
+// qualified with its architecture if it has one.
+func selectionName(step Step) string {
+	if arch := step.Architecture.String(); arch != "" {
+		return step.Package + ":" + arch
+	}
+	return step.Package
+}
+
+// Check a Plan doesn't change any package on hold, returning a *HoldError
+// listing the Steps that do, the way apt refuses to go ahead without
+// --allow-change-held-packages. Like apt, only holds are taken into
+// account; deinstall and purge selections are only acted on by
+// dselect-upgrade.
+//
+// There's no leaving out the held Steps and going ahead with the rest,
+// since what's left may well not hang together; to plan around holds,
+// set Solver.Selections instead.
+func CheckHolds(plan Plan, selections dpkg.Selections) error {
+	held := []Step{}
+	for _, step := range plan.Steps {
+		if selections.IsHeld(selectionName(step)) {
+			held = append(held, step)
+		}
+	}
+	if len(held) > 0 {
+		return &HoldError{Steps: held}
+	}
+	return nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
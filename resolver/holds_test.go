@@ -0,0 +1,61 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package resolver_test
+
+import (
+	"testing"
+
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/dpkg"
+	"pault.ag/go/debian/resolver"
+)
+
+/*
+ *
+ */
+
+func TestHolds(t *testing.T) {
+	plan := resolver.Plan{Steps: []resolver.Step{
+		{Action: resolver.Upgrade, Package: "libc6", Architecture: dependency.AMD64, OldVersion: ver(t, "2.36-9"), NewVersion: ver(t, "2.36-9+deb12u3")},
+		{Action: resolver.Upgrade, Package: "libc6", Architecture: dependency.I386, OldVersion: ver(t, "2.36-9"), NewVersion: ver(t, "2.36-9+deb12u3")},
+		{Action: resolver.Remove, Package: "postfix", OldVersion: ver(t, "3.7.10-0+deb12u1")},
+		{Action: resolver.Install, Package: "exim4-daemon-light", NewVersion: ver(t, "4.96-15+deb12u4")},
+	}}
+	selections := dpkg.Selections{
+		"libc6:i386":   dpkg.WantHold,
+		"postfix":      dpkg.WantHold,
+		"exim4-config": dpkg.WantPurge,
+	}
+
+	err := resolver.CheckHolds(plan, selections)
+	notok(t, err)
+	holdErr, ok := err.(*resolver.HoldError)
+	assert(t, ok && len(holdErr.Steps) == 2)
+	assert(t, holdErr.Steps[0].Architecture.Equal(dependency.I386))
+	assert(t, holdErr.Steps[1].Package == "postfix")
+	assert(t, err.Error() == "Held packages would be changed: libc6, postfix")
+
+	allowed := resolver.Plan{Steps: []resolver.Step{plan.Steps[0], plan.Steps[3]}}
+	isok(t, resolver.CheckHolds(allowed, selections))
+	isok(t, resolver.CheckHolds(plan, dpkg.Selections{}))
+}
+
+// vim: foldmethod=marker
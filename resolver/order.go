@@ -0,0 +1,310 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package resolver // import "pault.ag/go/debian/resolver"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+// Errors {{{
+
+// CycleError is returned by Order when packages Pre-Depend on each other
+// in a loop, which dpkg has no way to break. Packages are the names of the
+// packages in the loop.
+type CycleError struct {
+	Packages []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("Pre-Depends loop between %s", strings.Join(e.Packages, ", "))
+}
+
+// }}}
+
+// Graph {{{
+
+// Why one Step has to come before another.
+type edgeKind int
+
+const (
+	// The later Step's package Pre-Depends on the earlier one's.
+	preDependsEdge edgeKind = iota
+	// The later Step's package Depends on the earlier one's.
+	dependsEdge
+	// The earlier Step removes a package the later one Conflicts with or
+	// Breaks.
+	conflictsEdge
+	// The earlier Step activates a trigger the later one is interested in.
+	triggerEdge
+)
+
+type edge struct {
+	from, to int
+	kind     edgeKind
+}
+
+// Work out which Steps must come before which. Relations are only looked
+// at between Steps of the Plan; anything else is already on the system.
+func orderEdges(plan Plan, packages []control.BinaryIndex, interests map[string][]string) []edge {
+	indices := make([]*control.BinaryIndex, len(plan.Steps))
+	for i, step := range plan.Steps {
+		if step.NewVersion != nil {
+			indices[i] = findPackage(packages, step, *step.NewVersion)
+		}
+	}
+
+	/* Every Step that installs something satisfying the Possibility */
+	satisfying := func(possi dependency.Possibility) []int {
+		ret := []int{}
+		for i, step := range plan.Steps {
+			if step.NewVersion == nil {
+				continue
+			}
+			if step.Package == possi.Name && possi.SatisfiedBy(*step.NewVersion) {
+				ret = append(ret, i)
+				continue
+			}
+			if indices[i] == nil {
+				continue
+			}
+			provides := indices[i].GetProvides()
+			for _, provided := range provides.GetAllPossibilities() {
+				if provided.Name == possi.Name {
+					ret = append(ret, i)
+					break
+				}
+			}
+		}
+		return ret
+	}
+
+	ret := []edge{}
+	seen := map[edge]bool{}
+	add := func(from, to int, kind edgeKind) {
+		e := edge{from: from, to: to, kind: kind}
+		if from != to && !seen[e] {
+			seen[e] = true
+			ret = append(ret, e)
+		}
+	}
+
+	for i, step := range plan.Steps {
+		for _, trigger := range step.ActivatesTriggers {
+			for _, pkg := range interests[trigger] {
+				for j, other := range plan.Steps {
+					if other.Package == pkg && other.NewVersion != nil {
+						add(i, j, triggerEdge)
+					}
+				}
+			}
+		}
+
+		pkg := indices[i]
+		if pkg == nil {
+			continue
+		}
+		for kind, dep := range map[edgeKind]dependency.Dependency{
+			preDependsEdge: pkg.GetPreDepends(),
+			dependsEdge:    pkg.GetDepends(),
+		} {
+			for _, possi := range dep.GetAllPossibilities() {
+				for _, j := range satisfying(possi) {
+					add(j, i, kind)
+				}
+			}
+		}
+
+		conflicts := pkg.GetConflicts()
+		breaks := pkg.GetBreaks()
+		for _, possi := range append(conflicts.GetAllPossibilities(), breaks.GetAllPossibilities()...) {
+			for j, other := range plan.Steps {
+				if other.Action != Remove && other.Action != Purge {
+					continue
+				}
+				if other.Package == possi.Name && (other.OldVersion == nil || possi.SatisfiedBy(*other.OldVersion)) {
+					add(j, i, conflictsEdge)
+				}
+			}
+		}
+	}
+
+	/* Map iteration order above isn't stable */
+	sort.SliceStable(ret, func(a, b int) bool {
+		if ret[a].from != ret[b].from {
+			return ret[a].from < ret[b].from
+		}
+		if ret[a].to != ret[b].to {
+			return ret[a].to < ret[b].to
+		}
+		return ret[a].kind < ret[b].kind
+	})
+	return ret
+}
+
+// Tarjan's algorithm: return the strongly connected component each node
+// is in, numbered in reverse topological order.
+func components(nodes int, edges []edge) []int {
+	adjacent := make([][]int, nodes)
+	for _, e := range edges {
+		adjacent[e.from] = append(adjacent[e.from], e.to)
+	}
+
+	index := make([]int, nodes)
+	low := make([]int, nodes)
+	onStack := make([]bool, nodes)
+	component := make([]int, nodes)
+	for i := range index {
+		index[i] = -1
+	}
+	stack := []int{}
+	next, count := 0, 0
+
+	var visit func(int)
+	visit = func(node int) {
+		index[node], low[node] = next, next
+		next++
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, to := range adjacent[node] {
+			if index[to] < 0 {
+				visit(to)
+				if low[to] < low[node] {
+					low[node] = low[to]
+				}
+			} else if onStack[to] && index[to] < low[node] {
+				low[node] = index[to]
+			}
+		}
+
+		if low[node] == index[node] {
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component[top] = count
+				if top == node {
+					break
+				}
+			}
+			count++
+		}
+	}
+	for node := 0; node < nodes; node++ {
+		if index[node] < 0 {
+			visit(node)
+		}
+	}
+	return component
+}
+
+// }}}
+
+// Order {{{
+
+// Split a Plan into batches, in the order dpkg has to run them: each
+// batch can be unpacked (or removed) and configured together once every
+// earlier batch has been. The new versions' relations are looked up in
+// packages (Packages indices), and interests maps trigger names to the
+// packages interested in them, as for Simulate.
+//
+// A package comes after everything in the Plan it Pre-Depends on, Depends
+// on, or is interested in a trigger of, and after the removal of anything
+// it Conflicts with or Breaks. Loops are broken the way dpkg breaks them:
+// if a loop goes through a trigger, processing that trigger is deferred;
+// otherwise, packages that Depend on each other are configured together,
+// in the same batch. A loop of Pre-Depends can't be broken, and is
+// returned as a *CycleError.
+//
+// Within a batch, Steps are in Plan order.
+func Order(plan Plan, packages []control.BinaryIndex, interests map[string][]string) ([][]Step, error) {
+	nodes := len(plan.Steps)
+	edges := orderEdges(plan, packages, interests)
+
+	/* Defer any trigger that's part of a loop, then look again */
+	component := components(nodes, edges)
+	kept := []edge{}
+	for _, e := range edges {
+		if e.kind == triggerEdge && component[e.from] == component[e.to] {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	edges = kept
+	component = components(nodes, edges)
+
+	for _, e := range edges {
+		if e.kind != preDependsEdge || component[e.from] != component[e.to] {
+			continue
+		}
+		names := []string{}
+		for i, step := range plan.Steps {
+			if component[i] == component[e.from] {
+				names = append(names, step.Package)
+			}
+		}
+		sort.Strings(names)
+		return nil, &CycleError{Packages: names}
+	}
+
+	/* Each component goes in the batch after the latest of the ones it
+	 * has to follow. Tarjan numbers components so that everything a
+	 * component has to follow has a higher number. */
+	count := 0
+	for _, c := range component {
+		if c+1 > count {
+			count = c + 1
+		}
+	}
+	after := make([][]int, count)
+	for _, e := range edges {
+		if from, to := component[e.from], component[e.to]; from != to {
+			after[to] = append(after[to], from)
+		}
+	}
+	level := make([]int, count)
+	for c := count - 1; c >= 0; c-- {
+		for _, before := range after[c] {
+			if level[before]+1 > level[c] {
+				level[c] = level[before] + 1
+			}
+		}
+	}
+
+	batches := [][]Step{}
+	for i, step := range plan.Steps {
+		l := level[component[i]]
+		for len(batches) <= l {
+			batches = append(batches, []Step{})
+		}
+		batches[l] = append(batches[l], step)
+	}
+	return batches, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,150 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package resolver_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/resolver"
+)
+
+// {{{ packages
+var orderPackages = `Package: libc6
+Version: 2.36-9
+Architecture: amd64
+
+Package: libfoo1
+Version: 1.0-1
+Architecture: amd64
+Pre-Depends: libc6
+
+Package: foo
+Version: 1.0-1
+Architecture: amd64
+Depends: libfoo1, foo-data
+
+Package: foo-data
+Version: 1.0-1
+Architecture: all
+Depends: foo
+
+Package: man-db
+Version: 2.11-1
+Architecture: amd64
+Depends: libfoo1
+
+Package: postfix
+Version: 3.7-1
+Architecture: amd64
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent
+
+Package: loop-a
+Version: 1.0-1
+Architecture: amd64
+Pre-Depends: loop-b
+
+Package: loop-b
+Version: 1.0-1
+Architecture: amd64
+Depends: loop-a
+`
+
+// }}}
+
+func batchString(batches [][]resolver.Step) string {
+	ret := []string{}
+	for _, batch := range batches {
+		names := []string{}
+		for _, step := range batch {
+			names = append(names, step.Package)
+		}
+		ret = append(ret, strings.Join(names, " "))
+	}
+	return strings.Join(ret, " | ")
+}
+
+func install(t *testing.T, name, number string) resolver.Step {
+	return resolver.Step{Action: resolver.Install, Package: name, NewVersion: ver(t, number)}
+}
+
+func TestOrder(t *testing.T) {
+	packages, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(orderPackages)))
+	isok(t, err)
+
+	/* foo and foo-data Depend on each other, so are configured together */
+	plan := resolver.Plan{Steps: []resolver.Step{
+		install(t, "foo", "1.0-1"),
+		install(t, "foo-data", "1.0-1"),
+		install(t, "libfoo1", "1.0-1"),
+		{Action: resolver.Upgrade, Package: "libc6", OldVersion: ver(t, "2.31-13"), NewVersion: ver(t, "2.36-9")},
+	}}
+	batches, err := resolver.Order(plan, packages, nil)
+	isok(t, err)
+	assert(t, batchString(batches) == "libc6 | libfoo1 | foo foo-data")
+
+	/* The removal of what postfix Conflicts with comes first */
+	plan = resolver.Plan{Steps: []resolver.Step{
+		install(t, "postfix", "3.7-1"),
+		{Action: resolver.Remove, Package: "mail-transport-agent", OldVersion: ver(t, "1.0")},
+	}}
+	batches, err = resolver.Order(plan, packages, nil)
+	isok(t, err)
+	assert(t, batchString(batches) == "mail-transport-agent | postfix")
+
+	_, err = resolver.Order(resolver.Plan{Steps: []resolver.Step{
+		install(t, "loop-a", "1.0-1"),
+		install(t, "loop-b", "1.0-1"),
+	}}, packages, nil)
+	notok(t, err)
+	cycle, ok := err.(*resolver.CycleError)
+	assert(t, ok)
+	assert(t, strings.Join(cycle.Packages, " ") == "loop-a loop-b")
+}
+
+func TestOrderTriggers(t *testing.T) {
+	packages, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(orderPackages)))
+	isok(t, err)
+	interests := map[string][]string{"/usr/share/man": {"man-db"}}
+
+	/* man-db is configured after what triggers it */
+	libfoo := install(t, "libfoo1", "1.0-1")
+	foo := install(t, "foo", "1.0-1")
+	foo.ActivatesTriggers = []string{"/usr/share/man"}
+	plan := resolver.Plan{Steps: []resolver.Step{install(t, "man-db", "2.11-1"), foo, install(t, "foo-data", "1.0-1"), libfoo}}
+	batches, err := resolver.Order(plan, packages, interests)
+	isok(t, err)
+	assert(t, batchString(batches) == "libfoo1 | foo foo-data | man-db")
+
+	/* Unless that's a loop, in which case the trigger waits */
+	interests["libfoo-trigger"] = []string{"libfoo1"}
+	manDB := install(t, "man-db", "2.11-1")
+	manDB.ActivatesTriggers = []string{"libfoo-trigger"}
+	plan = resolver.Plan{Steps: []resolver.Step{manDB, libfoo}}
+	batches, err = resolver.Order(plan, packages, interests)
+	isok(t, err)
+	assert(t, batchString(batches) == "libfoo1 | man-db")
+}
+
+// vim: foldmethod=marker
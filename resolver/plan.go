@@ -0,0 +1,127 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package resolver // import "pault.ag/go/debian/resolver"
+
+import (
+	"fmt"
+
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Action {{{
+
+// An Action is the thing that is going to be done to a package.
+type Action int
+
+const (
+	Install Action = iota
+	Upgrade
+	Remove
+	Purge
+)
+
+func (a Action) String() string {
+	switch a {
+	case Install:
+		return "install"
+	case Upgrade:
+		return "upgrade"
+	case Remove:
+		return "remove"
+	case Purge:
+		return "purge"
+	default:
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+}
+
+// }}}
+
+// Step {{{
+
+// A Step is a single operation on a single package. OldVersion is the version
+// that is on the system before the Step is run (nil if the package is not
+// known to dpkg at all), and NewVersion is the version being installed (nil
+// for removals).
+type Step struct {
+	Action       Action
+	Package      string
+	Architecture dependency.Arch
+
+	OldVersion *version.Version
+	NewVersion *version.Version
+
+	// If the package was removed but not purged, only its conffiles are
+	// left on the system, and OldVersion is the version those came from.
+	ConfigFilesOnly bool
+
+	// Names of triggers that this package activates when it's unpacked or
+	// removed, such as file triggers on /usr/share/man or named triggers
+	// like ldconfig.
+	ActivatesTriggers []string
+}
+
+func (s Step) String() string {
+	switch s.Action {
+	case Install:
+		return fmt.Sprintf("install %s (%s)", s.Package, s.NewVersion)
+	case Upgrade:
+		return fmt.Sprintf("upgrade %s (%s => %s)", s.Package, s.OldVersion, s.NewVersion)
+	default:
+		return fmt.Sprintf("%s %s (%s)", s.Action, s.Package, s.OldVersion)
+	}
+}
+
+// }}}
+
+// Plan {{{
+
+// A Plan is an ordered set of Steps, as would be computed by a resolver.
+type Plan struct {
+	Steps []Step
+}
+
+// Return all Steps in the Plan with the given Action.
+func (p Plan) With(action Action) []Step {
+	ret := []Step{}
+	for _, step := range p.Steps {
+		if step.Action == action {
+			ret = append(ret, step)
+		}
+	}
+	return ret
+}
+
+// Return the Step for the named package, or nil if the Plan doesn't touch
+// that package.
+func (p Plan) Find(name string) *Step {
+	for i := range p.Steps {
+		if p.Steps[i].Package == name {
+			return &p.Steps[i]
+		}
+	}
+	return nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
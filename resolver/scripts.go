@@ -0,0 +1,218 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package resolver // import "pault.ag/go/debian/resolver"
+
+import (
+	"fmt"
+	"strings"
+
+	"pault.ag/go/debian/version"
+)
+
+// Invocation {{{
+
+// An Invocation is a single maintainer script call that dpkg would make,
+// such as `postinst configure 1.0-1`. Version is the version of the package
+// that the script is taken from, since during an upgrade both the old and
+// new scripts get run.
+type Invocation struct {
+	Package string
+	Version version.Version
+	Script  string
+	Args    []string
+}
+
+func (i Invocation) String() string {
+	args := make([]string, len(i.Args))
+	for n, arg := range i.Args {
+		if arg == "" || strings.Contains(arg, " ") {
+			arg = fmt.Sprintf("%q", arg)
+		}
+		args[n] = arg
+	}
+	return fmt.Sprintf(
+		"%s (%s) %s %s", i.Package, i.Version, i.Script, strings.Join(args, " "),
+	)
+}
+
+// }}}
+
+// Simulate {{{
+
+// Given a Plan, produce the exact sequence of maintainer script invocations
+// that dpkg would run to carry it out, following the flowcharts in chapter
+// 6 of Debian Policy. Nothing is executed.
+//
+// All removals and unpacks are run in Plan order, followed by configuration
+// of every unpacked package, followed by trigger processing. `interests` maps
+// trigger names to the packages that declared interest in them (as found in
+// the `triggers` control member); every interested package that is still
+// installed at the end of the run will have its postinst invoked with
+// `triggered`.
+func Simulate(plan Plan, interests map[string][]string) ([]Invocation, error) {
+	ret := []Invocation{}
+	pending := map[string][]string{}
+	pendingOrder := []string{}
+	removed := map[string]bool{}
+
+	activate := func(step Step) {
+		for _, trigger := range step.ActivatesTriggers {
+			for _, pkg := range interests[trigger] {
+				if _, ok := pending[pkg]; !ok {
+					pendingOrder = append(pendingOrder, pkg)
+				}
+				if !contains(pending[pkg], trigger) {
+					pending[pkg] = append(pending[pkg], trigger)
+				}
+			}
+		}
+	}
+
+	/* Unpack and remove phase */
+	for _, step := range plan.Steps {
+		invocations, err := unpackOrRemove(step)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, invocations...)
+		if step.Action == Remove || step.Action == Purge {
+			removed[step.Package] = true
+		}
+		activate(step)
+	}
+
+	/* Configure phase */
+	for _, step := range plan.Steps {
+		if step.Action != Install && step.Action != Upgrade {
+			continue
+		}
+		ret = append(ret, Invocation{
+			Package: step.Package,
+			Version: *step.NewVersion,
+			Script:  "postinst",
+			Args:    []string{"configure", versionArg(step.OldVersion)},
+		})
+	}
+
+	/* Trigger processing */
+	for _, pkg := range pendingOrder {
+		if removed[pkg] {
+			continue
+		}
+		invocation := Invocation{
+			Package: pkg,
+			Script:  "postinst",
+			Args:    []string{"triggered", strings.Join(pending[pkg], " ")},
+		}
+		if step := plan.Find(pkg); step != nil && step.NewVersion != nil {
+			invocation.Version = *step.NewVersion
+		} else if step != nil && step.OldVersion != nil {
+			invocation.Version = *step.OldVersion
+		}
+		ret = append(ret, invocation)
+	}
+
+	return ret, nil
+}
+
+func unpackOrRemove(step Step) ([]Invocation, error) {
+	switch step.Action {
+	case Install, Upgrade:
+		if step.NewVersion == nil {
+			return nil, fmt.Errorf("%s: no version to %s", step.Package, step.Action)
+		}
+		if step.OldVersion == nil || step.ConfigFilesOnly {
+			return []Invocation{{
+				Package: step.Package,
+				Version: *step.NewVersion,
+				Script:  "preinst",
+				Args:    optionalArgs("install", step.OldVersion),
+			}}, nil
+		}
+		return []Invocation{
+			{
+				Package: step.Package,
+				Version: *step.OldVersion,
+				Script:  "prerm",
+				Args:    []string{"upgrade", step.NewVersion.String()},
+			},
+			{
+				Package: step.Package,
+				Version: *step.NewVersion,
+				Script:  "preinst",
+				Args:    []string{"upgrade", step.OldVersion.String()},
+			},
+			{
+				Package: step.Package,
+				Version: *step.OldVersion,
+				Script:  "postrm",
+				Args:    []string{"upgrade", step.NewVersion.String()},
+			},
+		}, nil
+	case Remove, Purge:
+		if step.OldVersion == nil {
+			return nil, fmt.Errorf("%s: can't %s a package that isn't installed", step.Package, step.Action)
+		}
+		ret := []Invocation{}
+		if !step.ConfigFilesOnly {
+			ret = append(ret,
+				Invocation{Package: step.Package, Version: *step.OldVersion, Script: "prerm", Args: []string{"remove"}},
+				Invocation{Package: step.Package, Version: *step.OldVersion, Script: "postrm", Args: []string{"remove"}},
+			)
+		}
+		if step.Action == Purge {
+			ret = append(ret, Invocation{
+				Package: step.Package, Version: *step.OldVersion, Script: "postrm", Args: []string{"purge"},
+			})
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("%s: unknown action %s", step.Package, step.Action)
+}
+
+// dpkg passes the most recently configured version, or an empty string
+// if there isn't one.
+func versionArg(v *version.Version) string {
+	if v == nil {
+		return ""
+	}
+	return v.String()
+}
+
+func optionalArgs(arg string, v *version.Version) []string {
+	if v == nil {
+		return []string{arg}
+	}
+	return []string{arg, v.String()}
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, el := range haystack {
+		if el == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,116 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package resolver_test
+
+import (
+	"log"
+	"testing"
+
+	"pault.ag/go/debian/resolver"
+	"pault.ag/go/debian/version"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+func ver(t *testing.T, in string) *version.Version {
+	v, err := version.Parse(in)
+	isok(t, err)
+	return &v
+}
+
+/*
+ *
+ */
+
+func TestSimulate(t *testing.T) {
+	plan := resolver.Plan{Steps: []resolver.Step{
+		{Action: resolver.Install, Package: "foo", NewVersion: ver(t, "1.0-1")},
+		{
+			Action:            resolver.Upgrade,
+			Package:           "bar",
+			OldVersion:        ver(t, "1.0-1"),
+			NewVersion:        ver(t, "2.0-1"),
+			ActivatesTriggers: []string{"/usr/share/man"},
+		},
+		{Action: resolver.Purge, Package: "baz", OldVersion: ver(t, "3.0")},
+		{Action: resolver.Purge, Package: "quux", OldVersion: ver(t, "4.0"), ConfigFilesOnly: true},
+	}}
+
+	invocations, err := resolver.Simulate(plan, map[string][]string{
+		"/usr/share/man": {"man-db"},
+	})
+	isok(t, err)
+
+	expected := []string{
+		`foo (1.0-1) preinst install`,
+		`bar (1.0-1) prerm upgrade 2.0-1`,
+		`bar (2.0-1) preinst upgrade 1.0-1`,
+		`bar (1.0-1) postrm upgrade 2.0-1`,
+		`baz (3.0) prerm remove`,
+		`baz (3.0) postrm remove`,
+		`baz (3.0) postrm purge`,
+		`quux (4.0) postrm purge`,
+		`foo (1.0-1) postinst configure ""`,
+		`bar (2.0-1) postinst configure 1.0-1`,
+		`man-db () postinst triggered /usr/share/man`,
+	}
+	assert(t, len(invocations) == len(expected))
+	for i, el := range expected {
+		assert(t, invocations[i].String() == el)
+	}
+}
+
+func TestSimulateErrors(t *testing.T) {
+	_, err := resolver.Simulate(resolver.Plan{Steps: []resolver.Step{
+		{Action: resolver.Remove, Package: "foo"},
+	}}, nil)
+	notok(t, err)
+
+	_, err = resolver.Simulate(resolver.Plan{Steps: []resolver.Step{
+		{Action: resolver.Install, Package: "foo"},
+	}}, nil)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
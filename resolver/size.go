@@ -0,0 +1,154 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package resolver // import "pault.ag/go/debian/resolver"
+
+import (
+	"fmt"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/version"
+)
+
+// Sizes {{{
+
+// The download and disk space cost of a single Step.
+type StepSize struct {
+	Step Step
+
+	// Bytes to download; zero for removals, or if the .deb is cached.
+	Download int64
+	// Change in disk space used, in bytes, going by Installed-Size.
+	InstalledDelta int64
+	// The .deb is already in the cache, so needn't be downloaded.
+	Cached bool
+}
+
+// A SizeReport is what a Plan costs, as summarized by apt before it asks
+// whether to continue.
+type SizeReport struct {
+	Steps []StepSize
+
+	// Bytes to download, and the bytes of every .deb, cached or not.
+	Download      int64
+	TotalArchives int64
+	// Change in disk space used, in bytes. Negative if space is freed.
+	InstalledDelta int64
+
+	// Packages that couldn't be found in the indices, so aren't counted.
+	Unknown []string
+}
+
+// Work out the SizeReport of a Plan. The new versions are looked up in
+// available (Packages indices, for Size and Installed-Size), and the old
+// versions in installed (the dpkg status file, for Installed-Size). If
+// cached is not nil, it's asked whether each .deb is already downloaded.
+func Sizes(plan Plan, available, installed []control.BinaryIndex, cached func(control.BinaryIndex) bool) SizeReport {
+	report := SizeReport{}
+	for _, step := range plan.Steps {
+		size := StepSize{Step: step}
+		known := true
+
+		if step.NewVersion != nil {
+			if pkg := findPackage(available, step, *step.NewVersion); pkg != nil {
+				size.InstalledDelta += int64(pkg.InstalledSize) * 1024
+				report.TotalArchives += int64(pkg.Size)
+				if cached != nil && cached(*pkg) {
+					size.Cached = true
+				} else {
+					size.Download = int64(pkg.Size)
+				}
+			} else {
+				known = false
+			}
+		}
+		if step.OldVersion != nil && !step.ConfigFilesOnly {
+			if pkg := findPackage(installed, step, *step.OldVersion); pkg != nil {
+				size.InstalledDelta -= int64(pkg.InstalledSize) * 1024
+			} else {
+				known = false
+			}
+		}
+
+		if !known {
+			report.Unknown = append(report.Unknown, step.Package)
+		}
+		report.Download += size.Download
+		report.InstalledDelta += size.InstalledDelta
+		report.Steps = append(report.Steps, size)
+	}
+	return report
+}
+
+// Find the package the Step is about, at the given version.
+func findPackage(packages []control.BinaryIndex, step Step, ver version.Version) *control.BinaryIndex {
+	for i, pkg := range packages {
+		if pkg.Package != step.Package || version.Compare(pkg.Version, ver) != 0 {
+			continue
+		}
+		if step.Architecture.CPU != "" && pkg.Architecture.CPU != "all" && !pkg.Architecture.Is(&step.Architecture) {
+			continue
+		}
+		return &packages[i]
+	}
+	return nil
+}
+
+// Summarize the report the way apt does.
+func (r SizeReport) String() string {
+	lines := []string{}
+	if r.TotalArchives > 0 {
+		if r.Download == r.TotalArchives {
+			lines = append(lines, fmt.Sprintf("Need to get %sB of archives.", formatSize(r.Download)))
+		} else {
+			lines = append(lines, fmt.Sprintf("Need to get %sB/%sB of archives.", formatSize(r.Download), formatSize(r.TotalArchives)))
+		}
+	}
+	switch {
+	case r.InstalledDelta > 0:
+		lines = append(lines, fmt.Sprintf("After this operation, %sB of additional disk space will be used.", formatSize(r.InstalledDelta)))
+	case r.InstalledDelta < 0:
+		lines = append(lines, fmt.Sprintf("After this operation, %sB disk space will be freed.", formatSize(-r.InstalledDelta)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Format a number of bytes like apt does, with SI units.
+func formatSize(size int64) string {
+	units := []string{"", "k", "M", "G", "T", "P"}
+	value := float64(size)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d ", size)
+	}
+	if value < 100 {
+		return fmt.Sprintf("%.1f %s", value, units[unit])
+	}
+	return fmt.Sprintf("%.0f %s", value, units[unit])
+}
+
+// }}}
+
+// vim: foldmethod=marker
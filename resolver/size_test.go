@@ -0,0 +1,99 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package resolver_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/resolver"
+)
+
+// {{{ indices
+var availablePackages = `Package: hello
+Version: 2.10-3
+Architecture: amd64
+Installed-Size: 280
+Size: 56000
+
+Package: hello
+Version: 2.10-3
+Architecture: arm64
+Installed-Size: 300
+Size: 58000
+
+Package: cowsay
+Version: 3.03+dfsg2-8
+Architecture: all
+Installed-Size: 90
+Size: 20000
+`
+
+var statusPackages = `Package: hello
+Version: 2.10-2
+Architecture: amd64
+Installed-Size: 270
+
+Package: sl
+Version: 5.02-1
+Architecture: amd64
+Installed-Size: 60
+`
+
+// }}}
+
+func TestSizes(t *testing.T) {
+	available, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(availablePackages)))
+	isok(t, err)
+	installed, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(statusPackages)))
+	isok(t, err)
+
+	amd64 := dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"}
+	plan := resolver.Plan{Steps: []resolver.Step{
+		{Action: resolver.Upgrade, Package: "hello", Architecture: amd64, OldVersion: ver(t, "2.10-2"), NewVersion: ver(t, "2.10-3")},
+		{Action: resolver.Install, Package: "cowsay", Architecture: amd64, NewVersion: ver(t, "3.03+dfsg2-8")},
+		{Action: resolver.Remove, Package: "sl", Architecture: amd64, OldVersion: ver(t, "5.02-1")},
+		{Action: resolver.Install, Package: "missing", NewVersion: ver(t, "1.0")},
+	}}
+
+	report := resolver.Sizes(plan, available, installed, func(pkg control.BinaryIndex) bool {
+		return pkg.Package == "cowsay"
+	})
+	assert(t, len(report.Steps) == 4)
+	assert(t, report.Steps[0].Download == 56000)
+	assert(t, report.Steps[0].InstalledDelta == 10*1024)
+	assert(t, report.Steps[1].Cached && report.Steps[1].Download == 0)
+	assert(t, report.Steps[2].InstalledDelta == -60*1024)
+	assert(t, report.Download == 56000)
+	assert(t, report.TotalArchives == 76000)
+	assert(t, report.InstalledDelta == 40*1024)
+	assert(t, strings.Join(report.Unknown, " ") == "missing")
+	assert(t, report.String() == "Need to get 56.0 kB/76.0 kB of archives.\n"+
+		"After this operation, 41.0 kB of additional disk space will be used.")
+
+	report = resolver.Sizes(resolver.Plan{Steps: plan.Steps[2:3]}, available, installed, nil)
+	assert(t, report.String() == "After this operation, 61.4 kB disk space will be freed.")
+}
+
+// vim: foldmethod=marker
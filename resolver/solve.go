@@ -0,0 +1,591 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package resolver // import "pault.ag/go/debian/resolver"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/dpkg"
+	"pault.ag/go/debian/version"
+)
+
+// Request {{{
+
+// A Request is what's asked of a Solver, as in "apt-get install foo bar-".
+type Request struct {
+	// Packages to install (or upgrade, if they're installed already), by
+	// name, or as "name=version" for a particular version.
+	Install []string
+
+	// Packages to remove. Packages that aren't installed are ignored.
+	Remove []string
+}
+
+// }}}
+
+// Errors {{{
+
+// UnsatisfiableError is returned by Solve when no set of packages meets
+// the Request. Reasons are the problems the Solver couldn't get past, in
+// the style of apt's unmet dependencies report, such as
+// "hello : Depends: libc6 (>= 2.38) but 2.36-9 is to be installed".
+type UnsatisfiableError struct {
+	Reasons []string
+}
+
+func (e *UnsatisfiableError) Error() string {
+	return fmt.Sprintf("Unmet dependencies: %s", strings.Join(e.Reasons, "; "))
+}
+
+// }}}
+
+// Solver {{{
+
+// The default for Solver.MaxSteps.
+const DefaultMaxSteps = 100000
+
+// A Solver works out what apt-get would do to satisfy a Request: which
+// packages to install, upgrade or remove so that every installed package
+// has its Depends and Pre-Depends met, and none Conflicts with or Breaks
+// another.
+//
+// It's a simple backtracking search, which prefers (in order) the first
+// alternative of each relation, the newest version of each package, and
+// leaving installed packages alone. Installed packages are only upgraded
+// or removed when that's the only way to satisfy the Request, and packages
+// on hold in the Selections are never changed.
+//
+// Only one architecture is handled; multi-arch qualifiers such as ":any"
+// are ignored.
+type Solver struct {
+	// The architecture being installed for. Available and installed
+	// packages for other architectures (apart from "all") are ignored,
+	// such as the i386 libraries on a multiarch amd64 system, as are
+	// relations restricted to other architectures. If empty, nothing is
+	// filtered, and a package installed for more than one architecture is
+	// an error.
+	Arch dependency.Arch
+
+	// Every package that can be installed, such as from Packages indices.
+	Available []control.BinaryIndex
+
+	// What's on the system now; nil for an empty system.
+	Installed *dpkg.StatusDatabase
+
+	// dpkg's selections, for holds; may be nil.
+	Selections dpkg.Selections
+
+	// Give up after trying this many partial solutions. If zero,
+	// DefaultMaxSteps.
+	MaxSteps int
+}
+
+// Work out the Plan to carry out the Request, returning an
+// *UnsatisfiableError if there isn't one. The Steps are ordered by package
+// name, not in the order they need to be run in.
+func (s *Solver) Solve(request Request) (Plan, error) {
+	u, err := s.universe()
+	if err != nil {
+		return Plan{}, err
+	}
+
+	root := &candidate{name: requestName}
+	for _, name := range request.Install {
+		relation := name
+		if pkg, number, ok := strings.Cut(name, "="); ok {
+			relation = fmt.Sprintf("%s (= %s)", pkg, number)
+			name = pkg
+		}
+		if len(u.versions[name]) == 0 && len(u.providers[name]) == 0 {
+			return Plan{}, fmt.Errorf("Unable to locate package %s", name)
+		}
+		dep, err := dependency.Parse(relation)
+		if err != nil {
+			return Plan{}, err
+		}
+		root.depends = append(root.depends, dep.Relations...)
+	}
+	for _, name := range request.Remove {
+		dep, err := dependency.Parse(name)
+		if err != nil {
+			return Plan{}, err
+		}
+		root.conflicts = append(root.conflicts, dep.GetAllPossibilities()...)
+	}
+
+	start := state{}
+	for name, pkg := range u.installed {
+		held := s.Selections != nil && s.Selections.IsHeld(name)
+		start[name] = choice{pkg: pkg, locked: held, held: held}
+	}
+
+	search := search{
+		universe: u,
+		root:     root,
+		maxSteps: s.MaxSteps,
+		seen:     map[string]bool{},
+	}
+	if search.maxSteps == 0 {
+		search.maxSteps = DefaultMaxSteps
+	}
+	solution, err := search.solve(start)
+	if err != nil {
+		return Plan{}, err
+	}
+	if solution == nil {
+		return Plan{}, &UnsatisfiableError{Reasons: search.reasons}
+	}
+	return s.plan(u, solution), nil
+}
+
+// Turn the solution into the Steps to get to it from what's installed.
+func (s *Solver) plan(u *universe, solution state) Plan {
+	names := []string{}
+	for name := range u.installed {
+		names = append(names, name)
+	}
+	for name, choice := range solution {
+		if choice.pkg != nil && u.installed[name] == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	plan := Plan{}
+	for _, name := range names {
+		old, new := u.installed[name], solution[name].pkg
+		switch {
+		case old == nil:
+			step := Step{Action: Install, Package: name, Architecture: new.arch, NewVersion: &new.version}
+			if s.Installed != nil {
+				for _, pkg := range s.Installed.Lookup(name) {
+					if pkg.Status.State == dpkg.ConfigFiles && !s.foreign(pkg.Architecture) {
+						ver := pkg.Version
+						step.OldVersion, step.ConfigFilesOnly = &ver, true
+					}
+				}
+			}
+			plan.Steps = append(plan.Steps, step)
+		case new == nil:
+			plan.Steps = append(plan.Steps, Step{Action: Remove, Package: name, Architecture: old.arch, OldVersion: &old.version})
+		case old != new:
+			plan.Steps = append(plan.Steps, Step{
+				Action: Upgrade, Package: name, Architecture: new.arch,
+				OldVersion: &old.version, NewVersion: &new.version,
+			})
+		}
+	}
+	return plan
+}
+
+// }}}
+
+// Universe {{{
+
+// What the Request is called in explanations.
+const requestName = "Request"
+
+// A candidate is one version of one package, with its relations parsed.
+type candidate struct {
+	name    string
+	version version.Version
+	arch    dependency.Arch
+
+	depends   []dependency.Relation
+	conflicts []dependency.Possibility
+	provides  []dependency.Possibility
+}
+
+// Every candidate, indexed.
+type universe struct {
+	// By name, newest first.
+	versions map[string][]*candidate
+	// By virtual package name.
+	providers map[string][]*candidate
+	// What's installed now, by name.
+	installed map[string]*candidate
+}
+
+// Return true if arch is neither the Solver's Arch nor "all", so packages
+// built for it are left out. Nothing is foreign if the Arch isn't set.
+func (s *Solver) foreign(arch dependency.Arch) bool {
+	return s.Arch.CPU != "" && arch.CPU != "all" && !arch.Is(&s.Arch)
+}
+
+func (s *Solver) reduce(dep dependency.Dependency) dependency.Dependency {
+	if s.Arch.CPU == "" {
+		return dep
+	}
+	return dep.Reduce(s.Arch, nil)
+}
+
+func (s *Solver) newCandidate(name string, ver version.Version, arch dependency.Arch, preDepends, depends, conflicts, breaks, provides dependency.Dependency) *candidate {
+	ret := candidate{name: name, version: ver, arch: arch}
+	ret.depends = append(ret.depends, s.reduce(preDepends).Relations...)
+	ret.depends = append(ret.depends, s.reduce(depends).Relations...)
+	conflicts = s.reduce(conflicts)
+	breaks = s.reduce(breaks)
+	ret.conflicts = append(conflicts.GetAllPossibilities(), breaks.GetAllPossibilities()...)
+	ret.provides = provides.GetAllPossibilities()
+	return &ret
+}
+
+func (s *Solver) universe() (*universe, error) {
+	u := universe{
+		versions:  map[string][]*candidate{},
+		providers: map[string][]*candidate{},
+		installed: map[string]*candidate{},
+	}
+
+	add := func(pkg *candidate) {
+		u.versions[pkg.name] = append(u.versions[pkg.name], pkg)
+		for _, possi := range pkg.provides {
+			u.providers[possi.Name] = append(u.providers[possi.Name], pkg)
+		}
+	}
+
+	for i := range s.Available {
+		pkg := &s.Available[i]
+		if s.foreign(pkg.Architecture) {
+			continue
+		}
+		known := false
+		for _, other := range u.versions[pkg.Package] {
+			if version.Compare(other.version, pkg.Version) == 0 {
+				known = true
+			}
+		}
+		if known {
+			continue
+		}
+		add(s.newCandidate(
+			pkg.Package, pkg.Version, pkg.Architecture,
+			pkg.GetPreDepends(), pkg.GetDepends(), pkg.GetConflicts(), pkg.GetBreaks(), pkg.GetProvides(),
+		))
+	}
+
+	if s.Installed != nil {
+		for _, pkg := range s.Installed.Installed() {
+			if s.foreign(pkg.Architecture) {
+				continue
+			}
+			if u.installed[pkg.Package] != nil {
+				return nil, fmt.Errorf("%s is installed for more than one architecture", pkg.Package)
+			}
+			for _, available := range u.versions[pkg.Package] {
+				if version.Compare(available.version, pkg.Version) == 0 {
+					u.installed[pkg.Package] = available
+				}
+			}
+			if u.installed[pkg.Package] == nil {
+				/* Not (or no longer) in the archive; dpkg knows it, though */
+				local := s.newCandidate(
+					pkg.Package, pkg.Version, pkg.Architecture,
+					pkg.GetPreDepends(), pkg.GetDepends(), pkg.GetConflicts(), pkg.GetBreaks(), pkg.GetProvides(),
+				)
+				add(local)
+				u.installed[pkg.Package] = local
+			}
+		}
+	}
+
+	for name := range u.versions {
+		versions := u.versions[name]
+		sort.SliceStable(versions, func(a, b int) bool {
+			return version.Compare(versions[a].version, versions[b].version) > 0
+		})
+	}
+	for name := range u.providers {
+		providers := u.providers[name]
+		sort.SliceStable(providers, func(a, b int) bool {
+			if providers[a].name != providers[b].name {
+				return providers[a].name < providers[b].name
+			}
+			return version.Compare(providers[a].version, providers[b].version) > 0
+		})
+	}
+	return &u, nil
+}
+
+// Return true if pkg Provides something that satisfies possi. As in dpkg,
+// only a versioned Provides satisfies a versioned relation.
+func (pkg *candidate) satisfiesVirtual(possi dependency.Possibility) bool {
+	for _, provided := range pkg.provides {
+		if provided.Name != possi.Name {
+			continue
+		}
+		if possi.Version == nil {
+			return true
+		}
+		if provided.Version == nil || provided.Version.Operator != "=" {
+			continue
+		}
+		if ver, err := version.Parse(provided.Version.Number); err == nil && possi.Version.SatisfiedBy(ver) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return true if pkg satisfies possi, by name or by Provides.
+func (pkg *candidate) satisfies(possi dependency.Possibility) bool {
+	if pkg.name == possi.Name && possi.SatisfiedBy(pkg.version) {
+		return true
+	}
+	return pkg.satisfiesVirtual(possi)
+}
+
+// }}}
+
+// Search {{{
+
+// What's been decided about a package: installed at pkg (or not installed
+// at all, if nil). Packages that aren't locked are as they were on the
+// system, and can still be changed.
+type choice struct {
+	pkg    *candidate
+	locked bool
+	held   bool
+}
+
+// A state is a (possibly partial) solution; names that aren't in it are
+// not installed, and not locked.
+type state map[string]choice
+
+func (st state) with(name string, pkg *candidate) state {
+	ret := state{}
+	for key, value := range st {
+		ret[key] = value
+	}
+	ret[name] = choice{pkg: pkg, locked: true}
+	return ret
+}
+
+// Every package installed in the state, in name order.
+func (st state) installed() []*candidate {
+	names := []string{}
+	for name, choice := range st {
+		if choice.pkg != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	ret := []*candidate{}
+	for _, name := range names {
+		ret = append(ret, st[name].pkg)
+	}
+	return ret
+}
+
+type search struct {
+	universe *universe
+	root     *candidate
+	maxSteps int
+	steps    int
+
+	reasons []string
+	seen    map[string]bool
+}
+
+// Something wrong with a state: either pkg has a relation that isn't met,
+// or it conflicts with other.
+type problem struct {
+	pkg      *candidate
+	relation *dependency.Relation
+
+	conflict *dependency.Possibility
+	other    *candidate
+}
+
+// Find the first thing wrong with the state, or nil if there's nothing.
+// The Request's relations must be met by locked packages, so that
+// installed packages the Request names are considered for an upgrade.
+func (s *search) problem(st state, installed []*candidate) *problem {
+	check := func(pkg *candidate, locked bool) *problem {
+		for i, relation := range pkg.depends {
+			if !s.satisfied(st, installed, relation, locked) {
+				return &problem{pkg: pkg, relation: &pkg.depends[i]}
+			}
+		}
+		for i, possi := range pkg.conflicts {
+			for _, other := range installed {
+				if other.name != pkg.name && other.satisfies(possi) {
+					return &problem{pkg: pkg, conflict: &pkg.conflicts[i], other: other}
+				}
+			}
+		}
+		return nil
+	}
+
+	if found := check(s.root, true); found != nil {
+		return found
+	}
+	for _, pkg := range installed {
+		if found := check(pkg, false); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func (s *search) satisfied(st state, installed []*candidate, relation dependency.Relation, locked bool) bool {
+	for _, possi := range relation.Possibilities {
+		if possi.Substvar {
+			continue
+		}
+		for _, pkg := range installed {
+			if (!locked || st[pkg.name].locked) && pkg.satisfies(possi) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Depth first search for a state with no problems, returning nil if
+// there isn't one.
+func (s *search) solve(st state) (state, error) {
+	s.steps++
+	if s.steps > s.maxSteps {
+		return nil, fmt.Errorf("Gave up looking for a solution after %d steps", s.maxSteps)
+	}
+
+	installed := st.installed()
+	found := s.problem(st, installed)
+	if found == nil {
+		return st, nil
+	}
+
+	options := s.options(st, found)
+	if len(options) == 0 {
+		s.explain(st, found)
+		return nil, nil
+	}
+	for _, option := range options {
+		solution, err := s.solve(st.with(option.name, option.pkg))
+		if err != nil || solution != nil {
+			return solution, err
+		}
+	}
+	return nil, nil
+}
+
+// A way to fix a problem: install pkg as name (or remove name, if pkg is
+// nil).
+type option struct {
+	name string
+	pkg  *candidate
+}
+
+// Every way to fix the problem, in order of preference.
+func (s *search) options(st state, found *problem) []option {
+	ret := []option{}
+	seen := map[*candidate]bool{}
+	add := func(pkg *candidate) {
+		if !seen[pkg] && !st[pkg.name].locked {
+			seen[pkg] = true
+			ret = append(ret, option{name: pkg.name, pkg: pkg})
+		}
+	}
+	/* Every other version of name, then removing it */
+	change := func(name string, avoid *dependency.Possibility) {
+		if st[name].locked || name == requestName {
+			return
+		}
+		for _, pkg := range s.universe.versions[name] {
+			if pkg != st[name].pkg && (avoid == nil || !pkg.satisfies(*avoid)) {
+				add(pkg)
+			}
+		}
+		ret = append(ret, option{name: name})
+	}
+
+	if found.relation != nil {
+		for _, possi := range found.relation.Possibilities {
+			if possi.Substvar {
+				continue
+			}
+			for _, pkg := range s.universe.versions[possi.Name] {
+				if possi.SatisfiedBy(pkg.version) {
+					add(pkg)
+				}
+			}
+			for _, pkg := range s.universe.providers[possi.Name] {
+				if pkg.satisfiesVirtual(possi) {
+					add(pkg)
+				}
+			}
+		}
+		change(found.pkg.name, nil)
+		return ret
+	}
+
+	change(found.other.name, found.conflict)
+	change(found.pkg.name, nil)
+	return ret
+}
+
+// Record why a problem couldn't be fixed, in apt's words.
+func (s *search) explain(st state, found *problem) {
+	var reason string
+	if found.relation != nil {
+		reason = fmt.Sprintf("%s : Depends: %s but %s", found.pkg.name, found.relation, s.why(st, *found.relation))
+	} else if found.pkg == s.root {
+		why := "it is required"
+		if st[found.other.name].held {
+			why = "it is held"
+		}
+		reason = fmt.Sprintf("%s : Remove: %s but %s", requestName, found.other.name, why)
+	} else {
+		reason = fmt.Sprintf(
+			"%s : Conflicts: %s but %s %s is to be installed",
+			found.pkg.name, found.conflict, found.other.name, found.other.version,
+		)
+	}
+	if !s.seen[reason] {
+		s.seen[reason] = true
+		s.reasons = append(s.reasons, reason)
+	}
+}
+
+// Explain why nothing could be found to satisfy the relation.
+func (s *search) why(st state, relation dependency.Relation) string {
+	if len(relation.Possibilities) == 1 {
+		name := relation.Possibilities[0].Name
+		switch choice, ok := st[name]; {
+		case ok && choice.held && choice.pkg != nil:
+			return fmt.Sprintf("%s is held", choice.pkg.version)
+		case ok && choice.locked && choice.pkg != nil:
+			return fmt.Sprintf("%s is to be installed", choice.pkg.version)
+		case ok && choice.locked:
+			return "it is not going to be installed"
+		}
+	}
+	return "it is not installable"
+}
+
+// }}}
+
+// vim: foldmethod=marker
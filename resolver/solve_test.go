@@ -0,0 +1,238 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package resolver_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/dpkg"
+	"pault.ag/go/debian/resolver"
+)
+
+// {{{ archive
+var solverPackages = `Package: hello
+Version: 2.0-1
+Architecture: amd64
+Depends: libc6 (>= 2.36), libhello1 (>= 2.0)
+
+Package: hello
+Version: 1.0-1
+Architecture: amd64
+Depends: libc6 (>= 2.36), libhello-data | libhello-alt
+
+Package: hello
+Version: 1.0-1
+Architecture: i386
+Depends: libi386-only
+
+Package: libhello-data
+Version: 1.0-1
+Architecture: all
+
+Package: libc6
+Version: 2.36-9
+Architecture: amd64
+Breaks: oldtool (<< 2.0)
+
+Package: oldtool
+Version: 2.0-1
+Architecture: amd64
+
+Package: postfix
+Version: 3.7-1
+Architecture: amd64
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent
+
+Package: exim4
+Version: 4.96-15
+Architecture: amd64
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent
+
+Package: mutt
+Version: 2.2-1
+Architecture: amd64
+Depends: exim4 | mail-transport-agent
+`
+
+var solverStatus = `Package: libc6
+Status: install ok installed
+Version: 2.31-13
+Architecture: amd64
+
+Package: oldtool
+Status: install ok installed
+Version: 1.0-1
+Architecture: amd64
+
+Package: exim4
+Status: install ok installed
+Version: 4.96-15
+Architecture: amd64
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent
+
+Package: mutt
+Status: install ok installed
+Version: 2.2-1
+Architecture: amd64
+Depends: exim4 | mail-transport-agent
+
+Package: libhello-data
+Status: deinstall ok config-files
+Version: 0.9-1
+Architecture: all
+`
+
+// }}}
+
+func newSolver(t *testing.T) *resolver.Solver {
+	available, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(solverPackages)))
+	isok(t, err)
+	installed, err := dpkg.ParseStatus(strings.NewReader(solverStatus))
+	isok(t, err)
+	return &resolver.Solver{
+		Arch:      dependency.AMD64,
+		Available: available,
+		Installed: installed,
+	}
+}
+
+func planString(plan resolver.Plan) string {
+	steps := []string{}
+	for _, step := range plan.Steps {
+		steps = append(steps, step.String())
+	}
+	return strings.Join(steps, ", ")
+}
+
+func TestSolveInstall(t *testing.T) {
+	solver := newSolver(t)
+
+	/* hello 2.0 needs a libhello1 that doesn't exist, so it's 1.0; that
+	 * needs a newer libc6, which Breaks the installed oldtool. */
+	plan, err := solver.Solve(resolver.Request{Install: []string{"hello"}})
+	isok(t, err)
+	assert(t, planString(plan) == "install hello (1.0-1), upgrade libc6 (2.31-13 => 2.36-9), install libhello-data (1.0-1), upgrade oldtool (1.0-1 => 2.0-1)")
+
+	step := plan.Find("libhello-data")
+	assert(t, step.ConfigFilesOnly && step.OldVersion.String() == "0.9-1")
+
+	/* Nothing to do */
+	plan, err = solver.Solve(resolver.Request{Install: []string{"mutt"}})
+	isok(t, err)
+	assert(t, len(plan.Steps) == 0)
+
+	_, err = solver.Solve(resolver.Request{Install: []string{"no-such-package"}})
+	notok(t, err)
+}
+
+func TestSolveConflicts(t *testing.T) {
+	solver := newSolver(t)
+
+	plan, err := solver.Solve(resolver.Request{Install: []string{"postfix"}})
+	isok(t, err)
+	assert(t, planString(plan) == "remove exim4 (4.96-15), install postfix (3.7-1)")
+
+	/* mutt needs an MTA, and installing another beats removing mutt */
+	plan, err = solver.Solve(resolver.Request{Remove: []string{"exim4"}})
+	isok(t, err)
+	assert(t, planString(plan) == "remove exim4 (4.96-15), install postfix (3.7-1)")
+
+	/* Unless there isn't one to install */
+	solver.Available = solver.Available[:len(solver.Available)-3]
+	plan, err = solver.Solve(resolver.Request{Remove: []string{"exim4"}})
+	isok(t, err)
+	assert(t, planString(plan) == "remove exim4 (4.96-15), remove mutt (2.2-1)")
+	solver = newSolver(t)
+
+	plan, err = solver.Solve(resolver.Request{Install: []string{"postfix", "mutt"}})
+	isok(t, err)
+	assert(t, planString(plan) == "remove exim4 (4.96-15), install postfix (3.7-1)")
+}
+
+func TestSolveUnsatisfiable(t *testing.T) {
+	solver := newSolver(t)
+
+	_, err := solver.Solve(resolver.Request{Install: []string{"hello=2.0-1"}})
+	notok(t, err)
+	unsatisfiable, ok := err.(*resolver.UnsatisfiableError)
+	assert(t, ok)
+	assert(t, len(unsatisfiable.Reasons) == 1)
+	assert(t, unsatisfiable.Reasons[0] == "hello : Depends: libhello1 (>= 2.0) but it is not installable")
+
+	/* With libc6 held, hello can't be installed at all */
+	solver.Selections = dpkg.Selections{"libc6": dpkg.WantHold}
+	_, err = solver.Solve(resolver.Request{Install: []string{"hello"}})
+	notok(t, err)
+	unsatisfiable, ok = err.(*resolver.UnsatisfiableError)
+	assert(t, ok)
+	assert(t, strings.Contains(err.Error(), "hello : Depends: libc6 (>= 2.36) but 2.31-13 is held"))
+
+	_, err = solver.Solve(resolver.Request{Remove: []string{"libc6"}})
+	notok(t, err)
+	assert(t, err.Error() == "Unmet dependencies: Request : Remove: libc6 but it is held")
+
+	solver.MaxSteps = 1
+	_, err = solver.Solve(resolver.Request{Install: []string{"hello"}})
+	notok(t, err)
+	_, ok = err.(*resolver.UnsatisfiableError)
+	assert(t, !ok)
+}
+
+func TestSolveMultiarch(t *testing.T) {
+	solver := newSolver(t)
+
+	/* i386 libraries next to the amd64 ones, as on any multiarch system */
+	foreign, err := dpkg.ParseStatus(strings.NewReader(`Package: libc6
+Status: install ok installed
+Version: 2.31-13
+Architecture: i386
+Multi-Arch: same
+
+Package: libgcc-s1
+Status: install ok installed
+Version: 12.2.0-14
+Architecture: i386
+Multi-Arch: same
+Depends: libc6 (>= 2.35)
+`))
+	isok(t, err)
+	solver.Installed.Packages = append(solver.Installed.Packages, foreign.Packages...)
+
+	plan, err := solver.Solve(resolver.Request{Install: []string{"hello"}})
+	isok(t, err)
+	assert(t, planString(plan) == "install hello (1.0-1), upgrade libc6 (2.31-13 => 2.36-9), install libhello-data (1.0-1), upgrade oldtool (1.0-1 => 2.0-1)")
+	assert(t, plan.Find("libc6").Architecture.CPU == "amd64")
+	assert(t, plan.Find("libgcc-s1") == nil)
+
+	/* Without an Arch, there's no telling which libc6 is meant */
+	solver.Arch = dependency.Arch{}
+	_, err = solver.Solve(resolver.Request{Install: []string{"hello"}})
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
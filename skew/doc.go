@@ -0,0 +1,11 @@
+/*
+Compare the versions of source packages across a set of suites, much like the
+version table on the Debian Package Tracker.
+
+Given the parsed Sources index for each suite (say, oldstable, stable,
+testing, unstable and experimental), this will produce one Row for each
+source package, containing the version in each suite, as well as flags for
+suites that have fallen behind unstable, and packages that haven't made it
+into testing at all.
+*/
+package skew // import "pault.ag/go/debian/skew"
@@ -0,0 +1,161 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package skew // import "pault.ag/go/debian/skew"
+
+import (
+	"sort"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/version"
+)
+
+// Suite {{{
+
+// A Suite is a named set of source packages, such as the contents of
+// the `main/source/Sources` index for `unstable`.
+//
+// Frozen suites (such as oldstable and stable) are expected to lag behind,
+// and will never be reported as out of date.
+type Suite struct {
+	Name    string
+	Sources []control.SourceIndex
+	Frozen  bool
+}
+
+// Return the highest version of every source package in the Suite. Sources
+// indices may (and for unstable, often do) contain more than one version of
+// the same source.
+func (s Suite) versions() map[string]version.Version {
+	ret := map[string]version.Version{}
+	for _, source := range s.Sources {
+		if current, ok := ret[source.Package]; ok {
+			if version.Compare(current, source.Version) >= 0 {
+				continue
+			}
+		}
+		ret[source.Package] = source.Version
+	}
+	return ret
+}
+
+// }}}
+
+// Row {{{
+
+// A Row is the version of a single source package in every Suite it appears
+// in.
+type Row struct {
+	Source   string
+	Versions map[string]version.Version
+
+	// Names of non-Frozen Suites that have an older version of this source
+	// than the reference suite (usually unstable).
+	OutOfDate []string
+
+	// Set if the source is in the reference suite, but not in testing.
+	NotInTesting bool
+}
+
+// Return the version of the source in the named Suite, and if the source
+// is in that Suite at all.
+func (r Row) Version(suite string) (version.Version, bool) {
+	v, ok := r.Versions[suite]
+	return v, ok
+}
+
+// Return true if the Row has anything worth flagging.
+func (r Row) Skewed() bool {
+	return r.NotInTesting || len(r.OutOfDate) != 0
+}
+
+// }}}
+
+// Report {{{
+
+// A Report is a list of Rows, one per source package, sorted by name.
+type Report []Row
+
+// Return only the Rows that are out of date, or missing from testing.
+func (r Report) Skewed() Report {
+	ret := Report{}
+	for _, row := range r {
+		if row.Skewed() {
+			ret = append(ret, row)
+		}
+	}
+	return ret
+}
+
+// Return the Row for the named source, or nil if no Suite contains it.
+func (r Report) Find(source string) *Row {
+	i := sort.Search(len(r), func(i int) bool { return r[i].Source >= source })
+	if i < len(r) && r[i].Source == source {
+		return &r[i]
+	}
+	return nil
+}
+
+// Given a set of Suites, compute a Report of each source's version in every
+// Suite. `reference` is the name of the Suite that everything else is
+// compared against (usually "unstable"), and `testing` is the name of the
+// Suite that sources are expected to migrate into (usually "testing"). Either
+// may be empty, which will disable the matching flag.
+//
+// Suites with a version newer than the reference (like experimental) are
+// not out of date.
+func Compute(suites []Suite, reference, testing string) Report {
+	rows := map[string]*Row{}
+	for _, suite := range suites {
+		for source, v := range suite.versions() {
+			row, ok := rows[source]
+			if !ok {
+				row = &Row{Source: source, Versions: map[string]version.Version{}}
+				rows[source] = row
+			}
+			row.Versions[suite.Name] = v
+		}
+	}
+
+	ret := Report{}
+	for _, row := range rows {
+		if want, ok := row.Versions[reference]; ok {
+			for _, suite := range suites {
+				if suite.Frozen || suite.Name == reference {
+					continue
+				}
+				if have, ok := row.Versions[suite.Name]; ok && version.Compare(have, want) < 0 {
+					row.OutOfDate = append(row.OutOfDate, suite.Name)
+				}
+			}
+			if testing != "" {
+				_, ok := row.Versions[testing]
+				row.NotInTesting = !ok
+			}
+		}
+		ret = append(ret, *row)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Source < ret[j].Source })
+	return ret
+}
+
+// }}}
+
+// vim: foldmethod=marker
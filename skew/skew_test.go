@@ -0,0 +1,118 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package skew_test
+
+import (
+	"bufio"
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/skew"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+func suite(t *testing.T, name string, frozen bool, sources string) skew.Suite {
+	index, err := control.ParseSourceIndex(bufio.NewReader(strings.NewReader(sources)))
+	isok(t, err)
+	return skew.Suite{Name: name, Sources: index, Frozen: frozen}
+}
+
+/*
+ *
+ */
+
+func TestCompute(t *testing.T) {
+	report := skew.Compute([]skew.Suite{
+		suite(t, "stable", true, `Package: hello
+Version: 2.9-2
+
+Package: fortune
+Version: 1.0-1
+`),
+		suite(t, "testing", false, `Package: hello
+Version: 2.10-1
+`),
+		suite(t, "unstable", false, `Package: hello
+Version: 2.10-1
+
+Package: hello
+Version: 2.10-2
+
+Package: fortune
+Version: 1.0-2
+
+Package: newthing
+Version: 0.1-1
+`),
+		suite(t, "experimental", false, `Package: hello
+Version: 3.0~rc1-1
+
+Package: fortune
+Version: 0.9-1
+`),
+	}, "unstable", "testing")
+
+	assert(t, len(report) == 3)
+	assert(t, report[0].Source == "fortune")
+
+	hello := report.Find("hello")
+	assert(t, hello != nil)
+	v, ok := hello.Version("unstable")
+	assert(t, ok)
+	assert(t, v.String() == "2.10-2")
+	assert(t, len(hello.OutOfDate) == 1)
+	assert(t, hello.OutOfDate[0] == "testing")
+	assert(t, !hello.NotInTesting)
+
+	fortune := report.Find("fortune")
+	assert(t, fortune.NotInTesting)
+	assert(t, len(fortune.OutOfDate) == 1)
+	assert(t, fortune.OutOfDate[0] == "experimental")
+
+	newthing := report.Find("newthing")
+	assert(t, newthing.NotInTesting)
+	_, ok = newthing.Version("stable")
+	assert(t, !ok)
+
+	assert(t, report.Find("missing") == nil)
+	assert(t, len(report.Skewed()) == 3)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,23 @@
+/*
+Unpack Debian source packages, as dpkg-source -x does, and apply the
+patches in them.
+
+	dsc, err := control.ParseDscFile("hello_2.10-3.dsc")
+	...
+	err = source.Unpack(dsc, "hello-2.10")
+
+The "3.0 (native)" and "3.0 (quilt)" formats are supported. For quilt,
+the patches listed in debian/patches/series are applied with a Patch,
+which can also be used on its own, for any unified diff:
+
+	patch, err := source.ParsePatchFile("fix-typo.patch")
+	...
+	err = patch.Apply("hello-2.10", 1)
+
+Patches have to apply cleanly, though they may have moved, as patch(1)
+allows; there's no fuzz.
+
+To download a source package first, see repo.Client.DownloadSource, or
+repo.DownloadSource for a .dsc URL, as dget(1) takes.
+*/
+package source // import "pault.ag/go/debian/source"
@@ -0,0 +1,381 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package source // import "pault.ag/go/debian/source"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Patch {{{
+
+// A Patch is a unified diff, such as one of the patches in
+// debian/patches, changing any number of files.
+type Patch struct {
+	Files []FilePatch
+}
+
+// A FilePatch is the part of a Patch that changes a single file.
+type FilePatch struct {
+	// The paths from the "---" and "+++" lines, without any timestamp.
+	// A file being created has an Old path of "/dev/null", and a file
+	// being removed has a New path of "/dev/null".
+	Old string
+	New string
+
+	Hunks []Hunk
+}
+
+// A Hunk is a single "@@ -1,3 +1,4 @@" section of a FilePatch.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+
+	// The lines of the Hunk, each starting with ' ', '-' or '+', and
+	// ending with its line ending, if it has one (a line followed by
+	// "\ No newline at end of file" doesn't).
+	Lines []string
+}
+
+// Return the lines the Hunk expects to find (for which, with the
+// leading character removed, which is '-'), or those it puts in their
+// place (for '+').
+func (h Hunk) side(which byte) []string {
+	ret := []string{}
+	for _, line := range h.Lines {
+		if line[0] == ' ' || line[0] == which {
+			ret = append(ret, line[1:])
+		}
+	}
+	return ret
+}
+
+// Return true if the FilePatch creates the file.
+func (f FilePatch) Creates() bool {
+	return f.Old == "/dev/null"
+}
+
+// Return true if the FilePatch removes the file.
+func (f FilePatch) Deletes() bool {
+	return f.New == "/dev/null"
+}
+
+// Return the path of the file being changed, with the first strip
+// components taken off, as patch(1) does with -p. It is an error for the
+// path to have fewer components than that, or to point outside the tree.
+func (f FilePatch) Path(strip int) (string, error) {
+	name := f.New
+	if f.Deletes() {
+		name = f.Old
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) <= strip {
+		return "", fmt.Errorf("Can't strip %d components from '%s'", strip, name)
+	}
+	ret := path.Clean(strings.Join(parts[strip:], "/"))
+	if path.IsAbs(ret) || ret == ".." || strings.HasPrefix(ret, "../") {
+		return "", fmt.Errorf("Patched file '%s' is outside the tree", name)
+	}
+	return ret, nil
+}
+
+// Apply the FilePatch to the contents of the file, returning what it
+// should now contain. Each Hunk is looked for where it says it applies,
+// then at increasing distances either side of there (allowing for lines
+// added or removed by other patches), but its context has to match
+// exactly.
+func (f FilePatch) Apply(data []byte) ([]byte, error) {
+	lines := splitLines(string(data))
+	out := []string{}
+	pos, offset := 0, 0
+	for i, hunk := range f.Hunks {
+		old := hunk.side('-')
+		start := hunk.OldStart - 1 + offset
+		if hunk.OldLines == 0 {
+			/* A Hunk that only adds lines gives the line they go after */
+			start++
+		}
+		at, ok := find(lines, old, start, pos)
+		if !ok {
+			return nil, fmt.Errorf("Hunk #%d of '%s' doesn't apply", i+1, f.New)
+		}
+		out = append(out, lines[pos:at]...)
+		out = append(out, hunk.side('+')...)
+		pos = at + len(old)
+		offset += at - start
+	}
+	out = append(out, lines[pos:]...)
+	return []byte(strings.Join(out, "")), nil
+}
+
+// Split text into lines, each keeping its line ending.
+func splitLines(text string) []string {
+	ret := []string{}
+	for text != "" {
+		end := strings.IndexByte(text, '\n') + 1
+		if end == 0 {
+			end = len(text)
+		}
+		ret = append(ret, text[:end])
+		text = text[end:]
+	}
+	return ret
+}
+
+// Find where want appears in lines, at or after min, nearest to start.
+func find(lines, want []string, start, min int) (int, bool) {
+	matches := func(at int) bool {
+		if at < min || at+len(want) > len(lines) {
+			return false
+		}
+		for i, line := range want {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+	for distance := 0; start-distance >= min || start+distance <= len(lines); distance++ {
+		if matches(start - distance) {
+			return start - distance, true
+		}
+		if matches(start + distance) {
+			return start + distance, true
+		}
+	}
+	return 0, false
+}
+
+// Apply each FilePatch to the tree at dir, taking strip components off
+// the paths in the Patch, as patch(1) does with -p. Files are never read
+// or written through a symlink. Every FilePatch is worked out before
+// anything is written, so if any of them don't apply, the tree is left
+// alone.
+func (p Patch) Apply(dir string, strip int) error {
+	type result struct {
+		target  string
+		data    []byte
+		deleted bool
+	}
+	results := map[string]*result{}
+	order := []string{}
+
+	for _, file := range p.Files {
+		name, err := file.Path(strip)
+		if err != nil {
+			return err
+		}
+		current, seen := results[name]
+		if !seen {
+			target, err := safeTarget(dir, name)
+			if err != nil {
+				return err
+			}
+			current = &result{target: target}
+			data, err := os.ReadFile(target)
+			switch {
+			case os.IsNotExist(err):
+				current.deleted = true
+			case err != nil:
+				return err
+			default:
+				current.data = data
+			}
+			results[name] = current
+			order = append(order, name)
+		}
+
+		if file.Creates() && !current.deleted && len(current.data) != 0 {
+			return fmt.Errorf("'%s' already exists", name)
+		}
+		if !file.Creates() && current.deleted {
+			return fmt.Errorf("'%s' doesn't exist", name)
+		}
+		data, err := file.Apply(current.data)
+		if err != nil {
+			return err
+		}
+		current.data, current.deleted = data, file.Deletes()
+	}
+
+	for _, name := range order {
+		target := results[name].target
+		if results[name].deleted {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(target); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, results[name].data, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// }}}
+
+// Parsing {{{
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Parse a patch file off the disk.
+func ParsePatchFile(pathname string) (*Patch, error) {
+	f, err := os.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParsePatch(f)
+}
+
+// Parse a unified diff, as written by diff -u, git diff or quilt. Any
+// text that isn't part of a FilePatch (such as the DEP-3 header of a
+// patch in debian/patches) is skipped.
+func ParsePatch(reader io.Reader) (*Patch, error) {
+	lines := []string{}
+	buffered := bufio.NewReader(reader)
+	for {
+		line, err := buffered.ReadString('\n')
+		if line != "" {
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret := Patch{}
+	for i := 0; i < len(lines); {
+		if !strings.HasPrefix(lines[i], "--- ") || i+1 == len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+			i++
+			continue
+		}
+		file := FilePatch{Old: patchName(lines[i]), New: patchName(lines[i+1])}
+		i += 2
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@ ") {
+			hunk, n, err := parseHunk(lines[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", file.New, err)
+			}
+			file.Hunks = append(file.Hunks, *hunk)
+			i += n
+		}
+		ret.Files = append(ret.Files, file)
+	}
+	return &ret, nil
+}
+
+// Return the path from a "---" or "+++" line, without the timestamp that
+// follows it after a tab.
+func patchName(line string) string {
+	name := strings.TrimRight(line[4:], "\r\n")
+	if tab := strings.IndexByte(name, '\t'); tab >= 0 {
+		name = name[:tab]
+	}
+	return name
+}
+
+// Parse the Hunk at the start of lines, returning it and how many lines
+// it took up.
+func parseHunk(lines []string) (*Hunk, int, error) {
+	match := hunkHeader.FindStringSubmatch(lines[0])
+	if match == nil {
+		return nil, 0, fmt.Errorf("Malformed hunk header '%s'", strings.TrimSpace(lines[0]))
+	}
+	number := func(value string) int {
+		if value == "" {
+			return 1
+		}
+		/* The regular expression only lets digits through */
+		n, _ := strconv.Atoi(value)
+		return n
+	}
+	hunk := Hunk{
+		OldStart: number(match[1]), OldLines: number(match[2]),
+		NewStart: number(match[3]), NewLines: number(match[4]),
+	}
+
+	oldLeft, newLeft := hunk.OldLines, hunk.NewLines
+	i := 1
+	for ; oldLeft > 0 || newLeft > 0; i++ {
+		if i == len(lines) {
+			return nil, 0, fmt.Errorf("Hunk at line %d is cut short", hunk.OldStart)
+		}
+		line := lines[i]
+		if line == "\n" || line == "\r\n" {
+			/* Some editors strip the space off empty context lines */
+			line = " " + line
+		}
+		switch line[0] {
+		case ' ':
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		case '\\':
+			noNewline(&hunk)
+			continue
+		default:
+			return nil, 0, fmt.Errorf("Malformed line in hunk: '%s'", strings.TrimSpace(line))
+		}
+		hunk.Lines = append(hunk.Lines, line)
+	}
+	if oldLeft < 0 || newLeft < 0 {
+		return nil, 0, fmt.Errorf("Hunk at line %d is longer than its header says", hunk.OldStart)
+	}
+	if i < len(lines) && strings.HasPrefix(lines[i], `\`) {
+		noNewline(&hunk)
+		i++
+	}
+	return &hunk, i, nil
+}
+
+// Handle a "\ No newline at end of file" line, which is about the line
+// before it.
+func noNewline(hunk *Hunk) {
+	if n := len(hunk.Lines); n != 0 {
+		hunk.Lines[n-1] = strings.TrimRight(hunk.Lines[n-1], "\r\n")
+	}
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,239 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package source_test
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/source"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// {{{ test patch
+var testPatch = `Description: Fix the greeting
+Author: Test Maintainer <test@example.com>
+Forwarded: not-needed
+
+Index: hello/src/hello.c
+===================================================================
+--- hello.orig/src/hello.c	2024-01-01 00:00:00.000000000 +0000
++++ hello/src/hello.c	2024-01-01 00:00:00.000000000 +0000
+@@ -1,5 +1,5 @@
+ #include <stdio.h>
+ 
+ int main(void) {
+-	printf("Helo, world\n");
++	printf("Hello, world\n");
+ 	return 0;
+@@ -8,3 +8,4 @@
+ void unused(void) {
+ }
+ /* end */
++/* patched */
+--- /dev/null
++++ hello/NEWS
+@@ -0,0 +1,2 @@
++2.10-3
++  No trailing newline
+\ No newline at end of file
+--- hello.orig/TODO
++++ /dev/null
+@@ -1 +0,0 @@
+-Everything
+`
+
+// }}}
+
+// {{{ test source
+var helloC = `#include <stdio.h>
+
+int main(void) {
+	printf("Helo, world\n");
+	return 0;
+}
+
+void unused(void) {
+}
+/* end */
+`
+
+// }}}
+
+func TestParsePatch(t *testing.T) {
+	patch, err := source.ParsePatch(strings.NewReader(testPatch))
+	isok(t, err)
+	assert(t, len(patch.Files) == 3)
+
+	file := patch.Files[0]
+	assert(t, file.Old == "hello.orig/src/hello.c")
+	assert(t, file.New == "hello/src/hello.c")
+	assert(t, len(file.Hunks) == 2)
+	assert(t, file.Hunks[0].OldStart == 1 && file.Hunks[0].OldLines == 5)
+	assert(t, len(file.Hunks[0].Lines) == 6)
+	assert(t, file.Hunks[0].Lines[1] == " \n")
+
+	name, err := file.Path(1)
+	isok(t, err)
+	assert(t, name == "src/hello.c")
+	_, err = file.Path(3)
+	notok(t, err)
+
+	assert(t, patch.Files[1].Creates())
+	assert(t, patch.Files[1].Hunks[0].Lines[1] == "+  No trailing newline")
+	assert(t, patch.Files[2].Deletes())
+	name, err = patch.Files[2].Path(1)
+	isok(t, err)
+	assert(t, name == "TODO")
+
+	_, err = source.ParsePatch(strings.NewReader("--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n-one\n"))
+	notok(t, err)
+	_, err = source.ParsePatch(strings.NewReader("--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n-one\n?two\n"))
+	notok(t, err)
+}
+
+func TestFilePatchApply(t *testing.T) {
+	patch, err := source.ParsePatch(strings.NewReader(testPatch))
+	isok(t, err)
+
+	/* The hunks still apply with lines added above them */
+	data, err := patch.Files[0].Apply([]byte("/* header */\n/* more */\n" + helloC))
+	isok(t, err)
+	assert(t, string(data) == "/* header */\n/* more */\n"+
+		strings.Replace(helloC, "Helo", "Hello", 1)+"/* patched */\n")
+
+	_, err = patch.Files[0].Apply([]byte(strings.Replace(helloC, "return 0", "return 1", 1)))
+	notok(t, err)
+
+	data, err = patch.Files[1].Apply(nil)
+	isok(t, err)
+	assert(t, string(data) == "2.10-3\n  No trailing newline")
+}
+
+func TestPatchApply(t *testing.T) {
+	dir := t.TempDir()
+	isok(t, os.MkdirAll(filepath.Join(dir, "src"), 0755))
+	isok(t, os.WriteFile(filepath.Join(dir, "src", "hello.c"), []byte(helloC), 0600))
+	isok(t, os.WriteFile(filepath.Join(dir, "TODO"), []byte("Everything\n"), 0644))
+
+	patch, err := source.ParsePatch(strings.NewReader(testPatch))
+	isok(t, err)
+	isok(t, patch.Apply(dir, 1))
+
+	data, err := os.ReadFile(filepath.Join(dir, "src", "hello.c"))
+	isok(t, err)
+	assert(t, strings.Contains(string(data), `"Hello, world\n"`))
+	info, err := os.Stat(filepath.Join(dir, "src", "hello.c"))
+	isok(t, err)
+	assert(t, info.Mode().Perm() == 0600)
+
+	data, err = os.ReadFile(filepath.Join(dir, "NEWS"))
+	isok(t, err)
+	assert(t, string(data) == "2.10-3\n  No trailing newline")
+	_, err = os.Stat(filepath.Join(dir, "TODO"))
+	assert(t, os.IsNotExist(err))
+
+	/* Applying it again fails, and changes nothing */
+	notok(t, patch.Apply(dir, 1))
+	again, err := os.ReadFile(filepath.Join(dir, "NEWS"))
+	isok(t, err)
+	assert(t, string(again) == string(data))
+}
+
+func TestPatchApplySymlink(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	isok(t, os.Symlink(outside, filepath.Join(dir, "evil")))
+
+	patch, err := source.ParsePatch(strings.NewReader(`--- /dev/null
++++ b/evil/pwned
+@@ -0,0 +1 @@
++pwned
+`))
+	isok(t, err)
+	notok(t, patch.Apply(dir, 1))
+	_, err = os.Stat(filepath.Join(outside, "pwned"))
+	assert(t, os.IsNotExist(err))
+
+	isok(t, os.WriteFile(filepath.Join(outside, "target"), []byte("old\n"), 0644))
+	isok(t, os.Symlink(filepath.Join(outside, "target"), filepath.Join(dir, "link")))
+	patch, err = source.ParsePatch(strings.NewReader(`--- a/link
++++ b/link
+@@ -1 +1 @@
+-old
++new
+`))
+	isok(t, err)
+	notok(t, patch.Apply(dir, 1))
+}
+
+func TestParseSeries(t *testing.T) {
+	series, err := source.ParseSeries(strings.NewReader(`# Sent upstream
+fix-greeting.patch
+old-style.diff -p0
+debian/local.patch # ours
+
+`))
+	isok(t, err)
+	assert(t, len(series) == 3)
+	assert(t, series[0] == source.SeriesEntry{Name: "fix-greeting.patch", Strip: 1})
+	assert(t, series[1] == source.SeriesEntry{Name: "old-style.diff", Strip: 0})
+	assert(t, series[2] == source.SeriesEntry{Name: "debian/local.patch", Strip: 1})
+
+	_, err = source.ParseSeries(strings.NewReader("fix.patch -R\n"))
+	notok(t, err)
+	_, err = source.ParseSeries(strings.NewReader("../../escape.patch\n"))
+	notok(t, err)
+	_, err = source.ParseSeries(strings.NewReader("/etc/passwd\n"))
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
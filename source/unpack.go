@@ -0,0 +1,429 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package source // import "pault.ag/go/debian/source"
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/control"
+)
+
+// Series {{{
+
+// A SeriesEntry is a line of a quilt series file: a patch, and how many
+// path components to strip from it, as with patch -p.
+type SeriesEntry struct {
+	Name  string
+	Strip int
+}
+
+// Parse a quilt series file, such as debian/patches/series. Blank lines
+// and comments are skipped.
+func ParseSeries(reader io.Reader) ([]SeriesEntry, error) {
+	ret := []SeriesEntry{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if hash := strings.Index(line, "#"); hash == 0 || (hash > 0 && line[hash-1] == ' ') {
+			line = line[:hash]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		entry := SeriesEntry{Name: fields[0], Strip: 1}
+		if clean := path.Clean(entry.Name); path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("Patch '%s' is outside the patches directory", entry.Name)
+		}
+		for _, option := range fields[1:] {
+			switch {
+			case strings.HasPrefix(option, "-p"):
+				strip, err := strconv.Atoi(option[2:])
+				if err != nil || strip < 0 {
+					return nil, fmt.Errorf("Bad option '%s' for patch '%s'", option, entry.Name)
+				}
+				entry.Strip = strip
+			default:
+				return nil, fmt.Errorf("Unsupported option '%s' for patch '%s'", option, entry.Name)
+			}
+		}
+		ret = append(ret, entry)
+	}
+	return ret, scanner.Err()
+}
+
+// }}}
+
+// Unpacking {{{
+
+// What dpkg-source allows as the name of an orig-component tarball's
+// component, which becomes a directory name.
+var componentName = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// Unpack the source package described by the .dsc (with its files
+// alongside it, as DSC.Filename says) into dest, as dpkg-source -x does.
+// dest must not already exist.
+//
+// A "3.0 (native)" package is just the one tarball. For "3.0 (quilt)",
+// the orig tarball is unpacked, then any orig-component tarballs into
+// directories named for their component, then the debian tarball over
+// the top (replacing any debian directory upstream had). The patches in
+// debian/patches/series are then applied, with a .pc directory recording
+// them, as quilt does, so "quilt pop" works.
+//
+// The files are checked against the .dsc before anything is unpacked.
+func Unpack(dsc *control.DSC, dest string) error {
+	if err := dsc.VerifyFiles(); err != nil {
+		return err
+	}
+	files, err := dsc.GetFiles()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("'%s' already exists", dest)
+	}
+
+	dir := filepath.Dir(dsc.Filename)
+	var native, orig, debian string
+	components := map[string]string{}
+	for _, file := range files {
+		name := file.Filename
+		switch {
+		case strings.HasSuffix(name, ".asc"):
+		case strings.Contains(name, ".orig.tar."):
+			orig = name
+		case strings.Contains(name, ".orig-"):
+			component := name[strings.Index(name, ".orig-")+len(".orig-"):]
+			component = component[:strings.Index(component+".tar.", ".tar.")]
+			if !componentName.MatchString(component) {
+				return fmt.Errorf("Invalid orig tarball component '%s' in '%s'", component, name)
+			}
+			components[component] = name
+		case strings.Contains(name, ".debian.tar."):
+			debian = name
+		case strings.Contains(name, ".tar."):
+			native = name
+		}
+	}
+
+	switch dsc.Format {
+	case "3.0 (native)":
+		if native == "" {
+			return fmt.Errorf("No tarball in %s", dsc.Filename)
+		}
+		return extract(filepath.Join(dir, native), dest, true)
+	case "3.0 (quilt)":
+		if orig == "" || debian == "" {
+			return fmt.Errorf("%s needs both an orig and a debian tarball", dsc.Filename)
+		}
+	default:
+		return fmt.Errorf("Unsupported source format '%s'", dsc.Format)
+	}
+
+	if err := extract(filepath.Join(dir, orig), dest, true); err != nil {
+		return err
+	}
+	for component, name := range components {
+		if err := os.RemoveAll(filepath.Join(dest, component)); err != nil {
+			return err
+		}
+		if err := extract(filepath.Join(dir, name), filepath.Join(dest, component), true); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(dest, "debian")); err != nil {
+		return err
+	}
+	if err := extract(filepath.Join(dir, debian), dest, false); err != nil {
+		return err
+	}
+	return applySeries(dest)
+}
+
+// Apply the patches in debian/patches/series to the tree at dir, backing
+// up what they change into .pc, as quilt push -a does.
+func applySeries(dir string) error {
+	f, err := os.Open(filepath.Join(dir, "debian", "patches", "series"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	series, err := ParseSeries(f)
+	if err != nil {
+		return err
+	}
+	if len(series) == 0 {
+		return nil
+	}
+
+	pc := filepath.Join(dir, ".pc")
+	for name, content := range map[string]string{
+		".version":       "2\n",
+		".quilt_patches": "debian/patches\n",
+		".quilt_series":  "series\n",
+	} {
+		if err := writeFile(filepath.Join(pc, name), []byte(content)); err != nil {
+			return err
+		}
+	}
+
+	applied := []string{}
+	for _, entry := range series {
+		pathname, err := safeTarget(dir, path.Join("debian/patches", entry.Name))
+		if err != nil {
+			return err
+		}
+		patch, err := ParsePatchFile(pathname)
+		if err != nil {
+			return err
+		}
+		backupDir, err := safeJoin(dir, path.Join(".pc", entry.Name))
+		if err != nil {
+			return err
+		}
+		if err := backup(*patch, entry, dir, backupDir); err != nil {
+			return err
+		}
+		if err := patch.Apply(dir, entry.Strip); err != nil {
+			return fmt.Errorf("%s: %s", entry.Name, err)
+		}
+		applied = append(applied, entry.Name)
+		if err := writeFile(filepath.Join(pc, "applied-patches"), []byte(strings.Join(applied, "\n")+"\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copy each file the Patch changes into the backup directory, as quilt
+// does, so it can be unapplied again; a file the Patch creates is backed
+// up as an empty file.
+func backup(patch Patch, entry SeriesEntry, dir, backupDir string) error {
+	for _, file := range patch.Files {
+		name, err := file.Path(entry.Strip)
+		if err != nil {
+			return fmt.Errorf("%s: %s", entry.Name, err)
+		}
+		source, err := safeTarget(dir, name)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(source)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		target, err := safeTarget(backupDir, name)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(target, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(pathname string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(pathname, data, 0644)
+}
+
+// }}}
+
+// Tarballs {{{
+
+// Work out whether every member of the tarball is in one directory, as
+// upstream tarballs usually are, such as "hello-2.10/".
+func singleTopDirectory(pathname string) (bool, error) {
+	f, err := os.Open(pathname)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	r, err := compression.NewReader(f)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	top := ""
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return top != "", nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		first, _, nested := strings.Cut(strings.TrimPrefix(hdr.Name, "./"), "/")
+		if (!nested && hdr.Typeflag != tar.TypeDir) || (top != "" && first != top) {
+			return false, nil
+		}
+		top = first
+	}
+}
+
+// Return where a member of a tarball goes under dest, refusing anything
+// that would end up outside it, or be written through a symlink.
+func safeJoin(dest, name string) (string, error) {
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		return dest, nil
+	}
+	parent := dest
+	for _, part := range strings.Split(path.Dir(name), "/") {
+		if part == "." {
+			break
+		}
+		parent = filepath.Join(parent, part)
+		if info, err := os.Lstat(parent); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("'%s' is inside a symlink", name)
+		}
+	}
+	return filepath.Join(dest, filepath.FromSlash(name)), nil
+}
+
+// As safeJoin, but for a file that's going to be read or written in
+// place, so it mustn't be a symlink itself either.
+func safeTarget(dest, name string) (string, error) {
+	target, err := safeJoin(dest, name)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("'%s' is a symlink", name)
+	}
+	return target, nil
+}
+
+// Unpack the (compressed) tarball at pathname into dest, taking off the
+// directory everything is in if strip is set and there is just the one.
+func extract(pathname, dest string, strip bool) error {
+	if strip {
+		single, err := singleTopDirectory(pathname)
+		if err != nil {
+			return err
+		}
+		strip = single
+	}
+
+	f, err := os.Open(pathname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := compression.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", filepath.Base(pathname), err)
+		}
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if strip {
+			_, name, _ = strings.Cut(name, "/")
+		}
+		if name == "" || hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		target, err := safeJoin(dest, name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			os.Remove(target)
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			link := strings.TrimPrefix(hdr.Linkname, "./")
+			if strip {
+				_, link, _ = strings.Cut(link, "/")
+			}
+			source, err := safeJoin(dest, link)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,168 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package source_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/source"
+	"pault.ag/go/debian/testsupport"
+)
+
+/*
+ *
+ */
+
+// Build the source package into dir, and return its parsed .dsc.
+func writeSource(t *testing.T, src testsupport.Source, dir string) *control.DSC {
+	files, order, err := src.Build()
+	isok(t, err)
+	for _, name := range order {
+		isok(t, os.WriteFile(filepath.Join(dir, name), files[name], 0644))
+	}
+	dsc, err := control.ParseDscFile(filepath.Join(dir, order[0]))
+	isok(t, err)
+	return dsc
+}
+
+func readFile(t *testing.T, pathname string) string {
+	data, err := os.ReadFile(pathname)
+	isok(t, err)
+	return string(data)
+}
+
+var quiltSource = testsupport.Source{
+	Package: "hello",
+	Version: "2.10-3",
+	Upstream: map[string]string{
+		"src/hello.c":  helloC,
+		"TODO":         "Everything\n",
+		"debian/junk":  "upstream's packaging\n",
+		"docs/ref.txt": "reference\n",
+	},
+	Files: map[string]string{
+		"debian/rules":                      "#!/usr/bin/make -f\n%:\n\tdh $@\n",
+		"debian/patches/series":             "fix-greeting.patch\n",
+		"debian/patches/fix-greeting.patch": testPatch,
+	},
+}
+
+func TestUnpackQuilt(t *testing.T) {
+	dir := t.TempDir()
+	dsc := writeSource(t, quiltSource, dir)
+	assert(t, dsc.Format == "3.0 (quilt)")
+
+	dest := filepath.Join(dir, "hello-2.10")
+	isok(t, source.Unpack(dsc, dest))
+
+	assert(t, strings.Contains(readFile(t, filepath.Join(dest, "src", "hello.c")), `"Hello, world\n"`))
+	assert(t, readFile(t, filepath.Join(dest, "NEWS")) == "2.10-3\n  No trailing newline")
+	assert(t, readFile(t, filepath.Join(dest, "docs", "ref.txt")) == "reference\n")
+	_, err := os.Stat(filepath.Join(dest, "TODO"))
+	assert(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dest, "debian", "junk"))
+	assert(t, os.IsNotExist(err))
+
+	info, err := os.Stat(filepath.Join(dest, "debian", "rules"))
+	isok(t, err)
+	assert(t, info.Mode().Perm() == 0755)
+
+	/* quilt can take the patches back off again */
+	assert(t, readFile(t, filepath.Join(dest, ".pc", "applied-patches")) == "fix-greeting.patch\n")
+	assert(t, readFile(t, filepath.Join(dest, ".pc", "fix-greeting.patch", "src", "hello.c")) == helloC)
+	assert(t, readFile(t, filepath.Join(dest, ".pc", "fix-greeting.patch", "TODO")) == "Everything\n")
+	assert(t, readFile(t, filepath.Join(dest, ".pc", "fix-greeting.patch", "NEWS")) == "")
+
+	/* It won't unpack over the top of something */
+	notok(t, source.Unpack(dsc, dest))
+}
+
+func TestUnpackNative(t *testing.T) {
+	dir := t.TempDir()
+	dsc := writeSource(t, testsupport.Source{
+		Package: "hello",
+		Version: "1.0",
+		Files:   map[string]string{"debian/rules": "#!/usr/bin/make -f\n", "README": "hi\n"},
+	}, dir)
+
+	dest := filepath.Join(dir, "hello-1.0")
+	isok(t, source.Unpack(dsc, dest))
+	assert(t, readFile(t, filepath.Join(dest, "README")) == "hi\n")
+	_, err := os.Stat(filepath.Join(dest, ".pc"))
+	assert(t, os.IsNotExist(err))
+}
+
+func TestUnpackBadPatch(t *testing.T) {
+	broken := quiltSource
+	broken.Upstream = map[string]string{"src/hello.c": "something else\n", "TODO": "Everything\n"}
+
+	dir := t.TempDir()
+	notok(t, source.Unpack(writeSource(t, broken, dir), filepath.Join(dir, "hello-2.10")))
+}
+
+func TestUnpackCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	dsc := writeSource(t, quiltSource, dir)
+	isok(t, os.WriteFile(filepath.Join(dir, "hello_2.10.orig.tar.gz"), []byte("not a tarball"), 0644))
+
+	dest := filepath.Join(dir, "hello-2.10")
+	notok(t, source.Unpack(dsc, dest))
+	_, err := os.Stat(dest)
+	assert(t, os.IsNotExist(err))
+}
+
+func TestUnpackBadComponent(t *testing.T) {
+	dir := t.TempDir()
+	dsc := writeSource(t, quiltSource, dir)
+
+	/* A component of ".." would have Unpack clear out dest's parent */
+	name := "hello_2.10.orig-...tar.gz"
+	data := []byte("not a tarball")
+	isok(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+	dsc.ChecksumsSha256 = append(dsc.ChecksumsSha256, control.SHA256FileHash{FileHash: control.FileHash{
+		Algorithm: "sha256",
+		Hash:      fmt.Sprintf("%x", sha256.Sum256(data)),
+		Size:      int64(len(data)),
+		Filename:  name,
+	}})
+
+	notok(t, source.Unpack(dsc, filepath.Join(dir, "hello-2.10")))
+	_, err := os.Stat(filepath.Join(dir, name))
+	isok(t, err)
+}
+
+func TestUnpackSeriesOutsideTree(t *testing.T) {
+	escaping := quiltSource
+	escaping.Files = map[string]string{
+		"debian/rules":          "#!/usr/bin/make -f\n",
+		"debian/patches/series": "../../../../evil.patch\n",
+	}
+	dir := t.TempDir()
+	notok(t, source.Unpack(writeSource(t, escaping, dir), filepath.Join(dir, "hello-2.10")))
+}
+
+// vim: foldmethod=marker
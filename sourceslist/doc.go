@@ -0,0 +1,18 @@
+/*
+Parse and write APT's sources.list(5), in both the one-line format used in
+/etc/apt/sources.list:
+
+	deb [arch=amd64 signed-by=/usr/share/keyrings/debian-archive-keyring.gpg] https://deb.debian.org/debian bookworm main contrib
+
+and the deb822 format of /etc/apt/sources.list.d/*.sources:
+
+	Types: deb deb-src
+	URIs: https://deb.debian.org/debian
+	Suites: bookworm bookworm-updates
+	Components: main contrib
+	Signed-By: /usr/share/keyrings/debian-archive-keyring.gpg
+
+Either way, each source is read into an Entry, and can be written back out
+in either format.
+*/
+package sourceslist // import "pault.ag/go/debian/sourceslist"
@@ -0,0 +1,280 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package sourceslist // import "pault.ag/go/debian/sourceslist"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+// Entry {{{
+
+// An Entry is one source: a deb822 stanza, or a line of the one-line
+// format. Options that don't have a field of their own (such as Trusted or
+// Languages) are kept in the Paragraph, by their deb822 name.
+type Entry struct {
+	control.Paragraph
+
+	Types      []string `required:"true" delim:" "`
+	URIs       []string `required:"true" delim:" "`
+	Suites     []string `required:"true" delim:" "`
+	Components []string `delim:" "`
+
+	Architectures []dependency.Arch
+	// Keyring paths or fingerprints, or an armored key inline.
+	SignedBy string `control:"Signed-By,multiline"`
+}
+
+// Return false if the Entry has been turned off with "Enabled: no".
+func (e Entry) Enabled() bool {
+	return e.Values["Enabled"] != "no"
+}
+
+// }}}
+
+// Options {{{
+
+// One-line option names, and the deb822 fields they are.
+var optionFields = map[string]string{
+	"arch":                        "Architectures",
+	"lang":                        "Languages",
+	"target":                      "Targets",
+	"pdiffs":                      "PDiffs",
+	"by-hash":                     "By-Hash",
+	"allow-insecure":              "Allow-Insecure",
+	"allow-weak":                  "Allow-Weak",
+	"allow-downgrade-to-insecure": "Allow-Downgrade-To-Insecure",
+	"trusted":                     "Trusted",
+	"signed-by":                   "Signed-By",
+	"check-valid-until":           "Check-Valid-Until",
+	"valid-until-min":             "Valid-Until-Min",
+	"valid-until-max":             "Valid-Until-Max",
+	"check-date":                  "Check-Date",
+	"date-max-future":             "Date-Max-Future",
+	"inrelease-path":              "InRelease-Path",
+	"snapshot":                    "Snapshot",
+}
+
+// Options whose values are lists; comma separated in the one-line format,
+// and space separated in deb822.
+var listOptions = map[string]bool{
+	"arch":   true,
+	"lang":   true,
+	"target": true,
+}
+
+// The deb822 field for a one-line option, and whether it's a list.
+// "arch+=" and "arch-=" become Architectures-Add and Architectures-Remove.
+func optionField(option string) (string, bool) {
+	suffix := ""
+	switch {
+	case strings.HasSuffix(option, "+"):
+		option, suffix = strings.TrimSuffix(option, "+"), "-Add"
+	case strings.HasSuffix(option, "-"):
+		option, suffix = strings.TrimSuffix(option, "-"), "-Remove"
+	}
+	if field, ok := optionFields[option]; ok {
+		return field + suffix, listOptions[option]
+	}
+	return option + suffix, false
+}
+
+// The one-line option for a deb822 field, and whether it's a list.
+func fieldOption(field string) (string, bool) {
+	suffix := ""
+	switch {
+	case strings.HasSuffix(field, "-Add"):
+		field, suffix = strings.TrimSuffix(field, "-Add"), "+"
+	case strings.HasSuffix(field, "-Remove"):
+		field, suffix = strings.TrimSuffix(field, "-Remove"), "-"
+	}
+	for option, name := range optionFields {
+		if strings.EqualFold(name, field) {
+			return option + suffix, listOptions[option]
+		}
+	}
+	return strings.ToLower(field) + suffix, false
+}
+
+// }}}
+
+// Parsing {{{
+
+// Parse a deb822 .sources file.
+func ParseDeb822(reader io.Reader) ([]Entry, error) {
+	ret := []Entry{}
+	if err := control.Unmarshal(&ret, bufio.NewReader(reader)); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Parse a one-line sources.list file. Comments and blank lines are
+// skipped, including commented out entries.
+func ParseOneLine(reader io.Reader) ([]Entry, error) {
+	ret := []Entry{}
+	scanner := bufio.NewScanner(reader)
+	number := 0
+	for scanner.Scan() {
+		number++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		entry, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", number, err)
+		}
+		ret = append(ret, *entry)
+	}
+	return ret, scanner.Err()
+}
+
+// Parse a single line of the one-line format.
+func parseLine(line string) (*Entry, error) {
+	fields := strings.Fields(line)
+	para := control.Paragraph{Values: map[string]string{}}
+	para.Set("Types", fields[0])
+	fields = fields[1:]
+
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "[") {
+		/* The options run up to the closing bracket, however it's spaced */
+		options := strings.TrimPrefix(strings.Join(fields, " "), "[")
+		end := strings.Index(options, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("Unterminated options")
+		}
+		for _, option := range strings.Fields(options[:end]) {
+			key, value, ok := strings.Cut(option, "=")
+			if !ok {
+				return nil, fmt.Errorf("Malformed option: '%s'", option)
+			}
+			field, list := optionField(key)
+			if list {
+				value = strings.Join(strings.Split(value, ","), " ")
+			}
+			para.Set(field, value)
+		}
+		fields = strings.Fields(options[end+1:])
+	}
+
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("Missing URI or suite")
+	}
+	para.Set("URIs", fields[0])
+	para.Set("Suites", fields[1])
+	if len(fields) > 2 {
+		para.Set("Components", strings.Join(fields[2:], " "))
+	}
+
+	entry := Entry{}
+	if err := control.UnpackFromParagraph(para, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Parse a file off the disk, as one-line or deb822 going by whether its
+// name ends in ".sources".
+func ParseFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.HasSuffix(path, ".sources") {
+		return ParseDeb822(f)
+	}
+	return ParseOneLine(f)
+}
+
+// }}}
+
+// Writing {{{
+
+// Write the entries out in the deb822 format.
+func WriteDeb822(out io.Writer, entries []Entry) error {
+	return control.Marshal(out, entries)
+}
+
+// Write the entries out in the one-line format. An Entry with more than
+// one Type, URI or Suite takes a line for each combination. Disabled
+// entries are written commented out. An inline Signed-By key can't be
+// written this way, and is an error.
+func WriteOneLine(out io.Writer, entries []Entry) error {
+	for _, entry := range entries {
+		para, err := control.ConvertToParagraph(&entry)
+		if err != nil {
+			return err
+		}
+
+		options := []string{}
+		for _, key := range para.Order {
+			value := para.Values[key]
+			switch key {
+			case "Types", "URIs", "Suites", "Components", "Enabled":
+				continue
+			}
+			if strings.Contains(value, "\n") {
+				return fmt.Errorf("%s can't be written in the one-line format", key)
+			}
+			option, list := fieldOption(key)
+			if list {
+				value = strings.Join(strings.Fields(value), ",")
+			}
+			options = append(options, option+"="+value)
+		}
+
+		prefix := ""
+		if !entry.Enabled() {
+			prefix = "# "
+		}
+		for _, kind := range entry.Types {
+			for _, uri := range entry.URIs {
+				for _, suite := range entry.Suites {
+					line := []string{kind}
+					if len(options) > 0 {
+						line = append(line, "["+strings.Join(options, " ")+"]")
+					}
+					line = append(line, uri, suite)
+					line = append(line, entry.Components...)
+					if _, err := fmt.Fprintln(out, prefix+strings.Join(line, " ")); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
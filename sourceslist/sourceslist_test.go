@@ -0,0 +1,153 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package sourceslist_test
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/sourceslist"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// {{{ sources files
+var oneLine = `# The main archive
+deb [ arch=amd64,arm64 signed-by=/usr/share/keyrings/debian.gpg ] https://deb.debian.org/debian bookworm main contrib
+deb-src https://deb.debian.org/debian bookworm main
+deb [trusted=yes] file:///srv/local ./
+# deb http://old.example.com/debian buster main
+`
+
+var deb822 = `Types: deb deb-src
+URIs: https://deb.debian.org/debian
+Suites: bookworm bookworm-updates
+Components: main
+Architectures: amd64
+Signed-By: /usr/share/keyrings/debian.gpg
+
+Types: deb
+URIs: https://security.debian.org/debian-security
+Suites: bookworm-security
+Components: main
+Enabled: no
+Signed-By:
+ -----BEGIN PGP PUBLIC KEY BLOCK-----
+ .
+ mDMEY...
+ -----END PGP PUBLIC KEY BLOCK-----
+`
+
+// }}}
+
+func TestParseOneLine(t *testing.T) {
+	entries, err := sourceslist.ParseOneLine(strings.NewReader(oneLine))
+	isok(t, err)
+	assert(t, len(entries) == 3)
+
+	main := entries[0]
+	assert(t, main.Types[0] == "deb")
+	assert(t, main.URIs[0] == "https://deb.debian.org/debian")
+	assert(t, main.Suites[0] == "bookworm")
+	assert(t, strings.Join(main.Components, " ") == "main contrib")
+	assert(t, len(main.Architectures) == 2)
+	assert(t, main.Architectures[1].CPU == "arm64")
+	assert(t, main.SignedBy == "/usr/share/keyrings/debian.gpg")
+
+	assert(t, entries[1].Types[0] == "deb-src")
+	assert(t, entries[2].Suites[0] == "./")
+	assert(t, len(entries[2].Components) == 0)
+	assert(t, entries[2].Values["Trusted"] == "yes")
+
+	/* Into deb822 and back again */
+	out := bytes.Buffer{}
+	isok(t, sourceslist.WriteDeb822(&out, entries))
+	again, err := sourceslist.ParseDeb822(&out)
+	isok(t, err)
+	out.Reset()
+	isok(t, sourceslist.WriteOneLine(&out, again))
+	assert(t, out.String() == `deb [arch=amd64,arm64 signed-by=/usr/share/keyrings/debian.gpg] https://deb.debian.org/debian bookworm main contrib
+deb-src https://deb.debian.org/debian bookworm main
+deb [trusted=yes] file:///srv/local ./
+`)
+
+	for _, el := range []string{
+		"deb http://example.com/debian\n",
+		"deb [arch=amd64 http://example.com/debian sid main\n",
+		"deb [arch] http://example.com/debian sid main\n",
+	} {
+		_, err := sourceslist.ParseOneLine(strings.NewReader(el))
+		notok(t, err)
+	}
+}
+
+func TestParseDeb822(t *testing.T) {
+	entries, err := sourceslist.ParseDeb822(strings.NewReader(deb822))
+	isok(t, err)
+	assert(t, len(entries) == 2)
+	assert(t, len(entries[0].Types) == 2)
+	assert(t, entries[0].Suites[1] == "bookworm-updates")
+	assert(t, entries[0].Enabled())
+	assert(t, !entries[1].Enabled())
+	assert(t, strings.HasPrefix(entries[1].SignedBy, "-----BEGIN PGP PUBLIC KEY BLOCK-----\n"))
+
+	out := bytes.Buffer{}
+	isok(t, sourceslist.WriteDeb822(&out, entries))
+	assert(t, out.String() == deb822)
+
+	out.Reset()
+	isok(t, sourceslist.WriteOneLine(&out, entries[:1]))
+	assert(t, strings.Count(out.String(), "\n") == 4)
+	assert(t, strings.HasPrefix(out.String(), "deb [arch=amd64 signed-by=/usr/share/keyrings/debian.gpg] https://deb.debian.org/debian bookworm main\n"))
+
+	notok(t, sourceslist.WriteOneLine(&out, entries[1:]))
+}
+
+// vim: foldmethod=marker
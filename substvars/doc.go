@@ -0,0 +1,7 @@
+/*
+Read debian/substvars files, and expand substitution variables in control
+files the way dpkg-gencontrol(1) does.
+
+See deb-substvars(5) for the file format and the variables dpkg provides.
+*/
+package substvars // import "pault.ag/go/debian/substvars"
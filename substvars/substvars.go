@@ -0,0 +1,230 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package substvars // import "pault.ag/go/debian/substvars"
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// Substvars {{{
+
+// Substvars is a set of substitution variables, as read from
+// debian/substvars files and set by the caller. It's a
+// control.VariableProvider, which keeps track of which variables were used.
+type Substvars struct {
+	values   map[string]string
+	optional map[string]bool
+	used     map[string]bool
+}
+
+// Create a Substvars with the variables dpkg always provides: Newline,
+// Space, Tab and Dollar.
+func New() *Substvars {
+	s := &Substvars{
+		values:   map[string]string{},
+		optional: map[string]bool{},
+		used:     map[string]bool{},
+	}
+	for name, value := range map[string]string{
+		"Newline": "\n",
+		"Space":   " ",
+		"Tab":     "\t",
+		"Dollar":  "$",
+	} {
+		s.SetOptional(name, value)
+	}
+	return s
+}
+
+// Set a variable, replacing any earlier value.
+func (s *Substvars) Set(name, value string) {
+	s.values[name] = value
+	delete(s.optional, name)
+}
+
+// Set a variable that nobody needs to use; Unused won't list it.
+func (s *Substvars) SetOptional(name, value string) {
+	s.values[name] = value
+	s.optional[name] = true
+}
+
+// Set source:Version, source:Upstream-Version and binary:Version, as
+// dpkg-gencontrol does from debian/changelog. The binary version is
+// usually the same as the source version, other than for a binNMU.
+func (s *Substvars) SetVersions(source, binary version.Version) {
+	upstream := source
+	upstream.Revision = ""
+	s.SetOptional("source:Version", source.String())
+	s.SetOptional("source:Upstream-Version", upstream.String())
+	s.SetOptional("binary:Version", binary.String())
+}
+
+// Set Arch, the architecture being built for.
+func (s *Substvars) SetArch(arch dependency.Arch) {
+	s.SetOptional("Arch", arch.String())
+}
+
+// Return the value of a variable, noting that it was used.
+func (s *Substvars) Variable(name string) (string, bool) {
+	value, ok := s.values[name]
+	if ok {
+		s.used[name] = true
+	}
+	return value, ok
+}
+
+// Return the names of the variables that were set (other than with
+// SetOptional or "?="), but never used, sorted. dpkg-gencontrol warns
+// about these.
+func (s *Substvars) Unused() []string {
+	ret := []string{}
+	for name := range s.values {
+		if !s.used[name] && !s.optional[name] {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// }}}
+
+// Parsing {{{
+
+// Read a debian/substvars file into the Substvars. Each line is
+// "name=value", or "name?=value" for a variable that needn't be used.
+// Blank lines, and lines starting with "#", are ignored. This is the same
+// parser as control.ReadVariables.
+func (s *Substvars) Read(reader io.Reader) error {
+	return control.ScanVariables(reader, func(name, value string, optional bool) {
+		if optional {
+			s.SetOptional(name, value)
+		} else {
+			s.Set(name, value)
+		}
+	})
+}
+
+// Read the substvars file at the given path. A file that doesn't exist is
+// not an error, since debhelper only writes one when it has something to
+// say.
+func (s *Substvars) ReadFile(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Read(f)
+}
+
+// }}}
+
+// Expansion {{{
+
+// Fields holding a list of relations. Once expanded, empty entries (from
+// variables with no value) are dropped, and the field has to parse.
+var DependencyFields = map[string]bool{
+	"Pre-Depends":         true,
+	"Depends":             true,
+	"Recommends":          true,
+	"Suggests":            true,
+	"Enhances":            true,
+	"Breaks":              true,
+	"Conflicts":           true,
+	"Replaces":            true,
+	"Provides":            true,
+	"Built-Using":         true,
+	"Static-Built-Using":  true,
+	"Build-Depends":       true,
+	"Build-Depends-Arch":  true,
+	"Build-Depends-Indep": true,
+	"Build-Conflicts":     true,
+}
+
+// Expand every variable in the string. Unknown variables expand to
+// nothing.
+func (s *Substvars) Expand(value string) (string, error) {
+	return control.Template{Providers: []control.VariableProvider{s}}.ExpandString(value)
+}
+
+// Return a copy of the Paragraph with every variable expanded, the way
+// dpkg-gencontrol does: relation fields (see DependencyFields) have any
+// empty or repeated entries removed, and any field that ends up empty is
+// dropped entirely.
+func (s *Substvars) Paragraph(para control.Paragraph) (control.Paragraph, error) {
+	template := control.Template{Providers: []control.VariableProvider{s}}
+	expanded, err := template.Paragraph(para)
+	if err != nil {
+		return control.Paragraph{}, err
+	}
+
+	ret := control.Paragraph{Order: []string{}, Values: map[string]string{}}
+	for _, key := range expanded.Order {
+		value := expanded.Values[key]
+		if DependencyFields[key] {
+			if value, err = cleanRelations(value); err != nil {
+				return control.Paragraph{}, fmt.Errorf("%s: %s", key, err)
+			}
+			if value == "" {
+				continue
+			}
+		}
+		ret.Set(key, value)
+	}
+	return ret, nil
+}
+
+// Drop the empty and repeated entries from a comma separated list of
+// relations, and check what's left parses.
+func cleanRelations(value string) (string, error) {
+	seen := map[string]bool{}
+	relations := []string{}
+	for _, relation := range strings.Split(value, ",") {
+		relation = strings.Join(strings.Fields(relation), " ")
+		if relation == "" || seen[relation] {
+			continue
+		}
+		seen[relation] = true
+		relations = append(relations, relation)
+	}
+	ret := strings.Join(relations, ", ")
+	if ret == "" {
+		return "", nil
+	}
+	if _, err := dependency.Parse(ret); err != nil {
+		return "", err
+	}
+	return ret, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
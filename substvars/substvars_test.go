@@ -0,0 +1,141 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package substvars_test
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/substvars"
+	"pault.ag/go/debian/version"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// {{{ control
+const controlTemplate = `Package: hello
+Architecture: any
+Version: ${binary:Version}
+Pre-Depends: ${misc:Pre-Depends}
+Depends: ${shlibs:Depends}, ${misc:Depends}, ${misc:Depends},
+ hello-data (= ${source:Version})
+Recommends: ${misc:Recommends}
+Built-Using: ${sphinxdoc:Built-Using}
+Description: example package${Newline}with two lines
+`
+
+// }}}
+
+func TestExpandParagraph(t *testing.T) {
+	dir := t.TempDir()
+	isok(t, os.WriteFile(filepath.Join(dir, "hello.substvars"), []byte(`shlibs:Depends=libc6 (>= 2.34)
+misc:Depends=
+misc:Pre-Depends=
+misc:Recommends?=
+# left over
+misc:Unused=foo
+`), 0644))
+
+	vars := substvars.New()
+	isok(t, vars.ReadFile(filepath.Join(dir, "hello.substvars")))
+	isok(t, vars.ReadFile(filepath.Join(dir, "missing.substvars")))
+	vars.SetVersions(version.MustParse("1:2.10-3"), version.MustParse("1:2.10-3+b1"))
+	vars.SetArch(dependency.Arch{ABI: "gnu", OS: "linux", CPU: "amd64"})
+
+	reader, err := control.NewParagraphReader(strings.NewReader(controlTemplate))
+	isok(t, err)
+	para, err := reader.Next()
+	isok(t, err)
+
+	expanded, err := vars.Paragraph(*para)
+	isok(t, err)
+	out := bytes.Buffer{}
+	isok(t, expanded.WriteTo(&out))
+	assert(t, out.String() == `Package: hello
+Architecture: any
+Version: 1:2.10-3+b1
+Depends: libc6 (>= 2.34), hello-data (= 1:2.10-3)
+Description: example package
+ with two lines
+`)
+
+	assert(t, strings.Join(vars.Unused(), " ") == "misc:Unused")
+
+	value, err := vars.Expand("${source:Upstream-Version} on ${Arch} costs ${Dollar}0")
+	isok(t, err)
+	assert(t, value == "1:2.10 on amd64 costs $0")
+}
+
+func TestBadRelations(t *testing.T) {
+	vars := substvars.New()
+	vars.Set("misc:Depends", "foo (>>")
+	_, err := vars.Paragraph(control.Paragraph{
+		Order:  []string{"Depends"},
+		Values: map[string]string{"Depends": "${misc:Depends}"},
+	})
+	notok(t, err)
+}
+
+func TestBadSubstvarsFile(t *testing.T) {
+	for _, file := range []string{
+		"no equals\n",
+		"=value\n",
+		"-leading=dash\n",
+		"has space=1\n",
+	} {
+		notok(t, substvars.New().Read(strings.NewReader(file)))
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,318 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package testsupport // import "pault.ag/go/debian/testsupport"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"testing/fstest"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/hashio"
+	"pault.ag/go/debian/pool"
+)
+
+// Hashes {{{
+
+type hashes struct {
+	filename string
+	size     int
+	md5      control.FileHash
+	sha1     control.FileHash
+	sha256   control.FileHash
+}
+
+// Return a "<hash> <size> <filename>" line, as in a .dsc or Release.
+func (h hashes) line(hash control.FileHash) string {
+	return fmt.Sprintf("%s %d %s", hash.Hash, h.size, h.filename)
+}
+
+func checksum(filename string, data []byte) (*hashes, error) {
+	writer, hashers, err := hashio.NewHasherWriters([]string{"md5", "sha1", "sha256"}, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	return &hashes{
+		filename: filename,
+		size:     len(data),
+		md5:      control.FileHashFromHasher(filename, *hashers[0]),
+		sha1:     control.FileHashFromHasher(filename, *hashers[1]),
+		sha256:   control.FileHashFromHasher(filename, *hashers[2]),
+	}, nil
+}
+
+// }}}
+
+// Signer {{{
+
+// Create a new OpenPGP key to sign fabricated archives with. It's small,
+// so it's quick to make, and mustn't be used for anything real.
+func NewSigner() (*openpgp.Entity, error) {
+	return openpgp.NewEntity("Test Archive", "", "archive@example.com", &packet.Config{RSABits: 1024})
+}
+
+// Return a keyring holding just the signer, to check fabricated archives
+// with.
+func Keyring(signer *openpgp.Entity) openpgp.EntityList {
+	return openpgp.EntityList{signer}
+}
+
+// }}}
+
+// Archive {{{
+
+// An Archive is a fixture for a single suite of a Debian archive.
+type Archive struct {
+	// Default to "Test", "unstable" and "sid".
+	Origin   string
+	Suite    string
+	Codename string
+
+	// The Release Date; Epoch if zero.
+	Date time.Time
+
+	// If set, the Valid-Until of the Release.
+	ValidUntil time.Time
+
+	// Binary and source packages, by component (such as "main").
+	Debs    map[string][]Deb
+	Sources map[string][]Source
+
+	// If set, the Release is also written as a clearsigned InRelease.
+	Signer *openpgp.Entity
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// Write an index, and its gzip compressed copy.
+func writeIndex(files fstest.MapFS, pathname string, paragraphs []control.Paragraph) error {
+	out := bytes.Buffer{}
+	for i, para := range paragraphs {
+		if i != 0 {
+			out.WriteString("\n")
+		}
+		if err := para.WriteTo(&out); err != nil {
+			return err
+		}
+	}
+	compressed := bytes.Buffer{}
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(out.Bytes()); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	files[pathname] = &fstest.MapFile{Data: out.Bytes(), Mode: 0644}
+	files[pathname+".gz"] = &fstest.MapFile{Data: compressed.Bytes(), Mode: 0644}
+	return nil
+}
+
+// Build the archive: the pool, the Packages and Sources indices for each
+// component (plain and gzipped), and the Release (and InRelease, if
+// there's a Signer) under dists/<suite>. Packages for Architecture: all
+// are in every architecture's Packages, as in the Debian archive.
+func (a Archive) Build() (fstest.MapFS, error) {
+	files := fstest.MapFS{}
+	suite := orDefault(a.Suite, "unstable")
+	dists := path.Join("dists", suite)
+
+	components := map[string]bool{}
+	architectures := map[string]bool{}
+	for component, debs := range a.Debs {
+		components[component] = true
+		for _, deb := range debs {
+			if deb.architecture() != "all" {
+				architectures[deb.architecture()] = true
+			}
+		}
+	}
+	for component := range a.Sources {
+		components[component] = true
+	}
+	if len(architectures) == 0 {
+		architectures["all"] = true
+	}
+
+	for component, debs := range a.Debs {
+		indices := map[string][]control.Paragraph{}
+		for _, deb := range debs {
+			data, err := deb.Build()
+			if err != nil {
+				return nil, err
+			}
+			pool, err := deb.PoolPath(component)
+			if err != nil {
+				return nil, err
+			}
+			files[pool] = &fstest.MapFile{Data: data, Mode: 0644}
+
+			hashes, err := checksum(pool, data)
+			if err != nil {
+				return nil, err
+			}
+			para := deb.Control()
+			para.Set("Filename", pool)
+			para.Set("Size", fmt.Sprintf("%d", len(data)))
+			para.Set("MD5sum", hashes.md5.Hash)
+			para.Set("SHA256", hashes.sha256.Hash)
+
+			for arch := range architectures {
+				if deb.architecture() == arch || deb.architecture() == "all" {
+					indices[arch] = append(indices[arch], para)
+				}
+			}
+		}
+		for arch := range architectures {
+			pathname := path.Join(dists, component, "binary-"+arch, "Packages")
+			if err := writeIndex(files, pathname, indices[arch]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for component, sources := range a.Sources {
+		paragraphs := []control.Paragraph{}
+		for _, source := range sources {
+			built, order, err := source.Build()
+			if err != nil {
+				return nil, err
+			}
+			dir := pool.Dir(component, source.Package)
+			/* The same as the .dsc, but with Package rather than Source */
+			para := control.Paragraph{Values: map[string]string{}}
+			para.Set("Package", source.Package)
+			dsc := source.paragraph()
+			for _, key := range dsc.Order {
+				if key != "Source" {
+					para.Set(key, dsc.Values[key])
+				}
+			}
+			para.Set("Directory", dir)
+
+			md5s, sha256s := []string{}, []string{}
+			for _, filename := range order {
+				files[path.Join(dir, filename)] = &fstest.MapFile{Data: built[filename], Mode: 0644}
+				hashes, err := checksum(filename, built[filename])
+				if err != nil {
+					return nil, err
+				}
+				md5s = append(md5s, hashes.line(hashes.md5))
+				sha256s = append(sha256s, hashes.line(hashes.sha256))
+			}
+			para.Set("Files", "\n"+strings.Join(md5s, "\n"))
+			para.Set("Checksums-Sha256", "\n"+strings.Join(sha256s, "\n"))
+			paragraphs = append(paragraphs, para)
+		}
+		if err := writeIndex(files, path.Join(dists, component, "source", "Sources"), paragraphs); err != nil {
+			return nil, err
+		}
+	}
+
+	release := control.Release{
+		Origin:     orDefault(a.Origin, "Test"),
+		Label:      orDefault(a.Origin, "Test"),
+		Suite:      suite,
+		Codename:   orDefault(a.Codename, "sid"),
+		Date:       a.Date,
+		ValidUntil: a.ValidUntil,
+	}
+	if release.Date.IsZero() {
+		release.Date = Epoch
+	}
+	for component := range components {
+		release.Components = append(release.Components, component)
+	}
+	sort.Strings(release.Components)
+	names := []string{}
+	for arch := range architectures {
+		names = append(names, arch)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		arch, err := dependency.ParseArch(name)
+		if err != nil {
+			return nil, err
+		}
+		release.Architectures = append(release.Architectures, *arch)
+	}
+
+	indices := []string{}
+	for pathname := range files {
+		if strings.HasPrefix(pathname, dists+"/") {
+			indices = append(indices, pathname)
+		}
+	}
+	sort.Strings(indices)
+	for _, pathname := range indices {
+		hashes, err := checksum(strings.TrimPrefix(pathname, dists+"/"), files[pathname].Data)
+		if err != nil {
+			return nil, err
+		}
+		release.MD5Sum = append(release.MD5Sum, control.MD5FileHash{FileHash: hashes.md5})
+		release.SHA256 = append(release.SHA256, control.SHA256FileHash{FileHash: hashes.sha256})
+	}
+
+	out := bytes.Buffer{}
+	if err := control.Marshal(&out, release); err != nil {
+		return nil, err
+	}
+	files[path.Join(dists, "Release")] = &fstest.MapFile{Data: out.Bytes(), Mode: 0644}
+
+	if a.Signer != nil {
+		signed := bytes.Buffer{}
+		writer, err := clearsign.Encode(&signed, a.Signer.PrivateKey, nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write(out.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		files[path.Join(dists, "InRelease")] = &fstest.MapFile{Data: signed.Bytes(), Mode: 0644}
+	}
+	return files, nil
+}
+
+// }}}
+
+// vim: foldmethod=marker
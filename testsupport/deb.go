@@ -0,0 +1,420 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package testsupport // import "pault.ag/go/debian/testsupport"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/pool"
+	"pault.ag/go/debian/version"
+)
+
+// When everything in a fabricated .deb or source package was last
+// modified, so the same fixture always builds the same bytes.
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// The Maintainer of fixtures that don't say otherwise.
+const Maintainer = "Test Maintainer <test@example.com>"
+
+// Helpers {{{
+
+// Write a gzipped tarball of files (path to contents), with the
+// directories they're in, sorted by path.
+func tarball(files map[string]string, executable func(string) bool) ([]byte, error) {
+	dirs := map[string]bool{}
+	names := []string{}
+	for name := range files {
+		name = strings.Trim(name, "/")
+		names = append(names, name)
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	for dir := range dirs {
+		names = append(names, dir+"/")
+	}
+	sort.Strings(names)
+
+	out := bytes.Buffer{}
+	compressed := gzip.NewWriter(&out)
+	writer := deb.NewTarWriter(compressed)
+	for _, name := range names {
+		entry := deb.TarEntry{
+			Path:    strings.TrimSuffix(name, "/"),
+			Type:    deb.DirectoryEntry,
+			Mode:    0755,
+			Uname:   "root",
+			Gname:   "root",
+			ModTime: Epoch,
+		}
+		content := ""
+		if !strings.HasSuffix(name, "/") {
+			content = files[name]
+			if _, ok := files[name]; !ok {
+				content = files["/"+name]
+			}
+			entry.Type = deb.RegularEntry
+			entry.Size = int64(len(content))
+			if !executable(name) {
+				entry.Mode = 0644
+			}
+		}
+		if err := writer.WriteEntry(&entry, strings.NewReader(content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	if err := compressed.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Return the keys of a map, sorted.
+func sortedKeys(values map[string]string) []string {
+	ret := []string{}
+	for key := range values {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// }}}
+
+// Deb {{{
+
+// Control members that dpkg runs, so are written executable.
+var maintainerScripts = map[string]bool{
+	"preinst":  true,
+	"postinst": true,
+	"prerm":    true,
+	"postrm":   true,
+	"config":   true,
+}
+
+// A Deb is a fixture for a binary package. Only Package and Version have
+// to be set.
+type Deb struct {
+	Package string
+	Version string
+
+	// amd64 if empty.
+	Architecture string
+
+	// The source package it's built from, if not Package.
+	Source string
+
+	// Any other control fields, such as Depends, Provides or Multi-Arch.
+	// Maintainer and Description are filled in if missing.
+	Fields map[string]string
+
+	// Files to install (path to contents), such as "usr/bin/hello".
+	// Anything under a bin or sbin directory is executable.
+	Files map[string]string
+
+	// Maintainer scripts (such as "postinst") and other control members
+	// (such as "triggers"), by name.
+	Scripts map[string]string
+
+	// Paths of Files that are conffiles.
+	Conffiles []string
+}
+
+func (d Deb) architecture() string {
+	if d.Architecture == "" {
+		return "amd64"
+	}
+	return d.Architecture
+}
+
+func (d Deb) source() string {
+	if d.Source == "" {
+		return d.Package
+	}
+	return d.Source
+}
+
+// Return the control file of the package, as it'd be in the .deb.
+func (d Deb) Control() control.Paragraph {
+	para := control.Paragraph{Values: map[string]string{}}
+	para.Set("Package", d.Package)
+	if d.Source != "" {
+		para.Set("Source", d.Source)
+	}
+	para.Set("Version", d.Version)
+	para.Set("Architecture", d.architecture())
+	para.Set("Maintainer", Maintainer)
+
+	size := 0
+	for _, content := range d.Files {
+		size += len(content)
+	}
+	para.Set("Installed-Size", fmt.Sprintf("%d", (size+1023)/1024))
+	for _, key := range sortedKeys(d.Fields) {
+		if key != "Description" {
+			para.Set(key, d.Fields[key])
+		}
+	}
+	if description, ok := d.Fields["Description"]; ok {
+		para.Set("Description", description)
+	} else {
+		para.Set("Description", d.Package+" test fixture")
+	}
+	return para
+}
+
+// Return the filename of the .deb, such as "hello_2.10-3_amd64.deb".
+func (d Deb) Filename() (string, error) {
+	ver, err := version.Parse(d.Version)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s_%s_%s.deb", d.Package, ver.StringWithoutEpoch(), d.architecture()), nil
+}
+
+// Return where the .deb goes in an archive, such as
+// "pool/main/h/hello/hello_2.10-3_amd64.deb".
+func (d Deb) PoolPath(component string) (string, error) {
+	filename, err := d.Filename()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(pool.Dir(component, d.source()), filename), nil
+}
+
+// Build the .deb, with gzip compressed control and data members.
+func (d Deb) Build() ([]byte, error) {
+	if d.Package == "" {
+		return nil, fmt.Errorf("Deb fixture has no Package")
+	}
+	if _, err := version.Parse(d.Version); err != nil {
+		return nil, fmt.Errorf("%s: %s", d.Package, err)
+	}
+
+	controlFile := bytes.Buffer{}
+	para := d.Control()
+	if err := para.WriteTo(&controlFile); err != nil {
+		return nil, err
+	}
+	controlFiles := map[string]string{"control": controlFile.String()}
+
+	sums := []string{}
+	conffiles := map[string]bool{}
+	for _, name := range d.Conffiles {
+		conffiles[strings.Trim(name, "/")] = true
+	}
+	for _, name := range sortedKeys(d.Files) {
+		clean := strings.Trim(name, "/")
+		if conffiles[clean] {
+			continue
+		}
+		sums = append(sums, fmt.Sprintf("%x  %s\n", md5.Sum([]byte(d.Files[name])), clean))
+	}
+	if len(sums) != 0 {
+		controlFiles["md5sums"] = strings.Join(sums, "")
+	}
+	if len(d.Conffiles) != 0 {
+		lines := []string{}
+		for _, name := range d.Conffiles {
+			lines = append(lines, "/"+strings.Trim(name, "/")+"\n")
+		}
+		controlFiles["conffiles"] = strings.Join(lines, "")
+	}
+	for name, content := range d.Scripts {
+		controlFiles[name] = content
+	}
+
+	controlTar, err := tarball(controlFiles, func(name string) bool {
+		return maintainerScripts[name]
+	})
+	if err != nil {
+		return nil, err
+	}
+	dataTar, err := tarball(d.Files, func(name string) bool {
+		dir := path.Base(path.Dir(name))
+		return dir == "bin" || dir == "sbin"
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.Buffer{}
+	writer := deb.NewArWriter(&out)
+	for _, member := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", controlTar},
+		{"data.tar.gz", dataTar},
+	} {
+		if err := writer.WriteEntry(member.name, member.data); err != nil {
+			return nil, err
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// }}}
+
+// Source {{{
+
+// A Source is a fixture for a (native, format 3.0) source package. Only
+// Package and Version have to be set.
+type Source struct {
+	Package string
+	Version string
+
+	// The binary packages it builds; just Package if empty.
+	Binaries []string
+
+	// "any" if empty.
+	Architecture string
+
+	// Any other fields, such as Build-Depends.
+	Fields map[string]string
+
+	// The files in the source tree, by path, such as "debian/rules".
+	Files map[string]string
+
+	// The upstream source tree, by path. If set, the source package is
+	// "3.0 (quilt)" rather than native, with these files in the orig
+	// tarball, and Files (which should all be under debian/) in the
+	// debian tarball.
+	Upstream map[string]string
+}
+
+func (s Source) format() string {
+	if s.Upstream != nil {
+		return "3.0 (quilt)"
+	}
+	return "3.0 (native)"
+}
+
+func (s Source) prefix() (string, error) {
+	ver, err := version.Parse(s.Version)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", s.Package, err)
+	}
+	return s.Package + "_" + ver.StringWithoutEpoch(), nil
+}
+
+// Build the source package, returning its files (the .dsc first) by
+// filename.
+func (s Source) Build() (map[string][]byte, []string, error) {
+	if s.Package == "" {
+		return nil, nil, fmt.Errorf("Source fixture has no Package")
+	}
+	prefix, err := s.prefix()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	executable := func(name string) bool {
+		return path.Base(name) == "rules"
+	}
+	files := map[string][]byte{}
+	order := []string{}
+	if s.Upstream == nil {
+		tree := map[string]string{}
+		for name, content := range s.Files {
+			tree[path.Join(s.Package, name)] = content
+		}
+		if files[prefix+".tar.gz"], err = tarball(tree, executable); err != nil {
+			return nil, nil, err
+		}
+		order = append(order, prefix+".tar.gz")
+	} else {
+		/* prefix has already checked that the version parses */
+		ver, _ := version.Parse(s.Version)
+		tree := map[string]string{}
+		for name, content := range s.Upstream {
+			tree[path.Join(s.Package+"-"+ver.Version, name)] = content
+		}
+		orig := s.Package + "_" + ver.Version + ".orig.tar.gz"
+		if files[orig], err = tarball(tree, executable); err != nil {
+			return nil, nil, err
+		}
+		if files[prefix+".debian.tar.gz"], err = tarball(s.Files, executable); err != nil {
+			return nil, nil, err
+		}
+		order = append(order, orig, prefix+".debian.tar.gz")
+	}
+
+	md5s, sha256s := []string{}, []string{}
+	for _, filename := range order {
+		hashes, err := checksum(filename, files[filename])
+		if err != nil {
+			return nil, nil, err
+		}
+		md5s = append(md5s, hashes.line(hashes.md5))
+		sha256s = append(sha256s, hashes.line(hashes.sha256))
+	}
+	dsc := s.paragraph()
+	dsc.Set("Checksums-Sha256", "\n"+strings.Join(sha256s, "\n"))
+	dsc.Set("Files", "\n"+strings.Join(md5s, "\n"))
+
+	out := bytes.Buffer{}
+	if err := dsc.WriteTo(&out); err != nil {
+		return nil, nil, err
+	}
+	files[prefix+".dsc"] = out.Bytes()
+	return files, append([]string{prefix + ".dsc"}, order...), nil
+}
+
+// The fields shared by the .dsc and the Sources index.
+func (s Source) paragraph() control.Paragraph {
+	binaries := s.Binaries
+	if len(binaries) == 0 {
+		binaries = []string{s.Package}
+	}
+	architecture := s.Architecture
+	if architecture == "" {
+		architecture = "any"
+	}
+	para := control.Paragraph{Values: map[string]string{}}
+	para.Set("Format", s.format())
+	para.Set("Source", s.Package)
+	para.Set("Binary", strings.Join(binaries, ", "))
+	para.Set("Architecture", architecture)
+	para.Set("Version", s.Version)
+	para.Set("Maintainer", Maintainer)
+	for _, key := range sortedKeys(s.Fields) {
+		para.Set(key, s.Fields[key])
+	}
+	return para
+}
+
+// }}}
+
+// vim: foldmethod=marker
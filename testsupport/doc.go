@@ -0,0 +1,25 @@
+/*
+Fabricate Debian archives for tests: .debs, source packages, Packages and
+Sources indices, and (signed) Release files, all built in memory from
+short fixtures, so tests don't need binary files checked in.
+
+	signer, err := testsupport.NewSigner()
+	...
+	files, err := testsupport.Archive{
+		Signer: signer,
+		Debs: map[string][]testsupport.Deb{
+			"main": {{
+				Package: "hello",
+				Version: "2.10-3",
+				Fields:  map[string]string{"Depends": "libc6 (>= 2.34)"},
+				Files:   map[string]string{"usr/bin/hello": "#!/bin/sh\necho hello\n"},
+			}},
+		},
+	}.Build()
+	...
+	server := httptest.NewServer(http.FileServer(http.FS(files)))
+
+Everything (including the Release Date) is fixed unless set, so the same
+fixtures always build the same bytes, signatures aside.
+*/
+package testsupport // import "pault.ag/go/debian/testsupport"
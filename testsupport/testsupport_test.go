@@ -0,0 +1,197 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package testsupport_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/deb"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/repo"
+	"pault.ag/go/debian/testsupport"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+var hello = testsupport.Deb{
+	Package: "hello",
+	Version: "1:2.10-3",
+	Fields:  map[string]string{"Depends": "libc6 (>= 2.34)"},
+	Files: map[string]string{
+		"usr/bin/hello":  "#!/bin/sh\necho hello\n",
+		"etc/hello.conf": "greeting=hi\n",
+	},
+	Scripts:   map[string]string{"postinst": "#!/bin/sh\nexit 0\n"},
+	Conffiles: []string{"/etc/hello.conf"},
+}
+
+func TestDeb(t *testing.T) {
+	data, err := hello.Build()
+	isok(t, err)
+	filename, err := hello.Filename()
+	isok(t, err)
+	assert(t, filename == "hello_2.10-3_amd64.deb")
+
+	debFile, err := deb.Load(bytes.NewReader(data), filename)
+	isok(t, err)
+	assert(t, debFile.Control.Package == "hello")
+	assert(t, debFile.Control.Version.Epoch == 1)
+	assert(t, debFile.Control.Maintainer == testsupport.Maintainer)
+	assert(t, debFile.Control.Depends.String() == "libc6 (>= 2.34)")
+
+	entries := map[string]*deb.TarEntry{}
+	isok(t, deb.ReadTarEntries(debFile.Data, func(entry *deb.TarEntry, _ io.Reader) error {
+		entries[entry.Path] = entry
+		return nil
+	}))
+	assert(t, entries["usr/bin"].Type == deb.DirectoryEntry)
+	assert(t, entries["usr/bin/hello"].Mode == 0755)
+	assert(t, entries["etc/hello.conf"].Mode == 0644)
+
+	/* And it's the same every time */
+	again, err := hello.Build()
+	isok(t, err)
+	assert(t, bytes.Equal(data, again))
+
+	_, err = testsupport.Deb{Package: "broken", Version: "not a version!"}.Build()
+	notok(t, err)
+}
+
+func TestSourceQuilt(t *testing.T) {
+	files, order, err := testsupport.Source{
+		Package:  "hello",
+		Version:  "1:2.10-3",
+		Upstream: map[string]string{"hello.c": "int main(void) { return 0; }\n"},
+		Files:    map[string]string{"debian/rules": "#!/usr/bin/make -f\n"},
+	}.Build()
+	isok(t, err)
+	assert(t, strings.Join(order, " ") == "hello_2.10-3.dsc hello_2.10.orig.tar.gz hello_2.10-3.debian.tar.gz")
+
+	dsc, err := control.ParseDsc(bufio.NewReader(bytes.NewReader(files[order[0]])), "")
+	isok(t, err)
+	assert(t, dsc.Format == "3.0 (quilt)")
+	assert(t, len(dsc.ChecksumsSha256) == 2)
+}
+
+func TestArchive(t *testing.T) {
+	signer, err := testsupport.NewSigner()
+	isok(t, err)
+
+	files, err := testsupport.Archive{
+		Signer: signer,
+		Debs: map[string][]testsupport.Deb{
+			"main": {
+				hello,
+				{Package: "hello", Version: "1:2.10-3", Architecture: "arm64"},
+				{Package: "hello-doc", Source: "hello", Version: "1:2.10-3", Architecture: "all"},
+				{Package: "libfoo1", Source: "foo", Version: "1.0-1"},
+			},
+		},
+		Sources: map[string][]testsupport.Source{
+			"main": {{
+				Package:  "hello",
+				Version:  "1:2.10-3",
+				Binaries: []string{"hello", "hello-doc"},
+				Fields:   map[string]string{"Build-Depends": "debhelper-compat (= 13)"},
+				Files:    map[string]string{"debian/rules": "#!/usr/bin/make -f\n%:\n\tdh $@\n"},
+			}},
+		},
+	}.Build()
+	isok(t, err)
+
+	assert(t, files["pool/main/h/hello/hello_2.10-3_amd64.deb"] != nil)
+	assert(t, files["pool/main/f/foo/libfoo1_1.0-1_amd64.deb"] != nil)
+	assert(t, files["pool/main/h/hello/hello_2.10-3.dsc"] != nil)
+
+	server := httptest.NewServer(http.FileServer(http.FS(files)))
+	defer server.Close()
+
+	client, err := repo.New(server.URL, "unstable", testsupport.Keyring(signer))
+	isok(t, err)
+	release, err := client.Release()
+	isok(t, err)
+	assert(t, release.Codename == "sid")
+	assert(t, len(release.Architectures) == 2)
+
+	/* Only the key the archive was signed with will do */
+	stranger, err := testsupport.NewSigner()
+	isok(t, err)
+	other, err := repo.New(server.URL, "unstable", testsupport.Keyring(stranger))
+	isok(t, err)
+	_, err = other.Release()
+	notok(t, err)
+
+	arm64, err := dependency.ParseArch("arm64")
+	isok(t, err)
+	names := []string{}
+	isok(t, client.Packages("main", *arm64, func(pkg *control.BinaryIndex) error {
+		names = append(names, pkg.Package+" "+pkg.Architecture.String())
+		return nil
+	}))
+	assert(t, strings.Join(names, ", ") == "hello arm64, hello-doc all")
+
+	sources := []*control.SourceIndex{}
+	isok(t, client.Sources("main", func(src *control.SourceIndex) error {
+		sources = append(sources, src)
+		return nil
+	}))
+	assert(t, len(sources) == 1)
+	assert(t, sources[0].Directory == "pool/main/h/hello")
+	assert(t, len(sources[0].ChecksumsSha256) == 2)
+	assert(t, sources[0].GetBuildDepends().String() == "debhelper-compat (= 13)")
+}
+
+// vim: foldmethod=marker
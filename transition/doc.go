@@ -0,0 +1,15 @@
+/*
+Parse and evaluate release team transition definitions, as used by `ben(1)`.
+
+A transition is described by a small file of key/value assignments, where the
+interesting keys are boolean expressions over control fields:
+
+	title = "libfoo";
+	is_affected = .depends ~ "libfoo1" | .depends ~ "libfoo2";
+	is_good = .depends ~ "libfoo2";
+	is_bad = .depends ~ "libfoo1";
+
+Those expressions can be evaluated against Paragraphs taken from a Packages
+or Sources index, to find out how far along the transition is.
+*/
+package transition // import "pault.ag/go/debian/transition"
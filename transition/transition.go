@@ -0,0 +1,570 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package transition // import "pault.ag/go/debian/transition"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+// Transition {{{
+
+// A Transition is the encapsulation of a single `.ben` file, as used by the
+// release team to track library transitions. The three expressions decide
+// which packages are part of the transition at all, and which of those have
+// been rebuilt (good) or are still using the old bits (bad).
+type Transition struct {
+	Title string
+	Notes string
+
+	IsAffected Expr
+	IsGood     Expr
+	IsBad      Expr
+
+	Export bool
+
+	// Any other string or boolean assignments we don't have a home for,
+	// stored as their raw text value.
+	Values map[string]string
+}
+
+// Status {{{
+
+// The Status of a Package in the context of a given Transition.
+type Status int
+
+const (
+	Unaffected Status = iota
+	Unknown
+	Good
+	Bad
+)
+
+func (s Status) String() string {
+	switch s {
+	case Unaffected:
+		return "unaffected"
+	case Good:
+		return "good"
+	case Bad:
+		return "bad"
+	default:
+		return "unknown"
+	}
+}
+
+// }}}
+
+// Classify a Paragraph (either a binary or source index entry) against the
+// Transition. Packages that don't match `is_affected` are Unaffected, and
+// `is_bad` is checked before `is_good`, since a package that matches both
+// is still holding the transition back.
+func (t *Transition) Classify(para control.Paragraph) Status {
+	if t.IsAffected == nil || !t.IsAffected.Matches(para) {
+		return Unaffected
+	}
+	if t.IsBad != nil && t.IsBad.Matches(para) {
+		return Bad
+	}
+	if t.IsGood != nil && t.IsGood.Matches(para) {
+		return Good
+	}
+	return Unknown
+}
+
+// Result {{{
+
+// A Result is the Status of a single Paragraph, along with the names that
+// are handy to have when rendering a transition dashboard.
+type Result struct {
+	Package string
+	Source  string
+	Status  Status
+}
+
+// Report is the set of Results for every affected package in an index.
+type Report []Result
+
+// Return all Results that have the given Status.
+func (r Report) With(status Status) Report {
+	ret := Report{}
+	for _, result := range r {
+		if result.Status == status {
+			ret = append(ret, result)
+		}
+	}
+	return ret
+}
+
+// Return true if there are no packages left that are Bad or Unknown.
+func (r Report) Done() bool {
+	return len(r.With(Bad)) == 0 && len(r.With(Unknown)) == 0
+}
+
+// }}}
+
+// Evaluate the Transition against a list of Paragraphs, and return a Result
+// for each Paragraph that is affected. Unaffected packages are not included.
+func (t *Transition) Evaluate(paras []control.Paragraph) Report {
+	ret := Report{}
+	for _, para := range paras {
+		status := t.Classify(para)
+		if status == Unaffected {
+			continue
+		}
+		name := para.Values["Package"]
+		source := para.Values["Source"]
+		if source == "" {
+			source = name
+		}
+		if i := strings.Index(source, " "); i != -1 {
+			/* binNMU'd packages have "Source: foo (1.0-1)" */
+			source = source[:i]
+		}
+		ret = append(ret, Result{Package: name, Source: source, Status: status})
+	}
+	return ret
+}
+
+// Evaluate the Transition against a parsed Packages index.
+func (t *Transition) EvaluateBinaryIndex(index []control.BinaryIndex) Report {
+	paras := make([]control.Paragraph, len(index))
+	for i, entry := range index {
+		paras[i] = entry.Paragraph
+	}
+	return t.Evaluate(paras)
+}
+
+// }}}
+
+// Parse {{{
+
+// Given a path on the filesystem, parse the `.ben` file off the disk.
+func ParseFile(path string) (*Transition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(bufio.NewReader(f))
+}
+
+// Parse a `.ben` transition definition from the given io.Reader.
+func Parse(reader io.Reader) (*Transition, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := Transition{Values: map[string]string{}}
+	in := &input{Data: string(data)}
+
+	for {
+		eatWhitespace(in)
+		if in.Peek() == 0 {
+			return &ret, nil
+		}
+
+		key := in.readWord()
+		if key == "" {
+			return nil, fmt.Errorf("Expected a key at offset %d", in.Index)
+		}
+		eatWhitespace(in)
+		if in.Next() != '=' {
+			return nil, fmt.Errorf("Expected '=' after '%s'", key)
+		}
+		eatWhitespace(in)
+
+		switch key {
+		case "is_affected", "is_good", "is_bad":
+			expr, err := parseOr(in)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", key, err)
+			}
+			switch key {
+			case "is_affected":
+				ret.IsAffected = expr
+			case "is_good":
+				ret.IsGood = expr
+			case "is_bad":
+				ret.IsBad = expr
+			}
+		default:
+			value, err := parseValue(in)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", key, err)
+			}
+			switch key {
+			case "title":
+				ret.Title = value
+			case "notes":
+				ret.Notes = value
+			case "export":
+				ret.Export = value == "true"
+			default:
+				ret.Values[key] = value
+			}
+		}
+
+		eatWhitespace(in)
+		if in.Next() != ';' {
+			return nil, fmt.Errorf("Expected ';' after the value of '%s'", key)
+		}
+	}
+}
+
+// }}}
+
+// Expressions {{{
+
+// An Expr is a boolean expression over the fields of a control Paragraph.
+type Expr interface {
+	Matches(para control.Paragraph) bool
+	String() string
+}
+
+// Match {{{
+
+// A Match is the `.field ~ "value"` or `.field ~ /regex/` leaf of an
+// expression. A string Pattern will match a relationship field if any
+// package named in that field is exactly the Pattern, or any other field if
+// the value is exactly the Pattern. A Regexp is matched against the raw value.
+type Match struct {
+	Field   string
+	Pattern string
+	Regexp  *regexp.Regexp
+}
+
+func (m Match) Matches(para control.Paragraph) bool {
+	value, ok := lookup(para, m.Field)
+	if !ok {
+		return false
+	}
+
+	if m.Regexp != nil {
+		return m.Regexp.MatchString(value)
+	}
+
+	if isRelationField(m.Field) {
+		dep, err := dependency.Parse(value)
+		if err != nil {
+			return false
+		}
+		for _, possi := range dep.GetAllPossibilities() {
+			if possi.Name == m.Pattern {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, el := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n'
+	}) {
+		if el == m.Pattern {
+			return true
+		}
+	}
+	return strings.TrimSpace(value) == m.Pattern
+}
+
+func (m Match) String() string {
+	if m.Regexp != nil {
+		return fmt.Sprintf(".%s ~ /%s/", m.Field, m.Regexp.String())
+	}
+	return fmt.Sprintf(".%s ~ %q", m.Field, m.Pattern)
+}
+
+// }}}
+
+// Not, And, Or and Bool {{{
+
+type Not struct{ Expr Expr }
+
+func (n Not) Matches(para control.Paragraph) bool { return !n.Expr.Matches(para) }
+func (n Not) String() string                      { return "!" + n.Expr.String() }
+
+type And struct{ Left, Right Expr }
+
+func (a And) Matches(para control.Paragraph) bool {
+	return a.Left.Matches(para) && a.Right.Matches(para)
+}
+func (a And) String() string { return "(" + a.Left.String() + " & " + a.Right.String() + ")" }
+
+type Or struct{ Left, Right Expr }
+
+func (o Or) Matches(para control.Paragraph) bool {
+	return o.Left.Matches(para) || o.Right.Matches(para)
+}
+func (o Or) String() string { return "(" + o.Left.String() + " | " + o.Right.String() + ")" }
+
+type Bool bool
+
+func (b Bool) Matches(para control.Paragraph) bool { return bool(b) }
+func (b Bool) String() string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// }}}
+
+// field helpers {{{
+
+// ben field names are lowercase, control fields are usually not.
+func lookup(para control.Paragraph, field string) (string, bool) {
+	if value, ok := para.Values[field]; ok {
+		return value, true
+	}
+	for _, key := range para.Order {
+		if strings.EqualFold(key, field) {
+			return para.Values[key], true
+		}
+	}
+	return "", false
+}
+
+func isRelationField(field string) bool {
+	switch strings.ToLower(field) {
+	case "depends", "pre-depends", "recommends", "suggests", "enhances",
+		"breaks", "conflicts", "replaces", "provides", "built-using",
+		"build-depends", "build-depends-indep", "build-depends-arch",
+		"build-conflicts", "build-conflicts-indep", "build-conflicts-arch":
+		return true
+	}
+	return false
+}
+
+// }}}
+
+// }}}
+
+// Expression Parser {{{
+
+type input struct {
+	Data  string
+	Index int
+}
+
+func (i *input) Peek() byte {
+	if i.Index >= len(i.Data) {
+		return 0
+	}
+	return i.Data[i.Index]
+}
+
+func (i *input) Next() byte {
+	chr := i.Peek()
+	i.Index++
+	return chr
+}
+
+func (i *input) readWord() string {
+	start := i.Index
+	for {
+		chr := i.Peek()
+		if chr == '_' || chr == '-' || chr == '+' || chr == '.' ||
+			(chr >= 'a' && chr <= 'z') || (chr >= 'A' && chr <= 'Z') ||
+			(chr >= '0' && chr <= '9') {
+			i.Next()
+			continue
+		}
+		return i.Data[start:i.Index]
+	}
+}
+
+func (i *input) readDelimited(delim byte) (string, error) {
+	i.Next() /* the opening delimiter */
+	var ret strings.Builder
+	for {
+		chr := i.Next()
+		switch chr {
+		case 0:
+			return "", fmt.Errorf("Reached EOF looking for closing %c", delim)
+		case '\\':
+			next := i.Next()
+			if delim == '/' && next != '/' {
+				/* Leave regex escapes alone */
+				ret.WriteByte(chr)
+			}
+			ret.WriteByte(next)
+		case delim:
+			return ret.String(), nil
+		default:
+			ret.WriteByte(chr)
+		}
+	}
+}
+
+/* Eat whitespace and comments */
+func eatWhitespace(in *input) {
+	for {
+		switch in.Peek() {
+		case '\r', '\n', ' ', '\t':
+			in.Next()
+			continue
+		case '#':
+			for in.Peek() != '\n' && in.Peek() != 0 {
+				in.Next()
+			}
+			continue
+		}
+		return
+	}
+}
+
+func parseValue(in *input) (string, error) {
+	switch in.Peek() {
+	case '"':
+		return in.readDelimited('"')
+	}
+	word := in.readWord()
+	if word == "" {
+		return "", fmt.Errorf("Unexpected character '%c'", in.Peek())
+	}
+	return word, nil
+}
+
+func parseOr(in *input) (Expr, error) {
+	left, err := parseAnd(in)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		eatWhitespace(in)
+		if in.Peek() != '|' {
+			return left, nil
+		}
+		in.Next()
+		right, err := parseAnd(in)
+		if err != nil {
+			return nil, err
+		}
+		left = Or{Left: left, Right: right}
+	}
+}
+
+func parseAnd(in *input) (Expr, error) {
+	left, err := parseUnary(in)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		eatWhitespace(in)
+		if in.Peek() != '&' {
+			return left, nil
+		}
+		in.Next()
+		right, err := parseUnary(in)
+		if err != nil {
+			return nil, err
+		}
+		left = And{Left: left, Right: right}
+	}
+}
+
+func parseUnary(in *input) (Expr, error) {
+	eatWhitespace(in)
+	switch in.Peek() {
+	case '!':
+		in.Next()
+		expr, err := parseUnary(in)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: expr}, nil
+	case '(':
+		in.Next()
+		expr, err := parseOr(in)
+		if err != nil {
+			return nil, err
+		}
+		eatWhitespace(in)
+		if in.Next() != ')' {
+			return nil, fmt.Errorf("Missing ')' at offset %d", in.Index)
+		}
+		return expr, nil
+	case '.':
+		return parseMatch(in)
+	case 0:
+		return nil, fmt.Errorf("Reached EOF in the middle of an expression")
+	}
+
+	switch word := in.readWord(); word {
+	case "true":
+		return Bool(true), nil
+	case "false":
+		return Bool(false), nil
+	default:
+		return nil, fmt.Errorf("Unexpected token '%s' at offset %d", word, in.Index)
+	}
+}
+
+func parseMatch(in *input) (Expr, error) {
+	in.Next() /* Assert ch == '.' */
+	field := in.readWord()
+	if field == "" {
+		return nil, fmt.Errorf("Missing field name at offset %d", in.Index)
+	}
+
+	eatWhitespace(in)
+	if in.Next() != '~' {
+		return nil, fmt.Errorf("Expected '~' after .%s", field)
+	}
+	eatWhitespace(in)
+
+	switch in.Peek() {
+	case '"':
+		pattern, err := in.readDelimited('"')
+		if err != nil {
+			return nil, err
+		}
+		return Match{Field: field, Pattern: pattern}, nil
+	case '/':
+		pattern, err := in.readDelimited('/')
+		if err != nil {
+			return nil, err
+		}
+		if in.Peek() == 'i' {
+			in.Next()
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return Match{Field: field, Pattern: pattern, Regexp: re}, nil
+	}
+	return nil, fmt.Errorf("Expected a string or regex after .%s ~", field)
+}
+
+// }}}
+
+// vim: foldmethod=marker
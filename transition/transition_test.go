@@ -0,0 +1,129 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package transition_test
+
+import (
+	"bufio"
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/transition"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+func TestTransitionParse(t *testing.T) {
+	ben, err := transition.Parse(strings.NewReader(`# Transition for libfoo
+title = "libfoo";
+is_affected = .depends ~ "libfoo1" | .depends ~ "libfoo2";
+is_good = .depends ~ "libfoo2";
+is_bad = .depends ~ "libfoo1";
+notes = "#123456";
+export = false;
+`))
+	isok(t, err)
+	assert(t, ben.Title == "libfoo")
+	assert(t, ben.Notes == "#123456")
+	assert(t, !ben.Export)
+	assert(t, ben.IsAffected.String() == `(.depends ~ "libfoo1" | .depends ~ "libfoo2")`)
+}
+
+func TestTransitionParseErrors(t *testing.T) {
+	for _, el := range []string{
+		`title = "foo"`,
+		`is_good = .depends "foo";`,
+		`is_good = (.depends ~ "foo";`,
+		`is_good = .depends ~ /[/;`,
+	} {
+		_, err := transition.Parse(strings.NewReader(el))
+		notok(t, err)
+	}
+}
+
+func TestTransitionEvaluate(t *testing.T) {
+	ben, err := transition.Parse(strings.NewReader(`
+title = "libfoo";
+is_affected = .depends ~ /libfoo[12]/ | .source ~ "libfoo";
+is_good = .depends ~ "libfoo2";
+is_bad = .depends ~ "libfoo1" & !.source ~ "libfoo";
+`))
+	isok(t, err)
+
+	index, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(`Package: libfoo2
+Source: libfoo
+Version: 2.0-1
+
+Package: bar
+Version: 1.0-1
+Depends: libc6, libfoo2 (>= 2.0)
+
+Package: baz
+Source: baz (1.0-1)
+Version: 1.0-1+b1
+Depends: libfoo1 | libfoo-compat
+
+Package: quux
+Version: 1.0-1
+Depends: libfoo10
+`)))
+	isok(t, err)
+
+	report := ben.EvaluateBinaryIndex(index)
+	assert(t, len(report) == 4)
+	assert(t, report[0].Status == transition.Unknown)
+	assert(t, report[1].Status == transition.Good)
+	assert(t, report[2].Status == transition.Bad)
+	assert(t, report[2].Source == "baz")
+	assert(t, report[3].Status == transition.Unknown)
+	assert(t, len(report.With(transition.Bad)) == 1)
+	assert(t, !report.Done())
+}
+
+// vim: foldmethod=marker
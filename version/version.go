@@ -53,6 +53,30 @@ func (a Slice) Less(i, j int) bool {
 	return Compare(a[i], a[j]) < 0
 }
 
+// Max returns the greatest of the given versions, or the zero Version if
+// there are none.
+func Max(versions ...Version) Version {
+	ret := Version{}
+	for i, v := range versions {
+		if i == 0 || Compare(v, ret) > 0 {
+			ret = v
+		}
+	}
+	return ret
+}
+
+// Min returns the least of the given versions, or the zero Version if
+// there are none.
+func Min(versions ...Version) Version {
+	ret := Version{}
+	for i, v := range versions {
+		if i == 0 || Compare(v, ret) < 0 {
+			ret = v
+		}
+	}
+	return ret
+}
+
 type Version struct {
 	Epoch    uint
 	Version  string
@@ -196,39 +220,98 @@ func Compare(a Version, b Version) int {
 	return verrevcmp(a.Revision, b.Revision)
 }
 
+// Component names the part of a version string that a ParseError is about.
+type Component int
+
+const (
+	// The version string as a whole, such as when it's empty.
+	WholeVersion Component = iota
+	Epoch
+	UpstreamVersion
+	Revision
+)
+
+func (c Component) String() string {
+	switch c {
+	case WholeVersion:
+		return "version string"
+	case Epoch:
+		return "epoch"
+	case UpstreamVersion:
+		return "upstream version"
+	case Revision:
+		return "revision"
+	default:
+		return fmt.Sprintf("Component(%d)", int(c))
+	}
+}
+
+// ParseError is returned by Parse when the input isn't a valid version.
+// Message is roughly what dpkg(1) would say about it.
+type ParseError struct {
+	Input     string
+	Component Component
+	Message   string
+}
+
+func (e *ParseError) Error() string {
+	return e.Message
+}
+
 // Parse returns a Version struct filled with the epoch, version and revision
 // specified in input. It verifies the version string as a whole, just like
-// dpkg(1), and even returns roughly the same error messages.
+// dpkg(1), and even returns roughly the same error messages. Any error is a
+// *ParseError, saying which component of the version was at fault.
 func Parse(input string) (Version, error) {
 	result := Version{}
 	return result, parseInto(&result, input)
 }
 
+// MustParse is like Parse, but panics if the input isn't a valid version.
+// It's intended for tests, and versions written out in the source.
+func MustParse(input string) Version {
+	result, err := Parse(input)
+	if err != nil {
+		panic(fmt.Sprintf("version: MustParse(%q): %s", input, err))
+	}
+	return result
+}
+
 func parseInto(result *Version, input string) error {
+	fail := func(component Component, message string) error {
+		return &ParseError{Input: input, Component: component, Message: message}
+	}
+
 	trimmed := strings.TrimSpace(input)
 	if trimmed == "" {
-		return fmt.Errorf("version string is empty")
+		return fail(WholeVersion, "version string is empty")
 	}
 
 	if strings.IndexFunc(trimmed, unicode.IsSpace) != -1 {
-		return fmt.Errorf("version string has embedded spaces")
+		return fail(WholeVersion, "version string has embedded spaces")
 	}
 
 	colon := strings.Index(trimmed, ":")
 	if colon != -1 {
-		epoch, err := strconv.ParseInt(trimmed[:colon], 10, 64)
-		if err != nil {
-			return fmt.Errorf("epoch: %v", err)
+		epoch := trimmed[:colon]
+		switch {
+		case epoch == "":
+			return fail(Epoch, "epoch in version is empty")
+		case strings.HasPrefix(epoch, "-"):
+			return fail(Epoch, "epoch in version is negative")
+		case strings.IndexFunc(epoch, func(c rune) bool { return !cisdigit(c) }) != -1:
+			return fail(Epoch, "epoch in version is not number")
 		}
-		if epoch < 0 {
-			return fmt.Errorf("epoch in version is negative")
+		value, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return fail(Epoch, "epoch in version is too big")
 		}
-		result.Epoch = uint(epoch)
+		result.Epoch = uint(value)
 	}
 
 	result.Version = trimmed[colon+1:]
 	if len(result.Version) == 0 {
-		return fmt.Errorf("nothing after colon in version number")
+		return fail(UpstreamVersion, "nothing after colon in version number")
 	}
 	if hyphen := strings.LastIndex(result.Version, "-"); hyphen != -1 {
 		result.Revision = result.Version[hyphen+1:]
@@ -236,19 +319,19 @@ func parseInto(result *Version, input string) error {
 	}
 
 	if len(result.Version) > 0 && !unicode.IsDigit(rune(result.Version[0])) {
-		return fmt.Errorf("version number does not start with digit")
+		return fail(UpstreamVersion, "version number does not start with digit")
 	}
 
 	if strings.IndexFunc(result.Version, func(c rune) bool {
 		return !cisdigit(c) && !cisalpha(c) && c != '.' && c != '-' && c != '+' && c != '~' && c != ':'
 	}) != -1 {
-		return fmt.Errorf("invalid character in version number")
+		return fail(UpstreamVersion, "invalid character in version number")
 	}
 
 	if strings.IndexFunc(result.Revision, func(c rune) bool {
 		return !cisdigit(c) && !cisalpha(c) && c != '.' && c != '+' && c != '~'
 	}) != -1 {
-		return fmt.Errorf("invalid character in revision number")
+		return fail(Revision, "invalid character in revision number")
 	}
 
 	return nil
@@ -29,6 +29,7 @@
 package version // import "pault.ag/go/debian/version"
 
 import (
+	"sort"
 	"strings"
 	"testing"
 )
@@ -358,6 +359,71 @@ func TestParseInvalidCharactersInRevision(t *testing.T) {
 	}
 }
 
+func TestParseErrorComponent(t *testing.T) {
+	for _, el := range []struct {
+		input     string
+		component Component
+	}{
+		{"", WholeVersion},
+		{"1.0 1", WholeVersion},
+		{":1.0", Epoch},
+		{"+1:1.0", Epoch},
+		{"99999999999999999999:1.0", Epoch},
+		{"1:", UpstreamVersion},
+		{"1:a1.0", UpstreamVersion},
+		{"1.0_1-1", UpstreamVersion},
+		{"1.0-1_1", Revision},
+	} {
+		_, err := Parse(el.input)
+		parseError, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("Parse(%q): expected a *ParseError, got %v", el.input, err)
+			continue
+		}
+		if parseError.Component != el.component || parseError.Input != el.input {
+			t.Errorf("Parse(%q): got %s, want %s", el.input, parseError.Component, el.component)
+		}
+	}
+}
+
+func TestMustParse(t *testing.T) {
+	if v := MustParse("1:2.0-3"); v.Epoch != 1 || v.Version != "2.0" || v.Revision != "3" {
+		t.Errorf("MustParse returned %#v", v)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("MustParse didn't panic on an invalid version")
+		}
+	}()
+	MustParse("not a version")
+}
+
+func TestSliceSort(t *testing.T) {
+	versions := Slice{}
+	for _, el := range []string{"1.0-1", "1:0.1", "1.0~rc1-1", "1.0-1+b1", "0.9"} {
+		versions = append(versions, MustParse(el))
+	}
+	sort.Sort(versions)
+	got := []string{}
+	for _, v := range versions {
+		got = append(got, v.String())
+	}
+	if strings.Join(got, " ") != "0.9 1.0~rc1-1 1.0-1 1.0-1+b1 1:0.1" {
+		t.Errorf("Sorted versions are in the wrong order: %v", got)
+	}
+
+	if v := Max(versions...); v.String() != "1:0.1" {
+		t.Errorf("Max returned %s", v)
+	}
+	if v := Min(versions[2:]...); v.String() != "1.0-1" {
+		t.Errorf("Min returned %s", v)
+	}
+	if v := Max(); !v.Empty() {
+		t.Errorf("Max of nothing returned %s", v)
+	}
+}
+
 func TestString(t *testing.T) {
 	if strings.Compare("1.0-1", Version{
 		Version:  "1.0",
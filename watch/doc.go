@@ -0,0 +1,28 @@
+/*
+Parse debian/watch files, as read by uscan(1), and use them to pick the
+newest upstream version out of a list of candidate URLs.
+
+A (version 4) watch file looks like:
+
+	version=4
+	opts="uversionmangle=s/-?rc/~rc/,dversionmangle=s/\+dfsg\d*$//" \
+	  https://example.com/downloads/ @PACKAGE@@ANY_VERSION@@ARCHIVE_EXT@
+
+Each line after the version is an Entry: some options, a URL to look at,
+a regular expression matching the links to upstream tarballs on that page,
+and, optionally, the Debian version to compare against and a script to run.
+
+Fetching and scraping the page is left to the caller. Given the links
+found there, Entry.Newest applies the pattern and the uversionmangle
+rules, and returns the link to the newest upstream release.
+
+A Downloader then fetches the Candidate, checks its signature (for
+Entries with pgpsigurlmangle) against upstream's keys, removes anything
+listed in debian/copyright's Files-Excluded, and writes the result out
+as the .orig.tar, named as dpkg-source expects.
+
+Mangle rules are Perl substitutions (s/pattern/replacement/flags) and
+transliterations (tr/from/to/), run with Go's regexp package, so Perl-only
+regular expression syntax, such as lookahead, is rejected.
+*/
+package watch // import "pault.ag/go/debian/watch"
@@ -0,0 +1,297 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package watch // import "pault.ag/go/debian/watch"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+
+	"pault.ag/go/debian/copyright"
+	"pault.ag/go/debian/repack"
+)
+
+// Downloader {{{
+
+// A Downloader fetches the upstream tarball an Entry picked, and turns it
+// into the .orig.tar the source package is built from, as uscan(1) does.
+type Downloader struct {
+	// HTTP client to use for all requests. If nil, http.DefaultClient
+	// is used.
+	HTTPClient *http.Client
+
+	// Upstream's signing keys, as in debian/upstream/signing-key.asc.
+	// Signatures are checked for every Entry with a pgpsigurlmangle
+	// option, and it's an error for that to be set without a Keyring.
+	Keyring openpgp.EntityList
+
+	// If set, any path matching the Header's Files-Excluded patterns is
+	// removed from the tarball, which is then repacked as a .tar.xz (as
+	// mk-origtargz does), and the Entry's repacksuffix (such as "+dfsg")
+	// added to its version. The Header's FilesExcluded are compiled (see
+	// copyright.Header.Compile) before they're used, so a Copyright built
+	// by hand works as well as one from copyright.Parse.
+	Copyright *copyright.Copyright
+}
+
+// A Download is an upstream tarball fetched by a Downloader.
+type Download struct {
+	// Where the tarball was downloaded from.
+	URL string
+
+	// The upstream version, after uversionmangle, and the version of the
+	// .orig.tar, which has the repacksuffix on the end if it was
+	// repacked.
+	Upstream string
+	Version  string
+
+	// Where the .orig.tar was written to, such as
+	// "../hello_2.10.orig.tar.gz".
+	Path string
+
+	// Who signed the tarball, if its signature was checked.
+	Signer *openpgp.Entity
+
+	// Paths removed from the tarball for matching Files-Excluded.
+	Excluded []string
+}
+
+func (d Downloader) httpClient() *http.Client {
+	if d.HTTPClient != nil {
+		return d.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (d Downloader) get(link string) (io.ReadCloser, error) {
+	resp, err := d.httpClient().Get(link)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Fetching %s: %s", link, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Download the Candidate (as returned by Entry.Newest) into dir as
+// "<pkg>_<version>.orig.tar.<ext>":
+//
+// The link is resolved against the Entry's URL, and downloadurlmangle
+// applied to it. If pgpsigurlmangle is set, it's applied to the link to
+// find the detached signature, which has to be good, and made by a key in
+// the Keyring. filenamemangle, if set, is applied to the link to name
+// the tarball; otherwise, the name is the last part of the link. Paths
+// matching the Copyright's Files-Excluded are removed. It's an error for
+// the Candidate's Version not to be a valid upstream version.
+func (d Downloader) Download(entry Entry, pkg string, candidate Candidate, dir string) (*Download, error) {
+	/* The version comes from upstream's web site, and goes in a filename */
+	if err := repack.CheckUpstreamVersion(candidate.Version); err != nil {
+		return nil, err
+	}
+	link, err := entry.resolve(candidate.Href)
+	if err != nil {
+		return nil, err
+	}
+	filename, err := entry.filename(link)
+	if err != nil {
+		return nil, err
+	}
+	ext, err := tarballExtension(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := d.fetch(link, dir)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	ret := Download{URL: link, Upstream: candidate.Version, Version: candidate.Version}
+	if ret.Signer, err = d.verify(entry, link, tmp); err != nil {
+		return nil, err
+	}
+
+	if d.Copyright != nil && len(d.Copyright.Header.FilesExcluded) != 0 {
+		if err := d.Copyright.Header.Compile(); err != nil {
+			return nil, err
+		}
+		suffix, _ := entry.Option("repacksuffix")
+		repacker := repack.FromCopyright(d.Copyright, suffix)
+		repacked, report, err := repacker.OrigTarball(tmp, dir, pkg, candidate.Version)
+		if err != nil {
+			return nil, err
+		}
+		if report.Repacked() {
+			ret.Version = repacker.Version(candidate.Version)
+			ret.Path = repacked
+			ret.Excluded = report.Removed
+			return &ret, nil
+		}
+	}
+
+	ret.Path = filepath.Join(dir, fmt.Sprintf("%s_%s.orig.tar.%s", pkg, ret.Version, ext))
+	if err := os.Rename(tmp, ret.Path); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Download the link into a temporary file in dir, returning its path.
+func (d Downloader) fetch(link, dir string) (string, error) {
+	body, err := d.get(link)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	f, err := os.CreateTemp(dir, ".download-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Check the upstream signature on the file at pathname, if the Entry has
+// a pgpsigurlmangle option, returning who made it.
+func (d Downloader) verify(entry Entry, link, pathname string) (*openpgp.Entity, error) {
+	if _, ok := entry.Option("pgpsigurlmangle"); !ok {
+		return nil, nil
+	}
+	if d.Keyring == nil {
+		return nil, fmt.Errorf("No keyring to check the upstream signature against")
+	}
+	mangles, err := entry.Mangles("pgpsigurlmangle")
+	if err != nil {
+		return nil, err
+	}
+	body, err := d.get(ApplyMangles(mangles, link))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	signature, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var signer *openpgp.Entity
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN PGP")) {
+		signer, err = openpgp.CheckArmoredDetachedSignature(d.Keyring, f, bytes.NewReader(signature))
+	} else {
+		signer, err = openpgp.CheckDetachedSignature(d.Keyring, f, bytes.NewReader(signature))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Bad upstream signature on %s: %s", link, err)
+	}
+	return signer, nil
+}
+
+// }}}
+
+// Links {{{
+
+// Resolve a link found on the Entry's page against its URL, and apply
+// downloadurlmangle to it.
+func (e Entry) resolve(href string) (string, error) {
+	base, err := url.Parse(e.URL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	mangles, err := e.Mangles("downloadurlmangle")
+	if err != nil {
+		return "", err
+	}
+	return ApplyMangles(mangles, base.ResolveReference(ref).String()), nil
+}
+
+// Work out what upstream called the tarball at the link: the last part
+// of it, or what filenamemangle makes of it.
+func (e Entry) filename(link string) (string, error) {
+	if _, ok := e.Option("filenamemangle"); !ok {
+		u, err := url.Parse(link)
+		if err != nil {
+			return "", err
+		}
+		return path.Base(u.Path), nil
+	}
+	mangles, err := e.Mangles("filenamemangle")
+	if err != nil {
+		return "", err
+	}
+	return path.Base(ApplyMangles(mangles, link)), nil
+}
+
+// Return the compression extension of a tarball's name, with shorthand
+// such as ".tgz" spelled out, since an .orig.tar has to be named in full.
+func tarballExtension(filename string) (string, error) {
+	lower := strings.ToLower(filename)
+	for _, short := range []struct{ suffix, ext string }{
+		{".tgz", "gz"},
+		{".tbz", "bz2"},
+		{".tbz2", "bz2"},
+		{".txz", "xz"},
+		{".tar.zstd", "zst"},
+	} {
+		if strings.HasSuffix(lower, short.suffix) {
+			return short.ext, nil
+		}
+	}
+	for _, ext := range []string{"gz", "xz", "bz2", "lzma", "zst"} {
+		if strings.HasSuffix(lower, ".tar."+ext) {
+			return ext, nil
+		}
+	}
+	return "", fmt.Errorf("Unsupported upstream archive '%s'", filename)
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,247 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package watch_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+
+	"pault.ag/go/debian/compression"
+	"pault.ag/go/debian/copyright"
+	"pault.ag/go/debian/testsupport"
+	"pault.ag/go/debian/watch"
+)
+
+/*
+ *
+ */
+
+func upstreamTarball(t *testing.T) []byte {
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range []string{
+		"hello-2.10/",
+		"hello-2.10/README",
+		"hello-2.10/vendor/",
+		"hello-2.10/vendor/lib.c",
+		"hello-2.10/doc/",
+		"hello-2.10/doc/manual.pdf",
+		"hello-2.10/doc/manual.texi",
+	} {
+		hdr := tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg}
+		body := "contents of " + name
+		if strings.HasSuffix(name, "/") {
+			hdr.Mode, hdr.Typeflag, body = 0755, tar.TypeDir, ""
+		}
+		hdr.Size = int64(len(body))
+		isok(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(body))
+		isok(t, err)
+	}
+	isok(t, tw.Close())
+	isok(t, gz.Close())
+	return buf.Bytes()
+}
+
+func tarballNames(t *testing.T, pathname string) []string {
+	f, err := os.Open(pathname)
+	isok(t, err)
+	defer f.Close()
+	r, err := compression.NewReader(f)
+	isok(t, err)
+	defer r.Close()
+
+	names := []string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		isok(t, err)
+		names = append(names, hdr.Name)
+	}
+}
+
+// Serve the tarball, and its signature from the given signer, from a
+// directory listing page.
+func upstreamServer(t *testing.T, tarball []byte, signer *openpgp.Entity) *httptest.Server {
+	signature := bytes.Buffer{}
+	isok(t, openpgp.ArmoredDetachSign(&signature, signer, bytes.NewReader(tarball), nil))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases/download/v2.10/source.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball)
+	})
+	mux.HandleFunc("/releases/download/v2.10/source.tar.gz.asc", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(signature.Bytes())
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func parseEntry(t *testing.T, text string) watch.Entry {
+	file, err := watch.Parse(strings.NewReader("version=4\n" + text + "\n"))
+	isok(t, err)
+	assert(t, len(file.Entries) == 1)
+	return file.Entries[0]
+}
+
+func TestDownload(t *testing.T) {
+	signer, err := testsupport.NewSigner()
+	isok(t, err)
+	tarball := upstreamTarball(t)
+	server := upstreamServer(t, tarball, signer)
+
+	entry := parseEntry(t, `opts="filenamemangle=s%.*/v?([\d.]+)/source(\.tar\..*)%hello-$1$2%,pgpsigurlmangle=s/$/.asc/" `+
+		server.URL+`/releases/ download/v@ANY_VERSION@/source@ARCHIVE_EXT@`)
+	candidate, err := entry.Newest("hello", []string{
+		"download/v2.9/source.tar.gz",
+		"download/v2.10/source.tar.gz",
+	})
+	isok(t, err)
+	assert(t, candidate.Version == "2.10")
+
+	dir := t.TempDir()
+	download, err := watch.Downloader{Keyring: testsupport.Keyring(signer)}.Download(entry, "hello", *candidate, dir)
+	isok(t, err)
+	assert(t, download.URL == server.URL+"/releases/download/v2.10/source.tar.gz")
+	assert(t, download.Version == "2.10")
+	assert(t, download.Signer != nil)
+	assert(t, download.Path == filepath.Join(dir, "hello_2.10.orig.tar.gz"))
+
+	written, err := os.ReadFile(download.Path)
+	isok(t, err)
+	assert(t, bytes.Equal(written, tarball))
+
+	/* Nothing else is left lying around */
+	entries, err := os.ReadDir(dir)
+	isok(t, err)
+	assert(t, len(entries) == 1)
+}
+
+func TestDownloadRepack(t *testing.T) {
+	signer, err := testsupport.NewSigner()
+	isok(t, err)
+	server := upstreamServer(t, upstreamTarball(t), signer)
+
+	c, err := copyright.Parse(strings.NewReader(`Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+Files-Excluded: vendor
+ doc/*.pdf
+`))
+	isok(t, err)
+
+	entry := parseEntry(t, `opts="repacksuffix=+dfsg,dversionmangle=s/\+dfsg//" `+
+		server.URL+`/releases/ download/v@ANY_VERSION@/source@ARCHIVE_EXT@`)
+	dir := t.TempDir()
+	download, err := watch.Downloader{Copyright: c}.Download(entry, "hello", watch.Candidate{
+		Href:    "download/v2.10/source.tar.gz",
+		Version: "2.10",
+	}, dir)
+	isok(t, err)
+	assert(t, download.Upstream == "2.10")
+	assert(t, download.Version == "2.10+dfsg")
+	assert(t, download.Signer == nil)
+	assert(t, download.Path == filepath.Join(dir, "hello_2.10+dfsg.orig.tar.xz"))
+
+	sort.Strings(download.Excluded)
+	assert(t, strings.Join(download.Excluded, " ") == "doc/manual.pdf vendor vendor/lib.c")
+	assert(t, strings.Join(tarballNames(t, download.Path), " ") ==
+		"hello-2.10/ hello-2.10/README hello-2.10/doc/ hello-2.10/doc/manual.texi")
+
+	entries, err := os.ReadDir(dir)
+	isok(t, err)
+	assert(t, len(entries) == 1)
+}
+
+func TestDownloadHandBuiltCopyright(t *testing.T) {
+	signer, err := testsupport.NewSigner()
+	isok(t, err)
+	server := upstreamServer(t, upstreamTarball(t), signer)
+
+	c := &copyright.Copyright{}
+	c.Header.FilesExcluded = []string{"vendor"}
+
+	entry := parseEntry(t, `opts="repacksuffix=+ds" `+server.URL+`/releases/ download/v@ANY_VERSION@/source@ARCHIVE_EXT@`)
+	download, err := watch.Downloader{Copyright: c}.Download(entry, "hello", watch.Candidate{
+		Href:    "download/v2.10/source.tar.gz",
+		Version: "2.10",
+	}, t.TempDir())
+	isok(t, err)
+	assert(t, download.Version == "2.10+ds")
+	assert(t, strings.Join(download.Excluded, " ") == "vendor vendor/lib.c")
+}
+
+func TestDownloadBadVersion(t *testing.T) {
+	signer, err := testsupport.NewSigner()
+	isok(t, err)
+	server := upstreamServer(t, upstreamTarball(t), signer)
+
+	entry := parseEntry(t, server.URL+`/releases/ download/v@ANY_VERSION@/source@ARCHIVE_EXT@`)
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "b", "c", "d")
+	isok(t, os.MkdirAll(dir, 0755))
+	_, err = watch.Downloader{}.Download(entry, "hello", watch.Candidate{
+		Href:    "download/v2.10/source.tar.gz",
+		Version: "1/../../../../evil",
+	}, dir)
+	notok(t, err)
+	entries, err := os.ReadDir(root)
+	isok(t, err)
+	assert(t, len(entries) == 1)
+}
+
+func TestDownloadBadSignature(t *testing.T) {
+	signer, err := testsupport.NewSigner()
+	isok(t, err)
+	other, err := testsupport.NewSigner()
+	isok(t, err)
+	server := upstreamServer(t, upstreamTarball(t), other)
+
+	entry := parseEntry(t, `opts="pgpsigurlmangle=s/$/.asc/" `+
+		server.URL+`/releases/ download/v@ANY_VERSION@/source@ARCHIVE_EXT@`)
+	candidate := watch.Candidate{Href: "download/v2.10/source.tar.gz", Version: "2.10"}
+
+	dir := t.TempDir()
+	_, err = watch.Downloader{Keyring: testsupport.Keyring(signer)}.Download(entry, "hello", candidate, dir)
+	notok(t, err)
+	_, err = watch.Downloader{}.Download(entry, "hello", candidate, dir)
+	notok(t, err)
+
+	entries, err := os.ReadDir(dir)
+	isok(t, err)
+	assert(t, len(entries) == 0)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,284 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package watch // import "pault.ag/go/debian/watch"
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Mangle {{{
+
+// A Mangle is a single rule of a *mangle option, such as the
+// "s/-rc/~rc/" of "uversionmangle=s/-rc/~rc/".
+type Mangle struct {
+	Rule string
+
+	/* s/// */
+	re          *regexp.Regexp
+	replacement string
+	global      bool
+
+	/* tr/// */
+	from []rune
+	to   []rune
+}
+
+// Apply the rule to the value.
+func (m Mangle) Apply(value string) string {
+	if m.re == nil {
+		return m.transliterate(value)
+	}
+	if m.global {
+		return m.re.ReplaceAllString(value, m.replacement)
+	}
+	match := m.re.FindStringSubmatchIndex(value)
+	if match == nil {
+		return value
+	}
+	replaced := m.re.ExpandString(nil, m.replacement, value, match)
+	return value[:match[0]] + string(replaced) + value[match[1]:]
+}
+
+func (m Mangle) transliterate(value string) string {
+	return strings.Map(func(r rune) rune {
+		for i, from := range m.from {
+			if from != r {
+				continue
+			}
+			/* As in Perl, a short replacement list repeats its last
+			 * character, and an empty one leaves things as they are */
+			if len(m.to) == 0 {
+				return r
+			}
+			if i >= len(m.to) {
+				return m.to[len(m.to)-1]
+			}
+			return m.to[i]
+		}
+		return r
+	}, value)
+}
+
+// Apply each of the rules to the value in turn.
+func ApplyMangles(mangles []Mangle, value string) string {
+	for _, mangle := range mangles {
+		value = mangle.Apply(value)
+	}
+	return value
+}
+
+// }}}
+
+// Parsing {{{
+
+// Parse a single rule, such as "s/-rc/~rc/g" or "tr/A-Z/a-z/".
+func ParseMangle(rule string) (Mangle, error) {
+	ret := Mangle{Rule: rule}
+	rule = strings.TrimSpace(rule)
+
+	var op string
+	switch {
+	case strings.HasPrefix(rule, "s"):
+		op, rule = "s", rule[1:]
+	case strings.HasPrefix(rule, "tr"):
+		op, rule = "tr", rule[2:]
+	case strings.HasPrefix(rule, "y"):
+		op, rule = "tr", rule[1:]
+	default:
+		return ret, fmt.Errorf("Unknown mangle rule '%s'", ret.Rule)
+	}
+
+	parts, err := splitRule(rule)
+	if err != nil {
+		return ret, fmt.Errorf("Malformed mangle rule '%s': %s", ret.Rule, err)
+	}
+	pattern, replacement, flags := parts[0], parts[1], parts[2]
+
+	if op == "tr" {
+		if flags != "" {
+			return ret, fmt.Errorf("Unsupported flags '%s' in mangle rule '%s'", flags, ret.Rule)
+		}
+		ret.from = expandRange(unescape(pattern))
+		ret.to = expandRange(unescape(replacement))
+		return ret, nil
+	}
+
+	for _, flag := range flags {
+		switch flag {
+		case 'g':
+			ret.global = true
+		case 'i':
+			pattern = "(?i)" + pattern
+		default:
+			return ret, fmt.Errorf("Unsupported flag '%c' in mangle rule '%s'", flag, ret.Rule)
+		}
+	}
+	if ret.re, err = regexp.Compile(pattern); err != nil {
+		return ret, fmt.Errorf("Bad pattern in mangle rule '%s': %s", ret.Rule, err)
+	}
+	ret.replacement = convertReplacement(replacement)
+	return ret, nil
+}
+
+// Parse a list of rules separated by ";", as a *mangle option holds.
+func ParseMangles(rules string) ([]Mangle, error) {
+	ret := []Mangle{}
+	for _, rule := range splitRules(rules) {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		mangle, err := ParseMangle(rule)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, mangle)
+	}
+	return ret, nil
+}
+
+// Split rules on ";", other than inside the rules themselves (where one
+// may be escaped, as "\;").
+func splitRules(rules string) []string {
+	ret := []string{}
+	start := 0
+	for i := 0; i < len(rules); i++ {
+		switch rules[i] {
+		case '\\':
+			i++
+		case ';':
+			ret = append(ret, rules[start:i])
+			start = i + 1
+		}
+	}
+	return append(ret, rules[start:])
+}
+
+// Split "/pattern/replacement/flags" on its delimiter (whichever character
+// it starts with), leaving escaped delimiters in place but unescaped.
+func splitRule(rule string) ([]string, error) {
+	if rule == "" {
+		return nil, fmt.Errorf("no delimiter")
+	}
+	delim := rule[0]
+	switch delim {
+	case '\\', ' ', '{', '(', '[', '<':
+		return nil, fmt.Errorf("unsupported delimiter '%c'", delim)
+	}
+
+	parts := []string{}
+	current := strings.Builder{}
+	for i := 1; i < len(rule); i++ {
+		c := rule[i]
+		switch {
+		case c == '\\' && i+1 < len(rule) && rule[i+1] == delim:
+			current.WriteByte(delim)
+			i++
+		case c == '\\' && i+1 < len(rule):
+			current.WriteByte(c)
+			current.WriteByte(rule[i+1])
+			i++
+		case c == delim && len(parts) < 2:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected three '%c'", delim)
+	}
+	return append(parts, current.String()), nil
+}
+
+// Turn a Perl replacement, with "$1", "${1}" or "\1" references to groups,
+// into one for regexp.Expand.
+func convertReplacement(replacement string) string {
+	out := strings.Builder{}
+	for i := 0; i < len(replacement); i++ {
+		c := replacement[i]
+		switch {
+		case c == '\\' && i+1 < len(replacement):
+			i++
+			if next := replacement[i]; next >= '0' && next <= '9' {
+				fmt.Fprintf(&out, "${%c}", next)
+			} else if next == '$' {
+				out.WriteString("$$")
+			} else {
+				out.WriteByte(next)
+			}
+		case c == '$' && i+1 < len(replacement) && replacement[i+1] >= '0' && replacement[i+1] <= '9':
+			j := i + 1
+			for j < len(replacement) && replacement[j] >= '0' && replacement[j] <= '9' {
+				j++
+			}
+			fmt.Fprintf(&out, "${%s}", replacement[i+1:j])
+			i = j - 1
+		case c == '$' && strings.HasPrefix(replacement[i:], "${"):
+			end := strings.Index(replacement[i:], "}")
+			if end < 0 {
+				out.WriteString("$$")
+				continue
+			}
+			out.WriteString(replacement[i : i+end+1])
+			i += end
+		case c == '$':
+			out.WriteString("$$")
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// Drop the backslashes from escaped characters.
+func unescape(value string) string {
+	out := strings.Builder{}
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		out.WriteByte(value[i])
+	}
+	return out.String()
+}
+
+// Expand the ranges in a tr list, such as "a-z".
+func expandRange(list string) []rune {
+	runes := []rune(list)
+	ret := []rune{}
+	for i := 0; i < len(runes); i++ {
+		if i+2 < len(runes) && runes[i+1] == '-' && runes[i] <= runes[i+2] {
+			for r := runes[i]; r <= runes[i+2]; r++ {
+				ret = append(ret, r)
+			}
+			i += 2
+			continue
+		}
+		ret = append(ret, runes[i])
+	}
+	return ret
+}
+
+// }}}
+
+// vim: foldmethod=marker
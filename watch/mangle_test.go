@@ -0,0 +1,73 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package watch_test
+
+import (
+	"testing"
+
+	"pault.ag/go/debian/watch"
+)
+
+/*
+ *
+ */
+
+func TestMangle(t *testing.T) {
+	for _, test := range []struct{ rule, in, out string }{
+		{`s/-rc/~rc/`, "1.0-rc1", "1.0~rc1"},
+		{`s/_/./`, "1_2_3", "1.2_3"},
+		{`s/_/./g`, "1_2_3", "1.2.3"},
+		{`s/RC/~rc/i`, "1.0rc1", "1.0~rc1"},
+		{`s/^v(\d+)/$1/`, "v12.1", "12.1"},
+		{`s/^v(\d+)/\1/`, "v12.1", "12.1"},
+		{`s/^(\d+)/${1}x/`, "12.1", "12x.1"},
+		{`s/\.tar/\$tar/`, "a.tar", "a$tar"},
+		{`s%/%-%g`, "a/b/c", "a-b-c"},
+		{`s/\//-/g`, "a/b/c", "a-b-c"},
+		{`tr/A-Z/a-z/`, "ABC-1", "abc-1"},
+		{`y/_/./`, "1_2", "1.2"},
+	} {
+		mangle, err := watch.ParseMangle(test.rule)
+		isok(t, err)
+		assert(t, mangle.Apply(test.in) == test.out)
+	}
+}
+
+func TestMangles(t *testing.T) {
+	mangles, err := watch.ParseMangles(`s/-?(rc|beta)/~$1/;s/_/./g;`)
+	isok(t, err)
+	assert(t, len(mangles) == 2)
+	assert(t, watch.ApplyMangles(mangles, "1_2-beta3") == "1.2~beta3")
+
+	for _, bad := range []string{
+		`x/a/b/`,
+		`s/a/b`,
+		`s/a/b/e`,
+		`s/(?=a)/b/`,
+		`s{a}{b}`,
+		`tr/a/b/d`,
+	} {
+		_, err := watch.ParseMangles(bad)
+		notok(t, err)
+	}
+}
+
+// vim: foldmethod=marker
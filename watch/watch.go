@@ -0,0 +1,374 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package watch // import "pault.ag/go/debian/watch"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pault.ag/go/debian/version"
+)
+
+// File {{{
+
+// A File is a parsed debian/watch file.
+type File struct {
+	// The version of the watch file format, from the "version=" line.
+	Version int
+	Entries []Entry
+}
+
+// An Entry is a single line of a watch file (after joining up any
+// continuation lines), describing where to look for upstream releases.
+type Entry struct {
+	// Options set with "opts=", such as "uversionmangle". Options that
+	// don't take a value, such as "decompress", are set to "".
+	Options map[string]string
+
+	// The page to look at, and the regular expression the links to
+	// upstream tarballs have to match.
+	URL     string
+	Pattern string
+
+	// What to compare the newest upstream version against ("debian",
+	// "ignore", "same", "previous", or a version), and the script to run
+	// after downloading it (such as "uupdate"). Either may be empty.
+	DebianVersion string
+	Script        string
+}
+
+// Return the value of an option, and whether it was set at all.
+func (e Entry) Option(name string) (string, bool) {
+	value, ok := e.Options[name]
+	return value, ok
+}
+
+// Return the mangle rules in an option (such as "filenamemangle").
+// uversionmangle and dversionmangle fall back to versionmangle, which
+// sets both.
+func (e Entry) Mangles(option string) ([]Mangle, error) {
+	rules, ok := e.Options[option]
+	if !ok && (option == "uversionmangle" || option == "dversionmangle") {
+		rules = e.Options["versionmangle"]
+	}
+	mangles, err := ParseMangles(rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", option, err)
+	}
+	return mangles, nil
+}
+
+// Apply the dversionmangle rules to the upstream part of a Debian
+// version, such as to drop a "+dfsg" suffix, so it can be compared with
+// the upstream versions the Entry finds.
+func (e Entry) MangleDebianVersion(upstream string) (string, error) {
+	mangles, err := e.Mangles("dversionmangle")
+	if err != nil {
+		return "", err
+	}
+	return ApplyMangles(mangles, upstream), nil
+}
+
+// }}}
+
+// Matching {{{
+
+// Substitutions uscan makes in patterns. @PACKAGE@ is handled separately,
+// as it depends on the source package.
+var substitutions = []struct{ from, to string }{
+	{"@ANY_VERSION@", `[-_]?[Vv]?(\d[\-+\.:\~\da-zA-Z]*)`},
+	{"@ARCHIVE_EXT@", `(?i:\.(?:tar\.xz|tar\.bz2|tar\.gz|tar\.zstd?|zip|tgz|tbz|txz))`},
+	{"@SIGNATURE_EXT@", `(?i:\.(?:tar\.xz|tar\.bz2|tar\.gz|tar\.zstd?|zip|tgz|tbz|txz))(?i:\.(?:asc|pgp|gpg|sig|sign))`},
+	{"@DEB_EXT@", `[\+~](?:debian|dfsg|ds|deb)(?:\.)?(?:\d+)?$`},
+}
+
+// Expand the @...@ substitutions in a pattern, for the given source
+// package.
+func expand(pattern, pkg string) string {
+	pattern = strings.ReplaceAll(pattern, "@PACKAGE@", regexp.QuoteMeta(pkg))
+	for _, substitution := range substitutions {
+		pattern = strings.ReplaceAll(pattern, substitution.from, substitution.to)
+	}
+	return pattern
+}
+
+// Compile the Entry's Pattern, with the substitutions uscan makes (such as
+// @PACKAGE@ or @ANY_VERSION@) done for the given source package. As with
+// uscan, the pattern has to match the whole link.
+func (e Entry) Regexp(pkg string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + expand(e.Pattern, pkg) + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("Bad pattern '%s': %s", e.Pattern, err)
+	}
+	return re, nil
+}
+
+// Work out the upstream version of a link, if it matches the Entry's
+// Pattern: the groups the Pattern captures, joined with ".", with the
+// uversionmangle rules applied. A link matches if all of it does, or, for
+// a Pattern without a "/", if its last path component does.
+func (e Entry) Match(pkg, href string) (string, bool, error) {
+	re, err := e.Regexp(pkg)
+	if err != nil {
+		return "", false, err
+	}
+	mangles, err := e.Mangles("uversionmangle")
+	if err != nil {
+		return "", false, err
+	}
+	upstream, ok := match(re, !strings.Contains(e.Pattern, "/"), href)
+	if !ok {
+		return "", false, nil
+	}
+	return ApplyMangles(mangles, upstream), true, nil
+}
+
+func match(re *regexp.Regexp, basename bool, href string) (string, bool) {
+	groups := re.FindStringSubmatch(href)
+	if groups == nil && basename {
+		groups = re.FindStringSubmatch(path.Base(href))
+	}
+	if groups == nil {
+		return "", false
+	}
+	parts := []string{}
+	for _, group := range groups[1:] {
+		if group != "" {
+			parts = append(parts, group)
+		}
+	}
+	return strings.Join(parts, "."), true
+}
+
+// A Candidate is a link that matched an Entry, and its upstream version.
+type Candidate struct {
+	Href    string
+	Version string
+}
+
+// Out of a list of links (such as those scraped from the page at URL),
+// return the one with the newest upstream version, comparing versions as
+// dpkg does. It is an error for no link to match.
+func (e Entry) Newest(pkg string, hrefs []string) (*Candidate, error) {
+	var best *Candidate
+	for _, href := range hrefs {
+		upstream, ok, err := e.Match(pkg, href)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if best == nil || compare(upstream, best.Version) > 0 {
+			best = &Candidate{Href: href, Version: upstream}
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("No link matches '%s'", e.Pattern)
+	}
+	return best, nil
+}
+
+// Compare upstream versions, which may have hyphens in, so can't be
+// parsed as Debian versions.
+func compare(a, b string) int {
+	return version.Compare(version.Version{Version: a}, version.Version{Version: b})
+}
+
+// }}}
+
+// Parsing {{{
+
+// Parse a debian/watch file off the disk.
+func ParseFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse a watch file. Version 3 and 4 files are understood; version 5
+// (which is deb822) and older formats are not.
+func Parse(reader io.Reader) (*File, error) {
+	lines, err := logicalLines(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("Empty watch file")
+	}
+
+	ret := File{Entries: []Entry{}}
+	key, value, ok := strings.Cut(lines[0].text, "=")
+	if !ok || strings.TrimSpace(key) != "version" {
+		return nil, fmt.Errorf("line %d: expected a version= line", lines[0].number)
+	}
+	if ret.Version, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+		return nil, fmt.Errorf("line %d: bad version: %s", lines[0].number, err)
+	}
+	if ret.Version != 3 && ret.Version != 4 {
+		return nil, fmt.Errorf("line %d: unsupported watch file version %d", lines[0].number, ret.Version)
+	}
+
+	for _, line := range lines[1:] {
+		entry, err := parseEntry(line.text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line.number, err)
+		}
+		ret.Entries = append(ret.Entries, *entry)
+	}
+	return &ret, nil
+}
+
+type line struct {
+	number int
+	text   string
+}
+
+// Read the lines of a watch file, joining up lines that end in a
+// backslash, and dropping comments and blank lines.
+func logicalLines(reader io.Reader) ([]line, error) {
+	ret := []line{}
+	scanner := bufio.NewScanner(reader)
+	current := strings.Builder{}
+	start := 0
+	for number := 1; scanner.Scan(); number++ {
+		text := scanner.Text()
+		if current.Len() == 0 {
+			start = number
+			if strings.HasPrefix(strings.TrimSpace(text), "#") {
+				continue
+			}
+		}
+		if strings.HasSuffix(text, "\\") {
+			current.WriteString(strings.TrimSuffix(text, "\\"))
+			continue
+		}
+		current.WriteString(text)
+		if text := strings.TrimSpace(current.String()); text != "" {
+			ret = append(ret, line{number: start, text: text})
+		}
+		current.Reset()
+	}
+	if text := strings.TrimSpace(current.String()); text != "" {
+		ret = append(ret, line{number: start, text: text})
+	}
+	return ret, scanner.Err()
+}
+
+// Parse a single (joined up) line into an Entry.
+func parseEntry(text string) (*Entry, error) {
+	entry := Entry{Options: map[string]string{}}
+
+	if strings.HasPrefix(text, "opts=") || strings.HasPrefix(text, "options=") {
+		_, text, _ = strings.Cut(text, "=")
+		var opts string
+		if strings.HasPrefix(text, `"`) {
+			end := strings.Index(text[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated opts")
+			}
+			opts, text = text[1:end+1], text[end+2:]
+		} else {
+			i := strings.IndexAny(text, " \t")
+			if i < 0 {
+				i = len(text)
+			}
+			opts, text = text[:i], text[i:]
+		}
+		for _, option := range splitOptions(opts) {
+			key, value, _ := strings.Cut(option, "=")
+			entry.Options[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Missing URL")
+	}
+	entry.URL, fields = fields[0], fields[1:]
+
+	/* The pattern may be given as the last path component of the URL */
+	if i := strings.LastIndex(entry.URL, "/"); i >= 0 && strings.Contains(entry.URL[i+1:], "(") {
+		entry.URL, entry.Pattern = entry.URL[:i+1], entry.URL[i+1:]
+	}
+	if entry.Pattern == "" {
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("Missing pattern")
+		}
+		entry.Pattern, fields = fields[0], fields[1:]
+	}
+
+	if len(fields) > 0 {
+		entry.DebianVersion, fields = fields[0], fields[1:]
+	}
+	if len(fields) > 0 {
+		entry.Script, fields = fields[0], fields[1:]
+	}
+	if len(fields) > 0 {
+		return nil, fmt.Errorf("Unexpected '%s'", strings.Join(fields, " "))
+	}
+	return &entry, nil
+}
+
+// Split options on commas, other than escaped ones ("\,"), or ones inside
+// a mangle rule's "{1,3}" style repetition.
+func splitOptions(opts string) []string {
+	ret := []string{}
+	current := strings.Builder{}
+	depth := 0
+	for i := 0; i < len(opts); i++ {
+		c := opts[i]
+		switch {
+		case c == '\\' && i+1 < len(opts) && opts[i+1] == ',':
+			current.WriteByte(',')
+			i++
+			continue
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case c == ',' && depth == 0:
+			if strings.TrimSpace(current.String()) != "" {
+				ret = append(ret, current.String())
+			}
+			current.Reset()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	if strings.TrimSpace(current.String()) != "" {
+		ret = append(ret, current.String())
+	}
+	return ret
+}
+
+// }}}
+
+// vim: foldmethod=marker
@@ -0,0 +1,149 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package watch_test
+
+import (
+	"log"
+	"strings"
+	"testing"
+
+	"pault.ag/go/debian/watch"
+)
+
+/*
+ *
+ */
+
+func isok(t *testing.T, err error) {
+	if err != nil {
+		log.Printf("Error! Error is not nil! %s\n", err)
+		t.FailNow()
+	}
+}
+
+func notok(t *testing.T, err error) {
+	if err == nil {
+		log.Printf("Error! Error is nil!\n")
+		t.FailNow()
+	}
+}
+
+func assert(t *testing.T, expr bool) {
+	if !expr {
+		log.Printf("Assertion failed!")
+		t.FailNow()
+	}
+}
+
+/*
+ *
+ */
+
+// {{{ test watch file
+const testWatch = `# Compulsory line, this is a version 4 file
+version=4
+
+opts="uversionmangle=s/-?(rc|beta)/~$1/;s/_/./g, \
+      dversionmangle=s/\+dfsg\d*$//,repacksuffix=+dfsg,decompress" \
+  https://example.com/releases/ @PACKAGE@@ANY_VERSION@@ARCHIVE_EXT@ debian uupdate
+
+# Pattern as part of the URL
+https://example.com/old/hello-(\d[\d.]*)\.tar\.gz
+`
+
+// }}}
+
+func TestParse(t *testing.T) {
+	file, err := watch.Parse(strings.NewReader(testWatch))
+	isok(t, err)
+	assert(t, file.Version == 4)
+	assert(t, len(file.Entries) == 2)
+
+	entry := file.Entries[0]
+	assert(t, entry.URL == "https://example.com/releases/")
+	assert(t, entry.Pattern == "@PACKAGE@@ANY_VERSION@@ARCHIVE_EXT@")
+	assert(t, entry.DebianVersion == "debian")
+	assert(t, entry.Script == "uupdate")
+	assert(t, entry.Options["repacksuffix"] == "+dfsg")
+	_, ok := entry.Option("decompress")
+	assert(t, ok)
+	assert(t, entry.Options["uversionmangle"] == "s/-?(rc|beta)/~$1/;s/_/./g")
+
+	entry = file.Entries[1]
+	assert(t, entry.URL == "https://example.com/old/")
+	assert(t, entry.Pattern == `hello-(\d[\d.]*)\.tar\.gz`)
+	assert(t, entry.DebianVersion == "")
+}
+
+func TestParseBad(t *testing.T) {
+	for _, bad := range []string{
+		"",
+		"# just a comment\n",
+		"https://example.com/ foo-(.*).tar.gz\n",
+		"version=5\n",
+		"version=4\nopts=\"decompress https://example.com/ foo-(.*).tar.gz\n",
+		"version=4\nhttps://example.com/\n",
+		"version=4\nhttps://example.com/ foo-(.*).tar.gz debian uupdate extra\n",
+	} {
+		_, err := watch.Parse(strings.NewReader(bad))
+		notok(t, err)
+	}
+}
+
+func TestNewest(t *testing.T) {
+	file, err := watch.Parse(strings.NewReader(testWatch))
+	isok(t, err)
+	entry := file.Entries[0]
+
+	upstream, ok, err := entry.Match("hello", "https://example.com/releases/hello-2.0-rc1.tar.gz")
+	isok(t, err)
+	assert(t, ok)
+	assert(t, upstream == "2.0~rc1")
+
+	_, ok, err = entry.Match("hello", "https://example.com/releases/hello-2.0.tar.gz.asc")
+	isok(t, err)
+	assert(t, !ok)
+
+	best, err := entry.Newest("hello", []string{
+		"hello-1.9.tar.gz",
+		"/releases/hello-2.0-rc1.tar.xz",
+		"/releases/hello-2.0.tar.gz",
+		"/releases/hello-2.0.tar.gz.asc",
+		"/releases/hello_1_10.zip",
+		"/releases/goodbye-3.0.tar.gz",
+	})
+	isok(t, err)
+	assert(t, best.Href == "/releases/hello-2.0.tar.gz")
+	assert(t, best.Version == "2.0")
+
+	_, err = entry.Newest("hello", []string{"/releases/goodbye-3.0.tar.gz"})
+	notok(t, err)
+
+	dversion, err := entry.MangleDebianVersion("1.9+dfsg2")
+	isok(t, err)
+	assert(t, dversion == "1.9")
+
+	best, err = file.Entries[1].Newest("hello", []string{"hello-1.2.tar.gz", "hello-1.10.tar.gz"})
+	isok(t, err)
+	assert(t, best.Version == "1.10")
+}
+
+// vim: foldmethod=marker